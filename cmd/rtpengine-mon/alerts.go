@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/chat"
+	"github.com/civilcoder55/rtpengine-mon/internal/doctor"
+	"github.com/civilcoder55/rtpengine-mon/internal/mail"
+	"github.com/civilcoder55/rtpengine-mon/internal/maintenance"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/snmp"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// alerts tells the NOC about critical conditions through SNMP traps, email
+// and chat, once when a condition starts and once when it clears rather
+// than for every check that sees it. Nothing is sent during the maintenance
+// windows covering an alert.
+type alerts struct {
+	traps        *snmp.Sender
+	mailer       *mail.Mailer
+	chat         *chat.Notifier
+	maintenance  *maintenance.Schedule
+	instance     string
+	mosThreshold float64
+
+	mu       sync.Mutex
+	full     map[string]bool
+	degraded map[string]bool
+}
+
+// alertKinds name the notifications in emails and chat.
+var alertKinds = map[snmp.Notification]string{
+	snmp.RTPEngineDown: "rtpengine.down",
+	snmp.RTPEngineUp:   "rtpengine.up",
+	snmp.DiskFull:      "disk.full",
+	snmp.DiskOK:        "disk.ok",
+	snmp.QualityAlert:  "quality.alert",
+	snmp.QualityOK:     "quality.ok",
+}
+
+// resolved are the notifications of conditions clearing.
+var resolved = map[snmp.Notification]bool{
+	snmp.RTPEngineUp: true,
+	snmp.DiskOK:      true,
+	snmp.QualityOK:   true,
+}
+
+// newAlerts sends alerts through traps, mailer and notifier, any of which
+// may be nil, outside the windows of schedule.
+func newAlerts(traps *snmp.Sender, mailer *mail.Mailer, notifier *chat.Notifier, schedule *maintenance.Schedule, instance string, mosThreshold float64) *alerts {
+	return &alerts{
+		traps:        traps,
+		mailer:       mailer,
+		chat:         notifier,
+		maintenance:  schedule,
+		instance:     instance,
+		mosThreshold: mosThreshold,
+		full:         make(map[string]bool),
+		degraded:     make(map[string]bool),
+	}
+}
+
+// send sends trap, whose call ID is redacted on the way out but for the
+// links of chat messages.
+func (a *alerts) send(trap snmp.Trap) {
+	kind := alertKinds[trap.Notification]
+	if w, ok := a.maintenance.Suppressed(maintenance.Subject{Kind: kind, Instance: a.instance, CallID: trap.CallID}, time.Now()); ok {
+		log.Printf("Alert %s suppressed by maintenance window %s", kind, w.ID)
+		return
+	}
+	summary := trap.Detail
+	if trap.Path != "" {
+		summary = trap.Path + ": " + summary
+	}
+	if a.chat != nil {
+		a.chat.Notify(context.Background(), chat.Alert{Kind: kind, Summary: summary, CallID: trap.CallID, Resolved: resolved[trap.Notification], Instance: a.instance})
+	}
+	trap.CallID = redact.CallID(trap.CallID)
+	if a.mailer != nil {
+		a.mailer.Notify(mail.Alert{Kind: kind, Summary: summary, CallID: trap.CallID})
+	}
+	if a.traps == nil {
+		return
+	}
+	trap.Instance = a.instance
+	if err := a.traps.Send(trap); err != nil {
+		log.Printf("SNMP: failed to send trap: %v", err)
+	}
+}
+
+// health sends rtpengineDown and rtpengineUp as the control connection
+// changes state.
+func (a *alerts) health(h rtpengine.Health) {
+	if h.Healthy {
+		a.send(snmp.Trap{Notification: snmp.RTPEngineUp, Detail: fmt.Sprintf("rtpengine answers pings again (%s)", h.Latency)})
+		return
+	}
+	a.send(snmp.Trap{Notification: snmp.RTPEngineDown, Detail: fmt.Sprintf("rtpengine unreachable after %d failed pings: %s", h.Failures, h.LastError)})
+}
+
+// quality sends qualityAlert when the MOS of a call falls below the
+// threshold and qualityOK when it is back above.
+func (a *alerts) quality(q spy.CallQuality) {
+	mos := q.MinMOS()
+	if mos == 0 {
+		return
+	}
+	low := mos < a.mosThreshold
+	a.mu.Lock()
+	changed := a.degraded[q.CallID] != low
+	if low {
+		a.degraded[q.CallID] = true
+	} else {
+		delete(a.degraded, q.CallID)
+	}
+	a.mu.Unlock()
+	if !changed {
+		return
+	}
+	trap := snmp.Trap{Notification: snmp.QualityOK, CallID: q.CallID, MOS: mos}
+	trap.Detail = fmt.Sprintf("MOS %.2f back above %.2f", mos, a.mosThreshold)
+	if low {
+		trap.Notification = snmp.QualityAlert
+		trap.Detail = fmt.Sprintf("MOS %.2f below %.2f", mos, a.mosThreshold)
+	}
+	a.send(trap)
+}
+
+// forget drops the quality state of a call nobody listens to anymore.
+func (a *alerts) forget(source *spy.Source) {
+	a.mu.Lock()
+	delete(a.degraded, source.CallID)
+	a.mu.Unlock()
+}
+
+// watchDisks checks the free space of the directories of d every interval
+// and sends diskFull and diskOK as directories fill up and get room again,
+// until ctx is cancelled.
+func (a *alerts) watchDisks(ctx context.Context, d *doctor.Doctor, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, r := range d.Disks() {
+			if r.Status == doctor.Skipped {
+				continue
+			}
+			full := r.Status == doctor.Fail
+			if a.full[r.Check] == full {
+				continue
+			}
+			a.full[r.Check] = full
+			trap := snmp.Trap{Notification: snmp.DiskOK, Path: strings.TrimPrefix(r.Check, "disk "), Detail: r.Detail}
+			if full {
+				trap.Notification = snmp.DiskFull
+			}
+			a.send(trap)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/doctor"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/tenant"
+)
+
+// runDoctor implements the "doctor" subcommand: it checks the environment
+// of the configuration and prints what to fix, exiting non-zero when a
+// check fails.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	timeout := fs.Duration("timeout", 30*time.Second, "deadline for all checks")
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("config load failed: %w", err)
+	}
+	var tenants *tenant.Registry
+	if cfg.TenantsFile != "" {
+		if tenants, err = tenant.Load(cfg.TenantsFile); err != nil {
+			return fmt.Errorf("tenants load failed: %w", err)
+		}
+	}
+
+	rtpClient, err := rtpengine.NewClient(cfg.RTPEngineAddr, ngOptions(cfg)...)
+	if err != nil {
+		return fmt.Errorf("rtpengine client init failed: %w", err)
+	}
+	defer rtpClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	results := doctor.New(cfg, rtpClient, doctorOptions(cfg, tenants)...).Run(ctx)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+	} else {
+		for _, r := range results {
+			fmt.Printf("[%-7s] %s: %s\n", r.Status, r.Check, r.Detail)
+			if r.Fix != "" {
+				fmt.Printf("          fix: %s\n", r.Fix)
+			}
+		}
+	}
+	if doctor.Failed(results) {
+		return errors.New("some checks failed")
+	}
+	return nil
+}
+
+// doctorOptions configures the doctor for cfg, checking the free space of
+// the directories the monitor writes to and of the tenants' recording paths.
+func doctorOptions(cfg *config.Config, tenants *tenant.Registry) []doctor.Option {
+	dirs := append(doctor.Dirs(cfg), cfg.DoctorDirs...)
+	if tenants != nil {
+		for _, t := range tenants.Tenants() {
+			if t.RecordingPath != "" {
+				dirs = append(dirs, t.RecordingPath)
+			}
+		}
+	}
+	return []doctor.Option{doctor.WithSTUNServer(cfg.DoctorSTUNServer), doctor.WithDirs(dirs...)}
+}
@@ -2,24 +2,66 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
-	"rtpengine-mon/internal/api"
-	"rtpengine-mon/internal/config"
-	"rtpengine-mon/internal/rtpengine"
-	"rtpengine-mon/internal/spy"
-	"rtpengine-mon/pkg/telemetry"
+	"github.com/civilcoder55/rtpengine-mon/internal/api"
+	"github.com/civilcoder55/rtpengine-mon/internal/automation"
+	"github.com/civilcoder55/rtpengine-mon/internal/bot"
+	"github.com/civilcoder55/rtpengine-mon/internal/bridge"
+	"github.com/civilcoder55/rtpengine-mon/internal/capacity"
+	"github.com/civilcoder55/rtpengine-mon/internal/chat"
+	"github.com/civilcoder55/rtpengine-mon/internal/cluster"
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/demux"
+	"github.com/civilcoder55/rtpengine-mon/internal/discovery"
+	"github.com/civilcoder55/rtpengine-mon/internal/doctor"
+	"github.com/civilcoder55/rtpengine-mon/internal/logfile"
+	"github.com/civilcoder55/rtpengine-mon/internal/mail"
+	"github.com/civilcoder55/rtpengine-mon/internal/maintenance"
+	"github.com/civilcoder55/rtpengine-mon/internal/natspub"
+	"github.com/civilcoder55/rtpengine-mon/internal/notice"
+	"github.com/civilcoder55/rtpengine-mon/internal/quota"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/slo"
+	"github.com/civilcoder55/rtpengine-mon/internal/snmp"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+	"github.com/civilcoder55/rtpengine-mon/internal/systemd"
+	"github.com/civilcoder55/rtpengine-mon/internal/tenant"
+	"github.com/civilcoder55/rtpengine-mon/internal/watermark"
+	"github.com/civilcoder55/rtpengine-mon/pkg/telemetry"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "probe" {
+		if err := runProbe(os.Args[2:]); err != nil {
+			log.Fatalf("probe failure: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		if err := runDoctor(os.Args[2:]); err != nil {
+			log.Fatalf("doctor: %v", err)
+		}
+		return
+	}
+
 	if err := run(); err != nil {
 		log.Fatalf("application failure: %v", err)
 	}
@@ -34,8 +76,37 @@ func run() error {
 		return fmt.Errorf("config load failed: %w", err)
 	}
 
+	if cfg.LogFile != "" {
+		lf, err := logfile.Open(cfg.LogFile)
+		if err != nil {
+			return fmt.Errorf("log file open failed: %w", err)
+		}
+		defer lf.Close()
+		log.SetOutput(lf)
+
+		reopen := make(chan os.Signal, 1)
+		notifyLogReopen(reopen)
+		go func() {
+			for range reopen {
+				if err := lf.Reopen(); err != nil {
+					log.Printf("Failed to reopen log file: %v", err)
+				}
+			}
+		}()
+	}
+
+	if len(cfg.Labels) > 0 {
+		log.SetPrefix(logPrefix(cfg.Labels))
+		log.SetFlags(log.Flags() | log.Lmsgprefix)
+	}
+
+	if cfg.Anonymize {
+		redact.Enable(cfg.AnonymizeSalt)
+		log.Println("Anonymized mode enabled: call IDs are hashed and tags stripped from telemetry, logs and audit events")
+	}
+
 	// 2. Setup Telemetry
-	tracerProvider, err := telemetry.InitTracer(ctx, cfg.TelemetryEndpoint)
+	tracerProvider, err := telemetry.InitTracer(ctx, cfg.TelemetryEndpoint, cfg.Labels)
 	if err != nil {
 		return fmt.Errorf("telemetry init failed: %w", err)
 	}
@@ -50,51 +121,495 @@ func run() error {
 		log.Println("Telemetry disabled (no endpoint configured)")
 	}
 
+	meterProvider, metricsHandler := telemetry.InitMeter(cfg.Labels)
+	defer meterProvider.Shutdown(context.Background())
+
 	// 3. Connect to RTPEngine
-	rtpClient, err := rtpengine.NewClient(cfg.RTPEngineAddr)
-	if err != nil {
-		return fmt.Errorf("rtpengine client init failed: %w", err)
+	rtpOpts := ngOptions(cfg)
+	rtpOpts = append(rtpOpts, rtpengine.WithSubscriptionTags(cfg.InstanceID))
+	var ngLog *rtpengine.NGLog
+	if cfg.NGDebugCapture > 0 {
+		ngLog = rtpengine.NewNGLog(cfg.NGDebugCapture)
+		rtpOpts = append(rtpOpts, rtpengine.WithNGLog(ngLog))
+		log.Printf("Capturing the last %d NG exchanges at /debug/ng", cfg.NGDebugCapture)
+	}
+	var chaos *rtpengine.Chaos
+	if cfg.ChaosHooks {
+		chaos = rtpengine.NewChaos()
+		rtpOpts = append(rtpOpts, rtpengine.WithChaos(chaos))
+		log.Println("WARNING: chaos hooks enabled; /debug/chaos injects NG failures")
+	}
+	if cfg.ReadOnly {
+		rtpOpts = append(rtpOpts, rtpengine.WithReadOnly())
+		log.Println("Read-only mode: spying and call changes are refused")
+	}
+	nodes := cfg.RTPEngineNodes
+	discover := cfg.RTPEngineSRV != "" || cfg.RTPEngineK8sSelector != ""
+	if len(nodes) == 0 && !discover {
+		nodes = []config.RTPEngineNode{{Name: "local", Addr: cfg.RTPEngineAddr}}
+	}
+	var registry []rtpengine.Node
+	var samplers []*capacity.Sampler
+	for _, node := range nodes {
+		clock := rtpengine.NewClock(cfg.CapacityWindow)
+		opts := append(slices.Clip(rtpOpts), rtpengine.WithClock(clock))
+		if len(nodes) > 1 {
+			opts = append(opts, rtpengine.WithInstanceName(node.Name))
+		}
+		client, err := rtpengine.NewClient(node.Addr, opts...)
+		if err != nil {
+			return fmt.Errorf("rtpengine client init failed for %s: %w", node.Name, err)
+		}
+		log.Printf("Connected to RTPEngine %s at %s", node.Name, node.Addr)
+		registry = append(registry, rtpengine.Node{Name: node.Name, Client: client})
+
+		sampler := capacity.NewSampler(node.Name, node.Addr, client, cfg.CapacitySampleInterval,
+			int(cfg.CapacityWindow/cfg.CapacitySampleInterval)+1)
+		sampler.SetClock(clock)
+		samplers = append(samplers, sampler)
+	}
+	var rtpClient rtpengine.Client
+	var owners *rtpengine.Registry
+	switch {
+	case discover:
+		// Discovered instances are not sampled for capacity.
+		owners = rtpengine.NewRegistry(nil)
+		watcher, err := newDiscovery(cfg, owners, rtpOpts)
+		if err != nil {
+			return fmt.Errorf("rtpengine discovery init failed: %w", err)
+		}
+		if err := watcher.Refresh(ctx); err != nil {
+			log.Printf("No rtpengine instance discovered yet: %v", err)
+		}
+		go watcher.Run(ctx)
+		rtpClient = owners
+	case len(registry) > 1:
+		owners = rtpengine.NewRegistry(registry)
+		rtpClient = owners
+	default:
+		rtpClient = registry[0].Client
 	}
 	defer rtpClient.Close()
-	log.Printf("Connected to RTPEngine at %s", cfg.RTPEngineAddr)
 
 	// 4. Start Spy Service (Handles WebRTC)
-	tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{
-		IP:   net.ParseIP(cfg.WebRTCICEAddress),
-		Port: cfg.WebRTCICEPort,
-	})
+	tlsConfig, err := loadTLSConfig(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to listen on TCP %s:%d: %w", cfg.WebRTCICEAddress, cfg.WebRTCICEPort, err)
+		return fmt.Errorf("tls config load failed: %w", err)
+	}
+
+	httpListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.HTTPPort))
+	if err != nil {
+		return fmt.Errorf("failed to listen on TCP :%d: %w", cfg.HTTPPort, err)
+	}
+
+	var tcpListener net.Listener
+	if cfg.WebRTCICEShareHTTP {
+		dm := demux.New(httpListener, tlsConfig)
+		go dm.Serve()
+		httpListener = dm.HTTP()
+		tcpListener = dm.ICE()
+		log.Printf("WebRTC ICE TCP sharing HTTP port %d", cfg.HTTPPort)
+	} else {
+		iceListener, err := net.ListenTCP("tcp", &net.TCPAddr{
+			IP:   net.ParseIP(cfg.WebRTCICEAddress),
+			Port: cfg.WebRTCICEPort,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to listen on TCP %s:%d: %w", cfg.WebRTCICEAddress, cfg.WebRTCICEPort, err)
+		}
+		tcpListener = iceListener
+		if tlsConfig != nil {
+			httpListener = tls.NewListener(httpListener, tlsConfig)
+		}
+		log.Printf("WebRTC Listening for ICE TCP at %s", tcpListener.Addr())
 	}
-	log.Printf("WebRTC Listening for ICE TCP at %s", tcpListener.Addr())
 
 	spyService, err := spy.NewService(cfg, rtpClient, tcpListener)
 	if err != nil {
 		return fmt.Errorf("spy service init failed: %w", err)
 	}
 
+	if cfg.PCMExportURL != "" {
+		pub, err := natspub.New(cfg.PCMExportURL, cfg.PCMExportQueue)
+		if err != nil {
+			return fmt.Errorf("pcm export init failed: %w", err)
+		}
+		go pub.Run(ctx, func(err error) { log.Printf("PCM export: NATS connection failed: %v", err) })
+		exportPCM(pub, cfg.PCMExportSubject, cfg.InstanceID, cfg.Labels, spyService)
+		log.Printf("Exporting PCM of subscribed legs to %s.{from,to}", cfg.PCMExportSubject)
+	}
+
+	if cfg.StateFile != "" {
+		snap, err := spy.LoadSnapshot(cfg.StateFile)
+		if err != nil {
+			return fmt.Errorf("state restore failed: %w", err)
+		}
+		// An unresponsive rtpengine must not hold up startup for long;
+		// calls not restored by then are left to the orphan cleanup.
+		restoreCtx, cancelRestore := context.WithTimeout(ctx, 30*time.Second)
+		spyService.Restore(restoreCtx, snap)
+		cancelRestore()
+		log.Printf("Restored %d sources from %s", len(spyService.Snapshot().Sources), cfg.StateFile)
+
+		persist := func(*spy.Source) {
+			if err := spyService.SaveSnapshot(cfg.StateFile); err != nil {
+				log.Printf("Failed to save state snapshot: %v", err)
+			}
+		}
+		spyService.OnSourceCreated(persist)
+		spyService.OnSourceClosed(persist)
+		persist(nil)
+	}
+
+	// Release what a crashed predecessor left subscribed before anything
+	// creates new subscriptions. A read-only monitor leaves them alone.
+	if !cfg.ReadOnly {
+		if released, err := spyService.CleanupOrphans(ctx); err != nil {
+			log.Printf("Orphaned subscription cleanup failed: %v", err)
+		} else if released > 0 {
+			log.Printf("Released %d orphaned subscriptions", released)
+		}
+	}
+
+	if cfg.QualityPushInterval > 0 {
+		go spyService.RunQualityPush(ctx, cfg.QualityPushInterval)
+	}
+
+	if cfg.SpyFollowInterval > 0 {
+		go spyService.RunFollow(ctx, cfg.SpyFollowInterval)
+		log.Printf("Following transfers of watched calls every %s", cfg.SpyFollowInterval)
+	}
+
+	var st store.Store
+	var tenants *tenant.Registry
+	if cfg.StoreDriver != "" {
+		st, err = store.Open(ctx, cfg.StoreDriver, cfg.StoreDSN)
+		if err != nil {
+			return fmt.Errorf("store init failed: %w", err)
+		}
+		defer st.Close()
+
+		if cfg.TenantsFile != "" {
+			if tenants, err = tenant.Load(cfg.TenantsFile); err != nil {
+				return fmt.Errorf("tenants load failed: %w", err)
+			}
+			ts, err := tenant.OpenStore(ctx, tenants, st)
+			if err != nil {
+				return fmt.Errorf("tenant store init failed: %w", err)
+			}
+			defer ts.Close()
+			st = ts
+			log.Printf("Routing history and recordings of %d tenants", len(tenants.Tenants()))
+		}
+		recordSpyActivity(st, spyService, cfg.Labels)
+
+		if info, err := st.SchemaInfo(ctx); err == nil {
+			log.Printf("Persisting activity to %s store (schema version %d)", cfg.StoreDriver, info.Version)
+		}
+	}
+
 	// 5. Setup HTTP Server
-	apiHandler := api.NewHandler(rtpClient, spyService)
+	var handlerOpts []api.HandlerOption
+	if owners != nil {
+		handlerOpts = append(handlerOpts, api.WithCallOwners(owners))
+	}
+	var keys map[string]spy.Priority
+	if len(cfg.APIKeys) > 0 {
+		keys = make(map[string]spy.Priority, len(cfg.APIKeys))
+		for key, name := range cfg.APIKeys {
+			if keys[key], err = spy.ParsePriority(name); err != nil {
+				return fmt.Errorf("invalid API_KEYS entry: %w", err)
+			}
+		}
+		handlerOpts = append(handlerOpts, api.WithAPIKeys(keys))
+	}
+	if cfg.SpyDedupeWindow > 0 {
+		handlerOpts = append(handlerOpts, api.WithSpyDedupe(cfg.SpyDedupeWindow))
+	}
+	if tenants != nil {
+		handlerOpts = append(handlerOpts, api.WithTenants(tenants))
+	}
+	if ngLog != nil {
+		handlerOpts = append(handlerOpts, api.WithNGLog(ngLog))
+	}
+	if chaos != nil {
+		handlerOpts = append(handlerOpts, api.WithChaos(chaos))
+	}
+	if cfg.WatermarkKey != "" {
+		handlerOpts = append(handlerOpts, api.WithWatermark(watermark.NewKey(cfg.WatermarkKey)))
+		log.Println("Watermarking spy and exported audio")
+	}
+	if cfg.ScreenPopURL != "" {
+		handlerOpts = append(handlerOpts, api.WithScreenPop(cfg.ScreenPopURL))
+		log.Println("Posting screen pops of spy sessions to the CRM webhook")
+	}
+	if cfg.PlayMediaDir != "" {
+		handlerOpts = append(handlerOpts, api.WithMediaDir(cfg.PlayMediaDir))
+	}
+	var notices *notice.Notifier
+	if cfg.AgentNoticeWebhook != "" || cfg.AgentNoticeSIPURI != "" {
+		n, err := notice.New(cfg.AgentNoticeWebhook, cfg.AgentNoticeSIPURI)
+		if err != nil {
+			return fmt.Errorf("agent notices init failed: %w", err)
+		}
+		notices = n
+		handlerOpts = append(handlerOpts, api.WithAgentNotices(notices))
+	}
+	if cfg.RecordingConsentAnnouncement != "" {
+		handlerOpts = append(handlerOpts, api.WithRecordingConsent(cfg.RecordingConsentAnnouncement, cfg.RecordingConsentRequired))
+	}
+	if cfg.ReadOnly {
+		handlerOpts = append(handlerOpts, api.WithReadOnly())
+	}
+	if len(cfg.Labels) > 0 {
+		handlerOpts = append(handlerOpts, api.WithLabels(cfg.Labels))
+	}
+	if cfg.ErasureSigningKey != "" {
+		handlerOpts = append(handlerOpts, api.WithErasureKey([]byte(cfg.ErasureSigningKey)))
+	}
+	var traps *snmp.Sender
+	if cfg.SNMPTrapTarget != "" {
+		traps, err = snmp.NewSender(cfg.SNMPTrapTarget, cfg.SNMPCommunity, cfg.SNMPEnterpriseOID)
+		if err != nil {
+			return fmt.Errorf("snmp init failed: %w", err)
+		}
+		defer traps.Close()
+		log.Printf("Sending SNMP traps of critical events to %s", cfg.SNMPTrapTarget)
+	}
+	var mailer *mail.Mailer
+	if cfg.SMTPAddr != "" {
+		mailOpts := []mail.Option{
+			mail.WithWindow(cfg.AlertEmailWindow),
+			mail.WithRateLimit(cfg.AlertEmailMaxPerHour),
+			mail.WithInstance(cfg.InstanceID, cfg.Labels),
+		}
+		if cfg.SMTPUsername != "" {
+			mailOpts = append(mailOpts, mail.WithAuth(cfg.SMTPUsername, cfg.SMTPPassword))
+		}
+		if cfg.AlertEmailTemplate != "" {
+			tmpl, err := mail.ParseTemplate(cfg.AlertEmailTemplate)
+			if err != nil {
+				return fmt.Errorf("email template load failed: %w", err)
+			}
+			mailOpts = append(mailOpts, mail.WithTemplate(tmpl))
+		}
+		mailer = mail.New(cfg.SMTPAddr, cfg.AlertEmailFrom, cfg.AlertEmailTo, mailOpts...)
+		go mailer.Run(ctx)
+		handlerOpts = append(handlerOpts, api.WithMailer(mailer))
+		log.Printf("Emailing alerts to %s, collected over %s", strings.Join(cfg.AlertEmailTo, ", "), cfg.AlertEmailWindow)
+	}
+	var notifier *chat.Notifier
+	if cfg.ChatChannelsFile != "" {
+		channels, err := chat.Load(cfg.ChatChannelsFile)
+		if err != nil {
+			return fmt.Errorf("chat channels load failed: %w", err)
+		}
+		if notifier, err = chat.New(channels, cfg.DashboardURL); err != nil {
+			return fmt.Errorf("chat channels load failed: %w", err)
+		}
+		log.Printf("Posting alerts to %d chat channels", len(channels))
+	}
+	// Singleton jobs (polling, sampling, alerting) run on one replica only:
+	// the holder of the "leader" lease when clustered, otherwise this one.
+	var elector *cluster.Elector
+	if cfg.ClusterAdvertiseURL != "" {
+		c := cluster.New(st, store.Instance{ID: cfg.ClusterInstanceID, URL: cfg.ClusterAdvertiseURL}, cfg.ClusterHeartbeat)
+		go c.Run(ctx)
+		elector = c.Elector(st, "leader")
+		handlerOpts = append(handlerOpts, api.WithCluster(c))
+		log.Printf("Sharding sources as cluster member %s (%s)", cfg.ClusterInstanceID, cfg.ClusterAdvertiseURL)
+	}
+	leading := func() bool { return elector == nil || elector.IsLeader() }
+	windows := maintenance.NewSchedule()
+	handlerOpts = append(handlerOpts, api.WithMaintenance(windows))
+	var critical *alerts
+	if traps != nil || mailer != nil || notifier != nil {
+		critical = newAlerts(traps, mailer, notifier, windows, cfg.InstanceID, cfg.SNMPMOSThreshold)
+		spyService.OnQuality(critical.quality)
+		spyService.OnSourceClosed(critical.forget)
+	}
+	if cfg.RTPEnginePingInterval > 0 {
+		health := rtpengine.NewHealthChecker(rtpClient, cfg.RTPEnginePingInterval, cfg.RTPEnginePingFailures)
+		health.OnChange(func(h rtpengine.Health) {
+			if h.Healthy {
+				log.Printf("rtpengine control connection recovered (ping %s)", h.Latency)
+			} else {
+				log.Printf("rtpengine control connection lost after %d failed pings: %s", h.Failures, h.LastError)
+			}
+		})
+		if critical != nil {
+			health.OnChange(func(h rtpengine.Health) {
+				if leading() {
+					critical.health(h)
+				}
+			})
+		}
+		go health.Run(ctx)
+		handlerOpts = append(handlerOpts, api.WithHealth(health))
+	}
+	quotas := quota.NewTracker(cfg.QuotaWindow,
+		quota.Limits{Requests: cfg.QuotaGlobalRequests, SpyMinutes: cfg.QuotaGlobalSpyMinutes},
+		quota.Limits{Requests: cfg.QuotaKeyRequests, SpyMinutes: cfg.QuotaKeySpyMinutes})
+	if tenants != nil {
+		for _, t := range tenants.Tenants() {
+			quotas.SetTenant(t.Name, t.Quota)
+		}
+	}
+	handlerOpts = append(handlerOpts, api.WithQuotas(quotas))
+	objectives := slo.NewTracker(slo.Defaults)
+	objectives.OnAlert(func(a slo.Alert) {
+		state := "resolved"
+		if a.Firing {
+			state = "firing"
+		}
+		log.Printf("SLO alert %s: %s %s (burn rate %.1f)", state, a.Objective, a.Severity, a.BurnRate)
+		if w, ok := windows.Suppressed(maintenance.Subject{Kind: "slo", Instance: cfg.InstanceID}, a.Time); ok {
+			log.Printf("SLO alert %s suppressed by maintenance window %s", a.Objective, w.ID)
+			return
+		}
+		summary := fmt.Sprintf("%s %s alert %s (burn rate %.1f)", a.Objective, a.Severity, state, a.BurnRate)
+		if mailer != nil {
+			mailer.Notify(mail.Alert{Kind: "slo", Summary: summary, Time: a.Time})
+		}
+		if notifier != nil {
+			notifier.Notify(ctx, chat.Alert{Kind: "slo", Summary: summary, Resolved: !a.Firing, Instance: cfg.InstanceID, Time: a.Time})
+		}
+	})
+	handlerOpts = append(handlerOpts, api.WithSLO(objectives))
+	handlerOpts = append(handlerOpts, api.WithCapacity(samplers...))
+
+	if len(cfg.AutomationScripts) > 0 {
+		scripts, err := automation.Load(cfg.AutomationScripts)
+		if err != nil {
+			return fmt.Errorf("automation scripts load failed: %w", err)
+		}
+		handlerOpts = append(handlerOpts, api.WithAutomation(scripts))
+		log.Printf("Running %d automation scripts for calls starting and ending", len(scripts.Scripts()))
+	}
+	var audioBridge *bridge.Bridge
+	if len(cfg.BridgeRTPDestinations) > 0 || cfg.BridgeRTSPAddr != "" {
+		audioBridge = bridge.New(spyService, bridge.WithAPIKeys(keys), bridge.WithDestinations(cfg.BridgeRTPDestinations))
+		handlerOpts = append(handlerOpts, api.WithBridge(audioBridge))
+	}
+	doc := doctor.New(cfg, rtpClient, append(doctorOptions(cfg, tenants), doctor.InProcess())...)
+	if critical != nil {
+		go critical.watchDisks(ctx, doc, cfg.SNMPDiskInterval)
+	}
+	handlerOpts = append(handlerOpts, api.WithDoctor(doc))
+	handlerOpts = append(handlerOpts, api.WithBuildInfo(buildInfo(map[string]bool{
+		"recording":    !cfg.ReadOnly,
+		"history":      st != nil,
+		"multi_engine": owners != nil,
+		"cluster":      cfg.ClusterAdvertiseURL != "",
+		"tenants":      tenants != nil,
+		"shadow":       cfg.ShadowPercent > 0,
+		"watches":      cfg.WatchInterval > 0,
+		"pcm_export":   cfg.PCMExportURL != "",
+		"bot":          cfg.BotGRPCAddr != "",
+		"bridge":       audioBridge != nil,
+		"automation":   len(cfg.AutomationScripts) > 0,
+		"snmp":         traps != nil,
+		"email":        mailer != nil,
+		"chat":         notifier != nil,
+		"agent_notice": notices != nil,
+		"watermark":    cfg.WatermarkKey != "",
+		"anonymize":    cfg.Anonymize,
+		"read_only":    cfg.ReadOnly,
+	})))
+	apiHandler := api.NewHandler(rtpClient, spyService, st, handlerOpts...)
+	singletons := func(ctx context.Context) {
+		// Every replica sees every call, so shadow subscriptions and media
+		// polling are left to one of them.
+		if cfg.ShadowPercent > 0 {
+			go spyService.RunShadow(ctx, spy.ShadowConfig{
+				Percent:    cfg.ShadowPercent,
+				MaxSources: cfg.ShadowMaxSources,
+				Interval:   cfg.ShadowInterval,
+			})
+			log.Printf("Shadow subscribing %.2f%% of calls (max %d sources)", cfg.ShadowPercent, cfg.ShadowMaxSources)
+		}
+		if cfg.MediaHistoryInterval > 0 {
+			go spyService.RunMediaPoll(ctx, cfg.MediaHistoryInterval)
+			log.Printf("Recording media history of all calls every %s", cfg.MediaHistoryInterval)
+		}
+		go objectives.Run(ctx, cfg.SLOEvaluationInterval)
+		for _, sampler := range samplers {
+			go sampler.Run(ctx)
+		}
+		if cfg.CallFeedInterval > 0 {
+			go apiHandler.RunCallFeed(ctx, cfg.CallFeedInterval)
+		}
+		if cfg.WatchInterval > 0 {
+			go apiHandler.RunWatches(ctx, cfg.WatchInterval)
+		}
+		if len(cfg.AutomationScripts) > 0 {
+			go apiHandler.RunAutomation(ctx, cfg.AutomationInterval)
+		}
+	}
+	if elector != nil {
+		// lead's context is cancelled on losing the lease, stopping the jobs
+		// so the next leader can start them.
+		go elector.Run(ctx, singletons)
+	} else {
+		singletons(ctx)
+	}
 	mux := http.NewServeMux()
 	apiHandler.RegisterRoutes(mux)
-	
+	mux.Handle("/metrics", metricsHandler)
+
 	// Serve static files
-	mux.Handle("/", http.FileServer(http.Dir("./static")))
+	mux.Handle("/", http.FileServer(http.Dir(staticDir())))
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.HTTPPort),
+		Addr:    httpListener.Addr().String(),
 		Handler: mux,
 	}
+	if !cfg.HTTP2 {
+		// A non-nil empty map keeps net/http from negotiating h2.
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
 
 	// 6. Start Server in goroutine
 	srvErr := make(chan error, 1)
 	go func() {
 		log.Printf("Starting HTTP server on %s", server.Addr)
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := server.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			srvErr <- fmt.Errorf("http server failed: %w", err)
 		}
 	}()
 
+	if cfg.BotGRPCAddr != "" {
+		botListener, err := net.Listen("tcp", cfg.BotGRPCAddr)
+		if err != nil {
+			return fmt.Errorf("bot api listen failed: %w", err)
+		}
+		botServer := bot.New(spyService, rtpClient, bot.WithAPIKeys(keys), bot.WithMaxInject(cfg.BotMaxInject), bot.WithNotices(notices))
+		go func() {
+			log.Printf("Starting bot gRPC API on %s", botListener.Addr())
+			if err := botServer.Serve(ctx, botListener); err != nil {
+				srvErr <- fmt.Errorf("bot api failed: %w", err)
+			}
+		}()
+	}
+
+	if cfg.BridgeRTSPAddr != "" {
+		rtspListener, err := net.Listen("tcp", cfg.BridgeRTSPAddr)
+		if err != nil {
+			return fmt.Errorf("rtsp listen failed: %w", err)
+		}
+		go func() {
+			log.Printf("Starting RTSP bridge on %s", rtspListener.Addr())
+			if err := audioBridge.ServeRTSP(ctx, rtspListener); err != nil {
+				srvErr <- fmt.Errorf("rtsp bridge failed: %w", err)
+			}
+		}()
+	}
+
+	if err := systemd.Ready(); err != nil {
+		log.Printf("Failed to notify systemd readiness: %v", err)
+	}
+	go systemd.RunWatchdog(ctx, spyService.Healthy)
+
 	// 7. Wait for signal or error
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
@@ -107,6 +622,7 @@ func run() error {
 	}
 
 	// 8. Graceful Shutdown
+	systemd.Stopping()
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
 
@@ -116,3 +632,185 @@ func run() error {
 
 	return nil
 }
+
+// loadTLSConfig returns nil when no certificate is configured.
+func loadTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	nextProtos := []string{"http/1.1"}
+	if cfg.HTTP2 {
+		nextProtos = []string{"h2", "http/1.1"}
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   nextProtos,
+	}, nil
+}
+
+// recordSpyActivity persists spy lifecycle events, labelling calls with
+// labels. Store errors are logged and never interrupt the media path.
+func recordSpyActivity(st store.Store, spyService *spy.Service, labels map[string]string) {
+	ctx := context.Background()
+
+	spyService.OnSourceCreated(func(source *spy.Source) {
+		now := time.Now()
+		call := store.CallRecord{CallID: source.CallID, FromTag: source.FromTag, ToTag: source.ToTag, FirstSeen: now, LastSeen: now, Labels: labels}
+		if existing, err := st.GetCall(ctx, source.CallID); err == nil {
+			call.FirstSeen = existing.FirstSeen
+		}
+		if err := st.SaveCall(ctx, call); err != nil {
+			log.Printf("store: failed to save call %s: %v", redact.CallID(source.CallID), err)
+		}
+	})
+	spyService.OnSourceClosed(func(source *spy.Source) {
+		t := source.Talk()
+		talk := store.CallTalk{FromTalkMs: t.From.TalkMs, FromSilenceMs: t.From.SilenceMs, ToTalkMs: t.To.TalkMs, ToSilenceMs: t.To.SilenceMs}
+		if err := st.AddCallTalk(ctx, source.CallID, talk); err != nil {
+			log.Printf("store: failed to save talk time of call %s: %v", redact.CallID(source.CallID), err)
+		}
+	})
+	spyService.OnSessionCreated(func(source *spy.Source, sess *spy.Session) {
+		if err := st.SaveSession(ctx, store.SessionRecord{ID: sess.ID, CallID: source.CallID, StartedAt: time.Now()}); err != nil {
+			log.Printf("store: failed to save session %s: %v", sess.ID, err)
+		}
+		if err := st.AppendAudit(ctx, store.AuditEntry{Time: time.Now(), Action: "spy.start", Target: redact.CallID(source.CallID), Detail: sess.ID}); err != nil {
+			log.Printf("store: failed to append audit entry: %v", err)
+		}
+	})
+	spyService.OnSessionClosed(func(source *spy.Source, sess *spy.Session) {
+		if err := st.EndSession(ctx, sess.ID, time.Now()); err != nil {
+			log.Printf("store: failed to end session %s: %v", sess.ID, err)
+		}
+		if err := st.AppendAudit(ctx, store.AuditEntry{Time: time.Now(), Action: "spy.stop", Target: redact.CallID(source.CallID), Detail: sess.ID}); err != nil {
+			log.Printf("store: failed to append audit entry: %v", err)
+		}
+	})
+}
+
+// newDiscovery creates the watcher keeping registry in step with the
+// rtpengine instances found in DNS SRV records or among Kubernetes pods.
+func newDiscovery(cfg *config.Config, registry *rtpengine.Registry, opts []rtpengine.Option) (*discovery.Watcher, error) {
+	var resolver discovery.Resolver
+	if cfg.RTPEngineSRV != "" {
+		resolver = discovery.NewSRV(cfg.RTPEngineSRV)
+		log.Printf("Discovering rtpengine instances from the SRV records of %s", cfg.RTPEngineSRV)
+	} else {
+		k, err := discovery.NewKubernetes(cfg.RTPEngineK8sSelector, cfg.RTPEngineK8sNamespace, cfg.RTPEngineK8sPort)
+		if err != nil {
+			return nil, err
+		}
+		resolver = k
+		log.Printf("Discovering rtpengine instances from pods matching %s", cfg.RTPEngineK8sSelector)
+	}
+	return discovery.NewWatcher(resolver, registry, func(inst discovery.Instance) (rtpengine.Client, error) {
+		return rtpengine.NewClient(inst.Addr, append(slices.Clip(opts), rtpengine.WithInstanceName(inst.Name))...)
+	}, cfg.RTPEngineDiscoveryInterval), nil
+}
+
+// ngOptions returns the client options of the NG control connection.
+func ngOptions(cfg *config.Config) []rtpengine.Option {
+	opts := []rtpengine.Option{
+		rtpengine.WithTransport(cfg.RTPEngineTransport),
+		rtpengine.WithEncoding(cfg.RTPEngineEncoding),
+		rtpengine.WithQueryCache(cfg.RTPEngineQueryCacheTTL),
+		rtpengine.WithRateLimit(cfg.RTPEngineRateLimit, cfg.RTPEngineRateBurst),
+		rtpengine.WithSockets(cfg.RTPEngineSockets),
+		rtpengine.WithRetryPolicy(rtpengine.RetryPolicy{
+			Timeout:         cfg.RTPEngineTimeout,
+			CommandTimeouts: cfg.RTPEngineCommandTimeouts,
+			Retries:         cfg.RTPEngineRetries,
+			Backoff:         cfg.RTPEngineRetryBackoff,
+		}),
+		rtpengine.WithSubscribeOptions(rtpengine.MediaOptions{
+			Flags:             cfg.RTPEngineSubscribeFlags,
+			RTCPMux:           cfg.RTPEngineSubscribeRTCPMux,
+			TransportProtocol: cfg.RTPEngineSubscribeTransportProtocol,
+			ICE:               cfg.RTPEngineSubscribeICE,
+			Codec:             subscribeCodec(cfg.RTPEngineSubscribeTranscode),
+		}),
+	}
+	// The fallback address belongs to a single rtpengine.
+	if cfg.RTPEngineTCPFallbackAddr != "" && len(cfg.RTPEngineNodes) <= 1 && cfg.RTPEngineSRV == "" && cfg.RTPEngineK8sSelector == "" {
+		opts = append(opts, rtpengine.WithTCPFallback(cfg.RTPEngineTCPFallbackAddr))
+	}
+	if cfg.RTPEngineBackupAddr != "" {
+		opts = append(opts, rtpengine.WithFailover(rtpengine.FailoverPolicy{
+			Address:       cfg.RTPEngineBackupAddr,
+			Failures:      cfg.RTPEngineFailoverAfter,
+			ProbeInterval: cfg.RTPEngineFailbackInterval,
+			OnSwitch: func(ev rtpengine.FailoverEvent) {
+				log.Printf("rtpengine: switched from the %s to the %s endpoint %s: %s", ev.From, ev.To, ev.Address, ev.Reason)
+			},
+		}))
+	}
+	return opts
+}
+
+// logPrefix renders labels as "key=value" pairs sorted by key, put before
+// every log message.
+func logPrefix(labels map[string]string) string {
+	var b strings.Builder
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		fmt.Fprintf(&b, "%s=%s ", key, labels[key])
+	}
+	return b.String()
+}
+
+// subscribeCodec transcodes subscriptions to the codecs listed, stripping
+// the others, or keeps the default codec options when none is.
+func subscribeCodec(transcode []string) rtpengine.CodecOptions {
+	if len(transcode) == 0 {
+		return rtpengine.CodecOptions{}
+	}
+	return rtpengine.CodecOptions{Strip: []string{"all"}, Transcode: transcode}
+}
+
+// exportPCM publishes the audio of every subscribed leg to subject.<leg> as
+// 16-bit little-endian PCM, one message per RTP packet, with the call in the
+// headers, along with labels as Label-<key> headers. Frames are dropped
+// rather than delaying the media path.
+func exportPCM(pub *natspub.Publisher, subject, instance string, labels map[string]string, spyService *spy.Service) {
+	spyService.SetPCMSink(func(f spy.PCMFrame) {
+		data := make([]byte, 2*len(f.Samples))
+		for i, s := range f.Samples {
+			binary.LittleEndian.PutUint16(data[2*i:], uint16(s))
+		}
+		header := natspub.Header{
+			"Call-Id":       redact.CallID(f.CallID),
+			"Leg":           f.Leg,
+			"Tag":           redact.Tag(f.Tag),
+			"Instance":      instance,
+			"Encoding":      "s16le",
+			"Sample-Rate":   strconv.Itoa(f.SampleRate),
+			"Seq":           strconv.Itoa(int(f.SequenceNumber)),
+			"Rtp-Timestamp": strconv.FormatUint(uint64(f.RTPTimestamp), 10),
+			"Received":      f.Received.UTC().Format(time.RFC3339Nano),
+		}
+		for key, value := range labels {
+			header["Label-"+key] = value
+		}
+		pub.Publish(subject+"."+f.Leg, header, data)
+	})
+}
+
+// staticDir prefers ./static and falls back to the directory shipped next to
+// the executable, so the dashboard also works when started from elsewhere
+// (e.g. a Windows shortcut or a macOS launchd job).
+func staticDir() string {
+	if info, err := os.Stat("static"); err == nil && info.IsDir() {
+		return "static"
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "static"
+	}
+	return filepath.Join(filepath.Dir(exe), "static")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/probe"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// runProbe implements the "probe" subcommand: a canary that repeatedly
+// creates a synthetic call, spies on it and tears it down.
+func runProbe(args []string) error {
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Minute, "time between probe runs")
+	timeout := fs.Duration("timeout", 15*time.Second, "deadline for a single probe run")
+	once := fs.Bool("once", false, "run a single probe and exit non-zero on failure")
+	localIP := fs.String("local-ip", "", "IP used for synthetic call media (default: route to rtpengine)")
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("config load failed: %w", err)
+	}
+	if cfg.Anonymize {
+		redact.Enable(cfg.AnonymizeSalt)
+	}
+
+	ip := net.ParseIP(*localIP)
+	if ip == nil {
+		if ip, err = routeIP(cfg.RTPEngineAddr); err != nil {
+			return fmt.Errorf("failed to determine local IP: %w", err)
+		}
+	}
+
+	rtpClient, err := rtpengine.NewClient(cfg.RTPEngineAddr, ngOptions(cfg)...)
+	if err != nil {
+		return fmt.Errorf("rtpengine client init failed: %w", err)
+	}
+	defer rtpClient.Close()
+
+	spyService, err := spy.NewService(cfg, rtpClient, nil)
+	if err != nil {
+		return fmt.Errorf("spy service init failed: %w", err)
+	}
+
+	p := probe.New(rtpClient, spyService, ip, *timeout)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		res, err := p.RunOnce(ctx)
+		if err != nil {
+			return fmt.Errorf("probe call %s failed: %w", res.CallID, err)
+		}
+		log.Printf("probe: call %s ok, first audio after %s", redact.CallID(res.CallID), res.Latency)
+		return nil
+	}
+
+	log.Printf("Probing %s every %s", cfg.RTPEngineAddr, *interval)
+	p.Run(ctx, *interval)
+	return nil
+}
+
+// routeIP returns the local address used to reach addr.
+func routeIP(addr string) (net.IP, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
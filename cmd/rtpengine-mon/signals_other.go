@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyLogReopen is a no-op on platforms without SIGUSR1.
+func notifyLogReopen(c chan<- os.Signal) {}
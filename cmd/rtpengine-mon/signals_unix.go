@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyLogReopen delivers SIGUSR1, the conventional log rotation signal.
+func notifyLogReopen(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
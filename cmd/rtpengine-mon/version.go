@@ -0,0 +1,39 @@
+package main
+
+import (
+	"runtime/debug"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/api"
+)
+
+// Set at build time with
+// -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)".
+// Unset, they are taken from the VCS stamp of the Go toolchain.
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// buildInfo describes this binary with the given enabled subsystems.
+func buildInfo(subsystems map[string]bool) api.BuildInfo {
+	info := api.BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, Subsystems: subsystems}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = bi.GoVersion
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
@@ -0,0 +1,42 @@
+// Command rtpengine-sim runs a fake rtpengine with a few scripted calls, to
+// demo the monitor without a real one.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:22222", "UDP address to answer NG requests on")
+	calls := flag.Int("calls", 3, "number of scripted calls")
+	flag.Parse()
+
+	s, err := rtpenginetest.Listen(*listen)
+	if err != nil {
+		log.Fatalf("listen failed: %v", err)
+	}
+	defer s.Close()
+
+	for i := range *calls {
+		s.AddCall(rtpenginetest.Call{
+			ID: fmt.Sprintf("demo-call-%d", i+1),
+			Tags: []rtpenginetest.Tag{
+				{Tag: fmt.Sprintf("caller-%d", i+1), Label: "caller"},
+				{Tag: fmt.Sprintf("callee-%d", i+1), Label: "callee"},
+			},
+		})
+	}
+	log.Printf("Fake rtpengine with %d calls answering NG requests on %s", *calls, s.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const peerStatsTimeout = 3 * time.Second
+
+type InstanceStats struct {
+	Statistics map[string]interface{} `json:"statistics,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+type AggregateStats struct {
+	Aggregate map[string]interface{}   `json:"aggregate"`
+	Instances map[string]InstanceStats `json:"instances"`
+}
+
+// handleAggregateStats merges the statistics of every cluster member. Without
+// clustering only the local rtpengine is reported.
+func (h *Handler) handleAggregateStats(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "http.AggregateStatistics", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	resp := AggregateStats{Instances: make(map[string]InstanceStats)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	collect := func(id string, fetch func(ctx context.Context) (map[string]interface{}, error)) {
+		defer wg.Done()
+		fetchCtx, cancel := context.WithTimeout(ctx, peerStatsTimeout)
+		defer cancel()
+
+		stats, err := fetch(fetchCtx)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			resp.Instances[id] = InstanceStats{Error: err.Error()}
+			return
+		}
+		resp.Instances[id] = InstanceStats{Statistics: stats}
+	}
+
+	if h.cluster == nil {
+		wg.Add(1)
+		go collect("local", h.rtpClient.Statistics)
+	} else {
+		self := h.cluster.Self()
+		for _, member := range h.cluster.Members() {
+			wg.Add(1)
+			if member.ID == self.ID {
+				go collect(member.ID, h.rtpClient.Statistics)
+				continue
+			}
+			url := member.URL + "/stats"
+			go collect(member.ID, func(ctx context.Context) (map[string]interface{}, error) {
+				return fetchPeerStats(ctx, url, r.Header)
+			})
+		}
+	}
+	wg.Wait()
+
+	resp.Aggregate = map[string]interface{}{}
+	counts := map[string]int{}
+	for _, inst := range resp.Instances {
+		if inst.Statistics != nil {
+			mergeStats(resp.Aggregate, inst.Statistics, counts, "")
+		}
+	}
+	averageStats(resp.Aggregate, counts, "")
+
+	h.respondJSON(w, resp)
+}
+
+func fetchPeerStats(ctx context.Context, url string, incoming http.Header) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range []string{"X-API-Key", "Authorization"} {
+		if v := incoming.Get(header); v != "" {
+			req.Header.Set(header, v)
+		}
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned %s", res.Status)
+	}
+
+	var stats map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// mergeStats sums numeric values of src into dst, recursing into nested
+// maps. Non-numeric values keep the first value seen. counts tracks how many
+// instances contributed to each averaged key.
+func mergeStats(dst, src map[string]interface{}, counts map[string]int, prefix string) {
+	for k, v := range src {
+		path := prefix + k
+		switch val := v.(type) {
+		case map[string]interface{}:
+			sub, ok := dst[k].(map[string]interface{})
+			if !ok {
+				sub = map[string]interface{}{}
+				dst[k] = sub
+			}
+			mergeStats(sub, val, counts, path+".")
+		case float64, int64, int:
+			n := toFloat(val)
+			if isAverage(k) {
+				counts[path]++
+			}
+			if cur, ok := dst[k]; ok {
+				n += toFloat(cur)
+			}
+			dst[k] = n
+		default:
+			if _, ok := dst[k]; !ok {
+				dst[k] = v
+			}
+		}
+	}
+}
+
+// averageStats divides summed average values by their contributor count.
+func averageStats(dst map[string]interface{}, counts map[string]int, prefix string) {
+	for k, v := range dst {
+		path := prefix + k
+		switch val := v.(type) {
+		case map[string]interface{}:
+			averageStats(val, counts, path+".")
+		case float64:
+			if n := counts[path]; n > 1 {
+				dst[k] = val / float64(n)
+			}
+		}
+	}
+}
+
+func isAverage(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, "avg") || strings.HasPrefix(key, "average") || strings.Contains(key, "_avg")
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	}
+	return 0
+}
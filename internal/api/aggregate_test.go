@@ -0,0 +1,28 @@
+package api
+
+import "testing"
+
+func TestMergeStats(t *testing.T) {
+	instances := []map[string]interface{}{
+		{"currentstatistics": map[string]interface{}{"sessionsown": int64(3), "avgcallduration": int64(10)}, "version": "11.5"},
+		{"currentstatistics": map[string]interface{}{"sessionsown": float64(4), "avgcallduration": float64(30)}, "version": "11.4"},
+	}
+
+	agg := map[string]interface{}{}
+	counts := map[string]int{}
+	for _, stats := range instances {
+		mergeStats(agg, stats, counts, "")
+	}
+	averageStats(agg, counts, "")
+
+	current := agg["currentstatistics"].(map[string]interface{})
+	if current["sessionsown"] != float64(7) {
+		t.Errorf("expected summed sessionsown 7, got %v", current["sessionsown"])
+	}
+	if current["avgcallduration"] != float64(20) {
+		t.Errorf("expected averaged avgcallduration 20, got %v", current["avgcallduration"])
+	}
+	if agg["version"] != "11.5" {
+		t.Errorf("expected first non-numeric value to be kept, got %v", agg["version"])
+	}
+}
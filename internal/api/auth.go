@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// HandlerOption configures optional Handler behaviour.
+type HandlerOption func(*Handler)
+
+// WithAPIKeys requires every API request to carry one of the given keys in the
+// X-API-Key header or as a bearer token. The key's priority is attached to the
+// request context and applied to spy sessions it starts.
+func WithAPIKeys(keys map[string]spy.Priority) HandlerOption {
+	return func(h *Handler) { h.apiKeys = keys }
+}
+
+func (h *Handler) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(h.apiKeys) == 0 {
+			next(w, r)
+			return
+		}
+
+		key := apiKey(r)
+		priority, ok := h.apiKeys[key]
+		if key == "" || !ok {
+			h.respondError(w, fmt.Errorf("invalid or missing API key"), http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r.WithContext(spy.WithPriority(r.Context(), priority)))
+	}
+}
+
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
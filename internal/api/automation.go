@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/automation"
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// WithAutomation runs the scripts of e for calls starting and ending, once
+// RunAutomation polls for them.
+func WithAutomation(e *automation.Engine) HandlerOption {
+	return func(h *Handler) { h.automation = e }
+}
+
+// RunAutomation polls the call list every interval and runs the automation
+// scripts for calls that started or ended since the previous poll, until ctx
+// is cancelled. The calls of the first poll are not reported as started.
+func (h *Handler) RunAutomation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var seen map[string]bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			list, err := h.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+			if err != nil {
+				log.Printf("Automation: failed to list calls: %v", err)
+				continue
+			}
+			prev := seen
+			seen = make(map[string]bool, len(list))
+			for _, callID := range list {
+				seen[callID] = true
+			}
+			if prev == nil {
+				continue
+			}
+			now := time.Now()
+			for _, callID := range list {
+				if !prev[callID] {
+					h.automation.Run(ctx, h.automationEvent(ctx, automation.CallStart, callID, now), automationActions{h})
+				}
+			}
+			for callID := range prev {
+				if !seen[callID] {
+					h.automation.Run(ctx, h.automationEvent(ctx, automation.CallEnd, callID, now), automationActions{h})
+				}
+			}
+		}
+	}
+}
+
+func (h *Handler) automationEvent(ctx context.Context, typ, callID string, now time.Time) automation.Event {
+	ev := automation.Event{Type: typ, CallID: callID, Time: now, Labels: h.labels}
+	ev.Instance, _ = h.callOwner(callID)
+	if typ != automation.CallStart {
+		return ev
+	}
+	details, err := h.rtpClient.QueryCall(ctx, callID)
+	if err != nil {
+		log.Printf("Automation: failed to query call %s: %v", redact.CallID(callID), err)
+		return ev
+	}
+	var subs []spy.Subscription
+	if h.spyService != nil {
+		subs = h.spyService.Subscriptions(callID)
+	}
+	ev.LegLabels = legLabels(rtpengine.DecodeCallDetails(details), subs)
+	return ev
+}
+
+// automationActions carries out the actions of automation scripts as the
+// matching actions of watches do. Recordings are audited.
+type automationActions struct {
+	h *Handler
+}
+
+func (a automationActions) Record(ctx context.Context, callID string) error {
+	now := time.Now()
+	if window, ok := a.h.recordingSuppressed(callID, now); ok {
+		log.Printf("Automation: recording of call %s suppressed by maintenance window %s", redact.CallID(callID), window.ID)
+		return nil
+	}
+	if err := a.h.recordWatched(ctx, callID, false, now); err != nil {
+		return err
+	}
+	a.h.audit(ctx, "automation.record", callID, "")
+	return nil
+}
+
+func (a automationActions) Prewarm(ctx context.Context, callID string) error {
+	if a.h.spyService == nil {
+		return catalog.Errorf(catalog.FeatureDisabled, "spying is disabled")
+	}
+	go func() {
+		if err := a.h.spyService.Prewarm(ctx, callID); err != nil {
+			log.Printf("Automation: failed to prewarm call %s: %v", redact.CallID(callID), err)
+		}
+	}()
+	return nil
+}
+
+func (a automationActions) Notify(ctx context.Context, url string, ev automation.Event) error {
+	ev.CallID = redact.CallID(ev.CallID)
+	go func() {
+		if err := postWebhook(ctx, url, ev); err != nil {
+			log.Printf("Automation: %v", err)
+		}
+	}()
+	return nil
+}
+
+// handleAutomation lists the automation scripts and how their runs went.
+func (h *Handler) handleAutomation(w http.ResponseWriter, r *http.Request) {
+	_, span := h.tracer.Start(r.Context(), "http.Automation", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if h.automation == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "automation is disabled"), http.StatusNotFound)
+		return
+	}
+	h.respondJSON(w, h.automation.Scripts())
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/automation"
+)
+
+type automationClient struct {
+	watchClient
+}
+
+func (c *automationClient) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"result": "ok", "tags": map[string]interface{}{
+		"tag-a": map[string]interface{}{"tag": "tag-a", "label": "agent", "created": int64(1)},
+	}}, nil
+}
+
+func TestRunAutomation(t *testing.T) {
+	notified := make(chan automation.Event, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev automation.Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		notified <- ev
+	}))
+	defer hook.Close()
+
+	script := filepath.Join(t.TempDir(), "agent.star")
+	body := `
+def on_call_start(call):
+    if "agent" in call.leg_labels:
+        record()
+    notify("` + hook.URL + `")
+
+def on_call_end(call):
+    notify("` + hook.URL + `")
+`
+	if err := os.WriteFile(script, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scripts, err := automation.Load([]string{script})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &automationClient{watchClient{calls: []string{"old"}}}
+	h := NewHandler(client, nil, nil, WithAutomation(scripts), WithLabels(map[string]string{"site": "fra1"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.RunAutomation(ctx, 10*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	client.mu.Lock()
+	client.calls = []string{"new"}
+	client.mu.Unlock()
+
+	got := map[string]automation.Event{}
+	for range 2 {
+		select {
+		case ev := <-notified:
+			got[ev.Type] = ev
+		case <-time.After(2 * time.Second):
+			t.Fatalf("webhook notified of %v only", got)
+		}
+	}
+	if ev := got[automation.CallStart]; ev.CallID != "new" || ev.LegLabels["agent"] != "tag-a" || ev.Labels["site"] != "fra1" {
+		t.Errorf("start event = %+v", ev)
+	}
+	if ev := got[automation.CallEnd]; ev.CallID != "old" {
+		t.Errorf("end event = %+v", ev)
+	}
+	client.mu.Lock()
+	recorded := client.recorded
+	client.mu.Unlock()
+	if len(recorded) != 1 || recorded[0] != "new" {
+		t.Errorf("recorded = %v", recorded)
+	}
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/automation", nil))
+	var list []automation.Script
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 1 || list[0].Runs != 2 {
+		t.Errorf("GET /admin/automation = %d %+v", rec.Code, list)
+	}
+}
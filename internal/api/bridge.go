@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/bridge"
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// BridgeRequest names the configured RTP destination to send a call to.
+type BridgeRequest struct {
+	Destination string `json:"destination"`
+}
+
+// BridgeResponse lists the RTP streams of a call and the destinations it
+// may be sent to.
+type BridgeResponse struct {
+	CallID       string          `json:"call_id"`
+	Streams      []bridge.Stream `json:"streams"`
+	Destinations []string        `json:"destinations"`
+}
+
+// WithBridge republishes the audio of calls as plain RTP through b.
+func WithBridge(b *bridge.Bridge) HandlerOption {
+	return func(h *Handler) { h.bridge = b }
+}
+
+// handleBridge sends the audio of a call to legacy consoles: POST starts a
+// stream to a destination, DELETE stops it and GET lists the streams.
+func (h *Handler) handleBridge(w http.ResponseWriter, r *http.Request, callID string) {
+	if h.bridge == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "the bridge is disabled"), http.StatusNotFound)
+		return
+	}
+	ctx, span := h.tracer.Start(r.Context(), "http.Bridge", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID)), attribute.String("method", r.Method)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req BridgeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		stream, err := h.bridge.Start(ctx, callID, req.Destination)
+		if err != nil {
+			var saturated *spy.SaturatedError
+			switch {
+			case errors.Is(err, bridge.ErrUnknownDestination):
+				h.respondError(w, err, http.StatusNotFound)
+			case errors.As(err, &saturated):
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(saturated.RetryAfter.Seconds()))))
+				h.respondError(w, err, http.StatusServiceUnavailable)
+			default:
+				h.respondError(w, err, http.StatusInternalServerError)
+			}
+			return
+		}
+		h.audit(ctx, "call.bridge.start", callID, fmt.Sprintf("destination=%s address=%s", stream.Destination, stream.Address))
+	case http.MethodDelete:
+		destination := r.URL.Query().Get("destination")
+		if !h.bridge.Stop(callID, destination) {
+			h.respondError(w, fmt.Errorf("call is not bridged to %q", destination), http.StatusNotFound)
+			return
+		}
+		h.audit(ctx, "call.bridge.stop", callID, "destination="+destination)
+	default:
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	h.respondJSON(w, BridgeResponse{CallID: callID, Streams: h.bridge.Streams(callID), Destinations: h.bridge.Destinations()})
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/bridge"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+type bridgeAudio struct{}
+
+func (bridgeAudio) Tap(ctx context.Context, callID string) (<-chan spy.PCMFrame, func(), error) {
+	return make(chan spy.PCMFrame), func() {}, nil
+}
+
+func TestHandleBridge(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(nil, nil, nil).RegisterRoutes(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calls/c1/bridge", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without bridge: status = %d, want 404", rec.Code)
+	}
+
+	b := bridge.New(bridgeAudio{}, bridge.WithDestinations(map[string]string{"console": "127.0.0.1:9"}))
+	mux = http.NewServeMux()
+	NewHandler(nil, nil, nil, WithBridge(b)).RegisterRoutes(mux)
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"unknown destination", http.MethodPost, "/calls/c1/bridge", `{"destination":"other"}`, http.StatusNotFound},
+		{"start", http.MethodPost, "/calls/c1/bridge", `{"destination":"console"}`, http.StatusOK},
+		{"list", http.MethodGet, "/calls/c1/bridge", "", http.StatusOK},
+		{"stop", http.MethodDelete, "/calls/c1/bridge?destination=console", "", http.StatusOK},
+		{"stop again", http.MethodDelete, "/calls/c1/bridge?destination=console", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d, body %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.name == "list" && !strings.Contains(rec.Body.String(), `"destination":"console"`) {
+				t.Errorf("body = %s, want the console stream", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+const (
+	defaultBulkConcurrency = 8
+	maxBulkConcurrency     = 64
+)
+
+// BulkFilter selects the calls a bulk action applies to. Criteria are
+// combined: a call must match every criterion that is set.
+type BulkFilter struct {
+	CallIDs []string `json:"call_ids"`
+	Prefix  string   `json:"prefix"`
+	All     bool     `json:"all"`
+}
+
+type BulkRequest struct {
+	Action      string     `json:"action"`
+	Filter      BulkFilter `json:"filter"`
+	Concurrency int        `json:"concurrency"`
+}
+
+type BulkResult struct {
+	CallID string `json:"call_id"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Action    string       `json:"action"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+func (h *Handler) bulkAction(action string) (func(ctx context.Context, callID string) (map[string]interface{}, error), bool) {
+	switch action {
+	case "delete":
+		return h.deleteCall, true
+	case "block-media":
+		return h.blockMedia, true
+	case "start-recording":
+		return h.startRecording, true
+	case "stop-recording":
+		return h.rtpClient.StopRecording, true
+	}
+	return nil, false
+}
+
+func (h *Handler) deleteCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return h.rtpClient.Delete(ctx, callID, rtpengine.DeleteOptions{})
+}
+
+// blockMedia blocks every leg of a call.
+func (h *Handler) blockMedia(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return h.rtpClient.BlockMedia(ctx, callID, "")
+}
+
+// startRecording records a call into its tenant's recording path,
+// announced if consent is required.
+func (h *Handler) startRecording(ctx context.Context, callID string) (map[string]interface{}, error) {
+	path, err := h.recordingPath(callID)
+	if err != nil {
+		return nil, err
+	}
+	return nil, h.recordCall(ctx, callID, path, false)
+}
+
+func (h *Handler) handleBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.Bulk", trace.WithAttributes(attribute.String("action", req.Action)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	run, ok := h.bulkAction(req.Action)
+	if !ok {
+		h.respondError(w, fmt.Errorf("unknown action: %q", req.Action), http.StatusBadRequest)
+		return
+	}
+	if !req.Filter.All && len(req.Filter.CallIDs) == 0 && req.Filter.Prefix == "" {
+		h.respondError(w, fmt.Errorf("filter must set call_ids, prefix or all"), http.StatusBadRequest)
+		return
+	}
+
+	calls, err := h.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+	targets := req.Filter.apply(calls)
+	span.SetAttributes(attribute.Int("targets", len(targets)))
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	if concurrency > maxBulkConcurrency {
+		concurrency = maxBulkConcurrency
+	}
+
+	results := make([]BulkResult, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, callID := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, callID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = BulkResult{CallID: callID, OK: true}
+			if _, err := run(ctx, callID); err != nil {
+				results[i] = BulkResult{CallID: callID, Error: err.Error()}
+			}
+			h.audit(ctx, "bulk."+req.Action, callID, results[i].Error)
+		}(i, callID)
+	}
+	wg.Wait()
+
+	resp := BulkResponse{Action: req.Action, Results: results}
+	for _, res := range results {
+		if res.OK {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	h.respondJSON(w, resp)
+}
+
+func (f BulkFilter) apply(calls []string) []string {
+	var ids map[string]bool
+	if len(f.CallIDs) > 0 {
+		ids = make(map[string]bool, len(f.CallIDs))
+		for _, id := range f.CallIDs {
+			ids[id] = true
+		}
+	}
+
+	matched := []string{}
+	for _, callID := range calls {
+		if ids != nil && !ids[callID] {
+			continue
+		}
+		if f.Prefix != "" && !strings.HasPrefix(callID, f.Prefix) {
+			continue
+		}
+		matched = append(matched, callID)
+	}
+	return matched
+}
+
+// audit records an action when persistence is enabled.
+func (h *Handler) audit(ctx context.Context, action, target, detail string) {
+	if h.store == nil {
+		return
+	}
+	if err := h.store.AppendAudit(ctx, store.AuditEntry{Time: time.Now(), Action: action, Target: redact.CallID(target), Detail: detail}); err != nil {
+		log.Printf("Error appending audit entry: %v", err)
+	}
+}
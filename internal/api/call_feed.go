@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// callFeedBuffer is how many diffs a subscriber may lag behind before it is
+// dropped and has to reconnect for a fresh snapshot.
+const callFeedBuffer = 16
+
+// CallDiff is the change of the call list between two polls. The first diff
+// a subscriber receives has Reset set and lists every call as added.
+type CallDiff struct {
+	Seq     uint64            `json:"seq"`
+	Reset   bool              `json:"reset,omitempty"`
+	Added   []CallSummary     `json:"added,omitempty"`
+	Removed []string          `json:"removed,omitempty"`
+	Changed []CallSummary     `json:"changed,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// callFeed polls the call list while someone is subscribed and publishes
+// the differences between polls.
+type callFeed struct {
+	running atomic.Bool
+
+	mu    sync.Mutex
+	seq   uint64
+	calls map[string]CallSummary
+	subs  map[chan CallDiff]struct{}
+}
+
+// subscribe returns a channel receiving a snapshot followed by diffs. The
+// channel is closed when the subscriber falls behind.
+func (f *callFeed) subscribe() (<-chan CallDiff, func()) {
+	ch := make(chan CallDiff, callFeedBuffer)
+
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan CallDiff]struct{})
+	}
+	f.subs[ch] = struct{}{}
+	// Without a current list the next poll sends the snapshot.
+	if f.calls != nil {
+		ch <- f.snapshot()
+	}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+		if len(f.subs) == 0 {
+			// Nobody listens; the list goes stale until the next subscriber.
+			f.calls = nil
+		}
+	}
+}
+
+func (f *callFeed) snapshot() CallDiff {
+	diff := CallDiff{Seq: f.seq, Reset: true, Added: make([]CallSummary, 0, len(f.calls))}
+	for _, call := range f.calls {
+		diff.Added = append(diff.Added, call)
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].CallID < diff.Added[j].CallID })
+	return diff
+}
+
+func (f *callFeed) active() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs) > 0
+}
+
+// update replaces the call list and publishes what changed.
+func (f *callFeed) update(calls []CallSummary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	next := make(map[string]CallSummary, len(calls))
+	for _, call := range calls {
+		next[call.CallID] = call
+	}
+	prev := f.calls
+	f.calls = next
+
+	if prev == nil {
+		f.seq++
+		f.publish(f.snapshot())
+		return
+	}
+
+	diff := diffCalls(prev, next)
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0 {
+		return
+	}
+	f.seq++
+	diff.Seq = f.seq
+	f.publish(diff)
+}
+
+func (f *callFeed) publish(diff CallDiff) {
+	for ch := range f.subs {
+		select {
+		case ch <- diff:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+	if len(f.subs) == 0 {
+		f.calls = nil
+	}
+}
+
+// diffCalls compares two call lists, each part sorted by call ID.
+func diffCalls(prev, next map[string]CallSummary) CallDiff {
+	var diff CallDiff
+	for callID, call := range next {
+		old, ok := prev[callID]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, call)
+		case !sameAudio(old, call):
+			diff.Changed = append(diff.Changed, call)
+		}
+	}
+	for callID := range prev {
+		if _, ok := next[callID]; !ok {
+			diff.Removed = append(diff.Removed, callID)
+		}
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].CallID < diff.Added[j].CallID })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].CallID < diff.Changed[j].CallID })
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+func sameAudio(a, b CallSummary) bool {
+	if a.Audio == nil || b.Audio == nil {
+		return a.Audio == b.Audio
+	}
+	return *a.Audio == *b.Audio
+}
+
+// RunCallFeed polls the call list every interval while clients are
+// subscribed to /calls/events, until ctx is cancelled.
+func (h *Handler) RunCallFeed(ctx context.Context, interval time.Duration) {
+	h.feed.running.Store(true)
+	defer h.feed.running.Store(false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !h.feed.active() {
+				continue
+			}
+			list, err := h.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+			if err != nil {
+				log.Printf("Call feed: failed to list calls: %v", err)
+				continue
+			}
+			h.feed.update(h.callSummaries(list))
+		}
+	}
+}
+
+// handleCallEvents streams call list diffs as server-sent events.
+func (h *Handler) handleCallEvents(w http.ResponseWriter, r *http.Request) {
+	if !h.feed.running.Load() {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "call events are disabled"), http.StatusNotFound)
+		return
+	}
+
+	diffs, unsubscribe := h.feed.subscribe()
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case diff, ok := <-diffs:
+			if !ok {
+				return
+			}
+			diff.Labels = h.labels
+			data, err := json.Marshal(diff)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", diff.Seq, catalog.EventCalls, data)
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
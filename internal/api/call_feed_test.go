@@ -0,0 +1,76 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+func TestDiffCalls(t *testing.T) {
+	speech := &spy.CallAudio{From: spy.AudioSpeech, To: spy.AudioSpeech}
+	music := &spy.CallAudio{From: spy.AudioMusic, To: spy.AudioSilence}
+
+	prev := map[string]CallSummary{
+		"a": {CallID: "a"},
+		"b": {CallID: "b", Audio: speech},
+		"c": {CallID: "c", Audio: speech},
+	}
+	next := map[string]CallSummary{
+		"b": {CallID: "b", Audio: &spy.CallAudio{From: spy.AudioSpeech, To: spy.AudioSpeech}},
+		"c": {CallID: "c", Audio: music},
+		"e": {CallID: "e"},
+		"d": {CallID: "d"},
+	}
+
+	diff := diffCalls(prev, next)
+	want := CallDiff{
+		Added:   []CallSummary{{CallID: "d"}, {CallID: "e"}},
+		Removed: []string{"a"},
+		Changed: []CallSummary{{CallID: "c", Audio: music}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diffCalls() = %+v, want %+v", diff, want)
+	}
+}
+
+func TestCallFeed(t *testing.T) {
+	var f callFeed
+	diffs, unsubscribe := f.subscribe()
+
+	// The first poll after a subscriber arrives is a snapshot.
+	f.update([]CallSummary{{CallID: "b"}, {CallID: "a"}})
+	if got := <-diffs; !got.Reset || got.Seq != 1 || len(got.Added) != 2 || got.Added[0].CallID != "a" {
+		t.Fatalf("unexpected snapshot: %+v", got)
+	}
+
+	// Unchanged polls publish nothing.
+	f.update([]CallSummary{{CallID: "a"}, {CallID: "b"}})
+	f.update([]CallSummary{{CallID: "a"}, {CallID: "c"}})
+	got := <-diffs
+	if got.Reset || got.Seq != 2 || !reflect.DeepEqual(got.Removed, []string{"b"}) || len(got.Added) != 1 || got.Added[0].CallID != "c" {
+		t.Fatalf("unexpected diff: %+v", got)
+	}
+
+	// Late subscribers start from the current list.
+	late, unsubscribeLate := f.subscribe()
+	if got := <-late; !got.Reset || got.Seq != 2 || len(got.Added) != 2 {
+		t.Fatalf("unexpected late snapshot: %+v", got)
+	}
+	unsubscribeLate()
+
+	// A subscriber that stops reading is dropped.
+	for i := 0; i <= callFeedBuffer; i++ {
+		f.update([]CallSummary{{CallID: string(rune('a' + i%2))}})
+	}
+	for range diffs {
+	}
+	if f.active() {
+		t.Error("expected the lagging subscriber to be dropped")
+	}
+	unsubscribe()
+
+	if f.calls != nil {
+		t.Error("expected the list to be forgotten without subscribers")
+	}
+}
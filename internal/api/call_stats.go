@@ -0,0 +1,127 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// StreamStats is the media received on one stream of a call, so operators
+// can see which leg is losing media. Leg is "from" or "to" when the call's
+// direction is known.
+type StreamStats struct {
+	Tag    string `json:"tag"`
+	Label  string `json:"label,omitempty"`
+	Leg    string `json:"leg,omitempty"`
+	Medium int    `json:"medium"`
+	Type   string `json:"type"`
+	// RTCP marks the stream carrying the medium's RTCP apart from its RTP.
+	RTCP         bool     `json:"rtcp"`
+	LocalAddress string   `json:"local_address,omitempty"`
+	LocalPort    int      `json:"local_port,omitempty"`
+	Endpoint     string   `json:"endpoint,omitempty"`
+	SSRCs        []uint32 `json:"ssrcs,omitempty"`
+	Packets      uint64   `json:"packets"`
+	Bytes        uint64   `json:"bytes"`
+	Errors       uint64   `json:"errors"`
+	// MOS, JitterMs, LossPercent and RTTMs come from the RTCP reports of
+	// the stream's SSRCs and are left out until one arrives.
+	MOS         *float64 `json:"mos,omitempty"`
+	JitterMs    *float64 `json:"jitter_ms,omitempty"`
+	LossPercent *float64 `json:"loss_percent,omitempty"`
+	RTTMs       *float64 `json:"rtt_ms,omitempty"`
+	// LastPacket is when the stream last received a packet, and Idle for
+	// how long it has not since, in seconds.
+	LastPacket *time.Time `json:"last_packet,omitempty"`
+	Idle       *float64   `json:"idle,omitempty"`
+}
+
+func (h *Handler) handleCallStats(w http.ResponseWriter, r *http.Request, callID string) {
+	if r.Method != http.MethodGet {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.CallStats", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	details, err := h.rtpClient.QueryCall(ctx, callID)
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var from, to string
+	var subs []spy.Subscription
+	if h.spyService != nil {
+		from, to, _ = h.spyService.CallTags(ctx, callID)
+		subs = h.spyService.Subscriptions(callID)
+	}
+	h.respondJSON(w, buildStreamStats(rtpengine.DecodeCallDetails(details), from, to, subs, time.Now()))
+}
+
+// buildStreamStats lists the streams of the tags of a call other than its
+// spy subscriptions, by tag, medium and stream.
+func buildStreamStats(details rtpengine.CallDetails, from, to string, subs []spy.Subscription, now time.Time) []StreamStats {
+	spyTags := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		spyTags[sub.SubTag] = true
+	}
+
+	streams := []StreamStats{}
+	for name, tag := range details.Tags {
+		if spyTags[name] {
+			continue
+		}
+		leg := ""
+		switch name {
+		case from:
+			leg = "from"
+		case to:
+			leg = "to"
+		}
+		for _, m := range tag.Medias {
+			for _, s := range m.Streams {
+				stats := StreamStats{
+					Tag:          name,
+					Label:        tag.Label,
+					Leg:          leg,
+					Medium:       m.Index,
+					Type:         m.Type,
+					RTCP:         s.RTCP,
+					LocalAddress: s.LocalAddress,
+					LocalPort:    s.LocalPort,
+					Endpoint:     s.Endpoint,
+					SSRCs:        s.SSRCs,
+					Packets:      s.Packets,
+					Bytes:        s.Bytes,
+					Errors:       s.Errors,
+				}
+				if ssrc, ok := details.Stream(s); ok && ssrc.MOS > 0 {
+					stats.MOS, stats.JitterMs, stats.LossPercent, stats.RTTMs = &ssrc.MOS, &ssrc.JitterMs, &ssrc.LossPercent, &ssrc.RTTMs
+				}
+				if !s.LastPacket.IsZero() {
+					idle := max(now.Sub(s.LastPacket).Seconds(), 0)
+					stats.LastPacket, stats.Idle = &s.LastPacket, &idle
+				}
+				streams = append(streams, stats)
+			}
+		}
+	}
+
+	// Sorted so the list is stable across polls; a medium's RTP stream
+	// comes before its RTCP one.
+	slices.SortStableFunc(streams, func(a, b StreamStats) int {
+		return cmp.Or(cmp.Compare(a.Tag, b.Tag), cmp.Compare(a.Medium, b.Medium))
+	})
+	return streams
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+func TestBuildStreamStats(t *testing.T) {
+	leg := func(ssrc int64, packets int64) map[string]interface{} {
+		return map[string]interface{}{"medias": []interface{}{map[string]interface{}{
+			"index": int64(1),
+			"type":  "audio",
+			"streams": []interface{}{
+				map[string]interface{}{"SSRC": ssrc, "last packet": int64(1000), "flags": []interface{}{"RTP"}, "stats": map[string]interface{}{"packets": packets, "errors": int64(3)}},
+				map[string]interface{}{"flags": []interface{}{"RTCP"}, "stats": map[string]interface{}{"packets": int64(2)}},
+			},
+		}}}
+	}
+	details := rtpengine.DecodeCallDetails(map[string]interface{}{
+		"tags": map[string]interface{}{"a": leg(1, 500), "b": leg(2, 0), "spy-1": leg(3, 500)},
+		"SSRC": map[string]interface{}{
+			"1": map[string]interface{}{"average MOS": map[string]interface{}{"MOS": int64(43), "jitter": int64(2)}},
+			"2": map[string]interface{}{"MOS progression": map[string]interface{}{"entries": []interface{}{
+				map[string]interface{}{"MOS": int64(40), "jitter": int64(5)},
+				map[string]interface{}{"MOS": int64(21), "jitter": int64(48), "packet loss": int64(12), "round-trip time": int64(150000)},
+			}}},
+		},
+	})
+	subs := []spy.Subscription{{Leg: "from", Tag: "a", SubTag: "spy-1"}}
+
+	streams := buildStreamStats(details, "a", "b", subs, time.Unix(1010, 0))
+	if len(streams) != 4 {
+		t.Fatalf("got %d streams, want 4: %+v", len(streams), streams)
+	}
+	a, aRTCP, b := streams[0], streams[1], streams[2]
+	if a.Tag != "a" || a.Leg != "from" || a.RTCP || a.Packets != 500 || a.Errors != 3 || a.MOS == nil || *a.MOS != 4.3 || *a.JitterMs != 2 {
+		t.Errorf("stream a = %+v", a)
+	}
+	if a.Idle == nil || *a.Idle != 10 {
+		t.Errorf("stream a idle = %v, want 10", a.Idle)
+	}
+	if aRTCP.Tag != "a" || !aRTCP.RTCP || aRTCP.MOS != nil || aRTCP.LastPacket != nil {
+		t.Errorf("RTCP stream of a = %+v", aRTCP)
+	}
+	// The latest MOS sample is reported rather than the first.
+	if b.Leg != "to" || b.Packets != 0 || b.MOS == nil || *b.MOS != 2.1 || *b.JitterMs != 48 || *b.LossPercent != 12 || *b.RTTMs != 150 {
+		t.Errorf("stream b = %+v", b)
+	}
+}
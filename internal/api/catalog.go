@@ -0,0 +1,44 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/quota"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+// errorCode returns the catalog code of err, mapping the errors of the
+// packages the handler calls to their specific codes.
+func errorCode(err error, status int) catalog.Code {
+	var invalid *rtpengine.ResponseError
+	var truncated *rtpengine.TruncatedError
+	var exceeded *quota.ExceededError
+	var saturated *spy.SaturatedError
+	switch {
+	case errors.As(err, &invalid):
+		return catalog.RTPEngineResponse
+	case errors.As(err, &truncated):
+		return catalog.RTPEngineTooLarge
+	case errors.As(err, &exceeded):
+		return catalog.QuotaExceeded
+	case errors.As(err, &saturated):
+		return catalog.Saturated
+	case errors.Is(err, store.ErrLegalHold):
+		return catalog.LegalHold
+	case errors.Is(err, rtpengine.ErrReadOnly):
+		return catalog.ReadOnly
+	case errors.Is(err, rtpengine.ErrRateLimited):
+		return catalog.RTPEngineBusy
+	}
+	return catalog.CodeOf(err, status)
+}
+
+// handleCatalog lists the codes of API errors and events, so clients can
+// localize them.
+func (h *Handler) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	h.respondJSON(w, catalog.Entries())
+}
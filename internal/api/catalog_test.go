@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+func TestErrorCodes(t *testing.T) {
+	h := NewHandler(nil, nil, nil)
+	tests := []struct {
+		err    error
+		status int
+		want   catalog.Code
+	}{
+		{err: fmt.Errorf("erase: %w", store.ErrLegalHold), status: http.StatusConflict, want: catalog.LegalHold},
+		{err: &spy.SaturatedError{RetryAfter: time.Second}, status: http.StatusServiceUnavailable, want: catalog.Saturated},
+		{err: &rtpengine.ResponseError{Command: "query", Field: "tags"}, status: http.StatusInternalServerError, want: catalog.RTPEngineResponse},
+		{err: catalog.Errorf(catalog.FeatureDisabled, "watches are disabled"), status: http.StatusNotFound, want: catalog.FeatureDisabled},
+		{err: fmt.Errorf("call ID required"), status: http.StatusBadRequest, want: catalog.InvalidRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.respondError(rec, tt.err, tt.status)
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if body["code"] != string(tt.want) {
+			t.Errorf("code of %v = %q, want %q", tt.err, body["code"], tt.want)
+		}
+	}
+}
+
+func TestHandleCatalog(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(nil, nil, nil).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalog", nil))
+	var entries []catalog.Entry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(entries) != len(catalog.Entries()) {
+		t.Errorf("got %d entries, want %d", len(entries), len(catalog.Entries()))
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// WithChaos serves /debug/chaos, setting the faults ch injects into NG
+// exchanges.
+func WithChaos(ch *rtpengine.Chaos) HandlerOption {
+	return func(h *Handler) { h.chaos = ch }
+}
+
+// handleChaos reports the faults still to be injected on GET, replaces them
+// on PUT and clears them on DELETE.
+func (h *Handler) handleChaos(w http.ResponseWriter, r *http.Request) {
+	if h.chaos == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "chaos hooks are disabled"), http.StatusNotFound)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.Chaos", trace.WithAttributes(attribute.String("method", r.Method)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var f rtpengine.Faults
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if f.DropResponses < 0 || f.DelayMs < 0 || f.FailSubscriptions < 0 {
+			h.respondError(w, fmt.Errorf("faults must not be negative"), http.StatusBadRequest)
+			return
+		}
+		h.chaos.Set(f)
+		h.audit(ctx, "chaos.set", "", fmt.Sprintf("drop=%d delay_ms=%d fail_subscriptions=%d", f.DropResponses, f.DelayMs, f.FailSubscriptions))
+	case http.MethodDelete:
+		h.chaos.Set(rtpengine.Faults{})
+		h.audit(ctx, "chaos.clear", "", "")
+	default:
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	h.respondJSON(w, h.chaos.Faults())
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+func TestHandleChaos(t *testing.T) {
+	chaos := rtpengine.NewChaos()
+	mux := http.NewServeMux()
+	NewHandler(nil, nil, nil, WithChaos(chaos)).RegisterRoutes(mux)
+	do := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, "/debug/chaos", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPut, `{"drop_responses":2,"delay_ms":300,"fail_subscriptions":1}`)
+	want := rtpengine.Faults{DropResponses: 2, DelayMs: 300, FailSubscriptions: 1}
+	var got rtpengine.Faults
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got != want || chaos.Faults() != want {
+		t.Errorf("PUT = %d %s, faults %+v", rec.Code, rec.Body, chaos.Faults())
+	}
+	if rec := do(http.MethodPut, `{"drop_responses":-1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT with a negative count: status = %d, want 400", rec.Code)
+	}
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusOK || chaos.Faults() != (rtpengine.Faults{}) {
+		t.Errorf("DELETE = %d, faults %+v", rec.Code, chaos.Faults())
+	}
+
+	disabled := http.NewServeMux()
+	NewHandler(nil, nil, nil).RegisterRoutes(disabled)
+	rec = httptest.NewRecorder()
+	disabled.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/chaos", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without chaos hooks = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/notice"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// WithRecordingConsent plays file, within the media directory, to every
+// leg of a call when a recording asking for consent starts, as several
+// jurisdictions require callers to be told. With required set every
+// recording the monitor starts is announced.
+func WithRecordingConsent(file string, required bool) HandlerOption {
+	return func(h *Handler) {
+		h.consentFile = file
+		h.consentRequired = required
+	}
+}
+
+// checkConsent reports an error when a recording asks for consent that
+// cannot be announced.
+func (h *Handler) checkConsent(consent bool) error {
+	if consent && h.consentFile == "" {
+		return catalog.Errorf(catalog.FeatureDisabled, "recording consent announcements are disabled")
+	}
+	return nil
+}
+
+// announceRecording plays the consent announcement to the legs of a call
+// whose recording just started, when it asked for consent or consent is
+// required, and audits the consent event. Spy subscriptions are not
+// announced to.
+func (h *Handler) announceRecording(ctx context.Context, callID string, consent bool) error {
+	if h.consentFile == "" || !(consent || h.consentRequired) {
+		return nil
+	}
+	details, err := h.rtpClient.QueryCall(ctx, callID)
+	if err != nil {
+		return err
+	}
+	spyTags := map[string]bool{}
+	if h.spyService != nil {
+		for _, sub := range h.spyService.Subscriptions(callID) {
+			spyTags[sub.SubTag] = true
+		}
+	}
+	var tags []string
+	for tag := range rtpengine.DecodeCallDetails(details).Tags {
+		if !spyTags[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("call has no legs to announce the recording to")
+	}
+	sort.Strings(tags)
+
+	// Rooting the name keeps it from escaping the directory.
+	file := filepath.Join(h.mediaDir, filepath.Clean("/"+h.consentFile))
+	for _, tag := range tags {
+		resp, err := h.rtpClient.PlayMedia(ctx, callID, tag, rtpengine.PlayMediaOptions{File: file})
+		if err != nil {
+			return fmt.Errorf("failed to announce the recording to %s: %w", tag, err)
+		}
+		h.noticePlayback(callID, tag, notice.SourceConsent, resp)
+	}
+	h.audit(ctx, "call.recording.consent", callID, h.consentFile+" "+strings.Join(tags, ","))
+	return nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithSpyDedupe returns the existing session when the same principal requests
+// a spy session for the same call again within window, so double clicks do
+// not pile up sessions.
+func WithSpyDedupe(window time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.dedupe = &spyDedupe{window: window, recent: make(map[string]*dedupeEntry)}
+	}
+}
+
+type dedupeEntry struct {
+	done chan struct{}
+	at   time.Time
+	resp SpyResponse
+	err  error
+}
+
+// spyDedupe remembers recent spy requests per principal and call. Concurrent
+// duplicates wait for the first request instead of starting their own.
+type spyDedupe struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	recent map[string]*dedupeEntry
+}
+
+// do runs start unless an equivalent request is in flight or completed within
+// the window, in which case its result is returned and duplicate is true.
+// alive reports whether a completed session can still be reused.
+func (d *spyDedupe) do(key string, alive func(SpyResponse) bool, start func() (SpyResponse, error)) (resp SpyResponse, duplicate bool, err error) {
+	now := time.Now()
+
+	d.mu.Lock()
+	for k, e := range d.recent {
+		if isDone(e) && now.Sub(e.at) > d.window {
+			delete(d.recent, k)
+		}
+	}
+	if e, ok := d.recent[key]; ok {
+		d.mu.Unlock()
+		<-e.done
+		if e.err == nil && alive(e.resp) {
+			return e.resp, true, nil
+		}
+		d.mu.Lock()
+		if d.recent[key] == e {
+			delete(d.recent, key)
+		}
+	}
+	e := &dedupeEntry{done: make(chan struct{})}
+	d.recent[key] = e
+	d.mu.Unlock()
+
+	e.resp, e.err = start()
+	e.at = time.Now()
+	close(e.done)
+
+	if e.err != nil {
+		d.mu.Lock()
+		if d.recent[key] == e {
+			delete(d.recent, key)
+		}
+		d.mu.Unlock()
+	}
+	return e.resp, false, e.err
+}
+
+func isDone(e *dedupeEntry) bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// principal identifies the requester: a digest of its API key, or its
+// address when API keys are not configured.
+func principal(r *http.Request) string {
+	if key := apiKey(r); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpyDedupe(t *testing.T) {
+	d := &spyDedupe{window: time.Minute, recent: make(map[string]*dedupeEntry)}
+	var started atomic.Int32
+	alive := func(SpyResponse) bool { return true }
+	start := func() (SpyResponse, error) {
+		n := started.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return SpyResponse{SpyID: string(rune('a' + n - 1))}, nil
+	}
+
+	var wg sync.WaitGroup
+	var duplicates atomic.Int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, dup, err := d.do("alice|call-1", alive, start)
+			if err != nil || resp.SpyID != "a" {
+				t.Errorf("do() = %+v, %v", resp, err)
+			}
+			if dup {
+				duplicates.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if started.Load() != 1 || duplicates.Load() != 4 {
+		t.Errorf("started %d sessions with %d duplicates, want 1 and 4", started.Load(), duplicates.Load())
+	}
+
+	if resp, dup, _ := d.do("bob|call-1", alive, start); dup || resp.SpyID != "b" {
+		t.Errorf("other principal: got %+v, duplicate %v", resp, dup)
+	}
+	if resp, dup, _ := d.do("alice|call-1", func(SpyResponse) bool { return false }, start); dup || resp.SpyID != "c" {
+		t.Errorf("closed session: got %+v, duplicate %v", resp, dup)
+	}
+
+	failing := func() (SpyResponse, error) { return SpyResponse{}, errors.New("boom") }
+	d.do("alice|call-2", alive, failing)
+	if _, dup, _ := d.do("alice|call-2", alive, start); dup {
+		t.Error("failed request must not be reused")
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	r := httptest.NewRequest("POST", "/spy/c1", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	if got := principal(r); got != "addr:10.0.0.1" {
+		t.Errorf("principal() = %q", got)
+	}
+
+	r.Header.Set("X-API-Key", "secret")
+	keyed := principal(r)
+	r.Header.Del("X-API-Key")
+	r.Header.Set("Authorization", "Bearer secret")
+	if got := principal(r); got != keyed || got == "addr:10.0.0.1" {
+		t.Errorf("principal() = %q, want %q for the same key", got, keyed)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// dtmfDigits are the DTMF events rtpengine can play.
+const dtmfDigits = "0123456789*#ABCD"
+
+// DTMFRequest blocks, unblocks or plays DTMF on a leg of a call. Blocking
+// applies to every leg when Leg is empty or "all"; playing needs a leg.
+type DTMFRequest struct {
+	Action     string `json:"action"`
+	Leg        string `json:"leg"`
+	Digits     string `json:"digits,omitempty"`
+	DurationMs int    `json:"duration_ms,omitempty"`
+	PauseMs    int    `json:"pause_ms,omitempty"`
+	Volume     int    `json:"volume,omitempty"`
+}
+
+// handleDTMF lets supervisors drive IVRs while spying on a call, or keep
+// digits such as card numbers from reaching the other party.
+func (h *Handler) handleDTMF(w http.ResponseWriter, r *http.Request, callID string) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DTMFRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+	if req.Leg == "" {
+		req.Leg = "all"
+	}
+	req.Digits = strings.ToUpper(req.Digits)
+	if req.Action == "play" && (req.Digits == "" || strings.Trim(req.Digits, dtmfDigits) != "") {
+		h.respondError(w, fmt.Errorf("digits must be a non-empty string of %s", dtmfDigits), http.StatusBadRequest)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.DTMF", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID)), attribute.String("action", req.Action), attribute.String("leg", req.Leg)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	var fromTag string
+	if req.Leg != "all" || req.Action == "play" {
+		tag, status, err := h.legTag(ctx, callID, req.Leg)
+		if err != nil {
+			h.respondError(w, err, status)
+			return
+		}
+		fromTag = tag
+	}
+
+	var err error
+	switch req.Action {
+	case "block":
+		_, err = h.rtpClient.BlockDTMF(ctx, callID, fromTag)
+	case "unblock":
+		_, err = h.rtpClient.UnblockDTMF(ctx, callID, fromTag)
+	case "play":
+		_, err = h.rtpClient.PlayDTMF(ctx, callID, fromTag, req.Digits, rtpengine.DTMFOptions{
+			Duration: req.DurationMs,
+			Pause:    req.PauseMs,
+			Volume:   req.Volume,
+		})
+	default:
+		h.respondError(w, fmt.Errorf("unknown DTMF action %q", req.Action), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Played digits are kept out of the audit log, they may be PINs.
+	h.audit(ctx, "call.dtmf."+req.Action, callID, req.Leg)
+	h.respondJSON(w, MediaResponse{CallID: callID, Action: req.Action, Leg: req.Leg})
+}
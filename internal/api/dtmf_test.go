@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+type dtmfClient struct {
+	rtpengine.Client
+	commands []string
+}
+
+func (c *dtmfClient) BlockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	c.commands = append(c.commands, "block "+callID)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func (c *dtmfClient) UnblockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	c.commands = append(c.commands, "unblock "+callID)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func TestHandleDTMF(t *testing.T) {
+	client := &dtmfClient{}
+	mux := http.NewServeMux()
+	NewHandler(client, nil, nil).RegisterRoutes(mux)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"block all legs", `{"action":"block"}`, http.StatusOK},
+		{"unblock all legs", `{"action":"unblock","leg":"all"}`, http.StatusOK},
+		{"play without digits", `{"action":"play","leg":"to"}`, http.StatusBadRequest},
+		{"play invalid digits", `{"action":"play","leg":"to","digits":"12x"}`, http.StatusBadRequest},
+		{"play without spy service", `{"action":"play","leg":"to","digits":"1#"}`, http.StatusBadRequest},
+		{"unknown action", `{"action":"flash"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calls/c1/dtmf", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d, body %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	if len(client.commands) != 2 || client.commands[0] != "block c1" || client.commands[1] != "unblock c1" {
+		t.Errorf("commands = %v", client.commands)
+	}
+}
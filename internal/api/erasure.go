@@ -0,0 +1,283 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+// WithErasureKey enables the history erasure API. Receipts are signed with
+// HMAC-SHA256 under key so they can later be verified with
+// ErasureReceipt.Verify.
+func WithErasureKey(key []byte) HandlerOption {
+	return func(h *Handler) { h.erasureKey = key }
+}
+
+// ErasureReceipt proves that the history of a call was erased. Recording
+// files that could not be removed are listed as retained, so the receipt
+// never claims more than was erased.
+type ErasureReceipt struct {
+	ID            string         `json:"id"`
+	CallID        string         `json:"call_id"`
+	ErasedAt      time.Time      `json:"erased_at"`
+	Erased        store.Erasure  `json:"erased"`
+	FilesErased   []string       `json:"files_erased,omitempty"`
+	FilesRetained []RetainedFile `json:"files_retained,omitempty"`
+	Signature     string         `json:"signature"`
+}
+
+// RetainedFile is a recording location of an erased call whose files are
+// still on disk.
+type RetainedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+func (r ErasureReceipt) digest(key []byte) []byte {
+	r.Signature = ""
+	body, _ := json.Marshal(r)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Sign sets the receipt signature.
+func (r *ErasureReceipt) Sign(key []byte) {
+	r.Signature = hex.EncodeToString(r.digest(key))
+}
+
+// Verify reports whether the receipt was signed with key and left unmodified.
+func (r ErasureReceipt) Verify(key []byte) bool {
+	sig, err := hex.DecodeString(r.Signature)
+	return err == nil && hmac.Equal(sig, r.digest(key))
+}
+
+type LegalHoldRequest struct {
+	Reason string `json:"reason"`
+}
+
+type BulkEraseRequest struct {
+	CallIDs []string `json:"call_ids"`
+}
+
+type BulkEraseResult struct {
+	CallID  string          `json:"call_id"`
+	Receipt *ErasureReceipt `json:"receipt,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func (h *Handler) erasureEnabled(w http.ResponseWriter) bool {
+	if h.store == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "persistence is disabled"), http.StatusNotFound)
+		return false
+	}
+	if len(h.erasureKey) == 0 {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "erasure is disabled"), http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) handleEraseCall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	callID := r.URL.Path[len("/history/calls/"):]
+	if callID == "" {
+		h.respondError(w, fmt.Errorf("call ID required"), http.StatusBadRequest)
+		return
+	}
+	if !h.erasureEnabled(w) {
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.EraseCall", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	receipt, err := h.erase(r, callID)
+	if errors.Is(err, store.ErrLegalHold) {
+		h.respondError(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.audit(ctx, "history.erase", "", receipt.ID)
+	h.respondJSON(w, receipt)
+}
+
+func (h *Handler) handleBulkErase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.erasureEnabled(w) {
+		return
+	}
+
+	var req BulkEraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.BulkErase", trace.WithAttributes(attribute.Int("targets", len(req.CallIDs))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	results := make([]BulkEraseResult, 0, len(req.CallIDs))
+	for _, callID := range req.CallIDs {
+		receipt, err := h.erase(r.WithContext(ctx), callID)
+		if err != nil {
+			results = append(results, BulkEraseResult{CallID: callID, Error: err.Error()})
+			continue
+		}
+		h.audit(ctx, "history.erase", "", receipt.ID)
+		results = append(results, BulkEraseResult{CallID: callID, Receipt: receipt})
+	}
+	h.respondJSON(w, results)
+}
+
+// erase removes the history of a call, including audit entries recorded
+// under its anonymized hash, and the recording files at the stored
+// recording locations, and returns a signed receipt. Files are only removed
+// once the store erased the call, so calls under legal hold keep them.
+func (h *Handler) erase(r *http.Request, callID string) (*ErasureReceipt, error) {
+	var aliases []string
+	if redact.Enabled() {
+		aliases = append(aliases, redact.CallID(callID))
+	}
+
+	recordings, err := h.store.ListRecordings(r.Context(), callID)
+	if err != nil {
+		return nil, err
+	}
+	erased, err := h.store.EraseCall(r.Context(), callID, aliases...)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := &ErasureReceipt{
+		ID:       uuid.New().String(),
+		CallID:   callID,
+		ErasedAt: time.Now().UTC(),
+		Erased:   *erased,
+	}
+	receipt.FilesErased, receipt.FilesRetained = eraseRecordingFiles(callID, recordings)
+	receipt.Sign(h.erasureKey)
+	return receipt, nil
+}
+
+// eraseRecordingFiles removes the files rtpengine wrote for a call below
+// the locations of its recordings. rtpengine names them after the call ID
+// ("{call-id}-{random}.pcap", ".meta", ".wav", ...), in the directory itself
+// or its metadata and pcaps spool subdirectories. Locations that cannot be
+// searched, and files that cannot be removed, are reported as retained.
+func eraseRecordingFiles(callID string, recordings []store.RecordingRecord) (erased []string, retained []RetainedFile) {
+	if strings.ContainsAny(callID, `/\`) || callID == "." || callID == ".." {
+		for _, rec := range recordings {
+			retained = append(retained, RetainedFile{Path: rec.Location, Reason: "call ID is not a safe file name"})
+		}
+		return nil, retained
+	}
+
+	seen := make(map[string]bool)
+	for _, rec := range recordings {
+		if seen[rec.Location] {
+			continue
+		}
+		seen[rec.Location] = true
+		if rec.Location == "" {
+			retained = append(retained, RetainedFile{Reason: "recorded to rtpengine's default recording directory"})
+			continue
+		}
+
+		found := 0
+		err := filepath.WalkDir(rec.Location, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !isRecordingFile(d.Name(), callID) {
+				return nil
+			}
+			found++
+			if err := os.Remove(path); err != nil {
+				retained = append(retained, RetainedFile{Path: path, Reason: err.Error()})
+				return nil
+			}
+			erased = append(erased, path)
+			return nil
+		})
+		switch {
+		case err != nil:
+			retained = append(retained, RetainedFile{Path: rec.Location, Reason: err.Error()})
+		case found == 0:
+			retained = append(retained, RetainedFile{Path: rec.Location, Reason: "no recording files found"})
+		}
+	}
+	return erased, retained
+}
+
+func isRecordingFile(name, callID string) bool {
+	rest, ok := strings.CutPrefix(name, callID)
+	return ok && (strings.HasPrefix(rest, "-") || strings.HasPrefix(rest, "."))
+}
+
+func (h *Handler) handleLegalHold(w http.ResponseWriter, r *http.Request) {
+	callID := r.URL.Path[len("/history/holds/"):]
+	if callID == "" {
+		h.respondError(w, fmt.Errorf("call ID required"), http.StatusBadRequest)
+		return
+	}
+	if h.store == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "persistence is disabled"), http.StatusNotFound)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.LegalHold", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	switch r.Method {
+	case http.MethodPut:
+		var req LegalHoldRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		hold := store.LegalHold{CallID: callID, Reason: req.Reason, PlacedAt: time.Now()}
+		if err := h.store.PlaceLegalHold(ctx, hold); err != nil {
+			h.respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.audit(ctx, "history.hold", callID, req.Reason)
+		h.respondJSON(w, hold)
+	case http.MethodDelete:
+		if err := h.store.ReleaseLegalHold(ctx, callID); err != nil {
+			h.respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.audit(ctx, "history.release", callID, "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
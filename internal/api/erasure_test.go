@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+func TestErasureReceiptVerify(t *testing.T) {
+	key := []byte("secret")
+	receipt := ErasureReceipt{ID: "r1", CallID: "c1", ErasedAt: time.UnixMilli(1000).UTC(), Erased: store.Erasure{Calls: 1}}
+	receipt.Sign(key)
+
+	if !receipt.Verify(key) {
+		t.Fatal("expected signed receipt to verify")
+	}
+	if receipt.Verify([]byte("other")) {
+		t.Error("receipt verified with the wrong key")
+	}
+	tampered := receipt
+	tampered.Erased.Calls = 0
+	if tampered.Verify(key) {
+		t.Error("tampered receipt verified")
+	}
+}
+
+func TestEraseCall(t *testing.T) {
+	ctx := context.Background()
+	st, err := store.Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	key := []byte("secret")
+	mux := http.NewServeMux()
+	NewHandler(nil, nil, st, WithErasureKey(key)).RegisterRoutes(mux)
+
+	for _, callID := range []string{"c1", "c2"} {
+		if err := st.SaveCall(ctx, store.CallRecord{CallID: callID, FirstSeen: time.Now(), LastSeen: time.Now()}); err != nil {
+			t.Fatalf("SaveCall() error = %v", err)
+		}
+	}
+	if err := st.PlaceLegalHold(ctx, store.LegalHold{CallID: "c2", Reason: "case 42", PlacedAt: time.Now()}); err != nil {
+		t.Fatalf("PlaceLegalHold() error = %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/history/calls/c1", want: http.StatusOK},
+		{path: "/history/calls/c2", want: http.StatusConflict},
+		{path: "/history/calls/", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("DELETE %s = %d, want %d: %s", tt.path, rec.Code, tt.want, rec.Body)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var receipt ErasureReceipt
+		if err := json.NewDecoder(rec.Body).Decode(&receipt); err != nil {
+			t.Fatalf("failed to decode receipt: %v", err)
+		}
+		if receipt.Erased.Calls != 1 || !receipt.Verify(key) {
+			t.Errorf("unexpected receipt: %+v", receipt)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/history/calls/bulk", strings.NewReader(`{"call_ids":["c1","c2"]}`)))
+	var results []BulkEraseResult
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatalf("failed to decode bulk results: %v", err)
+	}
+	if len(results) != 2 || results[0].Receipt == nil || results[1].Error == "" {
+		t.Errorf("unexpected bulk results: %+v", results)
+	}
+}
+
+func TestEraseCallRecordingFiles(t *testing.T) {
+	ctx := context.Background()
+	st, err := store.Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	dir := t.TempDir()
+	files := map[string]bool{
+		"c1-4f2a.pcap":          false,
+		"metadata/c1-4f2a.meta": false,
+		"c2-9b1c.pcap":          true, // under legal hold
+		"c10-77aa.pcap":         true, // another call sharing the prefix
+	}
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("rtp"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, callID := range []string{"c1", "c2"} {
+		if err := st.SaveRecording(ctx, store.RecordingRecord{ID: callID, CallID: callID, Location: dir, StartedAt: time.Now()}); err != nil {
+			t.Fatalf("SaveRecording() error = %v", err)
+		}
+	}
+	if err := st.SaveRecording(ctx, store.RecordingRecord{ID: "c1-default", CallID: "c1", StartedAt: time.Now()}); err != nil {
+		t.Fatalf("SaveRecording() error = %v", err)
+	}
+	if err := st.PlaceLegalHold(ctx, store.LegalHold{CallID: "c2", Reason: "case 42", PlacedAt: time.Now()}); err != nil {
+		t.Fatalf("PlaceLegalHold() error = %v", err)
+	}
+
+	key := []byte("secret")
+	mux := http.NewServeMux()
+	NewHandler(nil, nil, st, WithErasureKey(key)).RegisterRoutes(mux)
+	for _, callID := range []string{"c1", "c2"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/history/calls/"+callID, nil))
+		if callID == "c2" {
+			if rec.Code != http.StatusConflict {
+				t.Errorf("DELETE held call = %d, want %d", rec.Code, http.StatusConflict)
+			}
+			continue
+		}
+		var receipt ErasureReceipt
+		if err := json.NewDecoder(rec.Body).Decode(&receipt); err != nil {
+			t.Fatalf("failed to decode receipt: %v", err)
+		}
+		if len(receipt.FilesErased) != 2 || !receipt.Verify(key) {
+			t.Errorf("files erased = %v, want both files of c1", receipt.FilesErased)
+		}
+		// The recording made to rtpengine's default directory is out of
+		// reach and must not be claimed as erased.
+		if len(receipt.FilesRetained) != 1 || receipt.FilesRetained[0].Path != "" {
+			t.Errorf("files retained = %+v, want the default directory", receipt.FilesRetained)
+		}
+	}
+
+	for name, kept := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != kept {
+			t.Errorf("%s exists = %v, want %v", name, exists, kept)
+		}
+	}
+}
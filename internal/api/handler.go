@@ -1,50 +1,304 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
-	"rtpengine-mon/internal/rtpengine"
-	"rtpengine-mon/internal/spy"
+	"github.com/civilcoder55/rtpengine-mon/internal/automation"
+	"github.com/civilcoder55/rtpengine-mon/internal/bridge"
+	"github.com/civilcoder55/rtpengine-mon/internal/capacity"
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/cluster"
+	"github.com/civilcoder55/rtpengine-mon/internal/doctor"
+	"github.com/civilcoder55/rtpengine-mon/internal/mail"
+	"github.com/civilcoder55/rtpengine-mon/internal/maintenance"
+	"github.com/civilcoder55/rtpengine-mon/internal/notice"
+	"github.com/civilcoder55/rtpengine-mon/internal/quota"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/slo"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+	"github.com/civilcoder55/rtpengine-mon/internal/tenant"
+	"github.com/civilcoder55/rtpengine-mon/internal/watermark"
 )
 
+// callStreamPage is how many calls a streamed call list asks rtpengine for
+// at a time, and writes between flushes.
+const callStreamPage = 1000
+
 type Handler struct {
 	rtpClient  rtpengine.Client
 	spyService *spy.Service
+	store      store.Store
 	tracer     trace.Tracer
+
+	apiKeys  map[string]spy.Priority
+	cluster  *cluster.Cluster
+	samplers []*capacity.Sampler
+	owners   CallOwners
+
+	erasureKey []byte
+	tenants    *tenant.Registry
+	ngLog      *rtpengine.NGLog
+	chaos      *rtpengine.Chaos
+	watermark  *watermark.Key
+	health     *rtpengine.HealthChecker
+	mediaDir   string
+	// consentFile is announced when recordings asking for consent start,
+	// and every recording when consentRequired is set.
+	consentFile     string
+	consentRequired bool
+	// notices tell agents about announcements played into their legs.
+	notices *notice.Notifier
+	// screenPopURL receives a ScreenPop for every spy session started.
+	screenPopURL string
+	// readOnly refuses the requests that would change anything.
+	readOnly bool
+	// labels are sent with every event.
+	labels map[string]string
+	// build is served at /version.
+	build BuildInfo
+	// doctor runs the self-diagnostics served at /admin/doctor.
+	doctor *doctor.Doctor
+	// bridge republishes the audio of calls as plain RTP.
+	bridge *bridge.Bridge
+	// automation runs operator scripts for calls starting and ending.
+	automation *automation.Engine
+	// mailer emails the matches of watches that ask for it.
+	mailer *mail.Mailer
+	// maintenance suppresses automatic recordings and watch emails during
+	// its windows.
+	maintenance *maintenance.Schedule
+
+	requestDuration  metric.Float64Histogram
+	duplicateCounter metric.Int64Counter
+	slo              *slo.Tracker
+	dedupe           *spyDedupe
+	quotas           *quota.Tracker
+	feed             callFeed
+	watches          watchList
+}
+
+// WithCapacity reports trend forecasts of the given samplers at /instances.
+func WithCapacity(samplers ...*capacity.Sampler) HandlerOption {
+	return func(h *Handler) { h.samplers = samplers }
+}
+
+// WithTenants records calls into the recording path of their tenant.
+func WithTenants(reg *tenant.Registry) HandlerOption {
+	return func(h *Handler) { h.tenants = reg }
+}
+
+// WithLabels sends the static labels of the instance with every event.
+func WithLabels(labels map[string]string) HandlerOption {
+	return func(h *Handler) { h.labels = labels }
+}
+
+// WithCluster redirects spy requests for calls owned by another replica.
+func WithCluster(c *cluster.Cluster) HandlerOption {
+	return func(h *Handler) { h.cluster = c }
 }
 
-func NewHandler(rtpClient rtpengine.Client, spyService *spy.Service) *Handler {
-	return &Handler{
+// NewHandler creates the API handler. st may be nil when persistence is disabled.
+func NewHandler(rtpClient rtpengine.Client, spyService *spy.Service, st store.Store, opts ...HandlerOption) *Handler {
+	h := &Handler{
 		rtpClient:  rtpClient,
 		spyService: spyService,
-		tracer:     otel.Tracer("http-handler"),
+		store:      st,
+		tracer:     serverSpanTracer{otel.Tracer("http-handler")},
+	}
+	meter := otel.Meter("http-handler")
+	h.requestDuration, _ = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of API requests by route and status"), metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10))
+	h.duplicateCounter, _ = meter.Int64Counter("spy.duplicate_requests_total",
+		metric.WithDescription("Spy requests answered with an existing session"))
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.quotas != nil {
+		h.spyService.OnSessionClosed(func(_ *spy.Source, sess *spy.Session) { h.quotas.SpyEnded(sess.ID) })
 	}
+	return h
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/calls", h.handleListCalls)
-	mux.HandleFunc("/calls/", h.handleCallDetails)
-	mux.HandleFunc("/spy/", h.handleSpy)
-	mux.HandleFunc("/spy/answer/", h.handleSpyAnswer)
-	mux.HandleFunc("/stats", h.handleStatistics)
+	h.handle(mux, "/calls", h.handleListCalls)
+	h.handle(mux, "/calls/", h.handleCallDetails)
+	h.handle(mux, "/calls/bulk", h.handleBulk)
+	h.handle(mux, "/calls/query", h.handleQueryCalls)
+	h.handle(mux, "/calls/ranked", h.handleRankedCalls)
+	// Event streams last as long as the client stays connected, so they are
+	// kept out of the latency metrics and SLOs.
+	mux.HandleFunc("/calls/events", h.authenticate(h.limit(h.handleCallEvents)))
+	// Health probes come from load balancers without API keys.
+	mux.HandleFunc("/health", h.handleHealth)
+	h.handle(mux, "/spy/", h.handleSpy)
+	h.handle(mux, "/spy/answer/", h.handleSpyAnswer)
+	h.handle(mux, "/sessions/", h.handleSessionDetails)
+	h.handle(mux, "/stats", h.handleStatistics)
+	h.handle(mux, "/stats/aggregate", h.handleAggregateStats)
+	h.handle(mux, "/history/calls/", h.handleEraseCall)
+	h.handle(mux, "/history/calls/bulk", h.handleBulkErase)
+	h.handle(mux, "/history/holds/", h.handleLegalHold)
+	h.handle(mux, "/watches", h.handleWatches)
+	h.handle(mux, "/watches/", h.handleWatches)
+	h.handle(mux, "/preferences", h.handlePreferences)
+	h.handle(mux, "/catalog", h.handleCatalog)
+	h.handle(mux, "/version", h.handleVersion)
+	h.handle(mux, "/sources", h.handleSources)
+	h.handle(mux, "/shadow", h.handleShadow)
+	h.handle(mux, "/instances", h.handleInstances)
+	h.handle(mux, "/slo", h.handleSLO)
+	h.handle(mux, "/admin/schema", h.handleSchema)
+	h.handle(mux, "/admin/cluster", h.handleCluster)
+	h.handle(mux, "/admin/usage", h.handleUsage)
+	h.handle(mux, "/admin/ng-log", h.handleNGLog)
+	h.handle(mux, "/debug/ng", h.handleNGLog)
+	h.handle(mux, "/debug/chaos", h.handleChaos)
+	h.handle(mux, "/admin/subscriptions", h.handleSubscriptionBudget)
+	h.handle(mux, "/admin/top", h.handleTop)
+	h.handle(mux, "/admin/automation", h.handleAutomation)
+	h.handle(mux, "/admin/watermark", h.handleWatermark)
+	h.handle(mux, "/admin/doctor", h.handleDoctor)
+	h.handle(mux, "/admin/maintenance", h.handleMaintenance)
+	h.handle(mux, "/admin/maintenance/", h.handleMaintenance)
 }
 
 func (h *Handler) handleListCalls(w http.ResponseWriter, r *http.Request) {
 	ctx, span := h.tracer.Start(r.Context(), "http.ListCalls", trace.WithSpanKind(trace.SpanKindServer))
 	defer span.End()
 
-	list, err := h.rtpClient.ListCalls(ctx)
+	query := r.URL.Query()
+	opts, err := listOptions(query)
+	if err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+	if query.Get("stream") == "true" {
+		if opts != (rtpengine.ListOptions{}) {
+			h.respondError(w, fmt.Errorf("a stream lists every call; limit and offset do not apply"), http.StatusBadRequest)
+			return
+		}
+		h.streamCalls(ctx, w, query.Get("audio") == "true")
+		return
+	}
+
+	list, err := h.rtpClient.ListCalls(ctx, opts)
 	if err != nil {
 		h.respondError(w, err, http.StatusInternalServerError)
 		return
 	}
-	h.respondJSON(w, list)
+	if query.Get("audio") != "true" {
+		h.respondJSON(w, list)
+		return
+	}
+
+	h.respondJSON(w, h.callSummaries(list))
+}
+
+// listOptions reads the page of the call list asked for with the limit and
+// offset parameters.
+func listOptions(query url.Values) (rtpengine.ListOptions, error) {
+	var opts rtpengine.ListOptions
+	for _, p := range []struct {
+		name string
+		v    *int
+	}{{"limit", &opts.Limit}, {"offset", &opts.Offset}} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("%s must be a non-negative integer", p.name)
+		}
+		*p.v = n
+	}
+	return opts, nil
+}
+
+// streamCalls writes every call as a line of JSON, the call ID or with
+// audio its summary, while rtpengine lists them a page at a time. An error
+// after the first call ends the stream early.
+func (h *Handler) streamCalls(ctx context.Context, w http.ResponseWriter, audio bool) {
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	var classes map[string]spy.CallAudio
+	if audio {
+		classes = h.spyService.AudioClasses()
+	}
+	n := 0
+	for callID, err := range rtpengine.Calls(ctx, h.rtpClient, callStreamPage) {
+		if err != nil {
+			if n == 0 {
+				h.respondError(w, err, http.StatusInternalServerError)
+			} else {
+				log.Printf("Call stream: ended after %d calls: %v", n, err)
+			}
+			return
+		}
+		if n == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		var line interface{} = callID
+		if audio {
+			line = h.callSummary(classes, callID)
+		}
+		if err := enc.Encode(line); err != nil {
+			return
+		}
+		if n++; n%callStreamPage == 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	if n == 0 {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (h *Handler) callSummaries(list []string) []CallSummary {
+	classes := h.spyService.AudioClasses()
+	calls := make([]CallSummary, 0, len(list))
+	for _, callID := range list {
+		calls = append(calls, h.callSummary(classes, callID))
+	}
+	return calls
+}
+
+func (h *Handler) callSummary(classes map[string]spy.CallAudio, callID string) CallSummary {
+	call := CallSummary{CallID: callID}
+	call.Instance, _ = h.callOwner(callID)
+	if audio, ok := classes[callID]; ok {
+		call.Audio = &audio
+	}
+	return call
+}
+
+// CallSummary is a call list entry with the audio class of subscribed calls.
+type CallSummary struct {
+	CallID string `json:"call_id"`
+	// Instance is the rtpengine instance owning the call when there are
+	// several.
+	Instance string         `json:"instance,omitempty"`
+	Audio    *spy.CallAudio `json:"audio,omitempty"`
 }
 
 func (h *Handler) handleCallDetails(w http.ResponseWriter, r *http.Request) {
@@ -53,8 +307,47 @@ func (h *Handler) handleCallDetails(w http.ResponseWriter, r *http.Request) {
 		h.respondError(w, fmt.Errorf("call ID required"), http.StatusBadRequest)
 		return
 	}
+	if h.owners != nil {
+		w = &instanceWriter{ResponseWriter: w, owner: func() (string, bool) { return h.callOwner(callID) }}
+	}
+	if id, ok := strings.CutSuffix(callID, "/refresh"); ok {
+		h.handleRefreshCall(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(callID, "/legs"); ok {
+		h.handleLegs(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(callID, "/stats"); ok {
+		h.handleCallStats(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(callID, "/topology"); ok {
+		h.handleTopology(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(callID, "/recording"); ok {
+		h.handleRecording(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(callID, "/bridge"); ok {
+		h.handleBridge(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(callID, "/dtmf"); ok {
+		h.handleDTMF(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(callID, "/media"); ok {
+		h.handleMedia(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(callID, "/media-history"); ok {
+		h.handleMediaHistory(w, r, id)
+		return
+	}
 
-	ctx, span := h.tracer.Start(r.Context(), "http.CallDetails", trace.WithAttributes(attribute.String("call_id", callID)), trace.WithSpanKind(trace.SpanKindServer))
+	ctx, span := h.tracer.Start(r.Context(), "http.CallDetails", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
 	defer span.End()
 
 	details, err := h.rtpClient.QueryCall(ctx, callID)
@@ -62,48 +355,222 @@ func (h *Handler) handleCallDetails(w http.ResponseWriter, r *http.Request) {
 		h.respondError(w, err, http.StatusInternalServerError)
 		return
 	}
+	if talk, ok := h.spyService.TalkTime(callID); ok {
+		details["talk_time"] = talk
+	}
+	if name, ok := h.callOwner(callID); ok {
+		details["instance"] = name
+	}
+	var subs []spy.Subscription
+	if h.spyService != nil {
+		subs = h.spyService.Subscriptions(callID)
+	}
+	details["labels"] = legLabels(rtpengine.DecodeCallDetails(details), subs)
 	h.respondJSON(w, details)
 }
 
+func (h *Handler) handleRefreshCall(w http.ResponseWriter, r *http.Request, callID string) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.RefreshCall", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if h.cluster != nil {
+		if owner, local := h.cluster.Owner(callID); !local {
+			span.SetAttributes(attribute.String("owner", owner.ID))
+			http.Redirect(w, r, owner.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+			return
+		}
+	}
+
+	if h.rtpengineDown(w) {
+		return
+	}
+
+	account, _ := h.accounts(r)
+	ctx = rtpengine.WithLabel(ctx, rtpengine.Label{User: account, Purpose: rtpengine.PurposeRefresh})
+	update, err := h.spyService.RefreshSource(ctx, callID)
+	if errors.Is(err, spy.ErrSourceNotFound) {
+		h.respondError(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(update.Changed) > 0 {
+		h.audit(ctx, "call.refresh", callID, strings.Join(update.Changed, ","))
+	}
+	h.respondJSON(w, update)
+}
+
+type MediaHistoryResponse struct {
+	CallID string           `json:"call_id"`
+	Events []spy.MediaEvent `json:"events"`
+}
+
+func (h *Handler) handleMediaHistory(w http.ResponseWriter, r *http.Request, callID string) {
+	_, span := h.tracer.Start(r.Context(), "http.MediaHistory", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	events, err := h.spyService.MediaHistory(callID)
+	if err != nil {
+		h.respondError(w, err, http.StatusNotFound)
+		return
+	}
+	h.respondJSON(w, MediaHistoryResponse{CallID: callID, Events: events})
+}
+
 type SpyRequest struct {
 	FromTag string `json:"from_tag"`
 	ToTag   string `json:"to_tag"`
+	// FromLabel and ToLabel pick the legs by the label the SIP proxy gave
+	// them instead of by tag, e.g. "agent" and "customer".
+	FromLabel string `json:"from_label,omitempty"`
+	ToLabel   string `json:"to_label,omitempty"`
+	// Listener names who listens, e.g. the supervisor's login, for the
+	// screen-pop webhook.
+	Listener string `json:"listener,omitempty"`
+	// Subscribe overrides the configured NG options of the subscriptions
+	// the request makes. Listeners joining a call already subscribed share
+	// its subscriptions.
+	Subscribe *SubscribeOptions `json:"subscribe,omitempty"`
 }
+
+// SubscribeOptions override the NG options of subscribe requests, for
+// rtpengine versions that reject the defaults. Each field set replaces the
+// configured one.
+type SubscribeOptions struct {
+	Flags             []string `json:"flags,omitempty"`
+	RTCPMux           []string `json:"rtcp_mux,omitempty"`
+	TransportProtocol string   `json:"transport_protocol,omitempty"`
+	ICE               string   `json:"ice,omitempty"`
+	// Transcode lists the codecs subscriptions are transcoded to.
+	Transcode []string `json:"transcode,omitempty"`
+}
+
+func (o SubscribeOptions) media() rtpengine.MediaOptions {
+	opts := rtpengine.MediaOptions{
+		Flags:             o.Flags,
+		RTCPMux:           o.RTCPMux,
+		TransportProtocol: o.TransportProtocol,
+		ICE:               o.ICE,
+	}
+	if len(o.Transcode) > 0 {
+		opts.Codec = rtpengine.CodecOptions{Strip: []string{"all"}, Transcode: o.Transcode}
+	}
+	return opts
+}
+
 type SpyResponse struct {
 	SpyID   string `json:"spyID"`
 	SDP     string `json:"sdp"`
 	FromTag string `json:"from_tag"`
 	ToTag   string `json:"to_tag"`
+	// Duplicate is set when an existing session was returned for a repeated
+	// request.
+	Duplicate bool `json:"duplicate,omitempty"`
 }
 
 func (h *Handler) handleSpy(w http.ResponseWriter, r *http.Request) {
 	callID := r.URL.Path[len("/spy/"):]
-	
-	ctx, span := h.tracer.Start(r.Context(), "http.Spy", trace.WithAttributes(attribute.String("call_id", callID)),  trace.WithSpanKind(trace.SpanKindServer))
+	if sessionID, ok := strings.CutSuffix(callID, "/client-stats"); ok {
+		h.handleClientStats(w, r, sessionID)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.Spy", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
 	defer span.End()
 
+	if h.cluster != nil {
+		if owner, local := h.cluster.Owner(callID); !local {
+			span.SetAttributes(attribute.String("owner", owner.ID))
+			http.Redirect(w, r, owner.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+			return
+		}
+	}
+
+	if h.rtpengineDown(w) {
+		return
+	}
+
 	var req SpyRequest
 	if r.Body != nil {
 		_ = json.NewDecoder(r.Body).Decode(&req)
 	}
 
-	sessionID, sdp, fromTag, toTag, err := h.spyService.StartSpySession(ctx, callID, req.FromTag, req.ToTag)
+	account, tenant := h.accounts(r)
+	ctx = rtpengine.WithLabel(ctx, rtpengine.Label{User: account, Purpose: rtpengine.PurposeSpy})
+	if req.Subscribe != nil {
+		ctx = rtpengine.WithSubscribeOverrides(ctx, req.Subscribe.media())
+	}
+	start := func() (SpyResponse, error) {
+		if h.quotas != nil {
+			if err := h.quotas.AllowSpy(account, tenant); err != nil {
+				return SpyResponse{}, err
+			}
+		}
+		fromTag, toTag := req.FromTag, req.ToTag
+		if req.FromLabel != "" || req.ToLabel != "" {
+			var err error
+			if fromTag, toTag, err = h.spyService.TagsByLabel(ctx, callID, req.FromLabel, req.ToLabel); err != nil {
+				return SpyResponse{}, err
+			}
+		}
+		sessionID, sdp, fromTag, toTag, err := h.spyService.StartSpySession(ctx, callID, fromTag, toTag)
+		if err == nil && h.quotas != nil {
+			h.quotas.SpyStarted(sessionID, account, tenant)
+		}
+		return SpyResponse{SpyID: sessionID, SDP: sdp, FromTag: fromTag, ToTag: toTag}, err
+	}
+
+	var resp SpyResponse
+	var err error
+	if h.dedupe != nil {
+		alive := func(prev SpyResponse) bool {
+			_, err := h.spyService.SessionDetails(prev.SpyID)
+			return err == nil
+		}
+		resp, resp.Duplicate, err = h.dedupe.do(principal(r)+"|"+callID, alive, start)
+		if resp.Duplicate {
+			span.SetAttributes(attribute.Bool("duplicate", true))
+			h.duplicateCounter.Add(ctx, 1)
+		}
+	} else {
+		resp, err = start()
+	}
 	if err != nil {
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			h.respondQuotaError(w, err)
+			return
+		}
+		if errors.Is(err, spy.ErrLabelNotFound) {
+			h.respondError(w, err, http.StatusNotFound)
+			return
+		}
+		var saturated *spy.SaturatedError
+		if errors.As(err, &saturated) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(saturated.RetryAfter.Seconds()))))
+			h.respondError(w, err, http.StatusServiceUnavailable)
+			return
+		}
 		h.respondError(w, err, http.StatusInternalServerError)
 		return
 	}
+	if h.screenPopURL != "" && !resp.Duplicate {
+		go h.screenPop(context.WithoutCancel(ctx), callID, resp, ScreenPopListener{Name: req.Listener, Principal: account, Tenant: tenant})
+	}
 
-	h.respondJSON(w, SpyResponse{
-		SpyID:   sessionID,
-		SDP:     sdp,
-		FromTag: fromTag,
-		ToTag:   toTag,
-	})
+	h.respondJSON(w, resp)
 }
 
 func (h *Handler) handleSpyAnswer(w http.ResponseWriter, r *http.Request) {
 	spyID := r.URL.Path[len("/spy/answer/"):]
-	
+
 	ctx, span := h.tracer.Start(r.Context(), "http.SpyAnswer", trace.WithAttributes(attribute.String("spy_id", spyID)), trace.WithSpanKind(trace.SpanKindServer))
 	defer span.End()
 
@@ -134,15 +601,166 @@ func (h *Handler) handleStatistics(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, stats)
 }
 
+func (h *Handler) handleSources(w http.ResponseWriter, r *http.Request) {
+	_, span := h.tracer.Start(r.Context(), "http.Sources", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	h.respondJSON(w, h.spyService.Sources())
+}
+
+func (h *Handler) handleSubscriptionBudget(w http.ResponseWriter, r *http.Request) {
+	h.respondJSON(w, h.spyService.SubscriptionBudget())
+}
+
+func (h *Handler) handleShadow(w http.ResponseWriter, r *http.Request) {
+	_, span := h.tracer.Start(r.Context(), "http.Shadow", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	h.respondJSON(w, h.spyService.ShadowStats())
+}
+
+func (h *Handler) handleSchema(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "http.Schema", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if h.store == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "persistence is disabled"), http.StatusNotFound)
+		return
+	}
+
+	info, err := h.store.SchemaInfo(ctx)
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.respondJSON(w, info)
+}
+
+func (h *Handler) handleInstances(w http.ResponseWriter, r *http.Request) {
+	instances := make([]capacity.Headroom, 0, len(h.samplers))
+	for _, s := range h.samplers {
+		instances = append(instances, s.Headroom())
+	}
+	h.respondJSON(w, instances)
+}
+
+// WithNGLog serves the captured NG exchanges at /debug/ng and
+// /admin/ng-log.
+func WithNGLog(log *rtpengine.NGLog) HandlerOption {
+	return func(h *Handler) { h.ngLog = log }
+}
+
+func (h *Handler) handleNGLog(w http.ResponseWriter, r *http.Request) {
+	if h.ngLog == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "NG debug capture is disabled"), http.StatusNotFound)
+		return
+	}
+	h.respondJSON(w, h.ngLog.Entries())
+}
+
+// WithHealth serves the rtpengine connection health at /health and refuses
+// spy requests while rtpengine does not answer pings.
+func WithHealth(hc *rtpengine.HealthChecker) HandlerOption {
+	return func(h *Handler) { h.health = hc }
+}
+
+// handleHealth is served without authentication for load balancers and
+// orchestrators. It answers 503 while rtpengine is unreachable.
+func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if h.health == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "health checks are disabled"), http.StatusNotFound)
+		return
+	}
+	health := h.health.Health()
+	if !health.Healthy {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(health)
+		return
+	}
+	h.respondJSON(w, health)
+}
+
+// rtpengineDown answers 503 when pings show rtpengine is unreachable, rather
+// than letting the request wait for its own command to time out.
+func (h *Handler) rtpengineDown(w http.ResponseWriter) bool {
+	if h.health == nil || h.health.Healthy() {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(h.health.Interval().Seconds()))))
+	h.respondError(w, catalog.Errorf(catalog.RTPEngineDown, "rtpengine is not answering: %s", h.health.Health().LastError), http.StatusServiceUnavailable)
+	return true
+}
+
+// WithDoctor serves the self-diagnostics of d at /admin/doctor.
+func WithDoctor(d *doctor.Doctor) HandlerOption {
+	return func(h *Handler) { h.doctor = d }
+}
+
+// handleDoctor runs the self-diagnostics. It answers 503 when a check fails
+// so it can back an alert.
+func (h *Handler) handleDoctor(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "http.Doctor", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if h.doctor == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "self-diagnostics are disabled"), http.StatusNotFound)
+		return
+	}
+	results := h.doctor.Run(ctx)
+	if doctor.Failed(results) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+	h.respondJSON(w, results)
+}
+
+func (h *Handler) handleCluster(w http.ResponseWriter, r *http.Request) {
+	if h.cluster == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "clustering is disabled"), http.StatusNotFound)
+		return
+	}
+	h.respondJSON(w, map[string]interface{}{
+		"self":       h.cluster.Self(),
+		"members":    h.cluster.Members(),
+		"leadership": h.cluster.Leadership(),
+	})
+}
+
 func (h *Handler) respondJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		fmt.Printf("Error encoding JSON: %v", err)
+		log.Printf("Error encoding JSON: %v", err)
 	}
 }
 
+// respondError writes err as JSON along with its catalog code. Unexpected
+// and truncated rtpengine responses are reported as 502 with the offending
+// command and field.
 func (h *Handler) respondError(w http.ResponseWriter, err error, code int) {
+	body := map[string]string{"error": err.Error()}
+	var invalid *rtpengine.ResponseError
+	if errors.As(err, &invalid) {
+		code = http.StatusBadGateway
+		body["command"] = invalid.Command
+		body["field"] = invalid.Field
+	}
+	var truncated *rtpengine.TruncatedError
+	if errors.As(err, &truncated) {
+		code = http.StatusBadGateway
+		body["command"] = truncated.Command
+	}
+	if errors.Is(err, rtpengine.ErrReadOnly) {
+		code = http.StatusForbidden
+	}
+	if errors.Is(err, rtpengine.ErrRateLimited) {
+		code = http.StatusTooManyRequests
+	}
+	body["code"] = string(errorCode(err, code))
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	json.NewEncoder(w).Encode(body)
 }
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+type listClient struct {
+	rtpengine.Client
+	calls []string
+}
+
+func (c *listClient) ListCalls(ctx context.Context, opts rtpengine.ListOptions) ([]string, error) {
+	calls := c.calls[min(opts.Offset, len(c.calls)):]
+	if opts.Limit > 0 {
+		calls = calls[:min(opts.Limit, len(calls))]
+	}
+	return calls, nil
+}
+
+func TestListCallsPages(t *testing.T) {
+	client := &listClient{}
+	for i := range 2500 {
+		client.calls = append(client.calls, fmt.Sprintf("call-%d", i))
+	}
+	mux := http.NewServeMux()
+	NewHandler(client, nil, nil).RegisterRoutes(mux)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/calls?limit=2&offset=10")
+	var page []string
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || !slices.Equal(page, client.calls[10:12]) {
+		t.Errorf("page = %v, %v, want %v", page, err, client.calls[10:12])
+	}
+	for _, target := range []string{"/calls?limit=-1", "/calls?offset=x", "/calls?stream=true&limit=5"} {
+		if rec := get(target); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want 400", target, rec.Code)
+		}
+	}
+
+	rec = get("/calls?stream=true")
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("stream Content-Type = %q", ct)
+	}
+	var streamed []string
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		var callID string
+		if err := dec.Decode(&callID); err != nil {
+			t.Fatal(err)
+		}
+		streamed = append(streamed, callID)
+	}
+	if !slices.Equal(streamed, client.calls) {
+		t.Errorf("streamed %d calls, want %d", len(streamed), len(client.calls))
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// instanceHeader names the rtpengine instance that owns the call of a
+// response.
+const instanceHeader = "X-RTPEngine-Instance"
+
+// CallOwners names the rtpengine instance owning a call, as
+// rtpengine.Registry does.
+type CallOwners interface {
+	Owner(callID string) (string, bool)
+}
+
+// WithCallOwners tags responses about calls with the rtpengine instance
+// owning them: every /calls/{id} response carries the X-RTPEngine-Instance
+// header, and call details and call list entries an "instance" field.
+func WithCallOwners(owners CallOwners) HandlerOption {
+	return func(h *Handler) { h.owners = owners }
+}
+
+// callOwner returns the instance owning callID, which may be followed by
+// the sub-resource of a /calls/{id}/... path.
+func (h *Handler) callOwner(callID string) (string, bool) {
+	if h.owners == nil {
+		return "", false
+	}
+	if name, ok := h.owners.Owner(callID); ok {
+		return name, true
+	}
+	if i := strings.LastIndex(callID, "/"); i >= 0 {
+		return h.owners.Owner(callID[:i])
+	}
+	return "", false
+}
+
+// instanceWriter sets the instance header when the response starts, by
+// which time the request has found the call's owner.
+type instanceWriter struct {
+	http.ResponseWriter
+	owner   func() (string, bool)
+	started bool
+}
+
+func (w *instanceWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	if name, ok := w.owner(); ok {
+		w.Header().Set(instanceHeader, name)
+	}
+}
+
+func (w *instanceWriter) WriteHeader(status int) {
+	w.start()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *instanceWriter) Write(b []byte) (int, error) {
+	w.start()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *instanceWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
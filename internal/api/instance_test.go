@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeOwners map[string]string
+
+func (o fakeOwners) Owner(callID string) (string, bool) {
+	name, ok := o[callID]
+	return name, ok
+}
+
+func TestInstanceHeader(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(&dtmfClient{}, nil, nil, WithCallOwners(fakeOwners{"c1": "rtp-b"})).RegisterRoutes(mux)
+
+	for path, want := range map[string]string{"/calls/c1/dtmf": "rtp-b", "/calls/c2/dtmf": ""} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"action":"block"}`)))
+		if got := rec.Header().Get(instanceHeader); got != want {
+			t.Errorf("%s: %s = %q, want %q", path, instanceHeader, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// Leg describes one party of a call with what its audio supports, so
+// operators know whether DTMF capture and media injection will work before
+// trying. Leg is "from" or "to" when the call's direction is known.
+type Leg struct {
+	Tag   string `json:"tag"`
+	Label string `json:"label,omitempty"`
+	Leg   string `json:"leg,omitempty"`
+	// SRTP, CryptoSuite and TelephoneEvent describe the leg's first audio
+	// medium. TelephoneEvent is nil when rtpengine does not list codecs.
+	SRTP           bool        `json:"srtp"`
+	CryptoSuite    string      `json:"crypto_suite,omitempty"`
+	TelephoneEvent *bool       `json:"telephone_event"`
+	Media          []LegMedium `json:"media"`
+}
+
+// LegMedium is one medium of a leg.
+type LegMedium struct {
+	Index          int    `json:"index"`
+	Type           string `json:"type"`
+	Protocol       string `json:"protocol"`
+	Codec          string `json:"codec,omitempty"`
+	SRTP           bool   `json:"srtp"`
+	CryptoSuite    string `json:"crypto_suite,omitempty"`
+	TelephoneEvent *bool  `json:"telephone_event"`
+}
+
+func (h *Handler) handleLegs(w http.ResponseWriter, r *http.Request, callID string) {
+	if r.Method != http.MethodGet {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.Legs", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	details, err := h.rtpClient.QueryCall(ctx, callID)
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var from, to string
+	var subs []spy.Subscription
+	if h.spyService != nil {
+		// Only named when the direction is known; calls with fewer than two
+		// tags have none.
+		from, to, _ = h.spyService.CallTags(ctx, callID)
+		subs = h.spyService.Subscriptions(callID)
+	}
+	h.respondJSON(w, buildLegs(rtpengine.DecodeCallDetails(details), from, to, subs))
+}
+
+// legLabels maps the labels of a call's legs, other than its spy
+// subscriptions, to their tags. A label several legs share maps to the
+// earliest of them.
+func legLabels(details rtpengine.CallDetails, subs []spy.Subscription) map[string]string {
+	spyTags := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		spyTags[sub.SubTag] = true
+	}
+
+	labels := map[string]string{}
+	created := map[string]time.Time{}
+	for name, tag := range details.Tags {
+		if tag.Label == "" || spyTags[name] {
+			continue
+		}
+		if prev, ok := labels[tag.Label]; ok && cmp.Or(created[tag.Label].Compare(tag.Created), cmp.Compare(prev, name)) < 0 {
+			continue
+		}
+		labels[tag.Label] = name
+		created[tag.Label] = tag.Created
+	}
+	return labels
+}
+
+// buildLegs lists the tags of a call other than its spy subscriptions.
+func buildLegs(details rtpengine.CallDetails, from, to string, subs []spy.Subscription) []Leg {
+	spyTags := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		spyTags[sub.SubTag] = true
+	}
+
+	legs := []Leg{}
+	for name, tag := range details.Tags {
+		if spyTags[name] {
+			continue
+		}
+		leg := Leg{Tag: name, Label: tag.Label, Media: []LegMedium{}}
+		switch name {
+		case from:
+			leg.Leg = "from"
+		case to:
+			leg.Leg = "to"
+		}
+
+		audio := false
+		for _, m := range tag.Medias {
+			medium := LegMedium{
+				Index:       m.Index,
+				Type:        m.Type,
+				Protocol:    m.Protocol,
+				Codec:       m.Codec,
+				SRTP:        m.SRTP(),
+				CryptoSuite: m.CryptoSuite(),
+			}
+			if supported, known := m.TelephoneEvent(); known {
+				medium.TelephoneEvent = &supported
+			}
+			if m.Type == "audio" && !audio {
+				audio = true
+				leg.SRTP, leg.CryptoSuite, leg.TelephoneEvent = medium.SRTP, medium.CryptoSuite, medium.TelephoneEvent
+			}
+			leg.Media = append(leg.Media, medium)
+		}
+		legs = append(legs, leg)
+	}
+
+	// Sorted so the list is stable across polls.
+	sort.Slice(legs, func(i, j int) bool { return legs[i].Tag < legs[j].Tag })
+	return legs
+}
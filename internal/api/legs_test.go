@@ -0,0 +1,68 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+func TestBuildLegs(t *testing.T) {
+	leg := func(protocol string, stream, media map[string]interface{}) map[string]interface{} {
+		m := map[string]interface{}{
+			"index":    int64(1),
+			"type":     "audio",
+			"protocol": protocol,
+			"codec":    "PCMA/8000",
+			"streams":  []interface{}{stream},
+		}
+		for k, v := range media {
+			m[k] = v
+		}
+		return map[string]interface{}{"medias": []interface{}{m}}
+	}
+	details := rtpengine.DecodeCallDetails(map[string]interface{}{"tags": map[string]interface{}{
+		"a": leg("RTP/SAVP", map[string]interface{}{"crypto suite": "AES_CM_128_HMAC_SHA1_80"},
+			map[string]interface{}{"codecs": []interface{}{"PCMA/8000", "telephone-event/8000"}}),
+		"b":     leg("RTP/AVP", map[string]interface{}{}, nil),
+		"spy-1": leg("UDP/TLS/RTP/SAVPF", map[string]interface{}{}, nil),
+	}})
+	subs := []spy.Subscription{{Leg: "from", Tag: "a", SubTag: "spy-1"}}
+
+	legs := buildLegs(details, "a", "b", subs)
+	if len(legs) != 2 {
+		t.Fatalf("got %d legs, want 2: %+v", len(legs), legs)
+	}
+
+	a, b := legs[0], legs[1]
+	if a.Tag != "a" || a.Leg != "from" || !a.SRTP || a.CryptoSuite != "AES_CM_128_HMAC_SHA1_80" {
+		t.Errorf("leg a = %+v", a)
+	}
+	if a.TelephoneEvent == nil || !*a.TelephoneEvent {
+		t.Errorf("leg a telephone_event = %v, want true", a.TelephoneEvent)
+	}
+	if b.Tag != "b" || b.Leg != "to" || b.SRTP || b.CryptoSuite != "" || b.TelephoneEvent != nil {
+		t.Errorf("leg b = %+v, want plain RTP with unknown DTMF support", b)
+	}
+	if len(b.Media) != 1 || b.Media[0].Codec != "PCMA/8000" || b.Media[0].Protocol != "RTP/AVP" {
+		t.Errorf("leg b media = %+v", b.Media)
+	}
+}
+
+func TestLegLabels(t *testing.T) {
+	details := rtpengine.DecodeCallDetails(map[string]interface{}{"tags": map[string]interface{}{
+		"a":     map[string]interface{}{"label": "customer", "created": int64(1000)},
+		"b":     map[string]interface{}{"label": "agent", "created": int64(1010)},
+		"c":     map[string]interface{}{"label": "agent", "created": int64(1005)},
+		"d":     map[string]interface{}{"created": int64(1020)},
+		"spy-1": map[string]interface{}{"label": "rtpengine-mon", "created": int64(1030)},
+	}})
+	subs := []spy.Subscription{{Leg: "from", Tag: "a", SubTag: "spy-1"}}
+
+	got := legLabels(details, subs)
+	want := map[string]string{"customer": "a", "agent": "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("legLabels() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/maintenance"
+)
+
+// WithMaintenance manages the maintenance windows of schedule through the
+// API and suppresses the recordings of watches and automation scripts
+// during them.
+func WithMaintenance(schedule *maintenance.Schedule) HandlerOption {
+	return func(h *Handler) { h.maintenance = schedule }
+}
+
+// recordingSuppressed returns the window suppressing the automatic
+// recording of callID, if any.
+func (h *Handler) recordingSuppressed(callID string, now time.Time) (maintenance.Window, bool) {
+	instance, _ := h.callOwner(callID)
+	return h.maintenance.Suppressed(maintenance.Subject{Kind: maintenance.KindRecording, Instance: instance, CallID: callID}, now)
+}
+
+// alertSuppressed reports whether a window suppresses the alerts of kind
+// about callID.
+func (h *Handler) alertSuppressed(kind, callID string, now time.Time) bool {
+	instance, _ := h.callOwner(callID)
+	_, ok := h.maintenance.Suppressed(maintenance.Subject{Kind: kind, Instance: instance, CallID: callID}, now)
+	return ok
+}
+
+// handleMaintenance lists the maintenance windows that have not ended on
+// GET, schedules one on POST and ends or cancels one on DELETE
+// /admin/maintenance/{id}.
+func (h *Handler) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "http.Maintenance", trace.WithAttributes(attribute.String("method", r.Method)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if h.maintenance == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "maintenance windows are disabled"), http.StatusNotFound)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/maintenance"), "/")
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		h.respondJSON(w, h.maintenance.Windows(time.Now()))
+	case r.Method == http.MethodPost && id == "":
+		var window maintenance.Window
+		if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if window.Start.IsZero() {
+			window.Start = time.Now()
+		}
+		if err := window.Validate(); err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if !window.End.After(time.Now()) {
+			h.respondError(w, fmt.Errorf("end is in the past"), http.StatusBadRequest)
+			return
+		}
+		window.ID = uuid.NewString()
+		h.maintenance.Add(window)
+		h.audit(ctx, "maintenance.create", "", fmt.Sprintf("%s %s-%s %s", window.ID, window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339), window.Reason))
+		h.respondJSON(w, window)
+	case r.Method == http.MethodDelete && id != "":
+		if !h.maintenance.Remove(id) {
+			h.respondError(w, fmt.Errorf("maintenance window not found"), http.StatusNotFound)
+			return
+		}
+		h.audit(ctx, "maintenance.delete", "", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
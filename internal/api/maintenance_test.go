@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/maintenance"
+)
+
+func TestMaintenance(t *testing.T) {
+	client := &watchClient{}
+	schedule := maintenance.NewSchedule()
+	h := NewHandler(client, nil, nil, WithMaintenance(schedule))
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(`{"end":"`+end+`","kinds":["recording"],"call_ids":["test-*"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST status = %d, body %s", rec.Code, rec.Body)
+	}
+	var window maintenance.Window
+	json.NewDecoder(rec.Body).Decode(&window)
+	if window.ID == "" || window.Start.IsZero() {
+		t.Errorf("window = %+v, want an ID and a start", window)
+	}
+
+	now := time.Now()
+	h.watchMatched(t.Context(), Watch{ID: "w1", Record: true}, "test-1", now)
+	h.watchMatched(t.Context(), Watch{ID: "w1", Record: true}, "real-1", now)
+	if len(client.recorded) != 1 || client.recorded[0] != "real-1" {
+		t.Errorf("recorded = %v, want only real-1", client.recorded)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/maintenance", nil))
+	var windows []maintenance.Window
+	json.NewDecoder(rec.Body).Decode(&windows)
+	if len(windows) != 1 || windows[0].ID != window.ID {
+		t.Errorf("GET = %+v", windows)
+	}
+
+	for _, body := range []string{`{}`, `{"end":"2000-01-01T00:00:00Z"}`, `{"end":"` + end + `","kinds":["["]}`} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s: status = %d", body, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/maintenance/"+window.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/maintenance/"+window.ID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second DELETE status = %d", rec.Code)
+	}
+}
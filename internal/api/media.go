@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/notice"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// MediaRequest blocks or silences the media one leg of a call sends, or
+// every leg when Leg is empty or "all". It also plays an announcement File
+// to one leg, or stops it.
+type MediaRequest struct {
+	Action      string `json:"action"`
+	Leg         string `json:"leg"`
+	File        string `json:"file,omitempty"`
+	RepeatTimes int    `json:"repeat_times,omitempty"`
+}
+
+// MediaResponse confirms a media action applied to a call.
+type MediaResponse struct {
+	CallID string `json:"call_id"`
+	Action string `json:"action"`
+	Leg    string `json:"leg"`
+}
+
+// WithAgentNotices tells the agent on a call when an announcement, such as
+// the recording consent one, starts and stops playing into their leg.
+func WithAgentNotices(n *notice.Notifier) HandlerOption {
+	return func(h *Handler) { h.notices = n }
+}
+
+// playDuration is how long rtpengine reports a started playback to last,
+// zero when it does not tell.
+func playDuration(resp map[string]interface{}) time.Duration {
+	return time.Duration(toFloat(resp["duration"])) * time.Millisecond
+}
+
+// noticePlayback tells the agent on leg that source started playing, and
+// when it stops if rtpengine reported its duration.
+func (h *Handler) noticePlayback(callID, leg, source string, resp map[string]interface{}) {
+	h.notices.Started(callID, leg, source)
+	if d := playDuration(resp); d > 0 {
+		h.notices.StoppedAfter(d, callID, leg, source)
+	}
+}
+
+// WithMediaDir allows announcements to be played into calls. Requests name
+// files within dir, a directory on the rtpengine host.
+func WithMediaDir(dir string) HandlerOption {
+	return func(h *Handler) { h.mediaDir = dir }
+}
+
+func (h *Handler) mediaAction(req MediaRequest) (func(ctx context.Context, callID, fromTag string) (map[string]interface{}, error), bool) {
+	switch req.Action {
+	case "play":
+		// Rooting the name keeps it from escaping the directory.
+		file := filepath.Join(h.mediaDir, filepath.Clean("/"+req.File))
+		return func(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+			return h.rtpClient.PlayMedia(ctx, callID, fromTag, rtpengine.PlayMediaOptions{File: file, RepeatTimes: req.RepeatTimes})
+		}, true
+	case "stop":
+		return h.rtpClient.StopMedia, true
+	case "block":
+		return h.rtpClient.BlockMedia, true
+	case "unblock":
+		return h.rtpClient.UnblockMedia, true
+	case "silence":
+		return h.rtpClient.SilenceMedia, true
+	case "unsilence":
+		return h.rtpClient.UnsilenceMedia, true
+	}
+	return nil, false
+}
+
+// handleMedia lets supervisors mute a leg of a call, e.g. during compliance
+// review, or play an announcement to it. Blocking drops the leg's media;
+// silencing keeps the stream flowing with silent audio.
+func (h *Handler) handleMedia(w http.ResponseWriter, r *http.Request, callID string) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MediaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+	fn, ok := h.mediaAction(req)
+	if !ok {
+		h.respondError(w, fmt.Errorf("unknown media action %q", req.Action), http.StatusBadRequest)
+		return
+	}
+	if req.Leg == "" {
+		req.Leg = "all"
+	}
+	if req.Action == "play" || req.Action == "stop" {
+		if h.mediaDir == "" {
+			h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "announcements are disabled"), http.StatusNotFound)
+			return
+		}
+		if req.Leg == "all" {
+			h.respondError(w, fmt.Errorf("%s needs a leg", req.Action), http.StatusBadRequest)
+			return
+		}
+		if req.Action == "play" && req.File == "" {
+			h.respondError(w, fmt.Errorf("file is required"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.Media", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID)), attribute.String("action", req.Action), attribute.String("leg", req.Leg)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	var fromTag string
+	if req.Leg != "all" {
+		tag, status, err := h.legTag(ctx, callID, req.Leg)
+		if err != nil {
+			h.respondError(w, err, status)
+			return
+		}
+		fromTag = tag
+	}
+
+	resp, err := fn(ctx, callID, fromTag)
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+	switch req.Action {
+	case "play":
+		h.noticePlayback(callID, req.Leg, notice.SourceAnnouncement, resp)
+	case "stop":
+		h.notices.Stopped(callID, req.Leg, notice.SourceAnnouncement)
+	}
+	detail := req.Leg
+	if req.Action == "play" {
+		detail += " " + req.File
+	}
+	h.audit(ctx, "call.media."+req.Action, callID, detail)
+	h.respondJSON(w, MediaResponse{CallID: callID, Action: req.Action, Leg: req.Leg})
+}
+
+// legTag resolves the "from" or "to" leg of a call to its tag. On failure it
+// also returns the HTTP status to answer with.
+func (h *Handler) legTag(ctx context.Context, callID, leg string) (string, int, error) {
+	if leg != "from" && leg != "to" {
+		return "", http.StatusBadRequest, fmt.Errorf("unknown leg %q", leg)
+	}
+	if h.spyService == nil {
+		return "", http.StatusBadRequest, fmt.Errorf("leg %q cannot be resolved", leg)
+	}
+	from, to, err := h.spyService.CallTags(ctx, callID)
+	if err != nil {
+		return "", http.StatusNotFound, err
+	}
+	if leg == "to" {
+		return to, 0, nil
+	}
+	return from, 0, nil
+}
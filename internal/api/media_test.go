@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+type mediaClient struct {
+	rtpengine.Client
+	commands []string
+}
+
+func (c *mediaClient) BlockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	c.commands = append(c.commands, "block "+callID+" "+fromTag)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func (c *mediaClient) SilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	c.commands = append(c.commands, "silence "+callID+" "+fromTag)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func (c *mediaClient) PlayMedia(ctx context.Context, callID, fromTag string, opts rtpengine.PlayMediaOptions) (map[string]interface{}, error) {
+	c.commands = append(c.commands, "play "+callID+" "+fromTag+" "+opts.File)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func TestHandleMedia(t *testing.T) {
+	client := &mediaClient{}
+	mux := http.NewServeMux()
+	NewHandler(client, nil, nil).RegisterRoutes(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"block all legs", http.MethodPost, `{"action":"block"}`, http.StatusOK},
+		{"silence all legs", http.MethodPost, `{"action":"silence","leg":"all"}`, http.StatusOK},
+		{"unknown action", http.MethodPost, `{"action":"mute"}`, http.StatusBadRequest},
+		{"unknown leg", http.MethodPost, `{"action":"block","leg":"middle"}`, http.StatusBadRequest},
+		{"leg without spy service", http.MethodPost, `{"action":"block","leg":"from"}`, http.StatusBadRequest},
+		{"wrong method", http.MethodGet, ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, "/calls/c1/media", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d, body %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	if len(client.commands) != 2 || client.commands[0] != "block c1 " || client.commands[1] != "silence c1 " {
+		t.Errorf("commands = %v", client.commands)
+	}
+}
+
+func TestPlayMediaFile(t *testing.T) {
+	client := &mediaClient{}
+	h := NewHandler(client, nil, nil, WithMediaDir("/var/lib/announcements"))
+
+	for file, want := range map[string]string{
+		"recorded.wav":          "/var/lib/announcements/recorded.wav",
+		"../../etc/passwd":      "/var/lib/announcements/etc/passwd",
+		"/en/recorded.wav":      "/var/lib/announcements/en/recorded.wav",
+		"en/../../recorded.wav": "/var/lib/announcements/recorded.wav",
+	} {
+		client.commands = nil
+		fn, ok := h.mediaAction(MediaRequest{Action: "play", File: file})
+		if !ok {
+			t.Fatal("play is not a media action")
+		}
+		fn(context.Background(), "c1", "a")
+		if got := client.commands[0]; got != "play c1 a "+want {
+			t.Errorf("%s played as %q, want %q", file, got, want)
+		}
+	}
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calls/c1/media", strings.NewReader(`{"action":"play","file":"recorded.wav"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("play to all legs: status = %d", rec.Code)
+	}
+
+	mux = http.NewServeMux()
+	NewHandler(client, nil, nil).RegisterRoutes(mux)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calls/c1/media", strings.NewReader(`{"action":"play","leg":"to","file":"recorded.wav"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("play without a media dir: status = %d", rec.Code)
+	}
+}
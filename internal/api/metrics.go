@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/slo"
+)
+
+// WithSLO records every API request against the tracker's objectives and
+// reports their burn rates at /slo.
+func WithSLO(t *slo.Tracker) HandlerOption {
+	return func(h *Handler) { h.slo = t }
+}
+
+// handle registers an authenticated, rate limited, instrumented route.
+func (h *Handler) handle(mux *http.ServeMux, route string, fn http.HandlerFunc) {
+	mux.HandleFunc(route, h.instrument(route, h.authenticate(h.limit(h.guardReadOnly(route, fn)))))
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+type serverSpanKey struct{}
+
+// serverSpanTracer remembers the first span a handler starts, its server
+// span, in the holder instrument puts in the request context.
+type serverSpanTracer struct {
+	trace.Tracer
+}
+
+func (t serverSpanTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := t.Tracer.Start(ctx, name, opts...)
+	if sc, ok := ctx.Value(serverSpanKey{}).(*trace.SpanContext); ok && !sc.IsValid() {
+		*sc = span.SpanContext()
+	}
+	return ctx, span
+}
+
+// instrument records request latency per route and status code. The
+// measurement carries the handler's span so sampled requests are exported as
+// exemplars linking the latency to their trace.
+func (h *Handler) instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		var span trace.SpanContext
+		next(rec, r.WithContext(context.WithValue(r.Context(), serverSpanKey{}, &span)))
+		elapsed := time.Since(start)
+
+		ctx := trace.ContextWithSpanContext(r.Context(), span)
+		h.requestDuration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(
+			attribute.String("http.route", route),
+			attribute.String("http.request.method", r.Method),
+			attribute.Int("http.response.status_code", rec.status),
+		))
+		if h.slo != nil {
+			h.slo.Record(route, rec.status, elapsed, start.Add(elapsed))
+		}
+	}
+}
+
+func (h *Handler) handleSLO(w http.ResponseWriter, r *http.Request) {
+	_, span := h.tracer.Start(r.Context(), "http.SLO", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if h.slo == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "SLO tracking is disabled"), http.StatusNotFound)
+		return
+	}
+	h.respondJSON(w, h.slo.Status(time.Now()))
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+// maxPreferencesSize bounds the settings a user may store.
+const maxPreferencesSize = 16 << 10
+
+// handlePreferences returns the UI settings of the requester on GET and
+// replaces them on PUT. Users are told apart by their API key, or by address
+// when API keys are not configured, so settings follow a supervisor across
+// machines.
+func (h *Handler) handlePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "http.Preferences", trace.WithAttributes(attribute.String("method", r.Method)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if h.store == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "persistence is disabled"), http.StatusNotFound)
+		return
+	}
+
+	user := principal(r)
+	switch r.Method {
+	case http.MethodGet:
+		prefs, err := h.store.GetPreferences(ctx, user)
+		if errors.Is(err, store.ErrNotFound) {
+			prefs = &store.Preferences{Settings: json.RawMessage("{}")}
+		} else if err != nil {
+			h.respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.respondJSON(w, prefs)
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPreferencesSize+1))
+		if err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxPreferencesSize {
+			h.respondError(w, fmt.Errorf("preferences exceed %d bytes", maxPreferencesSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		var settings map[string]json.RawMessage
+		if err := json.Unmarshal(body, &settings); err != nil || settings == nil {
+			h.respondError(w, fmt.Errorf("preferences must be a JSON object"), http.StatusBadRequest)
+			return
+		}
+		prefs := store.Preferences{User: user, Settings: body, UpdatedAt: time.Now()}
+		if err := h.store.SavePreferences(ctx, prefs); err != nil {
+			h.respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.respondJSON(w, prefs)
+	default:
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+func TestPreferences(t *testing.T) {
+	ctx := context.Background()
+	st, err := store.Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	mux := http.NewServeMux()
+	keys := map[string]spy.Priority{"alice": spy.PriorityNormal, "bob": spy.PriorityNormal}
+	NewHandler(nil, nil, st, WithAPIKeys(keys)).RegisterRoutes(mux)
+
+	do := func(method, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/preferences", strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "alice", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"settings":{}`) {
+		t.Errorf("GET before save = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPut, "alice", `{"denoise":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "alice", ""); !strings.Contains(rec.Body.String(), `"settings":{"denoise":true}`) {
+		t.Errorf("GET after save = %s", rec.Body)
+	}
+	if rec := do(http.MethodGet, "bob", ""); !strings.Contains(rec.Body.String(), `"settings":{}`) {
+		t.Errorf("another user sees %s", rec.Body)
+	}
+
+	for _, body := range []string{`[1]`, `null`, `{`} {
+		if rec := do(http.MethodPut, "alice", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if rec := do(http.MethodPut, "alice", `{"x":"`+strings.Repeat("a", maxPreferencesSize)+`"}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized PUT = %d", rec.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// maxQueryCalls bounds the calls of one POST /calls/query.
+const maxQueryCalls = 1000
+
+// CallQueryRequest lists the calls to query at once.
+type CallQueryRequest struct {
+	CallIDs     []string `json:"call_ids"`
+	Concurrency int      `json:"concurrency"`
+	// Details adds the full query response of every call.
+	Details bool `json:"details"`
+}
+
+// CallQueryResult summarizes one call of a CallQueryRequest.
+type CallQueryResult struct {
+	CallID     string            `json:"call_id"`
+	Instance   string            `json:"instance,omitempty"`
+	Created    *time.Time        `json:"created,omitempty"`
+	LastSignal *time.Time        `json:"last_signal,omitempty"`
+	Parties    int               `json:"parties"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Codecs     []string          `json:"codecs,omitempty"`
+	// Packets is the RTP and RTCP received from every party.
+	Packets uint64                 `json:"packets"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+type CallQueryResponse struct {
+	Queried int               `json:"queried"`
+	Failed  int               `json:"failed"`
+	Results []CallQueryResult `json:"results"`
+}
+
+// handleQueryCalls queries many calls concurrently and summarizes them, so
+// a table of calls takes one request rather than one per call.
+func (h *Handler) handleQueryCalls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CallQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+	if len(req.CallIDs) == 0 {
+		h.respondError(w, fmt.Errorf("call_ids is required"), http.StatusBadRequest)
+		return
+	}
+	if len(req.CallIDs) > maxQueryCalls {
+		h.respondError(w, fmt.Errorf("at most %d calls can be queried at once", maxQueryCalls), http.StatusBadRequest)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.QueryCalls", trace.WithAttributes(attribute.Int("calls", len(req.CallIDs))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	if concurrency > maxBulkConcurrency {
+		concurrency = maxBulkConcurrency
+	}
+
+	resp := CallQueryResponse{Results: make([]CallQueryResult, 0, len(req.CallIDs))}
+	for _, res := range rtpengine.QueryCalls(ctx, h.rtpClient, req.CallIDs, concurrency) {
+		resp.Queried++
+		if res.Err != nil {
+			resp.Failed++
+			resp.Results = append(resp.Results, CallQueryResult{CallID: res.CallID, Error: res.Err.Error()})
+			continue
+		}
+		result := h.summarizeQuery(res.CallID, res.Response)
+		if req.Details {
+			result.Details = res.Response
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	h.respondJSON(w, resp)
+}
+
+func (h *Handler) summarizeQuery(callID string, details map[string]interface{}) CallQueryResult {
+	decoded := rtpengine.DecodeCallDetails(details)
+	result := CallQueryResult{CallID: callID, Parties: len(decoded.Tags)}
+	result.Instance, _ = h.callOwner(callID)
+	if !decoded.Created.IsZero() {
+		result.Created = &decoded.Created
+	}
+	if !decoded.LastSignal.IsZero() {
+		result.LastSignal = &decoded.LastSignal
+	}
+	var subs []spy.Subscription
+	if h.spyService != nil {
+		subs = h.spyService.Subscriptions(callID)
+	}
+	if labels := legLabels(decoded, subs); len(labels) > 0 {
+		result.Labels = labels
+	}
+	for _, tag := range decoded.Tags {
+		for _, m := range tag.Medias {
+			if m.Codec != "" && !slices.Contains(result.Codecs, m.Codec) {
+				result.Codecs = append(result.Codecs, m.Codec)
+			}
+			for _, s := range m.Streams {
+				result.Packets += s.Packets
+			}
+		}
+	}
+	slices.Sort(result.Codecs)
+	return result
+}
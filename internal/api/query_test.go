@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+type callsClient struct {
+	rtpengine.Client
+	calls map[string]map[string]interface{}
+}
+
+func (c *callsClient) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	if details, ok := c.calls[callID]; ok {
+		return details, nil
+	}
+	return nil, errors.New("Unknown call-id")
+}
+
+func TestQueryCalls(t *testing.T) {
+	client := &callsClient{calls: map[string]map[string]interface{}{
+		"c1": {
+			"created": int64(1760000000),
+			"tags": map[string]interface{}{
+				"caller": map[string]interface{}{"label": "customer", "medias": []interface{}{
+					map[string]interface{}{"index": int64(1), "type": "audio", "codec": "PCMA", "streams": []interface{}{
+						map[string]interface{}{"stats": map[string]interface{}{"packets": int64(100)}},
+					}},
+				}},
+				"callee": map[string]interface{}{"label": "agent"},
+			},
+		},
+	}}
+	h := NewHandler(client, nil, nil)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calls/query", strings.NewReader(`{"call_ids":["c1","gone"]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp CallQueryResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Queried != 2 || resp.Failed != 1 || len(resp.Results) != 2 {
+		t.Fatalf("response = %+v", resp)
+	}
+	c1 := resp.Results[0]
+	if c1.CallID != "c1" || c1.Parties != 2 || c1.Created == nil || c1.Labels["agent"] != "callee" ||
+		len(c1.Codecs) != 1 || c1.Codecs[0] != "PCMA" || c1.Packets != 100 || c1.Details != nil {
+		t.Errorf("c1 = %+v", c1)
+	}
+	if gone := resp.Results[1]; gone.CallID != "gone" || gone.Error == "" {
+		t.Errorf("gone = %+v", gone)
+	}
+
+	ids := make([]string, maxQueryCalls+1)
+	for i := range ids {
+		ids[i] = fmt.Sprint("c", i)
+	}
+	body, _ := json.Marshal(CallQueryRequest{CallIDs: ids})
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calls/query", strings.NewReader(string(body))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("too many calls: status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/quota"
+)
+
+// WithQuotas counts every API request and spy minute against the tracker,
+// refusing requests over quota with 429, and reports usage at /admin/usage.
+// Keys issued to a tenant also count against the tenant's quota.
+func WithQuotas(t *quota.Tracker) HandlerOption {
+	return func(h *Handler) { h.quotas = t }
+}
+
+// accounts returns the principal and, for keys issued to a tenant, the
+// tenant name a request is counted against.
+func (h *Handler) accounts(r *http.Request) (string, string) {
+	var tenant string
+	if h.tenants != nil {
+		if t := h.tenants.ForAPIKey(apiKey(r)); t != nil {
+			tenant = t.Name
+		}
+	}
+	return principal(r), tenant
+}
+
+func (h *Handler) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.quotas == nil {
+			next(w, r)
+			return
+		}
+		if err := h.quotas.Request(h.accounts(r)); err != nil {
+			h.respondQuotaError(w, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// respondQuotaError answers 429 with Retry-After for exceeded quotas.
+func (h *Handler) respondQuotaError(w http.ResponseWriter, err error) {
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(exceeded.RetryAfter.Seconds()))))
+		h.respondError(w, err, http.StatusTooManyRequests)
+		return
+	}
+	h.respondError(w, err, http.StatusInternalServerError)
+}
+
+func (h *Handler) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if h.quotas == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "usage tracking is disabled"), http.StatusNotFound)
+		return
+	}
+	h.respondJSON(w, h.quotas.Report())
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"sort"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// Reasons a call is ranked up, with their weights. Only subscribed calls,
+// spied or shadow, carry audio and quality signals.
+const (
+	rankEcho        = "echo"
+	rankPoorQuality = "poor_quality"
+	rankWatched     = "watched"
+	rankDeadAir     = "dead_air"
+	rankFairQuality = "fair_quality"
+	rankOnHold      = "on_hold"
+)
+
+var rankWeights = map[string]int{
+	rankEcho:        40,
+	rankPoorQuality: 30,
+	rankWatched:     25,
+	rankDeadAir:     20,
+	rankFairQuality: 10,
+	rankOnHold:      5,
+}
+
+// RankedCall is a call of the supervisor wall with the score it is ranked
+// by and the reasons adding up to it.
+type RankedCall struct {
+	CallID  string           `json:"call_id"`
+	Score   int              `json:"score"`
+	Reasons []string         `json:"reasons,omitempty"`
+	Audio   *spy.CallAudio   `json:"audio,omitempty"`
+	Quality *spy.CallQuality `json:"quality,omitempty"`
+	Watches []string         `json:"watches,omitempty"`
+}
+
+// matching returns the IDs of the watches whose pattern matches callID.
+func (l *watchList) matching(callID string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ids []string
+	for id, w := range l.watches {
+		if ok, _ := path.Match(w.Pattern, callID); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// rankCalls scores every call by its alert state and the interest
+// registered in it, highest first.
+func rankCalls(list []string, classes map[string]spy.CallAudio, qualities map[string]spy.CallQuality, watches func(string) []string) []RankedCall {
+	ranked := make([]RankedCall, 0, len(list))
+	for _, callID := range list {
+		call := RankedCall{CallID: callID, Watches: watches(callID)}
+		if audio, ok := classes[callID]; ok {
+			call.Audio = &audio
+			if audio.Echo {
+				call.Reasons = append(call.Reasons, rankEcho)
+			}
+			if audio.From == spy.AudioSilence && audio.To == spy.AudioSilence {
+				call.Reasons = append(call.Reasons, rankDeadAir)
+			}
+			if audio.From == spy.AudioMusic || audio.To == spy.AudioMusic {
+				call.Reasons = append(call.Reasons, rankOnHold)
+			}
+		}
+		if quality, ok := qualities[callID]; ok {
+			call.Quality = &quality
+			switch mos := quality.MinMOS(); {
+			case mos == 0:
+			case mos < 3.1:
+				call.Reasons = append(call.Reasons, rankPoorQuality)
+			case mos < 4:
+				call.Reasons = append(call.Reasons, rankFairQuality)
+			}
+		}
+		if len(call.Watches) > 0 {
+			call.Reasons = append(call.Reasons, rankWatched)
+		}
+
+		for _, reason := range call.Reasons {
+			call.Score += rankWeights[reason]
+		}
+		sort.Slice(call.Reasons, func(i, j int) bool { return rankWeights[call.Reasons[i]] > rankWeights[call.Reasons[j]] })
+		ranked = append(ranked, call)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].CallID < ranked[j].CallID
+	})
+	return ranked
+}
+
+// handleRankedCalls lists the calls most in need of a supervisor first.
+func (h *Handler) handleRankedCalls(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "http.RankedCalls", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	list, err := h.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var classes map[string]spy.CallAudio
+	var qualities map[string]spy.CallQuality
+	if h.spyService != nil {
+		classes = h.spyService.AudioClasses()
+		qualities = h.spyService.Qualities()
+	}
+	h.respondJSON(w, rankCalls(list, classes, qualities, h.watches.matching))
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+func TestRankCalls(t *testing.T) {
+	classes := map[string]spy.CallAudio{
+		"echo":   {From: spy.AudioSpeech, To: spy.AudioSpeech, Echo: true},
+		"quiet":  {From: spy.AudioSilence, To: spy.AudioSilence},
+		"normal": {From: spy.AudioSpeech, To: spy.AudioSilence},
+	}
+	qualities := map[string]spy.CallQuality{
+		"quiet": {From: &spy.LegScore{MOS: 4.3}, To: &spy.LegScore{MOS: 2.8}},
+	}
+	var l watchList
+	l.add(Watch{ID: "w1", Pattern: "vip*"})
+
+	ranked := rankCalls([]string{"normal", "quiet", "vip", "echo", "unknown"}, classes, qualities, l.matching)
+
+	var order []string
+	for _, call := range ranked {
+		order = append(order, call.CallID)
+	}
+	if want := []string{"quiet", "echo", "vip", "normal", "unknown"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if q := ranked[0]; q.Score != 50 || !reflect.DeepEqual(q.Reasons, []string{rankPoorQuality, rankDeadAir}) {
+		t.Errorf("quiet call = %+v", q)
+	}
+	if v := ranked[2]; v.Score != 25 || !reflect.DeepEqual(v.Watches, []string{"w1"}) {
+		t.Errorf("watched call = %+v", v)
+	}
+	if n := ranked[3]; n.Score != 0 || n.Reasons != nil {
+		t.Errorf("normal call = %+v", n)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+)
+
+// readOnlyRoutes take no part in read-only mode, whatever the method: a
+// GET on /spy/ starts listening as well.
+var readOnlyRoutes = map[string]bool{
+	"/spy/":        true,
+	"/spy/answer/": true,
+}
+
+// readOnlyWrites are the routes whose writes are allowed in read-only mode,
+// as they only touch the caller's own dashboard settings, analyse an upload,
+// post a query or schedule maintenance.
+var readOnlyWrites = map[string]bool{
+	"/calls/query":        true,
+	"/preferences":        true,
+	"/watches":            true,
+	"/watches/":           true,
+	"/admin/watermark":    true,
+	"/admin/maintenance":  true,
+	"/admin/maintenance/": true,
+}
+
+// WithReadOnly turns the API into a dashboard: requests that would spy on,
+// change or end calls, erase history or inject faults are refused with 403.
+// The rtpengine client should be read-only too, so nothing else can.
+func WithReadOnly() HandlerOption {
+	return func(h *Handler) { h.readOnly = true }
+}
+
+// guardReadOnly refuses in read-only mode every request to route but GET
+// and HEAD, unless the route's writes are allowed.
+func (h *Handler) guardReadOnly(route string, fn http.HandlerFunc) http.HandlerFunc {
+	if !h.readOnly || readOnlyWrites[route] {
+		return fn
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if readOnlyRoutes[route] || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			h.respondError(w, catalog.Errorf(catalog.ReadOnly, "the monitor is read-only"), http.StatusForbidden)
+			return
+		}
+		fn(w, r)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+)
+
+func TestReadOnly(t *testing.T) {
+	h := NewHandler(&watchClient{}, nil, nil, WithReadOnly())
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	// Watches only take requests while polling.
+	h.watches.running.Store(true)
+
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/catalog", "", http.StatusOK},
+		{http.MethodGet, "/spy/call-1", "", http.StatusForbidden},
+		{http.MethodPost, "/spy/answer/session-1", "{}", http.StatusForbidden},
+		{http.MethodPost, "/calls/bulk", `{"action":"delete","call_ids":["call-1"]}`, http.StatusForbidden},
+		{http.MethodPost, "/calls/call-1/recording", "", http.StatusForbidden},
+		{http.MethodDelete, "/history/calls/call-1", "", http.StatusForbidden},
+		{http.MethodPost, "/watches", `{"pattern":"vip-*"}`, http.StatusOK},
+		{http.MethodPost, "/watches", `{"pattern":"vip-*","record":true}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d (%s)", tt.method, tt.target, rec.Code, tt.want, rec.Body)
+			continue
+		}
+		if tt.want == http.StatusForbidden {
+			var body map[string]string
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body["code"] != string(catalog.ReadOnly) {
+				t.Errorf("%s %s: code = %q, want %q", tt.method, tt.target, body["code"], catalog.ReadOnly)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+// RecordingRequest optionally starts a recording with the consent
+// announcement played to the call's legs.
+type RecordingRequest struct {
+	Consent bool `json:"consent,omitempty"`
+}
+
+// RecordingResponse reports the rtpengine recording state of a call. With
+// persistence enabled it lists the recordings started from the monitor.
+type RecordingResponse struct {
+	CallID     string                  `json:"call_id"`
+	Recording  bool                    `json:"recording"`
+	Recordings []store.RecordingRecord `json:"recordings,omitempty"`
+}
+
+// handleRecording toggles rtpengine's native recording of a call: POST
+// starts it, with an optional RecordingRequest body, DELETE stops it and GET
+// reports it from the store.
+func (h *Handler) handleRecording(w http.ResponseWriter, r *http.Request, callID string) {
+	ctx, span := h.tracer.Start(r.Context(), "http.Recording", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID)), attribute.String("method", r.Method)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	switch r.Method {
+	case http.MethodGet:
+		if h.store == nil {
+			h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "persistence is disabled"), http.StatusNotFound)
+			return
+		}
+		recordings, err := h.store.ListRecordings(ctx, callID)
+		if err != nil {
+			h.respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.respondJSON(w, RecordingResponse{CallID: callID, Recording: len(openRecordings(recordings)) > 0, Recordings: recordings})
+	case http.MethodPost:
+		var req RecordingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if err := h.checkConsent(req.Consent); err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		path, err := h.recordingPath(callID)
+		if err != nil {
+			h.respondError(w, err, http.StatusForbidden)
+			return
+		}
+		if err := h.recordCall(ctx, callID, path, req.Consent); err != nil {
+			h.respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.audit(ctx, "call.recording.start", callID, "")
+		h.saveRecording(ctx, store.RecordingRecord{ID: uuid.NewString(), CallID: callID, Location: path, StartedAt: time.Now()})
+		h.respondJSON(w, RecordingResponse{CallID: callID, Recording: true})
+	case http.MethodDelete:
+		if _, err := h.rtpClient.StopRecording(ctx, callID); err != nil {
+			h.respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.audit(ctx, "call.recording.stop", callID, "")
+		h.stopRecordings(ctx, callID)
+		h.respondJSON(w, RecordingResponse{CallID: callID, Recording: false})
+	default:
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
+
+// recordCall starts rtpengine's recording of a call to path and announces
+// it when consent is asked for or required. A recording that could not be
+// announced is stopped again.
+func (h *Handler) recordCall(ctx context.Context, callID, path string, consent bool) error {
+	if _, err := h.rtpClient.StartRecording(ctx, callID, path); err != nil {
+		return err
+	}
+	if err := h.announceRecording(ctx, callID, consent); err != nil {
+		if _, stopErr := h.rtpClient.StopRecording(ctx, callID); stopErr != nil {
+			log.Printf("Error stopping the unannounced recording of %s: %v", redact.CallID(callID), stopErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// recordingPath is the tenant's recording path for a call, empty for
+// rtpengine's default. With tenants configured, calls matching no tenant
+// are not recorded.
+func (h *Handler) recordingPath(callID string) (string, error) {
+	if h.tenants == nil {
+		return "", nil
+	}
+	t, err := h.tenants.Resolve(callID)
+	if err != nil {
+		return "", err
+	}
+	return t.RecordingPath, nil
+}
+
+func (h *Handler) saveRecording(ctx context.Context, rec store.RecordingRecord) {
+	if h.store == nil {
+		return
+	}
+	if err := h.store.SaveRecording(ctx, rec); err != nil {
+		log.Printf("Error saving recording of %s: %v", redact.CallID(rec.CallID), err)
+	}
+}
+
+// stopRecordings marks the open recordings of a call as stopped.
+func (h *Handler) stopRecordings(ctx context.Context, callID string) {
+	if h.store == nil {
+		return
+	}
+	recordings, err := h.store.ListRecordings(ctx, callID)
+	if err != nil {
+		log.Printf("Error listing recordings of %s: %v", redact.CallID(callID), err)
+		return
+	}
+	now := time.Now()
+	for _, rec := range openRecordings(recordings) {
+		rec.StoppedAt = now
+		h.saveRecording(ctx, rec)
+	}
+}
+
+func openRecordings(recordings []store.RecordingRecord) []store.RecordingRecord {
+	var open []store.RecordingRecord
+	for _, rec := range recordings {
+		if rec.StoppedAt.IsZero() {
+			open = append(open, rec)
+		}
+	}
+	return open
+}
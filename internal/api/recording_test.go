@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+type recordingClient struct {
+	rtpengine.Client
+	commands []string
+}
+
+func (c *recordingClient) StartRecording(ctx context.Context, callID, path string) (map[string]interface{}, error) {
+	c.commands = append(c.commands, "start "+callID)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func (c *recordingClient) StopRecording(ctx context.Context, callID string) (map[string]interface{}, error) {
+	c.commands = append(c.commands, "stop "+callID)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func (c *recordingClient) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"tags": map[string]interface{}{"b": map[string]interface{}{}, "a": map[string]interface{}{}}}, nil
+}
+
+func (c *recordingClient) PlayMedia(ctx context.Context, callID, fromTag string, opts rtpengine.PlayMediaOptions) (map[string]interface{}, error) {
+	if fromTag == "b" && strings.Contains(opts.File, "missing") {
+		return nil, errors.New("file not found")
+	}
+	c.commands = append(c.commands, "play "+fromTag+" "+opts.File)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func TestRecordingConsent(t *testing.T) {
+	post := func(h *Handler, body string) int {
+		mux := http.NewServeMux()
+		h.RegisterRoutes(mux)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calls/c1/recording", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	client := &recordingClient{}
+	if code := post(NewHandler(client, nil, nil), `{"consent":true}`); code != http.StatusBadRequest || len(client.commands) != 0 {
+		t.Errorf("consent without an announcement: status = %d, commands %v", code, client.commands)
+	}
+
+	h := NewHandler(client, nil, nil, WithMediaDir("/media"), WithRecordingConsent("recorded.wav", false))
+	if code := post(h, `{"consent":true}`); code != http.StatusOK {
+		t.Errorf("consent: status = %d", code)
+	}
+	want := []string{"start c1", "play a /media/recorded.wav", "play b /media/recorded.wav"}
+	if !reflect.DeepEqual(client.commands, want) {
+		t.Errorf("commands = %v, want %v", client.commands, want)
+	}
+
+	// A recording that could not be announced is stopped.
+	client.commands = nil
+	h = NewHandler(client, nil, nil, WithMediaDir("/media"), WithRecordingConsent("missing.wav", true))
+	if code := post(h, ""); code != http.StatusInternalServerError {
+		t.Errorf("failed announcement: status = %d", code)
+	}
+	if want := []string{"start c1", "play a /media/missing.wav", "stop c1"}; !reflect.DeepEqual(client.commands, want) {
+		t.Errorf("commands = %v, want %v", client.commands, want)
+	}
+}
+
+func TestRecordingToggle(t *testing.T) {
+	ctx := context.Background()
+	st, err := store.Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	client := &recordingClient{}
+	mux := http.NewServeMux()
+	NewHandler(client, nil, st).RegisterRoutes(mux)
+
+	status := func(method string) RecordingResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, "/calls/c1/recording", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status = %d, body %s", method, rec.Code, rec.Body)
+		}
+		var resp RecordingResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if status(http.MethodPost); !status(http.MethodGet).Recording {
+		t.Error("expected the call to be recording after POST")
+	}
+	status(http.MethodDelete)
+	resp := status(http.MethodGet)
+	if resp.Recording || len(resp.Recordings) != 1 || resp.Recordings[0].StoppedAt.IsZero() {
+		t.Errorf("after DELETE: %+v", resp)
+	}
+	if len(client.commands) != 2 || client.commands[0] != "start c1" || client.commands[1] != "stop c1" {
+		t.Errorf("commands = %v", client.commands)
+	}
+}
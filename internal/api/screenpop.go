@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// ScreenPop is posted to the screen-pop webhook when a spy session starts,
+// so the listener's CRM can open the record of the customer on the call.
+type ScreenPop struct {
+	Type      string            `json:"type"`
+	SessionID string            `json:"session_id"`
+	CallID    string            `json:"call_id"`
+	Time      time.Time         `json:"time"`
+	Listener  ScreenPopListener `json:"listener"`
+	Call      ScreenPopCall     `json:"call"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// ScreenPopListener identifies who started listening. Name is what the
+// client sent as the listener of the spy request, e.g. the supervisor's
+// login; Principal is the hashed API key or the client address.
+type ScreenPopListener struct {
+	Name      string `json:"name,omitempty"`
+	Principal string `json:"principal"`
+	Tenant    string `json:"tenant,omitempty"`
+}
+
+// ScreenPopCall describes the call listened to, as far as rtpengine knows
+// it. Legs is empty when the call could not be queried.
+type ScreenPopCall struct {
+	Instance string     `json:"instance,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	Legs     []Leg      `json:"legs"`
+}
+
+// WithScreenPop posts a ScreenPop to url for every spy session started.
+func WithScreenPop(url string) HandlerOption {
+	return func(h *Handler) { h.screenPopURL = url }
+}
+
+// screenPop enriches the start of a spy session with what rtpengine knows
+// about the call and posts it to the screen-pop webhook.
+func (h *Handler) screenPop(ctx context.Context, callID string, resp SpyResponse, listener ScreenPopListener) {
+	pop := ScreenPop{
+		Type:      string(catalog.EventSpyStart),
+		SessionID: resp.SpyID,
+		CallID:    redact.CallID(callID),
+		Time:      time.Now(),
+		Listener:  listener,
+		Call:      ScreenPopCall{Legs: []Leg{}},
+		Labels:    h.labels,
+	}
+	pop.Call.Instance, _ = h.callOwner(callID)
+	if details, err := h.rtpClient.QueryCall(ctx, callID); err == nil {
+		call := rtpengine.DecodeCallDetails(details)
+		if !call.Created.IsZero() {
+			pop.Call.Created = &call.Created
+		}
+		var subs []spy.Subscription
+		if h.spyService != nil {
+			subs = h.spyService.Subscriptions(callID)
+		}
+		pop.Call.Legs = buildLegs(call, resp.FromTag, resp.ToTag, subs)
+		for i := range pop.Call.Legs {
+			pop.Call.Legs[i].Tag = redact.Tag(pop.Call.Legs[i].Tag)
+		}
+	} else {
+		log.Printf("Screen pop %s: failed to query call %s: %v", resp.SpyID, redact.CallID(callID), err)
+	}
+
+	if err := postWebhook(ctx, h.screenPopURL, pop); err != nil {
+		log.Printf("Screen pop %s: %v", resp.SpyID, err)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+type queryClient struct {
+	rtpengine.Client
+	details map[string]interface{}
+}
+
+func (c *queryClient) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return c.details, nil
+}
+
+func TestScreenPop(t *testing.T) {
+	posted := make(chan ScreenPop, 1)
+	crm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pop ScreenPop
+		json.NewDecoder(r.Body).Decode(&pop)
+		posted <- pop
+	}))
+	defer crm.Close()
+
+	client := &queryClient{details: map[string]interface{}{
+		"created": int64(1760000000),
+		"tags": map[string]interface{}{
+			"caller": map[string]interface{}{"label": "customer"},
+			"callee": map[string]interface{}{"label": "agent"},
+		},
+	}}
+	h := NewHandler(client, nil, nil, WithScreenPop(crm.URL))
+	h.screenPop(context.Background(), "call-1", SpyResponse{SpyID: "s1", FromTag: "caller", ToTag: "callee"},
+		ScreenPopListener{Name: "alice", Principal: "key:0123", Tenant: "acme"})
+
+	pop := <-posted
+	if pop.Type != "spy.start" || pop.SessionID != "s1" || pop.CallID != "call-1" {
+		t.Errorf("screen pop = %+v", pop)
+	}
+	if pop.Listener != (ScreenPopListener{Name: "alice", Principal: "key:0123", Tenant: "acme"}) {
+		t.Errorf("listener = %+v", pop.Listener)
+	}
+	if pop.Call.Created == nil || pop.Call.Created.Unix() != 1760000000 {
+		t.Errorf("created = %v", pop.Call.Created)
+	}
+	if len(pop.Call.Legs) != 2 || pop.Call.Legs[0].Leg != "to" || pop.Call.Legs[0].Label != "agent" ||
+		pop.Call.Legs[1].Leg != "from" || pop.Call.Legs[1].Label != "customer" {
+		t.Errorf("legs = %+v", pop.Call.Legs)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+// clientStatsHistory is how many stored uploads session details include.
+const clientStatsHistory = 60
+
+type SessionDetailsResponse struct {
+	*spy.SessionDetails
+	ClientHistory []store.ClientStatsRecord `json:"client_history,omitempty"`
+}
+
+func (h *Handler) handleClientStats(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.ClientStats", trace.WithAttributes(attribute.String("spy_id", sessionID)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	var stats spy.ClientStats
+	if err := json.NewDecoder(r.Body).Decode(&stats); err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.spyService.RecordClientStats(sessionID, stats)
+	if err != nil {
+		h.respondError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if h.store != nil {
+		if err := h.store.SaveClientStats(ctx, store.ClientStatsRecord{
+			SessionID:        sessionID,
+			CallID:           sess.CallID,
+			Time:             stats.Time,
+			PacketsReceived:  stats.PacketsReceived,
+			PacketsLost:      stats.PacketsLost,
+			BytesReceived:    stats.BytesReceived,
+			Jitter:           stats.Jitter,
+			RoundTripTime:    stats.RoundTripTime,
+			ConcealedSamples: stats.ConcealedSamples,
+		}); err != nil {
+			log.Printf("Error saving client stats: %v", err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleSessionDetails(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Path[len("/sessions/"):]
+	if sessionID == "" {
+		h.respondError(w, fmt.Errorf("session ID required"), http.StatusBadRequest)
+		return
+	}
+
+	ctx, span := h.tracer.Start(r.Context(), "http.SessionDetails", trace.WithAttributes(attribute.String("spy_id", sessionID)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	details, err := h.spyService.SessionDetails(sessionID)
+	if err != nil {
+		h.respondError(w, err, http.StatusNotFound)
+		return
+	}
+
+	resp := SessionDetailsResponse{SessionDetails: details}
+	if h.store != nil {
+		if resp.ClientHistory, err = h.store.ListClientStats(ctx, sessionID, clientStatsHistory); err != nil {
+			h.respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	h.respondJSON(w, resp)
+}
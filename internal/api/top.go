@@ -0,0 +1,52 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// defaultTopLimit is how many sources /admin/top lists without a limit.
+const defaultTopLimit = 10
+
+// TopResponse lists the sources using the most CPU time or memory.
+type TopResponse struct {
+	Sort    string            `json:"sort"`
+	Total   int               `json:"total"`
+	Sources []spy.SourceUsage `json:"sources"`
+}
+
+// handleTop lists the heaviest sources, so operators can find the call
+// eating the box. sort is "cpu" (the default) or "memory".
+func (h *Handler) handleTop(w http.ResponseWriter, r *http.Request) {
+	_, span := h.tracer.Start(r.Context(), "http.Top", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	query := r.URL.Query()
+	limit := defaultTopLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			h.respondError(w, fmt.Errorf("limit must be a positive integer"), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	order := cmp.Or(query.Get("sort"), "cpu")
+	if order != "cpu" && order != "memory" {
+		h.respondError(w, fmt.Errorf("sort must be cpu or memory"), http.StatusBadRequest)
+		return
+	}
+
+	usage := h.spyService.Usage()
+	if order == "memory" {
+		slices.SortStableFunc(usage, func(a, b spy.SourceUsage) int { return cmp.Compare(b.MemoryBytes, a.MemoryBytes) })
+	}
+	h.respondJSON(w, TopResponse{Sort: order, Total: len(usage), Sources: usage[:min(limit, len(usage))]})
+}
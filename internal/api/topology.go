@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// Topology is the media path of a call as a graph: remote endpoints send to
+// rtpengine relay ports bound on its interfaces, relays forward between the
+// legs in dialogue and feed the spy subscriptions.
+type Topology struct {
+	CallID string         `json:"call_id"`
+	Nodes  []TopologyNode `json:"nodes"`
+	Edges  []TopologyEdge `json:"edges"`
+}
+
+// TopologyNode is an endpoint, interface, relay or spy subscription. Relays
+// name the interface node they are bound to as parent.
+type TopologyNode struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Label   string `json:"label"`
+	Tag     string `json:"tag,omitempty"`
+	Media   string `json:"media,omitempty"`
+	Parent  string `json:"parent,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// TopologyEdge is a media flow between two nodes with the packets and bytes
+// seen on it so far.
+type TopologyEdge struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Kind    string `json:"kind"`
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+func (h *Handler) handleTopology(w http.ResponseWriter, r *http.Request, callID string) {
+	ctx, span := h.tracer.Start(r.Context(), "http.Topology", trace.WithAttributes(attribute.String("call_id", redact.CallID(callID))), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	details, err := h.rtpClient.QueryCall(ctx, callID)
+	if err != nil {
+		h.respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+	h.respondJSON(w, buildTopology(callID, details, h.spyService.Subscriptions(callID)))
+}
+
+// buildTopology derives the graph of a call from its rtpengine query result
+// and the spy subscriptions held for it.
+func buildTopology(callID string, details map[string]interface{}, subs []spy.Subscription) *Topology {
+	topo := &Topology{CallID: callID, Nodes: []TopologyNode{}, Edges: []TopologyEdge{}}
+	tags, _ := details["tags"].(map[string]interface{})
+
+	spyTags := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		spyTags[sub.SubTag] = true
+	}
+
+	// Sorted so the graph is stable across polls.
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		if !spyTags[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	interfaces := map[string]bool{}
+	relays := map[string][]string{}
+	dialogue := map[string]string{}
+	for _, name := range names {
+		tag, _ := tags[name].(map[string]interface{})
+		if peer, ok := tag["in dialogue with"].(string); ok && peer != "" {
+			dialogue[name] = peer
+		}
+
+		medias, _ := tag["medias"].([]interface{})
+		for i, m := range medias {
+			media, _ := m.(map[string]interface{})
+			index := i + 1
+			if v, ok := media["index"]; ok {
+				index = int(toFloat(v))
+			}
+			streams, _ := media["streams"].([]interface{})
+			if len(streams) == 0 {
+				continue
+			}
+			stream, _ := streams[0].(map[string]interface{})
+			mediaType, _ := media["type"].(string)
+
+			local := fmt.Sprintf("%v:%v", stringOr(stream["local address"], "rtpengine"), stringOr(stream["local port"], "?"))
+			intf := stringOr(media["interface"], stringOr(stream["local address"], "default"))
+			intfID := "interface:" + intf
+			if !interfaces[intfID] {
+				interfaces[intfID] = true
+				topo.Nodes = append(topo.Nodes, TopologyNode{ID: intfID, Kind: "interface", Label: intf})
+			}
+
+			relayID := fmt.Sprintf("relay:%s:%d", name, index)
+			topo.Nodes = append(topo.Nodes, TopologyNode{ID: relayID, Kind: "relay", Label: local, Tag: name, Media: mediaType, Parent: intfID, Address: local})
+			relays[name] = append(relays[name], relayID)
+
+			endpointID := fmt.Sprintf("endpoint:%s:%d", name, index)
+			remote := "unknown"
+			if ep, ok := stream["endpoint"].(map[string]interface{}); ok {
+				remote = fmt.Sprintf("%v:%v", stringOr(ep["address"], "?"), stringOr(ep["port"], "?"))
+			}
+			topo.Nodes = append(topo.Nodes, TopologyNode{ID: endpointID, Kind: "endpoint", Label: remote, Tag: name, Media: mediaType, Address: remote})
+
+			edge := TopologyEdge{From: endpointID, To: relayID, Kind: "media"}
+			if stats, ok := stream["stats"].(map[string]interface{}); ok {
+				edge.Packets = uint64(toFloat(stats["packets"]))
+				edge.Bytes = uint64(toFloat(stats["bytes"]))
+			}
+			topo.Edges = append(topo.Edges, edge)
+		}
+	}
+
+	// Without dialogue information a two party call is assumed.
+	if len(dialogue) == 0 && len(names) == 2 {
+		dialogue[names[0]] = names[1]
+	}
+	for _, name := range names {
+		peer, ok := dialogue[name]
+		if !ok || (dialogue[peer] == name && peer < name) {
+			continue
+		}
+		for i, from := range relays[name] {
+			if i < len(relays[peer]) {
+				topo.Edges = append(topo.Edges, TopologyEdge{From: from, To: relays[peer][i], Kind: "relay"})
+			}
+		}
+	}
+
+	for _, sub := range subs {
+		spyID := "spy:" + sub.SubTag
+		topo.Nodes = append(topo.Nodes, TopologyNode{
+			ID:    spyID,
+			Kind:  "spy",
+			Label: fmt.Sprintf("%s leg subscription (%s, %d sessions)", sub.Leg, sub.State, sub.Sessions),
+			Tag:   sub.SubTag,
+		})
+		for _, relayID := range relays[sub.Tag] {
+			topo.Edges = append(topo.Edges, TopologyEdge{From: relayID, To: spyID, Kind: "subscription", Packets: sub.Received.Packets, Bytes: sub.Received.Bytes})
+		}
+	}
+	return topo
+}
+
+func stringOr(v interface{}, fallback string) string {
+	switch s := v.(type) {
+	case string:
+		if s != "" {
+			return s
+		}
+	case int64, float64, int:
+		return fmt.Sprint(s)
+	}
+	return fallback
+}
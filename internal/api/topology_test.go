@@ -0,0 +1,63 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+func TestBuildTopology(t *testing.T) {
+	leg := func(peer string, port int64) map[string]interface{} {
+		return map[string]interface{}{
+			"in dialogue with": peer,
+			"medias": []interface{}{map[string]interface{}{
+				"index": int64(1),
+				"type":  "audio",
+				"streams": []interface{}{map[string]interface{}{
+					"local address": "10.0.0.1",
+					"local port":    port,
+					"endpoint":      map[string]interface{}{"address": "192.0.2.1", "port": int64(4000)},
+					"stats":         map[string]interface{}{"packets": int64(10), "bytes": int64(1600)},
+				}},
+			}},
+		}
+	}
+	details := map[string]interface{}{"tags": map[string]interface{}{
+		"a":     leg("b", 30000),
+		"b":     leg("a", 30002),
+		"spy-1": leg("a", 30004),
+	}}
+	subs := []spy.Subscription{{Leg: "from", Tag: "a", SubTag: "spy-1", State: "connected", Sessions: 1}}
+
+	topo := buildTopology("c1", details, subs)
+
+	kinds := map[string]int{}
+	for _, n := range topo.Nodes {
+		kinds[n.Kind]++
+	}
+	if kinds["interface"] != 1 || kinds["relay"] != 2 || kinds["endpoint"] != 2 || kinds["spy"] != 1 {
+		t.Errorf("unexpected nodes: %+v", topo.Nodes)
+	}
+
+	edges := map[string]TopologyEdge{}
+	for _, e := range topo.Edges {
+		edges[e.Kind+" "+e.From+">"+e.To] = e
+	}
+	want := []string{
+		"media endpoint:a:1>relay:a:1",
+		"media endpoint:b:1>relay:b:1",
+		"relay relay:a:1>relay:b:1",
+		"subscription relay:a:1>spy:spy-1",
+	}
+	if len(edges) != len(want) {
+		t.Errorf("got %d edges, want %d: %+v", len(edges), len(want), topo.Edges)
+	}
+	for _, key := range want {
+		if _, ok := edges[key]; !ok {
+			t.Errorf("missing edge %s", key)
+		}
+	}
+	if e := edges["media endpoint:a:1>relay:a:1"]; e.Packets != 10 || e.Bytes != 1600 {
+		t.Errorf("unexpected media edge counters: %+v", e)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BuildInfo describes the running binary and the subsystems its
+// configuration enables.
+type BuildInfo struct {
+	Version    string          `json:"version"`
+	Commit     string          `json:"commit,omitempty"`
+	BuildDate  string          `json:"build_date,omitempty"`
+	GoVersion  string          `json:"go_version"`
+	Subsystems map[string]bool `json:"subsystems"`
+}
+
+// VersionResponse is the diagnostic summary served at /version.
+type VersionResponse struct {
+	BuildInfo
+	RTPEngine []EngineVersion `json:"rtpengine"`
+}
+
+// EngineVersion is the version an rtpengine instance reports in its
+// statistics. Instance is empty with a single rtpengine, and Version when
+// the instance does not report one.
+type EngineVersion struct {
+	Instance string `json:"instance,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// WithBuildInfo serves info at /version.
+func WithBuildInfo(info BuildInfo) HandlerOption {
+	return func(h *Handler) { h.build = info }
+}
+
+// handleVersion answers with the build and the rtpengine versions in one
+// blob to paste into support tickets. rtpengine failing to answer is
+// reported rather than failing the request.
+func (h *Handler) handleVersion(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "http.Version", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	resp := VersionResponse{BuildInfo: h.build, RTPEngine: []EngineVersion{}}
+	stats, err := h.rtpClient.Statistics(ctx)
+	if err != nil {
+		resp.RTPEngine = append(resp.RTPEngine, EngineVersion{Error: err.Error()})
+	} else {
+		resp.RTPEngine = engineVersions(stats)
+	}
+	h.respondJSON(w, resp)
+}
+
+// engineVersions reads the versions from the statistics of one rtpengine or,
+// from a Registry, of each instance under "instances".
+func engineVersions(stats map[string]interface{}) []EngineVersion {
+	instances, ok := stats["instances"].(map[string]interface{})
+	if !ok {
+		version, _ := stats["version"].(string)
+		return []EngineVersion{{Version: version}}
+	}
+	versions := make([]EngineVersion, 0, len(instances))
+	for name, s := range instances {
+		s, _ := s.(map[string]interface{})
+		version, _ := s["version"].(string)
+		errMsg, _ := s["error"].(string)
+		versions = append(versions, EngineVersion{Instance: name, Version: version, Error: errMsg})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Instance < versions[j].Instance })
+	return versions
+}
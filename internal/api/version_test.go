@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+type statsClient struct {
+	rtpengine.Client
+	stats map[string]interface{}
+}
+
+func (c *statsClient) Statistics(ctx context.Context) (map[string]interface{}, error) {
+	return c.stats, nil
+}
+
+func TestVersion(t *testing.T) {
+	client := &statsClient{stats: map[string]interface{}{"instances": map[string]interface{}{
+		"rtp2": map[string]interface{}{"error": "rtp2: timeout"},
+		"rtp1": map[string]interface{}{"version": "12.5.1.3"},
+	}}}
+	build := BuildInfo{Version: "1.4.0", Commit: "abc123", GoVersion: "go1.24", Subsystems: map[string]bool{"multi_engine": true}}
+	mux := http.NewServeMux()
+	NewHandler(client, nil, nil, WithBuildInfo(build)).RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var resp VersionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp.BuildInfo, build) {
+		t.Errorf("build = %+v, want %+v", resp.BuildInfo, build)
+	}
+	want := []EngineVersion{{Instance: "rtp1", Version: "12.5.1.3"}, {Instance: "rtp2", Error: "rtp2: timeout"}}
+	if !reflect.DeepEqual(resp.RTPEngine, want) {
+		t.Errorf("rtpengine = %+v, want %+v", resp.RTPEngine, want)
+	}
+}
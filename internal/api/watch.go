@@ -0,0 +1,317 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/mail"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+// WithMailer emails the matches of watches asking for it.
+func WithMailer(m *mail.Mailer) HandlerOption {
+	return func(h *Handler) { h.mailer = m }
+}
+
+// webhookTimeout bounds the delivery of one webhook notification.
+const webhookTimeout = 5 * time.Second
+
+// Watch registers interest in calls whose ID matches Pattern, a glob as in
+// path.Match, before they exist. When a matching call starts its watch is
+// notified and the chosen actions run.
+type Watch struct {
+	ID      string `json:"id"`
+	Pattern string `json:"pattern"`
+	// Webhook receives a WatchMatch as a JSON POST for every match.
+	Webhook string `json:"webhook,omitempty"`
+	// Email sends every match to the alert email recipients.
+	Email bool `json:"email,omitempty"`
+	// Record starts rtpengine recording of matching calls.
+	Record bool `json:"record,omitempty"`
+	// Consent announces the recordings Record starts to the calls' legs.
+	Consent bool `json:"consent,omitempty"`
+	// Prewarm subscribes to matching calls so spying starts instantly.
+	Prewarm bool `json:"prewarm,omitempty"`
+	// Once removes the watch after its first match.
+	Once      bool       `json:"once,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Matches   int        `json:"matches"`
+	LastMatch *time.Time `json:"last_match,omitempty"`
+}
+
+// WatchMatch notifies a watch of a matching call.
+type WatchMatch struct {
+	Type    string            `json:"type"`
+	WatchID string            `json:"watch_id"`
+	Pattern string            `json:"pattern"`
+	CallID  string            `json:"call_id"`
+	Time    time.Time         `json:"time"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// watchList holds the registered watches and the calls seen by the last
+// poll. Watches live in memory and do not survive restarts.
+type watchList struct {
+	running atomic.Bool
+
+	mu      sync.Mutex
+	watches map[string]*Watch
+	// seen is nil until the first poll, whose calls are not reported as
+	// started.
+	seen map[string]bool
+}
+
+func (l *watchList) add(w Watch) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watches == nil {
+		l.watches = make(map[string]*Watch)
+	}
+	l.watches[w.ID] = &w
+}
+
+func (l *watchList) remove(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.watches[id]
+	delete(l.watches, id)
+	return ok
+}
+
+func (l *watchList) list() []Watch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	watches := make([]Watch, 0, len(l.watches))
+	for _, w := range l.watches {
+		watches = append(watches, *w)
+	}
+	sort.Slice(watches, func(i, j int) bool { return watches[i].CreatedAt.Before(watches[j].CreatedAt) })
+	return watches
+}
+
+func (l *watchList) active() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.watches) > 0
+}
+
+// update records the current call list and returns the watches matching
+// each call that started since the previous update. Watches set to fire
+// once are removed.
+func (l *watchList) update(calls []string, now time.Time) map[string][]Watch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prev := l.seen
+	l.seen = make(map[string]bool, len(calls))
+	for _, callID := range calls {
+		l.seen[callID] = true
+	}
+	if prev == nil {
+		return nil
+	}
+
+	matches := map[string][]Watch{}
+	for _, callID := range calls {
+		if prev[callID] {
+			continue
+		}
+		for id, w := range l.watches {
+			if ok, _ := path.Match(w.Pattern, callID); !ok {
+				continue
+			}
+			w.Matches++
+			w.LastMatch = &now
+			matches[callID] = append(matches[callID], *w)
+			if w.Once {
+				delete(l.watches, id)
+			}
+		}
+	}
+	return matches
+}
+
+// reset forgets the calls seen, e.g. while no watch is registered.
+func (l *watchList) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seen = nil
+}
+
+// RunWatches polls the call list every interval while watches are
+// registered and acts on calls matching them, until ctx is cancelled.
+func (h *Handler) RunWatches(ctx context.Context, interval time.Duration) {
+	h.watches.running.Store(true)
+	defer h.watches.running.Store(false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !h.watches.active() {
+				h.watches.reset()
+				continue
+			}
+			list, err := h.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+			if err != nil {
+				log.Printf("Watches: failed to list calls: %v", err)
+				continue
+			}
+			now := time.Now()
+			for callID, watches := range h.watches.update(list, now) {
+				for _, w := range watches {
+					h.watchMatched(ctx, w, callID, now)
+				}
+			}
+		}
+	}
+}
+
+func (h *Handler) watchMatched(ctx context.Context, w Watch, callID string, now time.Time) {
+	log.Printf("Watch %s matched call %s", w.ID, redact.CallID(callID))
+	h.audit(ctx, "call.watch.match", callID, w.ID)
+
+	if w.Record {
+		if window, ok := h.recordingSuppressed(callID, now); ok {
+			log.Printf("Watch %s: recording of call %s suppressed by maintenance window %s", w.ID, redact.CallID(callID), window.ID)
+		} else if err := h.recordWatched(ctx, callID, w.Consent, now); err != nil {
+			log.Printf("Watch %s: failed to record call %s: %v", w.ID, redact.CallID(callID), err)
+		}
+	}
+	if w.Prewarm && h.spyService != nil {
+		go func() {
+			if err := h.spyService.Prewarm(ctx, callID); err != nil {
+				log.Printf("Watch %s: failed to prewarm call %s: %v", w.ID, redact.CallID(callID), err)
+			}
+		}()
+	}
+	if w.Webhook != "" {
+		go notifyWebhook(ctx, w.Webhook, WatchMatch{Type: string(catalog.EventWatchMatch), WatchID: w.ID, Pattern: w.Pattern, CallID: redact.CallID(callID), Time: now, Labels: h.labels})
+	}
+	if w.Email && h.mailer != nil && !h.alertSuppressed(string(catalog.EventWatchMatch), callID, now) {
+		h.mailer.Notify(mail.Alert{Kind: string(catalog.EventWatchMatch), Summary: fmt.Sprintf("watch %s (%s) matched", w.ID, w.Pattern), CallID: redact.CallID(callID), Time: now})
+	}
+}
+
+func (h *Handler) recordWatched(ctx context.Context, callID string, consent bool, now time.Time) error {
+	path, err := h.recordingPath(callID)
+	if err != nil {
+		return err
+	}
+	if err := h.recordCall(ctx, callID, path, consent); err != nil {
+		return err
+	}
+	h.saveRecording(ctx, store.RecordingRecord{ID: uuid.NewString(), CallID: callID, Location: path, StartedAt: now})
+	return nil
+}
+
+func notifyWebhook(ctx context.Context, url string, match WatchMatch) {
+	if err := postWebhook(ctx, url, match); err != nil {
+		log.Printf("Watch %s: %v", match.WatchID, err)
+	}
+}
+
+// postWebhook delivers v to a webhook as a JSON POST.
+func postWebhook(ctx context.Context, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// handleWatches lists watches on GET, registers one on POST and removes one
+// on DELETE /watches/{id}.
+func (h *Handler) handleWatches(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "http.Watches", trace.WithAttributes(attribute.String("method", r.Method)), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	if !h.watches.running.Load() {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "watches are disabled"), http.StatusNotFound)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/watches"), "/")
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		h.respondJSON(w, h.watches.list())
+	case r.Method == http.MethodPost && id == "":
+		var watch Watch
+		if err := json.NewDecoder(r.Body).Decode(&watch); err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if watch.Pattern == "" {
+			h.respondError(w, fmt.Errorf("pattern is required"), http.StatusBadRequest)
+			return
+		}
+		if _, err := path.Match(watch.Pattern, ""); err != nil {
+			h.respondError(w, fmt.Errorf("invalid pattern: %w", err), http.StatusBadRequest)
+			return
+		}
+		if err := h.checkConsent(watch.Consent); err != nil {
+			h.respondError(w, err, http.StatusBadRequest)
+			return
+		}
+		if watch.Email && h.mailer == nil {
+			h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "email notifications are disabled"), http.StatusBadRequest)
+			return
+		}
+		if h.readOnly && (watch.Record || watch.Prewarm) {
+			h.respondError(w, catalog.Errorf(catalog.ReadOnly, "the monitor is read-only; watches can only notify"), http.StatusForbidden)
+			return
+		}
+		watch.ID = uuid.NewString()
+		watch.CreatedAt = time.Now()
+		watch.Matches, watch.LastMatch = 0, nil
+		h.watches.add(watch)
+		h.audit(ctx, "watch.create", "", watch.ID+" "+watch.Pattern)
+		h.respondJSON(w, watch)
+	case r.Method == http.MethodDelete && id != "":
+		if !h.watches.remove(id) {
+			h.respondError(w, fmt.Errorf("watch not found"), http.StatusNotFound)
+			return
+		}
+		h.audit(ctx, "watch.delete", "", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
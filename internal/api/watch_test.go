@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+type watchClient struct {
+	rtpengine.Client
+	mu       sync.Mutex
+	calls    []string
+	recorded []string
+}
+
+func (c *watchClient) ListCalls(ctx context.Context, opts rtpengine.ListOptions) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...), nil
+}
+
+func (c *watchClient) StartRecording(ctx context.Context, callID, path string) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recorded = append(c.recorded, callID)
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func TestWatchListUpdate(t *testing.T) {
+	var l watchList
+	l.add(Watch{ID: "w1", Pattern: "vip-*"})
+	l.add(Watch{ID: "w2", Pattern: "*-42", Once: true})
+	now := time.Now()
+
+	// Calls already running when the first poll happens are not new.
+	if m := l.update([]string{"vip-1"}, now); len(m) != 0 {
+		t.Errorf("first poll matched %v", m)
+	}
+	m := l.update([]string{"vip-1", "vip-42", "other"}, now)
+	if len(m) != 1 || len(m["vip-42"]) != 2 {
+		t.Fatalf("matches = %v", m)
+	}
+	if watches := l.list(); len(watches) != 1 || watches[0].ID != "w1" || watches[0].Matches != 1 {
+		t.Errorf("after a once watch fired: %+v", watches)
+	}
+}
+
+func TestWatches(t *testing.T) {
+	notified := make(chan WatchMatch, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match WatchMatch
+		json.NewDecoder(r.Body).Decode(&match)
+		notified <- match
+	}))
+	defer hook.Close()
+
+	client := &watchClient{calls: []string{"old"}}
+	h := NewHandler(client, nil, nil)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/watches", strings.NewReader(`{"pattern":"vip-*"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("POST without poller: status = %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.RunWatches(ctx, 10*time.Millisecond)
+	for !h.watches.running.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/watches", strings.NewReader(`{"pattern":"vip-*","record":true,"webhook":"`+hook.URL+`"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST status = %d, body %s", rec.Code, rec.Body)
+	}
+	var watch Watch
+	json.NewDecoder(rec.Body).Decode(&watch)
+
+	time.Sleep(50 * time.Millisecond)
+	client.mu.Lock()
+	client.calls = append(client.calls, "vip-7", "regular")
+	client.mu.Unlock()
+
+	select {
+	case match := <-notified:
+		if match.WatchID != watch.ID || match.CallID != "vip-7" {
+			t.Errorf("match = %+v", match)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not notified")
+	}
+	client.mu.Lock()
+	recorded := client.recorded
+	client.mu.Unlock()
+	if len(recorded) != 1 || recorded[0] != "vip-7" {
+		t.Errorf("recorded = %v", recorded)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/watches/"+watch.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/watches", strings.NewReader(`{"pattern":"["}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid pattern: status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/watches", strings.NewReader(`{"pattern":"vip-*","email":true}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("email without a mailer: status = %d", rec.Code)
+	}
+}
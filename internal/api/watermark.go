@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/watermark"
+)
+
+// maxWatermarkAudio bounds the recordings checked for a watermark, about
+// 17 minutes of 8kHz 16-bit audio.
+const maxWatermarkAudio = 16 << 20
+
+// WatermarkResponse reports the watermark found in a recording. SessionID
+// names the spy session the audio was sent to, or is empty with PCMExport
+// set for audio taken from the PCM export.
+type WatermarkResponse struct {
+	Found     bool       `json:"found"`
+	SessionID string     `json:"session_id,omitempty"`
+	PCMExport bool       `json:"pcm_export,omitempty"`
+	IssuedAt  *time.Time `json:"issued_at,omitempty"`
+}
+
+// WithWatermark reads the watermarks made with key from recordings posted
+// to /admin/watermark.
+func WithWatermark(key *watermark.Key) HandlerOption {
+	return func(h *Handler) { h.watermark = key }
+}
+
+// handleWatermark looks for a watermark in a WAV recording, 8kHz 16-bit
+// mono, such as one that leaked.
+func (h *Handler) handleWatermark(w http.ResponseWriter, r *http.Request) {
+	if h.watermark == nil {
+		h.respondError(w, catalog.Errorf(catalog.FeatureDisabled, "watermarking is disabled"), http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.respondError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, span := h.tracer.Start(r.Context(), "http.Watermark", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWatermarkAudio+1))
+	if err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWatermarkAudio {
+		h.respondError(w, fmt.Errorf("recording exceeds %d bytes", maxWatermarkAudio), http.StatusRequestEntityTooLarge)
+		return
+	}
+	samples, err := wavSamples(body)
+	if err != nil {
+		h.respondError(w, err, http.StatusBadRequest)
+		return
+	}
+	if len(samples) < int(watermark.MessageDuration.Seconds()*watermark.SampleRate)+watermark.FrameSize {
+		h.respondError(w, fmt.Errorf("recording is shorter than %v", watermark.MessageDuration), http.StatusBadRequest)
+		return
+	}
+
+	payload, ok := h.watermark.Detect(samples)
+	if !ok {
+		h.respondJSON(w, WatermarkResponse{})
+		return
+	}
+	resp := WatermarkResponse{Found: true, IssuedAt: &payload.Issued}
+	if payload.ID == [16]byte{} {
+		resp.PCMExport = true
+	} else {
+		resp.SessionID = uuid.UUID(payload.ID).String()
+	}
+	h.respondJSON(w, resp)
+}
+
+// wavSamples returns the samples of a WAV file holding 8kHz 16-bit mono PCM.
+func wavSamples(b []byte) ([]int16, error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, errors.New("recording is not a WAV file")
+	}
+	formatOK := false
+	for off := 12; off+8 <= len(b); {
+		id, size := string(b[off:off+4]), int(binary.LittleEndian.Uint32(b[off+4:off+8]))
+		start := off + 8
+		end := start + size
+		if size > len(b)-start {
+			// Streamed WAV files leave the data size unset.
+			end = len(b)
+		}
+		data := b[start:end]
+
+		switch id {
+		case "fmt ":
+			if len(data) < 16 {
+				return nil, errors.New("malformed WAV format chunk")
+			}
+			format, channels := binary.LittleEndian.Uint16(data[0:]), binary.LittleEndian.Uint16(data[2:])
+			rate, bits := binary.LittleEndian.Uint32(data[4:]), binary.LittleEndian.Uint16(data[14:])
+			if format != 1 || channels != 1 || rate != watermark.SampleRate || bits != 16 {
+				return nil, fmt.Errorf("recording must be 8kHz 16-bit mono PCM, got format %d, %d channels, %dHz, %d bits", format, channels, rate, bits)
+			}
+			formatOK = true
+		case "data":
+			if !formatOK {
+				return nil, errors.New("WAV data precedes its format")
+			}
+			samples := make([]int16, len(data)/2)
+			for i := range samples {
+				samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+			}
+			return samples, nil
+		}
+		// Chunks are padded to an even size.
+		off = end + size%2
+	}
+	return nil, errors.New("WAV file has no audio")
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/watermark"
+)
+
+// testWAV wraps samples in a WAV header for 8kHz 16-bit mono PCM, with an
+// extra chunk before the audio.
+func testWAV(samples []int16) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(4+24+10+8+2*len(samples)))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(8000), uint32(16000), uint16(2), uint16(16)} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("LIST")
+	binary.Write(&b, binary.LittleEndian, uint32(1))
+	b.Write([]byte{0, 0})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(2*len(samples)))
+	binary.Write(&b, binary.LittleEndian, samples)
+	return b.Bytes()
+}
+
+func TestHandleWatermark(t *testing.T) {
+	key := watermark.NewKey("secret")
+	sessionID := uuid.New()
+	issued := time.Unix(1760000000, 0)
+	e := key.NewEmbedder(watermark.Payload{ID: sessionID, Issued: issued})
+
+	samples := make([]int16, 8*watermark.SampleRate)
+	for i := range samples {
+		samples[i] = int16(2000 * math.Sin(2*math.Pi*300*float64(i)/watermark.SampleRate))
+	}
+	for i := 0; i < len(samples); i += watermark.FrameSize {
+		e.Mark(samples[i : i+watermark.FrameSize])
+	}
+
+	mux := http.NewServeMux()
+	NewHandler(nil, nil, nil, WithWatermark(key)).RegisterRoutes(mux)
+	post := func(body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/watermark", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := post(testWAV(samples))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp WatermarkResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Found || resp.SessionID != sessionID.String() || resp.IssuedAt == nil || !resp.IssuedAt.Equal(issued) {
+		t.Errorf("response = %+v, want session %s", resp, sessionID)
+	}
+
+	if rec := post([]byte("not audio")); rec.Code != http.StatusBadRequest {
+		t.Errorf("status for non-WAV body = %d, want 400", rec.Code)
+	}
+	if rec := post(testWAV(samples[:watermark.SampleRate])); rec.Code != http.StatusBadRequest {
+		t.Errorf("status for a one second recording = %d, want 400", rec.Code)
+	}
+
+	disabled := http.NewServeMux()
+	NewHandler(nil, nil, nil).RegisterRoutes(disabled)
+	rec = httptest.NewRecorder()
+	disabled.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/watermark", bytes.NewReader(testWAV(samples))))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without a key = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,287 @@
+// Package automation runs operator scripts reacting to call events, for
+// automations between the static rules of watches and forking the code.
+//
+// Scripts are Starlark files (https://github.com/google/starlark-go) that
+// define on_call_start, on_call_end or both. Handlers are called with the
+// event as a struct with the fields of Event (call.type, call.call_id,
+// call.time, call.instance, call.labels, call.leg_labels), test call IDs
+// with match, act through record, prewarm and notify and log with print.
+//
+//	def on_call_start(call):
+//	    if match("vip-*", call.call_id):
+//	        record()
+//	        notify("https://crm.example.com/hooks/vip")
+//
+// An action that fails raises an error ending the handler where it failed:
+// the actions it took before stand and those after it are not taken, so the
+// script above sends no notification for a call it could not record. The
+// failure is counted and logged, and does not keep the other scripts from
+// running. A handler runs for at most maxSteps steps and stops when the
+// poller does.
+package automation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+// Event types scripts run for.
+const (
+	CallStart = "call.start"
+	CallEnd   = "call.end"
+)
+
+// handlers are the functions scripts define to handle each event type.
+var handlers = map[string]string{
+	CallStart: "on_call_start",
+	CallEnd:   "on_call_end",
+}
+
+// maxSteps bounds the Starlark computation of one handler call, so a
+// runaway loop cannot stall the poller.
+const maxSteps = 1_000_000
+
+// Event is the data a script runs with.
+type Event struct {
+	Type   string    `json:"type"`
+	CallID string    `json:"call_id"`
+	Time   time.Time `json:"time"`
+	// LegLabels maps the rtpengine labels of the call's legs, such as
+	// "caller" or "agent", to their tags. It is empty for CallEnd.
+	LegLabels map[string]string `json:"leg_labels,omitempty"`
+	// Instance is the rtpengine instance the call is on, with several.
+	Instance string `json:"instance,omitempty"`
+	// Labels are the static labels of the monitor.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Actions carry out what scripts ask for.
+type Actions interface {
+	// Record starts rtpengine recording of a call.
+	Record(ctx context.Context, callID string) error
+	// Prewarm subscribes to a call so spying starts instantly.
+	Prewarm(ctx context.Context, callID string) error
+	// Notify posts an event to a webhook as JSON.
+	Notify(ctx context.Context, url string, event Event) error
+}
+
+// Script is a loaded script and how its runs went.
+type Script struct {
+	Name      string     `json:"name"`
+	Runs      int        `json:"runs"`
+	Errors    int        `json:"errors"`
+	LastError string     `json:"last_error,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+
+	handlers map[string]starlark.Callable
+}
+
+// Engine runs the loaded scripts for every event.
+type Engine struct {
+	mu      sync.Mutex
+	scripts []*Script
+}
+
+// Load runs the scripts at paths, each a file or a directory whose *.star
+// files are loaded in name order, to collect their handlers.
+func Load(paths []string) (*Engine, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, "*.star"))
+		if err != nil {
+			return nil, err
+		}
+		slices.Sort(matches)
+		files = append(files, matches...)
+	}
+
+	e := &Engine{}
+	for _, file := range files {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		s, err := load(filepath.Base(file), body)
+		if err != nil {
+			return nil, err
+		}
+		e.scripts = append(e.scripts, s)
+	}
+	return e, nil
+}
+
+func load(name string, body []byte) (*Script, error) {
+	thread := &starlark.Thread{Name: name, Print: printer(name)}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, name, body, builtins)
+	if err != nil {
+		return nil, fmt.Errorf("automation script %s: %w", name, err)
+	}
+
+	s := &Script{Name: name, handlers: make(map[string]starlark.Callable)}
+	for typ, fn := range handlers {
+		v, ok := globals[fn]
+		if !ok {
+			continue
+		}
+		handler, ok := v.(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("automation script %s: %s is a %s, not a function", name, fn, v.Type())
+		}
+		s.handlers[typ] = handler
+	}
+	if len(s.handlers) == 0 {
+		return nil, fmt.Errorf("automation script %s defines neither on_call_start nor on_call_end", name)
+	}
+	return s, nil
+}
+
+// Scripts returns the loaded scripts.
+func (e *Engine) Scripts() []Script {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	scripts := make([]Script, len(e.scripts))
+	for i, s := range e.scripts {
+		scripts[i] = *s
+	}
+	return scripts
+}
+
+// Run calls the handler of every script defining one for ev. A script that
+// fails is logged and does not keep the others from running.
+func (e *Engine) Run(ctx context.Context, ev Event, actions Actions) {
+	for _, s := range e.scripts {
+		handler, ok := s.handlers[ev.Type]
+		if !ok {
+			continue
+		}
+		err := call(ctx, s.Name, handler, ev, actions)
+		now := time.Now()
+		e.mu.Lock()
+		s.Runs++
+		s.LastRun = &now
+		if err != nil {
+			s.Errors++
+			s.LastError = err.Error()
+		}
+		e.mu.Unlock()
+		if err != nil {
+			log.Printf("Automation script %s failed for %s of call %s: %v", s.Name, ev.Type, redact.CallID(ev.CallID), err)
+		}
+	}
+}
+
+// run is what the builtins of a handler call act on.
+type run struct {
+	ctx     context.Context
+	event   Event
+	actions Actions
+}
+
+const runKey = "run"
+
+func call(ctx context.Context, script string, handler starlark.Callable, ev Event, actions Actions) error {
+	thread := &starlark.Thread{Name: script, Print: printer(script)}
+	thread.SetLocal(runKey, &run{ctx: ctx, event: ev, actions: actions})
+	thread.SetMaxExecutionSteps(maxSteps)
+	stop := context.AfterFunc(ctx, func() { thread.Cancel(ctx.Err().Error()) })
+	defer stop()
+
+	_, err := starlark.Call(thread, handler, starlark.Tuple{eventValue(ev)}, nil)
+	return err
+}
+
+func printer(script string) func(*starlark.Thread, string) {
+	return func(_ *starlark.Thread, msg string) {
+		log.Printf("Automation script %s: %s", script, msg)
+	}
+}
+
+func eventValue(ev Event) starlark.Value {
+	return starlarkstruct.FromStringDict(starlark.String("call"), starlark.StringDict{
+		"type":       starlark.String(ev.Type),
+		"call_id":    starlark.String(ev.CallID),
+		"time":       starlark.String(ev.Time.Format(time.RFC3339)),
+		"instance":   starlark.String(ev.Instance),
+		"labels":     stringDict(ev.Labels),
+		"leg_labels": stringDict(ev.LegLabels),
+	})
+}
+
+func stringDict(m map[string]string) *starlark.Dict {
+	d := starlark.NewDict(len(m))
+	for k, v := range m {
+		d.SetKey(starlark.String(k), starlark.String(v))
+	}
+	d.Freeze()
+	return d
+}
+
+// builtins are predeclared in every script. The actions apply to the call
+// of the event being handled.
+var builtins = starlark.StringDict{
+	"record": starlark.NewBuiltin("record", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		r, err := handling(thread, b, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.None, r.actions.Record(r.ctx, r.event.CallID)
+	}),
+	"prewarm": starlark.NewBuiltin("prewarm", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		r, err := handling(thread, b, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.None, r.actions.Prewarm(r.ctx, r.event.CallID)
+	}),
+	"notify": starlark.NewBuiltin("notify", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var url string
+		r, err := handling(thread, b, args, kwargs, &url)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.None, r.actions.Notify(r.ctx, url, r.event)
+	}),
+	// match reports whether s matches the glob pattern, as in path.Match.
+	"match": starlark.NewBuiltin("match", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var pattern, s string
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &pattern, &s); err != nil {
+			return nil, err
+		}
+		ok, err := path.Match(pattern, s)
+		return starlark.Bool(ok), err
+	}),
+}
+
+// handling returns the handler call an action builtin was called from,
+// unpacking its positional args into vars.
+func handling(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, vars ...interface{}) (*run, error) {
+	r, ok := thread.Local(runKey).(*run)
+	if !ok {
+		return nil, fmt.Errorf("%s: only handlers can act on calls", b.Name())
+	}
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, len(vars), vars...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,129 @@
+package automation
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type recorder struct {
+	records  []string
+	prewarms []string
+	notified []string
+}
+
+func (r *recorder) Record(ctx context.Context, callID string) error {
+	if callID == "vip-broken" {
+		return errors.New("rtpengine error: Unknown call-id")
+	}
+	r.records = append(r.records, callID)
+	return nil
+}
+
+func (r *recorder) Prewarm(ctx context.Context, callID string) error {
+	r.prewarms = append(r.prewarms, callID)
+	return nil
+}
+
+func (r *recorder) Notify(ctx context.Context, url string, ev Event) error {
+	r.notified = append(r.notified, url+" "+ev.Type+" "+ev.CallID)
+	return nil
+}
+
+func TestEngine(t *testing.T) {
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"10-vip.star": `
+def on_call_start(call):
+    if match("vip-*", call.call_id):
+        record()
+        notify("http://crm/vip")
+`,
+		"20-agent.star": `
+def on_call_start(call):
+    agent = call.leg_labels.get("agent")
+    if agent:
+        prewarm()
+        print("prewarming agent leg", agent)
+
+def on_call_end(call):
+    pass
+`,
+		"notes.txt": `def broken(`,
+	}
+	for name, body := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e, err := Load([]string{dir})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	r := &recorder{}
+	ctx := context.Background()
+	e.Run(ctx, Event{Type: CallStart, CallID: "vip-1"}, r)
+	e.Run(ctx, Event{Type: CallStart, CallID: "other", LegLabels: map[string]string{"agent": "tag-a"}}, r)
+	e.Run(ctx, Event{Type: CallEnd, CallID: "vip-1"}, r)
+	// The recording fails, ending the handler before it notifies.
+	e.Run(ctx, Event{Type: CallStart, CallID: "vip-broken"}, r)
+
+	if len(r.records) != 1 || r.records[0] != "vip-1" {
+		t.Errorf("records = %v, want vip-1", r.records)
+	}
+	if len(r.notified) != 1 || r.notified[0] != "http://crm/vip call.start vip-1" {
+		t.Errorf("notified = %v", r.notified)
+	}
+	if len(r.prewarms) != 1 || r.prewarms[0] != "other" {
+		t.Errorf("prewarms = %v, want other", r.prewarms)
+	}
+
+	got := e.Scripts()
+	if len(got) != 2 || got[0].Name != "10-vip.star" || got[0].Runs != 3 || got[0].Errors != 1 || got[0].LastError == "" {
+		t.Errorf("Scripts() = %+v", got)
+	}
+	if got[1].Runs != 4 || got[1].Errors != 0 {
+		t.Errorf("Scripts()[1] = %+v, want 4 runs without errors", got[1])
+	}
+
+	os.WriteFile(filepath.Join(dir, "30-broken.star"), []byte(`def on_call_start(call)`), 0o644)
+	if _, err := Load([]string{dir}); err == nil {
+		t.Error("Load() of a broken script error = nil")
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	scripts := map[string]string{
+		"no handlers":      `x = 1`,
+		"not a function":   `on_call_start = "record"`,
+		"top-level action": "record()\ndef on_call_end(call):\n    pass\n",
+	}
+	for name, body := range scripts {
+		file := filepath.Join(t.TempDir(), "script.star")
+		if err := os.WriteFile(file, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load([]string{file}); err == nil {
+			t.Errorf("%s: Load() error = nil", name)
+		}
+	}
+}
+
+func TestRunStepLimit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "loop.star")
+	body := "def on_call_start(call):\n    for i in range(1000000000):\n        pass\n"
+	if err := os.WriteFile(file, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := Load([]string{file})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	e.Run(context.Background(), Event{Type: CallStart, CallID: "c1"}, &recorder{})
+	if got := e.Scripts(); got[0].Errors != 1 {
+		t.Errorf("Scripts() = %+v, want the runaway loop stopped", got)
+	}
+}
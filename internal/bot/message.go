@@ -0,0 +1,302 @@
+package bot
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of bot.proto. They are encoded by hand with protowire, so the
+// wire format must be kept in step with the .proto file;
+// TestMessagesMatchProto checks them against it.
+
+type StreamRequest struct {
+	CallID string
+	Inject *Inject
+}
+
+type Inject struct {
+	Leg string
+	PCM []byte
+	End bool
+}
+
+// StreamEvent carries exactly one of Audio and Played.
+type StreamEvent struct {
+	Audio  *Audio
+	Played *Played
+}
+
+type Audio struct {
+	Leg              string
+	SequenceNumber   uint32
+	RTPTimestamp     uint32
+	SampleRate       uint32
+	PCM              []byte
+	ReceivedUnixNano int64
+}
+
+type Played struct {
+	Leg        string
+	DurationMs uint32
+}
+
+// message is implemented by the pointers to every message type.
+type message interface {
+	marshal(b []byte) []byte
+	unmarshal(b []byte) error
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendMessage(b []byte, num protowire.Number, m message) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.marshal(nil))
+}
+
+// fields calls fn with each field of b. Values of a wire type other than
+// the expected one are skipped, as protobuf does for unknown fields.
+func fields(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, err := fn(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeBytes(typ protowire.Type, b []byte, v *[]byte) int {
+	if typ != protowire.BytesType {
+		return 0
+	}
+	value, n := protowire.ConsumeBytes(b)
+	if n >= 0 {
+		*v = append([]byte(nil), value...)
+	}
+	return n
+}
+
+func consumeString(typ protowire.Type, b []byte, v *string) int {
+	if typ != protowire.BytesType {
+		return 0
+	}
+	value, n := protowire.ConsumeString(b)
+	if n >= 0 {
+		*v = value
+	}
+	return n
+}
+
+func consumeVarint(typ protowire.Type, b []byte, v *uint64) int {
+	if typ != protowire.VarintType {
+		return 0
+	}
+	value, n := protowire.ConsumeVarint(b)
+	if n >= 0 {
+		*v = value
+	}
+	return n
+}
+
+func consumeMessage(typ protowire.Type, b []byte, m message) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, nil
+	}
+	value, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n, nil
+	}
+	return n, m.unmarshal(value)
+}
+
+func (m *StreamRequest) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.CallID)
+	if m.Inject != nil {
+		b = appendMessage(b, 2, m.Inject)
+	}
+	return b
+}
+
+func (m *StreamRequest) unmarshal(b []byte) error {
+	*m = StreamRequest{}
+	return fields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.CallID), nil
+		case 2:
+			m.Inject = &Inject{}
+			return consumeMessage(typ, b, m.Inject)
+		}
+		return 0, nil
+	})
+}
+
+func (m *Inject) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Leg)
+	b = appendBytes(b, 2, m.PCM)
+	if m.End {
+		b = appendVarint(b, 3, 1)
+	}
+	return b
+}
+
+func (m *Inject) unmarshal(b []byte) error {
+	*m = Inject{}
+	return fields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Leg), nil
+		case 2:
+			return consumeBytes(typ, b, &m.PCM), nil
+		case 3:
+			var v uint64
+			n := consumeVarint(typ, b, &v)
+			m.End = v != 0
+			return n, nil
+		}
+		return 0, nil
+	})
+}
+
+func (m *StreamEvent) marshal(b []byte) []byte {
+	switch {
+	case m.Audio != nil:
+		b = appendMessage(b, 1, m.Audio)
+	case m.Played != nil:
+		b = appendMessage(b, 2, m.Played)
+	}
+	return b
+}
+
+func (m *StreamEvent) unmarshal(b []byte) error {
+	*m = StreamEvent{}
+	return fields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			m.Audio, m.Played = &Audio{}, nil
+			return consumeMessage(typ, b, m.Audio)
+		case 2:
+			m.Audio, m.Played = nil, &Played{}
+			return consumeMessage(typ, b, m.Played)
+		}
+		return 0, nil
+	})
+}
+
+func (m *Audio) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Leg)
+	b = appendVarint(b, 2, uint64(m.SequenceNumber))
+	b = appendVarint(b, 3, uint64(m.RTPTimestamp))
+	b = appendVarint(b, 4, uint64(m.SampleRate))
+	b = appendBytes(b, 5, m.PCM)
+	b = appendVarint(b, 6, uint64(m.ReceivedUnixNano))
+	return b
+}
+
+func (m *Audio) unmarshal(b []byte) error {
+	*m = Audio{}
+	return fields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		var v uint64
+		var n int
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Leg), nil
+		case 5:
+			return consumeBytes(typ, b, &m.PCM), nil
+		case 2, 3, 4, 6:
+			n = consumeVarint(typ, b, &v)
+		default:
+			return 0, nil
+		}
+		switch num {
+		case 2:
+			m.SequenceNumber = uint32(v)
+		case 3:
+			m.RTPTimestamp = uint32(v)
+		case 4:
+			m.SampleRate = uint32(v)
+		case 6:
+			m.ReceivedUnixNano = int64(v)
+		}
+		return n, nil
+	})
+}
+
+func (m *Played) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Leg)
+	b = appendVarint(b, 2, uint64(m.DurationMs))
+	return b
+}
+
+func (m *Played) unmarshal(b []byte) error {
+	*m = Played{}
+	return fields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(typ, b, &m.Leg), nil
+		case 2:
+			var v uint64
+			n := consumeVarint(typ, b, &v)
+			m.DurationMs = uint32(v)
+			return n, nil
+		}
+		return 0, nil
+	})
+}
+
+// codec is the gRPC codec of the bot messages. It takes the name of the
+// protobuf codec, as it speaks the same wire format.
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("bot codec: cannot marshal %T", v)
+	}
+	return m.marshal(nil), nil
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("bot codec: cannot unmarshal into %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (codec) Name() string { return "proto" }
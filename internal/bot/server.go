@@ -0,0 +1,248 @@
+// Package bot serves a gRPC API through which external bots receive the
+// audio of a call and inject audio into it, e.g. to whisper hints to an
+// agent.
+package bot
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/notice"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// sampleRate is the rate of injected audio.
+const sampleRate = 8000
+
+// AudioSource is the part of the spy service the bot API uses.
+type AudioSource interface {
+	Tap(ctx context.Context, callID string) (<-chan spy.PCMFrame, func(), error)
+	CallTags(ctx context.Context, callID string) (string, string, error)
+}
+
+type Server struct {
+	audio     AudioSource
+	rtpClient rtpengine.Client
+	apiKeys   map[string]spy.Priority
+	maxInject time.Duration
+	notices   *notice.Notifier
+}
+
+// Option configures optional Server behaviour.
+type Option func(*Server)
+
+// WithAPIKeys requires every stream to carry one of the given keys in its
+// x-api-key metadata. The key's priority applies to the subscription.
+func WithAPIKeys(keys map[string]spy.Priority) Option {
+	return func(s *Server) { s.apiKeys = keys }
+}
+
+// WithNotices tells the agent when whispered audio starts and stops playing
+// into their leg.
+func WithNotices(n *notice.Notifier) Option {
+	return func(s *Server) { s.notices = n }
+}
+
+// WithMaxInject bounds the audio buffered for one injection.
+func WithMaxInject(d time.Duration) Option {
+	return func(s *Server) { s.maxInject = d }
+}
+
+func New(audio AudioSource, rtpClient rtpengine.Client, opts ...Option) *Server {
+	s := &Server{audio: audio, rtpClient: rtpClient, maxInject: 30 * time.Second}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "rtpenginemon.bot.v1.AudioBot",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Stream",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			return srv.(*Server).stream(stream)
+		},
+	}},
+	Metadata: "bot.proto",
+}
+
+// Serve handles bot streams on lis until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	gs := grpc.NewServer(grpc.ForceServerCodec(codec{}))
+	gs.RegisterService(&serviceDesc, s)
+	go func() {
+		<-ctx.Done()
+		gs.GracefulStop()
+	}()
+	return gs.Serve(lis)
+}
+
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if len(s.apiKeys) == 0 {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, key := range md.Get("x-api-key") {
+		if priority, ok := s.apiKeys[key]; ok {
+			return spy.WithPriority(ctx, priority), nil
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "invalid or missing API key")
+}
+
+func (s *Server) stream(stream grpc.ServerStream) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	var req StreamRequest
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	if req.CallID == "" {
+		return status.Error(codes.InvalidArgument, "the first request must name the call")
+	}
+	callID := req.CallID
+
+	frames, stop, err := s.audio.Tap(ctx, callID)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to tap call: %v", err)
+	}
+	defer stop()
+	log.Println("Bot: streaming call", redact.CallID(callID))
+
+	// Sends come from the audio loop and from confirmations of injected
+	// audio; grpc streams allow one sender at a time.
+	var sendMu sync.Mutex
+	send := func(event *StreamEvent) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.SendMsg(event)
+	}
+
+	recvErr := make(chan error, 1)
+	go func() { recvErr <- s.receive(ctx, stream, callID, &req, send) }()
+
+	for {
+		select {
+		case err := <-recvErr:
+			if err != nil {
+				return err
+			}
+			// The bot closed its side and only listens from now on.
+			recvErr = nil
+		case frame, ok := <-frames:
+			if !ok {
+				return status.Error(codes.Unavailable, "call audio ended")
+			}
+			if err := send(&StreamEvent{Audio: audioEvent(frame)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// receive buffers the audio the bot sends and plays it to its leg once the
+// bot ends the utterance. It returns nil when the bot closes its side.
+func (s *Server) receive(ctx context.Context, stream grpc.ServerStream, callID string, req *StreamRequest, send func(*StreamEvent) error) error {
+	buffers := map[string][]byte{}
+	maxBytes := int(s.maxInject.Seconds() * sampleRate * 2)
+
+	for {
+		if inject := req.Inject; inject != nil {
+			if inject.Leg != "from" && inject.Leg != "to" {
+				return status.Errorf(codes.InvalidArgument, "unknown leg %q", inject.Leg)
+			}
+			buf := append(buffers[inject.Leg], inject.PCM...)
+			if len(buf) > maxBytes {
+				return status.Errorf(codes.InvalidArgument, "injected audio exceeds %s", s.maxInject)
+			}
+			buffers[inject.Leg] = buf
+			if inject.End && len(buf) > 0 {
+				delete(buffers, inject.Leg)
+				if err := s.play(ctx, callID, inject.Leg, buf); err != nil {
+					return err
+				}
+				duration := uint32(len(buf) / 2 * 1000 / sampleRate)
+				if err := send(&StreamEvent{Played: &Played{Leg: inject.Leg, DurationMs: duration}}); err != nil {
+					return err
+				}
+			}
+		}
+
+		*req = StreamRequest{}
+		if err := stream.RecvMsg(req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) play(ctx context.Context, callID, leg string, pcm []byte) error {
+	fromTag, toTag, err := s.audio.CallTags(ctx, callID)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "failed to resolve leg: %v", err)
+	}
+	tag := fromTag
+	if leg == "to" {
+		tag = toTag
+	}
+	if _, err := s.rtpClient.PlayMedia(ctx, callID, tag, rtpengine.PlayMediaOptions{Blob: wav(pcm)}); err != nil {
+		return status.Errorf(codes.Internal, "play media failed: %v", err)
+	}
+	s.notices.Started(callID, leg, notice.SourceBot)
+	s.notices.StoppedAfter(time.Duration(len(pcm)/2)*time.Second/sampleRate, callID, leg, notice.SourceBot)
+	return nil
+}
+
+func audioEvent(frame spy.PCMFrame) *Audio {
+	pcm := make([]byte, 2*len(frame.Samples))
+	for i, sample := range frame.Samples {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(sample))
+	}
+	return &Audio{
+		Leg:              frame.Leg,
+		SequenceNumber:   uint32(frame.SequenceNumber),
+		RTPTimestamp:     frame.RTPTimestamp,
+		SampleRate:       uint32(frame.SampleRate),
+		PCM:              pcm,
+		ReceivedUnixNano: frame.Received.UnixNano(),
+	}
+}
+
+// wav wraps 16-bit little-endian mono PCM in a WAV header, a format
+// rtpengine can play from memory.
+func wav(pcm []byte) []byte {
+	b := make([]byte, 44, 44+len(pcm))
+	copy(b, "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], uint32(36+len(pcm)))
+	copy(b[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], 1)
+	binary.LittleEndian.PutUint16(b[22:], 1)
+	binary.LittleEndian.PutUint32(b[24:], sampleRate)
+	binary.LittleEndian.PutUint32(b[28:], sampleRate*2)
+	binary.LittleEndian.PutUint16(b[32:], 2)
+	binary.LittleEndian.PutUint16(b[34:], 16)
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], uint32(len(pcm)))
+	return append(b, pcm...)
+}
@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/notice"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+type fakeAudio struct {
+	frames chan spy.PCMFrame
+}
+
+func (a *fakeAudio) Tap(ctx context.Context, callID string) (<-chan spy.PCMFrame, func(), error) {
+	return a.frames, func() {}, nil
+}
+
+func (a *fakeAudio) CallTags(ctx context.Context, callID string) (string, string, error) {
+	return "tag-a", "tag-b", nil
+}
+
+type playClient struct {
+	rtpengine.Client
+	mu     sync.Mutex
+	played map[string][]byte
+}
+
+func (c *playClient) PlayMedia(ctx context.Context, callID, fromTag string, opts rtpengine.PlayMediaOptions) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.played[fromTag] = opts.Blob
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func startServer(t *testing.T, s *Server) grpc.ClientStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(ctx, lis)
+
+	conn, err := grpc.NewClient("passthrough:///bot",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", "secret")
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], "/rtpenginemon.bot.v1.AudioBot/Stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func TestStream(t *testing.T) {
+	audio := &fakeAudio{frames: make(chan spy.PCMFrame, 1)}
+	client := &playClient{played: map[string][]byte{}}
+	notices := make(chan notice.Notice, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notice.Notice
+		json.NewDecoder(r.Body).Decode(&n)
+		notices <- n
+	}))
+	defer hook.Close()
+	notifier, _ := notice.New(hook.URL, "")
+	stream := startServer(t, New(audio, client, WithAPIKeys(map[string]spy.Priority{"secret": spy.PriorityNormal}), WithNotices(notifier)))
+
+	if err := stream.SendMsg(&StreamRequest{CallID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	audio.frames <- spy.PCMFrame{Leg: "from", SequenceNumber: 5, SampleRate: 8000, Samples: []int16{1, -1}, Received: time.Now()}
+	var event StreamEvent
+	if err := stream.RecvMsg(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Audio == nil || event.Audio.Leg != "from" || event.Audio.SequenceNumber != 5 || len(event.Audio.PCM) != 4 || event.Audio.PCM[2] != 0xff {
+		t.Fatalf("audio event = %+v", event.Audio)
+	}
+
+	// 100ms sent in two chunks is played once the utterance ends.
+	for _, end := range []bool{false, true} {
+		if err := stream.SendMsg(&StreamRequest{Inject: &Inject{Leg: "to", PCM: make([]byte, 800), End: end}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.RecvMsg(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Played == nil || event.Played.Leg != "to" || event.Played.DurationMs != 100 {
+		t.Fatalf("played event = %+v", event.Played)
+	}
+	client.mu.Lock()
+	blob := client.played["tag-b"]
+	client.mu.Unlock()
+	if len(blob) != 44+1600 || string(blob[:4]) != "RIFF" || string(blob[8:12]) != "WAVE" {
+		t.Errorf("played blob of %d bytes", len(blob))
+	}
+	// The agent is told when the whisper starts and when it has played out.
+	for _, want := range []string{"injection.start", "injection.stop"} {
+		select {
+		case n := <-notices:
+			if n.Type != want || n.Leg != "to" || n.Source != notice.SourceBot {
+				t.Errorf("notice = %+v, want %s", n, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s not noticed", want)
+		}
+	}
+
+	// The call ending ends the stream.
+	close(audio.frames)
+	if err := stream.RecvMsg(&event); status.Code(err) != codes.Unavailable {
+		t.Errorf("after the call ended: %v", err)
+	}
+}
+
+func TestStreamRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		keys map[string]spy.Priority
+		req  *StreamRequest
+		want codes.Code
+	}{
+		{"wrong key", map[string]spy.Priority{"other": spy.PriorityNormal}, &StreamRequest{CallID: "c1"}, codes.Unauthenticated},
+		{"no call", nil, &StreamRequest{}, codes.InvalidArgument},
+		{"unknown leg", nil, &StreamRequest{CallID: "c1", Inject: &Inject{Leg: "both"}}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio := &fakeAudio{frames: make(chan spy.PCMFrame)}
+			stream := startServer(t, New(audio, &playClient{}, WithAPIKeys(tt.keys)))
+			if err := stream.SendMsg(tt.req); err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			var event StreamEvent
+			if err := stream.RecvMsg(&event); status.Code(err) != tt.want {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
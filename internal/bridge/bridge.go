@@ -0,0 +1,175 @@
+// Package bridge republishes the audio of calls for consumers that do not
+// speak WebRTC, such as legacy monitoring consoles and SIP listen stations:
+// as plain RTP sent to configured destinations, or as RTSP streams they
+// pull. Both legs are mixed into one PCMU stream.
+package bridge
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// ErrUnknownDestination is returned for RTP destinations that are not
+// configured.
+var ErrUnknownDestination = errors.New("unknown bridge destination")
+
+// AudioSource is the part of the spy service the bridge uses.
+type AudioSource interface {
+	Tap(ctx context.Context, callID string) (<-chan spy.PCMFrame, func(), error)
+}
+
+// Stream is the audio of a call being sent to an RTP destination.
+type Stream struct {
+	CallID      string    `json:"call_id"`
+	Destination string    `json:"destination"`
+	Address     string    `json:"address"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+type streamKey struct {
+	callID      string
+	destination string
+}
+
+type running struct {
+	Stream
+	cancel context.CancelFunc
+}
+
+type Bridge struct {
+	audio        AudioSource
+	destinations map[string]string
+	apiKeys      map[string]spy.Priority
+
+	mu      sync.Mutex
+	streams map[streamKey]*running
+}
+
+// Option configures optional Bridge behaviour.
+type Option func(*Bridge)
+
+// WithDestinations names the addresses RTP streams may be sent to, so API
+// clients pick a configured console rather than any address.
+func WithDestinations(destinations map[string]string) Option {
+	return func(b *Bridge) { b.destinations = destinations }
+}
+
+// WithAPIKeys requires RTSP clients to present one of the given keys. The
+// key's priority applies to the subscription.
+func WithAPIKeys(keys map[string]spy.Priority) Option {
+	return func(b *Bridge) { b.apiKeys = keys }
+}
+
+func New(audio AudioSource, opts ...Option) *Bridge {
+	b := &Bridge{audio: audio, streams: make(map[streamKey]*running)}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Destinations returns the names of the configured RTP destinations.
+func (b *Bridge) Destinations() []string {
+	return slices.Sorted(maps.Keys(b.destinations))
+}
+
+// Start sends the audio of callID to the named destination until Stop is
+// called or the call's source closes. Starting a running stream returns it.
+func (b *Bridge) Start(ctx context.Context, callID, destination string) (Stream, error) {
+	addr, ok := b.destinations[destination]
+	if !ok {
+		return Stream{}, fmt.Errorf("%w %q", ErrUnknownDestination, destination)
+	}
+	key := streamKey{callID, destination}
+	b.mu.Lock()
+	r, ok := b.streams[key]
+	b.mu.Unlock()
+	if ok {
+		return r.Stream, nil
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return Stream{}, fmt.Errorf("failed to resolve %s: %w", destination, err)
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return Stream{}, fmt.Errorf("failed to open socket to %s: %w", destination, err)
+	}
+	frames, stop, err := b.audio.Tap(ctx, callID)
+	if err != nil {
+		conn.Close()
+		return Stream{}, err
+	}
+
+	b.mu.Lock()
+	if r, ok := b.streams[key]; ok {
+		// Started concurrently.
+		b.mu.Unlock()
+		stop()
+		conn.Close()
+		return r.Stream, nil
+	}
+	streamCtx, cancel := context.WithCancel(context.Background())
+	r = &running{Stream: Stream{CallID: callID, Destination: destination, Address: raddr.String(), StartedAt: time.Now()}, cancel: cancel}
+	b.streams[key] = r
+	b.mu.Unlock()
+
+	log.Printf("Bridging call %s to %s (%s)", redact.CallID(callID), destination, raddr)
+	go func() {
+		defer conn.Close()
+		defer stop()
+		// Write errors, such as ICMP port unreachable while the console is
+		// down, do not end the stream.
+		send(streamCtx, frames, func(packet []byte) error {
+			conn.Write(packet)
+			return nil
+		})
+		b.mu.Lock()
+		if b.streams[key] == r {
+			delete(b.streams, key)
+		}
+		b.mu.Unlock()
+		cancel()
+	}()
+	return r.Stream, nil
+}
+
+// Stop ends the stream of callID to destination and reports whether there
+// was one.
+func (b *Bridge) Stop(callID, destination string) bool {
+	key := streamKey{callID, destination}
+	b.mu.Lock()
+	r, ok := b.streams[key]
+	delete(b.streams, key)
+	b.mu.Unlock()
+	if ok {
+		r.cancel()
+	}
+	return ok
+}
+
+// Streams returns the RTP streams of callID ordered by destination.
+func (b *Bridge) Streams(callID string) []Stream {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	streams := []Stream{}
+	for key, r := range b.streams {
+		if key.callID == callID {
+			streams = append(streams, r.Stream)
+		}
+	}
+	slices.SortFunc(streams, func(a, b Stream) int { return cmp.Compare(a.Destination, b.Destination) })
+	return streams
+}
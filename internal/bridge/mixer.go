@@ -0,0 +1,109 @@
+package bridge
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+const (
+	// frameSamples is the audio of one packet, 20ms at 8kHz.
+	frameSamples  = 160
+	frameInterval = 20 * time.Millisecond
+	// maxBacklog bounds the audio buffered per leg, so a burst after a
+	// stall does not delay the stream for good.
+	maxBacklog = 10 * frameSamples
+	// payloadPCMU is the static payload type of G.711 μ-law.
+	payloadPCMU = 0
+)
+
+// mixer sums the audio of the legs of a call into one stream.
+type mixer struct {
+	legs map[string][]int16
+}
+
+func (m *mixer) add(frame spy.PCMFrame) {
+	if m.legs == nil {
+		m.legs = make(map[string][]int16)
+	}
+	buf := append(m.legs[frame.Leg], frame.Samples...)
+	if len(buf) > maxBacklog {
+		buf = buf[len(buf)-maxBacklog:]
+	}
+	m.legs[frame.Leg] = buf
+}
+
+// next mixes the next frame of every leg, filling legs that have fallen
+// silent with silence.
+func (m *mixer) next() []int16 {
+	var sum [frameSamples]int32
+	for leg, buf := range m.legs {
+		n := min(len(buf), frameSamples)
+		for i, v := range buf[:n] {
+			sum[i] += int32(v)
+		}
+		m.legs[leg] = buf[n:]
+	}
+	mixed := make([]int16, frameSamples)
+	for i, v := range sum {
+		mixed[i] = int16(max(math.MinInt16, min(math.MaxInt16, v)))
+	}
+	return mixed
+}
+
+// packetizer numbers the packets of one RTP stream.
+type packetizer struct {
+	ssrc      uint32
+	seq       uint16
+	timestamp uint32
+}
+
+func newPacketizer() *packetizer {
+	return &packetizer{ssrc: rand.Uint32(), seq: uint16(rand.Uint32()), timestamp: rand.Uint32()}
+}
+
+func (p *packetizer) packet(samples []int16) []byte {
+	packet := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    payloadPCMU,
+			SequenceNumber: p.seq,
+			Timestamp:      p.timestamp,
+			SSRC:           p.ssrc,
+		},
+		Payload: spy.EncodePCMU(samples),
+	}
+	p.seq++
+	p.timestamp += uint32(len(samples))
+	raw, _ := packet.Marshal()
+	return raw
+}
+
+// send mixes frames into a PCMU packet every 20ms, silent while no audio
+// arrives, and writes it until ctx is done, frames is closed or write fails.
+func send(ctx context.Context, frames <-chan spy.PCMFrame, write func([]byte) error) {
+	var m mixer
+	p := newPacketizer()
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame, ok := <-frames:
+			if !ok {
+				return
+			}
+			m.add(frame)
+		case <-ticker.C:
+			if err := write(p.packet(m.next())); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package capacity
+
+import "time"
+
+// forecastHorizon is how far ahead call counts are projected.
+const forecastHorizon = time.Hour
+
+// Headroom is the capacity report of one rtpengine instance.
+type Headroom struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Samples int    `json:"samples"`
+
+	Calls             float64 `json:"calls"`
+	CallsTrendPerMin  float64 `json:"calls_trend_per_min"`
+	CallsForecastHour float64 `json:"calls_forecast_1h"`
+
+	PortsUsed  float64 `json:"ports_used"`
+	PortsTotal float64 `json:"ports_total"`
+	// MinutesUntilPortExhaustion is nil when ports are not reported or usage
+	// is not growing.
+	MinutesUntilPortExhaustion *float64 `json:"minutes_until_port_exhaustion"`
+
+	// ClockSkewMs is how far the instance's clock is ahead of the local
+	// one, negative when behind; nil until its responses tell.
+	ClockSkewMs *float64 `json:"clock_skew_ms"`
+	ClockSkewed bool     `json:"clock_skewed"`
+}
+
+// Headroom fits a linear trend over the retained samples.
+func (s *Sampler) Headroom() Headroom {
+	samples := s.Samples()
+	h := Headroom{ID: s.id, Address: s.address, Samples: len(samples)}
+	if s.clock != nil {
+		if skew, ok := s.clock.Skew(); ok {
+			ms := float64(skew.Milliseconds())
+			h.ClockSkewMs, h.ClockSkewed = &ms, s.clock.Skewed()
+		}
+	}
+	if len(samples) == 0 {
+		return h
+	}
+
+	last := samples[len(samples)-1]
+	h.Calls, h.PortsUsed, h.PortsTotal = last.Calls, last.PortsUsed, last.PortsTotal
+
+	h.CallsTrendPerMin = slopePerMinute(samples, func(s Sample) float64 { return s.Calls })
+	h.CallsForecastHour = h.Calls + h.CallsTrendPerMin*forecastHorizon.Minutes()
+	if h.CallsForecastHour < 0 {
+		h.CallsForecastHour = 0
+	}
+
+	portsTrend := slopePerMinute(samples, func(s Sample) float64 { return s.PortsUsed })
+	if last.PortsTotal > 0 && portsTrend > 0 {
+		minutes := (last.PortsTotal - last.PortsUsed) / portsTrend
+		h.MinutesUntilPortExhaustion = &minutes
+	}
+	return h
+}
+
+// slopePerMinute is the least squares slope of value over time.
+func slopePerMinute(samples []Sample, value func(Sample) float64) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+
+	t0 := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(t0).Minutes()
+		y := value(s)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(samples))
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denom
+}
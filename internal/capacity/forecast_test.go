@@ -0,0 +1,46 @@
+package capacity
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHeadroom(t *testing.T) {
+	s := NewSampler("local", "127.0.0.1:22222", nil, time.Minute, 10)
+	start := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		s.Add(Sample{
+			Time:       start.Add(time.Duration(i) * time.Minute),
+			Calls:      float64(10 + 2*i),
+			PortsUsed:  float64(100 + 10*i),
+			PortsTotal: 1000,
+		})
+	}
+
+	h := s.Headroom()
+	if math.Abs(h.CallsTrendPerMin-2) > 1e-9 {
+		t.Errorf("expected trend 2 calls/min, got %v", h.CallsTrendPerMin)
+	}
+	if math.Abs(h.CallsForecastHour-138) > 1e-9 {
+		t.Errorf("expected forecast 138 calls, got %v", h.CallsForecastHour)
+	}
+	if h.MinutesUntilPortExhaustion == nil || math.Abs(*h.MinutesUntilPortExhaustion-86) > 1e-9 {
+		t.Errorf("expected 86 minutes until exhaustion, got %v", h.MinutesUntilPortExhaustion)
+	}
+}
+
+func TestParseSample(t *testing.T) {
+	stats := map[string]interface{}{
+		"statistics": map[string]interface{}{
+			"currentstatistics": map[string]interface{}{"sessionsown": int64(5), "sessionsforeign": int64(1)},
+			"interfaces": []interface{}{
+				map[string]interface{}{"ports": map[string]interface{}{"used": int64(40), "free": int64(60)}},
+			},
+		},
+	}
+	got := parseSample(time.Unix(0, 0), stats)
+	if got.Calls != 6 || got.PortsUsed != 40 || got.PortsTotal != 100 {
+		t.Errorf("unexpected sample: %+v", got)
+	}
+}
@@ -0,0 +1,112 @@
+// Package capacity samples rtpengine statistics into a short in-memory time
+// series and forecasts call growth and port exhaustion from its trend.
+package capacity
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// StatsSource is the subset of the rtpengine client used for sampling.
+type StatsSource interface {
+	Statistics(ctx context.Context) (map[string]interface{}, error)
+}
+
+// SkewSource estimates the skew of the sampled instance's clock.
+type SkewSource interface {
+	Skew() (time.Duration, bool)
+	Skewed() bool
+}
+
+// Sample is one statistics observation.
+type Sample struct {
+	Time       time.Time `json:"time"`
+	Calls      float64   `json:"calls"`
+	PortsUsed  float64   `json:"ports_used"`
+	PortsTotal float64   `json:"ports_total"`
+}
+
+// Sampler keeps the most recent samples of one rtpengine instance.
+type Sampler struct {
+	id       string
+	address  string
+	source   StatsSource
+	interval time.Duration
+	size     int
+	clock    SkewSource
+
+	mu      sync.RWMutex
+	samples []Sample
+}
+
+// NewSampler creates a sampler retaining size samples taken every interval.
+func NewSampler(id, address string, source StatsSource, interval time.Duration, size int) *Sampler {
+	return &Sampler{
+		id:       id,
+		address:  address,
+		source:   source,
+		interval: interval,
+		size:     size,
+	}
+}
+
+// SetClock reports the clock skew estimated by clock in the headroom.
+func (s *Sampler) SetClock(clock SkewSource) {
+	s.clock = clock
+}
+
+// Run samples until ctx is cancelled.
+func (s *Sampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.sample(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sampler) sample(ctx context.Context) {
+	stats, err := s.source.Statistics(ctx)
+	if err != nil {
+		log.Printf("capacity: failed to sample %s: %v", s.address, err)
+		return
+	}
+	s.Add(parseSample(time.Now(), stats))
+}
+
+// Add appends a sample, evicting the oldest one when full.
+func (s *Sampler) Add(sample Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = append(s.samples, sample)
+	if len(s.samples) > s.size {
+		s.samples = s.samples[len(s.samples)-s.size:]
+	}
+}
+
+// Samples returns a copy of the retained samples, oldest first.
+func (s *Sampler) Samples() []Sample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Sample(nil), s.samples...)
+}
+
+func parseSample(now time.Time, resp map[string]interface{}) Sample {
+	stats := rtpengine.DecodeStatistics(resp)
+	sample := Sample{Time: now, Calls: float64(stats.Sessions())}
+	for _, iface := range stats.Interfaces {
+		sample.PortsUsed += float64(iface.PortsUsed)
+		sample.PortsTotal += float64(iface.PortsTotal())
+	}
+	return sample
+}
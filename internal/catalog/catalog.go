@@ -0,0 +1,147 @@
+// Package catalog defines the stable codes of the errors the API returns and
+// the events it emits. Frontends and webhook consumers branch on codes and
+// localize them instead of parsing the English messages, which may change.
+// Codes are never renamed or reused; new ones are only added.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code identifies an error or event.
+type Code string
+
+// Error codes. Every API error carries one; errors without a more specific
+// code carry the one of their HTTP status.
+const (
+	InvalidRequest    Code = "invalid_request"
+	Unauthorized      Code = "unauthorized"
+	Forbidden         Code = "forbidden"
+	NotFound          Code = "not_found"
+	MethodNotAllowed  Code = "method_not_allowed"
+	Conflict          Code = "conflict"
+	TooLarge          Code = "too_large"
+	Internal          Code = "internal"
+	Unavailable       Code = "unavailable"
+	FeatureDisabled   Code = "feature_disabled"
+	CallNotFound      Code = "call_not_found"
+	LegalHold         Code = "legal_hold"
+	QuotaExceeded     Code = "quota_exceeded"
+	Saturated         Code = "saturated"
+	RTPEngineDown     Code = "rtpengine_down"
+	RTPEngineResponse Code = "rtpengine_response"
+	RTPEngineTooLarge Code = "rtpengine_too_large"
+	RTPEngineBusy     Code = "rtpengine_busy"
+	ReadOnly          Code = "read_only"
+)
+
+// Event codes, sent as the type of data channel messages and webhooks.
+const (
+	EventEcho           Code = "echo"
+	EventQuality        Code = "quality"
+	EventLegsChanged    Code = "legs_changed"
+	EventCalls          Code = "calls"
+	EventWatchMatch     Code = "watch.match"
+	EventSpyStart       Code = "spy.start"
+	EventInjectionStart Code = "injection.start"
+	EventInjectionStop  Code = "injection.stop"
+)
+
+// Kinds of catalog entries.
+const (
+	KindError = "error"
+	KindEvent = "event"
+)
+
+// Entry describes a code. Message is the English default text; Fields name
+// the fields of the error body or event that a localized text may use.
+type Entry struct {
+	Code    Code     `json:"code"`
+	Kind    string   `json:"kind"`
+	Status  int      `json:"status,omitempty"`
+	Message string   `json:"message"`
+	Fields  []string `json:"fields,omitempty"`
+}
+
+// entries lists the generic code of each HTTP status before the specific
+// codes answered with the same status.
+var entries = []Entry{
+	{Code: InvalidRequest, Kind: KindError, Status: http.StatusBadRequest, Message: "The request is invalid."},
+	{Code: Unauthorized, Kind: KindError, Status: http.StatusUnauthorized, Message: "The API key is invalid or missing."},
+	{Code: Forbidden, Kind: KindError, Status: http.StatusForbidden, Message: "The request is not allowed."},
+	{Code: NotFound, Kind: KindError, Status: http.StatusNotFound, Message: "The resource does not exist."},
+	{Code: MethodNotAllowed, Kind: KindError, Status: http.StatusMethodNotAllowed, Message: "The method is not allowed on this resource."},
+	{Code: Conflict, Kind: KindError, Status: http.StatusConflict, Message: "The request conflicts with the current state."},
+	{Code: TooLarge, Kind: KindError, Status: http.StatusRequestEntityTooLarge, Message: "The request body is too large."},
+	{Code: Internal, Kind: KindError, Status: http.StatusInternalServerError, Message: "The request failed."},
+	{Code: Unavailable, Kind: KindError, Status: http.StatusServiceUnavailable, Message: "The service is unavailable."},
+	{Code: FeatureDisabled, Kind: KindError, Status: http.StatusNotFound, Message: "The feature is disabled in this deployment."},
+	{Code: CallNotFound, Kind: KindError, Status: http.StatusNotFound, Message: "The call does not exist."},
+	{Code: LegalHold, Kind: KindError, Status: http.StatusConflict, Message: "The call is under legal hold."},
+	{Code: QuotaExceeded, Kind: KindError, Status: http.StatusTooManyRequests, Message: "The tenant's quota is exhausted; retry later."},
+	{Code: Saturated, Kind: KindError, Status: http.StatusServiceUnavailable, Message: "The monitor is at capacity; retry later."},
+	{Code: RTPEngineDown, Kind: KindError, Status: http.StatusServiceUnavailable, Message: "rtpengine is not answering."},
+	{Code: RTPEngineResponse, Kind: KindError, Status: http.StatusBadGateway, Message: "rtpengine returned an unexpected response.", Fields: []string{"command", "field"}},
+	{Code: RTPEngineTooLarge, Kind: KindError, Status: http.StatusBadGateway, Message: "rtpengine's response did not fit a UDP datagram.", Fields: []string{"command"}},
+	{Code: RTPEngineBusy, Kind: KindError, Status: http.StatusTooManyRequests, Message: "Too many rtpengine commands are queued; retry later."},
+	{Code: ReadOnly, Kind: KindError, Status: http.StatusForbidden, Message: "The monitor is read-only."},
+
+	{Code: EventEcho, Kind: KindEvent, Message: "Echo was detected on the call.", Fields: []string{"call_id", "delay_ms"}},
+	{Code: EventQuality, Kind: KindEvent, Message: "The quality of the call's legs was measured.", Fields: []string{"call_id", "from", "to"}},
+	{Code: EventLegsChanged, Kind: KindEvent, Message: "The legs of the call changed.", Fields: []string{"call_id", "changed"}},
+	{Code: EventCalls, Kind: KindEvent, Message: "Calls started, changed or ended.", Fields: []string{"added", "changed", "removed"}},
+	{Code: EventWatchMatch, Kind: KindEvent, Message: "A call matched a watch.", Fields: []string{"watch_id", "pattern", "call_id"}},
+	{Code: EventSpyStart, Kind: KindEvent, Message: "Someone started listening to a call.", Fields: []string{"session_id", "call_id", "listener"}},
+	{Code: EventInjectionStart, Kind: KindEvent, Message: "Audio started playing into a leg of the call.", Fields: []string{"call_id", "leg", "source"}},
+	{Code: EventInjectionStop, Kind: KindEvent, Message: "Audio stopped playing into a leg of the call.", Fields: []string{"call_id", "leg", "source"}},
+}
+
+// Entries returns the catalog.
+func Entries() []Entry {
+	return append([]Entry(nil), entries...)
+}
+
+// Lookup returns the entry of code.
+func Lookup(code Code) (Entry, bool) {
+	for _, e := range entries {
+		if e.Code == code {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Error is an error carrying a catalog code.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Errorf formats an error carrying code.
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// CodeOf returns the code carried by err, or the code of the HTTP status the
+// error is answered with.
+func CodeOf(err error, status int) Code {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	for _, e := range entries {
+		if e.Kind == KindError && e.Status == status {
+			return e.Code
+		}
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return InvalidRequest
+}
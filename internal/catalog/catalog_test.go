@@ -0,0 +1,44 @@
+package catalog
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestEntriesAreUnique(t *testing.T) {
+	seen := map[Code]bool{}
+	for _, e := range Entries() {
+		if seen[e.Code] {
+			t.Errorf("code %q is listed twice", e.Code)
+		}
+		seen[e.Code] = true
+		if e.Message == "" {
+			t.Errorf("code %q has no message", e.Code)
+		}
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		want   Code
+	}{
+		{err: Errorf(FeatureDisabled, "watches are disabled"), status: http.StatusNotFound, want: FeatureDisabled},
+		{err: fmt.Errorf("wrapped: %w", Errorf(LegalHold, "held")), status: http.StatusConflict, want: LegalHold},
+		{err: fmt.Errorf("watch not found"), status: http.StatusNotFound, want: NotFound},
+		{err: fmt.Errorf("method not allowed"), status: http.StatusMethodNotAllowed, want: MethodNotAllowed},
+		{err: fmt.Errorf("busy"), status: http.StatusServiceUnavailable, want: Unavailable},
+		{err: fmt.Errorf("teapot"), status: http.StatusTeapot, want: InvalidRequest},
+		{err: fmt.Errorf("gateway"), status: http.StatusGatewayTimeout, want: Internal},
+	}
+	for _, tt := range tests {
+		if got := CodeOf(tt.err, tt.status); got != tt.want {
+			t.Errorf("CodeOf(%v, %d) = %q, want %q", tt.err, tt.status, got, tt.want)
+		}
+		if _, ok := Lookup(tt.want); !ok {
+			t.Errorf("code %q missing from catalog", tt.want)
+		}
+	}
+}
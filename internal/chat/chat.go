@@ -0,0 +1,256 @@
+// Package chat posts alerts to Slack and Microsoft Teams channels through
+// their incoming webhooks, with links that open the call in the dashboard.
+// Each channel receives the alerts its routing rules select.
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+// Channel types.
+const (
+	Slack = "slack"
+	Teams = "teams"
+)
+
+// postTimeout bounds the delivery of one message.
+const postTimeout = 5 * time.Second
+
+// Channel is the incoming webhook of a Slack or Teams channel and the
+// alerts routed to it.
+type Channel struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Webhook string `json:"webhook"`
+	// Kinds are globs, as in path.Match, of the alert kinds routed to the
+	// channel, such as "quality.*". Empty routes every kind.
+	Kinds []string `json:"kinds,omitempty"`
+	// CallIDs are globs of the call IDs whose alerts are routed to the
+	// channel. Alerts about no call are routed by kind alone.
+	CallIDs []string `json:"call_ids,omitempty"`
+}
+
+func (c Channel) routes(alert Alert) bool {
+	if len(c.Kinds) > 0 && !matchAny(c.Kinds, alert.Kind) {
+		return false
+	}
+	return alert.CallID == "" || len(c.CallIDs) == 0 || matchAny(c.CallIDs, alert.CallID)
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Alert is one event posted to channels.
+type Alert struct {
+	// Kind names the event, such as "quality.alert" or "rtpengine.down".
+	Kind    string
+	Summary string
+	// CallID is the call the alert is about, if any. It is redacted in
+	// messages in anonymized mode, where links are left out as they would
+	// carry it.
+	CallID string
+	// Resolved is set when a condition clears.
+	Resolved bool
+	Instance string
+	Time     time.Time
+}
+
+// Load reads the channels of a JSON file.
+func Load(path string) ([]Channel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var channels []Channel
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return nil, fmt.Errorf("invalid chat channels file %s: %w", path, err)
+	}
+	return channels, nil
+}
+
+// Notifier posts alerts to the channels routing them.
+type Notifier struct {
+	channels  []Channel
+	dashboard string
+	client    *http.Client
+}
+
+// New validates channels and creates a Notifier linking to the dashboard
+// at dashboardURL, or linking nowhere when it is empty.
+func New(channels []Channel, dashboardURL string) (*Notifier, error) {
+	for _, c := range channels {
+		if c.Type != Slack && c.Type != Teams {
+			return nil, fmt.Errorf("chat channel %q: unknown type %q, want slack or teams", c.Name, c.Type)
+		}
+		if c.Webhook == "" {
+			return nil, fmt.Errorf("chat channel %q: webhook is required", c.Name)
+		}
+		for _, p := range append(c.Kinds, c.CallIDs...) {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("chat channel %q: invalid pattern %q: %w", c.Name, p, err)
+			}
+		}
+	}
+	return &Notifier{channels: channels, dashboard: strings.TrimSuffix(dashboardURL, "/"), client: &http.Client{Timeout: postTimeout}}, nil
+}
+
+// Notify posts alert to every channel routing it, in the background.
+// Failures are logged.
+func (n *Notifier) Notify(ctx context.Context, alert Alert) {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+	for _, c := range n.channels {
+		if !c.routes(alert) {
+			continue
+		}
+		go func() {
+			if err := n.post(ctx, c, alert); err != nil {
+				log.Printf("Chat channel %s: %v", c.Name, err)
+			}
+		}()
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, c Channel, alert Alert) error {
+	var msg interface{}
+	if c.Type == Slack {
+		msg = n.slackMessage(alert)
+	} else {
+		msg = n.teamsMessage(alert)
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// link is a button opening the dashboard.
+type link struct {
+	title string
+	url   string
+}
+
+// links open the details of the call and start listening to it.
+func (n *Notifier) links(alert Alert) []link {
+	if n.dashboard == "" || alert.CallID == "" || redact.Enabled() {
+		return nil
+	}
+	id := url.QueryEscape(alert.CallID)
+	return []link{
+		{title: "Call details", url: n.dashboard + "/#call=" + id},
+		{title: "Listen", url: n.dashboard + "/#spy=" + id},
+	}
+}
+
+func title(alert Alert) string {
+	state := "Alert"
+	if alert.Resolved {
+		state = "Resolved"
+	}
+	t := fmt.Sprintf("%s: %s", state, alert.Kind)
+	if alert.Instance != "" {
+		t += " on " + alert.Instance
+	}
+	return t
+}
+
+func text(alert Alert) string {
+	if alert.CallID == "" {
+		return alert.Summary
+	}
+	return fmt.Sprintf("%s (call %s)", alert.Summary, redact.CallID(alert.CallID))
+}
+
+// slackMessage renders alert with Block Kit, its links as buttons.
+func (n *Notifier) slackMessage(alert Alert) map[string]interface{} {
+	icon := ":rotating_light:"
+	if alert.Resolved {
+		icon = ":white_check_mark:"
+	}
+	blocks := []interface{}{
+		map[string]interface{}{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": fmt.Sprintf("%s *%s*\n%s", icon, title(alert), text(alert))},
+		},
+		map[string]interface{}{
+			"type":     "context",
+			"elements": []interface{}{map[string]interface{}{"type": "mrkdwn", "text": alert.Time.UTC().Format(time.RFC3339)}},
+		},
+	}
+	if links := n.links(alert); len(links) > 0 {
+		var buttons []interface{}
+		for _, l := range links {
+			buttons = append(buttons, map[string]interface{}{
+				"type": "button",
+				"text": map[string]interface{}{"type": "plain_text", "text": l.title},
+				"url":  l.url,
+			})
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "actions", "elements": buttons})
+	}
+	return map[string]interface{}{"text": title(alert) + ": " + text(alert), "blocks": blocks}
+}
+
+// teamsMessage renders alert as an Adaptive Card, its links as actions.
+func (n *Notifier) teamsMessage(alert Alert) map[string]interface{} {
+	color := "Attention"
+	if alert.Resolved {
+		color = "Good"
+	}
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": title(alert), "weight": "Bolder", "color": color, "wrap": true},
+			map[string]interface{}{"type": "TextBlock", "text": text(alert), "wrap": true},
+			map[string]interface{}{"type": "TextBlock", "text": alert.Time.UTC().Format(time.RFC3339), "isSubtle": true, "size": "Small"},
+		},
+	}
+	if links := n.links(alert); len(links) > 0 {
+		var actions []interface{}
+		for _, l := range links {
+			actions = append(actions, map[string]interface{}{"type": "Action.OpenUrl", "title": l.title, "url": l.url})
+		}
+		card["actions"] = actions
+	}
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+}
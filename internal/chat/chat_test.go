@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	posted := make(chan map[string]interface{}, 4)
+	hook := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var msg map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&msg)
+			msg["channel"] = name
+			posted <- msg
+		}))
+	}
+	slack, teams := hook("noc"), hook("vip")
+	defer slack.Close()
+	defer teams.Close()
+
+	n, err := New([]Channel{
+		{Name: "noc", Type: Slack, Webhook: slack.URL, Kinds: []string{"quality.*", "rtpengine.*"}},
+		{Name: "vip", Type: Teams, Webhook: teams.URL, Kinds: []string{"quality.*"}, CallIDs: []string{"vip-*"}},
+	}, "https://mon.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.Notify(context.Background(), Alert{Kind: "quality.alert", Summary: "MOS 2.10 below 3.00", CallID: "vip-1"})
+	got := map[string]map[string]interface{}{}
+	for range 2 {
+		select {
+		case msg := <-posted:
+			got[msg["channel"].(string)] = msg
+		case <-time.After(2 * time.Second):
+			t.Fatal("alert not posted to both channels")
+		}
+	}
+	if s := mustJSON(got["noc"]); !strings.Contains(s, `"url":"https://mon.example.com/#spy=vip-1"`) || !strings.Contains(s, "MOS 2.10 below 3.00 (call vip-1)") {
+		t.Errorf("slack message = %s", s)
+	}
+	if s := mustJSON(got["vip"]); !strings.Contains(s, `"type":"Action.OpenUrl"`) || !strings.Contains(s, `"url":"https://mon.example.com/#call=vip-1"`) {
+		t.Errorf("teams message = %s", s)
+	}
+
+	// Neither the kind nor, for the vip channel, the call is routed.
+	n.Notify(context.Background(), Alert{Kind: "disk.full", Summary: "50MiB free"})
+	n.Notify(context.Background(), Alert{Kind: "quality.ok", Summary: "MOS back", CallID: "other", Resolved: true})
+	select {
+	case msg := <-posted:
+		if msg["channel"] != "noc" || !strings.Contains(mustJSON(msg), "Resolved: quality.ok") {
+			t.Errorf("unexpected message %s", mustJSON(msg))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("resolved alert not posted")
+	}
+	select {
+	case msg := <-posted:
+		t.Errorf("unrouted alert posted: %s", mustJSON(msg))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, c := range []Channel{
+		{Name: "a", Type: "irc", Webhook: "https://example.com"},
+		{Name: "b", Type: Slack},
+		{Name: "c", Type: Teams, Webhook: "https://example.com", Kinds: []string{"["}},
+	} {
+		if _, err := New([]Channel{c}, ""); err == nil {
+			t.Errorf("New(%+v) succeeded, want an error", c)
+		}
+	}
+}
+
+func mustJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,130 @@
+// Package cluster shards call sources across rtpengine-mon replicas. Replicas
+// heartbeat into a shared store and agree on call ownership through a
+// consistent hash ring over the live members.
+package cluster
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+// Registry is the subset of the store used for membership.
+type Registry interface {
+	Heartbeat(ctx context.Context, inst store.Instance) error
+	ListInstances(ctx context.Context, since time.Time) ([]store.Instance, error)
+}
+
+// Cluster tracks live members and answers ownership queries.
+type Cluster struct {
+	registry Registry
+	self     store.Instance
+	interval time.Duration
+
+	mu       sync.RWMutex
+	members  []store.Instance
+	ring     *Ring
+	electors map[string]*Elector
+}
+
+// New creates a cluster member advertising itself as self.
+func New(registry Registry, self store.Instance, interval time.Duration) *Cluster {
+	return &Cluster{
+		registry: registry,
+		self:     self,
+		interval: interval,
+		members:  []store.Instance{self},
+		ring:     NewRing([]store.Instance{self}),
+		electors: make(map[string]*Elector),
+	}
+}
+
+// Elector returns the elector for the named singleton job, creating it on
+// first use. Leases expire after three missed heartbeats.
+func (c *Cluster) Elector(leases LeaseStore, name string) *Elector {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.electors[name]
+	if !ok {
+		e = NewElector(leases, name, c.self.ID, 3*c.interval)
+		c.electors[name] = e
+	}
+	return e
+}
+
+// Leadership reports which singleton jobs this member currently leads.
+func (c *Cluster) Leadership() map[string]bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	leading := make(map[string]bool, len(c.electors))
+	for name, e := range c.electors {
+		leading[name] = e.IsLeader()
+	}
+	return leading
+}
+
+// Run heartbeats and refreshes membership until ctx is cancelled. Members
+// missing three heartbeats are dropped from the ring.
+func (c *Cluster) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cluster) refresh(ctx context.Context) {
+	now := time.Now()
+	self := c.self
+	self.LastSeen = now
+	if err := c.registry.Heartbeat(ctx, self); err != nil {
+		log.Printf("cluster: heartbeat failed: %v", err)
+		return
+	}
+
+	members, err := c.registry.ListInstances(ctx, now.Add(-3*c.interval))
+	if err != nil {
+		log.Printf("cluster: failed to list members: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	c.members = members
+	c.ring = NewRing(members)
+	c.mu.Unlock()
+}
+
+// Self returns the local member.
+func (c *Cluster) Self() store.Instance {
+	return c.self
+}
+
+// Members returns the live members seen at the last refresh.
+func (c *Cluster) Members() []store.Instance {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]store.Instance(nil), c.members...)
+}
+
+// Owner returns the member owning callID and whether it is the local member.
+func (c *Cluster) Owner(callID string) (store.Instance, bool) {
+	c.mu.RLock()
+	owner, ok := c.ring.Owner(callID)
+	c.mu.RUnlock()
+
+	if !ok {
+		return c.self, true
+	}
+	return owner, owner.ID == c.self.ID
+}
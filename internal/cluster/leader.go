@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// LeaseStore is the subset of the store used for leader election.
+type LeaseStore interface {
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// Elector runs singleton work on exactly one replica using a lease in the
+// shared store. The lease is renewed every ttl/3; when a leader stops
+// renewing, another replica takes over once the lease expires.
+type Elector struct {
+	leases LeaseStore
+	name   string
+	holder string
+	ttl    time.Duration
+
+	leader atomic.Bool
+}
+
+// NewElector creates an elector for the named lease.
+func NewElector(leases LeaseStore, name, holder string, ttl time.Duration) *Elector {
+	return &Elector{leases: leases, name: name, holder: holder, ttl: ttl}
+}
+
+// IsLeader reports whether this replica currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns until ctx is cancelled. lead is started with a context that
+// is cancelled as soon as leadership is lost.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	var cancelLead context.CancelFunc
+	stepDown := func() {
+		if cancelLead != nil {
+			cancelLead()
+			cancelLead = nil
+		}
+		if e.leader.Swap(false) {
+			log.Printf("cluster: lost %s leadership", e.name)
+		}
+	}
+	defer func() {
+		stepDown()
+		e.leases.ReleaseLease(context.Background(), e.name, e.holder)
+	}()
+
+	for {
+		acquired, err := e.leases.AcquireLease(ctx, e.name, e.holder, e.ttl)
+		if err != nil {
+			log.Printf("cluster: %s lease renewal failed: %v", e.name, err)
+		}
+
+		switch {
+		case acquired && !e.leader.Load():
+			e.leader.Store(true)
+			log.Printf("cluster: acquired %s leadership", e.name)
+			leadCtx, cancel := context.WithCancel(ctx)
+			cancelLead = cancel
+			go lead(leadCtx)
+		case !acquired:
+			stepDown()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+// fakeLeases mirrors the store's lease semantics: a lease is taken when free,
+// expired or already held by the caller.
+type fakeLeases struct {
+	mu       sync.Mutex
+	leases   map[string]lease
+	renewals map[string]int
+}
+
+func newFakeLeases() *fakeLeases {
+	return &fakeLeases{leases: map[string]lease{}, renewals: map[string]int{}}
+}
+
+func (f *fakeLeases) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	if l, ok := f.leases[name]; ok && l.holder != holder && now.Before(l.expires) {
+		return false, nil
+	}
+	f.leases[name] = lease{holder: holder, expires: now.Add(ttl)}
+	f.renewals[holder]++
+	return true, nil
+}
+
+func (f *fakeLeases) ReleaseLease(ctx context.Context, name, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.leases[name].holder == holder {
+		delete(f.leases, name)
+	}
+	return nil
+}
+
+// steal hands the lease to holder, as if this replica's renewal had been
+// lost and another replica had taken the expired lease.
+func (f *fakeLeases) steal(name, holder string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leases[name] = lease{holder: holder, expires: time.Now().Add(time.Hour)}
+}
+
+func (f *fakeLeases) renewalsBy(holder string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.renewals[holder]
+}
+
+// campaign runs e until the returned cancel is called, reporting each lead
+// context on the channel.
+func campaign(e *Elector) (<-chan context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	leads := make(chan context.Context, 4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx, func(ctx context.Context) { leads <- ctx })
+	}()
+	return leads, func() {
+		cancel()
+		<-done
+	}
+}
+
+func awaitLead(t *testing.T, leads <-chan context.Context) context.Context {
+	t.Helper()
+	select {
+	case ctx := <-leads:
+		return ctx
+	case <-time.After(2 * time.Second):
+		t.Fatal("leadership never acquired")
+		return nil
+	}
+}
+
+func awaitDone(t *testing.T, ctx context.Context) {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("lead context not cancelled")
+	}
+}
+
+func TestElectorAcquireAndRenew(t *testing.T) {
+	leases := newFakeLeases()
+	e := NewElector(leases, "leader", "a", 30*time.Millisecond)
+	leads, stop := campaign(e)
+	defer stop()
+
+	ctx := awaitLead(t, leads)
+	if !e.IsLeader() {
+		t.Error("IsLeader() = false after acquiring the lease")
+	}
+
+	// Renewals keep the lease without restarting the singleton work.
+	deadline := time.Now().Add(2 * time.Second)
+	for leases.renewalsBy("a") < 4 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := leases.renewalsBy("a"); n < 4 {
+		t.Fatalf("lease renewed %d times, want at least 4", n)
+	}
+	select {
+	case <-leads:
+		t.Error("lead started again on renewal")
+	default:
+	}
+	if ctx.Err() != nil {
+		t.Error("lead context cancelled while still leader")
+	}
+}
+
+func TestElectorLosesLease(t *testing.T) {
+	leases := newFakeLeases()
+	e := NewElector(leases, "leader", "a", 30*time.Millisecond)
+	leads, stop := campaign(e)
+	defer stop()
+
+	ctx := awaitLead(t, leads)
+	leases.steal("leader", "b")
+	awaitDone(t, ctx)
+	if e.IsLeader() {
+		t.Error("IsLeader() = true after losing the lease")
+	}
+}
+
+func TestElectorHandOver(t *testing.T) {
+	leases := newFakeLeases()
+	a := NewElector(leases, "leader", "a", 30*time.Millisecond)
+	b := NewElector(leases, "leader", "b", 30*time.Millisecond)
+
+	aLeads, stopA := campaign(a)
+	aCtx := awaitLead(t, aLeads)
+	bLeads, stopB := campaign(b)
+	defer stopB()
+
+	// b keeps campaigning but cannot lead while a holds the lease.
+	time.Sleep(60 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("two replicas lead at once")
+	}
+
+	// a shutting down releases the lease, so b takes over.
+	stopA()
+	awaitDone(t, aCtx)
+	if a.IsLeader() {
+		t.Error("stopped elector still reports leadership")
+	}
+	awaitLead(t, bLeads)
+	if !b.IsLeader() {
+		t.Error("IsLeader() = false on the new leader")
+	}
+}
@@ -0,0 +1,45 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+const virtualNodes = 64
+
+// Ring is a consistent hash ring over cluster members. Adding or removing a
+// member only moves the calls that hash next to its virtual nodes.
+type Ring struct {
+	hashes  []uint32
+	members map[uint32]store.Instance
+}
+
+// NewRing builds a ring from members.
+func NewRing(members []store.Instance) *Ring {
+	r := &Ring{members: make(map[uint32]store.Instance, len(members)*virtualNodes)}
+	for _, m := range members {
+		for i := 0; i < virtualNodes; i++ {
+			h := crc32.ChecksumIEEE([]byte(m.ID + "#" + strconv.Itoa(i)))
+			r.hashes = append(r.hashes, h)
+			r.members[h] = m
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// Owner returns the member owning key. ok is false for an empty ring.
+func (r *Ring) Owner(key string) (store.Instance, bool) {
+	if len(r.hashes) == 0 {
+		return store.Instance{}, false
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.members[r.hashes[i]], true
+}
@@ -0,0 +1,33 @@
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+func TestRingStability(t *testing.T) {
+	three := []store.Instance{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	before := NewRing(three)
+	after := NewRing(three[:2])
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("call-%d", i)
+		b, _ := before.Owner(key)
+		a, _ := after.Owner(key)
+		if b.ID != "c" && a.ID != b.ID {
+			moved++
+		}
+	}
+	if moved != 0 {
+		t.Errorf("expected only calls owned by the removed member to move, %d others moved", moved)
+	}
+}
+
+func TestRingEmpty(t *testing.T) {
+	if _, ok := NewRing(nil).Owner("call"); ok {
+		t.Error("expected no owner on an empty ring")
+	}
+}
@@ -1,31 +1,300 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	HTTPPort         int
-	RTPEngineAddr    string
-	WebRTCMinPort    uint16
-	WebRTCMaxPort    uint16
-	WebRTCNAT1To1IPs []string
-	WebRTCICEAddress string
-	WebRTCICEPort    int
+	HTTPPort          int
+	RTPEngineAddr     string
+	WebRTCMinPort     uint16
+	WebRTCMaxPort     uint16
+	WebRTCNAT1To1IPs  []string
+	WebRTCICEAddress  string
+	WebRTCICEPort     int
 	TelemetryEndpoint string
+	LogFile           string
+	// Labels, such as datacenter or team, are attached to every metric,
+	// span, log line, event and call record, so the data of several sites
+	// can be told apart downstream.
+	Labels map[string]string
+
+	// Anonymize hashes call IDs and strips tags from telemetry, logs and
+	// audit events, keyed by AnonymizeSalt.
+	Anonymize     bool
+	AnonymizeSalt string
+
+	// NGDebugCapture keeps this many sanitized NG exchanges for /debug/ng.
+	// Zero disables the capture.
+	NGDebugCapture int
+	// ChaosHooks serves /debug/chaos, which injects NG failures for
+	// resilience testing. Never enable it in production.
+	ChaosHooks bool
+	// ReadOnly refuses every request that would spy on, change or end a
+	// call, for deployments that only show calls.
+	ReadOnly bool
+
+	TLSCertFile        string
+	TLSKeyFile         string
+	HTTP2              bool
+	WebRTCICEShareHTTP bool
+
+	StoreDriver string
+	StoreDSN    string
+	StateFile   string
+	TenantsFile string
+
+	// ErasureSigningKey enables the history erasure API and signs its receipts.
+	ErasureSigningKey string
+
+	AdmissionMaxPPS     float64
+	AdmissionMaxCPU     float64
+	AdmissionRetryAfter time.Duration
+
+	// SubscriptionBudget caps the subscriptions held on rtpengine, two per
+	// watched call or one with SpySubscribeAll. Zero leaves them unlimited.
+	SubscriptionBudget int
+	// SubscriptionQueueTimeout is how long a spy request waits for room in
+	// the budget before it is refused. Zero refuses immediately.
+	SubscriptionQueueTimeout time.Duration
+
+	// SpyDedupeWindow returns the existing session for repeated spy requests
+	// from the same principal for the same call. Zero disables it.
+	SpyDedupeWindow time.Duration
+	// SpyAnswerTimeout closes sessions whose offer is not answered in time.
+	SpyAnswerTimeout time.Duration
+	// SpyFollowInterval is how often watched calls are re-queried to follow
+	// transfers onto new legs. Zero disables it.
+	SpyFollowInterval time.Duration
+	// WatermarkKey enables watermarking the audio sent to listeners and
+	// exported, and is the secret the marks are made and read with.
+	WatermarkKey string
+	// SpySubscribeAll watches both legs of a call with a single subscription
+	// to all of its media instead of one per leg. It needs an rtpengine that
+	// accepts subscribe requests without a from-tag. Calls with more than two
+	// parties are subscribed this way regardless.
+	SpySubscribeAll bool
+
+	// QualityPushInterval is how often listeners receive the MOS of the call
+	// they watch. Zero disables it.
+	QualityPushInterval time.Duration
+
+	// RTPEngineNodes lists the rtpengine instances when there are several.
+	// Calls are found on the instance that owns them; new calls created by
+	// the monitor go to the first one. RTPEngineAddr is the first address.
+	RTPEngineNodes []RTPEngineNode
+	// RTPEngineSRV and RTPEngineK8sSelector discover the rtpengine
+	// instances, from the SRV records of a name or from the pods matching a
+	// label selector in RTPEngineK8sNamespace (the monitor's own when empty)
+	// whose NG interface listens on RTPEngineK8sPort. The instances are
+	// looked up again every RTPEngineDiscoveryInterval.
+	RTPEngineSRV               string
+	RTPEngineK8sSelector       string
+	RTPEngineK8sNamespace      string
+	RTPEngineK8sPort           int
+	RTPEngineDiscoveryInterval time.Duration
+	// RTPEngineTransport is the NG transport, "udp" or "tcp". TCP needs
+	// rtpengine's listen-tcp-ng on RTPEngineAddr.
+	RTPEngineTransport string
+	// RTPEngineEncoding is the encoding of NG requests, "bencode", "json"
+	// or "auto" to use JSON when rtpengine accepts it.
+	RTPEngineEncoding string
+	// RTPEngineQueryCacheTTL is how long query responses are reused for the
+	// same call. Zero disables the cache.
+	RTPEngineQueryCacheTTL time.Duration
+	// RTPEngineRateLimit caps the NG commands sent per second, queueing the
+	// excess, in bursts of up to RTPEngineRateBurst. Zero disables it.
+	RTPEngineRateLimit float64
+	RTPEngineRateBurst int
+	// RTPEngineSockets is how many UDP sockets NG requests are spread over.
+	RTPEngineSockets int
+	// RTPEngineTimeout bounds one NG request attempt, and
+	// RTPEngineCommandTimeouts overrides it per command.
+	RTPEngineTimeout         time.Duration
+	RTPEngineCommandTimeouts map[string]time.Duration
+	// RTPEngineRetries is how many times a request that timed out is
+	// repeated, after RTPEngineRetryBackoff doubling with each retry.
+	RTPEngineRetries      int
+	RTPEngineRetryBackoff time.Duration
+	// RTPEngineTCPFallbackAddr is where rtpengine listens for NG over TCP,
+	// to retry requests whose UDP response does not fit a datagram. Empty
+	// disables the fallback.
+	RTPEngineTCPFallbackAddr string
+	// RTPEngineBackupAddr is a second NG endpoint of the same rtpengine
+	// cluster. Requests move to it after RTPEngineFailoverAfter go
+	// unanswered in a row, and back once the primary answers the pings sent
+	// every RTPEngineFailbackInterval. Empty disables failover.
+	RTPEngineBackupAddr       string
+	RTPEngineFailoverAfter    int
+	RTPEngineFailbackInterval time.Duration
+	// RTPEngineSubscribeFlags, RTPEngineSubscribeRTCPMux,
+	// RTPEngineSubscribeTransportProtocol, RTPEngineSubscribeICE and
+	// RTPEngineSubscribeTranscode replace the NG options of subscribe
+	// requests when set, for rtpengine versions that reject the defaults.
+	RTPEngineSubscribeFlags             []string
+	RTPEngineSubscribeRTCPMux           []string
+	RTPEngineSubscribeTransportProtocol string
+	RTPEngineSubscribeICE               string
+	RTPEngineSubscribeTranscode         []string
+	// RTPEnginePingInterval is how often the NG control connection is
+	// pinged. Zero disables health checking.
+	RTPEnginePingInterval time.Duration
+	// RTPEnginePingFailures is how many pings in a row must fail before
+	// rtpengine is reported unhealthy.
+	RTPEnginePingFailures int
+
+	// PCMExportURL is the NATS server the decoded audio of subscribed legs is
+	// published to. Empty disables the export.
+	PCMExportURL     string
+	PCMExportSubject string
+	// PCMExportQueue is how many frames may wait for the connection before
+	// new ones are dropped.
+	PCMExportQueue int
+
+	// PlayMediaDir is the directory on the rtpengine host announcements are
+	// played from. Empty disables playing them.
+	PlayMediaDir string
+	// RecordingConsentAnnouncement is the file within PlayMediaDir played to
+	// every leg of a call when a recording asking for consent starts. Empty
+	// disables consent announcements.
+	RecordingConsentAnnouncement string
+	// RecordingConsentRequired announces every recording the monitor starts,
+	// whether or not it asks for consent.
+	RecordingConsentRequired bool
+
+	// DoctorSTUNServer is asked for the public address the doctor checks
+	// WebRTCNAT1To1IPs against. Empty skips the check.
+	DoctorSTUNServer string
+	// DoctorDirs are directories, such as rtpengine's recording directory
+	// when it is mounted here, whose free space the doctor checks besides
+	// those the monitor writes to.
+	DoctorDirs []string
+
+	// BotGRPCAddr is the address of the gRPC API through which bots listen
+	// to calls and inject audio. Empty disables it.
+	BotGRPCAddr string
+	// BotMaxInject bounds the audio a bot may inject at once.
+	BotMaxInject time.Duration
+
+	// AgentNoticeWebhook receives a JSON POST when audio starts and stops
+	// playing into a leg, for the agent on it. Empty disables it.
+	AgentNoticeWebhook string
+	// AgentNoticeSIPURI receives the same notices as SIP MESSAGEs over UDP.
+	// Empty disables them.
+	AgentNoticeSIPURI string
+
+	// BridgeRTPDestinations names the host:port addresses the audio of a
+	// call may be sent to as plain RTP, such as legacy monitoring consoles.
+	BridgeRTPDestinations map[string]string
+	// BridgeRTSPAddr is the address of the RTSP server from which clients
+	// pull the audio of a call. Empty disables it.
+	BridgeRTSPAddr string
+
+	// SNMPTrapTarget is the host:port of the receiver of SNMPv2c traps for
+	// critical events. Empty disables them.
+	SNMPTrapTarget string
+	SNMPCommunity  string
+	// SNMPEnterpriseOID roots the notifications and objects of the traps.
+	// Empty uses a placeholder for sites without an enterprise number.
+	SNMPEnterpriseOID string
+	// SNMPMOSThreshold is the MOS below which a call raises a quality trap.
+	SNMPMOSThreshold float64
+	// SNMPDiskInterval is how often the disks written to are checked for
+	// disk full traps.
+	SNMPDiskInterval time.Duration
+
+	// SMTPAddr is the host:port of the SMTP server alerts are emailed
+	// through. Empty disables email.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	// AlertEmailFrom and AlertEmailTo address the alert emails.
+	AlertEmailFrom string
+	AlertEmailTo   []string
+	// AlertEmailTemplate is a text/template file defining the "subject" or
+	// "body" of the emails. Empty uses the built-in template.
+	AlertEmailTemplate string
+	// AlertEmailWindow is how long alerts are collected into one email.
+	AlertEmailWindow time.Duration
+	// AlertEmailMaxPerHour bounds the emails sent an hour; alerts beyond it
+	// wait for a later email. Zero removes the bound.
+	AlertEmailMaxPerHour int
+
+	// ChatChannelsFile is a JSON file of the Slack and Teams channels alerts
+	// are posted to, with their routing rules. Empty disables chat.
+	ChatChannelsFile string
+	// DashboardURL is the external URL of the dashboard, which chat
+	// messages link calls to.
+	DashboardURL string
+
+	// CallFeedInterval is how often the call list is polled for clients of
+	// /calls/events. Zero disables the stream.
+	CallFeedInterval time.Duration
+	// WatchInterval is how often the call list is polled for calls matching
+	// registered watches. Zero disables watches.
+	WatchInterval time.Duration
+	// AutomationScripts are the Starlark files, or directories of *.star
+	// files, of the scripts run for calls starting and ending. Empty disables them.
+	AutomationScripts []string
+	// AutomationInterval is how often the call list is polled for them.
+	AutomationInterval time.Duration
+	// ScreenPopURL is the CRM webhook told about every spy session started,
+	// with the call and the listener. Empty disables it.
+	ScreenPopURL string
+
+	CapacitySampleInterval time.Duration
+	CapacityWindow         time.Duration
+
+	SLOEvaluationInterval time.Duration
+
+	ShadowPercent    float64
+	ShadowMaxSources int
+	ShadowInterval   time.Duration
+
+	// MediaHistoryInterval is how often every call is queried for codec,
+	// ptime and bitrate changes. Zero limits the history to subscribed legs.
+	MediaHistoryInterval time.Duration
+	// MediaHistoryRetention keeps the history of ended calls this long.
+	MediaHistoryRetention time.Duration
+
+	ClusterAdvertiseURL string
+	ClusterInstanceID   string
+	ClusterHeartbeat    time.Duration
+
+	// InstanceID names the subscriptions this instance creates on rtpengine
+	// so orphans can be released after a crash. It defaults to the cluster
+	// instance ID, then the hostname.
+	InstanceID string
+
+	// APIKeys maps each accepted API key to its priority class name.
+	APIKeys map[string]string
+
+	// QuotaWindow is the period usage quotas are counted over. Zero limits
+	// are unlimited.
+	QuotaWindow           time.Duration
+	QuotaKeyRequests      int64
+	QuotaKeySpyMinutes    float64
+	QuotaGlobalRequests   int64
+	QuotaGlobalSpyMinutes float64
 }
 
-func Load() (*Config, error) {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, reading from environment variables")
-	}
+// RTPEngineNode is a named rtpengine instance.
+type RTPEngineNode struct {
+	Name string
+	Addr string
+}
 
-	cfg := &Config{
+// Default returns the configuration used when no environment overrides are set.
+func Default() *Config {
+	return &Config{
 		HTTPPort:         8081,
 		RTPEngineAddr:    "127.0.0.1:22222",
 		WebRTCMinPort:    50000,
@@ -33,8 +302,66 @@ func Load() (*Config, error) {
 		WebRTCNAT1To1IPs: []string{"192.168.1.7"},
 		WebRTCICEAddress: "192.168.1.7",
 		WebRTCICEPort:    8443, // TCP
+		HTTP2:            true,
+
+		AdmissionRetryAfter: 5 * time.Second,
+		SpyDedupeWindow:     5 * time.Second,
+		CallFeedInterval:    time.Second,
+		QualityPushInterval: time.Second,
+		SpyAnswerTimeout:    30 * time.Second,
+		ClusterHeartbeat:    5 * time.Second,
+
+		RTPEngineTransport:    "udp",
+		RTPEngineEncoding:     "bencode",
+		RTPEngineSockets:      1,
+		RTPEngineTimeout:      2 * time.Second,
+		RTPEngineRetries:      2,
+		RTPEngineRetryBackoff: 100 * time.Millisecond,
+		RTPEnginePingInterval: 5 * time.Second,
+		RTPEnginePingFailures: 3,
+
+		RTPEngineFailoverAfter:    3,
+		RTPEngineFailbackInterval: 10 * time.Second,
+
+		RTPEngineK8sPort:           22222,
+		RTPEngineDiscoveryInterval: 30 * time.Second,
+
+		PCMExportSubject: "rtpengine.pcm",
+		PCMExportQueue:   1000,
+
+		BotMaxInject: 30 * time.Second,
+
+		WatchInterval:      2 * time.Second,
+		AutomationInterval: 2 * time.Second,
+
+		SNMPCommunity:    "public",
+		SNMPMOSThreshold: 3.0,
+		SNMPDiskInterval: time.Minute,
+
+		AlertEmailWindow:     time.Minute,
+		AlertEmailMaxPerHour: 10,
+
+		CapacitySampleInterval: 30 * time.Second,
+		CapacityWindow:         time.Hour,
+
+		SLOEvaluationInterval: time.Minute,
+
+		ShadowMaxSources: 10,
+		ShadowInterval:   30 * time.Second,
+
+		MediaHistoryRetention: time.Hour,
+
+		QuotaWindow: 24 * time.Hour,
+	}
+}
+
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, reading from environment variables")
 	}
 
+	cfg := Default()
+
 	if v := os.Getenv("HTTP_PORT"); v != "" {
 		if p, err := strconv.Atoi(v); err == nil {
 			cfg.HTTPPort = p
@@ -43,6 +370,116 @@ func Load() (*Config, error) {
 	if v := os.Getenv("RTPENGINE_ADDR"); v != "" {
 		cfg.RTPEngineAddr = v
 	}
+	if v := os.Getenv("RTPENGINE_NODES"); v != "" {
+		for _, entry := range strings.Split(v, ",") {
+			name, addr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || name == "" || addr == "" {
+				return nil, fmt.Errorf("RTPENGINE_NODES entry %q is not name=address", entry)
+			}
+			if slices.ContainsFunc(cfg.RTPEngineNodes, func(n RTPEngineNode) bool { return n.Name == name }) {
+				return nil, fmt.Errorf("RTPENGINE_NODES names %q twice", name)
+			}
+			cfg.RTPEngineNodes = append(cfg.RTPEngineNodes, RTPEngineNode{Name: name, Addr: addr})
+		}
+		cfg.RTPEngineAddr = cfg.RTPEngineNodes[0].Addr
+	}
+	cfg.RTPEngineSRV = os.Getenv("RTPENGINE_SRV")
+	cfg.RTPEngineK8sSelector = os.Getenv("RTPENGINE_K8S_SELECTOR")
+	cfg.RTPEngineK8sNamespace = os.Getenv("RTPENGINE_K8S_NAMESPACE")
+	if v := os.Getenv("RTPENGINE_K8S_PORT"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil {
+			cfg.RTPEngineK8sPort = p
+		}
+	}
+	if v := os.Getenv("RTPENGINE_DISCOVERY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.RTPEngineDiscoveryInterval = d
+		}
+	}
+	if cfg.RTPEngineSRV != "" && cfg.RTPEngineK8sSelector != "" {
+		return nil, fmt.Errorf("RTPENGINE_SRV and RTPENGINE_K8S_SELECTOR are exclusive")
+	}
+	if (cfg.RTPEngineSRV != "" || cfg.RTPEngineK8sSelector != "") && len(cfg.RTPEngineNodes) > 0 {
+		return nil, fmt.Errorf("RTPENGINE_NODES cannot be combined with instance discovery")
+	}
+	if v := os.Getenv("RTPENGINE_TRANSPORT"); v != "" {
+		cfg.RTPEngineTransport = v
+	}
+	if v := os.Getenv("RTPENGINE_ENCODING"); v != "" {
+		cfg.RTPEngineEncoding = v
+	}
+	if v := os.Getenv("RTPENGINE_QUERY_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.RTPEngineQueryCacheTTL = d
+		}
+	}
+	if v := os.Getenv("RTPENGINE_RATE_LIMIT"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			cfg.RTPEngineRateLimit = f
+		}
+	}
+	if v := os.Getenv("RTPENGINE_RATE_BURST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.RTPEngineRateBurst = n
+		}
+	}
+	if v := os.Getenv("RTPENGINE_SOCKETS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.RTPEngineSockets = n
+		}
+	}
+	if v := os.Getenv("RTPENGINE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.RTPEngineTimeout = d
+		}
+	}
+	if v := os.Getenv("RTPENGINE_COMMAND_TIMEOUTS"); v != "" {
+		cfg.RTPEngineCommandTimeouts = make(map[string]time.Duration)
+		for _, entry := range strings.Split(v, ",") {
+			command, timeout, _ := strings.Cut(strings.TrimSpace(entry), "=")
+			if d, err := time.ParseDuration(timeout); err == nil && command != "" {
+				cfg.RTPEngineCommandTimeouts[command] = d
+			}
+		}
+	}
+	if v := os.Getenv("RTPENGINE_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.RTPEngineRetries = n
+		}
+	}
+	if v := os.Getenv("RTPENGINE_RETRY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.RTPEngineRetryBackoff = d
+		}
+	}
+	if v := os.Getenv("RTPENGINE_TCP_FALLBACK_ADDR"); v != "" {
+		cfg.RTPEngineTCPFallbackAddr = v
+	}
+	if v := os.Getenv("RTPENGINE_SUBSCRIBE_FLAGS"); v != "" {
+		cfg.RTPEngineSubscribeFlags = strings.Split(v, ",")
+	}
+	if v := os.Getenv("RTPENGINE_SUBSCRIBE_RTCP_MUX"); v != "" {
+		cfg.RTPEngineSubscribeRTCPMux = strings.Split(v, ",")
+	}
+	cfg.RTPEngineSubscribeTransportProtocol = os.Getenv("RTPENGINE_SUBSCRIBE_TRANSPORT_PROTOCOL")
+	cfg.RTPEngineSubscribeICE = os.Getenv("RTPENGINE_SUBSCRIBE_ICE")
+	if v := os.Getenv("RTPENGINE_SUBSCRIBE_TRANSCODE"); v != "" {
+		cfg.RTPEngineSubscribeTranscode = strings.Split(v, ",")
+	}
+	cfg.RTPEngineBackupAddr = os.Getenv("RTPENGINE_BACKUP_ADDR")
+	if v := os.Getenv("RTPENGINE_FAILOVER_AFTER"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.RTPEngineFailoverAfter = n
+		}
+	}
+	if v := os.Getenv("RTPENGINE_FAILBACK_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.RTPEngineFailbackInterval = d
+		}
+	}
+	if cfg.RTPEngineBackupAddr != "" && (len(cfg.RTPEngineNodes) > 1 || cfg.RTPEngineSRV != "" || cfg.RTPEngineK8sSelector != "") {
+		return nil, fmt.Errorf("RTPENGINE_BACKUP_ADDR needs a single rtpengine instance")
+	}
 	if v := os.Getenv("WEBRTC_MIN_PORT"); v != "" {
 		if p, err := strconv.ParseUint(v, 10, 16); err == nil {
 			cfg.WebRTCMinPort = uint16(p)
@@ -67,7 +504,396 @@ func Load() (*Config, error) {
 	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
 		cfg.TelemetryEndpoint = v
 	}
+	if v := os.Getenv("LOG_FILE"); v != "" {
+		cfg.LogFile = v
+	}
+	if v := os.Getenv("TLS_CERT_FILE"); v != "" {
+		cfg.TLSCertFile = v
+	}
+	if v := os.Getenv("TLS_KEY_FILE"); v != "" {
+		cfg.TLSKeyFile = v
+	}
+	if v := os.Getenv("HTTP2_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.HTTP2 = b
+		}
+	}
+	if v := os.Getenv("WEBRTC_ICE_SHARE_HTTP_PORT"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.WebRTCICEShareHTTP = b
+		}
+	}
+	if v := os.Getenv("STORE_DRIVER"); v != "" {
+		cfg.StoreDriver = v
+	}
+	if v := os.Getenv("STORE_DSN"); v != "" {
+		cfg.StoreDSN = v
+	}
+	if v := os.Getenv("STATE_FILE"); v != "" {
+		cfg.StateFile = v
+	}
+	if v := os.Getenv("TENANTS_FILE"); v != "" {
+		cfg.TenantsFile = v
+	}
+	if v := os.Getenv("NG_DEBUG_CAPTURE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.NGDebugCapture = n
+		}
+	}
+	if v := os.Getenv("CHAOS_HOOKS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.ChaosHooks = b
+		}
+	}
+	if v := os.Getenv("READ_ONLY"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.ReadOnly = b
+		}
+	}
+	if v := os.Getenv("ERASURE_SIGNING_KEY"); v != "" {
+		cfg.ErasureSigningKey = v
+	}
+	if v := os.Getenv("ADMISSION_MAX_PPS"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.AdmissionMaxPPS = f
+		}
+	}
+	if v := os.Getenv("ADMISSION_MAX_CPU_PERCENT"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.AdmissionMaxCPU = f
+		}
+	}
+	if v := os.Getenv("SUBSCRIPTION_BUDGET"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.SubscriptionBudget = n
+		}
+	}
+	if v := os.Getenv("SUBSCRIPTION_QUEUE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SubscriptionQueueTimeout = d
+		}
+	}
+	if v := os.Getenv("ADMISSION_RETRY_AFTER"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.AdmissionRetryAfter = d
+		}
+	}
+	if v := os.Getenv("CAPACITY_SAMPLE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.CapacitySampleInterval = d
+		}
+	}
+	if v := os.Getenv("CAPACITY_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.CapacityWindow = d
+		}
+	}
+	if v := os.Getenv("LABELS"); v != "" {
+		cfg.Labels = make(map[string]string)
+		for _, entry := range strings.Split(v, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(entry), "=")
+			if !validLabel(key) {
+				return nil, fmt.Errorf("LABELS: invalid label name %q", key)
+			}
+			cfg.Labels[key] = value
+		}
+	}
+	if v := os.Getenv("ANONYMIZE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Anonymize = b
+		}
+	}
+	if v := os.Getenv("ANONYMIZE_SALT"); v != "" {
+		cfg.AnonymizeSalt = v
+	}
+	if v := os.Getenv("SPY_DEDUPE_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SpyDedupeWindow = d
+		}
+	}
+	if v := os.Getenv("SPY_ANSWER_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SpyAnswerTimeout = d
+		}
+	}
+	if v := os.Getenv("SPY_FOLLOW_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SpyFollowInterval = d
+		}
+	}
+	cfg.WatermarkKey = os.Getenv("WATERMARK_KEY")
+	if v := os.Getenv("SPY_SUBSCRIBE_ALL"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.SpySubscribeAll = b
+		}
+	}
+	if v := os.Getenv("QUALITY_PUSH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.QualityPushInterval = d
+		}
+	}
+	if v := os.Getenv("RTPENGINE_PING_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.RTPEnginePingInterval = d
+		}
+	}
+	if v := os.Getenv("RTPENGINE_PING_FAILURES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.RTPEnginePingFailures = n
+		}
+	}
+	if v := os.Getenv("PCM_EXPORT_NATS_URL"); v != "" {
+		cfg.PCMExportURL = v
+	}
+	if v := os.Getenv("PCM_EXPORT_SUBJECT"); v != "" {
+		cfg.PCMExportSubject = v
+	}
+	if v := os.Getenv("PCM_EXPORT_QUEUE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.PCMExportQueue = n
+		}
+	}
+	if v := os.Getenv("PLAY_MEDIA_DIR"); v != "" {
+		cfg.PlayMediaDir = v
+	}
+	if v := os.Getenv("RECORDING_CONSENT_ANNOUNCEMENT"); v != "" {
+		cfg.RecordingConsentAnnouncement = v
+	}
+	if v := os.Getenv("RECORDING_CONSENT_REQUIRED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.RecordingConsentRequired = b
+		}
+	}
+	if v := os.Getenv("DOCTOR_STUN_SERVER"); v != "" {
+		cfg.DoctorSTUNServer = v
+	}
+	if v := os.Getenv("DOCTOR_DIRS"); v != "" {
+		cfg.DoctorDirs = strings.Split(v, ",")
+	}
+	if v := os.Getenv("BOT_GRPC_ADDR"); v != "" {
+		cfg.BotGRPCAddr = v
+	}
+	if v := os.Getenv("BOT_MAX_INJECT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.BotMaxInject = d
+		}
+	}
+	if v := os.Getenv("AGENT_NOTICE_WEBHOOK"); v != "" {
+		cfg.AgentNoticeWebhook = v
+	}
+	if v := os.Getenv("AGENT_NOTICE_SIP_URI"); v != "" {
+		cfg.AgentNoticeSIPURI = v
+	}
+	if v := os.Getenv("BRIDGE_RTP_DESTINATIONS"); v != "" {
+		cfg.BridgeRTPDestinations = make(map[string]string)
+		for _, entry := range strings.Split(v, ",") {
+			name, addr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || name == "" || addr == "" {
+				return nil, fmt.Errorf("BRIDGE_RTP_DESTINATIONS: invalid entry %q, want name=host:port", entry)
+			}
+			cfg.BridgeRTPDestinations[name] = addr
+		}
+	}
+	if v := os.Getenv("BRIDGE_RTSP_ADDR"); v != "" {
+		cfg.BridgeRTSPAddr = v
+	}
+	cfg.SNMPTrapTarget = os.Getenv("SNMP_TRAP_TARGET")
+	if v := os.Getenv("SNMP_COMMUNITY"); v != "" {
+		cfg.SNMPCommunity = v
+	}
+	if v := os.Getenv("SNMP_ENTERPRISE_OID"); v != "" {
+		cfg.SNMPEnterpriseOID = v
+	}
+	if v := os.Getenv("SNMP_MOS_THRESHOLD"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			cfg.SNMPMOSThreshold = f
+		}
+	}
+	if v := os.Getenv("SNMP_DISK_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.SNMPDiskInterval = d
+		}
+	}
+	cfg.ScreenPopURL = os.Getenv("SCREEN_POP_URL")
+	if v := os.Getenv("WATCH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.WatchInterval = d
+		}
+	}
+	cfg.SMTPAddr = os.Getenv("SMTP_ADDR")
+	cfg.SMTPUsername = os.Getenv("SMTP_USERNAME")
+	cfg.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	cfg.AlertEmailFrom = os.Getenv("ALERT_EMAIL_FROM")
+	if v := os.Getenv("ALERT_EMAIL_TO"); v != "" {
+		for _, addr := range strings.Split(v, ",") {
+			cfg.AlertEmailTo = append(cfg.AlertEmailTo, strings.TrimSpace(addr))
+		}
+	}
+	cfg.AlertEmailTemplate = os.Getenv("ALERT_EMAIL_TEMPLATE")
+	if v := os.Getenv("ALERT_EMAIL_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.AlertEmailWindow = d
+		}
+	}
+	if v := os.Getenv("ALERT_EMAIL_MAX_PER_HOUR"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.AlertEmailMaxPerHour = n
+		}
+	}
+	cfg.ChatChannelsFile = os.Getenv("CHAT_CHANNELS_FILE")
+	cfg.DashboardURL = os.Getenv("DASHBOARD_URL")
+	if v := os.Getenv("AUTOMATION_SCRIPTS"); v != "" {
+		cfg.AutomationScripts = strings.Split(v, ",")
+	}
+	if v := os.Getenv("AUTOMATION_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.AutomationInterval = d
+		}
+	}
+	if v := os.Getenv("CALL_FEED_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.CallFeedInterval = d
+		}
+	}
+	if v := os.Getenv("SLO_EVALUATION_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.SLOEvaluationInterval = d
+		}
+	}
+	if v := os.Getenv("SHADOW_PERCENT"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.ShadowPercent = f
+		}
+	}
+	if v := os.Getenv("SHADOW_MAX_SOURCES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ShadowMaxSources = n
+		}
+	}
+	if v := os.Getenv("SHADOW_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.ShadowInterval = d
+		}
+	}
+	if v := os.Getenv("MEDIA_HISTORY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.MediaHistoryInterval = d
+		}
+	}
+	if v := os.Getenv("MEDIA_HISTORY_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.MediaHistoryRetention = d
+		}
+	}
+	if v := os.Getenv("CLUSTER_ADVERTISE_URL"); v != "" {
+		cfg.ClusterAdvertiseURL = strings.TrimRight(v, "/")
+	}
+	if v := os.Getenv("CLUSTER_INSTANCE_ID"); v != "" {
+		cfg.ClusterInstanceID = v
+	}
+	if v := os.Getenv("CLUSTER_HEARTBEAT_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.ClusterHeartbeat = d
+		}
+	}
+	if v := os.Getenv("QUOTA_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.QuotaWindow = d
+		}
+	}
+	if v := os.Getenv("QUOTA_KEY_REQUESTS"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.QuotaKeyRequests = n
+		}
+	}
+	if v := os.Getenv("QUOTA_KEY_SPY_MINUTES"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.QuotaKeySpyMinutes = f
+		}
+	}
+	if v := os.Getenv("QUOTA_GLOBAL_REQUESTS"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.QuotaGlobalRequests = n
+		}
+	}
+	if v := os.Getenv("QUOTA_GLOBAL_SPY_MINUTES"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.QuotaGlobalSpyMinutes = f
+		}
+	}
+	if v := os.Getenv("API_KEYS"); v != "" {
+		cfg.APIKeys = make(map[string]string)
+		for _, entry := range strings.Split(v, ",") {
+			key, priority, _ := strings.Cut(strings.TrimSpace(entry), ":")
+			if key != "" {
+				cfg.APIKeys[key] = priority
+			}
+		}
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if cfg.TenantsFile != "" && cfg.StoreDriver == "" {
+		return nil, fmt.Errorf("TENANTS_FILE requires STORE_DRIVER for the shared store")
+	}
+	if cfg.Anonymize && cfg.AnonymizeSalt == "" {
+		return nil, fmt.Errorf("ANONYMIZE requires ANONYMIZE_SALT")
+	}
+	if cfg.ShadowPercent < 0 || cfg.ShadowPercent > 100 {
+		return nil, fmt.Errorf("SHADOW_PERCENT must be between 0 and 100")
+	}
+	if cfg.ReadOnly && (cfg.ShadowPercent > 0 || cfg.StateFile != "" || cfg.BotGRPCAddr != "" || cfg.BridgeRTSPAddr != "") {
+		return nil, fmt.Errorf("READ_ONLY cannot be combined with SHADOW_PERCENT, STATE_FILE, BOT_GRPC_ADDR or BRIDGE_RTSP_ADDR")
+	}
+	if cfg.RecordingConsentAnnouncement != "" && cfg.PlayMediaDir == "" {
+		return nil, fmt.Errorf("RECORDING_CONSENT_ANNOUNCEMENT requires PLAY_MEDIA_DIR")
+	}
+	if cfg.RecordingConsentRequired && cfg.RecordingConsentAnnouncement == "" {
+		return nil, fmt.Errorf("RECORDING_CONSENT_REQUIRED requires RECORDING_CONSENT_ANNOUNCEMENT")
+	}
+	if cfg.SMTPAddr != "" && (cfg.AlertEmailFrom == "" || len(cfg.AlertEmailTo) == 0) {
+		return nil, fmt.Errorf("SMTP_ADDR requires ALERT_EMAIL_FROM and ALERT_EMAIL_TO")
+	}
+
+	if cfg.ClusterAdvertiseURL != "" && cfg.StoreDriver == "" {
+		return nil, fmt.Errorf("CLUSTER_ADVERTISE_URL requires a shared STORE_DRIVER")
+	}
+	if cfg.ClusterAdvertiseURL != "" && cfg.ClusterInstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("CLUSTER_INSTANCE_ID not set and hostname unavailable: %w", err)
+		}
+		cfg.ClusterInstanceID = hostname
+	}
+	cfg.InstanceID = os.Getenv("INSTANCE_ID")
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = cfg.ClusterInstanceID
+	}
+	if cfg.InstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("INSTANCE_ID not set and hostname unavailable: %w", err)
+		}
+		cfg.InstanceID = hostname
+	}
+	if cfg.StoreDriver == "sqlite" && cfg.StoreDSN == "" {
+		cfg.StoreDSN = "rtpengine-mon.db"
+	}
 
 	return cfg, nil
 }
 
+// validLabel reports whether name can be used as a Prometheus label.
+func validLabel(name string) bool {
+	if name == "" || strings.HasPrefix(name, "__") {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+// Package demux shares a single TCP port between the HTTP server and the
+// browser ICE-TCP mux by sniffing the first bytes of every accepted connection.
+package demux
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	recordTypeHandshake = 0x16
+	sniffTimeout        = 5 * time.Second
+)
+
+// Listener accepts connections on a root listener and routes them either to
+// the HTTP listener or to the ICE listener.
+//
+// When a TLS config is set, TLS connections are terminated here and routed to
+// HTTP; browsers do not speak ICE-TCP over TLS. Plaintext connections are
+// routed to HTTP when they start with an HTTP method and to ICE otherwise
+// (RFC 4571 framing).
+type Listener struct {
+	root      net.Listener
+	tlsConfig *tls.Config
+
+	http *childListener
+	ice  *childListener
+}
+
+// New creates a demultiplexing listener on top of root. tlsConfig may be nil.
+func New(root net.Listener, tlsConfig *tls.Config) *Listener {
+	return &Listener{
+		root:      root,
+		tlsConfig: tlsConfig,
+		http:      newChildListener(root.Addr()),
+		ice:       newChildListener(root.Addr()),
+	}
+}
+
+// HTTP returns the listener receiving HTTP(S) connections.
+func (l *Listener) HTTP() net.Listener {
+	return l.http
+}
+
+// ICE returns the listener receiving ICE-TCP connections.
+func (l *Listener) ICE() net.Listener {
+	return l.ice
+}
+
+// Serve accepts connections until the root listener is closed.
+func (l *Listener) Serve() error {
+	for {
+		conn, err := l.root.Accept()
+		if err != nil {
+			l.http.close()
+			l.ice.close()
+			return err
+		}
+		go l.route(conn)
+	}
+}
+
+// Close closes the root listener and both child listeners.
+func (l *Listener) Close() error {
+	return l.root.Close()
+}
+
+func (l *Listener) route(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+
+	pc := &peekedConn{Conn: conn, r: bufio.NewReader(conn)}
+	first, err := pc.r.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	if first[0] == recordTypeHandshake && l.tlsConfig != nil {
+		tlsConn := tls.Server(pc, l.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		l.http.deliver(tlsConn)
+		return
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	if first[0] >= 'A' && first[0] <= 'Z' {
+		l.http.deliver(pc)
+		return
+	}
+	l.ice.deliver(pc)
+}
+
+// peekedConn replays bytes consumed while sniffing the protocol.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+type childListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newChildListener(addr net.Addr) *childListener {
+	return &childListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (c *childListener) deliver(conn net.Conn) {
+	select {
+	case c.conns <- conn:
+	case <-c.done:
+		conn.Close()
+	}
+}
+
+func (c *childListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-c.conns:
+		return conn, nil
+	case <-c.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (c *childListener) Close() error {
+	c.close()
+	return nil
+}
+
+func (c *childListener) close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func (c *childListener) Addr() net.Addr {
+	return c.addr
+}
@@ -0,0 +1,115 @@
+package demux
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRoutePlaintext(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		wantICE bool
+	}{
+		{name: "http request", payload: []byte("GET / HTTP/1.1\r\n\r\n"), wantICE: false},
+		{name: "rfc4571 framed stun", payload: []byte{0x00, 0x14, 0x00, 0x01}, wantICE: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			l := New(root, nil)
+			go l.Serve()
+			defer l.Close()
+
+			client, err := net.Dial("tcp", root.Addr().String())
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer client.Close()
+			if _, err := client.Write(tt.payload); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+
+			want, other := l.HTTP(), l.ICE()
+			if tt.wantICE {
+				want, other = other, want
+			}
+
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				if c, err := want.Accept(); err == nil {
+					accepted <- c
+				}
+			}()
+			go func() {
+				if c, err := other.Accept(); err == nil {
+					t.Errorf("connection routed to the wrong listener")
+					c.Close()
+				}
+			}()
+
+			select {
+			case conn := <-accepted:
+				defer conn.Close()
+				got := make([]byte, len(tt.payload))
+				if _, err := io.ReadFull(conn, got); err != nil {
+					t.Fatalf("read: %v", err)
+				}
+				if string(got) != string(tt.payload) {
+					t.Errorf("expected sniffed bytes to be replayed, got %q", got)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("connection was not routed")
+			}
+		})
+	}
+}
+
+func TestRouteTLS(t *testing.T) {
+	certs := httptest.NewTLSServer(nil)
+	defer certs.Close()
+
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	l := New(root, certs.TLS)
+	go l.Serve()
+	defer l.Close()
+
+	go func() {
+		if c, err := l.ICE().Accept(); err == nil {
+			t.Errorf("TLS connection routed to ICE")
+			c.Close()
+		}
+	}()
+
+	// With or without ALPN, TLS is served as HTTPS.
+	for _, protos := range [][]string{{"http/1.1"}, nil} {
+		client, err := tls.Dial("tcp", root.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: protos})
+		if err != nil {
+			t.Fatalf("dial %v: %v", protos, err)
+		}
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			if c, err := l.HTTP().Accept(); err == nil {
+				accepted <- c
+			}
+		}()
+		select {
+		case conn := <-accepted:
+			conn.Close()
+		case <-time.After(2 * time.Second):
+			t.Fatalf("TLS connection with ALPN %v was not routed to HTTP", protos)
+		}
+		client.Close()
+	}
+}
@@ -0,0 +1,131 @@
+// Package discovery finds rtpengine instances in DNS SRV records or among
+// Kubernetes pods and keeps an rtpengine.Registry in step as instances come
+// and go.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// Instance is one rtpengine found by a Resolver. Name identifies it across
+// lookups; Addr is its NG address.
+type Instance struct {
+	Name string
+	Addr string
+}
+
+// Resolver lists the rtpengine instances currently available.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]Instance, error)
+}
+
+// errNoneFound is returned by Refresh when a lookup finds no instance.
+var errNoneFound = errors.New("no rtpengine instance found")
+
+// Watcher resolves instances periodically and updates a registry with them,
+// connecting to instances that joined and closing the clients of those that
+// left.
+type Watcher struct {
+	resolver Resolver
+	registry *rtpengine.Registry
+	connect  func(Instance) (rtpengine.Client, error)
+	interval time.Duration
+
+	// addrs holds the address each registry node was connected to.
+	addrs map[string]string
+}
+
+// NewWatcher creates a watcher updating registry every interval. connect
+// creates the client of a new instance.
+func NewWatcher(resolver Resolver, registry *rtpengine.Registry, connect func(Instance) (rtpengine.Client, error), interval time.Duration) *Watcher {
+	return &Watcher{
+		resolver: resolver,
+		registry: registry,
+		connect:  connect,
+		interval: interval,
+		addrs:    make(map[string]string),
+	}
+}
+
+// Run refreshes the registry until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Refresh(ctx); err != nil {
+				log.Printf("discovery: keeping %d rtpengine instances: %v", len(w.registry.Nodes()), err)
+			}
+		}
+	}
+}
+
+// Refresh resolves the instances once and updates the registry. A failed or
+// empty lookup leaves the registry as it is, so a DNS or API server outage
+// does not take every instance away.
+func (w *Watcher) Refresh(ctx context.Context) error {
+	found, err := w.resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return errNoneFound
+	}
+
+	current := make(map[string]rtpengine.Node)
+	for _, n := range w.registry.Nodes() {
+		current[n.Name] = n
+	}
+
+	var nodes, replaced []rtpengine.Node
+	addrs := make(map[string]string, len(found))
+	for _, inst := range found {
+		if _, dup := addrs[inst.Name]; dup {
+			continue
+		}
+		n, ok := current[inst.Name]
+		if ok && w.addrs[inst.Name] == inst.Addr {
+			nodes = append(nodes, n)
+			addrs[inst.Name] = inst.Addr
+			continue
+		}
+
+		client, err := w.connect(inst)
+		if err != nil {
+			log.Printf("discovery: failed to connect to rtpengine %s at %s: %v", inst.Name, inst.Addr, err)
+			if ok {
+				// Keep the previous address until the new one connects.
+				nodes = append(nodes, n)
+				addrs[inst.Name] = w.addrs[inst.Name]
+			}
+			continue
+		}
+		if ok {
+			replaced = append(replaced, n)
+			log.Printf("discovery: rtpengine %s moved to %s", inst.Name, inst.Addr)
+		} else {
+			log.Printf("discovery: rtpengine %s joined at %s", inst.Name, inst.Addr)
+		}
+		nodes = append(nodes, rtpengine.Node{Name: inst.Name, Client: client})
+		addrs[inst.Name] = inst.Addr
+	}
+
+	removed := w.registry.SetNodes(nodes)
+	w.addrs = addrs
+	for _, n := range removed {
+		log.Printf("discovery: rtpengine %s left", n.Name)
+	}
+	for _, n := range append(removed, replaced...) {
+		n.Client.Close()
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+type staticResolver struct {
+	instances []Instance
+	err       error
+}
+
+func (r *staticResolver) Resolve(ctx context.Context) ([]Instance, error) {
+	return r.instances, r.err
+}
+
+// fakeClient records whether it was closed. Methods the tests do not use are
+// left to the embedded nil Client.
+type fakeClient struct {
+	rtpengine.Client
+	addr   string
+	closed bool
+}
+
+func (c *fakeClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func nodeNames(r *rtpengine.Registry) []string {
+	var names []string
+	for _, n := range r.Nodes() {
+		names = append(names, n.Name)
+	}
+	return names
+}
+
+func TestWatcherRefresh(t *testing.T) {
+	resolver := &staticResolver{instances: []Instance{{Name: "a", Addr: "10.0.0.1:22222"}, {Name: "b", Addr: "10.0.0.2:22222"}}}
+	registry := rtpengine.NewRegistry(nil)
+	clients := map[string]*fakeClient{}
+	w := NewWatcher(resolver, registry, func(inst Instance) (rtpengine.Client, error) {
+		c := &fakeClient{addr: inst.Addr}
+		clients[inst.Addr] = c
+		return c, nil
+	}, 0)
+	ctx := context.Background()
+
+	if err := w.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if names := nodeNames(registry); !slices.Equal(names, []string{"a", "b"}) {
+		t.Fatalf("nodes = %v, want [a b]", names)
+	}
+
+	// b leaves, c joins and a moves to a new address.
+	resolver.instances = []Instance{{Name: "a", Addr: "10.0.0.9:22222"}, {Name: "c", Addr: "10.0.0.3:22222"}}
+	if err := w.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if names := nodeNames(registry); !slices.Equal(names, []string{"a", "c"}) {
+		t.Errorf("nodes = %v, want [a c]", names)
+	}
+	if !clients["10.0.0.2:22222"].closed || !clients["10.0.0.1:22222"].closed {
+		t.Error("clients of the instances that left or moved were not closed")
+	}
+	if clients["10.0.0.9:22222"].closed || clients["10.0.0.3:22222"].closed {
+		t.Error("clients of current instances were closed")
+	}
+
+	// Unchanged instances keep their client.
+	before := registry.Nodes()
+	if err := w.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if after := registry.Nodes(); after[0].Client != before[0].Client || after[1].Client != before[1].Client {
+		t.Error("unchanged instances were reconnected")
+	}
+
+	// Failed and empty lookups keep the instances.
+	resolver.err = errors.New("SERVFAIL")
+	if err := w.Refresh(ctx); err == nil {
+		t.Error("Refresh() succeeded with a failing resolver")
+	}
+	resolver.err, resolver.instances = nil, nil
+	if err := w.Refresh(ctx); !errors.Is(err, errNoneFound) {
+		t.Errorf("Refresh() error = %v, want errNoneFound", err)
+	}
+	if names := nodeNames(registry); !slices.Equal(names, []string{"a", "c"}) {
+		t.Errorf("nodes = %v after failed lookups, want [a c]", names)
+	}
+}
+
+func TestSRVInstances(t *testing.T) {
+	got := srvInstances([]*net.SRV{
+		{Target: "rtp-b.example.com.", Port: 22222, Priority: 10},
+		{Target: "rtp-c.example.com.", Port: 22223, Priority: 20},
+		{Target: "rtp-a.example.com.", Port: 22222, Priority: 10},
+	})
+	want := []Instance{
+		{Name: "rtp-a.example.com", Addr: "rtp-a.example.com:22222"},
+		{Name: "rtp-b.example.com", Addr: "rtp-b.example.com:22222"},
+		{Name: "rtp-c.example.com", Addr: "rtp-c.example.com:22223"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("srvInstances() = %v, want %v", got, want)
+	}
+}
+
+func TestKubernetesResolve(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/voip/pods" || r.URL.Query().Get("labelSelector") != "app=rtpengine" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"items": [
+			{"metadata": {"name": "rtpengine-1"}, "status": {"phase": "Running", "podIP": "10.1.0.5",
+				"conditions": [{"type": "Ready", "status": "True"}]}},
+			{"metadata": {"name": "rtpengine-0"}, "status": {"phase": "Running", "podIP": "10.1.0.4",
+				"conditions": [{"type": "Ready", "status": "True"}]}},
+			{"metadata": {"name": "rtpengine-2"}, "status": {"phase": "Running", "podIP": "10.1.0.6",
+				"conditions": [{"type": "Ready", "status": "False"}]}},
+			{"metadata": {"name": "rtpengine-3"}, "status": {"phase": "Pending"}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	k := &Kubernetes{selector: "app=rtpengine", namespace: "voip", port: 22222, server: srv.URL, tokenFile: tokenFile, client: srv.Client()}
+
+	got, err := k.Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	want := []Instance{
+		{Name: "rtpengine-0", Addr: "10.1.0.4:22222"},
+		{Name: "rtpengine-1", Addr: "10.1.0.5:22222"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Resolve() = %v, want %v", got, want)
+	}
+}
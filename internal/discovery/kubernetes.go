@@ -0,0 +1,145 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the credentials of a pod's
+// service account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Kubernetes resolves instances from the pods matching a label selector,
+// asking the API server of the cluster the monitor runs in with its service
+// account, which needs to list pods. Each running and ready pod is one
+// instance, named after the pod.
+type Kubernetes struct {
+	selector  string
+	namespace string
+	port      int
+
+	server    string
+	tokenFile string
+	client    *http.Client
+}
+
+// NewKubernetes creates a resolver for the pods matching selector in
+// namespace, or in the monitor's own namespace when it is empty, whose NG
+// interface listens on port.
+func NewKubernetes(selector, namespace string, port int) (*Kubernetes, error) {
+	host, apiPort := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || apiPort == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes pod: KUBERNETES_SERVICE_HOST is not set")
+	}
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate in cluster CA")
+	}
+
+	return &Kubernetes{
+		selector:  selector,
+		namespace: namespace,
+		port:      port,
+		server:    "https://" + net.JoinHostPort(host, apiPort),
+		tokenFile: serviceAccountDir + "/token",
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// podList is the part of a Kubernetes pod list the resolver reads.
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Status struct {
+			Phase      string `json:"phase"`
+			PodIP      string `json:"podIP"`
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+func (k *Kubernetes) Resolve(ctx context.Context) ([]Instance, error) {
+	// The token is read for every request: projected tokens are rotated.
+	token, err := os.ReadFile(k.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/pods?labelSelector=%s", k.server, url.PathEscape(k.namespace), url.QueryEscape(k.selector))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing pods failed: %s", resp.Status)
+	}
+
+	var pods podList
+	if err := json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, fmt.Errorf("failed to decode pod list: %w", err)
+	}
+	return k.instances(pods), nil
+}
+
+// instances returns the running and ready pods, sorted by name.
+func (k *Kubernetes) instances(pods podList) []Instance {
+	var instances []Instance
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != "Running" || pod.Status.PodIP == "" {
+			continue
+		}
+		ready := false
+		for _, c := range pod.Status.Conditions {
+			if c.Type == "Ready" {
+				ready = c.Status == "True"
+			}
+		}
+		if !ready {
+			continue
+		}
+		instances = append(instances, Instance{
+			Name: pod.Metadata.Name,
+			Addr: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(k.port)),
+		})
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+	return instances
+}
@@ -0,0 +1,54 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SRV resolves instances from the SRV records of a name such as
+// _ng._udp.rtpengine.example.com. Each target is one instance, named after
+// its host.
+type SRV struct {
+	name     string
+	resolver *net.Resolver
+}
+
+// NewSRV creates a resolver for the SRV records of name.
+func NewSRV(name string) *SRV {
+	return &SRV{name: name, resolver: net.DefaultResolver}
+}
+
+func (s *SRV) Resolve(ctx context.Context) ([]Instance, error) {
+	_, records, err := s.resolver.LookupSRV(ctx, "", "", s.name)
+	if err != nil {
+		return nil, err
+	}
+	return srvInstances(records), nil
+}
+
+// srvInstances orders records by priority and then target rather than the
+// weighted random order of LookupSRV, so the first instance, which new calls
+// go to, only changes with the records.
+func srvInstances(records []*net.SRV) []Instance {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		return records[i].Target < records[j].Target
+	})
+	instances := make([]Instance, 0, len(records))
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		if host == "" {
+			continue
+		}
+		instances = append(instances, Instance{
+			Name: host,
+			Addr: net.JoinHostPort(host, strconv.Itoa(int(r.Port))),
+		})
+	}
+	return instances
+}
@@ -0,0 +1,329 @@
+// Package doctor checks the environment the monitor runs in and says what to
+// fix: whether rtpengine answers and how fast, whether the ICE ports can be
+// bound, whether WEBRTC_NAT_1TO1_IPS is the address the internet sees,
+// whether the disks written to have room and whether the telemetry endpoint
+// is reachable.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pion/stun/v3"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	OK      Status = "ok"
+	Warn    Status = "warn"
+	Fail    Status = "fail"
+	Skipped Status = "skipped"
+)
+
+const (
+	// slowNG is the NG round trip above which spy requests feel sluggish.
+	slowNG = 100 * time.Millisecond
+	// lowDisk and fullDisk are the free space below which a directory is
+	// warned about and failed.
+	lowDisk  = 1 << 30
+	fullDisk = 100 << 20
+	// dialTimeout bounds the network checks.
+	dialTimeout = 3 * time.Second
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Check  string `json:"check"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+	// Fix says what to do about a warning or failure.
+	Fix string `json:"fix,omitempty"`
+}
+
+// Failed reports whether any check failed.
+func Failed(results []Result) bool {
+	return slices.ContainsFunc(results, func(r Result) bool { return r.Status == Fail })
+}
+
+// Doctor runs the checks for a configuration.
+type Doctor struct {
+	cfg        *config.Config
+	rtpClient  rtpengine.Client
+	stunServer string
+	dirs       []string
+	// inProcess is set when the monitor itself runs the checks, holding
+	// the ICE TCP port and some of the UDP ports.
+	inProcess bool
+}
+
+// Option configures a Doctor.
+type Option func(*Doctor)
+
+// WithSTUNServer checks the public address against WEBRTC_NAT_1TO1_IPS by
+// asking the STUN server at addr, e.g. stun.l.google.com:19302.
+func WithSTUNServer(addr string) Option {
+	return func(d *Doctor) { d.stunServer = addr }
+}
+
+// WithDirs checks the free space of the directories written to, such as
+// recording paths. Directories that do not exist on this host are skipped.
+func WithDirs(dirs ...string) Option {
+	return func(d *Doctor) { d.dirs = append(d.dirs, dirs...) }
+}
+
+// InProcess runs the checks from within a running monitor, whose own ICE
+// ports are not reported as taken.
+func InProcess() Option {
+	return func(d *Doctor) { d.inProcess = true }
+}
+
+// New creates a Doctor checking cfg and the rtpengine behind rtpClient.
+func New(cfg *config.Config, rtpClient rtpengine.Client, opts ...Option) *Doctor {
+	d := &Doctor{cfg: cfg, rtpClient: rtpClient}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Run runs every check in order.
+func (d *Doctor) Run(ctx context.Context) []Result {
+	results := []Result{d.checkRTPEngine(ctx), d.checkICEPorts(), d.checkICETCPPort(), d.checkNAT(ctx)}
+	results = append(results, d.checkDisks()...)
+	return append(results, d.checkTelemetry(ctx))
+}
+
+// Disks checks only the free space of the directories, for watching them
+// between full runs.
+func (d *Doctor) Disks() []Result {
+	return d.checkDisks()
+}
+
+func (d *Doctor) checkRTPEngine(ctx context.Context) Result {
+	r := Result{Check: "rtpengine"}
+	start := time.Now()
+	err := d.rtpClient.Ping(ctx)
+	rtt := time.Since(start)
+	switch {
+	case err != nil:
+		r.Status, r.Detail = Fail, fmt.Sprintf("%s does not answer: %v", d.cfg.RTPEngineAddr, err)
+		r.Fix = "check RTPENGINE_ADDR and that rtpengine's listen-ng address is reachable from this host (firewall, interface it listens on)"
+	case rtt > slowNG:
+		r.Status, r.Detail = Warn, fmt.Sprintf("%s answered ping in %s", d.cfg.RTPEngineAddr, rtt.Round(time.Millisecond))
+		r.Fix = fmt.Sprintf("NG round trips above %s slow down spy requests; run the monitor closer to rtpengine or check its load", slowNG)
+	default:
+		r.Status, r.Detail = OK, fmt.Sprintf("%s answered ping in %s", d.cfg.RTPEngineAddr, rtt.Round(time.Microsecond))
+	}
+	return r
+}
+
+func (d *Doctor) checkICEPorts() Result {
+	r := Result{Check: "ice_udp_ports"}
+	lo, hi := int(d.cfg.WebRTCMinPort), int(d.cfg.WebRTCMaxPort)
+	if lo == 0 || hi < lo {
+		r.Status, r.Detail = Skipped, "no WEBRTC_MIN_PORT/WEBRTC_MAX_PORT range configured"
+		return r
+	}
+	free := 0
+	for port := lo; port <= hi; port++ {
+		conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		free++
+	}
+	total := hi - lo + 1
+	r.Detail = fmt.Sprintf("%d of %d ports in %d-%d can be bound", free, total, lo, hi)
+	switch {
+	case free == 0:
+		r.Status = Fail
+		r.Fix = "another process holds the range or the user may not bind it; pick a free WEBRTC_MIN_PORT/WEBRTC_MAX_PORT range"
+	case free < total/2 && !d.inProcess:
+		r.Status = Warn
+		r.Fix = "half the range is taken by other processes, leaving fewer listeners; widen or move the range"
+	default:
+		r.Status = OK
+	}
+	return r
+}
+
+func (d *Doctor) checkICETCPPort() Result {
+	r := Result{Check: "ice_tcp_port"}
+	if d.cfg.WebRTCICEShareHTTP || d.cfg.WebRTCICEPort == 0 {
+		r.Status, r.Detail = Skipped, "ICE TCP is served on HTTP_PORT or disabled"
+		return r
+	}
+	if d.inProcess {
+		r.Status, r.Detail = Skipped, fmt.Sprintf("port %d is held by this monitor", d.cfg.WebRTCICEPort)
+		return r
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", d.cfg.WebRTCICEPort))
+	if err != nil {
+		r.Status, r.Detail = Warn, fmt.Sprintf("port %d cannot be bound: %v", d.cfg.WebRTCICEPort, err)
+		r.Fix = "expected while the monitor runs; otherwise free the port or change WEBRTC_ICE_PORT"
+		return r
+	}
+	ln.Close()
+	r.Status, r.Detail = OK, fmt.Sprintf("port %d can be bound", d.cfg.WebRTCICEPort)
+	return r
+}
+
+func (d *Doctor) checkNAT(ctx context.Context) Result {
+	r := Result{Check: "nat_1to1_ip"}
+	if d.stunServer == "" {
+		r.Status, r.Detail = Skipped, "no STUN server configured to learn the public address"
+		return r
+	}
+	public, err := publicIP(ctx, d.stunServer)
+	if err != nil {
+		r.Status, r.Detail = Warn, fmt.Sprintf("STUN server %s did not answer: %v", d.stunServer, err)
+		r.Fix = "allow outgoing UDP to the STUN server or pick another one"
+		return r
+	}
+	configured := d.cfg.WebRTCNAT1To1IPs
+	switch {
+	case slices.Contains(configured, public.String()):
+		r.Status, r.Detail = OK, fmt.Sprintf("public address %s is in WEBRTC_NAT_1TO1_IPS", public)
+	case len(configured) == 0 && localIP(public):
+		r.Status, r.Detail = OK, fmt.Sprintf("public address %s is local, no NAT", public)
+	case len(configured) == 0:
+		r.Status, r.Detail = Warn, fmt.Sprintf("behind NAT with public address %s and no WEBRTC_NAT_1TO1_IPS", public)
+		r.Fix = fmt.Sprintf("set WEBRTC_NAT_1TO1_IPS=%s if browsers connect from outside this network", public)
+	default:
+		r.Status, r.Detail = Fail, fmt.Sprintf("public address %s is not in WEBRTC_NAT_1TO1_IPS (%s)", public, strings.Join(configured, ","))
+		r.Fix = fmt.Sprintf("set WEBRTC_NAT_1TO1_IPS=%s, browsers are sent candidates they cannot reach", public)
+	}
+	return r
+}
+
+// publicIP asks the STUN server at addr for the address it sees us at.
+func publicIP(ctx context.Context, addr string) (net.IP, error) {
+	var dialer net.Dialer
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	if _, err := conn.Write(req.Raw); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		res := &stun.Message{Raw: buf[:n]}
+		if res.Decode() != nil || res.TransactionID != req.TransactionID {
+			continue
+		}
+		var mapped stun.XORMappedAddress
+		if err := mapped.GetFrom(res); err != nil {
+			return nil, fmt.Errorf("no mapped address in STUN response: %w", err)
+		}
+		return mapped.IP, nil
+	}
+}
+
+// localIP reports whether ip is assigned to an interface of this host.
+func localIP(ip net.IP) bool {
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Doctor) checkDisks() []Result {
+	var results []Result
+	for _, dir := range d.dirs {
+		r := Result{Check: "disk " + dir}
+		if _, err := os.Stat(dir); err != nil {
+			r.Status, r.Detail = Skipped, "not present on this host"
+			results = append(results, r)
+			continue
+		}
+		free, err := freeSpace(dir)
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			r.Status, r.Detail = Skipped, "free space cannot be read on this platform"
+		case err != nil:
+			r.Status, r.Detail = Warn, fmt.Sprintf("free space cannot be read: %v", err)
+		case free < fullDisk:
+			r.Status, r.Detail = Fail, fmt.Sprintf("%s free", formatBytes(free))
+			r.Fix = "free space or move the directory; recordings and the store stop being written when it fills up"
+		case free < lowDisk:
+			r.Status, r.Detail = Warn, fmt.Sprintf("%s free", formatBytes(free))
+			r.Fix = "less than 1GiB left; free space or move the directory"
+		default:
+			r.Status, r.Detail = OK, fmt.Sprintf("%s free", formatBytes(free))
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func (d *Doctor) checkTelemetry(ctx context.Context) Result {
+	r := Result{Check: "telemetry"}
+	if d.cfg.TelemetryEndpoint == "" {
+		r.Status, r.Detail = Skipped, "OTEL_EXPORTER_OTLP_ENDPOINT is not set"
+		return r
+	}
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", d.cfg.TelemetryEndpoint)
+	if err != nil {
+		r.Status, r.Detail = Fail, fmt.Sprintf("%s is not reachable: %v", d.cfg.TelemetryEndpoint, err)
+		r.Fix = "check OTEL_EXPORTER_OTLP_ENDPOINT (host:port of the OTLP/HTTP receiver, usually 4318) and that the collector runs"
+		return r
+	}
+	conn.Close()
+	r.Status, r.Detail = OK, fmt.Sprintf("%s accepts connections", d.cfg.TelemetryEndpoint)
+	return r
+}
+
+// Dirs returns the directories the monitor writes to under cfg, besides the
+// recording paths of tenants: those of the log file, the state file and a
+// SQLite store.
+func Dirs(cfg *config.Config) []string {
+	var dirs []string
+	for _, file := range []string{cfg.LogFile, cfg.StateFile} {
+		if file != "" {
+			dirs = append(dirs, filepath.Dir(file))
+		}
+	}
+	if cfg.StoreDriver == "sqlite" && cfg.StoreDSN != "" {
+		dirs = append(dirs, filepath.Dir(strings.TrimPrefix(strings.SplitN(cfg.StoreDSN, "?", 2)[0], "file:")))
+	}
+	return dirs
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGiB", float64(n)/(1<<30))
+	default:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	}
+}
@@ -0,0 +1,90 @@
+package doctor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pion/stun/v3"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+// stunServer answers binding requests with mapped as the public address.
+func stunServer(t *testing.T, mapped net.IP) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+			if req.Decode() != nil {
+				continue
+			}
+			res := stun.MustBuild(req, stun.BindingSuccess, &stun.XORMappedAddress{IP: mapped, Port: 40000}, stun.Fingerprint)
+			conn.WriteTo(res.Raw, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestRun(t *testing.T) {
+	srv, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	client, err := rtpengine.NewClient(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	taken, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	port := uint16(taken.LocalAddr().(*net.UDPAddr).Port)
+
+	cfg := &config.Config{
+		RTPEngineAddr:    srv.Addr(),
+		WebRTCMinPort:    port,
+		WebRTCMaxPort:    port,
+		WebRTCNAT1To1IPs: []string{"198.51.100.7"},
+	}
+	results := New(cfg, client, WithSTUNServer(stunServer(t, net.ParseIP("203.0.113.9"))), WithDirs(t.TempDir(), "/nonexistent/recordings")).Run(context.Background())
+
+	want := map[string]Status{
+		"rtpengine":                    OK,
+		"ice_udp_ports":                Fail,
+		"ice_tcp_port":                 Skipped,
+		"nat_1to1_ip":                  Fail,
+		"disk /nonexistent/recordings": Skipped,
+		"telemetry":                    Skipped,
+	}
+	for _, r := range results {
+		if status, ok := want[r.Check]; ok && r.Status != status {
+			t.Errorf("%s = %s (%s), want %s", r.Check, r.Status, r.Detail, status)
+		}
+		if (r.Status == Fail || r.Status == Warn) && r.Fix == "" {
+			t.Errorf("%s: %s without a fix", r.Check, r.Status)
+		}
+	}
+	if len(results) != 7 {
+		t.Errorf("got %d results, want 7", len(results))
+	}
+	if !Failed(results) {
+		t.Error("Failed() = false, want true")
+	}
+}
@@ -0,0 +1,57 @@
+// Package logfile provides a log destination that can be reopened after an
+// external tool such as logrotate moved the file away.
+package logfile
+
+import (
+	"os"
+	"sync"
+)
+
+// File is an append-only log file safe for concurrent writes.
+type File struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens path for appending, creating it if needed.
+func Open(path string) (*File, error) {
+	f, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &File{path: path, f: f}, nil
+}
+
+func open(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+}
+
+func (l *File) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// Reopen closes the current file and opens path again.
+func (l *File) Reopen() error {
+	f, err := open(l.path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	old := l.f
+	l.f = f
+	l.mu.Unlock()
+
+	return old.Close()
+}
+
+// Close closes the underlying file.
+func (l *File) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
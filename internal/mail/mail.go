@@ -0,0 +1,269 @@
+// Package mail delivers alerts by email, for teams without chatops. Alerts
+// are collected over an aggregation window and sent as one digest, and
+// digests are rate limited so an alert storm does not flood inboxes.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// sendTimeout bounds the delivery of one digest.
+	sendTimeout = 30 * time.Second
+	// maxPending bounds the alerts listed in a digest; later ones are only
+	// counted.
+	maxPending = 100
+)
+
+// Alert is one event worth telling operators about.
+type Alert struct {
+	// Kind names the event, such as "rtpengine.down" or "watch.match".
+	Kind    string    `json:"kind"`
+	Summary string    `json:"summary"`
+	CallID  string    `json:"call_id,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Digest is the data the template renders: the alerts of a window, and of
+// the windows before it that the rate limit held back.
+type Digest struct {
+	Alerts []Alert
+	// Dropped counts the alerts beyond the listed ones.
+	Dropped  int
+	Instance string
+	Labels   map[string]string
+}
+
+// DefaultTemplate renders digests unless a template file replaces it. It
+// defines a "subject" and a "body" template.
+const DefaultTemplate = `{{define "subject"}}[rtpengine-mon{{with .Instance}} {{.}}{{end}}] {{len .Alerts}} alert{{if ne (len .Alerts) 1}}s{{end}}{{with (index .Alerts 0)}}: {{.Summary}}{{end}}{{end}}
+{{define "body"}}{{range .Alerts}}{{.Time.Format "2006-01-02 15:04:05 MST"}}  {{.Kind}}  {{.Summary}}{{with .CallID}} (call {{.}}){{end}}
+{{end}}{{if .Dropped}}
+{{.Dropped}} more alerts were not listed.
+{{end}}{{with .Labels}}
+Labels:{{range $k, $v := .}} {{$k}}={{$v}}{{end}}
+{{end}}{{end}}`
+
+// ParseTemplate parses the template file at path over DefaultTemplate, so
+// it may redefine only the subject or only the body.
+func ParseTemplate(path string) (*template.Template, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := template.Must(template.New("mail").Parse(DefaultTemplate))
+	if _, err := tmpl.Parse(string(body)); err != nil {
+		return nil, fmt.Errorf("email template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Mailer collects alerts and sends them as digests.
+type Mailer struct {
+	addr       string
+	from       string
+	to         []string
+	auth       smtp.Auth
+	window     time.Duration
+	maxPerHour int
+	tmpl       *template.Template
+	instance   string
+	labels     map[string]string
+
+	mu      sync.Mutex
+	pending []Alert
+	dropped int
+	sent    []time.Time
+}
+
+// Option configures a Mailer.
+type Option func(*Mailer)
+
+// WithAuth authenticates with PLAIN, which net/smtp only allows over TLS or
+// to localhost.
+func WithAuth(username, password string) Option {
+	return func(m *Mailer) {
+		host, _, _ := net.SplitHostPort(m.addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+}
+
+// WithWindow sets how long alerts are collected into one digest.
+func WithWindow(d time.Duration) Option {
+	return func(m *Mailer) { m.window = d }
+}
+
+// WithRateLimit sends at most n digests an hour; zero removes the limit.
+func WithRateLimit(n int) Option {
+	return func(m *Mailer) { m.maxPerHour = n }
+}
+
+// WithTemplate renders digests with tmpl, which defines "subject" and
+// "body".
+func WithTemplate(tmpl *template.Template) Option {
+	return func(m *Mailer) { m.tmpl = tmpl }
+}
+
+// WithInstance names the monitor in digests.
+func WithInstance(instance string, labels map[string]string) Option {
+	return func(m *Mailer) { m.instance, m.labels = instance, labels }
+}
+
+// New creates a Mailer sending through the SMTP server at addr, host:port,
+// from the address from to the addresses to.
+func New(addr, from string, to []string, opts ...Option) *Mailer {
+	m := &Mailer{
+		addr:   addr,
+		from:   from,
+		to:     to,
+		window: time.Minute,
+		tmpl:   template.Must(template.New("mail").Parse(DefaultTemplate)),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Notify queues alert for the next digest.
+func (m *Mailer) Notify(alert Alert) {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.pending) >= maxPending {
+		m.dropped++
+		return
+	}
+	m.pending = append(m.pending, alert)
+}
+
+// Run sends the alerts collected every window until ctx is cancelled.
+func (m *Mailer) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := m.flush(now); err != nil {
+				log.Printf("Mail: %v", err)
+			}
+		}
+	}
+}
+
+// flush sends the pending alerts unless the rate limit is reached, in which
+// case they wait for a later window. A digest that fails to send is
+// dropped, so a broken server does not make digests grow.
+func (m *Mailer) flush(now time.Time) error {
+	m.mu.Lock()
+	if len(m.pending) == 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	sent := m.sent[:0]
+	for _, t := range m.sent {
+		if now.Sub(t) < time.Hour {
+			sent = append(sent, t)
+		}
+	}
+	m.sent = sent
+	if m.maxPerHour > 0 && len(m.sent) >= m.maxPerHour {
+		m.mu.Unlock()
+		return nil
+	}
+	digest := Digest{Alerts: m.pending, Dropped: m.dropped, Instance: m.instance, Labels: m.labels}
+	m.pending, m.dropped = nil, 0
+	m.sent = append(m.sent, now)
+	m.mu.Unlock()
+
+	msg, err := m.render(digest, now)
+	if err != nil {
+		return err
+	}
+	if err := m.send(msg); err != nil {
+		return fmt.Errorf("failed to send %d alerts: %w", len(digest.Alerts)+digest.Dropped, err)
+	}
+	return nil
+}
+
+func (m *Mailer) render(digest Digest, now time.Time) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := m.tmpl.ExecuteTemplate(&subject, "subject", digest); err != nil {
+		return nil, fmt.Errorf("email template: %w", err)
+	}
+	if err := m.tmpl.ExecuteTemplate(&body, "body", digest); err != nil {
+		return nil, fmt.Errorf("email template: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body.String(), "\r\n", "\n"), "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
+
+// send delivers msg as smtp.SendMail does, upgrading to TLS when the server
+// offers it, but within sendTimeout.
+func (m *Mailer) send(msg []byte) error {
+	conn, err := net.DialTimeout("tcp", m.addr, sendTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+	host, _, _ := net.SplitHostPort(m.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.auth != nil {
+		if err := c.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.from); err != nil {
+		return err
+	}
+	for _, rcpt := range m.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
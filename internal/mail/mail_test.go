@@ -0,0 +1,140 @@
+package mail
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts mail and hands each message to the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	messages := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				conn.Write([]byte("220 fake ESMTP\r\n"))
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						conn.Write([]byte("250 fake\r\n"))
+					case cmd == "DATA":
+						conn.Write([]byte("354 go ahead\r\n"))
+						var msg strings.Builder
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil || line == ".\r\n" {
+								break
+							}
+							msg.WriteString(line)
+						}
+						messages <- msg.String()
+						conn.Write([]byte("250 queued\r\n"))
+					case cmd == "QUIT":
+						conn.Write([]byte("221 bye\r\n"))
+						return
+					default:
+						conn.Write([]byte("250 ok\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return lis.Addr().String(), messages
+}
+
+func TestDigest(t *testing.T) {
+	addr, messages := fakeSMTP(t)
+	m := New(addr, "mon@example.com", []string{"noc@example.com"}, WithInstance("mon-1", nil))
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.Notify(Alert{Kind: "rtpengine.down", Summary: "rtpengine unreachable", Time: now})
+	m.Notify(Alert{Kind: "watch.match", Summary: "watch w1 matched", CallID: "c1", Time: now})
+
+	if err := m.flush(now); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-messages
+	for _, want := range []string{
+		"To: noc@example.com\r\n",
+		"Subject: [rtpengine-mon mon-1] 2 alerts: rtpengine unreachable\r\n",
+		"rtpengine.down  rtpengine unreachable\r\n",
+		"watch w1 matched (call c1)\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+
+	if err := m.flush(now); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-messages:
+		t.Errorf("sent an empty digest:\n%s", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	addr, messages := fakeSMTP(t)
+	m := New(addr, "mon@example.com", []string{"noc@example.com"}, WithRateLimit(1))
+	now := time.Now()
+	m.Notify(Alert{Kind: "slo", Summary: "first"})
+	if err := m.flush(now); err != nil {
+		t.Fatal(err)
+	}
+	<-messages
+
+	m.Notify(Alert{Kind: "slo", Summary: "second"})
+	m.flush(now.Add(time.Minute))
+	select {
+	case msg := <-messages:
+		t.Fatalf("sent over the rate limit:\n%s", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The held back alert goes out with the next one once the hour passed.
+	m.Notify(Alert{Kind: "slo", Summary: "third"})
+	if err := m.flush(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-messages; !strings.Contains(msg, "second") || !strings.Contains(msg, "third") {
+		t.Errorf("message lacks the held back alert:\n%s", msg)
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alert.tmpl")
+	os.WriteFile(path, []byte(`{{define "subject"}}NOC: {{len .Alerts}}{{end}}`), 0o644)
+	tmpl, err := ParseTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New("localhost:25", "mon@example.com", []string{"noc@example.com"}, WithTemplate(tmpl))
+	msg, err := m.render(Digest{Alerts: []Alert{{Kind: "slo", Summary: "burning"}}}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(msg), "Subject: NOC: 1\r\n") || !strings.Contains(string(msg), "burning") {
+		t.Errorf("message = %s", msg)
+	}
+}
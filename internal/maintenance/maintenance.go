@@ -0,0 +1,133 @@
+// Package maintenance keeps the windows during which alerts and automatic
+// recordings are suppressed, so planned rtpengine maintenance does not page
+// anyone or fill disks with recordings of test calls.
+package maintenance
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// KindRecording is the kind of the recordings started by watches and
+// automation scripts, next to the kinds of alerts such as "quality.alert".
+const KindRecording = "recording"
+
+// Window suppresses what it matches between Start and End. Its filters are
+// globs, as in path.Match; an empty filter matches everything.
+type Window struct {
+	ID     string    `json:"id"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason,omitempty"`
+	// Kinds are the alert kinds suppressed, or KindRecording.
+	Kinds []string `json:"kinds,omitempty"`
+	// Instances are the rtpengine instances under maintenance. Alerts tied
+	// to no instance are only suppressed by windows without this filter.
+	Instances []string `json:"instances,omitempty"`
+	CallIDs   []string `json:"call_ids,omitempty"`
+}
+
+// Validate reports what is wrong with a window.
+func (w Window) Validate() error {
+	if w.Start.IsZero() || w.End.IsZero() {
+		return fmt.Errorf("start and end are required")
+	}
+	if !w.End.After(w.Start) {
+		return fmt.Errorf("end must be after start")
+	}
+	for _, p := range slices.Concat(w.Kinds, w.Instances, w.CallIDs) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// Subject is something a window may suppress.
+type Subject struct {
+	Kind     string
+	Instance string
+	CallID   string
+}
+
+func (w Window) covers(s Subject, now time.Time) bool {
+	if now.Before(w.Start) || !now.Before(w.End) {
+		return false
+	}
+	return matches(w.Kinds, s.Kind) && matches(w.Instances, s.Instance) && matches(w.CallIDs, s.CallID)
+}
+
+func matches(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Schedule holds the windows. They live in memory and do not survive
+// restarts.
+type Schedule struct {
+	mu      sync.Mutex
+	windows map[string]Window
+}
+
+func NewSchedule() *Schedule {
+	return &Schedule{windows: make(map[string]Window)}
+}
+
+// Add schedules w, which must be valid and have an ID.
+func (s *Schedule) Add(w Window) {
+	s.mu.Lock()
+	s.windows[w.ID] = w
+	s.mu.Unlock()
+}
+
+// Remove ends a window early or cancels it.
+func (s *Schedule) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.windows[id]
+	delete(s.windows, id)
+	return ok
+}
+
+// Windows returns the windows that have not ended, by start time. Ended
+// ones are dropped.
+func (s *Schedule) Windows(now time.Time) []Window {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	windows := make([]Window, 0, len(s.windows))
+	for id, w := range s.windows {
+		if !now.Before(w.End) {
+			delete(s.windows, id)
+			continue
+		}
+		windows = append(windows, w)
+	}
+	slices.SortFunc(windows, func(a, b Window) int { return a.Start.Compare(b.Start) })
+	return windows
+}
+
+// Suppressed returns the window suppressing subject at now, if any. A nil
+// Schedule suppresses nothing.
+func (s *Schedule) Suppressed(subject Subject, now time.Time) (Window, bool) {
+	if s == nil {
+		return Window{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.windows {
+		if w.covers(subject, now) {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
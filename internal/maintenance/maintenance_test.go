@@ -0,0 +1,55 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuppressed(t *testing.T) {
+	start := time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)
+	s := NewSchedule()
+	s.Add(Window{ID: "w1", Start: start, End: start.Add(2 * time.Hour), Instances: []string{"node-1"}})
+	s.Add(Window{ID: "w2", Start: start, End: start.Add(time.Hour), Kinds: []string{"quality.*"}, CallIDs: []string{"test-*"}})
+
+	for _, tc := range []struct {
+		subject Subject
+		at      time.Duration
+		want    string
+	}{
+		{Subject{Kind: "quality.alert", Instance: "node-1", CallID: "c1"}, time.Hour, "w1"},
+		{Subject{Kind: KindRecording, Instance: "node-1", CallID: "c1"}, -time.Minute, ""},
+		{Subject{Kind: KindRecording, Instance: "node-1", CallID: "c1"}, 2 * time.Hour, ""},
+		{Subject{Kind: "rtpengine.down"}, time.Minute, ""},
+		{Subject{Kind: "quality.alert", CallID: "test-1"}, time.Minute, "w2"},
+		{Subject{Kind: KindRecording, CallID: "test-1"}, time.Minute, ""},
+	} {
+		w, ok := s.Suppressed(tc.subject, start.Add(tc.at))
+		if got := w.ID; ok != (tc.want != "") || got != tc.want {
+			t.Errorf("Suppressed(%+v) at +%s = %q, %v, want %q", tc.subject, tc.at, got, ok, tc.want)
+		}
+	}
+
+	if windows := s.Windows(start.Add(90 * time.Minute)); len(windows) != 1 || windows[0].ID != "w1" {
+		t.Errorf("Windows() = %+v, want the unfinished w1", windows)
+	}
+	if !s.Remove("w1") || s.Remove("w1") {
+		t.Error("Remove() did not remove w1 once")
+	}
+	var nilSchedule *Schedule
+	if _, ok := nilSchedule.Suppressed(Subject{Kind: "slo"}, start); ok {
+		t.Error("nil schedule suppressed an alert")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	for _, w := range []Window{
+		{End: now},
+		{Start: now, End: now},
+		{Start: now, End: now.Add(time.Hour), CallIDs: []string{"["}},
+	} {
+		if err := w.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", w)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package natspub
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublisher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	type received struct {
+		connect string
+		subject string
+		header  string
+		data    string
+	}
+	got := make(chan received, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(`INFO {"server_id":"test","headers":true}` + "\r\n"))
+
+		r := bufio.NewReader(conn)
+		var msg received
+		msg.connect, _ = r.ReadString('\n')
+		r.ReadString('\n') // PING
+		conn.Write([]byte("PONG\r\n"))
+
+		line, _ := r.ReadString('\n')
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[0] != "HPUB" {
+			t.Errorf("unexpected publish line %q", line)
+			return
+		}
+		hdrLen, _ := strconv.Atoi(fields[2])
+		total, _ := strconv.Atoi(fields[3])
+		body := make([]byte, total+2)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Errorf("reading body: %v", err)
+			return
+		}
+		msg.subject, msg.header, msg.data = fields[1], string(body[:hdrLen]), string(body[hdrLen:total])
+		got <- msg
+	}()
+
+	p, err := New("nats://token@"+ln.Addr().String(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx, nil)
+
+	p.Publish("rtpengine.pcm.from", Header{"Call-Id": "c1\r\nX: y"}, []byte{1, 2, 3, 4})
+
+	select {
+	case msg := <-got:
+		if !strings.Contains(msg.connect, `"auth_token":"token"`) || !strings.Contains(msg.connect, `"headers":true`) {
+			t.Errorf("CONNECT = %q", msg.connect)
+		}
+		if msg.subject != "rtpengine.pcm.from" {
+			t.Errorf("subject = %q", msg.subject)
+		}
+		if msg.header != "NATS/1.0\r\nCall-Id: c1  X: y\r\n\r\n" {
+			t.Errorf("header = %q", msg.header)
+		}
+		if msg.data != "\x01\x02\x03\x04" {
+			t.Errorf("data = %q", msg.data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func TestPublishDropsWhenFull(t *testing.T) {
+	p, err := New("nats://127.0.0.1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.url.Host != "127.0.0.1:4222" {
+		t.Errorf("host = %q, want default port", p.url.Host)
+	}
+	if !p.Publish("a", nil, nil) || p.Publish("a", nil, nil) {
+		t.Error("expected the second message to be dropped")
+	}
+	if _, dropped := p.Stats(); dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+}
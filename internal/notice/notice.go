@@ -0,0 +1,272 @@
+// Package notice tells the agent on a call when audio starts and stops
+// being played into one of its legs, e.g. a supervisor's bot whispering or
+// an announcement, as works-council agreements require. Notices go to a
+// webhook as JSON and to a SIP user agent as a SIP MESSAGE.
+package notice
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+// sendTimeout bounds the delivery of one notice.
+const sendTimeout = 5 * time.Second
+
+// maxPending bounds the notices queued while delivery falls behind; later
+// notices are dropped until it catches up.
+const maxPending = 1024
+
+// Sources of injected audio.
+const (
+	SourceBot          = "bot"
+	SourceAnnouncement = "announcement"
+	SourceConsent      = "consent"
+)
+
+// Notice reports audio injected into a leg starting or stopping. Type is
+// catalog.EventInjectionStart or catalog.EventInjectionStop; Leg is "from",
+// "to" or, for consent announcements played to every leg, a leg's tag.
+type Notice struct {
+	Type   string    `json:"type"`
+	CallID string    `json:"call_id"`
+	Leg    string    `json:"leg"`
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+}
+
+// sourceNames name the sources in the messages shown to agents.
+var sourceNames = map[string]string{
+	SourceBot:          "Bot audio",
+	SourceAnnouncement: "Announcement",
+	SourceConsent:      "Recording announcement",
+}
+
+// text is the message shown to the agent.
+func (n Notice) text() string {
+	name, ok := sourceNames[n.Source]
+	if !ok {
+		name = "Audio"
+	}
+	if n.Type == string(catalog.EventInjectionStop) {
+		return name + " ended: nothing is played into your call anymore."
+	}
+	return name + " is being played into your call."
+}
+
+// Notifier delivers notices in the background, one at a time in the order
+// they happened, so an agent never hears of audio ending before it started.
+// Failures are logged.
+type Notifier struct {
+	webhook string
+	sipURI  string
+	sipAddr string
+	client  *http.Client
+
+	mu       sync.Mutex
+	queue    []Notice
+	draining bool
+}
+
+// New creates a Notifier posting to webhook and sending SIP MESSAGEs to
+// sipURI, such as "sip:agent-notify@pbx.example.com:5060" over UDP. Either
+// may be empty.
+func New(webhook, sipURI string) (*Notifier, error) {
+	n := &Notifier{webhook: webhook, client: &http.Client{Timeout: sendTimeout}}
+	if sipURI != "" {
+		addr, err := sipTarget(sipURI)
+		if err != nil {
+			return nil, err
+		}
+		n.sipURI, n.sipAddr = sipURI, addr
+	}
+	return n, nil
+}
+
+// sipTarget returns the host:port a sip: URI is sent to.
+func sipTarget(uri string) (string, error) {
+	rest, ok := strings.CutPrefix(uri, "sip:")
+	if !ok {
+		return "", fmt.Errorf("invalid SIP URI %q: want sip:user@host[:port]", uri)
+	}
+	if i := strings.IndexByte(rest, ';'); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndexByte(rest, '@'); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if rest == "" {
+		return "", fmt.Errorf("invalid SIP URI %q: no host", uri)
+	}
+	if _, _, err := net.SplitHostPort(rest); err != nil {
+		rest = net.JoinHostPort(rest, "5060")
+	}
+	return rest, nil
+}
+
+// Started notices that source started playing audio into leg of a call.
+func (n *Notifier) Started(callID, leg, source string) {
+	n.notify(Notice{Type: string(catalog.EventInjectionStart), CallID: callID, Leg: leg, Source: source})
+}
+
+// Stopped notices that the audio source played into leg ended.
+func (n *Notifier) Stopped(callID, leg, source string) {
+	n.notify(Notice{Type: string(catalog.EventInjectionStop), CallID: callID, Leg: leg, Source: source})
+}
+
+// StoppedAfter notices the end of audio known to play for d.
+func (n *Notifier) StoppedAfter(d time.Duration, callID, leg, source string) {
+	time.AfterFunc(d, func() { n.Stopped(callID, leg, source) })
+}
+
+// notify queues a notice, starting a goroutine to deliver the queue unless
+// one is running. It is a no-op on a nil Notifier, so callers need not
+// check. Notices carry the real call ID even in anonymized mode: the PBX
+// and agent clients route them by it.
+func (n *Notifier) notify(notice Notice) {
+	if n == nil {
+		return
+	}
+	notice.Time = time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.queue) >= maxPending {
+		log.Printf("Agent notice %s of call %s dropped: %d pending", notice.Type, redact.CallID(notice.CallID), len(n.queue))
+		return
+	}
+	n.queue = append(n.queue, notice)
+	if !n.draining {
+		n.draining = true
+		go n.drain()
+	}
+}
+
+func (n *Notifier) drain() {
+	for {
+		n.mu.Lock()
+		if len(n.queue) == 0 {
+			n.draining = false
+			n.mu.Unlock()
+			return
+		}
+		notice := n.queue[0]
+		n.queue = n.queue[1:]
+		n.mu.Unlock()
+
+		n.deliver(notice)
+	}
+}
+
+func (n *Notifier) deliver(notice Notice) {
+	if n.webhook != "" {
+		if err := n.post(notice); err != nil {
+			log.Printf("Agent notice %s of call %s to webhook: %v", notice.Type, redact.CallID(notice.CallID), err)
+		}
+	}
+	if n.sipAddr != "" {
+		if err := n.message(notice); err != nil {
+			log.Printf("Agent notice %s of call %s by SIP MESSAGE to %s: %v", notice.Type, redact.CallID(notice.CallID), n.sipURI, err)
+		}
+	}
+}
+
+func (n *Notifier) post(notice Notice) error {
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// message sends notice as a SIP MESSAGE (RFC 3428) over UDP and waits for
+// the final response, without retransmitting.
+func (n *Notifier) message(notice Notice) error {
+	conn, err := net.Dial("udp", n.sipAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	local := conn.LocalAddr().String()
+	body := notice.text()
+	var req strings.Builder
+	fmt.Fprintf(&req, "MESSAGE %s SIP/2.0\r\n", n.sipURI)
+	fmt.Fprintf(&req, "Via: SIP/2.0/UDP %s;branch=z9hG4bK%s;rport\r\n", local, token())
+	req.WriteString("Max-Forwards: 70\r\n")
+	fmt.Fprintf(&req, "From: <sip:rtpengine-mon@%s>;tag=%s\r\n", local, token())
+	fmt.Fprintf(&req, "To: <%s>\r\n", n.sipURI)
+	fmt.Fprintf(&req, "Call-ID: %s@rtpengine-mon\r\n", token())
+	req.WriteString("CSeq: 1 MESSAGE\r\n")
+	// The PBX routes the notice to the agent on the call by these.
+	fmt.Fprintf(&req, "X-RTPEngine-Call-ID: %s\r\n", notice.CallID)
+	fmt.Fprintf(&req, "X-RTPEngine-Leg: %s\r\n", notice.Leg)
+	fmt.Fprintf(&req, "X-RTPEngine-Event: %s\r\n", notice.Type)
+	req.WriteString("Content-Type: text/plain;charset=utf-8\r\n")
+	fmt.Fprintf(&req, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	if _, err := conn.Write([]byte(req.String())); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		size, err := conn.Read(buf)
+		if err != nil {
+			return fmt.Errorf("no final response: %w", err)
+		}
+		code, status := statusOf(buf[:size])
+		if code >= 200 && code < 300 {
+			return nil
+		}
+		if code >= 300 {
+			return fmt.Errorf("rejected: %s", status)
+		}
+		// 1xx responses are provisional.
+	}
+}
+
+// statusOf parses the status line of a SIP response.
+func statusOf(resp []byte) (int, string) {
+	line, _, _ := strings.Cut(string(resp), "\r\n")
+	status, ok := strings.CutPrefix(line, "SIP/2.0 ")
+	if !ok {
+		return 0, line
+	}
+	code, _ := strconv.Atoi(strings.SplitN(status, " ", 2)[0])
+	return code, status
+}
+
+func token() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
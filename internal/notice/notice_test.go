@@ -0,0 +1,132 @@
+package notice
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	posted := make(chan Notice, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notice
+		json.NewDecoder(r.Body).Decode(&n)
+		posted <- n
+	}))
+	defer hook.Close()
+
+	// A SIP user agent answering with a provisional then a final response.
+	ua, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ua.Close()
+	messages := make(chan string, 2)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			size, addr, err := ua.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			messages <- string(buf[:size])
+			ua.WriteTo([]byte("SIP/2.0 100 Trying\r\n\r\n"), addr)
+			ua.WriteTo([]byte("SIP/2.0 202 Accepted\r\n\r\n"), addr)
+		}
+	}()
+
+	n, err := New(hook.URL, "sip:agent@"+ua.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Started("call-1", "to", SourceBot)
+	n.StoppedAfter(10*time.Millisecond, "call-1", "to", SourceBot)
+
+	for _, want := range []string{"injection.start", "injection.stop"} {
+		select {
+		case got := <-posted:
+			if got.Type != want || got.CallID != "call-1" || got.Leg != "to" || got.Source != SourceBot {
+				t.Errorf("webhook notice = %+v, want %s", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s not posted", want)
+		}
+		select {
+		case msg := <-messages:
+			if !strings.HasPrefix(msg, "MESSAGE sip:agent@") || !strings.Contains(msg, "X-RTPEngine-Event: "+want) || !strings.Contains(msg, "X-RTPEngine-Call-ID: call-1") {
+				t.Errorf("SIP MESSAGE = %q", msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s not sent as a SIP MESSAGE", want)
+		}
+	}
+
+	var none *Notifier
+	none.Started("call-1", "to", SourceBot)
+}
+
+// Notices of a call arrive in the order they happened, even when the
+// target is slower to take the first one.
+func TestNotifierOrder(t *testing.T) {
+	posted := make(chan string, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notice
+		json.NewDecoder(r.Body).Decode(&n)
+		if n.Type == "injection.start" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		posted <- n.Type
+	}))
+	defer hook.Close()
+
+	n, err := New(hook.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Started("call-1", "to", SourceAnnouncement)
+	n.Stopped("call-1", "to", SourceAnnouncement)
+
+	for _, want := range []string{"injection.start", "injection.stop"} {
+		select {
+		case got := <-posted:
+			if got != want {
+				t.Fatalf("webhook got %s, want %s", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s not posted", want)
+		}
+	}
+}
+
+func TestNoticeText(t *testing.T) {
+	for _, tt := range []struct {
+		source, event, want string
+	}{
+		{SourceBot, "injection.start", "Bot audio is being played into your call."},
+		{SourceAnnouncement, "injection.start", "Announcement is being played into your call."},
+		{SourceConsent, "injection.stop", "Recording announcement ended: nothing is played into your call anymore."},
+	} {
+		if got := (Notice{Type: tt.event, Source: tt.source}).text(); got != tt.want {
+			t.Errorf("text(%s, %s) = %q, want %q", tt.source, tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestSIPTarget(t *testing.T) {
+	for uri, want := range map[string]string{
+		"sip:agent@pbx.example.com":             "pbx.example.com:5060",
+		"sip:agent@10.0.0.1:5080;transport=udp": "10.0.0.1:5080",
+		"sip:pbx.example.com":                   "pbx.example.com:5060",
+	} {
+		if got, err := sipTarget(uri); err != nil || got != want {
+			t.Errorf("sipTarget(%q) = %q, %v, want %q", uri, got, err, want)
+		}
+	}
+	if _, err := New("", "tel:+4930123"); err == nil {
+		t.Error("New() accepted a tel: URI")
+	}
+}
@@ -0,0 +1,263 @@
+// Package probe runs synthetic end-to-end checks: it creates a call on
+// rtpengine with local RTP endpoints, spies on it through the spy service
+// like a browser would, and measures the time until audio arrives.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// Result describes one probe run.
+type Result struct {
+	CallID  string
+	Latency time.Duration
+}
+
+// Probe creates, spies and tears down synthetic calls.
+type Probe struct {
+	rtpClient  rtpengine.Client
+	spyService *spy.Service
+	localIP    net.IP
+	timeout    time.Duration
+
+	runs    metric.Int64Counter
+	latency metric.Float64Histogram
+}
+
+// New creates a probe sending media from localIP, which rtpengine must be able
+// to reach.
+func New(rtpClient rtpengine.Client, spyService *spy.Service, localIP net.IP, timeout time.Duration) *Probe {
+	meter := otel.Meter("probe")
+	runs, _ := meter.Int64Counter("probe.runs_total", metric.WithDescription("Synthetic probe runs by result"))
+	latency, _ := meter.Float64Histogram("probe.latency_ms", metric.WithDescription("Time from spy start to first audio packet"))
+
+	return &Probe{
+		rtpClient:  rtpClient,
+		spyService: spyService,
+		localIP:    localIP,
+		timeout:    timeout,
+		runs:       runs,
+		latency:    latency,
+	}
+}
+
+// Run probes every interval until ctx is cancelled.
+func (p *Probe) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if res, err := p.RunOnce(ctx); err != nil {
+			log.Printf("probe: call %s failed: %v", redact.CallID(res.CallID), err)
+		} else {
+			log.Printf("probe: call %s ok, first audio after %s", redact.CallID(res.CallID), res.Latency)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce performs a single end-to-end probe.
+func (p *Probe) RunOnce(ctx context.Context) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	res := Result{CallID: "probe-" + uuid.New().String()}
+	latency, err := p.run(ctx, res.CallID)
+	res.Latency = latency
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	} else {
+		p.latency.Record(ctx, float64(latency.Milliseconds()))
+	}
+	p.runs.Add(ctx, 1, metric.WithAttributes(attribute.String("result", outcome)))
+	return res, err
+}
+
+func (p *Probe) run(ctx context.Context, callID string) (time.Duration, error) {
+	fromTag, toTag := uuid.New().String(), uuid.New().String()
+
+	caller, err := net.ListenUDP("udp", &net.UDPAddr{IP: p.localIP})
+	if err != nil {
+		return 0, err
+	}
+	defer caller.Close()
+	callee, err := net.ListenUDP("udp", &net.UDPAddr{IP: p.localIP})
+	if err != nil {
+		return 0, err
+	}
+	defer callee.Close()
+
+	offer, err := p.rtpClient.Offer(ctx, callID, fromTag, endpointSDP(caller), rtpengine.MediaOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("offer: %w", err)
+	}
+	defer p.rtpClient.Delete(context.Background(), callID, rtpengine.DeleteOptions{})
+
+	answer, err := p.rtpClient.Answer(ctx, callID, fromTag, toTag, endpointSDP(callee), rtpengine.MediaOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("answer: %w", err)
+	}
+
+	// rtpengine's offer reply is what the callee talks to and vice versa.
+	calleeTarget, err := mediaAddr(offer)
+	if err != nil {
+		return 0, fmt.Errorf("offer reply: %w", err)
+	}
+	callerTarget, err := mediaAddr(answer)
+	if err != nil {
+		return 0, fmt.Errorf("answer reply: %w", err)
+	}
+
+	mediaCtx, stopMedia := context.WithCancel(ctx)
+	defer stopMedia()
+	go sendMedia(mediaCtx, caller, callerTarget)
+	go sendMedia(mediaCtx, callee, calleeTarget)
+
+	start := time.Now()
+	if err := p.listen(ctx, callID, fromTag, toTag); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// listen joins the call as a browser would and waits for the first packet.
+func (p *Probe) listen(ctx context.Context, callID, fromTag, toTag string) error {
+	ctx = rtpengine.WithLabel(ctx, rtpengine.Label{Purpose: rtpengine.PurposeProbe})
+	sessionID, offerSDP, _, _, err := p.spyService.StartSpySession(ctx, callID, fromTag, toTag)
+	if err != nil {
+		return fmt.Errorf("spy: %w", err)
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	received := make(chan struct{}, 1)
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if _, _, err := track.ReadRTP(); err == nil {
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerSDP}); err != nil {
+		return err
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	<-webrtc.GatheringCompletePromise(pc)
+
+	if err := p.spyService.HandleSpyAnswer(ctx, sessionID, pc.LocalDescription().SDP); err != nil {
+		return fmt.Errorf("spy answer: %w", err)
+	}
+
+	select {
+	case <-received:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no audio received: %w", ctx.Err())
+	}
+}
+
+func endpointSDP(conn *net.UDPConn) string {
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	ip := addr.IP.String()
+	return "v=0\r\n" +
+		"o=- 1 1 IN IP4 " + ip + "\r\n" +
+		"s=rtpengine-mon probe\r\n" +
+		"c=IN IP4 " + ip + "\r\n" +
+		"t=0 0\r\n" +
+		"m=audio " + strconv.Itoa(addr.Port) + " RTP/AVP 0\r\n" +
+		"a=rtpmap:0 PCMU/8000\r\n" +
+		"a=sendrecv\r\n"
+}
+
+// mediaAddr extracts the audio address from an NG response SDP.
+func mediaAddr(resp map[string]interface{}) (*net.UDPAddr, error) {
+	raw, ok := resp["sdp"].(string)
+	if !ok {
+		return nil, fmt.Errorf("no sdp in response")
+	}
+
+	var desc sdp.SessionDescription
+	if err := desc.UnmarshalString(raw); err != nil {
+		return nil, err
+	}
+
+	for _, media := range desc.MediaDescriptions {
+		if media.MediaName.Media != "audio" {
+			continue
+		}
+		conn := desc.ConnectionInformation
+		if media.ConnectionInformation != nil {
+			conn = media.ConnectionInformation
+		}
+		if conn == nil || conn.Address == nil {
+			return nil, fmt.Errorf("no connection address in sdp")
+		}
+		return &net.UDPAddr{IP: net.ParseIP(conn.Address.Address), Port: media.MediaName.Port.Value}, nil
+	}
+	return nil, fmt.Errorf("no audio media in sdp")
+}
+
+// sendMedia streams 20ms PCMU packets of near-silence until ctx ends.
+func sendMedia(ctx context.Context, conn *net.UDPConn, target *net.UDPAddr) {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	pkt := rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 0, SSRC: uuid.New().ID()},
+		Payload: make([]byte, 160),
+	}
+	for i := range pkt.Payload {
+		pkt.Payload[i] = 0xFE
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pkt.SequenceNumber++
+			pkt.Timestamp += 160
+			buf, err := pkt.Marshal()
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf, target)
+		}
+	}
+}
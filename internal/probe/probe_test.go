@@ -0,0 +1,32 @@
+package probe
+
+import "testing"
+
+func TestMediaAddr(t *testing.T) {
+	resp := map[string]interface{}{
+		"sdp": "v=0\r\no=- 1 1 IN IP4 10.0.0.1\r\ns=-\r\nc=IN IP4 10.0.0.1\r\nt=0 0\r\n" +
+			"m=audio 30000 RTP/AVP 0\r\nc=IN IP4 10.0.0.2\r\na=rtpmap:0 PCMU/8000\r\n",
+	}
+
+	addr, err := mediaAddr(resp)
+	if err != nil {
+		t.Fatalf("mediaAddr() error = %v", err)
+	}
+	if addr.String() != "10.0.0.2:30000" {
+		t.Errorf("expected media-level address 10.0.0.2:30000, got %s", addr)
+	}
+
+	if _, err := mediaAddr(map[string]interface{}{}); err == nil {
+		t.Error("expected error without sdp")
+	}
+}
+
+func FuzzMediaAddr(f *testing.F) {
+	f.Add("v=0\r\no=- 1 1 IN IP4 10.0.0.1\r\ns=-\r\nc=IN IP4 10.0.0.1\r\nt=0 0\r\nm=audio 30000 RTP/AVP 0\r\n")
+	f.Add("v=0\r\ns=-\r\nt=0 0\r\nm=audio 30000 RTP/AVP 0\r\n")
+	f.Add("v=0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\n")
+
+	f.Fuzz(func(t *testing.T, sdp string) {
+		mediaAddr(map[string]interface{}{"sdp": sdp})
+	})
+}
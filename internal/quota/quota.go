@@ -0,0 +1,257 @@
+// Package quota tracks API requests and spy minutes per principal, tenant and
+// globally, and enforces limits on them over fixed windows.
+package quota
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Global is the account every request is counted against.
+const Global = "global"
+
+// Limits caps usage per window. Zero leaves a resource unlimited.
+type Limits struct {
+	Requests   int64   `json:"requests"`
+	SpyMinutes float64 `json:"spy_minutes"`
+}
+
+// ExceededError is returned when an account has used up a quota.
+type ExceededError struct {
+	Account    string
+	Resource   string
+	Limit      float64
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota of %s exceeded (limit %g per window)", e.Resource, e.Account, e.Limit)
+}
+
+// Usage is the consumption of one account in the current window.
+type Usage struct {
+	Account    string  `json:"account"`
+	Requests   int64   `json:"requests"`
+	SpyMinutes float64 `json:"spy_minutes"`
+	ActiveSpy  int     `json:"active_spy_sessions"`
+	Limits     Limits  `json:"limits"`
+}
+
+// Report lists the usage of every account seen in the current window.
+type Report struct {
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Accounts    []Usage   `json:"accounts"`
+}
+
+type account struct {
+	limits     Limits
+	requests   int64
+	spySeconds float64
+}
+
+type spySession struct {
+	accounts []string
+	since    time.Time
+}
+
+// Tracker counts usage over fixed windows aligned to the window length, so a
+// 24h window resets at midnight UTC.
+type Tracker struct {
+	window time.Duration
+	perKey Limits
+
+	mu          sync.Mutex
+	windowStart time.Time
+	limits      map[string]Limits
+	accounts    map[string]*account
+	sessions    map[string]*spySession
+
+	now func() time.Time
+}
+
+// NewTracker creates a tracker applying global to all usage and perKey to
+// every principal.
+func NewTracker(window time.Duration, global, perKey Limits) *Tracker {
+	t := &Tracker{
+		window:   window,
+		perKey:   perKey,
+		limits:   map[string]Limits{Global: global},
+		accounts: make(map[string]*account),
+		sessions: make(map[string]*spySession),
+		now:      time.Now,
+	}
+	t.windowStart = t.now().Truncate(window)
+	return t
+}
+
+// SetTenant sets the limits of a tenant's account.
+func (t *Tracker) SetTenant(name string, limits Limits) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits[TenantAccount(name)] = limits
+}
+
+// TenantAccount names the account of a tenant.
+func TenantAccount(name string) string {
+	return "tenant:" + name
+}
+
+// Request counts an API request of principal, and of tenant unless empty,
+// or returns an ExceededError without counting it.
+func (t *Tracker) Request(principal, tenant string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.roll(now)
+
+	accounts := t.resolve(principal, tenant)
+	for _, a := range accounts {
+		if limit := a.acc.limits.Requests; limit > 0 && a.acc.requests >= limit {
+			return t.exceeded(a.name, "request", float64(limit), now)
+		}
+	}
+	for _, a := range accounts {
+		a.acc.requests++
+	}
+	return nil
+}
+
+// AllowSpy returns an ExceededError when principal or tenant has used up its
+// spy minutes. Sessions already running are not cut off.
+func (t *Tracker) AllowSpy(principal, tenant string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.roll(now)
+
+	for _, a := range t.resolve(principal, tenant) {
+		if limit := a.acc.limits.SpyMinutes; limit > 0 && t.spyMinutes(a.name, a.acc, now) >= limit {
+			return t.exceeded(a.name, "spy minutes", limit, now)
+		}
+	}
+	return nil
+}
+
+// SpyStarted starts counting spy minutes of a session.
+func (t *Tracker) SpyStarted(sessionID, principal, tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.roll(now)
+
+	sess := &spySession{since: now}
+	for _, a := range t.resolve(principal, tenant) {
+		sess.accounts = append(sess.accounts, a.name)
+	}
+	t.sessions[sessionID] = sess
+}
+
+// SpyEnded adds the minutes of a finished session. Unknown sessions, e.g.
+// started while the tracker was not in use, are ignored.
+func (t *Tracker) SpyEnded(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.roll(now)
+
+	sess, ok := t.sessions[sessionID]
+	if !ok {
+		return
+	}
+	delete(t.sessions, sessionID)
+	elapsed := now.Sub(sess.since).Seconds()
+	for _, name := range sess.accounts {
+		t.account(name).spySeconds += elapsed
+	}
+}
+
+// Report returns the usage of the current window, sorted by account.
+func (t *Tracker) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.roll(now)
+
+	active := make(map[string]int)
+	for _, sess := range t.sessions {
+		for _, name := range sess.accounts {
+			active[name]++
+		}
+	}
+
+	report := Report{WindowStart: t.windowStart, WindowEnd: t.windowStart.Add(t.window), Accounts: []Usage{}}
+	for name, acc := range t.accounts {
+		report.Accounts = append(report.Accounts, Usage{
+			Account:    name,
+			Requests:   acc.requests,
+			SpyMinutes: t.spyMinutes(name, acc, now),
+			ActiveSpy:  active[name],
+			Limits:     acc.limits,
+		})
+	}
+	sort.Slice(report.Accounts, func(i, j int) bool { return report.Accounts[i].Account < report.Accounts[j].Account })
+	return report
+}
+
+type namedAccount struct {
+	name string
+	acc  *account
+}
+
+func (t *Tracker) resolve(principal, tenant string) []namedAccount {
+	names := []string{Global, principal}
+	if tenant != "" {
+		names = append(names, TenantAccount(tenant))
+	}
+	accounts := make([]namedAccount, len(names))
+	for i, name := range names {
+		accounts[i] = namedAccount{name: name, acc: t.account(name)}
+	}
+	return accounts
+}
+
+func (t *Tracker) account(name string) *account {
+	acc, ok := t.accounts[name]
+	if !ok {
+		limits, ok := t.limits[name]
+		if !ok {
+			limits = t.perKey
+		}
+		acc = &account{limits: limits}
+		t.accounts[name] = acc
+	}
+	return acc
+}
+
+// spyMinutes includes the running sessions of an account.
+func (t *Tracker) spyMinutes(name string, acc *account, now time.Time) float64 {
+	seconds := acc.spySeconds
+	for _, sess := range t.sessions {
+		for _, n := range sess.accounts {
+			if n == name {
+				seconds += now.Sub(sess.since).Seconds()
+			}
+		}
+	}
+	return seconds / 60
+}
+
+func (t *Tracker) exceeded(name, resource string, limit float64, now time.Time) *ExceededError {
+	return &ExceededError{Account: name, Resource: resource, Limit: limit, RetryAfter: t.windowStart.Add(t.window).Sub(now)}
+}
+
+// roll starts a new window once the current one has passed. Running
+// sessions are counted from the start of the new window.
+func (t *Tracker) roll(now time.Time) {
+	if now.Before(t.windowStart.Add(t.window)) {
+		return
+	}
+	t.windowStart = now.Truncate(t.window)
+	t.accounts = make(map[string]*account)
+	for _, sess := range t.sessions {
+		sess.since = t.windowStart
+	}
+}
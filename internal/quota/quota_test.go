@@ -0,0 +1,62 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tr := NewTracker(24*time.Hour, Limits{Requests: 100}, Limits{Requests: 2, SpyMinutes: 5})
+	tr.now = func() time.Time { return now }
+	tr.windowStart = now.Truncate(24 * time.Hour)
+	tr.SetTenant("partner", Limits{Requests: 3})
+
+	for i := 0; i < 2; i++ {
+		if err := tr.Request("key:a", ""); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+	var exceeded *ExceededError
+	if err := tr.Request("key:a", ""); !errors.As(err, &exceeded) || exceeded.Account != "key:a" {
+		t.Fatalf("expected key quota to be exceeded, got %v", err)
+	}
+	if exceeded.RetryAfter != 14*time.Hour {
+		t.Errorf("RetryAfter = %s, want 14h", exceeded.RetryAfter)
+	}
+
+	// Two keys of the same tenant share its quota.
+	for _, key := range []string{"key:b", "key:b", "key:c"} {
+		if err := tr.Request(key, "partner"); err != nil {
+			t.Fatalf("tenant request of %s: unexpected error %v", key, err)
+		}
+	}
+	if err := tr.Request("key:c", "partner"); !errors.As(err, &exceeded) || exceeded.Account != TenantAccount("partner") {
+		t.Fatalf("expected tenant quota to be exceeded, got %v", err)
+	}
+
+	tr.SpyStarted("s1", "key:a", "")
+	now = now.Add(3 * time.Minute)
+	if err := tr.AllowSpy("key:a", ""); err != nil {
+		t.Fatalf("AllowSpy() after 3 minutes: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := tr.AllowSpy("key:a", ""); !errors.As(err, &exceeded) {
+		t.Fatalf("expected spy minutes to be exceeded, got %v", err)
+	}
+	tr.SpyEnded("s1")
+
+	usage := map[string]Usage{}
+	for _, u := range tr.Report().Accounts {
+		usage[u.Account] = u
+	}
+	if u := usage[Global]; u.Requests != 5 || u.SpyMinutes != 5 {
+		t.Errorf("unexpected global usage %+v", u)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if err := tr.Request("key:a", ""); err != nil {
+		t.Errorf("expected quota to reset in the next window, got %v", err)
+	}
+}
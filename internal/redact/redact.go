@@ -0,0 +1,53 @@
+// Package redact hides call identifiers from telemetry, logs and audit events
+// when anonymized mode is enabled. Callers keep using the real identifiers
+// internally and only pass them through this package at output boundaries.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+)
+
+// Placeholder replaces tag values in anonymized mode.
+const Placeholder = "redacted"
+
+var key atomic.Pointer[[]byte]
+
+// Enable turns on anonymized mode. Call IDs are hashed with HMAC-SHA256 keyed
+// by salt, so the same call maps to the same value across logs and traces
+// without being reversible by anyone who does not know the salt.
+func Enable(salt string) {
+	k := []byte(salt)
+	key.Store(&k)
+}
+
+// Disable turns anonymized mode off.
+func Disable() {
+	key.Store(nil)
+}
+
+// Enabled reports whether anonymized mode is on.
+func Enabled() bool {
+	return key.Load() != nil
+}
+
+// CallID returns callID, or its hash in anonymized mode.
+func CallID(callID string) string {
+	k := key.Load()
+	if k == nil || callID == "" {
+		return callID
+	}
+	mac := hmac.New(sha256.New, *k)
+	mac.Write([]byte(callID))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Tag returns tag, or Placeholder in anonymized mode.
+func Tag(tag string) string {
+	if key.Load() == nil || tag == "" {
+		return tag
+	}
+	return Placeholder
+}
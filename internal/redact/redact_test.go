@@ -0,0 +1,34 @@
+package redact
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	defer Disable()
+
+	if got := CallID("call-1"); got != "call-1" {
+		t.Errorf("disabled: CallID() = %q, want unchanged", got)
+	}
+	if got := Tag("tag-1"); got != "tag-1" {
+		t.Errorf("disabled: Tag() = %q, want unchanged", got)
+	}
+
+	Enable("salt")
+	first := CallID("call-1")
+	if first == "call-1" || len(first) != 16 {
+		t.Errorf("enabled: CallID() = %q, want 16 hex chars", first)
+	}
+	if again := CallID("call-1"); again != first {
+		t.Errorf("enabled: CallID() not stable: %q != %q", again, first)
+	}
+	if other := CallID("call-2"); other == first {
+		t.Errorf("enabled: distinct calls hashed to %q", other)
+	}
+	if got := Tag("tag-1"); got != Placeholder {
+		t.Errorf("enabled: Tag() = %q, want %q", got, Placeholder)
+	}
+
+	Enable("pepper")
+	if got := CallID("call-1"); got == first {
+		t.Errorf("hash does not depend on salt")
+	}
+}
@@ -0,0 +1,175 @@
+package rtpengine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxBencodeDepth bounds the nesting of decoded lists and dictionaries.
+const maxBencodeDepth = 64
+
+var errTruncated = errors.New("truncated bencode")
+
+// decodeResponse parses an NG response datagram: a cookie, a space and a
+// bencoded or JSON dictionary. Unlike bencode.Decode it never trusts a
+// length prefix beyond the datagram, so malformed or hostile responses
+// return an error instead of panicking or allocating without bound.
+func decodeResponse(datagram []byte) (map[string]interface{}, error) {
+	spaceIdx := bytes.IndexByte(datagram, ' ')
+	if spaceIdx == -1 {
+		return nil, fmt.Errorf("invalid response format (no space)")
+	}
+	if body := datagram[spaceIdx+1:]; len(body) > 0 && body[0] == '{' {
+		resp, err := decodeJSON(body)
+		if err != nil {
+			return nil, fmt.Errorf("decode error: %w", err)
+		}
+		return resp, nil
+	}
+
+	d := bencodeDecoder{data: datagram[spaceIdx+1:]}
+	decoded, err := d.value(0)
+	if err != nil {
+		return nil, fmt.Errorf("decode error: %w", err)
+	}
+
+	resp, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("decoded response is not a map: %T", decoded)
+	}
+	return resp, nil
+}
+
+// decodePartial returns what arrived of the dictionary in a truncated
+// response: lists and dictionaries cut short hold the elements that arrived
+// whole, and a key whose value was cut short is kept with what arrived of it,
+// nil for strings and integers.
+func decodePartial(datagram []byte) map[string]interface{} {
+	_, body, ok := bytes.Cut(datagram, []byte(" "))
+	if !ok {
+		return nil
+	}
+	d := bencodeDecoder{data: body, partial: true}
+	decoded, _ := d.value(0)
+	resp, _ := decoded.(map[string]interface{})
+	return resp
+}
+
+// bencodeDecoder produces the same types as bencode.Decode: string, int64,
+// []interface{} and map[string]interface{}.
+type bencodeDecoder struct {
+	data []byte
+	pos  int
+	// partial returns lists and dictionaries cut short along with
+	// errTruncated.
+	partial bool
+}
+
+func (d *bencodeDecoder) value(depth int) (interface{}, error) {
+	if depth > maxBencodeDepth {
+		return nil, errors.New("bencode nested too deeply")
+	}
+	if d.pos >= len(d.data) {
+		return nil, errTruncated
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		d.pos++
+		return d.integer('e')
+	case c == 'l':
+		d.pos++
+		list := []interface{}{}
+		for {
+			if d.pos >= len(d.data) {
+				if d.partial {
+					return list, errTruncated
+				}
+				return nil, errTruncated
+			}
+			if d.data[d.pos] == 'e' {
+				d.pos++
+				return list, nil
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				if d.partial && errors.Is(err, errTruncated) {
+					return list, err
+				}
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case c == 'd':
+		d.pos++
+		dict := map[string]interface{}{}
+		for {
+			if d.pos >= len(d.data) {
+				if d.partial {
+					return dict, errTruncated
+				}
+				return nil, errTruncated
+			}
+			if d.data[d.pos] == 'e' {
+				d.pos++
+				return dict, nil
+			}
+			key, err := d.string()
+			if err != nil {
+				if d.partial && errors.Is(err, errTruncated) {
+					return dict, err
+				}
+				return nil, fmt.Errorf("dictionary key: %w", err)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				if d.partial && errors.Is(err, errTruncated) {
+					switch v.(type) {
+					case []interface{}, map[string]interface{}:
+						dict[key] = v
+					default:
+						dict[key] = nil
+					}
+					return dict, err
+				}
+				return nil, err
+			}
+			dict[key] = v
+		}
+	case c >= '0' && c <= '9':
+		return d.string()
+	default:
+		return nil, fmt.Errorf("unexpected byte %q at offset %d", c, d.pos)
+	}
+}
+
+func (d *bencodeDecoder) integer(delim byte) (int64, error) {
+	end := bytes.IndexByte(d.data[d.pos:], delim)
+	if end == -1 {
+		return 0, errTruncated
+	}
+	n, err := strconv.ParseInt(string(d.data[d.pos:d.pos+end]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	d.pos += end + 1
+	return n, nil
+}
+
+func (d *bencodeDecoder) string() (string, error) {
+	if d.pos >= len(d.data) || d.data[d.pos] < '0' || d.data[d.pos] > '9' {
+		return "", errors.New("expected string")
+	}
+	length, err := d.integer(':')
+	if err != nil {
+		return "", err
+	}
+	if length > int64(len(d.data)-d.pos) {
+		return "", errTruncated
+	}
+	s := string(d.data[d.pos : d.pos+int(length)])
+	d.pos += int(length)
+	return s, nil
+}
@@ -0,0 +1,81 @@
+package rtpengine
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/jackpal/bencode-go"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		datagram string
+		want     map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "nested",
+			datagram: "abc d6:result2:ok5:callsl3:one3:twoe3:numi-42e4:tagsd1:adeee",
+			want: map[string]interface{}{
+				"result": "ok",
+				"calls":  []interface{}{"one", "two"},
+				"num":    int64(-42),
+				"tags":   map[string]interface{}{"a": map[string]interface{}{}},
+			},
+		},
+		{name: "no cookie", datagram: "d6:result2:oke", wantErr: true},
+		{name: "not a dictionary", datagram: "abc l2:oke", wantErr: true},
+		{name: "truncated", datagram: "abc d6:result2:o", wantErr: true},
+		{name: "huge string length", datagram: "abc d6:result99999999999999:oke", wantErr: true},
+		{name: "integer key", datagram: "abc di1e2:oke", wantErr: true},
+		{name: "bad integer", datagram: "abc d3:numi1x2ee", wantErr: true},
+		{name: "too deep", datagram: "abc d1:a" + string(bytes.Repeat([]byte("l"), 100)), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeResponse([]byte(tt.datagram))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeResponse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzDecodeResponse(f *testing.F) {
+	f.Add([]byte("abc d6:result2:oke"))
+	f.Add([]byte("abc d6:result5:error12:error-reason14:Unknown call-ide"))
+	f.Add([]byte("abc d5:callsl3:one3:twoee"))
+	f.Add([]byte("abc d4:tagsd3:tagd6:mediasld4:type5:audio5:ptimei20eeeeee"))
+	f.Add([]byte("abc d3:sdpi1ee"))
+
+	f.Fuzz(func(t *testing.T, datagram []byte) {
+		resp, err := decodeResponse(datagram)
+		if err != nil {
+			return
+		}
+
+		// Whatever decodes must survive a round trip through the encoder
+		// used for requests.
+		var buf bytes.Buffer
+		buf.WriteString("cookie ")
+		if err := bencode.Marshal(&buf, resp); err != nil {
+			t.Fatalf("re-encode: %v", err)
+		}
+		again, err := decodeResponse(buf.Bytes())
+		if err != nil {
+			t.Fatalf("decode re-encoded response: %v", err)
+		}
+		if !reflect.DeepEqual(resp, again) {
+			t.Errorf("round trip changed response: %#v != %#v", resp, again)
+		}
+
+		// Sanitizing for the NG log walks every value.
+		sanitizeMap(resp)
+	})
+}
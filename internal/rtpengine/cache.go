@@ -0,0 +1,96 @@
+package rtpengine
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// WithQueryCache answers QueryCall from responses younger than ttl instead
+// of asking rtpengine again, for dashboards polling calls. Every command
+// changing a call, such as subscribe or delete, drops its cached response.
+// Zero disables the cache.
+func WithQueryCache(ttl time.Duration) Option {
+	return func(c *client) {
+		if ttl > 0 {
+			c.queryCache = &queryCache{ttl: ttl, entries: make(map[string]queryEntry)}
+		}
+	}
+}
+
+// queryCache holds the latest query response of calls. Responses are
+// copied at the top level on the way out, as callers add keys to them;
+// nested values are shared and must not be modified.
+type queryCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]queryEntry
+	// generation counts invalidations, so a query answered after the call
+	// changed does not cache the state from before.
+	generation uint64
+	// sweep is when expired entries are next dropped.
+	sweep time.Time
+
+	hitCounter metric.Int64Counter
+}
+
+type queryEntry struct {
+	resp    map[string]interface{}
+	expires time.Time
+}
+
+func (q *queryCache) get(callID string, now time.Time) (map[string]interface{}, uint64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entries[callID]
+	if !ok || now.After(e.expires) {
+		return nil, q.generation, false
+	}
+	return maps.Clone(e.resp), q.generation, true
+}
+
+// put caches resp unless the call was invalidated since generation.
+func (q *queryCache) put(callID string, resp map[string]interface{}, generation uint64, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if generation != q.generation {
+		return
+	}
+	q.entries[callID] = queryEntry{resp: resp, expires: now.Add(q.ttl)}
+	// Expired entries are dropped every ttl, which bounds the cache to the
+	// calls queried within two.
+	if now.After(q.sweep) {
+		for id, e := range q.entries {
+			if now.After(e.expires) {
+				delete(q.entries, id)
+			}
+		}
+		q.sweep = now.Add(q.ttl)
+	}
+}
+
+func (q *queryCache) invalidate(callID string) {
+	q.mu.Lock()
+	delete(q.entries, callID)
+	q.generation++
+	q.mu.Unlock()
+}
+
+// cachedQuery answers QueryCall through the cache.
+func (c *client) cachedQuery(ctx context.Context, callID string, query func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	resp, generation, ok := c.queryCache.get(callID, time.Now())
+	if ok {
+		c.queryCache.hitCounter.Add(ctx, 1, c.metricAttributes())
+		return resp, nil
+	}
+	resp, err := query()
+	if err != nil {
+		return nil, err
+	}
+	c.queryCache.put(callID, resp, generation, time.Now())
+	return maps.Clone(resp), nil
+}
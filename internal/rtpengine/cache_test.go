@@ -0,0 +1,81 @@
+package rtpengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+func TestQueryCache(t *testing.T) {
+	s, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "a"}, {Tag: "b"}}})
+
+	c, err := NewClient(s.Addr(), WithQueryCache(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	queries := func() int {
+		n := 0
+		for _, req := range s.Requests() {
+			if req.Command == "query" {
+				n++
+			}
+		}
+		return n
+	}
+
+	first, err := c.QueryCall(ctx, "call-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first["instance"] = "node-1"
+	second, err := c.QueryCall(ctx, "call-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := queries(); n != 1 {
+		t.Errorf("%d queries sent, want 1", n)
+	}
+	if _, ok := second["instance"]; ok {
+		t.Error("a caller's change to a response leaked into the cache")
+	}
+
+	if _, err := c.Subscribe(ctx, "call-1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.QueryCall(ctx, "call-1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := queries(); n != 2 {
+		t.Errorf("%d queries sent after subscribe, want 2", n)
+	}
+}
+
+func TestQueryCacheExpiry(t *testing.T) {
+	q := &queryCache{ttl: time.Second, entries: make(map[string]queryEntry)}
+	now := time.Now()
+	_, generation, _ := q.get("c1", now)
+	q.put("c1", map[string]interface{}{"result": "ok"}, generation, now)
+	if _, _, ok := q.get("c1", now.Add(time.Second/2)); !ok {
+		t.Error("fresh response missed")
+	}
+	if _, _, ok := q.get("c1", now.Add(2*time.Second)); ok {
+		t.Error("expired response hit")
+	}
+
+	// A query answered across an invalidation is not cached.
+	_, generation, _ = q.get("c2", now)
+	q.invalidate("c2")
+	q.put("c2", map[string]interface{}{"result": "ok"}, generation, now)
+	if _, _, ok := q.get("c2", now); ok {
+		t.Error("response from before the invalidation cached")
+	}
+}
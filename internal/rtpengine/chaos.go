@@ -0,0 +1,101 @@
+package rtpengine
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Faults are the failures Chaos injects into NG exchanges. Counts are used
+// up one exchange at a time; Delay applies until it is cleared.
+type Faults struct {
+	// DropResponses discards the responses of the next requests, which
+	// reach rtpengine but time out as if the answer was lost.
+	DropResponses int `json:"drop_responses"`
+	// DelayMs holds back every response this long; responses held past the
+	// request's timeout are lost.
+	DelayMs int `json:"delay_ms"`
+	// FailSubscriptions answers the next subscribe requests with an
+	// rtpengine error without sending them.
+	FailSubscriptions int `json:"fail_subscriptions"`
+}
+
+// Chaos injects failures into the NG exchanges of the clients it is given
+// to, so retries, failover and resubscription can be exercised against a
+// healthy rtpengine. The zero Faults inject nothing.
+type Chaos struct {
+	mu     sync.Mutex
+	faults Faults
+}
+
+// NewChaos creates a Chaos injecting nothing until Set.
+func NewChaos() *Chaos {
+	return &Chaos{}
+}
+
+// WithChaos injects the faults set on ch into the client's exchanges.
+func WithChaos(ch *Chaos) Option {
+	return func(c *client) { c.chaos = ch }
+}
+
+// Set replaces the faults to inject.
+func (ch *Chaos) Set(f Faults) {
+	ch.mu.Lock()
+	ch.faults = f
+	ch.mu.Unlock()
+}
+
+// Faults returns the faults still to be injected.
+func (ch *Chaos) Faults() Faults {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.faults
+}
+
+// failing reports whether command is to be answered with an error.
+func (ch *Chaos) failing(command string) bool {
+	if ch == nil || command != "subscribe request" {
+		return false
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.faults.FailSubscriptions == 0 {
+		return false
+	}
+	ch.faults.FailSubscriptions--
+	return true
+}
+
+// chaosFailure is the error response injected for cookie.
+func chaosFailure(cookie string) []byte {
+	return []byte(cookie + " d12:error-reason22:injected chaos failure6:result5:errore")
+}
+
+// response drops or delays a response that arrived on network. Lost
+// responses end in ctx's timeout.
+func (ch *Chaos) response(ctx context.Context, network string, resp []byte) ([]byte, error) {
+	if ch == nil {
+		return resp, nil
+	}
+	ch.mu.Lock()
+	drop := ch.faults.DropResponses > 0
+	if drop {
+		ch.faults.DropResponses--
+	}
+	delay := time.Duration(ch.faults.DelayMs) * time.Millisecond
+	ch.mu.Unlock()
+
+	if !drop && delay <= 0 {
+		return resp, nil
+	}
+	var held <-chan time.Time
+	if !drop {
+		held = time.After(delay)
+	}
+	select {
+	case <-held:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, &transportError{op: "read", network: network, err: ctx.Err()}
+	}
+}
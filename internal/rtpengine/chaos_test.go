@@ -0,0 +1,56 @@
+package rtpengine
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChaos(t *testing.T) {
+	var silent atomic.Bool
+	var answered atomic.Int32
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go servePong(conn, &silent, &answered)
+
+	chaos := NewChaos()
+	c, err := NewClient(conn.LocalAddr().String(), WithChaos(chaos), WithRetryPolicy(RetryPolicy{Timeout: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	chaos.Set(Faults{DropResponses: 1})
+	if err := c.Ping(ctx); !isTimeout(err) || answered.Load() != 1 {
+		t.Errorf("Ping() with a dropped response = %v after %d answers, want a timeout after rtpengine answered", err, answered.Load())
+	}
+	if err := c.Ping(ctx); err != nil || chaos.Faults().DropResponses != 0 {
+		t.Errorf("Ping() after the drop = %v, faults %+v", err, chaos.Faults())
+	}
+
+	chaos.Set(Faults{DelayMs: 100})
+	if err := c.Ping(ctx); !isTimeout(err) {
+		t.Errorf("Ping() delayed past its timeout = %v, want a timeout", err)
+	}
+	chaos.Set(Faults{DelayMs: 10})
+	start := time.Now()
+	if err := c.Ping(ctx); err != nil || time.Since(start) < 10*time.Millisecond {
+		t.Errorf("Ping() delayed 10ms = %v after %v", err, time.Since(start))
+	}
+
+	chaos.Set(Faults{FailSubscriptions: 1})
+	before := answered.Load()
+	if _, err := c.Subscribe(ctx, "call-1", "tag-a"); err == nil || !strings.Contains(err.Error(), "injected chaos failure") {
+		t.Errorf("Subscribe() = %v, want the injected error", err)
+	}
+	if answered.Load() != before || chaos.Faults() != (Faults{}) {
+		t.Errorf("failed subscription reached rtpengine or faults left %+v", chaos.Faults())
+	}
+}
@@ -2,123 +2,246 @@ package rtpengine
 
 import (
 	"bytes"
+	"cmp"
 	"context"
-	"crypto/rand"
+	"errors"
 	"fmt"
-	"net"
+	"slices"
 	"sync"
 	"time"
 
-	"github.com/jackpal/bencode-go"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// ngTimeout bounds one NG round trip by default, unless the caller's
+// context ends it sooner.
+const ngTimeout = 2 * time.Second
+
+// client multiplexes NG requests over its transport: any number may be in
+// flight, each with its own timeout.
 type client struct {
-	addr   *net.UDPAddr
-	conn   *net.UDPConn
-	mu     sync.Mutex
-	tracer trace.Tracer
-	meter  metric.Meter
+	network   string
+	sockets   int
+	transport transport
+	cookies   *cookies
+	retry     RetryPolicy
+	tracer    trace.Tracer
+	meter     metric.Meter
+
+	// fallback carries requests whose UDP response is truncated or too
+	// large to be sent.
+	fallbackAddr string
+	fallback     transport
+	// failover moves requests to a backup endpoint.
+	failover FailoverPolicy
+	// chaos injects failures for resilience testing.
+	chaos *Chaos
+	// subscribeOptions override DefaultSubscribeOptions.
+	subscribeOptions MediaOptions
+	// readOnly refuses the commands that are not readCommands.
+	readOnly bool
+	// queryCache answers repeated queries of a call.
+	queryCache *queryCache
+	// limiter queues commands over the rate limit.
+	limiter *rateLimiter
+	// encoding of requests, and the one EncodingAuto settled on.
+	encoding    string
+	negotiateMu sync.Mutex
+	negotiated  string
 
 	requestCounter metric.Int64Counter
 	errorCounter   metric.Int64Counter
-}
-
-// NewClient creates a new RTPEngine client for the given address.
-func NewClient(address string) (Client, error) {
-	addr, err := net.ResolveUDPAddr("udp", address)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve udp address: %w", err)
-	}
+	retryCounter   metric.Int64Counter
 
-	conn, err := net.ListenUDP("udp", nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to listen udp: %w", err)
-	}
+	ngLog *NGLog
+	clock *Clock
+	// instance names and labels the subscriptions of this client.
+	instance string
+	// name is the rtpengine instance the client talks to, as known to a
+	// Registry; it labels the client's metrics.
+	name string
+}
 
+// NewClient creates a new RTPEngine client for the given address. It speaks
+// NG over UDP unless WithTransport selects TCP.
+func NewClient(address string, opts ...Option) (Client, error) {
 	tracer := otel.Tracer("rtpengine-client")
 	meter := otel.Meter("rtpengine-client")
 
 	reqCounter, _ := meter.Int64Counter("rtpengine.requests_total", metric.WithDescription("Total number of requests to RTPEngine"))
 	errCounter, _ := meter.Int64Counter("rtpengine.errors_total", metric.WithDescription("Total number of errors from RTPEngine"))
+	retryCounter, _ := meter.Int64Counter("rtpengine.retries_total", metric.WithDescription("Total number of requests to RTPEngine repeated after a timeout"))
 
-	return &client{
-		addr:           addr,
-		conn:           conn,
+	c := &client{
 		tracer:         tracer,
 		meter:          meter,
 		requestCounter: reqCounter,
 		errorCounter:   errCounter,
-	}, nil
+		retryCounter:   retryCounter,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.cookies = newCookies(meter, c.metricAttributes())
+	if c.limiter != nil {
+		c.limiter.queuedCounter, _ = meter.Int64Counter("rtpengine.rate_limited_total", metric.WithDescription("Total number of commands queued by the rate limit"))
+	}
+	if c.queryCache != nil {
+		c.queryCache.hitCounter, _ = meter.Int64Counter("rtpengine.query_cache_hits_total", metric.WithDescription("Total number of call queries answered from the cache"))
+	}
+	if !validEncoding(c.encoding) {
+		return nil, fmt.Errorf("unknown NG encoding: %q", c.encoding)
+	}
+
+	t, err := newTransport(c.network, address, c.sockets, c.cookies)
+	if err != nil {
+		return nil, err
+	}
+	c.transport = t
+	if c.failover.Address != "" {
+		backup, err := newTransport(c.network, c.failover.Address, c.sockets, c.cookies)
+		if err != nil {
+			t.Close()
+			return nil, fmt.Errorf("backup endpoint: %w", err)
+		}
+		c.transport = newFailoverTransport(c, t, address, backup, c.retry.timeout("ping"))
+	}
+	if c.fallbackAddr != "" && c.network != TransportTCP {
+		c.fallback = &tcpTransport{address: c.fallbackAddr, cookies: c.cookies}
+	}
+	return c, nil
 }
 
-func (c *client) generateCookie() string {
-	b := make([]byte, 8)
-	rand.Read(b)
-	return fmt.Sprintf("%x", b)
+// WithInstanceName labels the client's metrics and spans with the name of
+// the rtpengine instance it talks to.
+func WithInstanceName(name string) Option {
+	return func(c *client) { c.name = name }
+}
+
+func (c *client) metricAttributes(attrs ...attribute.KeyValue) metric.MeasurementOption {
+	if c.name != "" {
+		attrs = append(attrs, attribute.String("rtpengine_instance", c.name))
+	}
+	return metric.WithAttributes(attrs...)
 }
 
 func (c *client) sendCommand(ctx context.Context, command string, args map[string]interface{}) (map[string]interface{}, error) {
-	ctx, span := c.tracer.Start(ctx, "rtpengine.SendCommand", trace.WithSpanKind(trace.SpanKindClient),trace.WithAttributes(
+	if c.readOnly && !readCommands[command] {
+		return nil, fmt.Errorf("%s: %w", command, ErrReadOnly)
+	}
+	if err := c.wait(ctx, command); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	cookie := c.cookies.next()
+	resp, err := c.exchange(ctx, command, cookie, args)
+	if callID, ok := args["call-id"].(string); ok && c.queryCache != nil && !readCommands[command] {
+		c.queryCache.invalidate(callID)
+	}
+	if c.ngLog != nil {
+		c.ngLog.record(start, cookie, command, args, resp, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.clock != nil {
+		c.clock.record(command, args, resp, start, time.Now())
+	}
+	return resp, nil
+}
+
+// exchange sends one command and decodes the response. Error responses from
+// rtpengine are returned along with the error so they can be captured.
+func (c *client) exchange(ctx context.Context, command, cookie string, args map[string]interface{}) (map[string]interface{}, error) {
+	ctx, span := c.tracer.Start(ctx, "rtpengine.SendCommand", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
 		attribute.String("command", command),
+		attribute.String("rtpengine_instance", c.name),
 	))
 	defer span.End()
 
-	cookie := c.generateCookie()
 	args["command"] = command
 
-	c.requestCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("command", command)))
+	c.requestCounter.Add(ctx, 1, c.metricAttributes(attribute.String("command", command)))
 
 	var buf bytes.Buffer
-	buf.WriteString(cookie + " ")
-	if err := bencode.Marshal(&buf, args); err != nil {
-		return nil, fmt.Errorf("failed to marshal bencode: %w", err)
+	if err := encodeMessage(&buf, c.requestEncoding(ctx), cookie, args); err != nil {
+		return nil, err
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if _, err := c.conn.WriteToUDP(buf.Bytes(), c.addr); err != nil {
-		c.errorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("command", command), attribute.String("reason", "write_error")))
-		return nil, fmt.Errorf("failed to write to udp: %w", err)
+	var respBuf []byte
+	var err error
+	if c.chaos.failing(command) {
+		respBuf = chaosFailure(cookie)
+	} else {
+		respBuf, err = c.send(ctx, command, buf.Bytes(), cookie)
+	}
+	if err != nil && c.fallback != nil && oversizeCommands[command] && isTimeout(err) {
+		// rtpengine cannot send a response larger than a datagram at all.
+		respBuf, err = c.roundTrip(ctx, c.fallback, c.retry.timeout(command), buf.Bytes(), cookie)
 	}
-
-	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
-	respBuf := make([]byte, 65535)
-	n, _, err := c.conn.ReadFromUDP(respBuf)
 	if err != nil {
-		c.errorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("command", command), attribute.String("reason", "read_error")))
-		return nil, fmt.Errorf("failed to read from udp: %w", err)
+		reason := "read_error"
+		var te *transportError
+		if errors.As(err, &te) {
+			reason = te.op + "_error"
+		}
+		c.errorCounter.Add(ctx, 1, c.metricAttributes(attribute.String("command", command), attribute.String("reason", reason)))
+		return nil, err
 	}
 
-	spaceIdx := bytes.IndexByte(respBuf[:n], ' ')
-	if spaceIdx == -1 {
-		return nil, fmt.Errorf("invalid response format (no space)")
+	resp, err := decodeResponse(respBuf)
+	if errors.Is(err, errTruncated) {
+		c.errorCounter.Add(ctx, 1, c.metricAttributes(attribute.String("command", command), attribute.String("reason", "truncated")))
+		resp, err = c.retryTruncated(ctx, command, buf.Bytes(), cookie, respBuf)
 	}
-
-	decoded, err := bencode.Decode(bytes.NewReader(respBuf[spaceIdx+1 : n]))
 	if err != nil {
-		return nil, fmt.Errorf("decode error: %w", err)
+		return nil, err
 	}
 
-	resp, ok := decoded.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("decoded response is not a map: %T", decoded)
+	if result, ok := resp["result"].(string); ok && result == "error" {
+		c.errorCounter.Add(ctx, 1, c.metricAttributes(attribute.String("command", command), attribute.String("reason", "rtpengine_error")))
+		return resp, fmt.Errorf("rtpengine error: %v", resp["error-reason"])
 	}
 
-	if result, ok := resp["result"].(string); ok && result == "error" {
-		c.errorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("command", command), attribute.String("reason", "rtpengine_error")))
-		return nil, fmt.Errorf("rtpengine error: %v", resp["error-reason"])
+	if err := validateResponse(command, resp); err != nil {
+		c.errorCounter.Add(ctx, 1, c.metricAttributes(attribute.String("command", command), attribute.String("reason", "invalid_response")))
+		return resp, err
 	}
 
 	return resp, nil
 }
 
-func (c *client) ListCalls(ctx context.Context) ([]string, error) {
-	resp, err := c.sendCommand(ctx, "list", map[string]interface{}{})
+// retryTruncated repeats a request over the TCP fallback after its UDP
+// response was cut short. The cookie is kept, so rtpengine answers from its
+// cookie cache instead of running the command twice.
+func (c *client) retryTruncated(ctx context.Context, command string, msg []byte, cookie string, respBuf []byte) (map[string]interface{}, error) {
+	if c.fallback == nil {
+		return nil, &TruncatedError{Command: command, Size: len(respBuf), Partial: decodePartial(respBuf)}
+	}
+	respBuf, err := c.roundTrip(ctx, c.fallback, c.retry.timeout(command), msg, cookie)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry truncated response to %s: %w", command, err)
+	}
+	return decodeResponse(respBuf)
+}
+
+func (c *client) roundTrip(ctx context.Context, t transport, timeout time.Duration, msg []byte, cookie string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := t.roundTrip(ctx, msg, cookie)
+	if err != nil {
+		return nil, err
+	}
+	return c.chaos.response(ctx, cmp.Or(c.network, TransportUDP), resp)
+}
+
+func (c *client) ListCalls(ctx context.Context, opts ListOptions) ([]string, error) {
+	args := map[string]interface{}{}
+	opts.apply(args)
+	resp, err := c.sendCommand(ctx, "list", args)
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +249,7 @@ func (c *client) ListCalls(ctx context.Context) ([]string, error) {
 	rawCalls, ok := resp["calls"].([]interface{})
 	if !ok {
 		if calls, ok := resp["calls"].([]string); ok {
-			return calls, nil
+			return opts.page(calls), nil
 		}
 		return []string{}, nil
 	}
@@ -135,38 +258,67 @@ func (c *client) ListCalls(ctx context.Context) ([]string, error) {
 	for i, v := range rawCalls {
 		calls[i] = fmt.Sprint(v)
 	}
-	return calls, nil
+	return opts.page(calls), nil
 }
 
 func (c *client) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	if c.queryCache != nil {
+		return c.cachedQuery(ctx, callID, func() (map[string]interface{}, error) {
+			return c.queryCall(ctx, callID)
+		})
+	}
+	return c.queryCall(ctx, callID)
+}
+
+func (c *client) queryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
 	args := map[string]interface{}{
 		"call-id": callID,
 	}
-	return c.sendCommand(ctx, "query", args)
+	resp, err := c.sendCommand(ctx, "query", args)
+	var truncated *TruncatedError
+	if errors.As(err, &truncated) {
+		return c.queryByTag(ctx, callID, truncated)
+	}
+	return resp, err
 }
 
 func (c *client) Subscribe(ctx context.Context, callID, tag string) (map[string]interface{}, error) {
+	return c.subscribe(ctx, callID, tag)
+}
+
+func (c *client) SubscribeAll(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return c.subscribe(ctx, callID, "")
+}
+
+// subscribe requests a subscription to the party with fromTag or, when it is
+// empty, to every party of the call with the "all" flag.
+func (c *client) subscribe(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	opts := DefaultSubscribeOptions.override(c.subscribeOptions).override(subscribeOptionsFromContext(ctx))
+	if fromTag == "" {
+		opts.Flags = append(slices.Clip(opts.Flags), "all")
+	}
 	args := map[string]interface{}{
-		"call-id":  callID,
-		"from-tag": tag,
-		"flags":    []string{"trust-address", "generate-mid", "SDES-off", "no-rtcp-attribute", "trickle-ICE"},
-		"rtcp-mux": []string{"offer", "require"},
-		"transport-protocol": "UDP/TLS/RTP/SAVPF",
-		"ICE": "force",
-		"codec": map[string]interface{}{
-			"strip": "all",
-			"transcode": "PCMU",
-		},
+		"call-id": callID,
+	}
+	opts.apply(args)
+	if fromTag != "" {
+		args["from-tag"] = fromTag
 	}
+	if toTag, ok := reusedSubscription(ctx, fromTag); ok {
+		args["to-tag"] = toTag
+	} else if toTag := c.subscriptionTag(); toTag != "" {
+		args["to-tag"] = toTag
+	}
+	args["label"] = c.subscriptionLabel(LabelFromContext(ctx))
 	return c.sendCommand(ctx, "subscribe request", args)
 }
 
 func (c *client) SubscribeAnswer(ctx context.Context, callID, sdp, toTag string) (map[string]interface{}, error) {
 	args := map[string]interface{}{
-		"call-id":  callID,
-		"sdp":      sdp,
-		"to-tag":   toTag,
-		"flags":    []string{"allow-transcoding"},
+		"call-id": callID,
+		"sdp":     sdp,
+		"to-tag":  toTag,
+		"flags":   []string{"allow-transcoding"},
 	}
 	return c.sendCommand(ctx, "subscribe answer", args)
 }
@@ -184,6 +336,149 @@ func (c *client) Statistics(ctx context.Context) (map[string]interface{}, error)
 	return c.sendCommand(ctx, "statistics", map[string]interface{}{})
 }
 
+func (c *client) Ping(ctx context.Context) error {
+	_, err := c.sendCommand(ctx, "ping", map[string]interface{}{})
+	return err
+}
+
+func (c *client) Offer(ctx context.Context, callID, fromTag, sdp string, opts MediaOptions) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id":  callID,
+		"from-tag": fromTag,
+		"sdp":      sdp,
+	}
+	opts.apply(args)
+	return c.sendCommand(ctx, "offer", args)
+}
+
+func (c *client) Answer(ctx context.Context, callID, fromTag, toTag, sdp string, opts MediaOptions) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id":  callID,
+		"from-tag": fromTag,
+		"to-tag":   toTag,
+		"sdp":      sdp,
+	}
+	opts.apply(args)
+	return c.sendCommand(ctx, "answer", args)
+}
+
+// Publish offers the media of a new participant, identified by fromTag, into
+// a call, as a conference publisher does. rtpengine answers with the SDP the
+// stream is sent to, and subscriptions to fromTag receive it.
+func (c *client) Publish(ctx context.Context, callID, fromTag, sdp string, opts MediaOptions) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id":  callID,
+		"from-tag": fromTag,
+		"sdp":      sdp,
+	}
+	opts.apply(args)
+	return c.sendCommand(ctx, "publish", args)
+}
+
+func (c *client) Delete(ctx context.Context, callID string, opts DeleteOptions) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id": callID,
+	}
+	opts.apply(args)
+	return c.sendCommand(ctx, "delete", args)
+}
+
+// BlockMedia stops rtpengine forwarding the media sent by the leg with
+// fromTag. An empty tag blocks every leg of the call.
+func (c *client) BlockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return c.mediaCommand(ctx, "block media", callID, fromTag)
+}
+
+func (c *client) UnblockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return c.mediaCommand(ctx, "unblock media", callID, fromTag)
+}
+
+// SilenceMedia replaces the media sent by the leg with fromTag with silence,
+// keeping the RTP stream flowing. An empty tag silences every leg.
+func (c *client) SilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return c.mediaCommand(ctx, "silence media", callID, fromTag)
+}
+
+func (c *client) UnsilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return c.mediaCommand(ctx, "unsilence media", callID, fromTag)
+}
+
+// BlockDTMF stops rtpengine forwarding the DTMF events sent by the leg with
+// fromTag. An empty tag blocks DTMF of every leg.
+func (c *client) BlockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return c.mediaCommand(ctx, "block DTMF", callID, fromTag)
+}
+
+func (c *client) UnblockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return c.mediaCommand(ctx, "unblock DTMF", callID, fromTag)
+}
+
+// PlayDTMF plays digits, any of 0-9, *, # and A-D, to the leg with fromTag
+// as RFC 4733 events or in-band tones, whichever the leg negotiated.
+func (c *client) PlayDTMF(ctx context.Context, callID, fromTag, digits string, opts DTMFOptions) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id":  callID,
+		"from-tag": fromTag,
+		"code":     digits,
+	}
+	opts.apply(args)
+	return c.sendCommand(ctx, "play DTMF", args)
+}
+
+// PlayMedia plays an audio file, e.g. a WAV, to the leg with fromTag. The
+// other legs of the call do not hear it.
+func (c *client) PlayMedia(ctx context.Context, callID, fromTag string, opts PlayMediaOptions) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id":  callID,
+		"from-tag": fromTag,
+	}
+	opts.apply(args)
+	return c.sendCommand(ctx, "play media", args)
+}
+
+// StopMedia stops the playback started by PlayMedia on the leg with fromTag.
+func (c *client) StopMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id":  callID,
+		"from-tag": fromTag,
+	}
+	return c.sendCommand(ctx, "stop media", args)
+}
+
+func (c *client) mediaCommand(ctx context.Context, command, callID, fromTag string) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id": callID,
+	}
+	if fromTag != "" {
+		args["from-tag"] = fromTag
+	} else {
+		args["flags"] = []string{"all"}
+	}
+	return c.sendCommand(ctx, command, args)
+}
+
+// StartRecording starts recording a call. A non-empty path overrides the
+// recording directory configured in rtpengine.
+func (c *client) StartRecording(ctx context.Context, callID, path string) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id": callID,
+	}
+	if path != "" {
+		args["recording-path"] = path
+	}
+	return c.sendCommand(ctx, "start recording", args)
+}
+
+func (c *client) StopRecording(ctx context.Context, callID string) (map[string]interface{}, error) {
+	args := map[string]interface{}{
+		"call-id": callID,
+	}
+	return c.sendCommand(ctx, "stop recording", args)
+}
+
 func (c *client) Close() error {
-	return c.conn.Close()
+	if c.fallback != nil {
+		c.fallback.Close()
+	}
+	return c.transport.Close()
 }
@@ -0,0 +1,154 @@
+package rtpengine
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ClockSkewTolerance is the skew beyond which rtpengine's clock is reported
+// out of sync with the local one. rtpengine reports whole seconds.
+const ClockSkewTolerance = 2 * time.Second
+
+// Clock estimates how far rtpengine's clock is off the local one from the
+// timestamps in its query responses. A timestamp cannot be later than
+// rtpengine's clock when it answered, which bounds the skew from below; the
+// last signal time of a call this client offered or answered cannot be
+// earlier than rtpengine's clock when the request was sent, which bounds it
+// from above.
+type Clock struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	signals map[string]time.Time
+	lower   []skewBound
+	upper   []skewBound
+	skewed  bool
+}
+
+type skewBound struct {
+	at   time.Time
+	skew time.Duration
+}
+
+// NewClock creates a clock estimating the skew from the observations of the
+// last window.
+func NewClock(window time.Duration) *Clock {
+	return &Clock{window: window, signals: make(map[string]time.Time)}
+}
+
+// WithClock estimates rtpengine's clock skew from the client's exchanges.
+func WithClock(clock *Clock) Option {
+	return func(c *client) { c.clock = clock }
+}
+
+// signalCommands set the last signal time of their call.
+var signalCommands = map[string]bool{
+	"offer":   true,
+	"answer":  true,
+	"publish": true,
+}
+
+// record observes one successful exchange sent at sent and answered at
+// received.
+func (c *Clock) record(command string, args, resp map[string]interface{}, sent, received time.Time) {
+	callID, _ := args["call-id"].(string)
+	switch {
+	case signalCommands[command] && callID != "":
+		c.mu.Lock()
+		c.signals[callID] = sent
+		c.mu.Unlock()
+	case command == "query":
+		c.observe(callID, resp, received)
+	}
+}
+
+func (c *Clock) observe(callID string, resp map[string]interface{}, received time.Time) {
+	details := DecodeCallDetails(resp)
+	latest := details.Created
+	if details.LastSignal.After(latest) {
+		latest = details.LastSignal
+	}
+	for _, tag := range details.Tags {
+		if tag.Created.After(latest) {
+			latest = tag.Created
+		}
+	}
+	if latest.IsZero() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune(received)
+	c.lower = append(c.lower, skewBound{received, latest.Sub(received)})
+	if sent, ok := c.signals[callID]; ok {
+		if !details.LastSignal.IsZero() {
+			c.upper = append(c.upper, skewBound{received, details.LastSignal.Add(time.Second).Sub(sent)})
+		}
+	}
+
+	skew, _ := c.estimate()
+	if skewed := skew > ClockSkewTolerance || skew < -ClockSkewTolerance; skewed != c.skewed {
+		c.skewed = skewed
+		if skewed {
+			log.Printf("rtpengine: clock is %s off the local clock; tag ordering and history timestamps may be wrong", skew)
+		} else {
+			log.Printf("rtpengine: clock is in sync with the local clock again")
+		}
+	}
+}
+
+func (c *Clock) prune(now time.Time) {
+	cutoff := now.Add(-c.window)
+	keep := func(bounds []skewBound) []skewBound {
+		i := 0
+		for i < len(bounds) && bounds[i].at.Before(cutoff) {
+			i++
+		}
+		return bounds[i:]
+	}
+	c.lower, c.upper = keep(c.lower), keep(c.upper)
+	for callID, sent := range c.signals {
+		if sent.Before(cutoff) {
+			delete(c.signals, callID)
+		}
+	}
+}
+
+// estimate returns the skew the bounds prove, or zero when they allow the
+// clocks to be in sync.
+func (c *Clock) estimate() (time.Duration, bool) {
+	if len(c.lower) == 0 && len(c.upper) == 0 {
+		return 0, false
+	}
+	var skew time.Duration
+	for i, b := range c.lower {
+		if i == 0 || b.skew > skew {
+			skew = b.skew
+		}
+	}
+	if skew > 0 {
+		return skew, true
+	}
+	skew = 0
+	for _, b := range c.upper {
+		skew = min(skew, b.skew)
+	}
+	return skew, true
+}
+
+// Skew returns how far rtpengine's clock is ahead of the local one, negative
+// when it is behind, and whether there were observations to tell.
+func (c *Clock) Skew() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune(time.Now())
+	return c.estimate()
+}
+
+// Skewed reports whether the skew exceeds ClockSkewTolerance.
+func (c *Clock) Skewed() bool {
+	skew, _ := c.Skew()
+	return skew > ClockSkewTolerance || skew < -ClockSkewTolerance
+}
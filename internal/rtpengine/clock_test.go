@@ -0,0 +1,45 @@
+package rtpengine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	now := time.Now()
+	query := func(created, lastSignal time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"created":     created.Unix(),
+			"last signal": lastSignal.Unix(),
+			"tags": map[string]interface{}{
+				"a": map[string]interface{}{"created": created.Unix()},
+			},
+		}
+	}
+
+	c := NewClock(time.Hour)
+	if _, ok := c.Skew(); ok {
+		t.Error("Skew() known before any observation")
+	}
+
+	// An older call proves nothing.
+	c.record("query", map[string]interface{}{"call-id": "old"}, query(now.Add(-time.Minute), now.Add(-time.Minute)), now, now)
+	if skew, ok := c.Skew(); !ok || skew != 0 || c.Skewed() {
+		t.Errorf("Skew() = %s, %v, want 0, true", skew, ok)
+	}
+
+	// A call signalled now whose last signal is a minute old: rtpengine is
+	// at least a minute behind.
+	c.record("offer", map[string]interface{}{"call-id": "behind"}, nil, now, now)
+	c.record("query", map[string]interface{}{"call-id": "behind"}, query(now.Add(-time.Minute), now.Add(-time.Minute)), now, now)
+	if skew, _ := c.Skew(); skew > -58*time.Second || skew < -time.Minute || !c.Skewed() {
+		t.Errorf("Skew() = %s, want about -1m", skew)
+	}
+
+	// A timestamp from the future: rtpengine is ahead.
+	c = NewClock(time.Hour)
+	c.record("query", map[string]interface{}{"call-id": "ahead"}, query(now.Add(30*time.Second), now.Add(30*time.Second)), now, now)
+	if skew, _ := c.Skew(); skew < 29*time.Second || skew > 30*time.Second || !c.Skewed() {
+		t.Errorf("Skew() = %s, want about 30s", skew)
+	}
+}
@@ -0,0 +1,135 @@
+package rtpengine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/jackpal/bencode-go"
+)
+
+// Encodings of NG messages. rtpengine answers a request in the encoding it
+// was sent in; responses are decoded in either.
+const (
+	EncodingBencode = "bencode"
+	// EncodingJSON needs an rtpengine that accepts JSON-encoded messages.
+	EncodingJSON = "json"
+	// EncodingAuto sends a JSON ping before the first request and uses
+	// JSON if rtpengine answers it in JSON, bencode otherwise.
+	EncodingAuto = "auto"
+)
+
+// WithEncoding selects the encoding of NG requests, EncodingBencode (the
+// default), EncodingJSON or EncodingAuto.
+func WithEncoding(encoding string) Option {
+	return func(c *client) { c.encoding = encoding }
+}
+
+func validEncoding(encoding string) bool {
+	switch encoding {
+	case "", EncodingBencode, EncodingJSON, EncodingAuto:
+		return true
+	}
+	return false
+}
+
+// encodeMessage writes an NG message: the cookie, a space and args.
+func encodeMessage(buf *bytes.Buffer, encoding, cookie string, args map[string]interface{}) error {
+	buf.WriteString(cookie + " ")
+	if encoding == EncodingJSON {
+		if err := json.NewEncoder(buf).Encode(args); err != nil {
+			return fmt.Errorf("failed to marshal json: %w", err)
+		}
+		// Encode ends the message with a newline rtpengine does not expect.
+		buf.Truncate(buf.Len() - 1)
+		return nil
+	}
+	if err := bencode.Marshal(buf, args); err != nil {
+		return fmt.Errorf("failed to marshal bencode: %w", err)
+	}
+	return nil
+}
+
+// requestEncoding returns the encoding to send a request in, negotiating it
+// first with EncodingAuto.
+func (c *client) requestEncoding(ctx context.Context) string {
+	switch c.encoding {
+	case EncodingAuto:
+		return c.negotiate(ctx)
+	case "":
+		return EncodingBencode
+	}
+	return c.encoding
+}
+
+// negotiate settles the encoding of an EncodingAuto client with a JSON
+// ping. Until rtpengine answers, requests are sent bencoded and the next
+// request tries again.
+func (c *client) negotiate(ctx context.Context) string {
+	c.negotiateMu.Lock()
+	defer c.negotiateMu.Unlock()
+	if c.negotiated != "" {
+		return c.negotiated
+	}
+
+	cookie := c.cookies.next()
+	var buf bytes.Buffer
+	if err := encodeMessage(&buf, EncodingJSON, cookie, map[string]interface{}{"command": "ping"}); err != nil {
+		return EncodingBencode
+	}
+	respBuf, err := c.send(ctx, "ping", buf.Bytes(), cookie)
+	if err != nil {
+		return EncodingBencode
+	}
+	c.negotiated = EncodingBencode
+	if _, body, _ := bytes.Cut(respBuf, []byte(" ")); len(body) > 0 && body[0] == '{' {
+		if resp, err := decodeResponse(respBuf); err == nil && resp["result"] == "pong" {
+			c.negotiated = EncodingJSON
+		}
+	}
+	log.Printf("rtpengine: speaking NG with %s encoding", c.negotiated)
+	return c.negotiated
+}
+
+// decodeJSON decodes a JSON-encoded NG dictionary into the types bencode
+// decodes to, so callers need not care which encoding was used: numbers
+// without a fraction become int64.
+func decodeJSON(body []byte) (map[string]interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var resp map[string]interface{}
+	if err := d.Decode(&resp); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil, errTruncated
+		}
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("decoded response is not a map")
+	}
+	return normalizeJSON(resp).(map[string]interface{}), nil
+}
+
+func normalizeJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeJSON(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalizeJSON(v[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,117 @@
+package rtpengine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+func TestDecodeJSONResponse(t *testing.T) {
+	resp, err := decodeResponse([]byte(`c1 {"result":"ok","created":1700000000,"mos":4.2,"tags":{"a":{"medias":[{"index":1}]}}}`))
+	if err != nil {
+		t.Fatalf("decodeResponse() error = %v", err)
+	}
+	if resp["created"] != int64(1700000000) || resp["mos"] != 4.2 {
+		t.Errorf("numbers = %#v, %#v, want int64 and float64", resp["created"], resp["mos"])
+	}
+	details := DecodeCallDetails(resp)
+	if len(details.Tags["a"].Medias) != 1 || details.Created.Unix() != 1700000000 {
+		t.Errorf("DecodeCallDetails() = %+v", details)
+	}
+
+	if _, err := decodeResponse([]byte(`c1 {"result":"ok","calls":["a",`)); !errors.Is(err, errTruncated) {
+		t.Errorf("truncated JSON error = %v, want errTruncated", err)
+	}
+}
+
+func TestReadJSONMessage(t *testing.T) {
+	stream := `c1 {"result":"ok","sdp":"v=0\r\n{[\"}","tags":{"a":[1,{"b":2}]}}c2 d6:result4:ponge`
+	r := bufio.NewReader(strings.NewReader(stream))
+	for _, want := range []string{`c1 {"result":"ok","sdp":"v=0\r\n{[\"}","tags":{"a":[1,{"b":2}]}}`, "c2 d6:result4:ponge"} {
+		msg, err := readMessage(r, maxMessageSize)
+		if err != nil {
+			t.Fatalf("readMessage() error = %v", err)
+		}
+		if string(msg) != want {
+			t.Errorf("readMessage() = %q, want %q", msg, want)
+		}
+	}
+}
+
+func TestEncodingJSON(t *testing.T) {
+	s, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "a"}, {Tag: "b"}}})
+
+	c, err := NewClient(s.Addr(), WithEncoding(EncodingAuto))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	calls, err := c.ListCalls(context.Background(), ListOptions{Limit: 10})
+	if err != nil || len(calls) != 1 {
+		t.Fatalf("ListCalls() = %v, %v", calls, err)
+	}
+	if got := c.(*client).negotiated; got != EncodingJSON {
+		t.Errorf("negotiated %q, want json", got)
+	}
+	resp, err := c.QueryCall(context.Background(), "call-1")
+	if err != nil {
+		t.Fatalf("QueryCall() error = %v", err)
+	}
+	if len(DecodeCallDetails(resp).Tags) != 2 {
+		t.Errorf("QueryCall() = %v, want two tags", resp)
+	}
+
+	if _, err := NewClient(s.Addr(), WithEncoding("xml")); err == nil {
+		t.Error("NewClient() with an unknown encoding error = nil")
+	}
+}
+
+// serveBencodeOnly answers NG requests over UDP like an rtpengine that does
+// not accept JSON.
+func serveBencodeOnly(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		cookie, body, _ := bytes.Cut(buf[:n], []byte(" "))
+		resp := " d6:result4:ponge"
+		if body[0] == '{' {
+			resp = " d6:result5:error12:error-reason32:Could not decode bencode dictionarye"
+		}
+		conn.WriteTo(append(cookie, resp...), addr)
+	}
+}
+
+func TestEncodingAutoFallsBack(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	go serveBencodeOnly(udp)
+
+	c, err := NewClient(udp.LocalAddr().String(), WithEncoding(EncodingAuto))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if got := c.(*client).negotiated; got != EncodingBencode {
+		t.Errorf("negotiated %q, want bencode", got)
+	}
+}
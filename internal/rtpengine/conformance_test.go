@@ -0,0 +1,378 @@
+//go:build conformance
+
+package rtpengine
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+)
+
+// The conformance suite runs every client command against real rtpengine
+// daemons and checks the response fields the monitor relies on, so a change
+// of NG dialect between releases shows up as a failing cell in the matrix.
+//
+// Start the daemons with deploy/conformance/docker-compose.yml and run:
+//
+//	go test -tags conformance ./internal/rtpengine/ -run TestConformance -v
+//
+// CONFORMANCE_TARGETS lists version=address pairs, CONFORMANCE_LOCAL_IP the
+// address put in the synthetic SDP and CONFORMANCE_REPORT, when set, a file
+// the markdown compatibility matrix is written to.
+
+const defaultConformanceTargets = "10=127.0.0.1:22210,11=127.0.0.1:22211,12=127.0.0.1:22212,13=127.0.0.1:22213"
+
+type conformanceCall struct {
+	callID, fromTag, toTag string
+	subscriptionTag        string
+	subscriptionSDP        string
+}
+
+type conformanceStep struct {
+	command string
+	run     func(ctx context.Context, c Client, call *conformanceCall) error
+}
+
+// conformanceSteps run in order on one synthetic call; a step failing skips
+// the steps after it that need the call it would have set up.
+var conformanceSteps = []conformanceStep{
+	{"ping", func(ctx context.Context, c Client, _ *conformanceCall) error {
+		return c.Ping(ctx)
+	}},
+	{"statistics", func(ctx context.Context, c Client, _ *conformanceCall) error {
+		resp, err := c.Statistics(ctx)
+		if err != nil {
+			return err
+		}
+		return requireFields(resp, "currentstatistics")
+	}},
+	{"offer", func(ctx context.Context, c Client, call *conformanceCall) error {
+		resp, err := c.Offer(ctx, call.callID, call.fromTag, conformanceSDP(30000), MediaOptions{})
+		if err != nil {
+			return err
+		}
+		return requireFields(resp, "sdp")
+	}},
+	{"answer", func(ctx context.Context, c Client, call *conformanceCall) error {
+		resp, err := c.Answer(ctx, call.callID, call.fromTag, call.toTag, conformanceSDP(30002), MediaOptions{})
+		if err != nil {
+			return err
+		}
+		return requireFields(resp, "sdp")
+	}},
+	{"list", func(ctx context.Context, c Client, call *conformanceCall) error {
+		calls, err := c.ListCalls(ctx, ListOptions{})
+		if err != nil {
+			return err
+		}
+		for _, id := range calls {
+			if id == call.callID {
+				return nil
+			}
+		}
+		return fmt.Errorf("call missing from list of %d calls", len(calls))
+	}},
+	{"query", func(ctx context.Context, c Client, call *conformanceCall) error {
+		resp, err := c.QueryCall(ctx, call.callID)
+		if err != nil {
+			return err
+		}
+		if err := requireFields(resp, "created", "tags"); err != nil {
+			return err
+		}
+		tags, ok := resp["tags"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("tags is %T, want a dictionary", resp["tags"])
+		}
+		tag, ok := tags[call.fromTag].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("from-tag missing from tags")
+		}
+		if err := requireFields(tag, "medias", "in dialogue with"); err != nil {
+			return fmt.Errorf("tag: %w", err)
+		}
+		medias, _ := tag["medias"].([]interface{})
+		if len(medias) == 0 {
+			return fmt.Errorf("tag has no medias")
+		}
+		media, _ := medias[0].(map[string]interface{})
+		if err := requireFields(media, "type", "codec", "streams"); err != nil {
+			return fmt.Errorf("media: %w", err)
+		}
+		streams, _ := media["streams"].([]interface{})
+		if len(streams) == 0 {
+			return fmt.Errorf("media has no streams")
+		}
+		stream, _ := streams[0].(map[string]interface{})
+		if err := requireFields(stream, "local address", "local port", "endpoint", "stats"); err != nil {
+			return fmt.Errorf("stream: %w", err)
+		}
+		return nil
+	}},
+	{"subscribe request", func(ctx context.Context, c Client, call *conformanceCall) error {
+		resp, err := c.Subscribe(ctx, call.callID, call.fromTag)
+		if err != nil {
+			return err
+		}
+		if err := requireFields(resp, "sdp", "to-tag"); err != nil {
+			return err
+		}
+		call.subscriptionTag, _ = resp["to-tag"].(string)
+		call.subscriptionSDP, _ = resp["sdp"].(string)
+		return nil
+	}},
+	{"subscribe answer", func(ctx context.Context, c Client, call *conformanceCall) error {
+		answer, err := webrtcAnswer(call.subscriptionSDP)
+		if err != nil {
+			return err
+		}
+		_, err = c.SubscribeAnswer(ctx, call.callID, answer, call.subscriptionTag)
+		return err
+	}},
+	{"unsubscribe", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.UnSubscribe(ctx, call.callID, call.subscriptionTag)
+		return err
+	}},
+	{"block media", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.BlockMedia(ctx, call.callID, "")
+		return err
+	}},
+	{"unblock media", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.UnblockMedia(ctx, call.callID, "")
+		return err
+	}},
+	{"silence media", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.SilenceMedia(ctx, call.callID, call.fromTag)
+		return err
+	}},
+	{"unsilence media", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.UnsilenceMedia(ctx, call.callID, call.fromTag)
+		return err
+	}},
+	{"block DTMF", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.BlockDTMF(ctx, call.callID, call.fromTag)
+		return err
+	}},
+	{"unblock DTMF", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.UnblockDTMF(ctx, call.callID, call.fromTag)
+		return err
+	}},
+	{"play DTMF", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.PlayDTMF(ctx, call.callID, call.toTag, "1#", DTMFOptions{Duration: 100})
+		return err
+	}},
+	{"play media", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.PlayMedia(ctx, call.callID, call.toTag, PlayMediaOptions{Blob: conformanceWAV(), RepeatTimes: 2})
+		return err
+	}},
+	{"stop media", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.StopMedia(ctx, call.callID, call.toTag)
+		return err
+	}},
+	{"publish", func(ctx context.Context, c Client, call *conformanceCall) error {
+		resp, err := c.Publish(ctx, call.callID, uuid.New().String(), conformanceSDP(30004), MediaOptions{})
+		if err != nil {
+			return err
+		}
+		return requireFields(resp, "sdp")
+	}},
+	{"start recording", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.StartRecording(ctx, call.callID, "")
+		return err
+	}},
+	{"stop recording", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.StopRecording(ctx, call.callID)
+		return err
+	}},
+	{"delete", func(ctx context.Context, c Client, call *conformanceCall) error {
+		_, err := c.Delete(ctx, call.callID, DeleteOptions{})
+		return err
+	}},
+}
+
+// conformanceDependencies names the step each command needs to have passed.
+var conformanceDependencies = map[string]string{
+	"answer":            "offer",
+	"list":              "offer",
+	"query":             "answer",
+	"subscribe request": "answer",
+	"subscribe answer":  "subscribe request",
+	"unsubscribe":       "subscribe answer",
+	"block media":       "offer",
+	"unblock media":     "block media",
+	"silence media":     "answer",
+	"unsilence media":   "silence media",
+	"block DTMF":        "answer",
+	"unblock DTMF":      "block DTMF",
+	"play DTMF":         "answer",
+	"play media":        "answer",
+	"stop media":        "play media",
+	"publish":           "answer",
+	"start recording":   "offer",
+	"stop recording":    "start recording",
+	"delete":            "offer",
+}
+
+func TestConformance(t *testing.T) {
+	targets := os.Getenv("CONFORMANCE_TARGETS")
+	if targets == "" {
+		targets = defaultConformanceTargets
+	}
+
+	matrix := make(map[string]map[string]string)
+	var versions []string
+	for _, target := range strings.Split(targets, ",") {
+		version, address, ok := strings.Cut(strings.TrimSpace(target), "=")
+		if !ok {
+			t.Fatalf("invalid target %q, want version=address", target)
+		}
+		versions = append(versions, version)
+		matrix[version] = make(map[string]string)
+
+		t.Run("rtpengine-"+version, func(t *testing.T) {
+			c, err := NewClient(address)
+			if err != nil {
+				t.Fatalf("connect to %s: %v", address, err)
+			}
+			defer c.Close()
+
+			call := &conformanceCall{
+				callID:  "conformance-" + uuid.New().String(),
+				fromTag: uuid.New().String(),
+				toTag:   uuid.New().String(),
+			}
+			passed := make(map[string]bool)
+			for _, step := range conformanceSteps {
+				if dep, ok := conformanceDependencies[step.command]; ok && !passed[dep] {
+					matrix[version][step.command] = "skipped"
+					continue
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				err := step.run(ctx, c, call)
+				cancel()
+				if err != nil {
+					t.Errorf("%s: %v", step.command, err)
+					matrix[version][step.command] = "fail: " + err.Error()
+					continue
+				}
+				passed[step.command] = true
+				matrix[version][step.command] = "ok"
+			}
+			if !passed["delete"] && passed["offer"] {
+				c.Delete(context.Background(), call.callID, DeleteOptions{})
+			}
+		})
+	}
+
+	report := conformanceMatrix(versions, matrix)
+	t.Log("\n" + report)
+	if path := os.Getenv("CONFORMANCE_REPORT"); path != "" {
+		if err := os.WriteFile(path, []byte(report), 0o644); err != nil {
+			t.Errorf("write report: %v", err)
+		}
+	}
+}
+
+// conformanceMatrix renders the results as a markdown table with a row per
+// command and a column per rtpengine version.
+func conformanceMatrix(versions []string, matrix map[string]map[string]string) string {
+	sort.Strings(versions)
+	var b strings.Builder
+	b.WriteString("| command |")
+	for _, v := range versions {
+		fmt.Fprintf(&b, " rtpengine %s |", v)
+	}
+	b.WriteString("\n|---|")
+	b.WriteString(strings.Repeat("---|", len(versions)))
+	b.WriteString("\n")
+	for _, step := range conformanceSteps {
+		fmt.Fprintf(&b, "| %s |", step.command)
+		for _, v := range versions {
+			result := matrix[v][step.command]
+			if result == "" {
+				result = "not run"
+			}
+			fmt.Fprintf(&b, " %s |", strings.ReplaceAll(result, "|", `\|`))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func requireFields(resp map[string]interface{}, fields ...string) error {
+	var missing []string
+	for _, f := range fields {
+		if _, ok := resp[f]; !ok {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("response lacks %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func conformanceSDP(port int) string {
+	ip := os.Getenv("CONFORMANCE_LOCAL_IP")
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+	return "v=0\r\n" +
+		"o=- 1 1 IN IP4 " + ip + "\r\n" +
+		"s=rtpengine-mon conformance\r\n" +
+		"c=IN IP4 " + ip + "\r\n" +
+		"t=0 0\r\n" +
+		fmt.Sprintf("m=audio %d RTP/AVP 0\r\n", port) +
+		"a=rtpmap:0 PCMU/8000\r\n" +
+		"a=sendrecv\r\n"
+}
+
+// conformanceWAV is 100ms of 8kHz 16-bit silence.
+func conformanceWAV() []byte {
+	const samples = 800
+	wav := make([]byte, 44+2*samples)
+	copy(wav, "RIFF")
+	binary.LittleEndian.PutUint32(wav[4:], uint32(len(wav)-8))
+	copy(wav[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(wav[16:], 16)
+	binary.LittleEndian.PutUint16(wav[20:], 1)
+	binary.LittleEndian.PutUint16(wav[22:], 1)
+	binary.LittleEndian.PutUint32(wav[24:], 8000)
+	binary.LittleEndian.PutUint32(wav[28:], 16000)
+	binary.LittleEndian.PutUint16(wav[32:], 2)
+	binary.LittleEndian.PutUint16(wav[34:], 16)
+	copy(wav[36:], "data")
+	binary.LittleEndian.PutUint32(wav[40:], 2*samples)
+	return wav
+}
+
+// webrtcAnswer answers a subscription offer the way a browser would.
+func webrtcAnswer(offer string) (string, error) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return "", err
+	}
+	defer pc.Close()
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", fmt.Errorf("subscription offer: %w", err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	<-webrtc.GatheringCompletePromise(pc)
+	return pc.LocalDescription().SDP, nil
+}
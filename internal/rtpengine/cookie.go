@@ -0,0 +1,59 @@
+package rtpengine
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// cookies issues the cookies of one client: a random namespace followed by a
+// sequence number. The namespace is kept for the client's lifetime, so a
+// response can be told apart as a late or repeated answer to one of the
+// client's own requests, e.g. a UDP retransmit, or as one nobody here sent.
+type cookies struct {
+	namespace string
+	seq       atomic.Uint64
+	late      metric.Int64Counter
+	labels    metric.MeasurementOption
+}
+
+func newCookies(meter metric.Meter, labels metric.MeasurementOption) *cookies {
+	b := make([]byte, 4)
+	rand.Read(b)
+	late, _ := meter.Int64Counter("rtpengine.late_responses_total", metric.WithDescription("Total number of RTPEngine responses dropped because no request was waiting for them"))
+	return &cookies{namespace: fmt.Sprintf("%x", b), late: late, labels: labels}
+}
+
+func (c *cookies) next() string {
+	return c.namespace + "-" + strconv.FormatUint(c.seq.Add(1), 16)
+}
+
+// issued reports whether cookie was handed out by c.
+func (c *cookies) issued(cookie string) bool {
+	rest, ok := strings.CutPrefix(cookie, c.namespace+"-")
+	if !ok {
+		return false
+	}
+	seq, err := strconv.ParseUint(rest, 16, 64)
+	return err == nil && seq > 0 && seq <= c.seq.Load()
+}
+
+// stray counts a response that matched no outstanding request: "late" when
+// it answers a request of this client that timed out or was already
+// answered, "unknown" otherwise.
+func (c *cookies) stray(cookie string) {
+	if c == nil {
+		return
+	}
+	kind := "unknown"
+	if c.issued(cookie) {
+		kind = "late"
+	}
+	c.late.Add(context.Background(), 1, c.labels, metric.WithAttributes(attribute.String("kind", kind)))
+}
@@ -0,0 +1,193 @@
+package rtpengine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Endpoints of a client with a backup.
+const (
+	EndpointPrimary = "primary"
+	EndpointBackup  = "backup"
+)
+
+// FailoverPolicy moves a client's requests to a backup NG endpoint while its
+// primary one stops answering, and back once the primary answers again.
+type FailoverPolicy struct {
+	// Address is the backup NG endpoint, e.g. an rtpengine sharing the
+	// primary's calls through Redis.
+	Address string
+	// Failures is how many requests in a row must go unanswered before the
+	// client switches to the other endpoint. Zero means 3.
+	Failures int
+	// ProbeInterval is how often the primary is pinged while the backup is
+	// in use. Zero means 10s.
+	ProbeInterval time.Duration
+	// OnSwitch is called after every switch, from the goroutine that made
+	// it.
+	OnSwitch func(FailoverEvent)
+}
+
+// FailoverEvent reports a client switching NG endpoint.
+type FailoverEvent struct {
+	// From and To are EndpointPrimary or EndpointBackup.
+	From    string
+	To      string
+	Address string
+	Reason  string
+	Time    time.Time
+}
+
+// WithFailover sends requests to a backup NG endpoint while the primary one
+// is unreachable.
+func WithFailover(p FailoverPolicy) Option {
+	return func(c *client) { c.failover = p }
+}
+
+func (p FailoverPolicy) failures() int32 {
+	if p.Failures > 0 {
+		return int32(p.Failures)
+	}
+	return 3
+}
+
+func (p FailoverPolicy) probeInterval() time.Duration {
+	if p.ProbeInterval > 0 {
+		return p.ProbeInterval
+	}
+	return 10 * time.Second
+}
+
+// failoverTransport sends every request to the active one of its two
+// endpoints. Unanswered requests in a row switch it to the other endpoint;
+// while the backup is active, the primary is pinged to fail back to it.
+// Both endpoints share the client's cookies, so a request retried across a
+// switch keeps its cookie.
+type failoverTransport struct {
+	endpoints [2]transport
+	addrs     [2]string
+	policy    FailoverPolicy
+	cookies   *cookies
+	// pingTimeout bounds the pings probing the primary.
+	pingTimeout time.Duration
+
+	active   atomic.Int32
+	failures atomic.Int32
+	// mu serializes switches, so concurrent failures switch once.
+	mu   sync.Mutex
+	stop chan struct{}
+	once sync.Once
+
+	switches     metric.Int64Counter
+	backupActive metric.Int64UpDownCounter
+	labels       func(...attribute.KeyValue) metric.MeasurementOption
+}
+
+func newFailoverTransport(c *client, primary transport, primaryAddr string, backup transport, pingTimeout time.Duration) *failoverTransport {
+	switches, _ := c.meter.Int64Counter("rtpengine.failovers_total", metric.WithDescription("Total number of switches between the primary and backup RTPEngine endpoints"))
+	backupActive, _ := c.meter.Int64UpDownCounter("rtpengine.backup_active", metric.WithDescription("Whether requests go to the backup RTPEngine endpoint"))
+	t := &failoverTransport{
+		endpoints:    [2]transport{primary, backup},
+		addrs:        [2]string{primaryAddr, c.failover.Address},
+		policy:       c.failover,
+		cookies:      c.cookies,
+		pingTimeout:  pingTimeout,
+		stop:         make(chan struct{}),
+		switches:     switches,
+		backupActive: backupActive,
+		labels:       c.metricAttributes,
+	}
+	go t.probe()
+	return t
+}
+
+func (t *failoverTransport) roundTrip(ctx context.Context, msg []byte, cookie string) ([]byte, error) {
+	i := t.active.Load()
+	resp, err := t.endpoints[i].roundTrip(ctx, msg, cookie)
+	switch {
+	case err == nil:
+		t.failures.Store(0)
+	case retryable(err):
+		if t.failures.Add(1) >= t.policy.failures() {
+			t.switchFrom(i, fmt.Sprintf("%d requests in a row went unanswered: %v", t.policy.failures(), err))
+		}
+	}
+	return resp, err
+}
+
+// switchFrom makes the other endpoint active, unless another request
+// already switched away from endpoint i.
+func (t *failoverTransport) switchFrom(i int32, reason string) {
+	t.mu.Lock()
+	if t.active.Load() != i {
+		t.mu.Unlock()
+		return
+	}
+	to := 1 - i
+	t.active.Store(to)
+	t.failures.Store(0)
+	t.mu.Unlock()
+
+	names := [2]string{EndpointPrimary, EndpointBackup}
+	ev := FailoverEvent{From: names[i], To: names[to], Address: t.addrs[to], Reason: reason, Time: time.Now()}
+	ctx := context.Background()
+	t.switches.Add(ctx, 1, t.labels(attribute.String("to", ev.To)))
+	if to == 1 {
+		t.backupActive.Add(ctx, 1, t.labels())
+	} else {
+		t.backupActive.Add(ctx, -1, t.labels())
+	}
+	if t.policy.OnSwitch != nil {
+		t.policy.OnSwitch(ev)
+	}
+}
+
+// probe pings the primary every ProbeInterval while the backup is active,
+// and fails back once it answers.
+func (t *failoverTransport) probe() {
+	ticker := time.NewTicker(t.policy.probeInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+		if t.active.Load() == 0 {
+			continue
+		}
+		if err := t.pingPrimary(); err == nil {
+			t.switchFrom(1, "primary answered a ping")
+		}
+	}
+}
+
+func (t *failoverTransport) pingPrimary() error {
+	ctx, cancel := context.WithTimeout(context.Background(), t.pingTimeout)
+	defer cancel()
+	cookie := t.cookies.next()
+	resp, err := t.endpoints[0].roundTrip(ctx, []byte(cookie+" d7:command4:pinge"), cookie)
+	if err != nil {
+		return err
+	}
+	decoded, err := decodeResponse(resp)
+	if err != nil {
+		return err
+	}
+	if result, _ := decoded["result"].(string); result != "pong" {
+		return fmt.Errorf("unexpected ping result %q", result)
+	}
+	return nil
+}
+
+func (t *failoverTransport) Close() error {
+	t.once.Do(func() { close(t.stop) })
+	t.endpoints[1].Close()
+	return t.endpoints[0].Close()
+}
@@ -0,0 +1,92 @@
+package rtpengine
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// servePong answers every ping over UDP unless silent is set, counting the
+// requests answered.
+func servePong(conn net.PacketConn, silent *atomic.Bool, answered *atomic.Int32) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if silent.Load() {
+			continue
+		}
+		answered.Add(1)
+		cookie, _, _ := strings.Cut(string(buf[:n]), " ")
+		conn.WriteTo([]byte(cookie+" d6:result4:ponge"), addr)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	var primarySilent, backupSilent atomic.Bool
+	var primaryAnswered, backupAnswered atomic.Int32
+	primary, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+	go servePong(primary, &primarySilent, &primaryAnswered)
+	backup, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	go servePong(backup, &backupSilent, &backupAnswered)
+
+	events := make(chan FailoverEvent, 4)
+	c, err := NewClient(primary.LocalAddr().String(),
+		WithRetryPolicy(RetryPolicy{Timeout: 50 * time.Millisecond}),
+		WithFailover(FailoverPolicy{
+			Address:       backup.LocalAddr().String(),
+			Failures:      2,
+			ProbeInterval: 20 * time.Millisecond,
+			OnSwitch:      func(ev FailoverEvent) { events <- ev },
+		}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil || primaryAnswered.Load() != 1 {
+		t.Fatalf("Ping() error = %v, answered by the primary %d times", err, primaryAnswered.Load())
+	}
+
+	primarySilent.Store(true)
+	for range 2 {
+		if err := c.Ping(ctx); err == nil {
+			t.Fatal("Ping() to a silent primary succeeded")
+		}
+	}
+	ev := <-events
+	if ev.From != EndpointPrimary || ev.To != EndpointBackup || ev.Address != backup.LocalAddr().String() {
+		t.Errorf("event = %+v, want a switch to the backup", ev)
+	}
+	if err := c.Ping(ctx); err != nil || backupAnswered.Load() != 1 {
+		t.Fatalf("Ping() error = %v, answered by the backup %d times", err, backupAnswered.Load())
+	}
+
+	primarySilent.Store(false)
+	select {
+	case ev := <-events:
+		if ev.From != EndpointBackup || ev.To != EndpointPrimary {
+			t.Errorf("event = %+v, want a switch back to the primary", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no failback after the primary answered again")
+	}
+	before := primaryAnswered.Load()
+	if err := c.Ping(ctx); err != nil || primaryAnswered.Load() != before+1 {
+		t.Errorf("Ping() error = %v, not answered by the primary after failback", err)
+	}
+}
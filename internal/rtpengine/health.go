@@ -0,0 +1,119 @@
+package rtpengine
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Health is the state of the NG control connection as seen by the last
+// pings.
+type Health struct {
+	Healthy bool `json:"healthy"`
+	// Latency is the round trip of the last successful ping.
+	Latency     time.Duration `json:"latency"`
+	LastCheck   time.Time     `json:"last_check"`
+	LastSuccess time.Time     `json:"last_success"`
+	// Failures counts consecutive failed pings.
+	Failures  int    `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// HealthChecker pings rtpengine in the background so a dead control
+// connection is noticed before a user action times out on it.
+type HealthChecker struct {
+	client   Client
+	interval time.Duration
+	// threshold is how many pings in a row must fail before the connection
+	// is reported unhealthy.
+	threshold int
+
+	mu       sync.RWMutex
+	health   Health
+	onChange []func(Health)
+}
+
+// NewHealthChecker creates a checker pinging client every interval. The
+// connection is assumed healthy until threshold pings fail in a row.
+func NewHealthChecker(client Client, interval time.Duration, threshold int) *HealthChecker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &HealthChecker{
+		client:    client,
+		interval:  interval,
+		threshold: threshold,
+		health:    Health{Healthy: true},
+	}
+}
+
+// OnChange registers fn to be called when the connection turns healthy or
+// unhealthy. It must be registered before Run.
+func (h *HealthChecker) OnChange(fn func(Health)) {
+	h.mu.Lock()
+	h.onChange = append(h.onChange, fn)
+	h.mu.Unlock()
+}
+
+// Health returns the result of the latest pings.
+func (h *HealthChecker) Health() Health {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.health
+}
+
+// Interval is how often rtpengine is pinged.
+func (h *HealthChecker) Interval() time.Duration {
+	return h.interval
+}
+
+// Healthy reports whether rtpengine answered recently enough.
+func (h *HealthChecker) Healthy() bool {
+	return h.Health().Healthy
+}
+
+// Run pings rtpengine every interval until ctx is cancelled.
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *HealthChecker) check(ctx context.Context) {
+	start := time.Now()
+	err := h.client.Ping(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	h.mu.Lock()
+	was := h.health.Healthy
+	h.health.LastCheck = start
+	if err != nil {
+		h.health.Failures++
+		h.health.LastError = err.Error()
+		if h.health.Failures >= h.threshold {
+			h.health.Healthy = false
+		}
+	} else {
+		h.health = Health{Healthy: true, Latency: time.Since(start), LastCheck: start, LastSuccess: start}
+	}
+	health := h.health
+	fns := h.onChange
+	h.mu.Unlock()
+
+	if health.Healthy == was {
+		return
+	}
+	for _, fn := range fns {
+		fn(health)
+	}
+}
@@ -0,0 +1,47 @@
+package rtpengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type pingClient struct {
+	Client
+	err error
+}
+
+func (c *pingClient) Ping(ctx context.Context) error { return c.err }
+
+func TestHealthChecker(t *testing.T) {
+	client := &pingClient{}
+	h := NewHealthChecker(client, time.Second, 2)
+	var changes []bool
+	h.OnChange(func(health Health) { changes = append(changes, health.Healthy) })
+
+	ctx := context.Background()
+	h.check(ctx)
+	if health := h.Health(); !health.Healthy || health.LastSuccess.IsZero() {
+		t.Fatalf("Health() = %+v, want healthy", health)
+	}
+
+	client.err = errors.New("timeout")
+	h.check(ctx)
+	if !h.Healthy() {
+		t.Fatal("unhealthy after a single failed ping")
+	}
+	h.check(ctx)
+	if health := h.Health(); health.Healthy || health.Failures != 2 || health.LastError != "timeout" {
+		t.Fatalf("Health() = %+v, want unhealthy after 2 failures", health)
+	}
+
+	client.err = nil
+	h.check(ctx)
+	if health := h.Health(); !health.Healthy || health.Failures != 0 {
+		t.Fatalf("Health() = %+v, want recovered", health)
+	}
+	if len(changes) != 2 || changes[0] || !changes[1] {
+		t.Errorf("changes = %v, want [false true]", changes)
+	}
+}
@@ -3,11 +3,36 @@ package rtpengine
 import "context"
 
 type Client interface {
-	ListCalls(ctx context.Context) ([]string, error)
+	// ListCalls lists the IDs of the calls rtpengine handles, or a page of
+	// them.
+	ListCalls(ctx context.Context, opts ListOptions) ([]string, error)
 	QueryCall(ctx context.Context, callID string) (map[string]interface{}, error)
 	Subscribe(ctx context.Context, callID, tag string) (map[string]interface{}, error)
+	// SubscribeAll subscribes to the media of every party of a call in one
+	// subscription, the parties' media sections in the order they joined.
+	SubscribeAll(ctx context.Context, callID string) (map[string]interface{}, error)
 	SubscribeAnswer(ctx context.Context, callID, sdp, toTag string) (map[string]interface{}, error)
 	UnSubscribe(ctx context.Context, callID, toTag string) (map[string]interface{}, error)
 	Statistics(ctx context.Context) (map[string]interface{}, error)
+	// Ping checks that rtpengine answers on the control connection.
+	Ping(ctx context.Context) error
+	Offer(ctx context.Context, callID, fromTag, sdp string, opts MediaOptions) (map[string]interface{}, error)
+	Answer(ctx context.Context, callID, fromTag, toTag, sdp string, opts MediaOptions) (map[string]interface{}, error)
+	// Publish originates a media stream of the monitor's own into a call.
+	Publish(ctx context.Context, callID, fromTag, sdp string, opts MediaOptions) (map[string]interface{}, error)
+	Delete(ctx context.Context, callID string, opts DeleteOptions) (map[string]interface{}, error)
+	// BlockMedia, UnblockMedia, SilenceMedia and UnsilenceMedia act on the
+	// media sent by the leg with fromTag, or on every leg when it is empty.
+	BlockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error)
+	UnblockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error)
+	SilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error)
+	UnsilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error)
+	BlockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error)
+	UnblockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error)
+	PlayDTMF(ctx context.Context, callID, fromTag, digits string, opts DTMFOptions) (map[string]interface{}, error)
+	PlayMedia(ctx context.Context, callID, fromTag string, opts PlayMediaOptions) (map[string]interface{}, error)
+	StopMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error)
+	StartRecording(ctx context.Context, callID, path string) (map[string]interface{}, error)
+	StopRecording(ctx context.Context, callID string) (map[string]interface{}, error)
 	Close() error
 }
@@ -0,0 +1,37 @@
+package rtpengine
+
+import (
+	"context"
+	"iter"
+)
+
+// Calls iterates over every call of c, listing pageSize calls at a time, so
+// a dump of a busy rtpengine is processed as it is listed rather than held
+// whole. Calls that start or end during the iteration may be missed; none
+// is yielded twice. An error ends the iteration; a pageSize below one lists
+// every call at once.
+func Calls(ctx context.Context, c Client, pageSize int) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		seen := make(map[string]bool)
+		for offset := 0; ; {
+			page, err := c.ListCalls(ctx, ListOptions{Limit: pageSize, Offset: offset})
+			if err != nil {
+				yield("", err)
+				return
+			}
+			for _, callID := range page {
+				if seen[callID] {
+					continue
+				}
+				seen[callID] = true
+				if !yield(callID, nil) {
+					return
+				}
+			}
+			if pageSize < 1 || len(page) < pageSize {
+				return
+			}
+			offset += len(page)
+		}
+	}
+}
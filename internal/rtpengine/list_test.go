@@ -0,0 +1,89 @@
+package rtpengine
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestListOptions(t *testing.T) {
+	args := map[string]interface{}{}
+	ListOptions{}.apply(args)
+	if args["limit"] != listAll {
+		t.Errorf("zero options ask for limit %v, want every call", args["limit"])
+	}
+	args = map[string]interface{}{}
+	ListOptions{Limit: 10, Offset: 20}.apply(args)
+	if args["limit"] != 30 {
+		t.Errorf("limit = %v, want 30 to cut the page from", args["limit"])
+	}
+
+	calls := []string{"c1", "c2", "c3"}
+	for _, tt := range []struct {
+		opts ListOptions
+		want []string
+	}{
+		{ListOptions{}, calls},
+		{ListOptions{Limit: 2}, []string{"c1", "c2"}},
+		{ListOptions{Limit: 2, Offset: 2}, []string{"c3"}},
+		{ListOptions{Offset: 1}, []string{"c2", "c3"}},
+		{ListOptions{Limit: 2, Offset: 5}, []string{}},
+	} {
+		if got := tt.opts.page(calls); !slices.Equal(got, tt.want) {
+			t.Errorf("%+v.page() = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+}
+
+type pagedClient struct {
+	Client
+	calls  []string
+	err    error
+	listed []ListOptions
+}
+
+func (c *pagedClient) ListCalls(ctx context.Context, opts ListOptions) ([]string, error) {
+	c.listed = append(c.listed, opts)
+	if c.err != nil && len(c.listed) > 1 {
+		return nil, c.err
+	}
+	return opts.page(c.calls), nil
+}
+
+func TestCalls(t *testing.T) {
+	ctx := context.Background()
+	c := &pagedClient{calls: []string{"c1", "c2", "c3", "c4", "c5"}}
+	var got []string
+	for callID, err := range Calls(ctx, c, 2) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, callID)
+	}
+	if !slices.Equal(got, c.calls) || len(c.listed) != 3 {
+		t.Errorf("Calls() = %v in %d pages, want every call in 3", got, len(c.listed))
+	}
+
+	c = &pagedClient{calls: c.calls, err: errors.New("timeout")}
+	got = nil
+	var iterErr error
+	for callID, err := range Calls(ctx, c, 2) {
+		if err != nil {
+			iterErr = err
+			break
+		}
+		got = append(got, callID)
+	}
+	if len(got) != 2 || iterErr == nil {
+		t.Errorf("Calls() = %v, %v, want the first page and the error", got, iterErr)
+	}
+
+	r := NewRegistry([]Node{{Name: "a", Client: &pagedClient{calls: []string{"c1", "c2"}}}, {Name: "b", Client: &pagedClient{calls: []string{"c3"}}}})
+	if calls, err := r.ListCalls(ctx, ListOptions{Limit: 2, Offset: 1}); err != nil || !slices.Equal(calls, []string{"c2", "c3"}) {
+		t.Errorf("Registry.ListCalls() page = %v, %v, want [c2 c3]", calls, err)
+	}
+	if owner, ok := r.Owner("c1"); !ok || owner != "a" {
+		t.Errorf("Owner(c1) = %q, %v after listing a page", owner, ok)
+	}
+}
@@ -0,0 +1,136 @@
+package rtpengine
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+// Exchange is a captured NG request with the response rtpengine sent back.
+type Exchange struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	// Cookie matches the exchange with rtpengine's own log and packet
+	// captures.
+	Cookie     string                 `json:"cookie"`
+	DurationMs float64                `json:"duration_ms"`
+	Request    map[string]interface{} `json:"request"`
+	Response   map[string]interface{} `json:"response,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// NGLog keeps the most recent NG exchanges in a ring buffer. Payloads are
+// sanitized before they are stored: SDP credentials and keys are masked and
+// call IDs and tags go through the redact package.
+type NGLog struct {
+	mu      sync.Mutex
+	entries []Exchange
+	next    int
+	full    bool
+}
+
+// NewNGLog creates a log keeping the last size exchanges.
+func NewNGLog(size int) *NGLog {
+	return &NGLog{entries: make([]Exchange, size)}
+}
+
+// Option configures a client.
+type Option func(*client)
+
+// WithNGLog records every exchange of the client in log.
+func WithNGLog(log *NGLog) Option {
+	return func(c *client) { c.ngLog = log }
+}
+
+func (l *NGLog) record(start time.Time, cookie, command string, req, resp map[string]interface{}, err error) {
+	e := Exchange{
+		Time:       start,
+		Command:    command,
+		Cookie:     cookie,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		Request:    sanitizeMap(req),
+		Response:   sanitizeMap(resp),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Entries returns the captured exchanges, oldest first.
+func (l *NGLog) Entries() []Exchange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]Exchange{}, l.entries[:l.next]...)
+	}
+	return append(append([]Exchange{}, l.entries[l.next:]...), l.entries[:l.next]...)
+}
+
+// sdpSecrets matches SDP attributes carrying credentials or keys.
+var sdpSecrets = regexp.MustCompile(`(?m)^(a=(?:ice-pwd|ice-ufrag):|a=crypto:\S+ \S+ inline:)[^\s|]+`)
+
+func sanitizeSDP(sdp string) string {
+	return sdpSecrets.ReplaceAllString(sdp, "${1}"+redact.Placeholder)
+}
+
+func sanitizeMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		switch k {
+		case "sdp":
+			if s, ok := v.(string); ok {
+				v = sanitizeSDP(s)
+			}
+		case "call-id", "callid":
+			if s, ok := v.(string); ok {
+				v = redact.CallID(s)
+			}
+		case "from-tag", "to-tag", "tag", "in dialogue with":
+			if s, ok := v.(string); ok {
+				v = redact.Tag(s)
+			}
+		case "tags":
+			if tags, ok := v.(map[string]interface{}); ok && redact.Enabled() {
+				// Tags are map keys in query responses; number them so the
+				// entries stay distinct.
+				renamed := make(map[string]interface{}, len(tags))
+				i := 0
+				for _, tag := range tags {
+					i++
+					renamed[fmt.Sprintf("%s-%d", redact.Placeholder, i)] = tag
+				}
+				v = renamed
+			}
+		}
+		out[k] = sanitizeValue(v)
+	}
+	return out
+}
+
+func sanitizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return sanitizeMap(val)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = sanitizeValue(item)
+		}
+		return out
+	}
+	return v
+}
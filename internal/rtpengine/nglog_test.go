@@ -0,0 +1,69 @@
+package rtpengine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+func TestNGLogRing(t *testing.T) {
+	log := NewNGLog(2)
+	for _, command := range []string{"list", "query", "statistics"} {
+		log.record(time.Now(), "c-"+command, command, map[string]interface{}{"command": command}, nil, nil)
+	}
+	entries := log.Entries()
+	if len(entries) != 2 || entries[0].Command != "query" || entries[1].Command != "statistics" || entries[1].Cookie != "c-statistics" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestNGLogSanitizes(t *testing.T) {
+	redact.Enable("salt")
+	defer redact.Disable()
+
+	sdp := "v=0\r\na=ice-ufrag:abcd\r\na=ice-pwd:secretpassword\r\na=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:KEYMATERIAL|2^31\r\na=sendrecv\r\n"
+	log := NewNGLog(4)
+	log.record(time.Now(), "c-1", "offer",
+		map[string]interface{}{"call-id": "call-1", "from-tag": "tag-a", "sdp": sdp},
+		map[string]interface{}{"result": "error", "error-reason": "Unknown flag", "tags": map[string]interface{}{"tag-a": map[string]interface{}{"tag": "tag-a"}}},
+		errors.New("rtpengine error: Unknown flag"))
+
+	e := log.Entries()[0]
+	got := e.Request["sdp"].(string)
+	for _, secret := range []string{"abcd", "secretpassword", "KEYMATERIAL"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("sanitized SDP still contains %q:\n%s", secret, got)
+		}
+	}
+	if !strings.Contains(got, "a=sendrecv") || !strings.Contains(got, "|2^31") {
+		t.Errorf("sanitized SDP lost unrelated content:\n%s", got)
+	}
+	if e.Request["call-id"] == "call-1" || e.Request["from-tag"] != redact.Placeholder {
+		t.Errorf("identifiers not redacted: %+v", e.Request)
+	}
+	if _, ok := e.Response["tags"].(map[string]interface{})["tag-a"]; ok {
+		t.Errorf("tag keys not redacted: %+v", e.Response)
+	}
+	if e.Error == "" || e.Response["error-reason"] != "Unknown flag" {
+		t.Errorf("expected error response to be kept: %+v", e)
+	}
+}
+
+func FuzzSanitizeSDP(f *testing.F) {
+	f.Add("v=0\r\na=ice-ufrag:abcd\r\na=ice-pwd:secretpassword\r\n")
+	f.Add("a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:KEYMATERIAL|2^31\r\n")
+	f.Add("a=ice-pwd:\na=crypto:1 x inline:")
+
+	f.Fuzz(func(t *testing.T, sdp string) {
+		once := sanitizeSDP(sdp)
+		if twice := sanitizeSDP(once); twice != once {
+			t.Errorf("sanitizeSDP is not idempotent: %q -> %q", once, twice)
+		}
+		if strings.Count(once, "\n") != strings.Count(sdp, "\n") {
+			t.Errorf("sanitizeSDP changed the line count of %q", sdp)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package rtpengine
+
+// MediaOptions are the NG options of an offer or answer that shape the media
+// rtpengine negotiates. Zero values are left out so rtpengine applies its
+// defaults.
+type MediaOptions struct {
+	// Flags are plain NG flags such as "trust address", "symmetric" or
+	// "strict source".
+	Flags []string
+	// Replace lists SDP fields to rewrite, e.g. "origin" or
+	// "session-connection".
+	Replace []string
+	// Direction names the interfaces media enters and leaves on, for
+	// rtpengine instances bridging networks.
+	Direction []string
+	// TransportProtocol forces the media protocol of the rewritten SDP, e.g.
+	// "RTP/AVP" or "UDP/TLS/RTP/SAVPF".
+	TransportProtocol string
+	// ICE is "remove", "force", "force-relay" or "default".
+	ICE string
+	// DTLS is "off", "passive" or "active".
+	DTLS string
+	// RTCPMux lists "offer", "require", "demux" or "accept".
+	RTCPMux []string
+	Codec   CodecOptions
+}
+
+// CodecOptions manipulate the codecs of the rewritten SDP. Each list holds
+// codec names such as "PCMU" or "opus", or "all".
+type CodecOptions struct {
+	Strip     []string
+	Offer     []string
+	Transcode []string
+	Mask      []string
+	Accept    []string
+}
+
+// ListOptions select a page of the call list. rtpengine has no cursor: a
+// page is cut from the first Offset+Limit calls it lists, in its own order,
+// which changes as calls come and go.
+type ListOptions struct {
+	// Limit is how many calls to return; zero returns every call.
+	Limit  int
+	Offset int
+}
+
+// listAll is the limit asking rtpengine for every call; it lists 32 when
+// none is given.
+const listAll = 1 << 30
+
+// DeleteOptions narrow a delete to one dialogue of a call or change how it
+// is torn down.
+type DeleteOptions struct {
+	// FromTag and ToTag limit the delete to the branches of these tags.
+	FromTag string
+	ToTag   string
+	// Flags such as "fatal" or "discard recording".
+	Flags []string
+	// DeleteDelay overrides rtpengine's delay before the call is removed, in
+	// seconds. Nil keeps the configured delay.
+	DeleteDelay *int
+}
+
+// DTMFOptions shape the events of play DTMF. Zero values keep rtpengine's
+// defaults.
+type DTMFOptions struct {
+	// Duration of each event and Pause between events, in milliseconds.
+	Duration int
+	Pause    int
+	// Volume in dB below the maximum, as a positive number.
+	Volume int
+}
+
+// PlayMediaOptions name the audio play media plays, either a File on the
+// rtpengine host or a Blob sent along, and how it is played.
+type PlayMediaOptions struct {
+	File string
+	Blob []byte
+	// RepeatTimes plays the audio this many times; zero plays it once.
+	RepeatTimes int
+	// StartPos starts playback this many milliseconds into the audio.
+	StartPos int
+}
+
+func (o MediaOptions) apply(args map[string]interface{}) {
+	setList(args, "flags", o.Flags)
+	setList(args, "replace", o.Replace)
+	setList(args, "direction", o.Direction)
+	setList(args, "rtcp-mux", o.RTCPMux)
+	setString(args, "transport-protocol", o.TransportProtocol)
+	setString(args, "ICE", o.ICE)
+	setString(args, "DTLS", o.DTLS)
+
+	codec := map[string]interface{}{}
+	setList(codec, "strip", o.Codec.Strip)
+	setList(codec, "offer", o.Codec.Offer)
+	setList(codec, "transcode", o.Codec.Transcode)
+	setList(codec, "mask", o.Codec.Mask)
+	setList(codec, "accept", o.Codec.Accept)
+	if len(codec) > 0 {
+		args["codec"] = codec
+	}
+}
+
+func (o ListOptions) apply(args map[string]interface{}) {
+	if o.Limit > 0 {
+		args["limit"] = o.Offset + o.Limit
+	} else {
+		args["limit"] = listAll
+	}
+}
+
+// page cuts the calls of o from a list starting at the first call.
+func (o ListOptions) page(calls []string) []string {
+	if o.Offset >= len(calls) {
+		return []string{}
+	}
+	calls = calls[o.Offset:]
+	if o.Limit > 0 && o.Limit < len(calls) {
+		calls = calls[:o.Limit]
+	}
+	return calls
+}
+
+func (o DeleteOptions) apply(args map[string]interface{}) {
+	setString(args, "from-tag", o.FromTag)
+	setString(args, "to-tag", o.ToTag)
+	setList(args, "flags", o.Flags)
+	if o.DeleteDelay != nil {
+		args["delete-delay"] = *o.DeleteDelay
+	}
+}
+
+func (o DTMFOptions) apply(args map[string]interface{}) {
+	setInt(args, "duration", o.Duration)
+	setInt(args, "pause", o.Pause)
+	setInt(args, "volume", o.Volume)
+}
+
+func (o PlayMediaOptions) apply(args map[string]interface{}) {
+	setString(args, "file", o.File)
+	if len(o.Blob) > 0 {
+		args["blob"] = string(o.Blob)
+	}
+	setInt(args, "repeat-times", o.RepeatTimes)
+	setInt(args, "start-pos", o.StartPos)
+}
+
+func setList(args map[string]interface{}, key string, values []string) {
+	if len(values) > 0 {
+		args[key] = values
+	}
+}
+
+func setString(args map[string]interface{}, key, value string) {
+	if value != "" {
+		args[key] = value
+	}
+}
+
+func setInt(args map[string]interface{}, key string, value int) {
+	if value != 0 {
+		args[key] = value
+	}
+}
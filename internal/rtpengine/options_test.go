@@ -0,0 +1,80 @@
+package rtpengine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMediaOptions(t *testing.T) {
+	args := map[string]interface{}{}
+	MediaOptions{}.apply(args)
+	if len(args) != 0 {
+		t.Errorf("zero options set %v", args)
+	}
+
+	args = map[string]interface{}{}
+	MediaOptions{
+		Flags:             []string{"trust address"},
+		Replace:           []string{"origin"},
+		TransportProtocol: "RTP/AVP",
+		ICE:               "remove",
+		Codec:             CodecOptions{Strip: []string{"all"}, Offer: []string{"PCMU"}},
+	}.apply(args)
+	want := map[string]interface{}{
+		"flags":              []string{"trust address"},
+		"replace":            []string{"origin"},
+		"transport-protocol": "RTP/AVP",
+		"ICE":                "remove",
+		"codec": map[string]interface{}{
+			"strip": []string{"all"},
+			"offer": []string{"PCMU"},
+		},
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestDeleteOptions(t *testing.T) {
+	delay := 0
+	args := map[string]interface{}{}
+	DeleteOptions{FromTag: "a", Flags: []string{"fatal"}, DeleteDelay: &delay}.apply(args)
+	want := map[string]interface{}{
+		"from-tag":     "a",
+		"flags":        []string{"fatal"},
+		"delete-delay": 0,
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestDTMFOptions(t *testing.T) {
+	args := map[string]interface{}{}
+	DTMFOptions{}.apply(args)
+	if len(args) != 0 {
+		t.Errorf("zero options set %v", args)
+	}
+
+	args = map[string]interface{}{}
+	DTMFOptions{Duration: 120, Volume: 8}.apply(args)
+	want := map[string]interface{}{"duration": 120, "volume": 8}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestPlayMediaOptions(t *testing.T) {
+	args := map[string]interface{}{}
+	PlayMediaOptions{File: "/announcements/recorded.wav", RepeatTimes: 2}.apply(args)
+	want := map[string]interface{}{"file": "/announcements/recorded.wav", "repeat-times": 2}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	args = map[string]interface{}{}
+	PlayMediaOptions{Blob: []byte("RIFF")}.apply(args)
+	if args["blob"] != "RIFF" || len(args) != 1 {
+		t.Errorf("args = %v", args)
+	}
+}
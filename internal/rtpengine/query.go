@@ -0,0 +1,83 @@
+package rtpengine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// queryByTag rebuilds the response to a query of a call too large for one
+// datagram, such as a conference, from queries of one party at a time,
+// starting from the tags that arrived before the response was cut short.
+// rtpengine answers a query with a from-tag with that party and the parties
+// it sends media to, whose tags are queried in turn. The totals are left
+// out, as no single response has them for the whole call.
+func (c *client) queryByTag(ctx context.Context, callID string, truncated *TruncatedError) (map[string]interface{}, error) {
+	known, _ := truncated.Partial["tags"].(map[string]interface{})
+	if len(known) == 0 {
+		return nil, truncated
+	}
+	queue := slices.Sorted(maps.Keys(known))
+	queued := make(map[string]bool, len(queue))
+	for _, tag := range queue {
+		queued[tag] = true
+	}
+
+	var merged map[string]interface{}
+	tags := make(map[string]interface{})
+	for len(queue) > 0 {
+		tag := queue[0]
+		queue = queue[1:]
+		resp, err := c.sendCommand(ctx, "query", map[string]interface{}{
+			"call-id":  callID,
+			"from-tag": tag,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query party %s of call after its response was truncated: %w", tag, err)
+		}
+		if merged == nil {
+			merged = resp
+		}
+		party, _ := resp["tags"].(map[string]interface{})
+		for _, t := range slices.Sorted(maps.Keys(party)) {
+			tags[t] = party[t]
+			if !queued[t] {
+				queued[t] = true
+				queue = append(queue, t)
+			}
+		}
+	}
+	merged["tags"] = tags
+	delete(merged, "totals")
+	return merged, nil
+}
+
+// QueryResult is the outcome of querying one call.
+type QueryResult struct {
+	CallID   string
+	Response map[string]interface{}
+	Err      error
+}
+
+// QueryCalls queries the calls with at most concurrency queries in flight,
+// for views of many calls at once, and returns the results in the order of
+// callIDs. A concurrency below one queries them one at a time.
+func QueryCalls(ctx context.Context, c Client, callIDs []string, concurrency int) []QueryResult {
+	results := make([]QueryResult, len(callIDs))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, callID := range callIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp, err := c.QueryCall(ctx, callID)
+			results[i] = QueryResult{CallID: callID, Response: resp, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
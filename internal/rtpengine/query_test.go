@@ -0,0 +1,124 @@
+package rtpengine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackpal/bencode-go"
+
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+// serveConference answers a query of the whole call with a response cut
+// short after the first party, and queries of one party with that party and
+// those it sends media to.
+func serveConference(conn net.PacketConn, parties map[string][]string) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		cookie, body, _ := strings.Cut(string(buf[:n]), " ")
+		decoded, _ := bencode.Decode(strings.NewReader(body))
+		args, _ := decoded.(map[string]interface{})
+		fromTag, _ := args["from-tag"].(string)
+		if fromTag == "" {
+			conn.WriteTo([]byte(cookie+" d6:result2:ok6:totalsde4:tagsd1:ad3:tag1:a5:media"), addr)
+			continue
+		}
+		tags := map[string]interface{}{fromTag: map[string]interface{}{"tag": fromTag}}
+		for _, t := range parties[fromTag] {
+			tags[t] = map[string]interface{}{"tag": t}
+		}
+		var resp bytes.Buffer
+		resp.WriteString(cookie + " ")
+		bencode.Marshal(&resp, map[string]interface{}{"result": "ok", "created": 1700000000, "totals": map[string]interface{}{}, "tags": tags})
+		conn.WriteTo(resp.Bytes(), addr)
+	}
+}
+
+func TestQueryByTag(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	go serveConference(udp, map[string][]string{"a": {"b"}, "b": {"a", "c"}, "c": {"d"}})
+
+	c, err := NewClient(udp.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	resp, err := c.QueryCall(context.Background(), "conf-1")
+	if err != nil {
+		t.Fatalf("QueryCall() error = %v", err)
+	}
+	tags, _ := resp["tags"].(map[string]interface{})
+	var got []string
+	for tag := range tags {
+		got = append(got, tag)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("tags = %v, want a, b, c and d", got)
+	}
+	if _, ok := resp["totals"]; ok {
+		t.Error("totals of a single party kept")
+	}
+
+	// Other commands report what arrived.
+	var truncated *TruncatedError
+	if _, err := c.ListCalls(context.Background(), ListOptions{}); !errors.As(err, &truncated) || truncated.Partial["result"] != "ok" {
+		t.Errorf("ListCalls() error = %v, want TruncatedError with what arrived", err)
+	}
+}
+
+func TestDecodePartial(t *testing.T) {
+	got := decodePartial([]byte("cookie d6:result2:ok4:tagsd1:ad3:tag1:ae1:bd3:tag"))
+	tags, _ := got["tags"].(map[string]interface{})
+	if got["result"] != "ok" || len(tags) != 2 {
+		t.Fatalf("decodePartial() = %v", got)
+	}
+	if b, _ := tags["b"].(map[string]interface{}); b == nil || len(b) != 1 || b["tag"] != nil {
+		t.Errorf("tags[b] = %v, want the tag key without its value", tags["b"])
+	}
+}
+
+func TestQueryCalls(t *testing.T) {
+	s, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "a"}, {Tag: "b"}}})
+	s.AddCall(rtpenginetest.Call{ID: "call-2", Tags: []rtpenginetest.Tag{{Tag: "c"}}})
+
+	c, err := NewClient(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	results := QueryCalls(context.Background(), c, []string{"call-2", "gone", "call-1"}, 2)
+	if len(results) != 3 {
+		t.Fatalf("%d results, want 3", len(results))
+	}
+	for i, want := range []string{"call-2", "gone", "call-1"} {
+		if results[i].CallID != want {
+			t.Errorf("results[%d] is %s, want %s", i, results[i].CallID, want)
+		}
+	}
+	if results[0].Err != nil || len(DecodeCallDetails(results[0].Response).Tags) != 1 {
+		t.Errorf("call-2: %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Error("gone: want an error")
+	}
+}
@@ -0,0 +1,53 @@
+package rtpengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned for commands that could not be sent before
+// their context ended while queued under the limit of WithRateLimit.
+var ErrRateLimited = errors.New("too many rtpengine commands queued")
+
+// WithRateLimit limits the commands sent to rtpengine to perSecond on
+// average, in bursts of up to burst, so a misbehaving dashboard or script
+// cannot flood its control socket. Commands over the limit queue until
+// their turn comes or their context ends. Pings are exempt so health checks
+// see rtpengine rather than the queue. A burst of zero allows one second's
+// worth; a zero rate disables the limit.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *client) {
+		if perSecond <= 0 {
+			return
+		}
+		if burst <= 0 {
+			burst = int(math.Ceil(perSecond))
+		}
+		c.limiter = &rateLimiter{limiter: rate.NewLimiter(rate.Limit(perSecond), burst)}
+	}
+}
+
+type rateLimiter struct {
+	limiter *rate.Limiter
+
+	queuedCounter metric.Int64Counter
+}
+
+// wait returns when command may be sent, or with an error wrapping
+// ErrRateLimited and the reason when ctx ends first or would have by then.
+func (c *client) wait(ctx context.Context, command string) error {
+	if c.limiter == nil || command == "ping" || c.limiter.limiter.Allow() {
+		return nil
+	}
+	c.limiter.queuedCounter.Add(ctx, 1, c.metricAttributes(attribute.String("command", command)))
+	if err := c.limiter.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("%s: %w: %w", command, ErrRateLimited, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package rtpengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+func TestRateLimit(t *testing.T) {
+	s, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "a"}, {Tag: "b"}}})
+
+	c, err := NewClient(s.Addr(), WithRateLimit(10, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := c.QueryCall(ctx, "call-1"); err != nil {
+			t.Fatalf("QueryCall() within the burst error = %v", err)
+		}
+	}
+
+	// The next token is 100ms away, past this deadline.
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.QueryCall(short, "call-1"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("QueryCall() over the limit error = %v, want ErrRateLimited", err)
+	}
+	if err := c.Ping(short); err != nil {
+		t.Errorf("Ping() over the limit error = %v", err)
+	}
+
+	start := time.Now()
+	if _, err := c.QueryCall(ctx, "call-1"); err != nil {
+		t.Errorf("queued QueryCall() error = %v", err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("queued QueryCall() returned after %s, want it to wait for a token", waited)
+	}
+}
@@ -0,0 +1,22 @@
+package rtpengine
+
+import "errors"
+
+// ErrReadOnly is returned for the commands a read-only client refuses.
+var ErrReadOnly = errors.New("the monitor is read-only")
+
+// readCommands are the NG commands that leave calls and subscriptions as
+// they are.
+var readCommands = map[string]bool{
+	"ping":       true,
+	"list":       true,
+	"query":      true,
+	"statistics": true,
+}
+
+// WithReadOnly refuses every command but ping, list, query and statistics
+// with ErrReadOnly before it is sent, so nothing using the client can
+// subscribe to, change or end a call.
+func WithReadOnly() Option {
+	return func(c *client) { c.readOnly = true }
+}
@@ -0,0 +1,40 @@
+package rtpengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+func TestReadOnly(t *testing.T) {
+	s, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "a"}, {Tag: "b"}}})
+
+	c, err := NewClient(s.Addr(), WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, err := c.QueryCall(ctx, "call-1"); err != nil {
+		t.Errorf("QueryCall() error = %v", err)
+	}
+	if _, err := c.SubscribeAll(ctx, "call-1"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SubscribeAll() error = %v, want ErrReadOnly", err)
+	}
+	if _, err := c.Delete(ctx, "call-1", DeleteOptions{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Delete() error = %v, want ErrReadOnly", err)
+	}
+	for _, req := range s.Requests() {
+		if !readCommands[req.Command] {
+			t.Errorf("%s was sent to rtpengine", req.Command)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package rtpengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"sort"
+	"sync"
+)
+
+// Node is one named rtpengine instance of a Registry.
+type Node struct {
+	Name   string
+	Client Client
+}
+
+// Registry spreads the Client interface over several rtpengine instances.
+// ListCalls fans out to every instance; requests about a call go to the
+// instance that owns it, which ListCalls records and a query to every
+// instance finds for calls it has not seen yet. Requests that create a call
+// go to its owner or, for a new call, to the first instance. The instances
+// may change at runtime with SetNodes.
+type Registry struct {
+	mu     sync.RWMutex
+	nodes  []Node
+	owners map[string]string
+}
+
+// errNoInstances is returned while a registry has no instances.
+var errNoInstances = errors.New("no rtpengine instance available")
+
+// NewRegistry creates a registry of nodes.
+func NewRegistry(nodes []Node) *Registry {
+	return &Registry{nodes: nodes, owners: make(map[string]string)}
+}
+
+// Nodes returns the instances of the registry.
+func (r *Registry) Nodes() []Node {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Node(nil), r.nodes...)
+}
+
+// SetNodes replaces the instances of the registry and returns the ones that
+// were dropped, for the caller to close. Instances are matched by name;
+// calls owned by a dropped instance are looked up again on next use.
+func (r *Registry) SetNodes(nodes []Node) []Node {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		kept[n.Name] = true
+	}
+	var removed []Node
+	for _, n := range r.nodes {
+		if !kept[n.Name] {
+			removed = append(removed, n)
+		}
+	}
+	for callID, owner := range r.owners {
+		if !kept[owner] {
+			delete(r.owners, callID)
+		}
+	}
+	r.nodes = append([]Node(nil), nodes...)
+	return removed
+}
+
+// Owner returns the name of the instance known to own callID.
+func (r *Registry) Owner(callID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.owners[callID]
+	return name, ok
+}
+
+// node returns the instance with name.
+func (r *Registry) node(name string) (Node, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, n := range r.nodes {
+		if n.Name == name {
+			return n, true
+		}
+	}
+	return Node{}, false
+}
+
+// fanOut runs fn on every instance at once and returns the instances it ran
+// on with their errors.
+func (r *Registry) fanOut(fn func(i int, n Node) error) ([]Node, []error) {
+	nodes := r.Nodes()
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(i, n); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", n.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return nodes, errs
+}
+
+// ListCalls lists the calls of every instance and records their owners. The
+// calls of instances that fail are left out unless every instance fails. A
+// page is cut from the calls of the instances in order.
+func (r *Registry) ListCalls(ctx context.Context, opts ListOptions) ([]string, error) {
+	var mu sync.Mutex
+	lists := make(map[string][]string)
+	nodeOpts := ListOptions{}
+	if opts.Limit > 0 {
+		nodeOpts.Limit = opts.Offset + opts.Limit
+	}
+	nodes, errs := r.fanOut(func(_ int, n Node) error {
+		calls, err := n.Client.ListCalls(ctx, nodeOpts)
+		mu.Lock()
+		lists[n.Name] = calls
+		mu.Unlock()
+		return err
+	})
+	if len(nodes) == 0 {
+		return nil, errNoInstances
+	}
+
+	owners := make(map[string]string)
+	calls := []string{}
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("rtpengine: failed to list calls of %v", err)
+			failed++
+			continue
+		}
+		for _, callID := range lists[nodes[i].Name] {
+			if _, ok := owners[callID]; !ok {
+				owners[callID] = nodes[i].Name
+				calls = append(calls, callID)
+			}
+		}
+	}
+	if failed == len(nodes) {
+		return nil, errors.Join(errs...)
+	}
+
+	r.mu.Lock()
+	if opts.Limit > 0 {
+		// A page does not list every call, so no owner is forgotten.
+		maps.Copy(r.owners, owners)
+	} else {
+		r.owners = owners
+	}
+	r.mu.Unlock()
+	return opts.page(calls), nil
+}
+
+// route returns the instance owning callID, asking every instance when it
+// is not known.
+func (r *Registry) route(ctx context.Context, callID string) (Node, error) {
+	if name, ok := r.Owner(callID); ok {
+		if n, ok := r.node(name); ok {
+			return n, nil
+		}
+	}
+
+	owner := -1
+	var mu sync.Mutex
+	nodes, errs := r.fanOut(func(i int, n Node) error {
+		if _, err := n.Client.QueryCall(ctx, callID); err != nil {
+			return err
+		}
+		mu.Lock()
+		if owner < 0 || i < owner {
+			owner = i
+		}
+		mu.Unlock()
+		return nil
+	})
+	if len(nodes) == 0 {
+		return Node{}, errNoInstances
+	}
+	if owner < 0 {
+		return Node{}, fmt.Errorf("call not found on any rtpengine instance: %w", errors.Join(errs...))
+	}
+	r.mu.Lock()
+	r.owners[callID] = nodes[owner].Name
+	r.mu.Unlock()
+	return nodes[owner], nil
+}
+
+// routeOrFirst routes requests that may create callID.
+func (r *Registry) routeOrFirst(ctx context.Context, callID string) (Node, error) {
+	if n, err := r.route(ctx, callID); err == nil {
+		return n, nil
+	}
+	nodes := r.Nodes()
+	if len(nodes) == 0 {
+		return Node{}, errNoInstances
+	}
+	return nodes[0], nil
+}
+
+// forget drops the owner of a call that ended.
+func (r *Registry) forget(callID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.owners, callID)
+}
+
+func (r *Registry) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	n, err := r.route(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := n.Client.QueryCall(ctx, callID)
+	if err != nil {
+		// The call ended or moved; find it again next time.
+		r.forget(callID)
+	}
+	return resp, err
+}
+
+func (r *Registry) Subscribe(ctx context.Context, callID, tag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.Subscribe(ctx, callID, tag) })
+}
+
+func (r *Registry) SubscribeAll(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.SubscribeAll(ctx, callID) })
+}
+
+func (r *Registry) SubscribeAnswer(ctx context.Context, callID, sdp, toTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.SubscribeAnswer(ctx, callID, sdp, toTag) })
+}
+
+func (r *Registry) UnSubscribe(ctx context.Context, callID, toTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.UnSubscribe(ctx, callID, toTag) })
+}
+
+// Statistics returns the statistics of every instance under "instances",
+// keyed by name, with the error of instances that failed.
+func (r *Registry) Statistics(ctx context.Context) (map[string]interface{}, error) {
+	var mu sync.Mutex
+	stats := make(map[string]map[string]interface{})
+	nodes, errs := r.fanOut(func(_ int, n Node) error {
+		s, err := n.Client.Statistics(ctx)
+		mu.Lock()
+		stats[n.Name] = s
+		mu.Unlock()
+		return err
+	})
+	if len(nodes) == 0 {
+		return nil, errNoInstances
+	}
+
+	instances := make(map[string]interface{}, len(nodes))
+	failed := 0
+	for i, n := range nodes {
+		if errs[i] != nil {
+			instances[n.Name] = map[string]interface{}{"error": errs[i].Error()}
+			failed++
+			continue
+		}
+		instances[n.Name] = stats[n.Name]
+	}
+	if failed == len(nodes) {
+		return nil, errors.Join(errs...)
+	}
+	return map[string]interface{}{"instances": instances}, nil
+}
+
+// Ping fails when no instance answers.
+func (r *Registry) Ping(ctx context.Context) error {
+	nodes, errs := r.fanOut(func(_ int, n Node) error { return n.Client.Ping(ctx) })
+	if len(nodes) == 0 {
+		return errNoInstances
+	}
+	var down []string
+	for i, err := range errs {
+		if err != nil {
+			down = append(down, nodes[i].Name)
+		}
+	}
+	if len(down) == len(nodes) {
+		return errors.Join(errs...)
+	}
+	if len(down) > 0 {
+		sort.Strings(down)
+		log.Printf("rtpengine: instances not answering: %v", down)
+	}
+	return nil
+}
+
+func (r *Registry) Offer(ctx context.Context, callID, fromTag, sdp string, opts MediaOptions) (map[string]interface{}, error) {
+	n, err := r.routeOrFirst(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+	return n.Client.Offer(ctx, callID, fromTag, sdp, opts)
+}
+
+func (r *Registry) Answer(ctx context.Context, callID, fromTag, toTag, sdp string, opts MediaOptions) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) {
+		return c.Answer(ctx, callID, fromTag, toTag, sdp, opts)
+	})
+}
+
+func (r *Registry) Publish(ctx context.Context, callID, fromTag, sdp string, opts MediaOptions) (map[string]interface{}, error) {
+	n, err := r.routeOrFirst(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+	return n.Client.Publish(ctx, callID, fromTag, sdp, opts)
+}
+
+func (r *Registry) Delete(ctx context.Context, callID string, opts DeleteOptions) (map[string]interface{}, error) {
+	n, err := r.route(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := n.Client.Delete(ctx, callID, opts)
+	if err == nil {
+		r.forget(callID)
+	}
+	return resp, err
+}
+
+// callCommand runs fn with the client of the instance owning callID.
+func (r *Registry) callCommand(ctx context.Context, callID string, fn func(Client) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	n, err := r.route(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+	return fn(n.Client)
+}
+
+func (r *Registry) BlockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.BlockMedia(ctx, callID, fromTag) })
+}
+
+func (r *Registry) UnblockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.UnblockMedia(ctx, callID, fromTag) })
+}
+
+func (r *Registry) SilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.SilenceMedia(ctx, callID, fromTag) })
+}
+
+func (r *Registry) UnsilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.UnsilenceMedia(ctx, callID, fromTag) })
+}
+
+func (r *Registry) BlockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.BlockDTMF(ctx, callID, fromTag) })
+}
+
+func (r *Registry) UnblockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.UnblockDTMF(ctx, callID, fromTag) })
+}
+
+func (r *Registry) PlayDTMF(ctx context.Context, callID, fromTag, digits string, opts DTMFOptions) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.PlayDTMF(ctx, callID, fromTag, digits, opts) })
+}
+
+func (r *Registry) PlayMedia(ctx context.Context, callID, fromTag string, opts PlayMediaOptions) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.PlayMedia(ctx, callID, fromTag, opts) })
+}
+
+func (r *Registry) StopMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.StopMedia(ctx, callID, fromTag) })
+}
+
+func (r *Registry) StartRecording(ctx context.Context, callID, path string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.StartRecording(ctx, callID, path) })
+}
+
+func (r *Registry) StopRecording(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return r.callCommand(ctx, callID, func(c Client) (map[string]interface{}, error) { return c.StopRecording(ctx, callID) })
+}
+
+// Close closes the clients of every instance.
+func (r *Registry) Close() error {
+	var errs []error
+	for _, n := range r.Nodes() {
+		errs = append(errs, n.Client.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package rtpengine
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// fakeNode is an rtpengine instance holding calls. Methods the tests do not
+// use are left to the embedded nil Client.
+type fakeNode struct {
+	Client
+	calls []string
+	down  bool
+
+	mu      sync.Mutex
+	queried []string
+}
+
+func (f *fakeNode) ListCalls(ctx context.Context, opts ListOptions) ([]string, error) {
+	if f.down {
+		return nil, errors.New("timeout")
+	}
+	return opts.page(f.calls), nil
+}
+
+func (f *fakeNode) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	f.mu.Lock()
+	f.queried = append(f.queried, callID)
+	f.mu.Unlock()
+	if f.down || !slices.Contains(f.calls, callID) {
+		return nil, errors.New("rtpengine error: Unknown call-id")
+	}
+	return map[string]interface{}{"result": "ok"}, nil
+}
+
+func (f *fakeNode) Ping(ctx context.Context) error {
+	if f.down {
+		return errors.New("timeout")
+	}
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	a := &fakeNode{calls: []string{"c1", "c2"}}
+	b := &fakeNode{calls: []string{"c3"}}
+	r := NewRegistry([]Node{{Name: "a", Client: a}, {Name: "b", Client: b}})
+	ctx := context.Background()
+
+	calls, err := r.ListCalls(ctx, ListOptions{})
+	if err != nil {
+		t.Fatalf("ListCalls() error = %v", err)
+	}
+	sort.Strings(calls)
+	if !slices.Equal(calls, []string{"c1", "c2", "c3"}) {
+		t.Errorf("ListCalls() = %v", calls)
+	}
+	if owner, _ := r.Owner("c3"); owner != "b" {
+		t.Errorf("Owner(c3) = %q, want b", owner)
+	}
+
+	// Listed calls go straight to their owner.
+	if _, err := r.QueryCall(ctx, "c3"); err != nil {
+		t.Fatalf("QueryCall(c3) error = %v", err)
+	}
+	if len(a.queried) != 0 || len(b.queried) != 1 {
+		t.Errorf("queries a=%v b=%v, want one on b", a.queried, b.queried)
+	}
+
+	// A call started since the listing is found by asking every instance.
+	b.calls = append(b.calls, "c4")
+	if _, err := r.QueryCall(ctx, "c4"); err != nil {
+		t.Fatalf("QueryCall(c4) error = %v", err)
+	}
+	if owner, _ := r.Owner("c4"); owner != "b" {
+		t.Errorf("Owner(c4) = %q, want b", owner)
+	}
+	if _, err := r.QueryCall(ctx, "missing"); err == nil {
+		t.Error("QueryCall(missing) succeeded")
+	}
+
+	// One instance down leaves the others usable.
+	b.down = true
+	if calls, err := r.ListCalls(ctx, ListOptions{}); err != nil || !slices.Equal(calls, []string{"c1", "c2"}) {
+		t.Errorf("ListCalls() with b down = %v, %v", calls, err)
+	}
+	if err := r.Ping(ctx); err != nil {
+		t.Errorf("Ping() with b down error = %v", err)
+	}
+	a.down = true
+	if _, err := r.ListCalls(ctx, ListOptions{}); err == nil {
+		t.Error("ListCalls() succeeded with every instance down")
+	}
+	if err := r.Ping(ctx); err == nil {
+		t.Error("Ping() succeeded with every instance down")
+	}
+}
+
+func TestRegistrySetNodes(t *testing.T) {
+	a := &fakeNode{calls: []string{"c1"}}
+	b := &fakeNode{calls: []string{"c2"}}
+	r := NewRegistry(nil)
+	ctx := context.Background()
+
+	if _, err := r.QueryCall(ctx, "c1"); !errors.Is(err, errNoInstances) {
+		t.Errorf("QueryCall() without instances error = %v, want errNoInstances", err)
+	}
+
+	r.SetNodes([]Node{{Name: "a", Client: a}, {Name: "b", Client: b}})
+	if _, err := r.ListCalls(ctx, ListOptions{}); err != nil {
+		t.Fatalf("ListCalls() error = %v", err)
+	}
+	if owner, _ := r.Owner("c2"); owner != "b" {
+		t.Errorf("Owner(c2) = %q, want b", owner)
+	}
+
+	// The call moved to a new instance replacing b.
+	c := &fakeNode{calls: []string{"c2"}}
+	removed := r.SetNodes([]Node{{Name: "a", Client: a}, {Name: "c", Client: c}})
+	if len(removed) != 1 || removed[0].Name != "b" {
+		t.Errorf("SetNodes() removed %v, want b", removed)
+	}
+	if _, ok := r.Owner("c2"); ok {
+		t.Error("owner of c2 kept after b was removed")
+	}
+	if owner, _ := r.Owner("c1"); owner != "a" {
+		t.Errorf("Owner(c1) = %q, want a", owner)
+	}
+	if _, err := r.QueryCall(ctx, "c2"); err != nil {
+		t.Fatalf("QueryCall(c2) error = %v", err)
+	}
+	if owner, _ := r.Owner("c2"); owner != "c" {
+		t.Errorf("Owner(c2) = %q, want c", owner)
+	}
+}
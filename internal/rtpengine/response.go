@@ -0,0 +1,344 @@
+package rtpengine
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CallDetails is a decoded query response. Fields rtpengine did not send
+// are left zero.
+type CallDetails struct {
+	Created    time.Time
+	LastSignal time.Time
+	Tags       map[string]Tag
+	// SSRCs is what rtpengine knows of each SSRC it received, from RTCP
+	// where the sender reports.
+	SSRCs map[uint32]SSRCStats
+}
+
+// SSRCStats is the quality of the media of one SSRC. The RTCP figures are
+// the latest sample of rtpengine's MOS progression, or the call average
+// before the first, and zero when no RTCP report arrived.
+type SSRCStats struct {
+	Packets     uint64
+	Bytes       uint64
+	MOS         float64
+	JitterMs    float64
+	LossPercent float64
+	RTTMs       float64
+}
+
+// Stream returns the SSRC statistics of the media s receives, summed over
+// its SSRCs, whose RTCP figures are those of the last SSRC reporting them.
+func (d CallDetails) Stream(s StreamStats) (SSRCStats, bool) {
+	var sum SSRCStats
+	found := false
+	for _, ssrc := range s.SSRCs {
+		stats, ok := d.SSRCs[ssrc]
+		if !ok {
+			continue
+		}
+		found = true
+		sum.Packets += stats.Packets
+		sum.Bytes += stats.Bytes
+		if stats.MOS > 0 {
+			sum.MOS, sum.JitterMs, sum.LossPercent, sum.RTTMs = stats.MOS, stats.JitterMs, stats.LossPercent, stats.RTTMs
+		}
+	}
+	return sum, found
+}
+
+// Tag is one party of a call.
+type Tag struct {
+	Tag            string
+	Label          string
+	Created        time.Time
+	InDialogueWith string
+	Medias         []Medium
+}
+
+// Medium is one m= section of a tag's SDP.
+type Medium struct {
+	Index     int
+	Type      string
+	Protocol  string
+	Interface string
+	Codec     string
+	// Codecs lists the negotiated codecs where rtpengine reports them.
+	Codecs  []string
+	Ptime   int
+	Flags   []string
+	Streams []StreamStats
+}
+
+// SRTP reports whether the medium is encrypted, with SDES or DTLS.
+func (m Medium) SRTP() bool {
+	return strings.Contains(m.Protocol, "SAVP")
+}
+
+// CryptoSuite returns the SRTP crypto suite of the medium's streams.
+func (m Medium) CryptoSuite() string {
+	for _, s := range m.Streams {
+		if s.CryptoSuite != "" {
+			return s.CryptoSuite
+		}
+	}
+	return ""
+}
+
+// TelephoneEvent reports whether the medium negotiated RFC 4733 events, and
+// whether rtpengine listed its codecs to tell.
+func (m Medium) TelephoneEvent() (supported, known bool) {
+	for _, codec := range m.Codecs {
+		if strings.HasPrefix(strings.ToLower(codec), "telephone-event/") {
+			return true, true
+		}
+	}
+	return false, len(m.Codecs) > 0
+}
+
+// StreamStats is one stream of a medium: the RTP stream first, then the
+// RTCP one unless it is multiplexed.
+type StreamStats struct {
+	LocalAddress string
+	LocalPort    int
+	// Endpoint is the address the stream receives from, as host:port, or
+	// empty before its first packet.
+	Endpoint    string
+	CryptoSuite string
+	// RTCP marks the stream carrying a medium's RTCP apart from its RTP.
+	RTCP       bool
+	SSRCs      []uint32
+	LastPacket time.Time
+	Packets    uint64
+	Bytes      uint64
+	Errors     uint64
+}
+
+// Statistics is a decoded statistics response.
+type Statistics struct {
+	SessionsOwn     int
+	SessionsForeign int
+	Interfaces      []InterfaceStats
+}
+
+// InterfaceStats is the port usage of one rtpengine interface.
+type InterfaceStats struct {
+	Name      string
+	Address   string
+	PortsUsed int
+	PortsFree int
+	PortsMin  int
+	PortsMax  int
+}
+
+// Sessions returns the number of calls rtpengine handles, its own and the
+// ones it took over from a peer.
+func (s Statistics) Sessions() int {
+	return s.SessionsOwn + s.SessionsForeign
+}
+
+// PortsTotal returns the size of the interface's port range. Older
+// rtpengine versions only report its bounds.
+func (i InterfaceStats) PortsTotal() int {
+	if i.PortsUsed > 0 || i.PortsFree > 0 {
+		return i.PortsUsed + i.PortsFree
+	}
+	if i.PortsMax > 0 {
+		return i.PortsMax - i.PortsMin + 1
+	}
+	return 0
+}
+
+// DecodeCallDetails decodes a query response. It is lenient: values of an
+// unexpected type are skipped, as validateResponse reports them already.
+func DecodeCallDetails(resp map[string]interface{}) CallDetails {
+	d := CallDetails{
+		Created:    unixTime(resp["created"]),
+		LastSignal: unixTime(resp["last signal"]),
+		Tags:       map[string]Tag{},
+	}
+	tags, _ := resp["tags"].(map[string]interface{})
+	for name, v := range tags {
+		raw, _ := v.(map[string]interface{})
+		tag := Tag{
+			Tag:            name,
+			Label:          str(raw["label"]),
+			Created:        unixTime(raw["created"]),
+			InDialogueWith: str(raw["in dialogue with"]),
+		}
+		medias, _ := raw["medias"].([]interface{})
+		for i, m := range medias {
+			media, _ := m.(map[string]interface{})
+			tag.Medias = append(tag.Medias, decodeMedium(media, i+1))
+		}
+		d.Tags[name] = tag
+	}
+	ssrcs, _ := resp["SSRC"].(map[string]interface{})
+	for key, v := range ssrcs {
+		ssrc, err := strconv.ParseUint(key, 10, 32)
+		raw, ok := v.(map[string]interface{})
+		if err != nil || !ok {
+			continue
+		}
+		if d.SSRCs == nil {
+			d.SSRCs = make(map[uint32]SSRCStats, len(ssrcs))
+		}
+		d.SSRCs[uint32(ssrc)] = decodeSSRC(raw)
+	}
+	return d
+}
+
+// decodeSSRC reads an entry of the "SSRC" section, where rtpengine reports
+// MOS times ten and the round-trip time in microseconds.
+func decodeSSRC(raw map[string]interface{}) SSRCStats {
+	s := SSRCStats{Packets: uint64(integer(raw["packets"])), Bytes: uint64(integer(raw["bytes"]))}
+	sample, _ := raw["average MOS"].(map[string]interface{})
+	if progression, ok := raw["MOS progression"].(map[string]interface{}); ok {
+		if entries, ok := progression["entries"].([]interface{}); ok && len(entries) > 0 {
+			if last, ok := entries[len(entries)-1].(map[string]interface{}); ok {
+				sample = last
+			}
+		}
+	}
+	if mos := float(sample["MOS"]); mos > 0 {
+		s.MOS = mos / 10
+		s.JitterMs = float(sample["jitter"])
+		s.LossPercent = float(sample["packet loss"])
+		s.RTTMs = float(sample["round-trip time"]) / 1000
+	}
+	return s
+}
+
+func decodeMedium(raw map[string]interface{}, index int) Medium {
+	m := Medium{
+		Index:     index,
+		Type:      str(raw["type"]),
+		Protocol:  str(raw["protocol"]),
+		Interface: str(raw["interface"]),
+		Codec:     str(raw["codec"]),
+		Codecs:    strs(raw["codecs"]),
+		Ptime:     int(integer(raw["ptime"])),
+		Flags:     strs(raw["flags"]),
+	}
+	if _, ok := raw["index"]; ok {
+		m.Index = int(integer(raw["index"]))
+	}
+	streams, _ := raw["streams"].([]interface{})
+	for _, s := range streams {
+		stream, _ := s.(map[string]interface{})
+		m.Streams = append(m.Streams, decodeStream(stream))
+	}
+	return m
+}
+
+func decodeStream(raw map[string]interface{}) StreamStats {
+	s := StreamStats{
+		LocalAddress: str(raw["local address"]),
+		LocalPort:    int(integer(raw["local port"])),
+		LastPacket:   unixTime(raw["last packet"]),
+		CryptoSuite:  str(raw["crypto suite"]),
+		RTCP:         slices.Contains(strs(raw["flags"]), "RTCP"),
+	}
+	if ep, ok := raw["endpoint"].(map[string]interface{}); ok && str(ep["address"]) != "" {
+		s.Endpoint = fmt.Sprintf("%s:%d", str(ep["address"]), integer(ep["port"]))
+	}
+	// Newer versions list every SSRC received under "ingress SSRCs".
+	if v, ok := raw["SSRC"]; ok {
+		s.SSRCs = append(s.SSRCs, uint32(integer(v)))
+	}
+	ingress, _ := raw["ingress SSRCs"].([]interface{})
+	for _, i := range ingress {
+		if entry, ok := i.(map[string]interface{}); ok {
+			if v, ok := entry["SSRC"]; ok && !slices.Contains(s.SSRCs, uint32(integer(v))) {
+				s.SSRCs = append(s.SSRCs, uint32(integer(v)))
+			}
+		}
+	}
+	if stats, ok := raw["stats"].(map[string]interface{}); ok {
+		s.Packets = uint64(integer(stats["packets"]))
+		s.Bytes = uint64(integer(stats["bytes"]))
+		s.Errors = uint64(integer(stats["errors"]))
+	}
+	return s
+}
+
+// DecodeStatistics decodes a statistics response, whose values rtpengine
+// nests under "statistics".
+func DecodeStatistics(resp map[string]interface{}) Statistics {
+	if inner, ok := resp["statistics"].(map[string]interface{}); ok {
+		resp = inner
+	}
+	var s Statistics
+	if current, ok := resp["currentstatistics"].(map[string]interface{}); ok {
+		s.SessionsOwn = int(integer(current["sessionsown"]))
+		s.SessionsForeign = int(integer(current["sessionsforeign"]))
+	}
+	interfaces, _ := resp["interfaces"].([]interface{})
+	for _, raw := range interfaces {
+		iface, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stats := InterfaceStats{Name: str(iface["name"]), Address: str(iface["address"])}
+		if ports, ok := iface["ports"].(map[string]interface{}); ok {
+			stats.PortsUsed = int(integer(ports["used"]))
+			stats.PortsFree = int(integer(ports["free"]))
+			stats.PortsMin = int(integer(ports["min"]))
+			stats.PortsMax = int(integer(ports["max"]))
+		}
+		s.Interfaces = append(s.Interfaces, stats)
+	}
+	return s
+}
+
+// integer reads a number that bencode decodes as int64, JSON as float64,
+// and that some rtpengine versions send as a decimal string.
+func integer(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	}
+	return 0
+}
+
+// float reads a number that may also be fractional.
+func float(v interface{}) float64 {
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	return float64(integer(v))
+}
+
+func unixTime(v interface{}) time.Time {
+	if sec := integer(v); sec > 0 {
+		return time.Unix(sec, 0)
+	}
+	return time.Time{}
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func strs(v interface{}) []string {
+	list, _ := v.([]interface{})
+	var out []string
+	for _, e := range list {
+		if s, ok := e.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
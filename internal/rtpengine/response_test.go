@@ -0,0 +1,108 @@
+package rtpengine
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The payloads in testdata are NG responses as rtpengine sends them.
+func decodeTestdata(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+	datagram, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := decodeResponse(datagram)
+	if err != nil {
+		t.Fatalf("decodeResponse(%s) error = %v", name, err)
+	}
+	return resp
+}
+
+func TestDecodeCallDetails(t *testing.T) {
+	d := DecodeCallDetails(decodeTestdata(t, "query.ng"))
+
+	if !d.Created.Equal(time.Unix(1718000000, 0)) || !d.LastSignal.Equal(time.Unix(1718000002, 0)) {
+		t.Errorf("Created, LastSignal = %s, %s", d.Created, d.LastSignal)
+	}
+	if len(d.Tags) != 2 {
+		t.Fatalf("got %d tags, want 2", len(d.Tags))
+	}
+
+	caller := d.Tags["as7d9f2"]
+	if caller.Label != "caller" || caller.InDialogueWith != "bk39xq1" || !caller.Created.Equal(time.Unix(1718000000, 0)) {
+		t.Errorf("caller = %+v", caller)
+	}
+	if len(caller.Medias) != 1 {
+		t.Fatalf("caller has %d medias, want 1", len(caller.Medias))
+	}
+	media := caller.Medias[0]
+	if media.Index != 1 || media.Type != "audio" || media.Protocol != "RTP/AVP" || !reflect.DeepEqual(media.Flags, []string{"initialized", "send", "recv"}) {
+		t.Errorf("media = %+v", media)
+	}
+	if len(media.Streams) != 2 {
+		t.Fatalf("media has %d streams, want 2", len(media.Streams))
+	}
+
+	want := StreamStats{
+		LocalAddress: "203.0.113.5",
+		LocalPort:    30000,
+		Endpoint:     "198.51.100.20:16384",
+		SSRCs:        []uint32{3735928559},
+		LastPacket:   time.Unix(1718000125, 0),
+		Packets:      6250,
+		Bytes:        1075000,
+	}
+	if rtp := media.Streams[0]; !reflect.DeepEqual(rtp, want) {
+		t.Errorf("RTP stream = %+v, want %+v", rtp, want)
+	}
+	if rtcp := media.Streams[1]; rtcp.LocalPort != 30001 || !rtcp.RTCP || rtcp.SSRCs != nil || rtcp.Packets != 12 {
+		t.Errorf("RTCP stream = %+v", rtcp)
+	}
+	if ssrc, ok := d.Stream(media.Streams[0]); !ok || ssrc != (SSRCStats{Packets: 1400, Bytes: 240800}) {
+		t.Errorf("Stream(RTP) = %+v, %v", ssrc, ok)
+	}
+	if _, ok := d.Stream(media.Streams[1]); ok {
+		t.Error("Stream(RTCP) found SSRC statistics")
+	}
+}
+
+func TestDecodeStatistics(t *testing.T) {
+	s := DecodeStatistics(decodeTestdata(t, "statistics.ng"))
+
+	if s.SessionsOwn != 42 || s.SessionsForeign != 3 || s.Sessions() != 45 {
+		t.Errorf("sessions = %d own, %d foreign", s.SessionsOwn, s.SessionsForeign)
+	}
+	want := []InterfaceStats{
+		{Name: "internal", Address: "10.0.0.5", PortsUsed: 120, PortsFree: 9880, PortsMin: 30000, PortsMax: 39999},
+		{Name: "external", Address: "203.0.113.5", PortsUsed: 60, PortsFree: 9940, PortsMin: 40000, PortsMax: 49999},
+	}
+	if !reflect.DeepEqual(s.Interfaces, want) {
+		t.Errorf("Interfaces = %+v, want %+v", s.Interfaces, want)
+	}
+	if total := s.Interfaces[0].PortsTotal(); total != 10000 {
+		t.Errorf("PortsTotal() = %d, want 10000", total)
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	d := DecodeCallDetails(map[string]interface{}{
+		"created": float64(1718000000),
+		"tags": map[string]interface{}{
+			"a": map[string]interface{}{"created": "1718000001", "medias": "bogus"},
+			"b": "bogus",
+		},
+	})
+	if !d.Created.Equal(time.Unix(1718000000, 0)) || !d.Tags["a"].Created.Equal(time.Unix(1718000001, 0)) {
+		t.Errorf("DecodeCallDetails() = %+v", d)
+	}
+	if b, ok := d.Tags["b"]; !ok || !b.Created.IsZero() || b.Medias != nil {
+		t.Errorf("tag b = %+v, want an empty tag", b)
+	}
+
+	if total := (InterfaceStats{PortsMin: 30000, PortsMax: 30099}).PortsTotal(); total != 100 {
+		t.Errorf("PortsTotal() from the range = %d, want 100", total)
+	}
+}
@@ -0,0 +1,90 @@
+package rtpengine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// cookieCacheWindow bounds how long a command that changes state is
+// retried. rtpengine answers a repeated cookie from its cookie cache for
+// about 30s; a retry after that could run the command a second time.
+const cookieCacheWindow = 20 * time.Second
+
+// idempotentCommands may be repeated at any time without effect.
+var idempotentCommands = map[string]bool{
+	"ping":       true,
+	"list":       true,
+	"query":      true,
+	"statistics": true,
+}
+
+// RetryPolicy sets the timeouts of NG requests and how requests that got no
+// response are retried.
+type RetryPolicy struct {
+	// Timeout bounds one attempt, unless CommandTimeouts names the command.
+	// Zero means 2s.
+	Timeout         time.Duration
+	CommandTimeouts map[string]time.Duration
+	// Retries is how many times a request is repeated after an attempt
+	// timed out or could not connect. The first retry waits Backoff, each
+	// further one twice as long as the one before.
+	Retries int
+	Backoff time.Duration
+}
+
+// WithRetryPolicy sets the timeouts and retries of the client's requests.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *client) { c.retry = p }
+}
+
+func (p RetryPolicy) timeout(command string) time.Duration {
+	if d, ok := p.CommandTimeouts[command]; ok && d > 0 {
+		return d
+	}
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return ngTimeout
+}
+
+// retryable reports whether an attempt failed without reaching rtpengine or
+// without an answer. Error responses are never retried.
+func retryable(err error) bool {
+	var te *transportError
+	if !errors.As(err, &te) {
+		return false
+	}
+	return te.op == "dial" || isTimeout(err)
+}
+
+// send runs the attempts of one request. Every attempt carries the same
+// cookie, so rtpengine answers a repeated request from its cookie cache
+// rather than running it twice; commands that change state are only
+// retried while that cache still holds the cookie.
+func (c *client) send(ctx context.Context, command string, msg []byte, cookie string) ([]byte, error) {
+	start := time.Now()
+	timeout := c.retry.timeout(command)
+	backoff := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := c.roundTrip(ctx, c.transport, timeout, msg, cookie)
+		if err == nil || attempt > c.retry.Retries || !retryable(err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if !idempotentCommands[command] && time.Since(start)+backoff+timeout > cookieCacheWindow {
+			return resp, err
+		}
+
+		c.retryCounter.Add(ctx, 1, c.metricAttributes(attribute.String("command", command)))
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt+1), attribute.String("error", err.Error())))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
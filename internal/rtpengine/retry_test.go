@@ -0,0 +1,99 @@
+package rtpengine
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveDropping ignores the first drop requests and answers the rest,
+// reporting the cookie of every request received.
+func serveDropping(conn net.PacketConn, drop int, cookies chan<- string) {
+	buf := make([]byte, 65535)
+	for i := 0; ; i++ {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		cookie, rest, _ := strings.Cut(string(buf[:n]), " ")
+		cookies <- cookie
+		if i < drop {
+			continue
+		}
+		if strings.Contains(rest, "5:offer") {
+			conn.WriteTo([]byte(cookie+" d6:result5:error12:error-reason4:nopee"), addr)
+			continue
+		}
+		conn.WriteTo([]byte(cookie+" d6:result4:ponge"), addr)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	cookies := make(chan string, 10)
+	go serveDropping(udp, 2, cookies)
+
+	c, err := NewClient(udp.LocalAddr().String(), WithRetryPolicy(RetryPolicy{Timeout: 50 * time.Millisecond, Retries: 2, Backoff: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	first := <-cookies
+	for i := 0; i < 2; i++ {
+		if retried := <-cookies; retried != first {
+			t.Errorf("retry %d carried cookie %q, want %q", i+1, retried, first)
+		}
+	}
+
+	// Error responses are final.
+	if _, err := c.Offer(context.Background(), "c1", "a", "v=0", MediaOptions{}); err == nil {
+		t.Fatal("Offer() succeeded")
+	}
+	<-cookies
+	select {
+	case cookie := <-cookies:
+		t.Errorf("error response was retried with cookie %q", cookie)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	cookies := make(chan string, 10)
+	go serveDropping(udp, 10, cookies)
+
+	c, err := NewClient(udp.LocalAddr().String(), WithRetryPolicy(RetryPolicy{
+		Timeout:         time.Second,
+		CommandTimeouts: map[string]time.Duration{"ping": 20 * time.Millisecond},
+		Retries:         1,
+	}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	if err := c.Ping(context.Background()); !isTimeout(err) {
+		t.Fatalf("Ping() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Ping() took %s, want the ping timeout to apply", elapsed)
+	}
+	if len(cookies) != 2 {
+		t.Errorf("got %d attempts, want 2", len(cookies))
+	}
+}
@@ -0,0 +1,157 @@
+package rtpengine
+
+import (
+	"cmp"
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// WithSubscriptionTags names the subscriptions the client creates after
+// instance, so a restarted instance can recognize the ones it left behind,
+// and adds the instance to their labels.
+func WithSubscriptionTags(instance string) Option {
+	return func(c *client) { c.instance = instance }
+}
+
+// SubscriptionTagPrefix is the prefix of the subscription tags created by
+// instance.
+func SubscriptionTagPrefix(instance string) string {
+	return "rtpengine-mon-" + strings.ReplaceAll(instance, " ", "_") + "-"
+}
+
+// IsSubscriptionTag reports whether tag names a subscription created by
+// instance. The random suffix must be intact, so instance "a" does not claim
+// the tags of instance "a-b".
+func IsSubscriptionTag(tag, instance string) bool {
+	rest, ok := strings.CutPrefix(tag, SubscriptionTagPrefix(instance))
+	if !ok {
+		return false
+	}
+	_, err := uuid.Parse(rest)
+	return err == nil && len(rest) == 36
+}
+
+func (c *client) subscriptionTag() string {
+	if c.instance == "" {
+		return ""
+	}
+	return SubscriptionTagPrefix(c.instance) + uuid.New().String()
+}
+
+// Purposes of subscriptions, as shown in their labels.
+const (
+	PurposeSpy     = "spy"
+	PurposeShadow  = "shadow"
+	PurposeRefresh = "refresh"
+	PurposeFollow  = "follow"
+	PurposeRestore = "restore"
+	PurposeProbe   = "probe"
+)
+
+// Label describes who holds a subscription and why. It is sent with
+// subscribe requests so our subscriptions can be told apart in rtpengine's
+// query output and other tools watching it.
+type Label struct {
+	// User is the principal that asked for the subscription, e.g. a hashed
+	// API key. It is empty for background jobs.
+	User    string
+	Purpose string
+}
+
+type labelKey struct{}
+
+// WithLabel attaches the label of subscriptions created with ctx.
+func WithLabel(ctx context.Context, label Label) context.Context {
+	return context.WithValue(ctx, labelKey{}, label)
+}
+
+// LabelFromContext returns the label attached to ctx, if any.
+func LabelFromContext(ctx context.Context) Label {
+	label, _ := ctx.Value(labelKey{}).(Label)
+	return label
+}
+
+// subscriptionLabel renders label as "rtpengine-mon;instance=...;purpose=...;user=...",
+// leaving out empty parts.
+func (c *client) subscriptionLabel(label Label) string {
+	parts := []string{"rtpengine-mon"}
+	for _, kv := range [][2]string{{"instance", c.instance}, {"purpose", label.Purpose}, {"user", label.User}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+strings.ReplaceAll(kv[1], ";", "_"))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// DefaultSubscribeOptions shape subscriptions for the monitor's WebRTC
+// listeners: one ICE, DTLS-SRTP stream per party, transcoded to PCMU.
+var DefaultSubscribeOptions = MediaOptions{
+	Flags:             []string{"trust-address", "generate-mid", "SDES-off", "no-rtcp-attribute", "trickle-ICE"},
+	RTCPMux:           []string{"offer", "require"},
+	TransportProtocol: "UDP/TLS/RTP/SAVPF",
+	ICE:               "force",
+	Codec:             CodecOptions{Strip: []string{"all"}, Transcode: []string{"PCMU"}},
+}
+
+// WithSubscribeOptions overrides DefaultSubscribeOptions for the
+// subscriptions the client creates, e.g. for rtpengine versions that reject
+// SDES-off. Each field set replaces the default one; any codec list set
+// replaces the default codec options.
+func WithSubscribeOptions(opts MediaOptions) Option {
+	return func(c *client) { c.subscribeOptions = opts }
+}
+
+type subscribeOptionsKey struct{}
+
+// WithSubscribeOverrides overrides the client's subscribe options, field by
+// field, for subscriptions created with ctx.
+func WithSubscribeOverrides(ctx context.Context, opts MediaOptions) context.Context {
+	return context.WithValue(ctx, subscribeOptionsKey{}, opts)
+}
+
+func subscribeOptionsFromContext(ctx context.Context) MediaOptions {
+	opts, _ := ctx.Value(subscribeOptionsKey{}).(MediaOptions)
+	return opts
+}
+
+type reusedSubscriptionsKey struct{}
+
+// WithReusedSubscriptions has subscriptions created with ctx reuse the
+// to-tags of subscriptions still live on rtpengine, which then renegotiates
+// them in place instead of adding new ones. tags maps the from-tag
+// subscribed to, or "" for a subscription to all media, to the to-tag.
+func WithReusedSubscriptions(ctx context.Context, tags map[string]string) context.Context {
+	return context.WithValue(ctx, reusedSubscriptionsKey{}, tags)
+}
+
+func reusedSubscription(ctx context.Context, fromTag string) (string, bool) {
+	tags, _ := ctx.Value(reusedSubscriptionsKey{}).(map[string]string)
+	toTag, ok := tags[fromTag]
+	return toTag, ok
+}
+
+// override returns o with the fields set in with replacing its own.
+func (o MediaOptions) override(with MediaOptions) MediaOptions {
+	if len(with.Flags) > 0 {
+		o.Flags = with.Flags
+	}
+	if len(with.Replace) > 0 {
+		o.Replace = with.Replace
+	}
+	if len(with.Direction) > 0 {
+		o.Direction = with.Direction
+	}
+	if len(with.RTCPMux) > 0 {
+		o.RTCPMux = with.RTCPMux
+	}
+	o.TransportProtocol = cmp.Or(with.TransportProtocol, o.TransportProtocol)
+	o.ICE = cmp.Or(with.ICE, o.ICE)
+	o.DTLS = cmp.Or(with.DTLS, o.DTLS)
+	if !reflect.DeepEqual(with.Codec, CodecOptions{}) {
+		o.Codec = with.Codec
+	}
+	return o
+}
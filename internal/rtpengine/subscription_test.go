@@ -0,0 +1,127 @@
+package rtpengine
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+func TestIsSubscriptionTag(t *testing.T) {
+	c := &client{instance: "mon-1"}
+	tag := c.subscriptionTag()
+
+	tests := []struct {
+		tag      string
+		instance string
+		want     bool
+	}{
+		{tag, "mon-1", true},
+		{tag, "mon", false},
+		{tag, "mon-2", false},
+		{SubscriptionTagPrefix("mon-1-b") + tag[len(SubscriptionTagPrefix("mon-1")):], "mon-1", false},
+		{SubscriptionTagPrefix("mon-1") + "not-a-uuid", "mon-1", false},
+		{"caller-tag", "mon-1", false},
+	}
+	for _, tt := range tests {
+		if got := IsSubscriptionTag(tt.tag, tt.instance); got != tt.want {
+			t.Errorf("IsSubscriptionTag(%q, %q) = %v, want %v", tt.tag, tt.instance, got, tt.want)
+		}
+	}
+
+	if (&client{}).subscriptionTag() != "" {
+		t.Error("expected no tag without a prefix")
+	}
+}
+
+func TestSubscriptionLabel(t *testing.T) {
+	tests := []struct {
+		instance string
+		label    Label
+		want     string
+	}{
+		{"mon-1", Label{User: "key:ab12", Purpose: PurposeSpy}, "rtpengine-mon;instance=mon-1;purpose=spy;user=key:ab12"},
+		{"mon-1", Label{Purpose: PurposeShadow}, "rtpengine-mon;instance=mon-1;purpose=shadow"},
+		{"", Label{}, "rtpengine-mon"},
+		{"a;b", Label{User: "x;y"}, "rtpengine-mon;instance=a_b;user=x_y"},
+	}
+	for _, tt := range tests {
+		c := &client{instance: tt.instance}
+		if got := c.subscriptionLabel(tt.label); got != tt.want {
+			t.Errorf("subscriptionLabel(%+v) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+
+	ctx := WithLabel(context.Background(), Label{Purpose: PurposeFollow})
+	if got := LabelFromContext(ctx); got.Purpose != PurposeFollow {
+		t.Errorf("LabelFromContext() = %+v", got)
+	}
+}
+
+func TestSubscribeOptions(t *testing.T) {
+	s, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "a"}, {Tag: "b"}}})
+
+	c, err := NewClient(s.Addr(), WithSubscribeOptions(MediaOptions{
+		Flags: []string{"trust-address", "generate-mid"},
+		ICE:   "default",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := WithSubscribeOverrides(context.Background(), MediaOptions{TransportProtocol: "RTP/SAVPF"})
+	if _, err := c.SubscribeAll(ctx, "call-1"); err != nil {
+		t.Fatalf("SubscribeAll() error = %v", err)
+	}
+	reqs := s.Requests()
+	args := reqs[len(reqs)-1].Args
+	want := map[string]interface{}{
+		"flags":              []interface{}{"trust-address", "generate-mid", "all"},
+		"rtcp-mux":           []interface{}{"offer", "require"},
+		"transport-protocol": "RTP/SAVPF",
+		"ICE":                "default",
+		"codec":              map[string]interface{}{"strip": []interface{}{"all"}, "transcode": []interface{}{"PCMU"}},
+	}
+	for key, v := range want {
+		if !reflect.DeepEqual(args[key], v) {
+			t.Errorf("%s = %v, want %v", key, args[key], v)
+		}
+	}
+	if !slices.Contains(DefaultSubscribeOptions.Flags, "SDES-off") {
+		t.Error("subscribing changed DefaultSubscribeOptions")
+	}
+}
+
+func TestReusedSubscriptions(t *testing.T) {
+	s, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "a"}, {Tag: "b"}}})
+
+	c, err := NewClient(s.Addr(), WithSubscriptionTags("mon-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := WithReusedSubscriptions(context.Background(), map[string]string{"a": "kept-a"})
+	for _, tag := range []string{"a", "b"} {
+		if _, err := c.Subscribe(ctx, "call-1", tag); err != nil {
+			t.Fatalf("Subscribe(%s) error = %v", tag, err)
+		}
+	}
+	got := s.Subscriptions("call-1")
+	if len(got) != 2 || got[0] != "kept-a" || !IsSubscriptionTag(got[1], "mon-1") {
+		t.Errorf("subscriptions = %v, want kept-a and a new one", got)
+	}
+}
@@ -0,0 +1,503 @@
+package rtpengine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Transports of the NG control protocol.
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+)
+
+// maxMessageSize bounds an NG response read from a TCP stream, where no
+// datagram limits it.
+const maxMessageSize = 64 << 20
+
+// transport carries NG messages, a cookie, a space and a bencoded
+// dictionary, to rtpengine. Round trips may run concurrently; responses are
+// matched to their requests by cookie.
+type transport interface {
+	// roundTrip sends msg and returns the response carrying cookie, or an
+	// error once ctx is done.
+	roundTrip(ctx context.Context, msg []byte, cookie string) ([]byte, error)
+	Close() error
+}
+
+// WithTransport selects the NG transport, TransportUDP (the default) or
+// TransportTCP for rtpengine's listen-tcp-ng.
+func WithTransport(network string) Option {
+	return func(c *client) { c.network = network }
+}
+
+// WithTCPFallback retries requests whose UDP response arrives truncated, as
+// responses describing huge calls may, over TCP to address, where rtpengine
+// listens with listen-tcp-ng.
+func WithTCPFallback(address string) Option {
+	return func(c *client) { c.fallbackAddr = address }
+}
+
+// TruncatedError reports a UDP response cut short with no TCP fallback to
+// retry the request over.
+type TruncatedError struct {
+	Command string
+	// Size is the number of bytes received.
+	Size int
+	// Partial is what arrived of the response, see decodePartial.
+	Partial map[string]interface{}
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("rtpengine response to %s was truncated after %d bytes; configure a TCP fallback for large responses", e.Command, e.Size)
+}
+
+// oversizeCommands are the read-only commands whose responses grow with the
+// calls they describe. They are retried over the TCP fallback when their UDP
+// response never arrives, as happens when it exceeds a datagram.
+var oversizeCommands = map[string]bool{
+	"list":       true,
+	"query":      true,
+	"statistics": true,
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// WithSockets spreads UDP requests round-robin over n sockets, each with its
+// own reader, for NG throughput beyond what one socket carries.
+func WithSockets(n int) Option {
+	return func(c *client) { c.sockets = n }
+}
+
+func newTransport(network, address string, sockets int, cookies *cookies) (transport, error) {
+	switch network {
+	case "", TransportUDP:
+		if sockets > 1 {
+			return newUDPPool(address, sockets, cookies)
+		}
+		return newUDPTransport(address, cookies)
+	case TransportTCP:
+		return &tcpTransport{address: address, cookies: cookies}, nil
+	default:
+		return nil, fmt.Errorf("unknown NG transport: %q", network)
+	}
+}
+
+// inFlight correlates the responses read from a socket with the requests
+// waiting for them. Responses nobody waits for, such as late answers to
+// requests that timed out or retransmitted answers to requests already
+// answered, are dropped rather than handed to another request.
+type inFlight struct {
+	network string
+	cookies *cookies
+
+	mu       sync.Mutex
+	requests map[string]chan []byte
+	err      error
+	done     chan struct{}
+}
+
+func newInFlight(network string, cookies *cookies) *inFlight {
+	return &inFlight{network: network, cookies: cookies, requests: make(map[string]chan []byte), done: make(chan struct{})}
+}
+
+func (f *inFlight) add(cookie string) (chan []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, &transportError{op: "read", network: f.network, err: f.err}
+	}
+	ch := make(chan []byte, 1)
+	f.requests[cookie] = ch
+	return ch, nil
+}
+
+func (f *inFlight) remove(cookie string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.requests, cookie)
+}
+
+func (f *inFlight) deliver(msg []byte) {
+	cookie, _, ok := bytes.Cut(msg, []byte(" "))
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	ch, ok := f.requests[string(cookie)]
+	delete(f.requests, string(cookie))
+	f.mu.Unlock()
+	if !ok {
+		f.cookies.stray(string(cookie))
+		return
+	}
+	ch <- msg
+}
+
+// fail stops the delivery of responses; waiting and later requests get err.
+func (f *inFlight) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+		close(f.done)
+	}
+}
+
+func (f *inFlight) wait(ctx context.Context, cookie string, ch chan []byte) ([]byte, error) {
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-f.done:
+		f.remove(cookie)
+		return nil, &transportError{op: "read", network: f.network, err: f.err}
+	case <-ctx.Done():
+		f.remove(cookie)
+		return nil, &transportError{op: "read", network: f.network, err: ctx.Err()}
+	}
+}
+
+// udpTransport sends every request from one socket, whose responses a
+// reader goroutine dispatches.
+type udpTransport struct {
+	addr *net.UDPAddr
+	conn *net.UDPConn
+	*inFlight
+}
+
+func newUDPTransport(address string, cookies *cookies) (*udpTransport, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve udp address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen udp: %w", err)
+	}
+	t := &udpTransport{addr: addr, conn: conn, inFlight: newInFlight(TransportUDP, cookies)}
+	go t.read()
+	return t, nil
+}
+
+func (t *udpTransport) read() {
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := t.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			t.fail(err)
+			return
+		}
+		if err != nil {
+			continue
+		}
+		t.deliver(append([]byte(nil), buf[:n]...))
+	}
+}
+
+func (t *udpTransport) roundTrip(ctx context.Context, msg []byte, cookie string) ([]byte, error) {
+	ch, err := t.add(cookie)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.conn.WriteToUDP(msg, t.addr); err != nil {
+		t.remove(cookie)
+		return nil, &transportError{op: "write", network: TransportUDP, err: err}
+	}
+	return t.wait(ctx, cookie, ch)
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
+
+// udpPool dispatches requests round-robin over several UDP transports.
+type udpPool struct {
+	sockets []*udpTransport
+	next    atomic.Uint64
+}
+
+func newUDPPool(address string, n int, cookies *cookies) (*udpPool, error) {
+	p := &udpPool{}
+	for i := 0; i < n; i++ {
+		t, err := newUDPTransport(address, cookies)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.sockets = append(p.sockets, t)
+	}
+	return p, nil
+}
+
+func (p *udpPool) roundTrip(ctx context.Context, msg []byte, cookie string) ([]byte, error) {
+	t := p.sockets[(p.next.Add(1)-1)%uint64(len(p.sockets))]
+	return t.roundTrip(ctx, msg, cookie)
+}
+
+func (p *udpPool) Close() error {
+	var errs []error
+	for _, t := range p.sockets {
+		errs = append(errs, t.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// tcpTransport keeps one connection to rtpengine, dialled on first use and
+// again after it fails. Messages are framed by their own syntax: the cookie
+// ends at the first space and the bencoded dictionary is self-delimiting.
+type tcpTransport struct {
+	address string
+	cookies *cookies
+
+	mu     sync.Mutex
+	conn   *tcpConn
+	closed bool
+}
+
+type tcpConn struct {
+	net.Conn
+	*inFlight
+	writeMu sync.Mutex
+}
+
+func (c *tcpConn) read() {
+	r := bufio.NewReader(c.Conn)
+	for {
+		msg, err := readMessage(r, maxMessageSize)
+		if err != nil {
+			c.Close()
+			c.fail(err)
+			return
+		}
+		c.deliver(msg)
+	}
+}
+
+// connect returns the current connection, or a new one when there is none
+// or it failed, and whether it was reused.
+func (t *tcpTransport) connect(ctx context.Context) (*tcpConn, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, false, &transportError{op: "dial", network: TransportTCP, err: net.ErrClosed}
+	}
+	if t.conn != nil {
+		select {
+		case <-t.conn.done:
+			t.conn = nil
+		default:
+			return t.conn, true, nil
+		}
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", t.address)
+	if err != nil {
+		return nil, false, &transportError{op: "dial", network: TransportTCP, err: err}
+	}
+	t.conn = &tcpConn{Conn: conn, inFlight: newInFlight(TransportTCP, t.cookies)}
+	go t.conn.read()
+	return t.conn, false, nil
+}
+
+func (t *tcpTransport) roundTrip(ctx context.Context, msg []byte, cookie string) ([]byte, error) {
+	resp, reused, err := t.try(ctx, msg, cookie)
+	if err != nil && reused && staleConn(err) {
+		// rtpengine closed the idle connection, e.g. on restart, before
+		// answering; send the request once more on a new one.
+		resp, _, err = t.try(ctx, msg, cookie)
+	}
+	return resp, err
+}
+
+func (t *tcpTransport) try(ctx context.Context, msg []byte, cookie string) ([]byte, bool, error) {
+	conn, reused, err := t.connect(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	ch, err := conn.add(cookie)
+	if err != nil {
+		return nil, reused, err
+	}
+
+	conn.writeMu.Lock()
+	deadline, _ := ctx.Deadline()
+	conn.SetWriteDeadline(deadline)
+	_, err = conn.Write(msg)
+	conn.writeMu.Unlock()
+	if err != nil {
+		// A partial write leaves the stream unusable.
+		conn.Close()
+		conn.fail(err)
+		return nil, reused, &transportError{op: "write", network: TransportTCP, err: err}
+	}
+	resp, err := conn.wait(ctx, cookie, ch)
+	return resp, reused, err
+}
+
+func (t *tcpTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	return nil
+}
+
+func staleConn(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// transportError reports a failure to exchange a message with rtpengine, as
+// opposed to an error response.
+type transportError struct {
+	op      string
+	network string
+	err     error
+}
+
+func (e *transportError) Error() string {
+	return fmt.Sprintf("failed to %s %s: %v", e.op, e.network, e.err)
+}
+
+func (e *transportError) Unwrap() error { return e.err }
+
+// readMessage reads one NG message from a stream. Bencoded values and JSON
+// objects are walked rather than decoded, so only the framing is checked
+// here.
+func readMessage(r *bufio.Reader, max int) ([]byte, error) {
+	msg, err := r.ReadBytes(' ')
+	if err != nil {
+		return nil, err
+	}
+	f := framer{r: r, msg: msg, max: max}
+	if err := f.value(0); err != nil {
+		return nil, err
+	}
+	return f.msg, nil
+}
+
+type framer struct {
+	r   *bufio.Reader
+	msg []byte
+	max int
+}
+
+func (f *framer) byte() (byte, error) {
+	c, err := f.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if len(f.msg) >= f.max {
+		return 0, fmt.Errorf("message exceeds %d bytes", f.max)
+	}
+	f.msg = append(f.msg, c)
+	return c, nil
+}
+
+func (f *framer) value(depth int) error {
+	if depth > maxBencodeDepth {
+		return errors.New("bencode nested too deeply")
+	}
+	c, err := f.byte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case c == '{' && depth == 0:
+		return f.jsonObject()
+	case c == 'i':
+		return f.until('e')
+	case c == 'l' || c == 'd':
+		for {
+			c, err := f.r.Peek(1)
+			if err != nil {
+				return err
+			}
+			if c[0] == 'e' {
+				_, err := f.byte()
+				return err
+			}
+			if err := f.value(depth + 1); err != nil {
+				return err
+			}
+		}
+	case c >= '0' && c <= '9':
+		length := int(c - '0')
+		for {
+			c, err := f.byte()
+			if err != nil {
+				return err
+			}
+			if c == ':' {
+				break
+			}
+			if c < '0' || c > '9' || length > f.max {
+				return fmt.Errorf("invalid string length")
+			}
+			length = length*10 + int(c-'0')
+		}
+		if len(f.msg)+length > f.max {
+			return fmt.Errorf("message exceeds %d bytes", f.max)
+		}
+		start := len(f.msg)
+		f.msg = append(f.msg, make([]byte, length)...)
+		_, err := io.ReadFull(f.r, f.msg[start:])
+		return err
+	default:
+		return fmt.Errorf("unexpected byte %q", c)
+	}
+}
+
+// jsonObject reads up to the brace closing the object just opened, counting
+// brackets outside of strings.
+func (f *framer) jsonObject() error {
+	depth := 1
+	inString, escaped := false, false
+	for depth > 0 {
+		c, err := f.byte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			escaped = c == '\\'
+			inString = c != '"'
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			if depth++; depth > maxBencodeDepth {
+				return errors.New("json nested too deeply")
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+func (f *framer) until(delim byte) error {
+	for {
+		c, err := f.byte()
+		if err != nil {
+			return err
+		}
+		if c == delim {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package rtpengine
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestReadMessage(t *testing.T) {
+	stream := "c1 d6:result4:pong4:listl1:ai42eee" + "c2 d3:sdp5:v=0\r\ne"
+	r := bufio.NewReader(iotest.OneByteReader(strings.NewReader(stream)))
+
+	for _, want := range []string{"c1 d6:result4:pong4:listl1:ai42eee", "c2 d3:sdp5:v=0\r\ne"} {
+		msg, err := readMessage(r, maxMessageSize)
+		if err != nil {
+			t.Fatalf("readMessage() error = %v", err)
+		}
+		if string(msg) != want {
+			t.Errorf("readMessage() = %q, want %q", msg, want)
+		}
+	}
+
+	for _, bad := range []string{"c d9:truncated", "c x", "c d3:sdp999999999:e"} {
+		if _, err := readMessage(bufio.NewReader(strings.NewReader(bad)), 64); err == nil {
+			t.Errorf("readMessage(%q) succeeded", bad)
+		}
+	}
+}
+
+// serveNG answers pings on a TCP listener, first with a stale response to
+// another cookie. The first connection is closed after one exchange, as
+// rtpengine does on restart.
+func serveNG(ln net.Listener) {
+	for first := true; ; first = false {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn, once bool) {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				msg, err := readMessage(r, maxMessageSize)
+				if err != nil {
+					return
+				}
+				cookie, _, _ := strings.Cut(string(msg), " ")
+				if _, err := conn.Write([]byte("stale d6:result5:errore" + cookie + " d6:result4:ponge")); err != nil {
+					return
+				}
+				if once {
+					return
+				}
+			}
+		}(conn, first)
+	}
+}
+
+func TestTCPTransport(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go serveNG(ln)
+
+	c, err := NewClient(ln.Addr().String(), WithTransport(TransportTCP))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+
+	// The second ping finds the first connection closed and reconnects.
+	for i := 0; i < 3; i++ {
+		if err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping() %d error = %v", i, err)
+		}
+	}
+}
+
+func TestUnknownTransport(t *testing.T) {
+	if _, err := NewClient("127.0.0.1:22222", WithTransport("sctp")); err == nil {
+		t.Error("NewClient() accepted an unknown transport")
+	}
+}
+
+// serveTruncated answers every NG request over UDP with a response cut short.
+func serveTruncated(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		cookie, _, _ := strings.Cut(string(buf[:n]), " ")
+		conn.WriteTo([]byte(cookie+" d5:calls"), addr)
+	}
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	go serveTruncated(udp)
+
+	c, err := NewClient(udp.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	var truncated *TruncatedError
+	if _, err := c.ListCalls(context.Background(), ListOptions{}); !errors.As(err, &truncated) || truncated.Command != "list" {
+		t.Fatalf("ListCalls() error = %v, want TruncatedError", err)
+	}
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	go serveNG(tcp)
+
+	c, err = NewClient(udp.LocalAddr().String(), WithTCPFallback(tcp.Addr().String()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() over the fallback error = %v", err)
+	}
+}
+
+// serveReversed collects n NG requests over UDP and answers them in reverse
+// order, then answers nothing.
+func serveReversed(conn net.PacketConn, n int) {
+	type request struct {
+		cookie string
+		addr   net.Addr
+	}
+	var requests []request
+	buf := make([]byte, 65535)
+	for len(requests) < n {
+		m, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		cookie, _, _ := strings.Cut(string(buf[:m]), " ")
+		requests = append(requests, request{cookie, addr})
+	}
+	for i := len(requests) - 1; i >= 0; i-- {
+		conn.WriteTo([]byte(requests[i].cookie+" d6:result4:ponge"), requests[i].addr)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	const n = 8
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	go serveReversed(udp, n)
+
+	c, err := NewClient(udp.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+
+	// Every request must be in flight at once for any to be answered.
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.Ping(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Ping() error = %v", err)
+		}
+	}
+
+	// The server is silent now; the caller's deadline ends the request.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := c.Ping(ctx); !isTimeout(err) {
+		t.Errorf("Ping() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Ping() took %s despite a 50ms deadline", elapsed)
+	}
+}
+
+func TestSocketPool(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	var mu sync.Mutex
+	sources := map[string]bool{}
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			sources[addr.String()] = true
+			mu.Unlock()
+			cookie, _, _ := strings.Cut(string(buf[:n]), " ")
+			udp.WriteTo([]byte(cookie+" d6:result4:ponge"), addr)
+		}
+	}()
+
+	c, err := NewClient(udp.LocalAddr().String(), WithSockets(3))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	for i := 0; i < 6; i++ {
+		if err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping() error = %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sources) != 3 {
+		t.Errorf("requests came from %d sockets, want 3", len(sources))
+	}
+}
+
+// serveRetransmitting answers every NG request over UDP twice, first
+// repeating its answer to the request before.
+func serveRetransmitting(conn net.PacketConn) {
+	var previous string
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if previous != "" {
+			conn.WriteTo([]byte(previous+" d6:result5:errore"), addr)
+		}
+		cookie, _, _ := strings.Cut(string(buf[:n]), " ")
+		conn.WriteTo([]byte(cookie+" d6:result4:ponge"), addr)
+		previous = cookie
+	}
+}
+
+func TestLateResponses(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	go serveRetransmitting(udp)
+
+	c, err := NewClient(udp.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer c.Close()
+	for i := 0; i < 3; i++ {
+		if err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping() %d error = %v", i, err)
+		}
+	}
+
+	cookies := c.(*client).cookies
+	first := cookies.namespace + "-1"
+	if !cookies.issued(first) {
+		t.Errorf("issued(%q) = false, want true", first)
+	}
+	for _, cookie := range []string{"0123abcd-1", cookies.namespace + "-ff", cookies.namespace + "-x", "stale"} {
+		if cookies.issued(cookie) {
+			t.Errorf("issued(%q) = true, want false", cookie)
+		}
+	}
+}
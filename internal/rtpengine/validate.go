@@ -0,0 +1,118 @@
+package rtpengine
+
+import (
+	"fmt"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+// ResponseError reports an NG response lacking a field the monitor relies on
+// or carrying it in an unexpected shape, which usually means rtpengine speaks
+// a dialect this client does not know.
+type ResponseError struct {
+	Command string
+	Field   string
+	Reason  string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("unexpected rtpengine response to %s: %s %s", e.Command, e.Field, e.Reason)
+}
+
+// validateResponse checks the fields callers of command depend on. Fields
+// that are optional in every rtpengine version are only checked when present.
+func validateResponse(command string, resp map[string]interface{}) error {
+	switch command {
+	case "ping":
+		if result, _ := resp["result"].(string); result != "pong" {
+			return &ResponseError{Command: command, Field: "result", Reason: fmt.Sprintf("is %q, want \"pong\"", result)}
+		}
+	case "offer", "answer", "publish":
+		return requireString(command, resp, "sdp")
+	case "subscribe request":
+		if err := requireString(command, resp, "sdp"); err != nil {
+			return err
+		}
+		return requireString(command, resp, "to-tag")
+	case "list":
+		if calls, ok := resp["calls"]; ok {
+			if _, ok := calls.([]interface{}); !ok {
+				return &ResponseError{Command: command, Field: "calls", Reason: fmt.Sprintf("is %T, want a list", calls)}
+			}
+		}
+	case "query":
+		return validateTags(command, resp)
+	case "statistics":
+		if current, ok := resp["currentstatistics"]; ok {
+			if _, ok := current.(map[string]interface{}); !ok {
+				return &ResponseError{Command: command, Field: "currentstatistics", Reason: fmt.Sprintf("is %T, want a dictionary", current)}
+			}
+		}
+	}
+	return nil
+}
+
+func requireString(command string, resp map[string]interface{}, field string) error {
+	v, ok := resp[field]
+	if !ok {
+		return &ResponseError{Command: command, Field: field, Reason: "is missing"}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return &ResponseError{Command: command, Field: field, Reason: fmt.Sprintf("is %T, want a string", v)}
+	}
+	if s == "" {
+		return &ResponseError{Command: command, Field: field, Reason: "is empty"}
+	}
+	return nil
+}
+
+// validateTags checks the tags dictionary of a query response down to the
+// streams of each media.
+func validateTags(command string, resp map[string]interface{}) error {
+	raw, ok := resp["tags"]
+	if !ok {
+		return &ResponseError{Command: command, Field: "tags", Reason: "is missing"}
+	}
+	tags, ok := raw.(map[string]interface{})
+	if !ok {
+		return &ResponseError{Command: command, Field: "tags", Reason: fmt.Sprintf("is %T, want a dictionary", raw)}
+	}
+
+	for name, v := range tags {
+		field := "tags." + redact.Tag(name)
+		tag, ok := v.(map[string]interface{})
+		if !ok {
+			return &ResponseError{Command: command, Field: field, Reason: fmt.Sprintf("is %T, want a dictionary", v)}
+		}
+		rawMedias, ok := tag["medias"]
+		if !ok {
+			continue
+		}
+		medias, ok := rawMedias.([]interface{})
+		if !ok {
+			return &ResponseError{Command: command, Field: field + ".medias", Reason: fmt.Sprintf("is %T, want a list", rawMedias)}
+		}
+		for i, m := range medias {
+			field := fmt.Sprintf("%s.medias[%d]", field, i)
+			media, ok := m.(map[string]interface{})
+			if !ok {
+				return &ResponseError{Command: command, Field: field, Reason: fmt.Sprintf("is %T, want a dictionary", m)}
+			}
+			rawStreams, ok := media["streams"]
+			if !ok {
+				continue
+			}
+			streams, ok := rawStreams.([]interface{})
+			if !ok {
+				return &ResponseError{Command: command, Field: field + ".streams", Reason: fmt.Sprintf("is %T, want a list", rawStreams)}
+			}
+			for j, s := range streams {
+				if _, ok := s.(map[string]interface{}); !ok {
+					return &ResponseError{Command: command, Field: fmt.Sprintf("%s.streams[%d]", field, j), Reason: fmt.Sprintf("is %T, want a dictionary", s)}
+				}
+			}
+		}
+	}
+	return nil
+}
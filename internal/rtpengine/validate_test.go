@@ -0,0 +1,62 @@
+package rtpengine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateResponse(t *testing.T) {
+	stream := map[string]interface{}{"local port": int64(30000)}
+	media := map[string]interface{}{"type": "audio", "streams": []interface{}{stream}}
+
+	tests := []struct {
+		name      string
+		command   string
+		resp      map[string]interface{}
+		wantField string
+	}{
+		{name: "offer ok", command: "offer", resp: map[string]interface{}{"sdp": "v=0\r\n"}},
+		{name: "offer without sdp", command: "offer", resp: map[string]interface{}{}, wantField: "sdp"},
+		{name: "answer with list sdp", command: "answer", resp: map[string]interface{}{"sdp": []interface{}{}}, wantField: "sdp"},
+		{name: "publish without sdp", command: "publish", resp: map[string]interface{}{"result": "ok"}, wantField: "sdp"},
+		{name: "subscribe ok", command: "subscribe request", resp: map[string]interface{}{"sdp": "v=0\r\n", "to-tag": "sub"}},
+		{name: "subscribe without to-tag", command: "subscribe request", resp: map[string]interface{}{"sdp": "v=0\r\n"}, wantField: "to-tag"},
+		{name: "subscribe with empty sdp", command: "subscribe request", resp: map[string]interface{}{"sdp": "", "to-tag": "sub"}, wantField: "sdp"},
+		{name: "list without calls", command: "list", resp: map[string]interface{}{}},
+		{name: "list with dictionary calls", command: "list", resp: map[string]interface{}{"calls": map[string]interface{}{}}, wantField: "calls"},
+		{name: "query ok", command: "query", resp: map[string]interface{}{"tags": map[string]interface{}{
+			"a": map[string]interface{}{"medias": []interface{}{media}},
+			"b": map[string]interface{}{},
+		}}},
+		{name: "query without tags", command: "query", resp: map[string]interface{}{}, wantField: "tags"},
+		{name: "query with list tags", command: "query", resp: map[string]interface{}{"tags": []interface{}{}}, wantField: "tags"},
+		{name: "query with string tag", command: "query", resp: map[string]interface{}{"tags": map[string]interface{}{"a": "x"}}, wantField: "tags.a"},
+		{name: "query with dictionary medias", command: "query", resp: map[string]interface{}{"tags": map[string]interface{}{
+			"a": map[string]interface{}{"medias": map[string]interface{}{}},
+		}}, wantField: "tags.a.medias"},
+		{name: "query with string stream", command: "query", resp: map[string]interface{}{"tags": map[string]interface{}{
+			"a": map[string]interface{}{"medias": []interface{}{map[string]interface{}{"streams": []interface{}{"x"}}}},
+		}}, wantField: "tags.a.medias[0].streams[0]"},
+		{name: "statistics with list", command: "statistics", resp: map[string]interface{}{"currentstatistics": []interface{}{}}, wantField: "currentstatistics"},
+		{name: "delete is not validated", command: "delete", resp: map[string]interface{}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateResponse(tt.command, tt.resp)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("validateResponse() error = %v", err)
+				}
+				return
+			}
+			var invalid *ResponseError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("validateResponse() error = %v, want a ResponseError", err)
+			}
+			if invalid.Command != tt.command || invalid.Field != tt.wantField {
+				t.Errorf("ResponseError = %+v, want field %q of %s", invalid, tt.wantField, tt.command)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+// Package slo tracks API service level objectives and raises multi-window
+// burn-rate alerts when the error budget is being spent too quickly.
+package slo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucketWidth is the resolution of the per-objective event history.
+const bucketWidth = time.Minute
+
+// Objective is a target ratio of good requests. A request is good when it
+// does not fail with a 5xx status and, if Threshold is set, completes within
+// Threshold.
+type Objective struct {
+	Name string `json:"name"`
+	// Route is the registered route pattern; empty matches every route and
+	// a trailing slash matches the whole subtree.
+	Route     string        `json:"route"`
+	Threshold time.Duration `json:"threshold"`
+	Target    float64       `json:"target"`
+}
+
+// Defaults are the built-in objectives.
+var Defaults = []Objective{
+	{Name: "spy-latency", Route: "/spy/", Threshold: 2 * time.Second, Target: 0.99},
+	{Name: "api-availability", Target: 0.999},
+}
+
+// burnWindow pairs a long and a short window that must both exceed Rate for
+// an alert of the given severity, as described in the Google SRE workbook.
+type burnWindow struct {
+	Severity string
+	Long     time.Duration
+	Short    time.Duration
+	Rate     float64
+}
+
+var burnWindows = []burnWindow{
+	{Severity: "page", Long: time.Hour, Short: 5 * time.Minute, Rate: 14.4},
+	{Severity: "ticket", Long: 6 * time.Hour, Short: 30 * time.Minute, Rate: 6},
+}
+
+// Alert is raised when an objective starts or stops burning its budget.
+type Alert struct {
+	Objective string    `json:"objective"`
+	Severity  string    `json:"severity"`
+	Firing    bool      `json:"firing"`
+	BurnRate  float64   `json:"burn_rate"`
+	Time      time.Time `json:"time"`
+}
+
+// Status reports an objective's burn rates per window.
+type Status struct {
+	Objective
+	BurnRates map[string]float64 `json:"burn_rates"`
+	Firing    []string           `json:"firing"`
+}
+
+type bucket struct {
+	start       time.Time
+	total, good int64
+}
+
+type tracker struct {
+	obj     Objective
+	buckets []bucket
+	firing  map[string]bool
+}
+
+// Tracker records request outcomes and evaluates objectives.
+type Tracker struct {
+	mu       sync.Mutex
+	trackers []*tracker
+	onAlert  []func(Alert)
+}
+
+// NewTracker creates a tracker for objectives.
+func NewTracker(objectives []Objective) *Tracker {
+	size := int(burnWindows[len(burnWindows)-1].Long / bucketWidth)
+	t := &Tracker{}
+	for _, obj := range objectives {
+		t.trackers = append(t.trackers, &tracker{obj: obj, buckets: make([]bucket, size), firing: make(map[string]bool)})
+	}
+	return t
+}
+
+// OnAlert registers fn to be called when an alert starts or stops firing.
+func (t *Tracker) OnAlert(fn func(Alert)) {
+	t.mu.Lock()
+	t.onAlert = append(t.onAlert, fn)
+	t.mu.Unlock()
+}
+
+func (o Objective) matches(route string) bool {
+	if o.Route == "" || o.Route == route {
+		return true
+	}
+	return strings.HasSuffix(o.Route, "/") && strings.HasPrefix(route, o.Route)
+}
+
+// Record adds a request outcome for route.
+func (t *Tracker) Record(route string, status int, d time.Duration, now time.Time) {
+	start := now.Truncate(bucketWidth)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tr := range t.trackers {
+		if !tr.obj.matches(route) {
+			continue
+		}
+		b := &tr.buckets[int(start.Unix()/int64(bucketWidth/time.Second))%len(tr.buckets)]
+		if !b.start.Equal(start) {
+			*b = bucket{start: start}
+		}
+		b.total++
+		if status < 500 && (tr.obj.Threshold == 0 || d <= tr.obj.Threshold) {
+			b.good++
+		}
+	}
+}
+
+// burnRate is the error ratio over window divided by the error budget.
+func (tr *tracker) burnRate(window time.Duration, now time.Time) float64 {
+	since := now.Truncate(bucketWidth).Add(-window + bucketWidth)
+	var total, good int64
+	for _, b := range tr.buckets {
+		if !b.start.Before(since) && !b.start.After(now) {
+			total += b.total
+			good += b.good
+		}
+	}
+	budget := 1 - tr.obj.Target
+	if total == 0 || budget <= 0 {
+		return 0
+	}
+	return float64(total-good) / float64(total) / budget
+}
+
+// Evaluate updates alert states and notifies OnAlert callbacks of changes.
+func (t *Tracker) Evaluate(now time.Time) []Alert {
+	t.mu.Lock()
+	var changed []Alert
+	for _, tr := range t.trackers {
+		for _, w := range burnWindows {
+			long := tr.burnRate(w.Long, now)
+			firing := long > w.Rate && tr.burnRate(w.Short, now) > w.Rate
+			if firing == tr.firing[w.Severity] {
+				continue
+			}
+			tr.firing[w.Severity] = firing
+			changed = append(changed, Alert{Objective: tr.obj.Name, Severity: w.Severity, Firing: firing, BurnRate: long, Time: now})
+		}
+	}
+	callbacks := t.onAlert
+	t.mu.Unlock()
+
+	for _, alert := range changed {
+		for _, fn := range callbacks {
+			fn(alert)
+		}
+	}
+	return changed
+}
+
+// Status returns the current burn rates of every objective.
+func (t *Tracker) Status(now time.Time) []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]Status, 0, len(t.trackers))
+	for _, tr := range t.trackers {
+		st := Status{Objective: tr.obj, BurnRates: make(map[string]float64), Firing: []string{}}
+		for _, w := range burnWindows {
+			for _, window := range []time.Duration{w.Long, w.Short} {
+				st.BurnRates[window.String()] = tr.burnRate(window, now)
+			}
+			if tr.firing[w.Severity] {
+				st.Firing = append(st.Firing, w.Severity)
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// Run evaluates objectives every interval until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.Evaluate(now)
+		}
+	}
+}
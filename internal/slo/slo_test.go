@@ -0,0 +1,59 @@
+package slo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObjectiveMatches(t *testing.T) {
+	tests := []struct {
+		route string
+		obj   Objective
+		want  bool
+	}{
+		{route: "/spy/", obj: Objective{Route: "/spy/"}, want: true},
+		{route: "/spy/answer/", obj: Objective{Route: "/spy/"}, want: true},
+		{route: "/calls", obj: Objective{Route: "/spy/"}, want: false},
+		{route: "/calls", obj: Objective{}, want: true},
+		{route: "/calls/bulk", obj: Objective{Route: "/calls"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.obj.matches(tt.route); got != tt.want {
+			t.Errorf("%+v.matches(%q) = %v, want %v", tt.obj, tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestBurnRateAlerts(t *testing.T) {
+	tr := NewTracker([]Objective{{Name: "spy", Route: "/spy/", Threshold: 2 * time.Second, Target: 0.99}})
+	var alerts []Alert
+	tr.OnAlert(func(a Alert) { alerts = append(alerts, a) })
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		tr.Record("/spy/", 200, time.Second, now)
+	}
+	if got := tr.Evaluate(now); len(got) != 0 {
+		t.Fatalf("expected no alerts for healthy traffic, got %+v", got)
+	}
+
+	// 20% slow requests burn a 1% budget 20 times too fast.
+	for i := 0; i < 25; i++ {
+		tr.Record("/spy/", 200, 3*time.Second, now)
+	}
+	got := tr.Evaluate(now)
+	if len(got) != 2 || !got[0].Firing || got[0].Severity != "page" || got[1].Severity != "ticket" {
+		t.Fatalf("expected page and ticket alerts, got %+v", got)
+	}
+	if len(alerts) != 2 {
+		t.Errorf("expected callbacks for both alerts, got %d", len(alerts))
+	}
+
+	// Once the bad minute leaves the short windows the alerts resolve.
+	later := now.Add(45 * time.Minute)
+	tr.Record("/spy/", 200, time.Second, later)
+	got = tr.Evaluate(later)
+	if len(got) != 2 || got[0].Firing || got[1].Firing {
+		t.Errorf("expected alerts to resolve, got %+v", got)
+	}
+}
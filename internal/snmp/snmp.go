@@ -0,0 +1,231 @@
+// Package snmp sends SNMPv2c traps for critical events, for NOC tooling
+// that ingests traps rather than webhooks. Only the encoding of traps is
+// implemented, with no agent to query.
+package snmp
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultEnterprise roots the notifications and objects of the monitor
+// unless a site configures its own enterprise number. 99999 is not assigned
+// to it by IANA.
+const DefaultEnterprise = "1.3.6.1.4.1.99999.1"
+
+// Notification identifies a trap, enterprise.0.N.
+type Notification int
+
+const (
+	RTPEngineDown Notification = iota + 1
+	RTPEngineUp
+	DiskFull
+	DiskOK
+	QualityAlert
+	QualityOK
+)
+
+// Objects sent with traps, enterprise.1.N.
+const (
+	objectDetail = iota + 1
+	objectInstance
+	objectCallID
+	// objectMOS is the score times 100, as a Gauge32.
+	objectMOS
+	objectPath
+)
+
+// Trap is one notification and the objects describing it. Empty fields are
+// not sent.
+type Trap struct {
+	Notification Notification
+	// Detail describes the event for humans.
+	Detail   string
+	Instance string
+	CallID   string
+	MOS      float64
+	Path     string
+}
+
+// Sender sends traps to one receiver.
+type Sender struct {
+	conn       net.Conn
+	community  string
+	enterprise []uint32
+	start      time.Time
+	requestID  atomic.Int32
+}
+
+// NewSender sends traps to target, host:port with port 162 by default,
+// with the community and under the enterprise OID in dotted form, or
+// DefaultEnterprise when empty.
+func NewSender(target, community, enterprise string) (*Sender, error) {
+	if enterprise == "" {
+		enterprise = DefaultEnterprise
+	}
+	oid, err := parseOID(enterprise)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enterprise OID %q: %w", enterprise, err)
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "162")
+	}
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return nil, err
+	}
+	return &Sender{conn: conn, community: community, enterprise: oid, start: time.Now()}, nil
+}
+
+// Send sends trap. Delivery is not acknowledged, as traps are not.
+func (s *Sender) Send(trap Trap) error {
+	_, err := s.conn.Write(s.encode(trap))
+	return err
+}
+
+func (s *Sender) Close() error {
+	return s.conn.Close()
+}
+
+// encode builds the message of a trap: version, community and an
+// SNMPv2-Trap-PDU whose first variables are sysUpTime.0 and snmpTrapOID.0.
+func (s *Sender) encode(trap Trap) []byte {
+	object := func(n int) []uint32 { return s.under(1, uint32(n)) }
+	uptime := time.Since(s.start) / (10 * time.Millisecond)
+	varbinds := [][]byte{
+		varbind(sysUpTime, tlv(tagTimeTicks, unsigned(uint64(uptime)&math.MaxUint32))),
+		varbind(snmpTrapOID, tlv(tagOID, oid(s.under(0, uint32(trap.Notification))))),
+	}
+	for _, v := range []struct {
+		object int
+		value  string
+	}{{objectDetail, trap.Detail}, {objectInstance, trap.Instance}, {objectCallID, trap.CallID}, {objectPath, trap.Path}} {
+		if v.value != "" {
+			varbinds = append(varbinds, varbind(object(v.object), tlv(tagOctetString, []byte(v.value))))
+		}
+	}
+	if trap.MOS > 0 {
+		varbinds = append(varbinds, varbind(object(objectMOS), tlv(tagGauge32, unsigned(uint64(math.Round(trap.MOS*100))))))
+	}
+
+	pdu := tlv(tagTrapV2,
+		tlv(tagInteger, integer(int64(s.requestID.Add(1)))),
+		tlv(tagInteger, integer(0)),
+		tlv(tagInteger, integer(0)),
+		tlv(tagSequence, varbinds...),
+	)
+	return tlv(tagSequence, tlv(tagInteger, integer(versionV2c)), tlv(tagOctetString, []byte(s.community)), pdu)
+}
+
+// under returns the OID of arcs under the enterprise OID.
+func (s *Sender) under(arcs ...uint32) []uint32 {
+	return append(slices.Clone(s.enterprise), arcs...)
+}
+
+// versionV2c is the message version of SNMPv2c.
+const versionV2c = 1
+
+// BER tags of the types used in traps.
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagOID         = 0x06
+	tagSequence    = 0x30
+	tagGauge32     = 0x42
+	tagTimeTicks   = 0x43
+	tagTrapV2      = 0xa7
+)
+
+var (
+	sysUpTime   = []uint32{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	snmpTrapOID = []uint32{1, 3, 6, 1, 6, 3, 1, 1, 4, 1, 0}
+)
+
+func varbind(name []uint32, value []byte) []byte {
+	return tlv(tagSequence, tlv(tagOID, oid(name)), value)
+}
+
+// tlv encodes a value of tag whose contents are the concatenation of parts.
+func tlv(tag byte, parts ...[]byte) []byte {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	out := append([]byte{tag}, length(n)...)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func length(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// integer encodes n in the fewest two's complement bytes.
+func integer(n int64) []byte {
+	b := []byte{byte(n)}
+	for n > 127 || n < -128 {
+		n >>= 8
+		b = append([]byte{byte(n)}, b...)
+	}
+	return b
+}
+
+// unsigned encodes n as the contents of an unsigned type, with a leading
+// zero byte where the top bit is set.
+func unsigned(n uint64) []byte {
+	b := []byte{byte(n)}
+	for n >>= 8; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func oid(arcs []uint32) []byte {
+	b := []byte{byte(40*arcs[0] + arcs[1])}
+	for _, arc := range arcs[2:] {
+		var enc []byte
+		enc = append(enc, byte(arc&0x7f))
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			enc = append([]byte{0x80 | byte(arc&0x7f)}, enc...)
+		}
+		b = append(b, enc...)
+	}
+	return b
+}
+
+func parseOID(s string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("too few arcs")
+	}
+	arcs := make([]uint32, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		arcs[i] = uint32(n)
+	}
+	if arcs[0] > 2 || (arcs[0] < 2 && arcs[1] > 39) {
+		return nil, fmt.Errorf("invalid first arcs")
+	}
+	return arcs, nil
+}
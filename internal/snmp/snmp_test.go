@@ -0,0 +1,89 @@
+package snmp
+
+import (
+	"encoding/asn1"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	receiver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	s, err := NewSender(receiver.LocalAddr().String(), "noc", "1.3.6.1.4.1.99999.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Send(Trap{Notification: QualityAlert, Detail: "MOS 2.10 below 3.00", CallID: "c1", MOS: 2.1}); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := receiver.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg struct {
+		Version   int
+		Community []byte
+		PDU       asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(buf[:n], &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Version != versionV2c || string(msg.Community) != "noc" {
+		t.Errorf("version %d, community %q", msg.Version, msg.Community)
+	}
+	if msg.PDU.Class != asn1.ClassContextSpecific || msg.PDU.Tag != 7 {
+		t.Fatalf("PDU class %d, tag %d, want SNMPv2-Trap-PDU", msg.PDU.Class, msg.PDU.Tag)
+	}
+
+	var pdu struct {
+		RequestID   int
+		ErrorStatus int
+		ErrorIndex  int
+		Varbinds    []struct {
+			Name  asn1.ObjectIdentifier
+			Value asn1.RawValue
+		}
+	}
+	// The PDU is a sequence under its context tag.
+	body := append([]byte{tagSequence}, msg.PDU.FullBytes[1:]...)
+	if _, err := asn1.Unmarshal(body, &pdu); err != nil {
+		t.Fatal(err)
+	}
+	if len(pdu.Varbinds) != 5 {
+		t.Fatalf("%d variables, want 5", len(pdu.Varbinds))
+	}
+	if name := pdu.Varbinds[0].Name.String(); name != "1.3.6.1.2.1.1.3.0" || pdu.Varbinds[0].Value.Tag != tagTimeTicks&0x1f {
+		t.Errorf("first variable %s with tag %d, want sysUpTime.0", name, pdu.Varbinds[0].Value.Tag)
+	}
+	var trapOID asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(pdu.Varbinds[1].Value.FullBytes, &trapOID); err != nil {
+		t.Fatal(err)
+	}
+	if trapOID.String() != "1.3.6.1.4.1.99999.1.0.5" {
+		t.Errorf("snmpTrapOID = %s, want qualityAlert", trapOID)
+	}
+	if name := pdu.Varbinds[3].Name.String(); name != "1.3.6.1.4.1.99999.1.1.3" || string(pdu.Varbinds[3].Value.Bytes) != "c1" {
+		t.Errorf("call ID variable %s = %q", name, pdu.Varbinds[3].Value.Bytes)
+	}
+	if mos := pdu.Varbinds[4].Value; mos.Tag != tagGauge32&0x1f || string(mos.Bytes) != "\x00\xd2" {
+		t.Errorf("MOS variable tag %d = %v, want Gauge32 210", mos.Tag, mos.Bytes)
+	}
+}
+
+func TestNewSenderInvalidOID(t *testing.T) {
+	for _, oid := range []string{"1", "1.x.3", "3.1.2"} {
+		if _, err := NewSender("127.0.0.1", "public", oid); err == nil {
+			t.Errorf("NewSender(%q) succeeded, want an error", oid)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package spy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// SaturatedError is returned when a new spy session is refused because the
+// service is above its configured saturation thresholds.
+type SaturatedError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *SaturatedError) Error() string {
+	return fmt.Sprintf("service saturated: %s", e.Reason)
+}
+
+// lowPriorityHeadroom is the fraction of the limits at which low priority
+// sessions are already refused.
+const lowPriorityHeadroom = 0.8
+
+// admission samples forwarded packets and process CPU once per second and
+// refuses new sessions while either is above its threshold. A zero threshold
+// disables that check. While saturated, shed is called once per sample to
+// drop a lower priority session.
+type admission struct {
+	maxPPS     float64
+	maxCPU     float64
+	retryAfter time.Duration
+	shed       func()
+
+	packets atomic.Uint64
+	pps     atomic.Uint64 // float64 bits
+	cpu     atomic.Uint64 // float64 bits, percent of all cores
+}
+
+func (a *admission) enabled() bool {
+	return a.maxPPS > 0 || a.maxCPU > 0
+}
+
+func (a *admission) forwarded(n int) {
+	a.packets.Add(uint64(n))
+}
+
+func (a *admission) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastPackets := a.packets.Load()
+	lastCPU := processCPUTime()
+	lastTick := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			elapsed := now.Sub(lastTick).Seconds()
+			if elapsed <= 0 {
+				continue
+			}
+
+			packets := a.packets.Load()
+			a.pps.Store(math.Float64bits(float64(packets-lastPackets) / elapsed))
+
+			cpu := processCPUTime()
+			cpuPercent := (cpu - lastCPU).Seconds() / elapsed / float64(runtime.NumCPU()) * 100
+			a.cpu.Store(math.Float64bits(cpuPercent))
+
+			lastPackets, lastCPU, lastTick = packets, cpu, now
+
+			if a.shed != nil && a.check(1) != nil {
+				a.shed()
+			}
+		}
+	}
+}
+
+// admit returns a *SaturatedError when a new session of priority p must be
+// refused.
+func (a *admission) admit(p Priority) error {
+	switch p {
+	case PriorityHigh:
+		return nil
+	case PriorityLow:
+		return a.check(lowPriorityHeadroom)
+	default:
+		return a.check(1)
+	}
+}
+
+// check compares the last sample against the limits scaled by factor.
+func (a *admission) check(factor float64) error {
+	if pps, limit := math.Float64frombits(a.pps.Load()), a.maxPPS*factor; a.maxPPS > 0 && pps >= limit {
+		return &SaturatedError{Reason: fmt.Sprintf("%.0f packets/s forwarded (limit %.0f)", pps, limit), RetryAfter: a.retryAfter}
+	}
+	if cpu, limit := math.Float64frombits(a.cpu.Load()), a.maxCPU*factor; a.maxCPU > 0 && cpu >= limit {
+		return &SaturatedError{Reason: fmt.Sprintf("%.0f%% cpu (limit %.0f%%)", cpu, limit), RetryAfter: a.retryAfter}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package spy
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAdmissionAdmit(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxPPS    float64
+		maxCPU    float64
+		priority  Priority
+		pps       float64
+		cpu       float64
+		saturated bool
+	}{
+		{name: "disabled", priority: PriorityLow, pps: 1e6, cpu: 100},
+		{name: "below limits", priority: PriorityNormal, maxPPS: 1000, maxCPU: 80, pps: 999, cpu: 79},
+		{name: "pps above limit", priority: PriorityNormal, maxPPS: 1000, pps: 1000, saturated: true},
+		{name: "cpu above limit", priority: PriorityNormal, maxCPU: 80, cpu: 95, saturated: true},
+		{name: "low priority refused early", priority: PriorityLow, maxPPS: 1000, pps: 850, saturated: true},
+		{name: "high priority always admitted", priority: PriorityHigh, maxPPS: 1000, pps: 5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &admission{maxPPS: tt.maxPPS, maxCPU: tt.maxCPU, retryAfter: 3 * time.Second}
+			a.pps.Store(math.Float64bits(tt.pps))
+			a.cpu.Store(math.Float64bits(tt.cpu))
+
+			err := a.admit(tt.priority)
+			var saturated *SaturatedError
+			if got := errors.As(err, &saturated); got != tt.saturated {
+				t.Fatalf("admit() error = %v, expected saturated = %v", err, tt.saturated)
+			}
+			if tt.saturated && saturated.RetryAfter != 3*time.Second {
+				t.Errorf("expected RetryAfter 3s, got %v", saturated.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestLegStatsLoss(t *testing.T) {
+	var l LegStats
+	var seq sequence
+	for _, n := range []uint16{65533, 65534, 1, 2, 2, 5} {
+		l.observe(&seq, n, 160)
+	}
+	if got := l.Packets.Load(); got != 6 {
+		t.Errorf("expected 6 packets, got %d", got)
+	}
+	// 65535, 0 missing across the wrap, 3 and 4 missing later.
+	if got := l.Lost.Load(); got != 4 {
+		t.Errorf("expected 4 lost packets, got %d", got)
+	}
+}
@@ -0,0 +1,143 @@
+package spy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// subscriptionsPerSource is how many rtpengine subscriptions a source holds,
+// one per leg, unless it subscribes to all media of the call at once.
+const subscriptionsPerSource = 2
+
+// subscriptionBudget caps the subscriptions held on rtpengine, whose kernel
+// forwarding tables are limited. Callers reserve a source's subscriptions
+// before creating it and releaseSource returns them. A zero max disables it.
+type subscriptionBudget struct {
+	instance   string
+	max        int
+	queue      time.Duration
+	retryAfter time.Duration
+	// perSource overrides subscriptionsPerSource when set.
+	perSource int
+
+	mu      sync.Mutex
+	active  int
+	waiting int
+	// freed is closed and replaced whenever subscriptions are returned.
+	freed chan struct{}
+}
+
+// BudgetStatus reports the subscription budget of the rtpengine instance.
+type BudgetStatus struct {
+	Instance string `json:"instance"`
+	Limit    int    `json:"limit"`
+	Active   int    `json:"active"`
+	Waiting  int    `json:"waiting"`
+}
+
+// acquire reserves the subscriptions of one source, waiting up to the queue
+// timeout for others to be released. It returns a *SaturatedError when the
+// budget stays exhausted.
+func (b *subscriptionBudget) acquire(ctx context.Context) error {
+	if b.max <= 0 {
+		return nil
+	}
+
+	var deadline <-chan time.Time
+	if b.queue > 0 {
+		timer := time.NewTimer(b.queue)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	b.mu.Lock()
+	for b.active+b.cost() > b.max {
+		if deadline == nil {
+			err := b.exhausted()
+			b.mu.Unlock()
+			return err
+		}
+		if b.freed == nil {
+			b.freed = make(chan struct{})
+		}
+		freed := b.freed
+		b.waiting++
+		b.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-deadline:
+			deadline = nil
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.waiting--
+			b.mu.Unlock()
+			return ctx.Err()
+		}
+
+		b.mu.Lock()
+		b.waiting--
+	}
+	b.active += b.cost()
+	b.mu.Unlock()
+	return nil
+}
+
+// tryAcquire reserves the subscriptions of one source without waiting, and
+// only while usage stays within factor of the budget.
+func (b *subscriptionBudget) tryAcquire(factor float64) error {
+	if b.max <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if float64(b.active+b.cost()) > factor*float64(b.max) {
+		return b.exhausted()
+	}
+	b.active += b.cost()
+	return nil
+}
+
+// release returns the subscriptions of one source.
+func (b *subscriptionBudget) release() {
+	if b.max <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active -= b.cost()
+	if b.freed != nil {
+		close(b.freed)
+		b.freed = nil
+	}
+}
+
+// cost returns how many subscriptions one source holds.
+func (b *subscriptionBudget) cost() int {
+	if b.perSource > 0 {
+		return b.perSource
+	}
+	return subscriptionsPerSource
+}
+
+func (b *subscriptionBudget) exhausted() *SaturatedError {
+	return &SaturatedError{
+		Reason:     fmt.Sprintf("subscription budget of rtpengine %s exhausted (%d of %d in use)", b.instance, b.active, b.max),
+		RetryAfter: b.retryAfter,
+	}
+}
+
+// SubscriptionBudget returns the subscription usage of the rtpengine
+// instance.
+func (s *Service) SubscriptionBudget() BudgetStatus {
+	s.budget.mu.Lock()
+	defer s.budget.mu.Unlock()
+	return BudgetStatus{
+		Instance: s.budget.instance,
+		Limit:    s.budget.max,
+		Active:   s.budget.active,
+		Waiting:  s.budget.waiting,
+	}
+}
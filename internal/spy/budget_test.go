@@ -0,0 +1,94 @@
+package spy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionBudget(t *testing.T) {
+	b := &subscriptionBudget{instance: "rtpengine-1", max: 4}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := b.acquire(ctx); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	var saturated *SaturatedError
+	if err := b.acquire(ctx); !errors.As(err, &saturated) {
+		t.Fatalf("expected SaturatedError when exhausted, got %v", err)
+	}
+
+	b.release()
+	if err := b.tryAcquire(0.8); !errors.As(err, &saturated) {
+		t.Errorf("expected shadows to be refused above 80%%, got %v", err)
+	}
+	if err := b.tryAcquire(1); err != nil {
+		t.Errorf("tryAcquire() error = %v", err)
+	}
+	if b.active != 4 {
+		t.Errorf("expected 4 active subscriptions, got %d", b.active)
+	}
+}
+
+func TestSubscriptionBudgetSubscribeAll(t *testing.T) {
+	b := &subscriptionBudget{max: 4, perSource: 1}
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if err := b.acquire(ctx); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	var saturated *SaturatedError
+	if err := b.acquire(ctx); !errors.As(err, &saturated) {
+		t.Fatalf("expected SaturatedError after 4 sources, got %v", err)
+	}
+	b.release()
+	if b.active != 3 {
+		t.Errorf("expected 3 active subscriptions, got %d", b.active)
+	}
+}
+
+func TestSubscriptionBudgetQueue(t *testing.T) {
+	b := &subscriptionBudget{max: 2, queue: time.Second}
+	ctx := context.Background()
+	if err := b.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.acquire(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	b.mu.Lock()
+	waiting := b.waiting
+	b.mu.Unlock()
+	if waiting != 1 {
+		t.Errorf("expected 1 queued request, got %d", waiting)
+	}
+
+	b.release()
+	if err := <-done; err != nil {
+		t.Errorf("queued acquire error = %v", err)
+	}
+
+	b.queue = 20 * time.Millisecond
+	var saturated *SaturatedError
+	if err := b.acquire(ctx); !errors.As(err, &saturated) {
+		t.Errorf("expected SaturatedError after the queue timeout, got %v", err)
+	}
+}
+
+func TestSubscriptionBudgetDisabled(t *testing.T) {
+	var b subscriptionBudget
+	for i := 0; i < 10; i++ {
+		if err := b.acquire(context.Background()); err != nil {
+			t.Fatalf("acquire() error = %v", err)
+		}
+	}
+	b.release()
+	if b.active != 0 {
+		t.Errorf("a disabled budget should not count, got %d", b.active)
+	}
+}
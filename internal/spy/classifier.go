@@ -0,0 +1,228 @@
+package spy
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// AudioClass is what a leg is currently carrying, as guessed from its audio.
+type AudioClass string
+
+const (
+	AudioUnknown  AudioClass = "unknown"
+	AudioSilence  AudioClass = "silence"
+	AudioSpeech   AudioClass = "speech"
+	AudioMusic    AudioClass = "music"
+	AudioRingback AudioClass = "ringback"
+)
+
+const (
+	// classifierFrame is the analysis frame, 20ms at 8kHz.
+	classifierFrame = 160
+	// classifierWindow is how many frames (6s) a decision looks at, long
+	// enough to cover a full ringback cadence.
+	classifierWindow = 300
+	// classifierMinFrames must be analysed before a first decision.
+	classifierMinFrames = 100
+	// classifierEvery is how many frames pass between decisions.
+	classifierEvery = 50
+
+	activeThresholdDB = -45
+)
+
+// Ringback tone frequencies used across regions, in Hz.
+var ringbackTones = [...]float64{350, 400, 425, 440, 450, 480}
+
+type frameFeatures struct {
+	energyDB float64
+	tonal    bool
+}
+
+// classifier labels the G.711 audio of one leg as silence, speech, music or
+// ringback. It is a heuristic on frame energy and tonality: ringback is a
+// cadenced tone, music is continuous audio with little energy modulation and
+// speech is everything else with pauses and syllabic modulation.
+type classifier struct {
+	out *atomic.Value
+	// onFrame are fed the energy of every analysed frame.
+	onFrame []func(energyDB float64)
+
+	samples []float64
+	window  [classifierWindow]frameFeatures
+	frames  int
+}
+
+func newClassifier(out *atomic.Value, onFrame ...func(energyDB float64)) *classifier {
+	out.Store(AudioUnknown)
+	return &classifier{out: out, onFrame: onFrame, samples: make([]float64, 0, classifierFrame)}
+}
+
+// observe decodes a packet and updates the class every classifierEvery
+// frames. Codecs other than G.711 leave the class unknown.
+func (c *classifier) observe(payloadType uint8, payload []byte) {
+	var table *[256]int16
+	switch payloadType {
+	case 0:
+		table = &ulawTable
+	case 8:
+		table = &alawTable
+	default:
+		return
+	}
+
+	for _, b := range payload {
+		c.samples = append(c.samples, float64(table[b]))
+		if len(c.samples) < classifierFrame {
+			continue
+		}
+		f := analyseFrame(c.samples)
+		c.window[c.frames%classifierWindow] = f
+		for _, fn := range c.onFrame {
+			fn(f.energyDB)
+		}
+		c.samples = c.samples[:0]
+		c.frames++
+		if c.frames >= classifierMinFrames && c.frames%classifierEvery == 0 {
+			c.out.Store(c.classify())
+		}
+	}
+}
+
+func (c *classifier) classify() AudioClass {
+	n := c.frames
+	if n > classifierWindow {
+		n = classifierWindow
+	}
+
+	var active, tonal int
+	var sum, sumSq float64
+	for _, f := range c.window[:n] {
+		if f.energyDB < activeThresholdDB {
+			continue
+		}
+		active++
+		if f.tonal {
+			tonal++
+		}
+		sum += f.energyDB
+		sumSq += f.energyDB * f.energyDB
+	}
+
+	activeFrac := float64(active) / float64(n)
+	switch {
+	case activeFrac < 0.05:
+		return AudioSilence
+	case float64(tonal) >= 0.9*float64(active) && activeFrac <= 0.7:
+		return AudioRingback
+	}
+
+	mean := sum / float64(active)
+	stddev := math.Sqrt(math.Max(sumSq/float64(active)-mean*mean, 0))
+	if activeFrac >= 0.9 && stddev < 6 {
+		return AudioMusic
+	}
+	return AudioSpeech
+}
+
+func analyseFrame(samples []float64) frameFeatures {
+	var energy float64
+	for _, s := range samples {
+		energy += s * s
+	}
+	f := frameFeatures{energyDB: -100}
+	if energy == 0 {
+		return f
+	}
+	f.energyDB = 10 * math.Log10(energy/float64(len(samples))/(32768*32768))
+
+	// A pure tone on a Goertzel bin has a ratio close to 1; US ringback
+	// splits its energy between 440 and 480Hz.
+	var ratios [len(ringbackTones)]float64
+	var peak float64
+	for i, freq := range ringbackTones {
+		ratios[i] = 2 * goertzel(samples, freq) / (float64(len(samples)) * energy)
+		peak = math.Max(peak, ratios[i])
+	}
+	f.tonal = peak >= 0.6 || ratios[3]+ratios[5] >= 0.7
+	return f
+}
+
+// goertzel returns the power of samples at freq for 8kHz audio.
+func goertzel(samples []float64, freq float64) float64 {
+	coeff := 2 * math.Cos(2*math.Pi*freq/8000)
+	var s1, s2 float64
+	for _, x := range samples {
+		s1, s2 = x+coeff*s1-s2, s1
+	}
+	return s1*s1 + s2*s2 - coeff*s1*s2
+}
+
+var ulawTable, alawTable [256]int16
+
+func init() {
+	for i := range 256 {
+		ulawTable[i] = decodeULaw(byte(i))
+		alawTable[i] = decodeALaw(byte(i))
+	}
+}
+
+func decodeULaw(b byte) int16 {
+	b = ^b
+	t := (int16(b&0x0f) << 3) + 0x84
+	t <<= (b & 0x70) >> 4
+	if b&0x80 != 0 {
+		return 0x84 - t
+	}
+	return t - 0x84
+}
+
+func decodeALaw(b byte) int16 {
+	b ^= 0x55
+	t := int16(b&0x0f) << 4
+	switch seg := (b & 0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if b&0x80 != 0 {
+		return t
+	}
+	return -t
+}
+
+// CallAudio is the current class of both legs of a subscribed call. Echo is
+// set while both legs carry the same audio, EchoDelayMs apart.
+type CallAudio struct {
+	From        AudioClass `json:"from"`
+	To          AudioClass `json:"to"`
+	Echo        bool       `json:"echo,omitempty"`
+	EchoDelayMs int64      `json:"echo_delay_ms,omitempty"`
+}
+
+// AudioClasses returns the audio class of every subscribed call. Calls
+// without a source, spied or shadow, are not classified.
+func (s *Service) AudioClasses() map[string]CallAudio {
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+
+	classes := make(map[string]CallAudio, len(s.sources))
+	for callID, source := range s.sources {
+		audio := CallAudio{From: source.audioClass(legFrom), To: source.audioClass(legTo)}
+		if echo, delay := source.echo.result(); echo {
+			audio.Echo, audio.EchoDelayMs = true, delay.Milliseconds()
+		}
+		classes[callID] = audio
+	}
+	return classes
+}
+
+func (src *Source) audioClass(leg int) AudioClass {
+	if class, ok := src.audio[leg].Load().(AudioClass); ok {
+		return class
+	}
+	return AudioUnknown
+}
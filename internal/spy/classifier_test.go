@@ -0,0 +1,99 @@
+package spy
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+func encodeULaw(sample float64) byte {
+	const bias, clip = 0x84, 32635
+	x := int(sample)
+	var sign byte
+	if x < 0 {
+		x, sign = -x, 0x80
+	}
+	if x > clip {
+		x = clip
+	}
+	x += bias
+	exp := 7
+	for mask := 0x4000; x&mask == 0 && exp > 0; mask >>= 1 {
+		exp--
+	}
+	mant := (x >> (exp + 3)) & 0x0f
+	return ^(sign | byte(exp<<4) | byte(mant))
+}
+
+func TestClassifier(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name   string
+		signal func(t float64) float64
+		want   AudioClass
+	}{
+		{
+			name:   "silence",
+			signal: func(float64) float64 { return 0 },
+			want:   AudioSilence,
+		},
+		{
+			name: "ringback",
+			signal: func(t float64) float64 {
+				if math.Mod(t, 6) >= 2 {
+					return 0
+				}
+				return 4000*math.Sin(2*math.Pi*440*t) + 4000*math.Sin(2*math.Pi*480*t)
+			},
+			want: AudioRingback,
+		},
+		{
+			name: "music",
+			signal: func(t float64) float64 {
+				level := 1 + 0.2*math.Sin(2*math.Pi*0.5*t)
+				return level * (3000*math.Sin(2*math.Pi*261.6*t) + 3000*math.Sin(2*math.Pi*329.6*t) + 3000*math.Sin(2*math.Pi*523.2*t))
+			},
+			want: AudioMusic,
+		},
+		{
+			name: "speech",
+			signal: func(t float64) float64 {
+				if math.Mod(t, 1) >= 0.7 {
+					return 0
+				}
+				envelope := math.Pow(math.Sin(2*math.Pi*4*t), 2)
+				return envelope * 8000 * (rng.Float64()*2 - 1)
+			},
+			want: AudioSpeech,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out atomic.Value
+			c := newClassifier(&out)
+			payload := make([]byte, classifierFrame)
+			for frame := 0; frame < 400; frame++ {
+				for i := range payload {
+					payload[i] = encodeULaw(tt.signal(float64(frame*classifierFrame+i) / 8000))
+				}
+				c.observe(0, payload)
+			}
+			if got := out.Load(); got != tt.want {
+				t.Errorf("class = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifierIgnoresOtherCodecs(t *testing.T) {
+	var out atomic.Value
+	c := newClassifier(&out)
+	for i := 0; i < classifierWindow; i++ {
+		c.observe(111, make([]byte, classifierFrame))
+	}
+	if got := out.Load(); got != AudioUnknown {
+		t.Errorf("class = %v, want %v", got, AudioUnknown)
+	}
+}
@@ -0,0 +1,82 @@
+package spy
+
+import (
+	"fmt"
+	"time"
+)
+
+// ClientStats is a summary of the browser's RTCPeerConnection.getStats()
+// report for a spy session, covering the browser end of the spy leg.
+type ClientStats struct {
+	Time             time.Time `json:"time"`
+	PacketsReceived  uint64    `json:"packets_received"`
+	PacketsLost      int64     `json:"packets_lost"`
+	BytesReceived    uint64    `json:"bytes_received"`
+	Jitter           float64   `json:"jitter"`
+	RoundTripTime    float64   `json:"round_trip_time"`
+	ConcealedSamples uint64    `json:"concealed_samples"`
+}
+
+// SessionDetails describes a spy session from both ends: the media the
+// backend receives from rtpengine and what the browser reports.
+type SessionDetails struct {
+	ID          string       `json:"id"`
+	CallID      string       `json:"call_id"`
+	Priority    string       `json:"priority"`
+	StartedAt   time.Time    `json:"started_at"`
+	SourceState SourceState  `json:"source_state"`
+	StateReason string       `json:"state_reason"`
+	BackendFrom LegQuality   `json:"backend_from"`
+	BackendTo   LegQuality   `json:"backend_to"`
+	Client      *ClientStats `json:"client"`
+}
+
+func (s *Service) session(sessionID string) (*Session, error) {
+	s.sessionsMu.RLock()
+	sess, ok := s.sessions[sessionID]
+	s.sessionsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	return sess, nil
+}
+
+// RecordClientStats stores the latest browser stats of a session and returns
+// the session they belong to.
+func (s *Service) RecordClientStats(sessionID string, stats ClientStats) (*Session, error) {
+	sess, err := s.session(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Time.IsZero() {
+		stats.Time = time.Now()
+	}
+	sess.clientStats.Store(&stats)
+	return sess, nil
+}
+
+// SessionDetails returns the details of an active session.
+func (s *Service) SessionDetails(sessionID string) (*SessionDetails, error) {
+	sess, err := s.session(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &SessionDetails{
+		ID:        sess.ID,
+		CallID:    sess.CallID,
+		Priority:  sess.Priority.String(),
+		StartedAt: sess.StartedAt,
+		Client:    sess.clientStats.Load(),
+	}
+
+	s.sourcesMu.RLock()
+	source, ok := s.sources[sess.CallID]
+	s.sourcesMu.RUnlock()
+	if ok {
+		details.SourceState, details.StateReason, _ = source.State()
+		details.BackendFrom = source.StatsFrom.quality()
+		details.BackendTo = source.StatsTo.quality()
+	}
+	return details, nil
+}
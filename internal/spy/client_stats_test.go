@@ -0,0 +1,30 @@
+package spy
+
+import "testing"
+
+func TestClientStats(t *testing.T) {
+	source := NewSource("call-1", "a", "b")
+	source.StatsFrom.observe(&sequence{}, 1, 160)
+	s := &Service{
+		sources:  map[string]*Source{"call-1": source},
+		sessions: map[string]*Session{"s1": {ID: "s1", CallID: "call-1", Priority: PriorityHigh}},
+	}
+
+	if _, err := s.RecordClientStats("missing", ClientStats{}); err == nil {
+		t.Error("expected error for unknown session")
+	}
+	if _, err := s.RecordClientStats("s1", ClientStats{PacketsReceived: 50, PacketsLost: 2}); err != nil {
+		t.Fatalf("RecordClientStats() error = %v", err)
+	}
+
+	details, err := s.SessionDetails("s1")
+	if err != nil {
+		t.Fatalf("SessionDetails() error = %v", err)
+	}
+	if details.Client == nil || details.Client.PacketsReceived != 50 || details.Client.Time.IsZero() {
+		t.Errorf("unexpected client stats: %+v", details.Client)
+	}
+	if details.BackendFrom.Packets != 1 || details.Priority != "high" {
+		t.Errorf("unexpected details: %+v", details)
+	}
+}
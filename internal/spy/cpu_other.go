@@ -0,0 +1,11 @@
+//go:build !unix
+
+package spy
+
+import "time"
+
+// processCPUTime is not implemented on this platform; CPU based admission
+// control never triggers.
+func processCPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,159 @@
+package spy
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+const (
+	// echoSlot is the time resolution of the leg envelopes, one classifier
+	// frame.
+	echoSlot = 20 * time.Millisecond
+	// echoWindow is how many slots (6s) are correlated.
+	echoWindow = 300
+	// echoMaxLag bounds the delay between the legs that is searched, 500ms
+	// either way.
+	echoMaxLag = 25
+	// echoEvery is how many slots pass between analyses.
+	echoEvery = 50
+	// echoThreshold is the envelope correlation above which the legs are
+	// considered to carry the same audio.
+	echoThreshold = 0.9
+	// echoMinActive is the fraction of active frames both legs need before
+	// they are compared, so two silent legs are not flagged.
+	echoMinActive = 0.2
+	// echoFloorDB clamps the envelope so the noise floor does not dominate
+	// the correlation.
+	echoFloorDB = activeThresholdDB - 15
+)
+
+// echoDetector flags calls whose legs carry nearly identical audio, as with
+// an rtpengine media loop or strong echo. It cross-correlates the energy
+// envelopes of the two legs over a few seconds at delays up to echoMaxLag;
+// two people talking have envelopes that take turns and correlate poorly.
+type echoDetector struct {
+	mu       sync.Mutex
+	start    time.Time
+	envelope [2][echoWindow]float64
+	// next is the next slot each leg writes.
+	next     [2]int64
+	analysed int64
+	echo     bool
+	delay    time.Duration
+}
+
+// observe records the energy of a frame of leg received at now. It reports
+// the delay between the legs when the call has just been found to echo.
+func (d *echoDetector) observe(leg int, now time.Time, energyDB float64) (time.Duration, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.start.IsZero() {
+		d.start = now
+	}
+	slot := int64(now.Sub(d.start) / echoSlot)
+	// Slots without frames, e.g. lost packets, count as silence.
+	for ; d.next[leg] < slot; d.next[leg]++ {
+		d.envelope[leg][d.next[leg]%echoWindow] = echoFloorDB
+	}
+	d.envelope[leg][slot%echoWindow] = math.Max(energyDB, echoFloorDB)
+	if slot >= d.next[leg] {
+		d.next[leg] = slot + 1
+	}
+
+	complete := min(d.next[legFrom], d.next[legTo])
+	if complete < echoWindow || complete < d.analysed+echoEvery {
+		return 0, false
+	}
+	d.analysed = complete
+
+	var from, to [echoWindow]float64
+	for i := range echoWindow {
+		idx := (complete - echoWindow + int64(i)) % echoWindow
+		from[i], to[i] = d.envelope[legFrom][idx], d.envelope[legTo][idx]
+	}
+	corr, lag := correlateEnvelopes(from[:], to[:])
+	was := d.echo
+	d.echo = corr >= echoThreshold
+	d.delay = time.Duration(lag) * echoSlot
+	return d.delay, d.echo && !was
+}
+
+func (d *echoDetector) result() (bool, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.echo, d.delay
+}
+
+// correlateEnvelopes returns the highest Pearson correlation of a and b at
+// any delay up to echoMaxLag and that delay in slots, positive when b lags
+// behind a. Envelopes with too little activity correlate as zero.
+func correlateEnvelopes(a, b []float64) (float64, int) {
+	if activeFraction(a) < echoMinActive || activeFraction(b) < echoMinActive {
+		return 0, 0
+	}
+
+	best, bestLag := math.Inf(-1), 0
+	for lag := -echoMaxLag; lag <= echoMaxLag; lag++ {
+		var x, y []float64
+		if lag >= 0 {
+			x, y = a[:len(a)-lag], b[lag:]
+		} else {
+			x, y = a[-lag:], b[:len(b)+lag]
+		}
+		if c := pearson(x, y); c > best {
+			best, bestLag = c, lag
+		}
+	}
+	return best, bestLag
+}
+
+func activeFraction(envelope []float64) float64 {
+	var active int
+	for _, e := range envelope {
+		if e >= activeThresholdDB {
+			active++
+		}
+	}
+	return float64(active) / float64(len(envelope))
+}
+
+func pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	var sx, sy, sxx, syy, sxy float64
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+		sxx += x[i] * x[i]
+		syy += y[i] * y[i]
+		sxy += x[i] * y[i]
+	}
+	cov := sxy - sx*sy/n
+	vx, vy := sxx-sx*sx/n, syy-sy*sy/n
+	if vx <= 0 || vy <= 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+// EchoAlert is sent to the browsers listening to a call when both of its
+// legs are found to carry the same audio.
+type EchoAlert struct {
+	Type    string `json:"type"`
+	CallID  string `json:"call_id"`
+	DelayMs int64  `json:"delay_ms"`
+	// Labels are the instance's static labels.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (s *Service) echoDetected(source *Source, delay time.Duration) {
+	log.Println("Echo: both legs of call", redact.CallID(source.CallID), "carry the same audio,", delay, "apart")
+	s.echoCounter.Add(context.Background(), 1)
+	s.notifySessions(source, EchoAlert{Type: string(catalog.EventEcho), CallID: source.CallID, DelayMs: delay.Milliseconds(), Labels: s.labels()})
+}
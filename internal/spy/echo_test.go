@@ -0,0 +1,82 @@
+package spy
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestEchoDetector(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// speech is a syllabic energy envelope with pauses.
+	speech := make([]float64, 2*echoWindow)
+	for i := range speech {
+		if (i/15)%3 == 2 {
+			speech[i] = -80
+		} else {
+			speech[i] = -30 + 10*rng.Float64()
+		}
+	}
+	// turns has a second speaker answering in the pauses of the first.
+	turns := make([]float64, len(speech))
+	for i := range turns {
+		if (i/15)%3 == 2 {
+			turns[i] = -30 + 10*rng.Float64()
+		} else {
+			turns[i] = -80
+		}
+	}
+	const lag = 7
+	echoed := make([]float64, len(speech))
+	for i := range echoed {
+		echoed[i] = -80
+		if i >= lag {
+			echoed[i] = speech[i-lag] - 12
+		}
+	}
+
+	tests := []struct {
+		name string
+		to   []float64
+		want bool
+	}{
+		{"conversation", turns, false},
+		{"echo", echoed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d echoDetector
+			start := time.Unix(0, 0)
+			var detected bool
+			var delay time.Duration
+			for i := range speech {
+				now := start.Add(time.Duration(i) * echoSlot)
+				if dl, ok := d.observe(legFrom, now, speech[i]); ok {
+					detected, delay = true, dl
+				}
+				if dl, ok := d.observe(legTo, now, tt.to[i]); ok {
+					detected, delay = true, dl
+				}
+			}
+			if detected != tt.want {
+				t.Fatalf("detected = %v, want %v", detected, tt.want)
+			}
+			if echo, _ := d.result(); echo != tt.want {
+				t.Errorf("result() = %v, want %v", echo, tt.want)
+			}
+			if tt.want && delay != lag*echoSlot {
+				t.Errorf("delay = %v, want %v", delay, lag*echoSlot)
+			}
+		})
+	}
+}
+
+func TestCorrelateEnvelopesIgnoresSilence(t *testing.T) {
+	silent := make([]float64, echoWindow)
+	for i := range silent {
+		silent[i] = echoFloorDB
+	}
+	if corr, _ := correlateEnvelopes(silent, silent); corr != 0 {
+		t.Errorf("corr = %v, want 0 for silent legs", corr)
+	}
+}
@@ -0,0 +1,60 @@
+package spy
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// RunFollow refreshes every source with attached sessions each interval
+// until ctx is cancelled, so supervisors stay on the conversation when a
+// transfer replaces one of its legs.
+func (s *Service) RunFollow(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.followTick(ctx)
+		}
+	}
+}
+
+func (s *Service) followTick(ctx context.Context) {
+	ctx = rtpengine.WithLabel(ctx, rtpengine.Label{Purpose: rtpengine.PurposeFollow})
+	for _, callID := range s.attachedCalls() {
+		update, err := s.RefreshSource(ctx, callID)
+		if err != nil {
+			log.Println("Follow: failed to refresh call", redact.CallID(callID), ":", err)
+			continue
+		}
+		if len(update.Changed) > 0 {
+			log.Println("Follow: call", redact.CallID(callID), "moved to new", strings.Join(update.Changed, ", "), "leg")
+		}
+	}
+}
+
+// attachedCalls returns the calls of the sources at least one browser
+// session is attached to.
+func (s *Service) attachedCalls() []string {
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+
+	var calls []string
+	for callID, source := range s.sources {
+		source.mu.RLock()
+		attached := len(source.Sessions) > 0
+		source.mu.RUnlock()
+		if attached {
+			calls = append(calls, callID)
+		}
+	}
+	return calls
+}
@@ -0,0 +1,38 @@
+package spy
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFollowOnlyRefreshesAttachedSources(t *testing.T) {
+	s := newStateTestService()
+	s.rtpClient = &mockRTPEngineClient{queryResult: map[string]interface{}{
+		"tags": map[string]interface{}{
+			"a": map[string]interface{}{"created": int64(1)},
+			"b": map[string]interface{}{"created": int64(2)},
+		},
+	}}
+
+	watched := NewSource("call-1", "a", "b")
+	watched.Sessions["sess-1"] = &Session{ID: "sess-1"}
+	s.sources["call-1"] = watched
+	s.sources["call-2"] = NewSource("call-2", "a", "b")
+
+	calls := s.attachedCalls()
+	if len(calls) != 1 || calls[0] != "call-1" {
+		t.Fatalf("attachedCalls() = %v, want [call-1]", calls)
+	}
+
+	update, err := s.RefreshSource(context.Background(), "call-1")
+	if err != nil {
+		t.Fatalf("RefreshSource() error = %v", err)
+	}
+	if len(update.Changed) != 0 {
+		t.Errorf("expected unchanged legs, got %v", update.Changed)
+	}
+
+	if _, err := s.RefreshSource(context.Background(), "missing"); err != ErrSourceNotFound {
+		t.Errorf("expected ErrSourceNotFound, got %v", err)
+	}
+}
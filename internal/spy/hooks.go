@@ -0,0 +1,152 @@
+package spy
+
+import (
+	"log"
+	"sync"
+)
+
+// maxPendingHooks bounds the events queued for hooks that fall behind;
+// later events are dropped until they catch up.
+const maxPendingHooks = 4096
+
+// SessionHook is called with the source a browser session is attached to.
+type SessionHook func(source *Source, sess *Session)
+
+// SourceHook is called when a backend source changes lifecycle state.
+type SourceHook func(source *Source)
+
+// QualityHook is called with the quality computed for a call.
+type QualityHook func(quality CallQuality)
+
+// hooks holds the lifecycle callbacks registered by embedders. Events are
+// queued and the callbacks run one at a time, in the order the events
+// happened, on a goroutine of their own: outside of the service locks, so
+// they may call back into the service, and without holding up sessions when
+// they are slow. A panicking callback is logged and skipped.
+type hooks struct {
+	mu             sync.RWMutex
+	sessionCreated []SessionHook
+	sessionClosed  []SessionHook
+	sourceCreated  []SourceHook
+	sourceClosed   []SourceHook
+	quality        []QualityHook
+
+	queueMu  sync.Mutex
+	queue    []func()
+	draining bool
+}
+
+// OnSessionCreated registers fn to be called after a browser session is created.
+func (s *Service) OnSessionCreated(fn SessionHook) {
+	s.hooks.mu.Lock()
+	s.hooks.sessionCreated = append(s.hooks.sessionCreated, fn)
+	s.hooks.mu.Unlock()
+}
+
+// OnSessionClosed registers fn to be called after a browser session is removed.
+func (s *Service) OnSessionClosed(fn SessionHook) {
+	s.hooks.mu.Lock()
+	s.hooks.sessionClosed = append(s.hooks.sessionClosed, fn)
+	s.hooks.mu.Unlock()
+}
+
+// OnSourceCreated registers fn to be called after both legs of a call are subscribed.
+func (s *Service) OnSourceCreated(fn SourceHook) {
+	s.hooks.mu.Lock()
+	s.hooks.sourceCreated = append(s.hooks.sourceCreated, fn)
+	s.hooks.mu.Unlock()
+}
+
+// OnSourceClosed registers fn to be called after a source is torn down.
+func (s *Service) OnSourceClosed(fn SourceHook) {
+	s.hooks.mu.Lock()
+	s.hooks.sourceClosed = append(s.hooks.sourceClosed, fn)
+	s.hooks.mu.Unlock()
+}
+
+// OnQuality registers fn to be called with every quality pushed to the
+// sessions of a call.
+func (s *Service) OnQuality(fn QualityHook) {
+	s.hooks.mu.Lock()
+	s.hooks.quality = append(s.hooks.quality, fn)
+	s.hooks.mu.Unlock()
+}
+
+func (h *hooks) fireSession(list *[]SessionHook, source *Source, sess *Session) {
+	h.mu.RLock()
+	fns := *list
+	h.mu.RUnlock()
+
+	h.dispatch(func() {
+		for _, fn := range fns {
+			safely("session", func() { fn(source, sess) })
+		}
+	})
+}
+
+func (h *hooks) fireSource(list *[]SourceHook, source *Source) {
+	h.mu.RLock()
+	fns := *list
+	h.mu.RUnlock()
+
+	h.dispatch(func() {
+		for _, fn := range fns {
+			safely("source", func() { fn(source) })
+		}
+	})
+}
+
+func (h *hooks) fireQuality(quality CallQuality) {
+	h.mu.RLock()
+	fns := h.quality
+	h.mu.RUnlock()
+
+	h.dispatch(func() {
+		for _, fn := range fns {
+			safely("quality", func() { fn(quality) })
+		}
+	})
+}
+
+// dispatch queues an event, starting a goroutine to drain the queue unless
+// one is running.
+func (h *hooks) dispatch(event func()) {
+	h.queueMu.Lock()
+	defer h.queueMu.Unlock()
+
+	if len(h.queue) >= maxPendingHooks {
+		log.Printf("spy: %d hook events pending, dropping one", len(h.queue))
+		return
+	}
+	h.queue = append(h.queue, event)
+	if !h.draining {
+		h.draining = true
+		go h.drain()
+	}
+}
+
+func (h *hooks) drain() {
+	for {
+		h.queueMu.Lock()
+		if len(h.queue) == 0 {
+			h.draining = false
+			h.queueMu.Unlock()
+			return
+		}
+		event := h.queue[0]
+		h.queue[0] = nil
+		h.queue = h.queue[1:]
+		h.queueMu.Unlock()
+
+		event()
+	}
+}
+
+func safely(kind string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("spy: %s hook panicked: %v", kind, r)
+		}
+	}()
+	fn()
+}
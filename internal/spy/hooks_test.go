@@ -0,0 +1,114 @@
+package spy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+)
+
+// hookedService restores one call, so its source is created and can be
+// closed through the same paths spy requests take.
+func hookedService(t *testing.T) *Service {
+	t.Helper()
+	s, err := NewService(config.Default(), &restoreRaceClient{}, nil)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	return s
+}
+
+func restoreCall(s *Service) *Source {
+	s.Restore(context.Background(), Snapshot{Sources: []SourceSnapshot{{CallID: "call-1", FromTag: "a", ToTag: "b"}}})
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+	return s.sources["call-1"]
+}
+
+func awaitHook(t *testing.T, events <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-events:
+		if got != want {
+			t.Fatalf("hook %q ran, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("hook %q never ran", want)
+	}
+}
+
+func TestHooksOrder(t *testing.T) {
+	s := hookedService(t)
+	events := make(chan string, 8)
+	s.OnSourceCreated(func(*Source) { events <- "created 1" })
+	s.OnSourceCreated(func(*Source) { events <- "created 2" })
+	s.OnSourceClosed(func(*Source) { events <- "closed" })
+	s.OnSessionClosed(func(_ *Source, sess *Session) { events <- "session " + sess.ID + " closed" })
+
+	source := restoreCall(s)
+	if source == nil {
+		t.Fatal("call not restored")
+	}
+	sess := &Session{ID: "s1", CallID: "call-1"}
+	s.sessionsMu.Lock()
+	s.sessions["s1"] = sess
+	s.sessionsMu.Unlock()
+	s.cleanupSession("s1", source)
+	s.closeSource(source, "test")
+
+	for _, want := range []string{"created 1", "created 2", "session s1 closed", "closed"} {
+		awaitHook(t, events, want)
+	}
+}
+
+// Hooks run outside sourcesMu, so they may call back into the service.
+func TestHooksCallBackIntoService(t *testing.T) {
+	s := hookedService(t)
+	events := make(chan string, 2)
+	s.OnSourceCreated(func(source *Source) {
+		if len(s.Snapshot().Sources) == 1 {
+			events <- "created"
+		}
+	})
+	s.OnSourceClosed(func(source *Source) {
+		if len(s.Snapshot().Sources) == 0 {
+			events <- "closed"
+		}
+	})
+
+	source := restoreCall(s)
+	awaitHook(t, events, "created")
+	s.closeSource(source, "test")
+	awaitHook(t, events, "closed")
+}
+
+func TestHooksDoNotBlockService(t *testing.T) {
+	s := hookedService(t)
+	release := make(chan struct{})
+	events := make(chan string, 4)
+	s.OnSourceCreated(func(*Source) { panic("broken embedder") })
+	s.OnSourceCreated(func(*Source) { <-release })
+	s.OnSourceClosed(func(*Source) { events <- "closed" })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		source := restoreCall(s)
+		s.closeSource(source, "test")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow hook held up the service")
+	}
+
+	// The hooks of later events run once the slow one returns.
+	select {
+	case <-events:
+		t.Fatal("closed hook ran before the created hooks finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	awaitHook(t, events, "closed")
+}
@@ -0,0 +1,328 @@
+package spy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+const (
+	// maxMediaEvents caps the history kept per call, dropping the oldest.
+	maxMediaEvents = 1000
+	// bitrateWindow is how often subscribed legs report their bitrate.
+	bitrateWindow = 10 * time.Second
+	// ptimeConfirmations is how many consecutive packets must agree before a
+	// ptime change is reported, so DTX gaps and reordering are ignored.
+	ptimeConfirmations = 3
+)
+
+// Kinds of media history events.
+const (
+	MediaCodec   = "codec"
+	MediaPtime   = "ptime"
+	MediaBitrate = "bitrate"
+)
+
+// MediaEvent is a codec, ptime or bitrate observation of one leg of a call.
+// Origin is "rtp" for subscribed legs and "query" for periodic rtpengine
+// queries, whose legs are named by tag.
+type MediaEvent struct {
+	Time        time.Time `json:"time"`
+	Leg         string    `json:"leg"`
+	Origin      string    `json:"origin"`
+	Kind        string    `json:"kind"`
+	Codec       string    `json:"codec,omitempty"`
+	PayloadType *uint8    `json:"payload_type,omitempty"`
+	PtimeMs     uint32    `json:"ptime_ms,omitempty"`
+	BitrateBps  uint64    `json:"bitrate_bps,omitempty"`
+}
+
+type callMedia struct {
+	events  []MediaEvent
+	endedAt time.Time
+	// queried holds the last values seen per tag and media by the poller.
+	queried map[string]*queriedMedia
+}
+
+type queriedMedia struct {
+	codec string
+	ptime uint32
+	bytes uint64
+	at    time.Time
+}
+
+// mediaHistories keeps the media history of live calls and, for retention,
+// of ended ones.
+type mediaHistories struct {
+	mu        sync.Mutex
+	calls     map[string]*callMedia
+	retention time.Duration
+}
+
+func (m *mediaHistories) call(callID string) *callMedia {
+	if m.calls == nil {
+		m.calls = make(map[string]*callMedia)
+	}
+	c, ok := m.calls[callID]
+	if !ok {
+		c = &callMedia{queried: make(map[string]*queriedMedia)}
+		m.calls[callID] = c
+	}
+	return c
+}
+
+func (m *mediaHistories) record(callID string, events ...MediaEvent) {
+	if len(events) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.call(callID)
+	c.endedAt = time.Time{}
+	c.events = append(c.events, events...)
+	if over := len(c.events) - maxMediaEvents; over > 0 {
+		c.events = append(c.events[:0:0], c.events[over:]...)
+	}
+}
+
+// end starts the retention period of a call's history.
+func (m *mediaHistories) end(callID string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.calls[callID]; ok && c.endedAt.IsZero() {
+		c.endedAt = now
+	}
+}
+
+// prune drops histories of calls that ended more than the retention ago.
+func (m *mediaHistories) prune(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for callID, c := range m.calls {
+		if !c.endedAt.IsZero() && now.Sub(c.endedAt) > m.retention {
+			delete(m.calls, callID)
+		}
+	}
+}
+
+// MediaHistory returns the codec, ptime and bitrate history of a call,
+// oldest first. It returns ErrSourceNotFound when nothing was recorded.
+func (s *Service) MediaHistory(callID string) ([]MediaEvent, error) {
+	s.media.mu.Lock()
+	defer s.media.mu.Unlock()
+
+	c, ok := s.media.calls[callID]
+	if !ok {
+		return nil, ErrSourceNotFound
+	}
+	events := make([]MediaEvent, len(c.events))
+	copy(events, c.events)
+	return events, nil
+}
+
+// mediaTracker derives media history events from the RTP of one subscribed
+// leg.
+type mediaTracker struct {
+	leg string
+	// codec returns the codec currently received, which follows payload
+	// type changes.
+	codec func() webrtc.RTPCodecParameters
+
+	started     bool
+	payloadType uint8
+	lastSeq     uint16
+	lastTS      uint32
+
+	ptime          uint32
+	candidate      uint32
+	candidateCount int
+
+	windowStart time.Time
+	windowBytes uint64
+}
+
+func newMediaTracker(leg string, track *webrtc.TrackRemote) *mediaTracker {
+	return &mediaTracker{leg: leg, codec: track.Codec}
+}
+
+func (t *mediaTracker) event(now time.Time, kind string) MediaEvent {
+	pt := t.payloadType
+	return MediaEvent{
+		Time:        now,
+		Leg:         t.leg,
+		Origin:      "rtp",
+		Kind:        kind,
+		Codec:       t.codec().MimeType,
+		PayloadType: &pt,
+		PtimeMs:     t.ptime,
+	}
+}
+
+func (t *mediaTracker) observe(now time.Time, pkt *rtp.Packet) []MediaEvent {
+	var events []MediaEvent
+
+	if !t.started || pkt.PayloadType != t.payloadType {
+		t.started = true
+		t.payloadType = pkt.PayloadType
+		t.ptime, t.candidate, t.candidateCount = 0, 0, 0
+		t.windowStart, t.windowBytes = now, 0
+		events = append(events, t.event(now, MediaCodec))
+	} else if clockRate := t.codec().ClockRate; pkt.SequenceNumber == t.lastSeq+1 && clockRate > 0 && pkt.Timestamp > t.lastTS {
+		ptime := (pkt.Timestamp - t.lastTS) * 1000 / clockRate
+		if ptime != t.candidate {
+			t.candidate, t.candidateCount = ptime, 0
+		}
+		t.candidateCount++
+		if t.candidateCount == ptimeConfirmations && ptime != t.ptime {
+			t.ptime = ptime
+			events = append(events, t.event(now, MediaPtime))
+		}
+	}
+	t.lastSeq, t.lastTS = pkt.SequenceNumber, pkt.Timestamp
+
+	t.windowBytes += uint64(len(pkt.Payload))
+	if elapsed := now.Sub(t.windowStart); elapsed >= bitrateWindow {
+		ev := t.event(now, MediaBitrate)
+		ev.BitrateBps = uint64(float64(t.windowBytes*8) / elapsed.Seconds())
+		events = append(events, ev)
+		t.windowStart, t.windowBytes = now, 0
+	}
+	return events
+}
+
+// RunMediaPoll queries every call each interval until ctx is cancelled and
+// records codec, ptime and bitrate changes reported by rtpengine, so calls
+// nobody listens to have a history too.
+func (s *Service) RunMediaPoll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mediaPollTick(ctx)
+		}
+	}
+}
+
+func (s *Service) mediaPollTick(ctx context.Context) {
+	calls, err := s.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+	if err != nil {
+		log.Println("Media history: failed to list calls:", err)
+		return
+	}
+
+	now := time.Now()
+	active := make(map[string]bool, len(calls))
+	for _, callID := range calls {
+		active[callID] = true
+		details, err := s.rtpClient.QueryCall(ctx, callID)
+		if err != nil {
+			log.Println("Media history: failed to query call", redact.CallID(callID), ":", err)
+			continue
+		}
+		s.media.record(callID, s.media.diffQuery(callID, details, now)...)
+	}
+
+	s.media.mu.Lock()
+	var ended []string
+	for callID := range s.media.calls {
+		if !active[callID] {
+			ended = append(ended, callID)
+		}
+	}
+	s.media.mu.Unlock()
+	for _, callID := range ended {
+		s.sourcesMu.RLock()
+		_, subscribed := s.sources[callID]
+		s.sourcesMu.RUnlock()
+		if !subscribed {
+			s.media.end(callID, now)
+		}
+	}
+	s.media.prune(now)
+}
+
+// diffQuery compares the audio medias of a query result with the previous
+// poll and returns the resulting events.
+func (m *mediaHistories) diffQuery(callID string, details map[string]interface{}, now time.Time) []MediaEvent {
+	tags, _ := details["tags"].(map[string]interface{})
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.call(callID)
+
+	var events []MediaEvent
+	for _, name := range names {
+		tag, _ := tags[name].(map[string]interface{})
+		medias, _ := tag["medias"].([]interface{})
+		for i, v := range medias {
+			media, _ := v.(map[string]interface{})
+			if t, _ := media["type"].(string); t != "audio" {
+				continue
+			}
+			codec, _ := media["codec"].(string)
+			ptime := uint32(number(media["ptime"]))
+			var bytes uint64
+			if streams, ok := media["streams"].([]interface{}); ok && len(streams) > 0 {
+				if stream, ok := streams[0].(map[string]interface{}); ok {
+					if stats, ok := stream["stats"].(map[string]interface{}); ok {
+						bytes = uint64(number(stats["bytes"]))
+					}
+				}
+			}
+
+			key := fmt.Sprintf("%s/%d", name, i)
+			prev, seen := c.queried[key]
+			c.queried[key] = &queriedMedia{codec: codec, ptime: ptime, bytes: bytes, at: now}
+			base := MediaEvent{Time: now, Leg: name, Origin: "query", Codec: codec, PtimeMs: ptime}
+
+			if codec != "" && (!seen || codec != prev.codec) {
+				ev := base
+				ev.Kind = MediaCodec
+				events = append(events, ev)
+			}
+			if ptime != 0 && seen && prev.ptime != 0 && ptime != prev.ptime {
+				ev := base
+				ev.Kind = MediaPtime
+				events = append(events, ev)
+			}
+			if seen && bytes >= prev.bytes && now.After(prev.at) {
+				ev := base
+				ev.Kind = MediaBitrate
+				ev.BitrateBps = uint64(float64((bytes-prev.bytes)*8) / now.Sub(prev.at).Seconds())
+				events = append(events, ev)
+			}
+		}
+	}
+	return events
+}
+
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	}
+	return 0
+}
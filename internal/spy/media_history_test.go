@@ -0,0 +1,86 @@
+package spy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestMediaTracker(t *testing.T) {
+	codec := webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMA, ClockRate: 8000}}
+	tracker := &mediaTracker{leg: "from", codec: func() webrtc.RTPCodecParameters { return codec }}
+
+	start := time.Unix(0, 0)
+	var kinds []string
+	send := func(i int, pt uint8, seq uint16, ts uint32) {
+		pkt := &rtp.Packet{Header: rtp.Header{PayloadType: pt, SequenceNumber: seq, Timestamp: ts}, Payload: make([]byte, 160)}
+		for _, ev := range tracker.observe(start.Add(time.Duration(i)*20*time.Millisecond), pkt) {
+			kinds = append(kinds, ev.Kind)
+			if ev.Kind == MediaPtime && ev.PtimeMs != 20 && ev.PtimeMs != 30 {
+				t.Errorf("unexpected ptime %d", ev.PtimeMs)
+			}
+		}
+	}
+
+	// 20ms PCMA, then 30ms after the 10th packet, then a switch to G.722.
+	var seq uint16
+	var ts uint32
+	for i := 0; i < 20; i++ {
+		step := uint32(160)
+		if i >= 10 {
+			step = 240
+		}
+		seq++
+		ts += step
+		send(i, 8, seq, ts)
+	}
+	codec.MimeType = webrtc.MimeTypeG722
+	seq++
+	send(20, 9, seq, ts+160)
+
+	want := []string{MediaCodec, MediaPtime, MediaPtime, MediaCodec}
+	if len(kinds) != len(want) {
+		t.Fatalf("events = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, kinds[i], want[i])
+		}
+	}
+}
+
+func TestMediaHistoryFromQueries(t *testing.T) {
+	s := &Service{}
+	m := &s.media
+	query := func(codec string, bytes int64) map[string]interface{} {
+		return map[string]interface{}{"tags": map[string]interface{}{
+			"a": map[string]interface{}{"medias": []interface{}{map[string]interface{}{
+				"type":    "audio",
+				"codec":   codec,
+				"ptime":   int64(20),
+				"streams": []interface{}{map[string]interface{}{"stats": map[string]interface{}{"bytes": bytes}}},
+			}}},
+		}}
+	}
+
+	now := time.Unix(100, 0)
+	m.record("c1", m.diffQuery("c1", query("PCMA", 0), now)...)
+	m.record("c1", m.diffQuery("c1", query("PCMA", 80000), now.Add(10*time.Second))...)
+	m.record("c1", m.diffQuery("c1", query("opus", 100000), now.Add(20*time.Second))...)
+
+	events, err := s.MediaHistory("c1")
+	if err != nil {
+		t.Fatalf("MediaHistory() error = %v", err)
+	}
+	if len(events) != 4 || events[0].Kind != MediaCodec || events[1].BitrateBps != 64000 || events[2].Codec != "opus" || events[3].BitrateBps != 16000 {
+		t.Errorf("unexpected events: %+v", events)
+	}
+
+	s.media.end("c1", now)
+	s.media.prune(now.Add(time.Second))
+	if _, err := s.MediaHistory("c1"); err != ErrSourceNotFound {
+		t.Errorf("expected pruned history, got %v", err)
+	}
+}
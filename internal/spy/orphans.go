@@ -0,0 +1,52 @@
+package spy
+
+import (
+	"context"
+	"log"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// CleanupOrphans releases subscriptions this instance holds on rtpengine
+// without a local source, such as the ones left behind by a crash, and
+// returns how many were released. It must run before sources are created
+// concurrently, i.e. at startup, as a subscription being set up has no
+// source yet.
+func (s *Service) CleanupOrphans(ctx context.Context) (int, error) {
+	calls, err := s.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	owned := make(map[string]bool)
+	s.sourcesMu.RLock()
+	for _, source := range s.sources {
+		source.mu.RLock()
+		owned[source.SubTagFrom] = true
+		owned[source.SubTagTo] = true
+		source.mu.RUnlock()
+	}
+	s.sourcesMu.RUnlock()
+
+	released := 0
+	for _, callID := range calls {
+		details, err := s.rtpClient.QueryCall(ctx, callID)
+		if err != nil {
+			log.Println("Orphan cleanup: failed to query call", redact.CallID(callID), ":", err)
+			continue
+		}
+		tags, _ := details["tags"].(map[string]interface{})
+		for tag := range tags {
+			if !rtpengine.IsSubscriptionTag(tag, s.cfg.InstanceID) || owned[tag] {
+				continue
+			}
+			if _, err := s.rtpClient.UnSubscribe(ctx, callID, tag); err != nil {
+				log.Println("Orphan cleanup: failed to release subscription", redact.Tag(tag), "for call", redact.CallID(callID), ":", err)
+				continue
+			}
+			released++
+		}
+	}
+	return released, nil
+}
@@ -0,0 +1,42 @@
+package spy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+func TestCleanupOrphans(t *testing.T) {
+	ours := rtpengine.SubscriptionTagPrefix("mon-1")
+	theirs := rtpengine.SubscriptionTagPrefix("mon-1-b")
+	live, orphan := ours+uuid.New().String(), ours+uuid.New().String()
+	client := &mockRTPEngineClient{
+		calls: []string{"call-1"},
+		queryResult: map[string]interface{}{"tags": map[string]interface{}{
+			"caller":                     map[string]interface{}{},
+			live:                         map[string]interface{}{},
+			orphan:                       map[string]interface{}{},
+			theirs + uuid.New().String(): map[string]interface{}{},
+		}},
+	}
+
+	s := newStateTestService()
+	s.cfg = &config.Config{InstanceID: "mon-1"}
+	s.rtpClient = client
+	source := NewSource("call-1", "caller", "callee")
+	source.SubTagFrom = live
+	s.sources["call-1"] = source
+
+	released, err := s.CleanupOrphans(context.Background())
+	if err != nil {
+		t.Fatalf("CleanupOrphans() error = %v", err)
+	}
+	if released != 1 || !reflect.DeepEqual(client.unsubscribed, []string{orphan}) {
+		t.Errorf("released %d, unsubscribed %v; want only the orphan", released, client.unsubscribed)
+	}
+}
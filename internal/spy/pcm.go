@@ -0,0 +1,80 @@
+package spy
+
+import (
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// pcmSampleRate is the rate of the exported audio, that of G.711.
+const pcmSampleRate = 8000
+
+// PCMFrame is the decoded audio of one RTP packet received on a leg of a
+// subscribed call, spied or shadow.
+type PCMFrame struct {
+	CallID string
+	// Leg is "from" or "to" and Tag the call tag the leg is subscribed to.
+	Leg            string
+	Tag            string
+	Received       time.Time
+	SequenceNumber uint16
+	RTPTimestamp   uint32
+	SampleRate     int
+	Samples        []int16
+}
+
+// PCMSink receives decoded audio on the forwarding path, so it must not
+// block.
+type PCMSink func(PCMFrame)
+
+// SetPCMSink exports the audio of every subscribed leg to sink. Only G.711
+// legs are exported. It must be set before sources are created.
+func (s *Service) SetPCMSink(sink PCMSink) {
+	s.pcmSink = sink
+}
+
+func (s *Service) exportPCM(source *Source, leg string, packet *rtp.Packet) {
+	samples := decodeG711(packet)
+	if samples == nil {
+		return
+	}
+	index := legFrom
+	if leg == legNames[legTo] {
+		index = legTo
+	}
+	if mark := s.exportWatermark(source, index); mark != nil {
+		mark.Mark(samples)
+	}
+
+	source.mu.RLock()
+	tag := source.FromTag
+	if index == legTo {
+		tag = source.ToTag
+	}
+	source.mu.RUnlock()
+
+	frame := PCMFrame{
+		CallID:         source.CallID,
+		Leg:            leg,
+		Tag:            tag,
+		Received:       time.Now(),
+		SequenceNumber: packet.SequenceNumber,
+		RTPTimestamp:   packet.Timestamp,
+		SampleRate:     pcmSampleRate,
+		Samples:        samples,
+	}
+	if s.pcmSink != nil {
+		s.pcmSink(frame)
+	}
+	source.fanOut(frame)
+}
+
+// EncodePCMU encodes the samples of PCMFrames as G.711 μ-law, for consumers
+// republishing them over RTP.
+func EncodePCMU(samples []int16) []byte {
+	payload := make([]byte, len(samples))
+	for i, v := range samples {
+		payload[i] = linearToULaw(v)
+	}
+	return payload
+}
@@ -0,0 +1,28 @@
+package spy
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+func TestExportPCM(t *testing.T) {
+	s := newStateTestService()
+	var frames []PCMFrame
+	s.SetPCMSink(func(f PCMFrame) { frames = append(frames, f) })
+	source := NewSource("call-1", "a", "b")
+
+	s.exportPCM(source, "to", &rtp.Packet{Header: rtp.Header{PayloadType: 0, SequenceNumber: 7}, Payload: []byte{0xff, 0x00}})
+	s.exportPCM(source, "from", &rtp.Packet{Header: rtp.Header{PayloadType: 111}, Payload: []byte{1}})
+
+	if len(frames) != 1 {
+		t.Fatalf("exported %d frames, want 1 (opus is skipped)", len(frames))
+	}
+	f := frames[0]
+	if f.CallID != "call-1" || f.Leg != "to" || f.Tag != "b" || f.SequenceNumber != 7 || f.SampleRate != 8000 {
+		t.Errorf("frame = %+v", f)
+	}
+	if len(f.Samples) != 2 || f.Samples[0] != ulawTable[0xff] || f.Samples[1] != ulawTable[0x00] {
+		t.Errorf("samples = %v", f.Samples)
+	}
+}
@@ -0,0 +1,58 @@
+package spy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Priority classifies spy sessions for load shedding. Under load low priority
+// sessions (wallboards, auto-scan) are refused and shed first, high priority
+// sessions (compliance, live incidents) are never refused by admission control.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority parses "low", "normal" or "high".
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low":
+		return PriorityLow, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority: %q", s)
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context carrying the priority for new sessions.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the session priority carried by ctx, or
+// PriorityNormal when none is set.
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,179 @@
+package spy
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+// CallQuality is pushed to the browsers listening to a call over their events
+// data channel. It scores the monitored call as rtpengine sees it from the
+// RTCP of its endpoints, not the path from rtpengine to the supervisor. A leg
+// is nil while its endpoint has not sent RTCP.
+type CallQuality struct {
+	Type   string    `json:"type"`
+	CallID string    `json:"call_id"`
+	From   *LegScore `json:"from"`
+	To     *LegScore `json:"to"`
+	// Labels are the instance's static labels.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// LegScore is the latest mean opinion score rtpengine computed for the media
+// one endpoint of a call sends.
+type LegScore struct {
+	MOS         float64 `json:"mos"`
+	JitterMs    float64 `json:"jitter_ms"`
+	LossPercent float64 `json:"loss_percent"`
+	RTTMs       float64 `json:"rtt_ms"`
+}
+
+// RunQualityPush sends the quality of every call with attached sessions to
+// its listeners each interval until ctx is cancelled.
+func (s *Service) RunQualityPush(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.qualityTick(ctx)
+		}
+	}
+}
+
+func (s *Service) qualityTick(ctx context.Context) {
+	for _, callID := range s.attachedCalls() {
+		s.sourcesMu.RLock()
+		source, ok := s.sources[callID]
+		s.sourcesMu.RUnlock()
+		if !ok {
+			continue
+		}
+
+		details, err := s.rtpClient.QueryCall(ctx, callID)
+		if err != nil {
+			log.Println("Quality: failed to query call", redact.CallID(callID), ":", err)
+			continue
+		}
+
+		source.mu.RLock()
+		fromTag, toTag := source.FromTag, source.ToTag
+		source.mu.RUnlock()
+		quality := CallQuality{
+			Type:   string(catalog.EventQuality),
+			CallID: callID,
+			From:   legScore(details, fromTag),
+			To:     legScore(details, toTag),
+			Labels: s.labels(),
+		}
+		source.quality.Store(&quality)
+		s.notifySessions(source, quality)
+		s.hooks.fireQuality(quality)
+	}
+}
+
+// Qualities returns the last quality pushed for every call with a source.
+// Calls nobody listened to since quality pushing started are missing.
+func (s *Service) Qualities() map[string]CallQuality {
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+
+	qualities := make(map[string]CallQuality)
+	for callID, source := range s.sources {
+		if q := source.quality.Load(); q != nil {
+			qualities[callID] = *q
+		}
+	}
+	return qualities
+}
+
+// MinMOS is the lower score of the two legs, or zero when neither has one.
+func (q CallQuality) MinMOS() float64 {
+	var mos float64
+	for _, leg := range []*LegScore{q.From, q.To} {
+		if leg != nil && (mos == 0 || leg.MOS < mos) {
+			mos = leg.MOS
+		}
+	}
+	return mos
+}
+
+// legScore finds the MOS of the media received from tag. rtpengine keys its
+// MOS data by SSRC at the top of a query response; the streams of the tag
+// name the SSRCs they receive. The most recent sample of the MOS progression
+// is preferred over the call average.
+func legScore(details map[string]interface{}, tag string) *LegScore {
+	tags, _ := details["tags"].(map[string]interface{})
+	info, _ := tags[tag].(map[string]interface{})
+	ssrcs, _ := details["SSRC"].(map[string]interface{})
+	if info == nil || ssrcs == nil {
+		return nil
+	}
+
+	medias, _ := info["medias"].([]interface{})
+	for _, m := range medias {
+		media, _ := m.(map[string]interface{})
+		if t, _ := media["type"].(string); t != "audio" {
+			continue
+		}
+		streams, _ := media["streams"].([]interface{})
+		for _, st := range streams {
+			stream, _ := st.(map[string]interface{})
+			for _, ssrc := range streamSSRCs(stream) {
+				stats, _ := ssrcs[ssrc].(map[string]interface{})
+				if score := mosSample(stats); score != nil {
+					return score
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// streamSSRCs returns the SSRCs a stream receives, from either the "SSRC"
+// field or the "ingress SSRCs" list of newer rtpengine versions.
+func streamSSRCs(stream map[string]interface{}) []string {
+	var ssrcs []string
+	if v, ok := stream["SSRC"]; ok {
+		ssrcs = append(ssrcs, strconv.FormatUint(uint64(number(v)), 10))
+	}
+	ingress, _ := stream["ingress SSRCs"].([]interface{})
+	for _, i := range ingress {
+		if entry, ok := i.(map[string]interface{}); ok {
+			if v, ok := entry["SSRC"]; ok {
+				ssrcs = append(ssrcs, strconv.FormatUint(uint64(number(v)), 10))
+			}
+		}
+	}
+	return ssrcs
+}
+
+func mosSample(stats map[string]interface{}) *LegScore {
+	sample, _ := stats["average MOS"].(map[string]interface{})
+	if progression, ok := stats["MOS progression"].(map[string]interface{}); ok {
+		if entries, ok := progression["entries"].([]interface{}); ok && len(entries) > 0 {
+			if last, ok := entries[len(entries)-1].(map[string]interface{}); ok {
+				sample = last
+			}
+		}
+	}
+	mos := number(sample["MOS"])
+	if mos <= 0 {
+		return nil
+	}
+	// rtpengine reports MOS times ten and the round-trip time in
+	// microseconds.
+	return &LegScore{
+		MOS:         mos / 10,
+		JitterMs:    number(sample["jitter"]),
+		LossPercent: number(sample["packet loss"]),
+		RTTMs:       number(sample["round-trip time"]) / 1000,
+	}
+}
@@ -0,0 +1,67 @@
+package spy
+
+import "testing"
+
+func TestLegScore(t *testing.T) {
+	details := map[string]interface{}{
+		"tags": map[string]interface{}{
+			"caller": map[string]interface{}{
+				"medias": []interface{}{
+					map[string]interface{}{
+						"type":    "audio",
+						"streams": []interface{}{map[string]interface{}{"SSRC": int64(1111)}},
+					},
+				},
+			},
+			"callee": map[string]interface{}{
+				"medias": []interface{}{
+					map[string]interface{}{
+						"type": "audio",
+						"streams": []interface{}{map[string]interface{}{
+							"ingress SSRCs": []interface{}{map[string]interface{}{"SSRC": int64(2222)}},
+						}},
+					},
+				},
+			},
+			"silent": map[string]interface{}{
+				"medias": []interface{}{
+					map[string]interface{}{
+						"type":    "audio",
+						"streams": []interface{}{map[string]interface{}{"SSRC": int64(3333)}},
+					},
+				},
+			},
+		},
+		"SSRC": map[string]interface{}{
+			"1111": map[string]interface{}{
+				"average MOS": map[string]interface{}{"MOS": int64(30)},
+				"MOS progression": map[string]interface{}{
+					"entries": []interface{}{
+						map[string]interface{}{"MOS": int64(41), "jitter": int64(2), "packet loss": int64(0), "round-trip time": int64(40000)},
+						map[string]interface{}{"MOS": int64(36), "jitter": int64(15), "packet loss": int64(3), "round-trip time": int64(120000)},
+					},
+				},
+			},
+			"2222": map[string]interface{}{
+				"average MOS": map[string]interface{}{"MOS": int64(43), "jitter": int64(1), "packet loss": int64(0), "round-trip time": int64(20000)},
+			},
+			"3333": map[string]interface{}{},
+		},
+	}
+
+	tests := []struct {
+		tag  string
+		want *LegScore
+	}{
+		{"caller", &LegScore{MOS: 3.6, JitterMs: 15, LossPercent: 3, RTTMs: 120}},
+		{"callee", &LegScore{MOS: 4.3, JitterMs: 1, LossPercent: 0, RTTMs: 20}},
+		{"silent", nil},
+		{"unknown", nil},
+	}
+	for _, tt := range tests {
+		got := legScore(details, tt.tag)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("legScore(%q) = %+v, want %+v", tt.tag, got, tt.want)
+		}
+	}
+}
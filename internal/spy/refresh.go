@@ -0,0 +1,251 @@
+package spy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/catalog"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+)
+
+// ErrSourceNotFound is returned when no source is subscribed for a call.
+var ErrSourceNotFound = errors.New("no source for call")
+
+// SourceUpdate describes a change of the legs a source is subscribed to. It
+// is also sent to the attached browsers over their events data channel.
+type SourceUpdate struct {
+	Type    string   `json:"type"`
+	CallID  string   `json:"call_id"`
+	FromTag string   `json:"from_tag"`
+	ToTag   string   `json:"to_tag"`
+	Changed []string `json:"changed"`
+	// Labels are the instance's static labels.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// subscribeLeg subscribes one backend leg of source to tag.
+func (s *Service) subscribeLeg(ctx context.Context, source *Source, leg int, tag string) (*webrtc.PeerConnection, string, error) {
+	return s.subscribeLegs(ctx, source, []int{leg}, func(ctx context.Context) (map[string]interface{}, error) {
+		return s.rtpClient.Subscribe(ctx, source.CallID, tag)
+	})
+}
+
+// subscribeAll subscribes both backend legs of source with one subscription
+// to all media of the call. rtpengine offers the parties in the order they
+// joined the call, the same order detectTags picks the from leg by.
+func (s *Service) subscribeAll(ctx context.Context, source *Source) (*webrtc.PeerConnection, string, error) {
+	return s.subscribeLegs(ctx, source, []int{legFrom, legTo}, func(ctx context.Context) (map[string]interface{}, error) {
+		return s.rtpClient.SubscribeAll(ctx, source.CallID)
+	})
+}
+
+// subscribeLegs subscribes legs of source with the subscription subscribe
+// makes, whose n-th audio section carries legs[n]. Connection state events
+// of a subscription are ignored once it has been replaced.
+func (s *Service) subscribeLegs(ctx context.Context, source *Source, legs []int, subscribe func(context.Context) (map[string]interface{}, error)) (*webrtc.PeerConnection, string, error) {
+	var prevState [2]webrtc.PeerConnectionState
+	var gen [2]uint64
+	source.stateMu.Lock()
+	for _, leg := range legs {
+		prevState[leg] = source.legs[leg]
+		source.legGen[leg]++
+		gen[leg] = source.legGen[leg]
+		source.legs[leg] = webrtc.PeerConnectionStateNew
+	}
+	source.stateMu.Unlock()
+
+	pc, subTag, err := s.setupBackendSubscription(ctx, source.CallID, subscribe, func(t *webrtc.TrackRemote, section int) {
+		if section < 0 || section >= len(legs) {
+			return
+		}
+		s.forwardLeg(source, legs[section], t)
+	}, func(state webrtc.PeerConnectionState) {
+		for _, leg := range legs {
+			s.legStateChanged(source, leg, gen[leg], state)
+		}
+	})
+	if err != nil {
+		// Hand the legs back to the subscriptions that are still in place.
+		source.stateMu.Lock()
+		for _, leg := range legs {
+			source.legGen[leg]--
+			source.legs[leg] = prevState[leg]
+		}
+		source.stateMu.Unlock()
+		return nil, "", err
+	}
+	return pc, subTag, nil
+}
+
+// forwardLeg forwards the audio of one backend leg until its track ends.
+func (s *Service) forwardLeg(source *Source, leg int, t *webrtc.TrackRemote) {
+	stats := &source.StatsFrom
+	if leg == legTo {
+		stats = &source.StatsTo
+	}
+	echo := func(energyDB float64) {
+		if delay, detected := source.echo.observe(leg, time.Now(), energyDB); detected {
+			s.echoDetected(source, delay)
+		}
+	}
+	s.forward(source, t, stats, newMediaTracker(legNames[leg], t), newClassifier(&source.audio[leg], source.talk[leg].frame, echo), leg)
+}
+
+// RefreshSource re-detects the tags of a call and resubscribes the legs that
+// changed, e.g. after a transfer replaced the callee. Attached sessions keep
+// their tracks and are notified of the change.
+func (s *Service) RefreshSource(ctx context.Context, callID string) (*SourceUpdate, error) {
+	s.sourcesMu.RLock()
+	source, ok := s.sources[callID]
+	s.sourcesMu.RUnlock()
+	if !ok {
+		return nil, ErrSourceNotFound
+	}
+
+	fromTag, toTag, err := s.detectTags(ctx, callID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect tags: %w", err)
+	}
+
+	source.refreshMu.Lock()
+	defer source.refreshMu.Unlock()
+
+	update := &SourceUpdate{Type: string(catalog.EventLegsChanged), CallID: callID, FromTag: fromTag, ToTag: toTag, Changed: []string{}, Labels: s.labels()}
+	tags := [...]string{legFrom: fromTag, legTo: toTag}
+	var changed []int
+	source.mu.RLock()
+	current := [...]string{legFrom: source.FromTag, legTo: source.ToTag}
+	source.mu.RUnlock()
+	for leg, tag := range tags {
+		if tag != current[leg] {
+			changed = append(changed, leg)
+		}
+	}
+
+	if source.wholeCall && len(changed) > 0 {
+		// One subscription carries both legs; it is replaced as a whole.
+		if err := s.replaceAll(ctx, source, fromTag, toTag); err != nil {
+			return nil, fmt.Errorf("failed to resubscribe call: %w", err)
+		}
+		for _, leg := range changed {
+			update.Changed = append(update.Changed, legNames[leg])
+		}
+		changed = nil
+	}
+	for _, leg := range changed {
+		if err := s.replaceLeg(ctx, source, leg, tags[leg]); err != nil {
+			return nil, fmt.Errorf("failed to resubscribe %s leg: %w", legNames[leg], err)
+		}
+		update.Changed = append(update.Changed, legNames[leg])
+	}
+
+	if len(update.Changed) > 0 {
+		s.notifySessions(source, update)
+	}
+	return update, nil
+}
+
+// replaceLeg subscribes leg to tag and releases the previous subscription.
+func (s *Service) replaceLeg(ctx context.Context, source *Source, leg int, tag string) error {
+	reason := fmt.Sprintf("%s leg changed to %s", legNames[leg], redact.Tag(tag))
+	s.transition(source, SourceDegraded, reason)
+
+	pc, subTag, err := s.subscribeLeg(ctx, source, leg, tag)
+	if err != nil {
+		s.resubscriptionFailed(source, "resubscription failed, keeping previous leg")
+		return err
+	}
+
+	source.mu.Lock()
+	var oldPC *webrtc.PeerConnection
+	var oldSubTag string
+	if leg == legFrom {
+		oldPC, oldSubTag = source.PCFrom, source.SubTagFrom
+		source.PCFrom, source.SubTagFrom, source.FromTag = pc, subTag, tag
+	} else {
+		oldPC, oldSubTag = source.PCTo, source.SubTagTo
+		source.PCTo, source.SubTagTo, source.ToTag = pc, subTag, tag
+	}
+	source.mu.Unlock()
+
+	go func() {
+		if oldPC != nil {
+			oldPC.Close()
+			s.rtpClient.UnSubscribe(context.Background(), source.CallID, oldSubTag)
+		}
+	}()
+	return nil
+}
+
+// replaceAll resubscribes a source whose legs share one subscription to all
+// media of its call, now with fromTag and toTag, and releases the previous
+// subscription.
+func (s *Service) replaceAll(ctx context.Context, source *Source, fromTag, toTag string) error {
+	s.transition(source, SourceDegraded, "legs changed")
+
+	pc, subTag, err := s.subscribeAll(ctx, source)
+	if err != nil {
+		s.resubscriptionFailed(source, "resubscription failed, keeping previous legs")
+		return err
+	}
+
+	source.mu.Lock()
+	oldPC, oldSubTag := source.PCFrom, source.SubTagFrom
+	source.PCFrom, source.SubTagFrom, source.FromTag = pc, subTag, fromTag
+	source.PCTo, source.SubTagTo, source.ToTag = pc, subTag, toTag
+	source.mu.Unlock()
+
+	go func() {
+		if oldPC != nil {
+			oldPC.Close()
+			s.rtpClient.UnSubscribe(context.Background(), source.CallID, oldSubTag)
+		}
+	}()
+	return nil
+}
+
+// resubscriptionFailed restores the connected state of a source whose
+// previous subscriptions are still up after a failed resubscription.
+func (s *Service) resubscriptionFailed(source *Source, reason string) {
+	source.stateMu.Lock()
+	bothConnected := source.legs[legFrom] == webrtc.PeerConnectionStateConnected &&
+		source.legs[legTo] == webrtc.PeerConnectionStateConnected
+	source.stateMu.Unlock()
+	if bothConnected {
+		s.transition(source, SourceConnected, reason)
+	}
+}
+
+// labels are the static labels events are sent with.
+func (s *Service) labels() map[string]string {
+	if s.cfg == nil {
+		return nil
+	}
+	return s.cfg.Labels
+}
+
+// notifySessions sends msg to every browser attached to source whose events
+// data channel is open.
+func (s *Service) notifySessions(source *Source, msg interface{}) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+	for _, sess := range source.Sessions {
+		if sess.events == nil || sess.events.ReadyState() != webrtc.DataChannelStateOpen {
+			continue
+		}
+		if err := sess.events.SendText(string(body)); err != nil {
+			log.Println("Failed to notify session", sess.ID, ":", err)
+		}
+	}
+}
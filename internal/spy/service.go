@@ -1,13 +1,19 @@
 package spy
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"maps"
 	"net"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pion/logging"
@@ -17,26 +23,48 @@ import (
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
-	"rtpengine-mon/internal/config"
-	"rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/watermark"
 )
 
 // Service provides WebRTC spying capabilities on active RTPEngine calls.
 type Service struct {
-	cfg       *config.Config
-	rtpClient rtpengine.Client
+	cfg              *config.Config
+	rtpClient        rtpengine.Client
 	browserWebrtcAPI *webrtc.API
 	backendWebrtcAPI *webrtc.API
-	tracer    trace.Tracer
-	meter     metric.Meter
-
-	sessionCounter metric.Int64UpDownCounter
+	tracer           trace.Tracer
+	meter            metric.Meter
+	// wholeCall subscribes both legs of every source at once, see
+	// config.SpySubscribeAll. Without it only calls with more than two
+	// parties are.
+	wholeCall bool
+	// watermark marks the audio sent to listeners and exported when set.
+	watermark *watermark.Key
+
+	sessionCounter    metric.Int64UpDownCounter
+	sourceStates      metric.Int64UpDownCounter
+	sourceTransitions metric.Int64Counter
+	echoCounter       metric.Int64Counter
 
 	sourcesMu sync.RWMutex
 	sources   map[string]*Source
 
 	sessionsMu sync.RWMutex
-	sessions   map[string]*Session 
+	sessions   map[string]*Session
+
+	hooks     hooks
+	admission admission
+	budget    subscriptionBudget
+	media     mediaHistories
+	pcmSink   PCMSink
+
+	// stop ends the background loops NewService started.
+	stop context.CancelFunc
+	// releases tracks subscriptions still being released to rtpengine.
+	releases sync.WaitGroup
 }
 
 func NewService(cfg *config.Config, rtpClient rtpengine.Client, tcpListener net.Listener) (*Service, error) {
@@ -53,23 +81,104 @@ func NewService(cfg *config.Config, rtpClient rtpengine.Client, tcpListener net.
 	tracer := otel.Tracer("spy-service")
 	meter := otel.Meter("spy-service")
 	sessCounter, _ := meter.Int64UpDownCounter("spy.sessions_active", metric.WithDescription("Number of active browser spy sessions"))
+	sourceStates, _ := meter.Int64UpDownCounter("spy.sources", metric.WithDescription("Number of backend sources by state"))
+	sourceTransitions, _ := meter.Int64Counter("spy.source_transitions_total", metric.WithDescription("Backend source state transitions"))
+	echoCounter, _ := meter.Int64Counter("spy.echo_detected_total", metric.WithDescription("Calls found with both legs carrying the same audio"))
+
+	s := &Service{
+		cfg:               cfg,
+		rtpClient:         rtpClient,
+		browserWebrtcAPI:  browserWebrtcAPI,
+		backendWebrtcAPI:  backendWebrtcAPI,
+		tracer:            tracer,
+		meter:             meter,
+		sessionCounter:    sessCounter,
+		sourceStates:      sourceStates,
+		sourceTransitions: sourceTransitions,
+		echoCounter:       echoCounter,
+		sources:           make(map[string]*Source),
+		sessions:          make(map[string]*Session),
+		admission: admission{
+			maxPPS:     cfg.AdmissionMaxPPS,
+			maxCPU:     cfg.AdmissionMaxCPU,
+			retryAfter: cfg.AdmissionRetryAfter,
+		},
+		budget: subscriptionBudget{
+			instance:   cfg.RTPEngineAddr,
+			max:        cfg.SubscriptionBudget,
+			queue:      cfg.SubscriptionQueueTimeout,
+			retryAfter: cfg.AdmissionRetryAfter,
+		},
+		media: mediaHistories{retention: cfg.MediaHistoryRetention},
+	}
+	if cfg.WatermarkKey != "" {
+		s.watermark = watermark.NewKey(cfg.WatermarkKey)
+	}
+	if cfg.SpySubscribeAll {
+		s.wholeCall = true
+		s.budget.perSource = 1
+	}
+	s.admission.shed = s.shedLowestPriority
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+	if s.admission.enabled() {
+		go s.admission.run(ctx)
+	}
+	return s, nil
+}
+
+// Close ends every session, releases every source and its rtpengine
+// subscriptions, and stops the background loops NewService started. It
+// waits until rtpengine was told about the released subscriptions or ctx
+// expires, so the client can be closed after it. Loops started with Run*
+// are stopped by cancelling their own contexts.
+func (s *Service) Close(ctx context.Context) error {
+	if s.stop != nil {
+		s.stop()
+	}
+
+	s.sessionsMu.RLock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.sessionsMu.RUnlock()
+	s.sourcesMu.RLock()
+	sources := make([]*Source, 0, len(s.sources))
+	for _, source := range s.sources {
+		sources = append(sources, source)
+	}
+	s.sourcesMu.RUnlock()
 
-	return &Service{
-		cfg:            cfg,
-		rtpClient:      rtpClient,
-		browserWebrtcAPI: browserWebrtcAPI,
-		backendWebrtcAPI: backendWebrtcAPI,
-		tracer:         tracer,
-		meter:          meter,
-		sessionCounter: sessCounter,
-		sources:        make(map[string]*Source),
-		sessions:       make(map[string]*Session),
-	}, nil
+	for _, source := range sources {
+		for _, sess := range sessions {
+			if sess.CallID != source.CallID {
+				continue
+			}
+			if sess.PC != nil {
+				sess.PC.Close()
+			}
+			s.cleanupSession(sess.ID, source)
+		}
+		s.closeSource(source, "service closed")
+	}
+
+	released := make(chan struct{})
+	go func() {
+		s.releases.Wait()
+		close(released)
+	}()
+	select {
+	case <-released:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("releasing subscriptions: %w", ctx.Err())
+	}
 }
 
 func createBrowserWebRTCApi(cfg *config.Config, tcpListener net.Listener) (*webrtc.API, error) {
 	settingEngine := webrtc.SettingEngine{}
-	
+
 	factory := logging.NewDefaultLoggerFactory()
 	factory.DefaultLogLevel = logging.LogLevelError
 	settingEngine.LoggerFactory = factory
@@ -98,7 +207,7 @@ func createBrowserWebRTCApi(cfg *config.Config, tcpListener net.Listener) (*webr
 
 func createBackendWebRTCApi(cfg *config.Config) (*webrtc.API, error) {
 	settingEngine := webrtc.SettingEngine{}
-	
+
 	factory := logging.NewDefaultLoggerFactory()
 	factory.DefaultLogLevel = logging.LogLevelError
 	settingEngine.LoggerFactory = factory
@@ -121,10 +230,14 @@ func createBackendWebRTCApi(cfg *config.Config) (*webrtc.API, error) {
 
 func (s *Service) StartSpySession(ctx context.Context, callID, fromTag, toTag string) (string, string, string, string, error) {
 	ctx, span := s.tracer.Start(ctx, "spy.StartSpySession", trace.WithAttributes(
-		attribute.String("call_id", callID),
+		attribute.String("call_id", redact.CallID(callID)),
 	))
 	defer span.End()
 
+	if err := s.admission.admit(PriorityFromContext(ctx)); err != nil {
+		return "", "", "", "", err
+	}
+
 	// 1. Auto-detect tags if missing
 	if fromTag == "" || toTag == "" {
 		var err error
@@ -134,29 +247,64 @@ func (s *Service) StartSpySession(ctx context.Context, callID, fromTag, toTag st
 		}
 	}
 
-	fmt.Println("Tags for call", callID, ":", fromTag, toTag)
+	log.Println("Tags for call", redact.CallID(callID), ":", redact.Tag(fromTag), redact.Tag(toTag))
 
 	// 2. Get or Create Source (Backend connection to RTPEngine)
+	source, err := s.acquireSource(ctx, callID, fromTag, toTag)
+	if err != nil {
+		return "", "", "", "", err
+	}
+
+	// 3. Create Spy Session (Connection to Frontend)
+	sessionID, offerSDP, err := s.createSession(ctx, source)
+	if err != nil {
+		return "", "", "", "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return sessionID, offerSDP, fromTag, toTag, nil
+}
+
+// acquireSource returns the source of a call, creating it when the call has
+// none. A new source needs room in the subscription budget, which may mean
+// queuing, so it is reserved before the sources lock is taken.
+func (s *Service) acquireSource(ctx context.Context, callID, fromTag, toTag string) (*Source, error) {
+	s.sourcesMu.RLock()
+	_, exists := s.sources[callID]
+	s.sourcesMu.RUnlock()
+	reserved := !exists
+	if reserved {
+		if err := s.budget.acquire(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	s.sourcesMu.Lock()
 	source, ok := s.sources[callID]
+	if ok && reserved {
+		s.budget.release()
+	}
 	if !ok {
+		if !reserved {
+			// The source went away since the check above.
+			if err := s.budget.tryAcquire(1); err != nil {
+				s.sourcesMu.Unlock()
+				return nil, err
+			}
+		}
 		var err error
 		source, err = s.createSource(ctx, callID, fromTag, toTag)
 		if err != nil {
 			s.sourcesMu.Unlock()
-			return "", "", "", "", fmt.Errorf("failed to create source: %w", err)
+			return nil, fmt.Errorf("failed to create source: %w", err)
 		}
 		s.sources[callID] = source
 	}
 	s.sourcesMu.Unlock()
 
-	// 3. Create Spy Session (Connection to Frontend)
-	sessionID, offerSDP, err := s.createSession(ctx, source)
-	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to create session: %w", err)
+	if !ok {
+		s.hooks.fireSource(&s.hooks.sourceCreated, source)
 	}
-
-	return sessionID, offerSDP, fromTag, toTag, nil
+	return source, nil
 }
 
 func (s *Service) HandleSpyAnswer(ctx context.Context, sessionID, sdp string) error {
@@ -180,31 +328,54 @@ func (s *Service) HandleSpyAnswer(ctx context.Context, sessionID, sdp string) er
 	if err != nil {
 		return fmt.Errorf("failed to set remote description: %w", err)
 	}
+	if sess.answerTimer != nil {
+		sess.answerTimer.Stop()
+	}
 
 	return nil
 }
 
+// expireUnanswered closes a session whose browser never posted its answer,
+// e.g. because the user navigated away right after requesting the offer.
+func (s *Service) expireUnanswered(sess *Session, source *Source) {
+	if sess.PC.RemoteDescription() != nil {
+		return
+	}
+	log.Println("Closing unanswered session", sess.ID)
+	sess.PC.Close()
+	s.cleanupSession(sess.ID, source)
+}
+
+// CallTags returns the from and to tags of a call, taken from its source
+// while it is being listened to and detected from rtpengine otherwise.
+func (s *Service) CallTags(ctx context.Context, callID string) (string, string, error) {
+	s.sourcesMu.RLock()
+	source, ok := s.sources[callID]
+	s.sourcesMu.RUnlock()
+	if ok {
+		source.mu.RLock()
+		defer source.mu.RUnlock()
+		return source.FromTag, source.ToTag, nil
+	}
+	return s.detectTags(ctx, callID)
+}
+
 func (s *Service) detectTags(ctx context.Context, callID string) (string, string, error) {
 	details, err := s.rtpClient.QueryCall(ctx, callID)
 	if err != nil {
 		return "", "", err
 	}
 
-	tagsMap, ok := details["tags"].(map[string]interface{})
-	if !ok || len(tagsMap) < 2 {
+	tags := rtpengine.DecodeCallDetails(details).Tags
+	if len(tags) < 2 {
 		return "", "", fmt.Errorf("not enough tags found")
 	}
 
 	var tagInfos []TagInfo
-
-	for t, v := range tagsMap {
+	for t, tag := range tags {
 		var created int64
-		if info, ok := v.(map[string]interface{}); ok {
-			if c, ok := info["created"].(int64); ok {
-				created = c
-			} else if c, ok := info["created"].(float64); ok {
-				created = int64(c)
-			}
+		if !tag.Created.IsZero() {
+			created = tag.Created.Unix()
 		}
 		tagInfos = append(tagInfos, TagInfo{Tag: t, Created: created})
 	}
@@ -220,98 +391,179 @@ func (s *Service) detectTags(ctx context.Context, callID string) (string, string
 	return tagInfos[0].Tag, tagInfos[1].Tag, nil
 }
 
+// ErrLabelNotFound is returned by TagsByLabel for a label no leg of the call
+// carries.
+var ErrLabelNotFound = errors.New("no leg with label")
+
+// TagsByLabel returns the from and to tags of a call by the labels the SIP
+// proxy gave its legs, e.g. "agent" and "customer". An empty label picks the
+// earliest other leg, as detectTags does. When several legs share a label
+// the earliest one is picked.
+func (s *Service) TagsByLabel(ctx context.Context, callID, fromLabel, toLabel string) (string, string, error) {
+	details, err := s.rtpClient.QueryCall(ctx, callID)
+	if err != nil {
+		return "", "", err
+	}
+
+	tags := slices.SortedFunc(maps.Values(rtpengine.DecodeCallDetails(details).Tags), func(a, b rtpengine.Tag) int {
+		return cmp.Or(a.Created.Compare(b.Created), cmp.Compare(a.Tag, b.Tag))
+	})
+	labels := [...]string{legFrom: fromLabel, legTo: toLabel}
+	var picked [2]string
+	pick := func(leg int) bool {
+		for _, t := range tags {
+			if t.Tag != picked[legFrom] && t.Tag != picked[legTo] && (labels[leg] == "" || t.Label == labels[leg]) {
+				picked[leg] = t.Tag
+				return true
+			}
+		}
+		return false
+	}
+	// Labelled legs are picked first so an unlabelled side cannot take them.
+	for _, leg := range []int{legFrom, legTo} {
+		if labels[leg] != "" && !pick(leg) {
+			return "", "", fmt.Errorf("%w %q", ErrLabelNotFound, labels[leg])
+		}
+	}
+	for _, leg := range []int{legFrom, legTo} {
+		if labels[leg] == "" && !pick(leg) {
+			return "", "", fmt.Errorf("not enough tags found")
+		}
+	}
+	return picked[legFrom], picked[legTo], nil
+}
+
+// conference reports whether a call has more than two parties, which only a
+// subscription to all of its media covers with a single NG request.
+func (s *Service) conference(ctx context.Context, callID string) bool {
+	details, err := s.rtpClient.QueryCall(ctx, callID)
+	if err != nil {
+		return false
+	}
+	parties := 0
+	for tag := range rtpengine.DecodeCallDetails(details).Tags {
+		// Our own subscriptions, e.g. the ones Restore re-adopts, are
+		// listed among the tags but are no parties.
+		if !rtpengine.IsSubscriptionTag(tag, s.cfg.InstanceID) {
+			parties++
+		}
+	}
+	return parties > 2
+}
+
+// createSource subscribes to both legs of a call. The caller must have
+// reserved the subscriptions in the budget; releasing the source returns
+// them, also when creation fails.
 func (s *Service) createSource(ctx context.Context, callID, fromTag, toTag string) (*Source, error) {
 	ctx, span := s.tracer.Start(ctx, "spy.createSource")
 	defer span.End()
 
 	source := NewSource(callID, fromTag, toTag)
+	s.sourceStates.Add(ctx, 1, metric.WithAttributes(attribute.String("state", SourceSubscribing.String())))
 
 	var err error
-	// Subscribe to FROM leg (User A)
-	source.PCFrom, source.SubTagFrom, err = s.setupBackendSubscription(ctx, callID, fromTag, func(track *webrtc.TrackRemote) {
-		var sessionTracks []*webrtc.TrackLocalStaticRTP
-		var lastSessionCount int
-		
-		for {
-			select {
-			case <-source.ctx.Done():
-				return
-			default:
-				source.mu.RLock()
-				currentCount := len(source.Sessions)
-				if currentCount != lastSessionCount {
-					sessionTracks = make([]*webrtc.TrackLocalStaticRTP, 0, currentCount)
-					for _, sess := range source.Sessions {
-						sessionTracks = append(sessionTracks, sess.TrackFrom)
-					}
-					lastSessionCount = currentCount
-				}
-				source.mu.RUnlock()
-				
-				rtp, _, readErr := track.ReadRTP()
-				if readErr != nil {
-					return
-				}
-				
-				for _, t := range sessionTracks {
-					if err := t.WriteRTP(rtp); err != nil && err != io.ErrClosedPipe {
-						// log error?
-					}
-				}
-			}
+	if s.wholeCall || s.conference(ctx, callID) {
+		source.wholeCall = true
+		source.PCFrom, source.SubTagFrom, err = s.subscribeAll(ctx, source)
+		if err == nil {
+			source.PCTo, source.SubTagTo = source.PCFrom, source.SubTagFrom
+			return source, nil
 		}
-	}, func() {
-		s.cleanupSource(source)
-	})
+		if s.wholeCall {
+			s.abandonSource(source, "subscription failed")
+			return nil, fmt.Errorf("failed to subscribe to call: %w", err)
+		}
+		// The rtpengine may not accept subscriptions to all media; the
+		// first two parties can still be heard with one per leg.
+		log.Println("Failed to subscribe to all media of call", redact.CallID(callID), ", subscribing per leg:", err)
+		source.wholeCall = false
+	}
+
+	// Subscribe to FROM leg (User A)
+	source.PCFrom, source.SubTagFrom, err = s.subscribeLeg(ctx, source, legFrom, fromTag)
 	if err != nil {
+		s.abandonSource(source, "from leg subscription failed")
 		return nil, fmt.Errorf("failed to subscribe from-leg: %w", err)
 	}
 
 	// Subscribe to TO leg (User B)
-	source.PCTo, source.SubTagTo, err = s.setupBackendSubscription(ctx, callID, toTag, func(track *webrtc.TrackRemote) {
-		var sessionTracks []*webrtc.TrackLocalStaticRTP
-		var lastSessionCount int
-		
-		for {
-			select {
-			case <-source.ctx.Done():
-				return
-			default:
-				source.mu.RLock()
-				currentCount := len(source.Sessions)
-				if currentCount != lastSessionCount {
-					sessionTracks = make([]*webrtc.TrackLocalStaticRTP, 0, currentCount)
-					for _, sess := range source.Sessions {
-						sessionTracks = append(sessionTracks, sess.TrackTo)
+	source.PCTo, source.SubTagTo, err = s.subscribeLeg(ctx, source, legTo, toTag)
+	if err != nil {
+		s.abandonSource(source, "to leg subscription failed")
+		return nil, fmt.Errorf("failed to subscribe to-leg: %w", err)
+	}
+
+	return source, nil
+}
+
+// forward copies RTP from one backend leg to the matching track of every
+// browser session attached to the source.
+func (s *Service) forward(source *Source, track *webrtc.TrackRemote, stats *LegStats, media *mediaTracker, audio *classifier, leg int) {
+	type output struct {
+		track *webrtc.TrackLocalStaticRTP
+		mark  *watermark.Embedder
+	}
+	var outputs []output
+	var lastSessionCount int
+	var seq sequence
+
+	for {
+		select {
+		case <-source.ctx.Done():
+			return
+		default:
+			source.mu.RLock()
+			currentCount := len(source.Sessions)
+			if currentCount != lastSessionCount {
+				outputs = make([]output, 0, currentCount)
+				for _, sess := range source.Sessions {
+					t := sess.TrackFrom
+					if leg == legTo {
+						t = sess.TrackTo
 					}
-					lastSessionCount = currentCount
+					outputs = append(outputs, output{track: t, mark: sess.marks[leg]})
 				}
-				source.mu.RUnlock()
-				
-				rtp, _, readErr := track.ReadRTP()
-				if readErr != nil {
-					return
-				}
-				
-				for _, t := range sessionTracks {
-					if err := t.WriteRTP(rtp); err != nil && err != io.ErrClosedPipe {
-						// log error?
+				lastSessionCount = currentCount
+			}
+			source.mu.RUnlock()
+
+			rtp, _, readErr := track.ReadRTP()
+			if readErr != nil {
+				return
+			}
+			start := time.Now()
+			stats.observe(&seq, rtp.SequenceNumber, len(rtp.Payload))
+			s.media.record(source.CallID, media.observe(start, rtp)...)
+			audio.observe(rtp.PayloadType, rtp.Payload)
+			start = source.usage.add(activityAnalytics, start)
+			if s.pcmSink != nil || source.tapped.Load() {
+				s.exportPCM(source, media.leg, rtp)
+				start = source.usage.add(activityTranscoding, start)
+			}
+
+			var samples []int16
+			for _, out := range outputs {
+				packet := rtp
+				if out.mark != nil {
+					if samples == nil {
+						samples = decodeG711(rtp)
 					}
+					packet = watermarked(rtp, samples, out.mark)
+				}
+				if err := out.track.WriteRTP(packet); err != nil && err != io.ErrClosedPipe {
+					// log error?
 				}
 			}
+			s.admission.forwarded(len(outputs))
+			source.usage.add(activityForwarding, start)
 		}
-	}, func() {
-		s.cleanupSource(source)
-	})
-	if err != nil {
-		s.cleanupSource(source)
-		return nil, fmt.Errorf("failed to subscribe to-leg: %w", err)
 	}
-
-	return source, nil
 }
 
-func (s *Service) setupBackendSubscription(ctx context.Context, callID, tag string, onTrack func(*webrtc.TrackRemote), onClose func()) (*webrtc.PeerConnection, string, error) {
+// setupBackendSubscription answers the offer of a subscription made with
+// subscribe. onTrack receives each audio track with the position of its
+// section among the audio sections of the offer.
+func (s *Service) setupBackendSubscription(ctx context.Context, callID string, subscribe func(context.Context) (map[string]interface{}, error), onTrack func(*webrtc.TrackRemote, int), onState func(webrtc.PeerConnectionState)) (*webrtc.PeerConnection, string, error) {
 	pc, err := s.backendWebrtcAPI.NewPeerConnection(webrtc.Configuration{})
 	if err != nil {
 		return nil, "", err
@@ -319,30 +571,24 @@ func (s *Service) setupBackendSubscription(ctx context.Context, callID, tag stri
 
 	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
 		if track.Kind() == webrtc.RTPCodecTypeAudio {
-			go onTrack(track)
-		}
-	})
-	
-	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
-		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
-			onClose()
+			go onTrack(track, audioSection(pc, receiver))
 		}
 	})
 
-	resp, err := s.rtpClient.Subscribe(ctx, callID, tag)
+	pc.OnConnectionStateChange(onState)
+
+	resp, err := subscribe(ctx)
 	if err != nil {
 		pc.Close()
 		return nil, "", err
 	}
 
-	offerSDP, ok := resp["sdp"].(string)
-	if !ok || offerSDP == "" {
+	offerSDP, subscriptionTag, err := subscriptionOffer(resp)
+	if err != nil {
 		pc.Close()
-		return nil, "", fmt.Errorf("invalid SDP from rtpengine")
+		return nil, "", err
 	}
-	subscriptionTag, _ := resp["to-tag"].(string)
 
-	fmt.Println("offerSDP", offerSDP)
 	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerSDP}); err != nil {
 		pc.Close()
 		return nil, "", err
@@ -359,8 +605,7 @@ func (s *Service) setupBackendSubscription(ctx context.Context, callID, tag stri
 	}
 	<-webrtc.GatheringCompletePromise(pc)
 
-	finalSDP := strings.ReplaceAll(pc.LocalDescription().SDP, "m=audio 0", "m=audio 9")
-	fmt.Println("Answer SDP", finalSDP)
+	finalSDP := subscriptionAnswerSDP(pc.LocalDescription().SDP)
 
 	if _, err := s.rtpClient.SubscribeAnswer(ctx, callID, finalSDP, subscriptionTag); err != nil {
 		pc.Close()
@@ -370,6 +615,39 @@ func (s *Service) setupBackendSubscription(ctx context.Context, callID, tag stri
 	return pc, subscriptionTag, nil
 }
 
+// audioSection returns the position of receiver among the audio transceivers
+// of pc, which follow the order of the offer's sections, or -1.
+func audioSection(pc *webrtc.PeerConnection, receiver *webrtc.RTPReceiver) int {
+	n := 0
+	for _, t := range pc.GetTransceivers() {
+		if t.Kind() != webrtc.RTPCodecTypeAudio {
+			continue
+		}
+		if t.Receiver() == receiver {
+			return n
+		}
+		n++
+	}
+	return -1
+}
+
+// subscriptionOffer extracts the SDP offer and subscription tag from a
+// subscribe request response.
+func subscriptionOffer(resp map[string]interface{}) (string, string, error) {
+	offerSDP, ok := resp["sdp"].(string)
+	if !ok || offerSDP == "" {
+		return "", "", fmt.Errorf("invalid SDP from rtpengine")
+	}
+	subscriptionTag, _ := resp["to-tag"].(string)
+	return offerSDP, subscriptionTag, nil
+}
+
+// subscriptionAnswerSDP rewrites rejected audio sections, which pion answers
+// with port 0, to the discard port so rtpengine does not drop the stream.
+func subscriptionAnswerSDP(answer string) string {
+	return strings.ReplaceAll(answer, "m=audio 0", "m=audio 9")
+}
+
 func (s *Service) createSession(ctx context.Context, source *Source) (string, string, error) {
 	pc, err := s.browserWebrtcAPI.NewPeerConnection(webrtc.Configuration{})
 	if err != nil {
@@ -378,27 +656,41 @@ func (s *Service) createSession(ctx context.Context, source *Source) (string, st
 
 	trackFrom, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU}, "audio_from", "pion")
 	if err != nil {
-		pc.Close(); return "", "", err
+		pc.Close()
+		return "", "", err
 	}
 	trackTo, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU}, "audio_to", "pion")
 	if err != nil {
-		pc.Close(); return "", "", err
+		pc.Close()
+		return "", "", err
 	}
 
 	if _, err = pc.AddTrack(trackFrom); err != nil {
-		pc.Close(); return "", "", err
+		pc.Close()
+		return "", "", err
 	}
 	if _, err = pc.AddTrack(trackTo); err != nil {
-		pc.Close(); return "", "", err
+		pc.Close()
+		return "", "", err
+	}
+	events, err := pc.CreateDataChannel("events", nil)
+	if err != nil {
+		pc.Close()
+		return "", "", err
 	}
 
 	sessionID := uuid.New().String()
 	sess := &Session{
 		ID:        sessionID,
+		CallID:    source.CallID,
+		StartedAt: time.Now(),
+		Priority:  PriorityFromContext(ctx),
 		PC:        pc,
 		TrackFrom: trackFrom,
 		TrackTo:   trackTo,
+		events:    events,
 	}
+	sess.marks = s.sessionWatermarks(sess)
 
 	s.sessionsMu.Lock()
 	s.sessions[sessionID] = sess
@@ -415,6 +707,10 @@ func (s *Service) createSession(ctx context.Context, source *Source) (string, st
 		}
 	})
 
+	if timeout := s.cfg.SpyAnswerTimeout; timeout > 0 {
+		sess.answerTimer = time.AfterFunc(timeout, func() { s.expireUnanswered(sess, source) })
+	}
+
 	offer, err := pc.CreateOffer(nil)
 	if err != nil {
 		return "", "", err
@@ -426,12 +722,15 @@ func (s *Service) createSession(ctx context.Context, source *Source) (string, st
 
 	<-webrtc.GatheringCompletePromise(pc)
 
+	s.hooks.fireSession(&s.hooks.sessionCreated, source, sess)
+
 	return sessionID, pc.LocalDescription().SDP, nil
 }
 
 func (s *Service) cleanupSession(sessionID string, source *Source) {
 	s.sessionsMu.Lock()
-	if _, ok := s.sessions[sessionID]; ok {
+	sess, ok := s.sessions[sessionID]
+	if ok {
 		delete(s.sessions, sessionID)
 		s.sessionCounter.Add(context.Background(), -1)
 	}
@@ -442,28 +741,109 @@ func (s *Service) cleanupSession(sessionID string, source *Source) {
 	// remaining := len(source.Sessions)
 	source.mu.Unlock()
 
+	if ok {
+		s.hooks.fireSession(&s.hooks.sessionClosed, source, sess)
+	}
+
 	// if remaining == 0 {
-	// 	s.cleanupSource(source)
+	// 	s.closeSource(source, "no sessions left")
 	// }
 }
 
-func (s *Service) cleanupSource(source *Source) {
+// Healthy reports whether the service registries can be locked before ctx
+// expires, which catches deadlocks in the session bookkeeping.
+func (s *Service) Healthy(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.sourcesMu.RLock()
+		s.sourcesMu.RUnlock()
+		s.sessionsMu.RLock()
+		s.sessionsMu.RUnlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("spy service unresponsive: %w", ctx.Err())
+	}
+}
+
+// shedLowestPriority closes one of the sessions with the lowest priority.
+// High priority sessions are never shed.
+func (s *Service) shedLowestPriority() {
+	s.sessionsMu.RLock()
+	var victim *Session
+	for _, sess := range s.sessions {
+		if sess.Priority >= PriorityHigh {
+			continue
+		}
+		if victim == nil || sess.Priority < victim.Priority {
+			victim = sess
+		}
+	}
+	s.sessionsMu.RUnlock()
+
+	if victim != nil {
+		log.Println("Shedding", victim.Priority, "priority session", victim.ID)
+		victim.PC.Close()
+	}
+}
+
+// closeSource moves source to the closing state, unregisters it and releases
+// its backend subscriptions.
+func (s *Service) closeSource(source *Source, reason string) {
+	s.transition(source, SourceClosing, reason)
+
 	s.sourcesMu.Lock()
-	if _, ok := s.sources[source.CallID]; ok {
+	registered := s.sources[source.CallID] == source
+	if registered {
 		delete(s.sources, source.CallID)
-		
+	}
+	s.sourcesMu.Unlock()
+
+	s.releaseSource(source)
+
+	if registered {
+		s.hooks.fireSource(&s.hooks.sourceClosed, source)
+	}
+}
+
+// abandonSource tears down a source createSource failed to complete. It was
+// never registered, so unlike closeSource it leaves the sources map, and
+// sourcesMu the callers of createSource hold, alone.
+func (s *Service) abandonSource(source *Source, reason string) {
+	s.transition(source, SourceClosing, reason)
+	s.releaseSource(source)
+}
+
+// releaseSource closes the backend connections of source exactly once.
+func (s *Service) releaseSource(source *Source) {
+	source.releaseOnce.Do(func() {
 		source.cancel()
-		
+		source.closeTaps()
+		s.budget.release()
+		s.media.end(source.CallID, time.Now())
+		s.media.prune(time.Now())
+
+		source.mu.RLock()
+		pcFrom, subTagFrom, pcTo, subTagTo := source.PCFrom, source.SubTagFrom, source.PCTo, source.SubTagTo
+		source.mu.RUnlock()
+
+		s.releases.Add(1)
 		go func() {
-			if source.PCFrom != nil {
-				source.PCFrom.Close()
-				s.rtpClient.UnSubscribe(context.Background(), source.CallID, source.SubTagFrom)
+			defer s.releases.Done()
+			if pcFrom != nil {
+				pcFrom.Close()
+				s.rtpClient.UnSubscribe(context.Background(), source.CallID, subTagFrom)
 			}
-			if source.PCTo != nil {
-				source.PCTo.Close()
-				s.rtpClient.UnSubscribe(context.Background(), source.CallID, source.SubTagTo)
+			// Both legs share one subscription with SpySubscribeAll.
+			if pcTo != nil && pcTo != pcFrom {
+				pcTo.Close()
+				s.rtpClient.UnSubscribe(context.Background(), source.CallID, subTagTo)
 			}
+			s.sourceStates.Add(context.Background(), -1, metric.WithAttributes(attribute.String("state", SourceClosing.String())))
 		}()
-	}
-	s.sourcesMu.Unlock()
+	})
 }
@@ -2,30 +2,100 @@ package spy
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+	"go.opentelemetry.io/otel"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
 )
 
 type mockRTPEngineClient struct {
 	queryResult map[string]interface{}
 	queryErr    error
+	calls       []string
+
+	mu           sync.Mutex
+	unsubscribed []string
 }
 
-func (m *mockRTPEngineClient) ListCalls(ctx context.Context) ([]string, error) { return nil, nil }
+func (m *mockRTPEngineClient) ListCalls(ctx context.Context, opts rtpengine.ListOptions) ([]string, error) {
+	return m.calls, nil
+}
 func (m *mockRTPEngineClient) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
 	return m.queryResult, m.queryErr
 }
 func (m *mockRTPEngineClient) Subscribe(ctx context.Context, callID, tag string) (map[string]interface{}, error) {
 	return nil, nil
 }
+func (m *mockRTPEngineClient) SubscribeAll(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return nil, nil
+}
 func (m *mockRTPEngineClient) SubscribeAnswer(ctx context.Context, callID, sdp, toTag string) (map[string]interface{}, error) {
 	return nil, nil
 }
 func (m *mockRTPEngineClient) UnSubscribe(ctx context.Context, callID, toTag string) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unsubscribed = append(m.unsubscribed, toTag)
 	return nil, nil
 }
 func (m *mockRTPEngineClient) Statistics(ctx context.Context) (map[string]interface{}, error) {
 	return nil, nil
 }
+func (m *mockRTPEngineClient) Ping(ctx context.Context) error { return nil }
+func (m *mockRTPEngineClient) Offer(ctx context.Context, callID, fromTag, sdp string, opts rtpengine.MediaOptions) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) Answer(ctx context.Context, callID, fromTag, toTag, sdp string, opts rtpengine.MediaOptions) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) Delete(ctx context.Context, callID string, opts rtpengine.DeleteOptions) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) BlockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) UnblockMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) SilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) UnsilenceMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) BlockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) UnblockDTMF(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) PlayDTMF(ctx context.Context, callID, fromTag, digits string, opts rtpengine.DTMFOptions) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) PlayMedia(ctx context.Context, callID, fromTag string, opts rtpengine.PlayMediaOptions) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) StopMedia(ctx context.Context, callID, fromTag string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) Publish(ctx context.Context, callID, fromTag, sdp string, opts rtpengine.MediaOptions) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) StartRecording(ctx context.Context, callID, path string) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (m *mockRTPEngineClient) StopRecording(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return nil, nil
+}
 func (m *mockRTPEngineClient) Close() error { return nil }
 
 func TestDetectTags(t *testing.T) {
@@ -88,3 +158,192 @@ func TestDetectTags(t *testing.T) {
 		})
 	}
 }
+
+func TestTagsByLabel(t *testing.T) {
+	s := &Service{rtpClient: &mockRTPEngineClient{queryResult: map[string]interface{}{
+		"tags": map[string]interface{}{
+			"tag-customer": map[string]interface{}{"label": "customer", "created": int64(1000)},
+			"tag-agent":    map[string]interface{}{"label": "agent", "created": int64(2000)},
+			"tag-other":    map[string]interface{}{"created": int64(1500)},
+		},
+	}}}
+	tests := []struct {
+		fromLabel, toLabel string
+		wantFrom, wantTo   string
+		wantErr            error
+	}{
+		{fromLabel: "agent", toLabel: "customer", wantFrom: "tag-agent", wantTo: "tag-customer"},
+		{fromLabel: "agent", wantFrom: "tag-agent", wantTo: "tag-customer"},
+		{toLabel: "customer", wantFrom: "tag-other", wantTo: "tag-customer"},
+		{fromLabel: "supervisor", wantErr: ErrLabelNotFound},
+	}
+	for _, tt := range tests {
+		from, to, err := s.TagsByLabel(context.Background(), "call-id", tt.fromLabel, tt.toLabel)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("TagsByLabel(%q, %q) error = %v, want %v", tt.fromLabel, tt.toLabel, err, tt.wantErr)
+			continue
+		}
+		if from != tt.wantFrom || to != tt.wantTo {
+			t.Errorf("TagsByLabel(%q, %q) = %s, %s; want %s, %s", tt.fromLabel, tt.toLabel, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+}
+
+func TestConference(t *testing.T) {
+	tags := func(n int) map[string]interface{} {
+		m := map[string]interface{}{}
+		for i := range n {
+			m[fmt.Sprintf("tag-%d", i)] = map[string]interface{}{"created": int64(1000 + i)}
+		}
+		return map[string]interface{}{"tags": m}
+	}
+	cfg := config.Default()
+	cfg.InstanceID = "mon-1"
+	withSubscription := func(details map[string]interface{}) map[string]interface{} {
+		tag := rtpengine.SubscriptionTagPrefix(cfg.InstanceID) + uuid.New().String()
+		details["tags"].(map[string]interface{})[tag] = map[string]interface{}{"created": int64(2000)}
+		return details
+	}
+	tests := []struct {
+		name        string
+		queryResult map[string]interface{}
+		queryErr    error
+		want        bool
+	}{
+		{name: "two parties", queryResult: tags(2), want: false},
+		{name: "three parties", queryResult: tags(3), want: true},
+		{name: "query failed", queryErr: errors.New("timeout"), want: false},
+		{name: "two parties and our subscription", queryResult: withSubscription(tags(2)), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{cfg: cfg, rtpClient: &mockRTPEngineClient{queryResult: tt.queryResult, queryErr: tt.queryErr}}
+			if got := s.conference(context.Background(), "call-id"); got != tt.want {
+				t.Errorf("conference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A failed subscription used to close the half-built source under the
+// sources lock its caller held, hanging every later spy request.
+func TestStartSpySessionSubscribeFailure(t *testing.T) {
+	// The mock answers subscribe requests without an SDP.
+	s, err := NewService(config.Default(), &mockRTPEngineClient{}, nil)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	for range 2 {
+		done := make(chan error, 1)
+		go func() {
+			_, _, _, _, err := s.StartSpySession(context.Background(), "call-1", "a", "b")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil || !strings.Contains(err.Error(), "failed to subscribe from-leg") {
+				t.Errorf("StartSpySession() error = %v, want the from-leg subscription failure", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("StartSpySession() deadlocked after a failed subscription")
+		}
+	}
+	if len(s.sources) != 0 {
+		t.Errorf("failed source left registered: %v", s.sources)
+	}
+}
+
+func TestExpireUnanswered(t *testing.T) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("NewPeerConnection() error = %v", err)
+	}
+	counter, _ := otel.Meter("test").Int64UpDownCounter("sessions")
+
+	source := NewSource("call-1", "a", "b")
+	sess := &Session{ID: "s1", CallID: "call-1", PC: pc}
+	source.Sessions["s1"] = sess
+	s := &Service{
+		sources:        map[string]*Source{"call-1": source},
+		sessions:       map[string]*Session{"s1": sess},
+		sessionCounter: counter,
+	}
+
+	s.expireUnanswered(sess, source)
+
+	if _, err := s.session("s1"); err == nil {
+		t.Error("expected unanswered session to be removed")
+	}
+	if len(source.Sessions) != 0 {
+		t.Error("expected session to be detached from its source")
+	}
+	if pc.ConnectionState() != webrtc.PeerConnectionStateClosed {
+		t.Errorf("expected peer connection to be closed, got %s", pc.ConnectionState())
+	}
+}
+
+func TestSubscriptionOffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    map[string]interface{}
+		wantSDP string
+		wantTag string
+		wantErr bool
+	}{
+		{name: "valid", resp: map[string]interface{}{"sdp": "v=0\r\n", "to-tag": "sub-1"}, wantSDP: "v=0\r\n", wantTag: "sub-1"},
+		{name: "missing sdp", resp: map[string]interface{}{"to-tag": "sub-1"}, wantErr: true},
+		{name: "sdp not a string", resp: map[string]interface{}{"sdp": int64(1)}, wantErr: true},
+		{name: "empty sdp", resp: map[string]interface{}{"sdp": ""}, wantErr: true},
+		{name: "tag not a string", resp: map[string]interface{}{"sdp": "v=0\r\n", "to-tag": []interface{}{}}, wantSDP: "v=0\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sdp, tag, err := subscriptionOffer(tt.resp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("subscriptionOffer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if sdp != tt.wantSDP || tag != tt.wantTag {
+				t.Errorf("subscriptionOffer() = %q, %q, want %q, %q", sdp, tag, tt.wantSDP, tt.wantTag)
+			}
+		})
+	}
+}
+
+// testOfferSDP is a subscription offer pion accepts.
+const testOfferSDP = "v=0\r\no=- 1 1 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n" +
+	"m=audio 30000 UDP/TLS/RTP/SAVPF 0\r\nc=IN IP4 127.0.0.1\r\na=mid:0\r\na=rtpmap:0 PCMU/8000\r\n" +
+	"a=ice-ufrag:abcd\r\na=ice-pwd:abcdefghijklmnopqrstuv\r\n" +
+	"a=fingerprint:sha-256 00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF\r\n" +
+	"a=setup:actpass\r\na=sendonly\r\na=rtcp-mux\r\n"
+
+// FuzzSubscriptionSDP drives arbitrary subscription offers through the path
+// setupBackendSubscription takes: pion answers them and the answer is munged.
+func FuzzSubscriptionSDP(f *testing.F) {
+	f.Add(testOfferSDP)
+	f.Add("v=0\r\nm=audio 0 RTP/AVP 0\r\n")
+
+	f.Fuzz(func(t *testing.T, offer string) {
+		offerSDP, _, err := subscriptionOffer(map[string]interface{}{"sdp": offer, "to-tag": "sub"})
+		if err != nil {
+			return
+		}
+
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerSDP}); err != nil {
+			return
+		}
+		answer, err := pc.CreateAnswer(nil)
+		if err != nil {
+			return
+		}
+		if munged := subscriptionAnswerSDP(answer.SDP); strings.Contains(munged, "m=audio 0 ") {
+			t.Errorf("answer still rejects audio: %q", munged)
+		}
+	})
+}
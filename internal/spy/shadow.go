@@ -0,0 +1,198 @@
+package spy
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"log"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// ShadowConfig configures dark-launch subscriptions: a deterministic share of
+// calls is subscribed without any listener to validate the media path and
+// collect quality stats before features are enabled for users.
+type ShadowConfig struct {
+	Percent    float64
+	MaxSources int
+	Interval   time.Duration
+}
+
+// LegQuality is a snapshot of LegStats.
+type LegQuality struct {
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+	Lost    uint64 `json:"lost"`
+}
+
+// ShadowStats reports the media received by a shadow source.
+type ShadowStats struct {
+	CallID string     `json:"call_id"`
+	From   LegQuality `json:"from"`
+	To     LegQuality `json:"to"`
+}
+
+// ShadowSelected reports whether callID falls into the sampled percentage.
+// Selection is stable across replicas and restarts.
+func ShadowSelected(callID string, percent float64) bool {
+	return float64(crc32.ChecksumIEEE([]byte(callID))%10000) < percent*100
+}
+
+// RunShadow maintains shadow subscriptions until ctx is cancelled, then
+// releases those nobody listens to, so the replica taking over shadowing
+// does not subscribe the same calls twice. New shadow sources are only
+// created while below MaxSources and while low priority sessions would
+// still be admitted.
+func (s *Service) RunShadow(ctx context.Context, cfg ShadowConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.shadowTick(ctx, cfg)
+		select {
+		case <-ctx.Done():
+			s.releaseShadows("shadowing stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseShadows closes the shadow sources without sessions.
+func (s *Service) releaseShadows(reason string) {
+	s.sourcesMu.RLock()
+	var idle []*Source
+	for _, source := range s.sources {
+		if !source.Shadow {
+			continue
+		}
+		source.mu.RLock()
+		if len(source.Sessions) == 0 {
+			idle = append(idle, source)
+		}
+		source.mu.RUnlock()
+	}
+	s.sourcesMu.RUnlock()
+
+	for _, source := range idle {
+		s.closeSource(source, reason)
+	}
+}
+
+func (s *Service) shadowTick(ctx context.Context, cfg ShadowConfig) {
+	calls, err := s.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+	if err != nil {
+		log.Println("Shadow: failed to list calls:", err)
+		return
+	}
+	active := make(map[string]bool, len(calls))
+	for _, callID := range calls {
+		active[callID] = true
+	}
+
+	// Release shadow sources of ended calls nobody listens to.
+	shadowed := 0
+	s.sourcesMu.RLock()
+	var ended []*Source
+	for callID, source := range s.sources {
+		if !source.Shadow {
+			continue
+		}
+		source.mu.RLock()
+		idle := len(source.Sessions) == 0
+		source.mu.RUnlock()
+		if !active[callID] && idle {
+			ended = append(ended, source)
+			continue
+		}
+		shadowed++
+	}
+	s.sourcesMu.RUnlock()
+	for _, source := range ended {
+		s.closeSource(source, "shadowed call ended")
+	}
+
+	for _, callID := range calls {
+		if shadowed >= cfg.MaxSources {
+			return
+		}
+		if !ShadowSelected(callID, cfg.Percent) {
+			continue
+		}
+		if err := s.admission.admit(PriorityLow); err != nil {
+			return
+		}
+
+		s.sourcesMu.RLock()
+		_, exists := s.sources[callID]
+		s.sourcesMu.RUnlock()
+		if exists {
+			continue
+		}
+
+		if err := s.startShadow(ctx, callID); err != nil {
+			var saturated *SaturatedError
+			if errors.As(err, &saturated) {
+				return
+			}
+			log.Println("Shadow: failed to subscribe call", redact.CallID(callID), ":", err)
+			continue
+		}
+		shadowed++
+	}
+}
+
+func (s *Service) startShadow(ctx context.Context, callID string) error {
+	ctx = rtpengine.WithLabel(ctx, rtpengine.Label{Purpose: rtpengine.PurposeShadow})
+	fromTag, toTag, err := s.detectTags(ctx, callID)
+	if err != nil {
+		return err
+	}
+
+	s.sourcesMu.Lock()
+	if _, exists := s.sources[callID]; exists {
+		s.sourcesMu.Unlock()
+		return nil
+	}
+	// Shadows leave the top of the budget to listeners.
+	if err := s.budget.tryAcquire(lowPriorityHeadroom); err != nil {
+		s.sourcesMu.Unlock()
+		return err
+	}
+	source, err := s.createSource(ctx, callID, fromTag, toTag)
+	if err != nil {
+		s.sourcesMu.Unlock()
+		return err
+	}
+	source.Shadow = true
+	s.sources[callID] = source
+	s.sourcesMu.Unlock()
+
+	s.hooks.fireSource(&s.hooks.sourceCreated, source)
+	return nil
+}
+
+// ShadowStats returns quality stats of every shadow source.
+func (s *Service) ShadowStats() []ShadowStats {
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+
+	stats := []ShadowStats{}
+	for _, source := range s.sources {
+		if !source.Shadow {
+			continue
+		}
+		stats = append(stats, ShadowStats{
+			CallID: redact.CallID(source.CallID),
+			From:   source.StatsFrom.quality(),
+			To:     source.StatsTo.quality(),
+		})
+	}
+	return stats
+}
+
+func (l *LegStats) quality() LegQuality {
+	return LegQuality{Packets: l.Packets.Load(), Bytes: l.Bytes.Load(), Lost: l.Lost.Load()}
+}
@@ -0,0 +1,21 @@
+package spy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunShadowReleasesOnStop(t *testing.T) {
+	s := hookedService(t)
+	shadow := restoreCall(s)
+	shadow.Shadow = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.RunShadow(ctx, ShadowConfig{Percent: 0, Interval: time.Hour})
+
+	if len(s.Snapshot().Sources) != 0 {
+		t.Error("idle shadow source kept after shadowing stopped")
+	}
+}
@@ -0,0 +1,190 @@
+package spy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/redact"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+// Snapshot is the persisted source registry used for warm restarts.
+type Snapshot struct {
+	Sources []SourceSnapshot `json:"sources"`
+}
+
+// SourceSnapshot records the rtpengine subscriptions held for a call.
+type SourceSnapshot struct {
+	CallID     string `json:"call_id"`
+	FromTag    string `json:"from_tag"`
+	ToTag      string `json:"to_tag"`
+	SubTagFrom string `json:"sub_tag_from"`
+	SubTagTo   string `json:"sub_tag_to"`
+}
+
+// Snapshot captures the current source registry.
+func (s *Service) Snapshot() Snapshot {
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+
+	snap := Snapshot{Sources: make([]SourceSnapshot, 0, len(s.sources))}
+	for _, source := range s.sources {
+		source.mu.RLock()
+		snap.Sources = append(snap.Sources, SourceSnapshot{
+			CallID:     source.CallID,
+			FromTag:    source.FromTag,
+			ToTag:      source.ToTag,
+			SubTagFrom: source.SubTagFrom,
+			SubTagTo:   source.SubTagTo,
+		})
+		source.mu.RUnlock()
+	}
+	return snap
+}
+
+// Restore re-adopts the calls of a snapshot taken by a previous process.
+// The media of the old subscriptions went to that process, so they are
+// renegotiated towards this one; those rtpengine still holds keep their tags
+// and are updated in place rather than released and replaced, so the call is
+// never left without them. Listeners rejoin the re-created sources without
+// waiting for a new subscription round trip. Calls that ended in the
+// meantime are skipped.
+func (s *Service) Restore(ctx context.Context, snap Snapshot) {
+	ctx = rtpengine.WithLabel(ctx, rtpengine.Label{Purpose: rtpengine.PurposeRestore})
+	for _, old := range snap.Sources {
+		if ctx.Err() != nil {
+			log.Println("Restore interrupted:", ctx.Err())
+			return
+		}
+		reuse, err := s.liveSubscriptions(ctx, old)
+		if err != nil {
+			log.Println("Skipping restore of call", redact.CallID(old.CallID), ":", err)
+			continue
+		}
+
+		s.sourcesMu.Lock()
+		_, exists := s.sources[old.CallID]
+		s.sourcesMu.Unlock()
+		if exists {
+			s.releaseStale(ctx, old.CallID, reuse, nil)
+			continue
+		}
+
+		if err := s.budget.tryAcquire(1); err != nil {
+			log.Println("Skipping restore of call", redact.CallID(old.CallID), ":", err)
+			s.releaseStale(ctx, old.CallID, reuse, nil)
+			continue
+		}
+		source, err := s.createSource(rtpengine.WithReusedSubscriptions(ctx, reuse), old.CallID, old.FromTag, old.ToTag)
+		if err != nil {
+			log.Println("Skipping restore of call", redact.CallID(old.CallID), ":", err)
+			s.releaseStale(ctx, old.CallID, reuse, nil)
+			continue
+		}
+		// The source may subscribe differently than before, e.g. per leg
+		// where rtpengine no longer accepts a subscription to all media.
+		s.releaseStale(ctx, old.CallID, reuse, source)
+
+		// A spy request may have created the call's source meanwhile; it
+		// stays and this one, never registered, is torn down.
+		s.sourcesMu.Lock()
+		_, exists = s.sources[old.CallID]
+		if !exists {
+			s.sources[old.CallID] = source
+		}
+		s.sourcesMu.Unlock()
+		if exists {
+			s.abandonSource(source, "created concurrently")
+			continue
+		}
+		s.hooks.fireSource(&s.hooks.sourceCreated, source)
+	}
+}
+
+// liveSubscriptions queries the call of old and returns its subscriptions
+// rtpengine still holds, keyed like rtpengine.WithReusedSubscriptions.
+func (s *Service) liveSubscriptions(ctx context.Context, old SourceSnapshot) (map[string]string, error) {
+	details, err := s.rtpClient.QueryCall(ctx, old.CallID)
+	if err != nil {
+		return nil, err
+	}
+	tags, _ := details["tags"].(map[string]interface{})
+	live := func(tag string) bool {
+		_, ok := tags[tag]
+		return tag != "" && ok
+	}
+
+	reuse := make(map[string]string)
+	if old.SubTagFrom == old.SubTagTo {
+		// Both legs share one subscription with SpySubscribeAll.
+		if live(old.SubTagFrom) {
+			reuse[""] = old.SubTagFrom
+		}
+		return reuse, nil
+	}
+	if live(old.SubTagFrom) {
+		reuse[old.FromTag] = old.SubTagFrom
+	}
+	if live(old.SubTagTo) {
+		reuse[old.ToTag] = old.SubTagTo
+	}
+	return reuse, nil
+}
+
+// releaseStale unsubscribes the live subscriptions of a call that source,
+// if any, did not take over.
+func (s *Service) releaseStale(ctx context.Context, callID string, reuse map[string]string, source *Source) {
+	for _, tag := range reuse {
+		if source != nil && (tag == source.SubTagFrom || tag == source.SubTagTo) {
+			continue
+		}
+		if _, err := s.rtpClient.UnSubscribe(ctx, callID, tag); err != nil {
+			log.Println("Failed to release stale subscription", redact.Tag(tag), "for call", redact.CallID(callID), ":", err)
+		}
+	}
+}
+
+// SaveSnapshot atomically writes the current source registry to path.
+func (s *Service) SaveSnapshot(path string) error {
+	data, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot. A missing file
+// yields an empty snapshot.
+func LoadSnapshot(path string) (Snapshot, error) {
+	var snap Snapshot
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	return snap, nil
+}
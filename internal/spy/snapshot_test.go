@@ -0,0 +1,167 @@
+package spy
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	source := NewSource("call-1", "from", "to")
+	source.SubTagFrom, source.SubTagTo = "sub-from", "sub-to"
+	s := &Service{sources: map[string]*Source{"call-1": source}}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := s.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	want := SourceSnapshot{CallID: "call-1", FromTag: "from", ToTag: "to", SubTagFrom: "sub-from", SubTagTo: "sub-to"}
+	if len(snap.Sources) != 1 || snap.Sources[0] != want {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestLoadSnapshotMissingFile(t *testing.T) {
+	snap, err := LoadSnapshot(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(snap.Sources) != 0 {
+		t.Errorf("expected empty snapshot, got %+v, err = %v", snap, err)
+	}
+}
+
+// restoreRaceClient offers a subscription for every leg and runs
+// onSubscribe, standing in for a spy request, while Restore subscribes.
+type restoreRaceClient struct {
+	mockRTPEngineClient
+	onSubscribe func()
+}
+
+func (c *restoreRaceClient) Subscribe(ctx context.Context, callID, tag string) (map[string]interface{}, error) {
+	if c.onSubscribe != nil {
+		c.onSubscribe()
+		c.onSubscribe = nil
+	}
+	return map[string]interface{}{"sdp": testOfferSDP, "to-tag": "restored-" + tag}, nil
+}
+
+func TestRestoreKeepsConcurrentSource(t *testing.T) {
+	client := &restoreRaceClient{}
+	s, err := NewService(config.Default(), client, nil)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	rival := NewSource("call-1", "a", "b")
+	client.onSubscribe = func() {
+		s.sourcesMu.Lock()
+		s.sources["call-1"] = rival
+		s.sourcesMu.Unlock()
+	}
+
+	s.Restore(context.Background(), Snapshot{Sources: []SourceSnapshot{{CallID: "call-1", FromTag: "a", ToTag: "b"}}})
+
+	s.sourcesMu.RLock()
+	got := s.sources["call-1"]
+	s.sourcesMu.RUnlock()
+	if got != rival {
+		t.Fatal("Restore replaced the source created while it subscribed")
+	}
+
+	// The duplicate's subscriptions are released in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client.mu.Lock()
+		released := slices.Contains(client.unsubscribed, "restored-a") && slices.Contains(client.unsubscribed, "restored-b")
+		client.mu.Unlock()
+		if released {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("duplicate subscriptions not released: %v", client.unsubscribed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Subscriptions rtpengine still holds are re-adopted under their tags; only
+// the ones that went away are replaced.
+func TestRestoreReadoptsLiveSubscriptions(t *testing.T) {
+	engine, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	engine.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "a"}, {Tag: "b"}}})
+
+	cfg := config.Default()
+	cfg.InstanceID = "mon-1"
+	client, err := rtpengine.NewClient(engine.Addr(), rtpengine.WithSubscriptionTags(cfg.InstanceID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	// The previous process held a subscription per leg; the one of the to
+	// leg has since been released.
+	var subTags []string
+	for _, tag := range []string{"a", "b"} {
+		resp, err := client.Subscribe(ctx, "call-1", tag)
+		if err != nil {
+			t.Fatalf("Subscribe(%s) error = %v", tag, err)
+		}
+		subTags = append(subTags, resp["to-tag"].(string))
+	}
+	if _, err := client.UnSubscribe(ctx, "call-1", subTags[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewService(cfg, client, nil)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer s.Close(ctx)
+	s.Restore(ctx, Snapshot{Sources: []SourceSnapshot{{CallID: "call-1", FromTag: "a", ToTag: "b", SubTagFrom: subTags[0], SubTagTo: subTags[1]}}})
+
+	s.sourcesMu.RLock()
+	source := s.sources["call-1"]
+	s.sourcesMu.RUnlock()
+	if source == nil {
+		t.Fatal("call not restored")
+	}
+	if source.SubTagFrom != subTags[0] || source.SubTagTo == subTags[1] {
+		t.Errorf("restored tags %s, %s; want %s kept and %s replaced", source.SubTagFrom, source.SubTagTo, subTags[0], subTags[1])
+	}
+	if got, want := engine.Subscriptions("call-1"), []string{source.SubTagFrom, source.SubTagTo}; !slices.Equal(got, slices.Sorted(slices.Values(want))) {
+		t.Errorf("subscriptions = %v, want %v", got, want)
+	}
+	for _, req := range engine.Requests() {
+		if req.Command == "unsubscribe" && req.Args["to-tag"] == subTags[0] {
+			t.Errorf("live subscription %s released", subTags[0])
+		}
+	}
+}
+
+func TestRestoreStopsAtDeadline(t *testing.T) {
+	client := &restoreRaceClient{}
+	s, err := NewService(config.Default(), client, nil)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s.Restore(ctx, Snapshot{Sources: []SourceSnapshot{{CallID: "call-1", FromTag: "a", ToTag: "b"}}})
+	if len(s.Snapshot().Sources) != 0 {
+		t.Error("Restore went on after its context ended")
+	}
+}
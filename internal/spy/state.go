@@ -0,0 +1,188 @@
+package spy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// SourceState is the lifecycle state of a backend source.
+type SourceState int
+
+const (
+	// SourceSubscribing waits for both backend legs to connect.
+	SourceSubscribing SourceState = iota
+	// SourceConnected receives media on both legs.
+	SourceConnected
+	// SourceDegraded lost connectivity on at least one leg and may recover.
+	SourceDegraded
+	// SourceClosing is being torn down and never leaves this state.
+	SourceClosing
+)
+
+func (st SourceState) String() string {
+	switch st {
+	case SourceSubscribing:
+		return "subscribing"
+	case SourceConnected:
+		return "connected"
+	case SourceDegraded:
+		return "degraded"
+	case SourceClosing:
+		return "closing"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the state by name.
+func (st SourceState) MarshalText() ([]byte, error) {
+	return []byte(st.String()), nil
+}
+
+// sourceTransitions lists the states reachable from each state.
+var sourceTransitions = map[SourceState][]SourceState{
+	SourceSubscribing: {SourceConnected, SourceDegraded, SourceClosing},
+	SourceConnected:   {SourceDegraded, SourceClosing},
+	SourceDegraded:    {SourceConnected, SourceClosing},
+	SourceClosing:     nil,
+}
+
+// Backend legs of a source, indexing Source.legs.
+const (
+	legFrom = iota
+	legTo
+)
+
+var legNames = [...]string{legFrom: "from", legTo: "to"}
+
+// SourceStatus is a snapshot of a source's state machine.
+type SourceStatus struct {
+	CallID   string      `json:"call_id"`
+	State    SourceState `json:"state"`
+	Reason   string      `json:"reason"`
+	Since    time.Time   `json:"since"`
+	Sessions int         `json:"sessions"`
+	Shadow   bool        `json:"shadow"`
+}
+
+// State returns the current state, the reason of the last transition and
+// when it happened.
+func (src *Source) State() (SourceState, string, time.Time) {
+	src.stateMu.Lock()
+	defer src.stateMu.Unlock()
+	return src.state, src.stateReason, src.stateSince
+}
+
+// transition moves source to state to. Transitions not allowed from the
+// current state are ignored and reported as false.
+func (s *Service) transition(source *Source, to SourceState, reason string) bool {
+	source.stateMu.Lock()
+	from := source.state
+	allowed := false
+	for _, next := range sourceTransitions[from] {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if allowed {
+		source.state, source.stateReason, source.stateSince = to, reason, time.Now()
+	}
+	source.stateMu.Unlock()
+
+	if !allowed {
+		return false
+	}
+	ctx := context.Background()
+	s.sourceStates.Add(ctx, -1, metric.WithAttributes(attribute.String("state", from.String())))
+	s.sourceStates.Add(ctx, 1, metric.WithAttributes(attribute.String("state", to.String())))
+	s.sourceTransitions.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("from", from.String()),
+		attribute.String("to", to.String()),
+	))
+	return true
+}
+
+// legStateChanged drives the source state machine from the connection state
+// of one backend leg.
+func (s *Service) legStateChanged(source *Source, leg int, gen uint64, state webrtc.PeerConnectionState) {
+	source.stateMu.Lock()
+	if gen != source.legGen[leg] {
+		source.stateMu.Unlock()
+		return
+	}
+	source.legs[leg] = state
+	bothConnected := source.legs[legFrom] == webrtc.PeerConnectionStateConnected &&
+		source.legs[legTo] == webrtc.PeerConnectionStateConnected
+	source.stateMu.Unlock()
+
+	switch state {
+	case webrtc.PeerConnectionStateConnected:
+		if bothConnected {
+			s.transition(source, SourceConnected, "both legs connected")
+		}
+	case webrtc.PeerConnectionStateDisconnected:
+		s.transition(source, SourceDegraded, fmt.Sprintf("%s leg disconnected", legNames[leg]))
+	case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+		s.closeSource(source, fmt.Sprintf("%s leg %s", legNames[leg], state))
+	}
+}
+
+// Sources returns the state of every source.
+func (s *Service) Sources() []SourceStatus {
+	s.sourcesMu.RLock()
+	defer s.sourcesMu.RUnlock()
+
+	list := make([]SourceStatus, 0, len(s.sources))
+	for _, source := range s.sources {
+		state, reason, since := source.State()
+		source.mu.RLock()
+		sessions := len(source.Sessions)
+		source.mu.RUnlock()
+		list = append(list, SourceStatus{
+			CallID:   source.CallID,
+			State:    state,
+			Reason:   reason,
+			Since:    since,
+			Sessions: sessions,
+			Shadow:   source.Shadow,
+		})
+	}
+	return list
+}
+
+// Subscription describes one backend leg subscription of a source.
+type Subscription struct {
+	Leg      string     `json:"leg"`
+	Tag      string     `json:"tag"`
+	SubTag   string     `json:"sub_tag"`
+	State    string     `json:"state"`
+	Sessions int        `json:"sessions"`
+	Received LegQuality `json:"received"`
+}
+
+// Subscriptions returns the backend subscriptions held for callID, or nil
+// when the call is not subscribed.
+func (s *Service) Subscriptions(callID string) []Subscription {
+	s.sourcesMu.RLock()
+	source, ok := s.sources[callID]
+	s.sourcesMu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	source.stateMu.Lock()
+	legs := source.legs
+	source.stateMu.Unlock()
+
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+	return []Subscription{
+		{Leg: legNames[legFrom], Tag: source.FromTag, SubTag: source.SubTagFrom, State: legs[legFrom].String(), Sessions: len(source.Sessions), Received: source.StatsFrom.quality()},
+		{Leg: legNames[legTo], Tag: source.ToTag, SubTag: source.SubTagTo, State: legs[legTo].String(), Sessions: len(source.Sessions), Received: source.StatsTo.quality()},
+	}
+}
@@ -0,0 +1,86 @@
+package spy
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+	"go.opentelemetry.io/otel"
+)
+
+func newStateTestService() *Service {
+	meter := otel.Meter("test")
+	states, _ := meter.Int64UpDownCounter("sources")
+	transitions, _ := meter.Int64Counter("transitions")
+	return &Service{
+		rtpClient:         &mockRTPEngineClient{},
+		sources:           make(map[string]*Source),
+		sourceStates:      states,
+		sourceTransitions: transitions,
+	}
+}
+
+func TestSourceStateMachine(t *testing.T) {
+	s := newStateTestService()
+	source := NewSource("call-1", "a", "b")
+	s.sources["call-1"] = source
+
+	steps := []struct {
+		leg        int
+		state      webrtc.PeerConnectionState
+		wantState  SourceState
+		wantReason string
+	}{
+		{leg: legFrom, state: webrtc.PeerConnectionStateConnected, wantState: SourceSubscribing, wantReason: "subscribing"},
+		{leg: legTo, state: webrtc.PeerConnectionStateConnected, wantState: SourceConnected, wantReason: "both legs connected"},
+		{leg: legTo, state: webrtc.PeerConnectionStateDisconnected, wantState: SourceDegraded, wantReason: "to leg disconnected"},
+		{leg: legTo, state: webrtc.PeerConnectionStateConnected, wantState: SourceConnected, wantReason: "both legs connected"},
+		{leg: legFrom, state: webrtc.PeerConnectionStateFailed, wantState: SourceClosing, wantReason: "from leg failed"},
+		{leg: legTo, state: webrtc.PeerConnectionStateConnected, wantState: SourceClosing, wantReason: "from leg failed"},
+	}
+	for i, step := range steps {
+		s.legStateChanged(source, step.leg, 0, step.state)
+		state, reason, _ := source.State()
+		if state != step.wantState || reason != step.wantReason {
+			t.Errorf("step %d: state = %s (%s), want %s (%s)", i, state, reason, step.wantState, step.wantReason)
+		}
+	}
+
+	if _, ok := s.sources["call-1"]; ok {
+		t.Error("expected closed source to be unregistered")
+	}
+}
+
+func TestSourceTransitionRules(t *testing.T) {
+	s := newStateTestService()
+	source := NewSource("call-1", "a", "b")
+
+	if !s.transition(source, SourceDegraded, "lost leg") {
+		t.Error("subscribing -> degraded should be allowed")
+	}
+	if s.transition(source, SourceSubscribing, "retry") {
+		t.Error("degraded -> subscribing should be rejected")
+	}
+	if !s.transition(source, SourceClosing, "done") || s.transition(source, SourceConnected, "late") {
+		t.Error("closing must be terminal")
+	}
+}
+
+func TestReplacedLegEventsIgnored(t *testing.T) {
+	s := newStateTestService()
+	source := NewSource("call-1", "a", "b")
+	s.sources["call-1"] = source
+
+	s.legStateChanged(source, legFrom, 0, webrtc.PeerConnectionStateConnected)
+	s.legStateChanged(source, legTo, 0, webrtc.PeerConnectionStateConnected)
+
+	// The to leg was resubscribed; closing the old subscription must not
+	// tear the source down.
+	source.legGen[legTo]++
+	s.legStateChanged(source, legTo, 0, webrtc.PeerConnectionStateClosed)
+	if state, _, _ := source.State(); state != SourceConnected {
+		t.Errorf("state = %s after stale leg event, want connected", state)
+	}
+	if _, ok := s.sources["call-1"]; !ok {
+		t.Error("source unregistered by a stale leg event")
+	}
+}
@@ -0,0 +1,78 @@
+package spy
+
+import "sync/atomic"
+
+// talkHangover is how many frames (200ms) after speech still count as talk,
+// so the pauses between syllables and words are not scored as silence.
+const talkHangover = 10
+
+// talkMeter accumulates the talk and silence time of one leg, in frames, from
+// the energy of the frames its classifier analyses. It survives
+// resubscriptions of the leg.
+type talkMeter struct {
+	talk    atomic.Uint64
+	silence atomic.Uint64
+	// hangover is only touched by the forwarding goroutine of the leg.
+	hangover int
+}
+
+func (m *talkMeter) frame(energyDB float64) {
+	if energyDB >= activeThresholdDB {
+		m.hangover = talkHangover
+	}
+	if m.hangover > 0 {
+		m.hangover--
+		m.talk.Add(1)
+		return
+	}
+	m.silence.Add(1)
+}
+
+// LegTalk is the talk time of one leg. TalkRatio is the leg's share of the
+// talk time of the whole call, the agent talk ratio QA teams track.
+type LegTalk struct {
+	TalkMs    int64   `json:"talk_ms"`
+	SilenceMs int64   `json:"silence_ms"`
+	TalkRatio float64 `json:"talk_ratio"`
+}
+
+// CallTalk is the talk time of both legs of a call while it was subscribed.
+// Only G.711 legs are measured.
+type CallTalk struct {
+	From LegTalk `json:"from"`
+	To   LegTalk `json:"to"`
+}
+
+// NewCallTalk builds the talk time of a call from the milliseconds of talk
+// and silence measured on each leg.
+func NewCallTalk(fromTalk, fromSilence, toTalk, toSilence int64) CallTalk {
+	talk := CallTalk{
+		From: LegTalk{TalkMs: fromTalk, SilenceMs: fromSilence},
+		To:   LegTalk{TalkMs: toTalk, SilenceMs: toSilence},
+	}
+	if total := fromTalk + toTalk; total > 0 {
+		talk.From.TalkRatio = float64(fromTalk) / float64(total)
+		talk.To.TalkRatio = float64(toTalk) / float64(total)
+	}
+	return talk
+}
+
+// Talk returns the talk time measured on the source so far.
+func (src *Source) Talk() CallTalk {
+	ms := func(frames uint64) int64 { return int64(frames) * classifierFrame / 8 }
+	return NewCallTalk(
+		ms(src.talk[legFrom].talk.Load()), ms(src.talk[legFrom].silence.Load()),
+		ms(src.talk[legTo].talk.Load()), ms(src.talk[legTo].silence.Load()),
+	)
+}
+
+// TalkTime returns the talk time of a subscribed call.
+func (s *Service) TalkTime(callID string) (CallTalk, bool) {
+	s.sourcesMu.RLock()
+	source, ok := s.sources[callID]
+	s.sourcesMu.RUnlock()
+	if !ok {
+		return CallTalk{}, false
+	}
+	return source.Talk(), true
+}
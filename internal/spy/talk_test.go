@@ -0,0 +1,38 @@
+package spy
+
+import "testing"
+
+func TestTalkMeter(t *testing.T) {
+	var m talkMeter
+	// One frame of speech is followed by the hangover, then silence.
+	m.frame(-20)
+	for i := 0; i < 20; i++ {
+		m.frame(-90)
+	}
+	if talk, silence := m.talk.Load(), m.silence.Load(); talk != talkHangover || silence != 21-talkHangover {
+		t.Errorf("talk, silence = %d, %d frames, want %d, %d", talk, silence, talkHangover, 21-talkHangover)
+	}
+
+	// Short pauses within speech count as talk.
+	m = talkMeter{}
+	for i := 0; i < 50; i++ {
+		energy := -20.0
+		if i%5 == 4 {
+			energy = -90
+		}
+		m.frame(energy)
+	}
+	if talk := m.talk.Load(); talk != 50 {
+		t.Errorf("talk = %d frames, want 50", talk)
+	}
+}
+
+func TestNewCallTalk(t *testing.T) {
+	talk := NewCallTalk(3000, 1000, 1000, 3000)
+	if talk.From.TalkRatio != 0.75 || talk.To.TalkRatio != 0.25 {
+		t.Errorf("ratios = %v, %v, want 0.75, 0.25", talk.From.TalkRatio, talk.To.TalkRatio)
+	}
+	if silent := NewCallTalk(0, 1000, 0, 1000); silent.From.TalkRatio != 0 || silent.To.TalkRatio != 0 {
+		t.Errorf("silent call ratios = %v, %v, want 0", silent.From.TalkRatio, silent.To.TalkRatio)
+	}
+}
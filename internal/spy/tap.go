@@ -0,0 +1,89 @@
+package spy
+
+import (
+	"context"
+	"fmt"
+)
+
+// tapBuffer is how many frames a tap may lag behind before frames are
+// dropped, a little over a second of both legs.
+const tapBuffer = 128
+
+// Tap subscribes to a call like a spy session and returns the decoded audio
+// of both legs, for consumers such as bots that cannot speak WebRTC. Frames
+// are dropped while the consumer lags. The channel is closed when stop is
+// called or the source closes.
+func (s *Service) Tap(ctx context.Context, callID string) (<-chan PCMFrame, func(), error) {
+	if err := s.admission.admit(PriorityFromContext(ctx)); err != nil {
+		return nil, nil, err
+	}
+	fromTag, toTag, err := s.detectTags(ctx, callID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to detect tags: %w", err)
+	}
+	source, err := s.acquireSource(ctx, callID, fromTag, toTag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan PCMFrame, tapBuffer)
+	source.mu.Lock()
+	if source.ctx.Err() != nil {
+		source.mu.Unlock()
+		return nil, nil, fmt.Errorf("source of call closed")
+	}
+	if source.taps == nil {
+		source.taps = make(map[chan PCMFrame]struct{})
+	}
+	source.taps[ch] = struct{}{}
+	source.tapped.Store(true)
+	source.mu.Unlock()
+
+	return ch, func() { source.removeTap(ch) }, nil
+}
+
+func (source *Source) fanOut(frame PCMFrame) {
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+	for ch := range source.taps {
+		select {
+		case ch <- frame:
+		default:
+		}
+	}
+}
+
+func (source *Source) removeTap(ch chan PCMFrame) {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if _, ok := source.taps[ch]; ok {
+		delete(source.taps, ch)
+		close(ch)
+	}
+	source.tapped.Store(len(source.taps) > 0)
+}
+
+func (source *Source) closeTaps() {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	for ch := range source.taps {
+		close(ch)
+	}
+	source.taps = nil
+	source.tapped.Store(false)
+}
+
+// Prewarm subscribes to a call before anyone listens, so the first spy
+// session starts without waiting for rtpengine. The source is released like
+// any other when the call ends.
+func (s *Service) Prewarm(ctx context.Context, callID string) error {
+	if err := s.admission.admit(PriorityFromContext(ctx)); err != nil {
+		return err
+	}
+	fromTag, toTag, err := s.detectTags(ctx, callID)
+	if err != nil {
+		return fmt.Errorf("failed to detect tags: %w", err)
+	}
+	_, err = s.acquireSource(ctx, callID, fromTag, toTag)
+	return err
+}
@@ -0,0 +1,65 @@
+package spy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+func TestTap(t *testing.T) {
+	s := newStateTestService()
+	s.rtpClient = &mockRTPEngineClient{queryResult: map[string]interface{}{
+		"tags": map[string]interface{}{
+			"a": map[string]interface{}{"created": int64(1)},
+			"b": map[string]interface{}{"created": int64(2)},
+		},
+	}}
+	source := NewSource("call-1", "a", "b")
+	s.sources["call-1"] = source
+
+	frames, stop, err := s.Tap(context.Background(), "call-1")
+	if err != nil {
+		t.Fatalf("Tap() error = %v", err)
+	}
+	if !source.tapped.Load() {
+		t.Fatal("source not marked as tapped")
+	}
+
+	s.exportPCM(source, "from", &rtp.Packet{Header: rtp.Header{PayloadType: 8, SequenceNumber: 3}, Payload: []byte{0xd5}})
+	f := <-frames
+	if f.Leg != "from" || f.Tag != "a" || f.SequenceNumber != 3 || len(f.Samples) != 1 {
+		t.Errorf("frame = %+v", f)
+	}
+
+	stop()
+	if _, ok := <-frames; ok {
+		t.Error("frames not closed after stop")
+	}
+	if source.tapped.Load() {
+		t.Error("source still tapped after stop")
+	}
+	stop()
+
+	frames, _, err = s.Tap(context.Background(), "call-1")
+	if err != nil {
+		t.Fatalf("Tap() error = %v", err)
+	}
+	source.closeTaps()
+	if _, ok := <-frames; ok {
+		t.Error("frames not closed with the source")
+	}
+}
+
+func TestTapDropsWhileLagging(t *testing.T) {
+	source := NewSource("call-1", "a", "b")
+	ch := make(chan PCMFrame, tapBuffer)
+	source.taps = map[chan PCMFrame]struct{}{ch: {}}
+
+	for i := 0; i < tapBuffer+10; i++ {
+		source.fanOut(PCMFrame{SequenceNumber: uint16(i)})
+	}
+	if len(ch) != tapBuffer {
+		t.Errorf("buffered %d frames, want %d", len(ch), tapBuffer)
+	}
+}
@@ -3,16 +3,32 @@ package spy
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pion/webrtc/v4"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/watermark"
 )
 
 // Session represents a single browser spying on a call
 type Session struct {
 	ID        string
+	CallID    string
+	StartedAt time.Time
+	Priority  Priority
 	PC        *webrtc.PeerConnection
 	TrackFrom *webrtc.TrackLocalStaticRTP
 	TrackTo   *webrtc.TrackLocalStaticRTP
+
+	// clientStats is the latest getStats() summary uploaded by the browser.
+	clientStats atomic.Pointer[ClientStats]
+	// answerTimer closes the session if the browser never answers the offer.
+	answerTimer *time.Timer
+	// events carries source updates to the browser.
+	events *webrtc.DataChannel
+	// marks watermark the audio of each leg the session hears.
+	marks [2]*watermark.Embedder
 }
 
 // Source manages the backend connections to RTPEngine for a specific call
@@ -25,11 +41,82 @@ type Source struct {
 	SubTagFrom string
 	SubTagTo   string
 
+	// Shadow marks sources subscribed without a listener to sample quality.
+	Shadow bool
+	// wholeCall marks sources whose legs share one subscription to all media
+	// of the call, see Service.wholeCall.
+	wholeCall bool
+	StatsFrom LegStats
+	StatsTo   LegStats
+	// audio holds the AudioClass of each leg.
+	audio [2]atomic.Value
+	// talk measures the talk time of each leg.
+	talk [2]talkMeter
+	// echo compares the audio of the two legs.
+	echo echoDetector
+	// quality is the last CallQuality pushed to the listeners.
+	quality atomic.Pointer[CallQuality]
+	// taps receive the decoded audio of both legs; tapped is set while
+	// there are any.
+	taps   map[chan PCMFrame]struct{}
+	tapped atomic.Bool
+	// exportMarks watermark the exported audio of each leg.
+	exportMarks [2]atomic.Pointer[watermark.Embedder]
+	// usage accounts the CPU time spent on the source.
+	usage sourceUsage
+
 	mu       sync.RWMutex
 	Sessions map[string]*Session
-	
-	ctx    context.Context
-	cancel context.CancelFunc
+
+	stateMu     sync.Mutex
+	state       SourceState
+	stateReason string
+	stateSince  time.Time
+	legs        [2]webrtc.PeerConnectionState
+	legGen      [2]uint64
+
+	// refreshMu serializes leg resubscriptions.
+	refreshMu sync.Mutex
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	releaseOnce sync.Once
+}
+
+// LegStats counts media received on one backend leg. The counters survive
+// resubscriptions of the leg and may be read concurrently.
+type LegStats struct {
+	Packets atomic.Uint64
+	Bytes   atomic.Uint64
+	Lost    atomic.Uint64
+}
+
+func (l *LegStats) observe(seq *sequence, number uint16, size int) {
+	l.Packets.Add(1)
+	l.Bytes.Add(uint64(size))
+	l.Lost.Add(seq.next(number))
+}
+
+// sequence tracks the RTP sequence numbers of a single stream.
+type sequence struct {
+	last    uint16
+	started bool
+}
+
+// next records number and returns how many packets were skipped before it.
+// Reordered and duplicate packets are not counted as loss.
+func (s *sequence) next(number uint16) uint64 {
+	var lost uint64
+	if s.started {
+		if gap := number - s.last; gap > 1 && gap < 0x8000 {
+			lost = uint64(gap - 1)
+		}
+	}
+	if !s.started || number-s.last < 0x8000 {
+		s.last = number
+	}
+	s.started = true
+	return lost
 }
 
 type TagInfo struct {
@@ -44,7 +131,14 @@ func NewSource(callID, fromTag, toTag string) *Source {
 		FromTag:  fromTag,
 		ToTag:    toTag,
 		Sessions: make(map[string]*Session),
-		ctx:      ctx,
-		cancel:   cancel,
+
+		state:       SourceSubscribing,
+		stateReason: "subscribing",
+		stateSince:  time.Now(),
+
+		usage: sourceUsage{since: time.Now()},
+
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
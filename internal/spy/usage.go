@@ -0,0 +1,122 @@
+package spy
+
+import (
+	"cmp"
+	"slices"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Activities a source spends CPU time on.
+const (
+	// activityForwarding writes RTP to the tracks of the sessions.
+	activityForwarding = iota
+	// activityTranscoding decodes G.711 for export, taps and watermarks.
+	activityTranscoding
+	// activityAnalytics tracks media, loss and the audio of the legs.
+	activityAnalytics
+	activityCount
+)
+
+var activityNames = [activityCount]string{"forwarding", "transcoding", "analytics"}
+
+// Rough sizes of what a source holds, from pion/webrtc v4 defaults.
+const (
+	// legMemory is the SRTP, SRTCP and interceptor buffers of one backend
+	// peer connection.
+	legMemory = 256 << 10
+	// sessionMemory is the same for the peer connection of a session.
+	sessionMemory = 256 << 10
+	// frameSamplesMemory is the audio of one queued 20ms G.711 frame.
+	frameSamplesMemory = 160 * 2
+)
+
+// sourceUsage accounts the CPU time a source spends on each activity. It is
+// measured as wall time on the goroutines forwarding its legs, so it is
+// approximate: time those goroutines wait to be scheduled counts too.
+type sourceUsage struct {
+	since time.Time
+	cpu   [activityCount]atomic.Int64
+}
+
+// add charges the time since start to activity and returns the time now,
+// to start measuring the next one.
+func (u *sourceUsage) add(activity int, start time.Time) time.Time {
+	now := time.Now()
+	u.cpu[activity].Add(int64(now.Sub(start)))
+	return now
+}
+
+// SourceUsage is the approximate CPU time and memory used by the source of
+// a call.
+type SourceUsage struct {
+	CallID   string `json:"call_id"`
+	Shadow   bool   `json:"shadow,omitempty"`
+	Sessions int    `json:"sessions"`
+	Taps     int    `json:"taps"`
+	// CPUSeconds is the CPU time used since the source was created, and
+	// CPUPercent its share of one core over that time.
+	CPUSeconds float64 `json:"cpu_seconds"`
+	CPUPercent float64 `json:"cpu_percent"`
+	// Activities breaks CPUSeconds down by activity.
+	Activities map[string]float64 `json:"activities"`
+	// MemoryBytes is estimated from the peer connections and the audio
+	// buffers the source holds.
+	MemoryBytes int64     `json:"memory_bytes"`
+	Since       time.Time `json:"since"`
+}
+
+// Usage returns the usage of every source, the heaviest on CPU first.
+func (s *Service) Usage() []SourceUsage {
+	s.sourcesMu.RLock()
+	sources := make([]*Source, 0, len(s.sources))
+	for _, source := range s.sources {
+		sources = append(sources, source)
+	}
+	s.sourcesMu.RUnlock()
+
+	usage := make([]SourceUsage, 0, len(sources))
+	for _, source := range sources {
+		usage = append(usage, source.Usage())
+	}
+	slices.SortFunc(usage, func(a, b SourceUsage) int {
+		return cmp.Or(cmp.Compare(b.CPUSeconds, a.CPUSeconds), cmp.Compare(a.CallID, b.CallID))
+	})
+	return usage
+}
+
+// Usage returns the usage of the source.
+func (source *Source) Usage() SourceUsage {
+	u := SourceUsage{
+		CallID:     source.CallID,
+		Shadow:     source.Shadow,
+		Activities: make(map[string]float64, activityCount),
+		Since:      source.usage.since,
+	}
+	for i, name := range activityNames {
+		seconds := time.Duration(source.usage.cpu[i].Load()).Seconds()
+		u.Activities[name] = seconds
+		u.CPUSeconds += seconds
+	}
+	if age := time.Since(source.usage.since).Seconds(); age > 0 {
+		u.CPUPercent = 100 * u.CPUSeconds / age
+	}
+
+	source.mu.RLock()
+	u.Sessions = len(source.Sessions)
+	u.Taps = len(source.taps)
+	legs := 0
+	if source.PCFrom != nil {
+		legs++
+	}
+	if source.PCTo != nil && source.PCTo != source.PCFrom {
+		legs++
+	}
+	u.MemoryBytes = int64(legs*legMemory + u.Sessions*sessionMemory)
+	for tap := range source.taps {
+		u.MemoryBytes += int64(cap(tap))*int64(unsafe.Sizeof(PCMFrame{})) + int64(len(tap))*frameSamplesMemory
+	}
+	source.mu.RUnlock()
+	return u
+}
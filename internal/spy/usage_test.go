@@ -0,0 +1,32 @@
+package spy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsage(t *testing.T) {
+	light := NewSource("light", "a", "b")
+	heavy := NewSource("heavy", "c", "d")
+	heavy.usage.since = time.Now().Add(-10 * time.Second)
+	start := time.Now().Add(-2 * time.Second)
+	heavy.usage.add(activityTranscoding, start)
+	heavy.Sessions["s1"] = &Session{}
+	heavy.taps = map[chan PCMFrame]struct{}{make(chan PCMFrame, tapBuffer): {}}
+	s := &Service{sources: map[string]*Source{"light": light, "heavy": heavy}}
+
+	usage := s.Usage()
+	if len(usage) != 2 || usage[0].CallID != "heavy" {
+		t.Fatalf("Usage() = %+v, want heavy first", usage)
+	}
+	u := usage[0]
+	if u.Activities["transcoding"] < 2 || u.CPUSeconds != u.Activities["transcoding"] {
+		t.Errorf("activities = %v, cpu %v", u.Activities, u.CPUSeconds)
+	}
+	if u.CPUPercent < 15 || u.CPUPercent > 25 {
+		t.Errorf("CPUPercent = %v, want about 20", u.CPUPercent)
+	}
+	if u.Sessions != 1 || u.Taps != 1 || u.MemoryBytes <= sessionMemory || usage[1].MemoryBytes != 0 {
+		t.Errorf("memory = %d and %d", u.MemoryBytes, usage[1].MemoryBytes)
+	}
+}
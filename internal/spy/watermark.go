@@ -0,0 +1,117 @@
+package spy
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/watermark"
+)
+
+// sessionWatermarks returns the embedders marking the two legs a session
+// hears with its ID and start time, or none when watermarking is disabled.
+func (s *Service) sessionWatermarks(sess *Session) [2]*watermark.Embedder {
+	if s.watermark == nil {
+		return [2]*watermark.Embedder{}
+	}
+	p := watermark.Payload{ID: uuid.MustParse(sess.ID), Issued: sess.StartedAt}
+	return [2]*watermark.Embedder{s.watermark.NewEmbedder(p), s.watermark.NewEmbedder(p)}
+}
+
+// exportWatermark returns the embedder marking the exported audio of one leg
+// of source. Exports are marked with the zero ID and the time the leg was
+// first exported.
+func (s *Service) exportWatermark(source *Source, leg int) *watermark.Embedder {
+	if s.watermark == nil {
+		return nil
+	}
+	if m := source.exportMarks[leg].Load(); m != nil {
+		return m
+	}
+	source.exportMarks[leg].CompareAndSwap(nil, s.watermark.NewEmbedder(watermark.Payload{Issued: time.Now()}))
+	return source.exportMarks[leg].Load()
+}
+
+// watermarked returns a copy of a G.711 packet with mark added to its audio.
+// samples is the packet's decoded audio. Other codecs are returned as they
+// are.
+func watermarked(packet *rtp.Packet, samples []int16, mark *watermark.Embedder) *rtp.Packet {
+	var encode func(int16) byte
+	switch packet.PayloadType {
+	case 0:
+		encode = linearToULaw
+	case 8:
+		encode = linearToALaw
+	default:
+		return packet
+	}
+
+	marked := append([]int16(nil), samples...)
+	mark.Mark(marked)
+	out := *packet
+	out.Payload = make([]byte, len(marked))
+	for i, v := range marked {
+		out.Payload[i] = encode(v)
+	}
+	return &out
+}
+
+// decodeG711 returns the audio of a G.711 packet, or nil for other codecs.
+func decodeG711(packet *rtp.Packet) []int16 {
+	var table *[256]int16
+	switch packet.PayloadType {
+	case 0:
+		table = &ulawTable
+	case 8:
+		table = &alawTable
+	default:
+		return nil
+	}
+	samples := make([]int16, len(packet.Payload))
+	for i, b := range packet.Payload {
+		samples[i] = table[b]
+	}
+	return samples
+}
+
+func linearToULaw(sample int16) byte {
+	const bias, clip = 0x84, 32635
+	v := int(sample)
+	sign := 0
+	if v < 0 {
+		v, sign = -v, 0x80
+	}
+	if v > clip {
+		v = clip
+	}
+	v += bias
+	exponent := 7
+	for mask := 0x4000; v&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (v >> (exponent + 3)) & 0x0f
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+func linearToALaw(sample int16) byte {
+	v := int(sample)
+	sign := 0x80
+	if v < 0 {
+		v, sign = -v-1, 0
+	}
+	if v > 32767 {
+		v = 32767
+	}
+	var b int
+	if v < 256 {
+		b = v >> 4
+	} else {
+		exponent := 1
+		for t := v >> 8; t > 1; t >>= 1 {
+			exponent++
+		}
+		b = exponent<<4 | (v>>(exponent+3))&0x0f
+	}
+	return byte(b|sign) ^ 0x55
+}
@@ -0,0 +1,59 @@
+package spy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/watermark"
+)
+
+func TestG711Encoding(t *testing.T) {
+	for b := range 256 {
+		if got := linearToULaw(ulawTable[b]); ulawTable[got] != ulawTable[b] {
+			t.Errorf("μ-law %#x decodes to %d, re-encodes to %#x", b, ulawTable[b], got)
+		}
+		if got := linearToALaw(alawTable[b]); got != byte(b) {
+			t.Errorf("A-law %#x decodes to %d, re-encodes to %#x", b, alawTable[b], got)
+		}
+	}
+}
+
+func TestSessionWatermark(t *testing.T) {
+	s := newStateTestService()
+	s.watermark = watermark.NewKey("secret")
+	sess := &Session{ID: uuid.New().String(), StartedAt: time.Unix(1760000000, 0)}
+	marks := s.sessionWatermarks(sess)
+
+	// Ten seconds of a tone forwarded to the session in 20ms PCMU packets.
+	var heard []int16
+	for seq := 0; seq < 500; seq++ {
+		payload := make([]byte, watermark.FrameSize)
+		for i := range payload {
+			n := seq*watermark.FrameSize + i
+			payload[i] = linearToULaw(int16(3000 * math.Sin(2*math.Pi*440*float64(n)/watermark.SampleRate)))
+		}
+		packet := &rtp.Packet{Header: rtp.Header{PayloadType: 0, SequenceNumber: uint16(seq)}, Payload: payload}
+		out := watermarked(packet, decodeG711(packet), marks[legFrom])
+		if out == packet || out.SequenceNumber != packet.SequenceNumber {
+			t.Fatal("watermarked() did not copy the packet")
+		}
+		heard = append(heard, decodeG711(out)...)
+	}
+
+	got, ok := s.watermark.Detect(heard)
+	if !ok {
+		t.Fatal("no watermark found in the session's audio")
+	}
+	if uuid.UUID(got.ID).String() != sess.ID || !got.Issued.Equal(sess.StartedAt) {
+		t.Errorf("watermark = %+v, want session %s", got, sess.ID)
+	}
+
+	opus := &rtp.Packet{Header: rtp.Header{PayloadType: 111}, Payload: []byte{1, 2}}
+	if watermarked(opus, nil, marks[legFrom]) != opus {
+		t.Error("watermarked() changed a non-G.711 packet")
+	}
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrLegalHold is returned when erasing a call placed under legal hold.
+var ErrLegalHold = errors.New("call is under legal hold")
+
+// LegalHold exempts a call's history from erasure.
+type LegalHold struct {
+	CallID   string    `json:"call_id"`
+	Reason   string    `json:"reason"`
+	PlacedAt time.Time `json:"placed_at"`
+}
+
+// Erasure counts the rows removed by EraseCall.
+type Erasure struct {
+	Calls        int64 `json:"calls"`
+	Sessions     int64 `json:"sessions"`
+	ClientStats  int64 `json:"client_stats"`
+	Recordings   int64 `json:"recordings"`
+	AuditEntries int64 `json:"audit_entries"`
+}
+
+func (s *sqlStore) PlaceLegalHold(ctx context.Context, hold LegalHold) error {
+	return s.exec(ctx, `INSERT INTO legal_holds (call_id, reason, placed_at) VALUES (?, ?, ?)
+		ON CONFLICT (call_id) DO UPDATE SET
+			reason = excluded.reason,
+			placed_at = excluded.placed_at`,
+		hold.CallID, hold.Reason, toMillis(hold.PlacedAt))
+}
+
+func (s *sqlStore) ReleaseLegalHold(ctx context.Context, callID string) error {
+	return s.exec(ctx, `DELETE FROM legal_holds WHERE call_id = ?`, callID)
+}
+
+// EraseCall removes a call's history in a single transaction. Audit entries
+// targeting the call ID or any of auditTargets are removed as well.
+func (s *sqlStore) EraseCall(ctx context.Context, callID string, auditTargets ...string) (*Erasure, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var held string
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT call_id FROM legal_holds WHERE call_id = ?`), callID).Scan(&held)
+	if err == nil {
+		return nil, ErrLegalHold
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	e := &Erasure{}
+	steps := []struct {
+		query string
+		count *int64
+	}{
+		{`DELETE FROM client_stats WHERE call_id = ?`, &e.ClientStats},
+		{`DELETE FROM sessions WHERE call_id = ?`, &e.Sessions},
+		{`DELETE FROM recordings WHERE call_id = ?`, &e.Recordings},
+		{`DELETE FROM calls WHERE call_id = ?`, &e.Calls},
+	}
+	for _, step := range steps {
+		if *step.count, err = execCount(ctx, tx, s.rebind(step.query), callID); err != nil {
+			return nil, err
+		}
+	}
+	for _, target := range append([]string{callID}, auditTargets...) {
+		n, err := execCount(ctx, tx, s.rebind(`DELETE FROM audit WHERE target = ?`), target)
+		if err != nil {
+			return nil, err
+		}
+		e.AuditEntries += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func execCount(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations follow the golang-migrate naming scheme: <version>_<name>.up.sql.
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Migration is a single schema migration.
+type Migration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+}
+
+// SchemaInfo reports the schema version of a store.
+type SchemaInfo struct {
+	Driver     string      `json:"driver"`
+	Version    int         `json:"version"`
+	Latest     int         `json:"latest"`
+	Migrations []Migration `json:"migrations"`
+}
+
+type migrationFile struct {
+	Migration
+	path string
+}
+
+func loadMigrations(dir string) ([]migrationFile, error) {
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []migrationFile
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		versionStr, rest, ok := strings.Cut(strings.TrimSuffix(name, ".up.sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", name, err)
+		}
+		files = append(files, migrationFile{
+			Migration: Migration{Version: version, Name: rest},
+			path:      path.Join(dir, name),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Version < files[j].Version })
+	for i := 1; i < len(files); i++ {
+		if files[i].Version == files[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", files[i].Version)
+		}
+	}
+	return files, nil
+}
+
+// migrationLockKey is the Postgres advisory lock replicas take while
+// migrating ("rtpmon" in ASCII).
+const migrationLockKey = 0x72746d6f6e
+
+// migrate applies every embedded migration not yet recorded in
+// schema_migrations, each in its own transaction. Where the dialect has a
+// migration lock, it is held on one connection for the whole run and the
+// applied set is read only once it is held, so replicas starting together
+// apply each migration once.
+func (s *sqlStore) migrate(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if s.d.lockMigrations != "" {
+		if _, err := conn.ExecContext(ctx, s.rebind(s.d.lockMigrations), migrationLockKey); err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), s.rebind(s.d.unlockMigrations), migrationLockKey)
+	}
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	files, err := loadMigrations(s.d.migrations)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range files {
+		if applied[m.Version] {
+			continue
+		}
+		body, err := migrationsFS.ReadFile(m.path)
+		if err != nil {
+			return err
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(body)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			m.Version, m.Name, time.Now().UnixMilli()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func (s *sqlStore) SchemaInfo(ctx context.Context) (*SchemaInfo, error) {
+	files, err := loadMigrations(s.d.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	info := &SchemaInfo{Driver: s.d.name, Migrations: []Migration{}}
+	if len(files) > 0 {
+		info.Latest = files[len(files)-1].Version
+	}
+	for rows.Next() {
+		var m Migration
+		var appliedAt int64
+		if err := rows.Scan(&m.Version, &m.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		m.AppliedAt = fromMillis(appliedAt)
+		info.Migrations = append(info.Migrations, m)
+		info.Version = m.Version
+	}
+	return info, rows.Err()
+}
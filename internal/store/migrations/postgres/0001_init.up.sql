@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS calls (
+	call_id    TEXT PRIMARY KEY,
+	from_tag   TEXT NOT NULL,
+	to_tag     TEXT NOT NULL,
+	first_seen BIGINT NOT NULL,
+	last_seen  BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id         TEXT PRIMARY KEY,
+	call_id    TEXT NOT NULL,
+	started_at BIGINT NOT NULL,
+	ended_at   BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS recordings (
+	id         TEXT PRIMARY KEY,
+	call_id    TEXT NOT NULL,
+	location   TEXT NOT NULL,
+	started_at BIGINT NOT NULL,
+	stopped_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS audit (
+	id     BIGSERIAL PRIMARY KEY,
+	time   BIGINT NOT NULL,
+	actor  TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	detail TEXT NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS instances (
+	id        TEXT PRIMARY KEY,
+	url       TEXT NOT NULL,
+	last_seen BIGINT NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS legal_holds (
+	call_id   TEXT PRIMARY KEY,
+	reason    TEXT NOT NULL,
+	placed_at BIGINT NOT NULL
+);
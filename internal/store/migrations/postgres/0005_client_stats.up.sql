@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS client_stats (
+	id                BIGSERIAL PRIMARY KEY,
+	session_id        TEXT NOT NULL,
+	call_id           TEXT NOT NULL,
+	time              BIGINT NOT NULL,
+	packets_received  BIGINT NOT NULL,
+	packets_lost      BIGINT NOT NULL,
+	bytes_received    BIGINT NOT NULL,
+	jitter            DOUBLE PRECISION NOT NULL,
+	round_trip_time   DOUBLE PRECISION NOT NULL,
+	concealed_samples BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS client_stats_session_idx ON client_stats (session_id, time);
+CREATE INDEX IF NOT EXISTS client_stats_call_idx ON client_stats (call_id);
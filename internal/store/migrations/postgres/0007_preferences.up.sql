@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS preferences (
+	user_id    TEXT PRIMARY KEY,
+	settings   TEXT NOT NULL,
+	updated_at BIGINT NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE calls ADD COLUMN labels TEXT NOT NULL DEFAULT '';
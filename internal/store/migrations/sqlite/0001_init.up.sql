@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS calls (
+	call_id    TEXT PRIMARY KEY,
+	from_tag   TEXT NOT NULL,
+	to_tag     TEXT NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id         TEXT PRIMARY KEY,
+	call_id    TEXT NOT NULL,
+	started_at INTEGER NOT NULL,
+	ended_at   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS recordings (
+	id         TEXT PRIMARY KEY,
+	call_id    TEXT NOT NULL,
+	location   TEXT NOT NULL,
+	started_at INTEGER NOT NULL,
+	stopped_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS audit (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	time   INTEGER NOT NULL,
+	actor  TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	detail TEXT NOT NULL
+);
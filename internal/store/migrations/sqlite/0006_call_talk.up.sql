@@ -0,0 +1,4 @@
+ALTER TABLE calls ADD COLUMN talk_ms_from    INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE calls ADD COLUMN silence_ms_from INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE calls ADD COLUMN talk_ms_to      INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE calls ADD COLUMN silence_ms_to   INTEGER NOT NULL DEFAULT 0;
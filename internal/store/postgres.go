@@ -0,0 +1,17 @@
+package store
+
+import (
+	"strconv"
+
+	_ "github.com/lib/pq"
+)
+
+var postgresDialect = dialect{
+	name:        "postgres",
+	driverName:  "postgres",
+	migrations:  "migrations/postgres",
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+
+	lockMigrations:   `SELECT pg_advisory_lock(?)`,
+	unlockMigrations: `SELECT pg_advisory_unlock(?)`,
+}
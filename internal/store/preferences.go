@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Preferences are the UI settings of one user, kept as an opaque JSON object
+// so the UI can add settings without schema changes.
+type Preferences struct {
+	User      string          `json:"-"`
+	Settings  json.RawMessage `json:"settings"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func (s *sqlStore) GetPreferences(ctx context.Context, user string) (*Preferences, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT settings, updated_at FROM preferences WHERE user_id = ?`), user)
+
+	prefs := Preferences{User: user}
+	var settings string
+	var updated int64
+	if err := row.Scan(&settings, &updated); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	prefs.Settings, prefs.UpdatedAt = json.RawMessage(settings), fromMillis(updated)
+	return &prefs, nil
+}
+
+func (s *sqlStore) SavePreferences(ctx context.Context, prefs Preferences) error {
+	return s.exec(ctx, `INSERT INTO preferences (user_id, settings, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			settings = excluded.settings,
+			updated_at = excluded.updated_at`,
+		prefs.User, string(prefs.Settings), toMillis(prefs.UpdatedAt))
+}
@@ -0,0 +1,351 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dialect captures the differences between the supported SQL databases.
+// Queries are written with '?' placeholders and rebound per dialect.
+type dialect struct {
+	name        string
+	driverName  string
+	migrations  string
+	placeholder func(n int) string
+	// dsn completes the DSN the operator configured, when set.
+	dsn func(dsn string) string
+	// lockMigrations and unlockMigrations take and release a session lock
+	// on the migration lock key; empty for SQLite, which replicas never
+	// share.
+	lockMigrations   string
+	unlockMigrations string
+}
+
+type sqlStore struct {
+	db *sql.DB
+	d  dialect
+}
+
+func openSQL(ctx context.Context, d dialect, dsn string) (*sqlStore, error) {
+	if d.dsn != nil {
+		dsn = d.dsn(dsn)
+	}
+	db, err := sql.Open(d.driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s store: %w", d.name, err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s store: %w", d.name, err)
+	}
+
+	s := &sqlStore{db: db, d: d}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s store: %w", d.name, err)
+	}
+
+	return s, nil
+}
+
+func (s *sqlStore) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(s.d.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(query), args...)
+	return err
+}
+
+func (s *sqlStore) SaveCall(ctx context.Context, call CallRecord) error {
+	var labels []byte
+	if len(call.Labels) > 0 {
+		var err error
+		if labels, err = json.Marshal(call.Labels); err != nil {
+			return err
+		}
+	}
+	return s.exec(ctx, `INSERT INTO calls (call_id, from_tag, to_tag, first_seen, last_seen, labels)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (call_id) DO UPDATE SET
+			from_tag = excluded.from_tag,
+			to_tag = excluded.to_tag,
+			last_seen = excluded.last_seen,
+			labels = excluded.labels`,
+		call.CallID, call.FromTag, call.ToTag, toMillis(call.FirstSeen), toMillis(call.LastSeen), string(labels))
+}
+
+// scanLabels decodes the labels column of a call, empty for calls saved
+// without labels.
+func scanLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var labels map[string]string
+	err := json.Unmarshal([]byte(s), &labels)
+	return labels, err
+}
+
+func (s *sqlStore) GetCall(ctx context.Context, callID string) (*CallRecord, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT call_id, from_tag, to_tag, first_seen, last_seen,
+		talk_ms_from, silence_ms_from, talk_ms_to, silence_ms_to, labels
+		FROM calls WHERE call_id = ?`), callID)
+
+	var call CallRecord
+	var first, last int64
+	var labels string
+	if err := row.Scan(&call.CallID, &call.FromTag, &call.ToTag, &first, &last,
+		&call.Talk.FromTalkMs, &call.Talk.FromSilenceMs, &call.Talk.ToTalkMs, &call.Talk.ToSilenceMs, &labels); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	call.FirstSeen, call.LastSeen = fromMillis(first), fromMillis(last)
+	call.Talk.setRatios()
+	var err error
+	if call.Labels, err = scanLabels(labels); err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+func (s *sqlStore) ListCalls(ctx context.Context, limit int) ([]CallRecord, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT call_id, from_tag, to_tag, first_seen, last_seen,
+		talk_ms_from, silence_ms_from, talk_ms_to, silence_ms_to, labels
+		FROM calls ORDER BY last_seen DESC LIMIT ?`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	calls := []CallRecord{}
+	for rows.Next() {
+		var call CallRecord
+		var first, last int64
+		var labels string
+		if err := rows.Scan(&call.CallID, &call.FromTag, &call.ToTag, &first, &last,
+			&call.Talk.FromTalkMs, &call.Talk.FromSilenceMs, &call.Talk.ToTalkMs, &call.Talk.ToSilenceMs, &labels); err != nil {
+			return nil, err
+		}
+		call.FirstSeen, call.LastSeen = fromMillis(first), fromMillis(last)
+		call.Talk.setRatios()
+		if call.Labels, err = scanLabels(labels); err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+	return calls, rows.Err()
+}
+
+func (s *sqlStore) AddCallTalk(ctx context.Context, callID string, talk CallTalk) error {
+	return s.exec(ctx, `UPDATE calls SET
+			talk_ms_from = talk_ms_from + ?,
+			silence_ms_from = silence_ms_from + ?,
+			talk_ms_to = talk_ms_to + ?,
+			silence_ms_to = silence_ms_to + ?
+		WHERE call_id = ?`,
+		talk.FromTalkMs, talk.FromSilenceMs, talk.ToTalkMs, talk.ToSilenceMs, callID)
+}
+
+func (s *sqlStore) SaveSession(ctx context.Context, sess SessionRecord) error {
+	return s.exec(ctx, `INSERT INTO sessions (id, call_id, started_at, ended_at) VALUES (?, ?, ?, ?)`,
+		sess.ID, sess.CallID, toMillis(sess.StartedAt), toMillis(sess.EndedAt))
+}
+
+func (s *sqlStore) EndSession(ctx context.Context, sessionID string, endedAt time.Time) error {
+	return s.exec(ctx, `UPDATE sessions SET ended_at = ? WHERE id = ?`, toMillis(endedAt), sessionID)
+}
+
+func (s *sqlStore) ListSessions(ctx context.Context, callID string) ([]SessionRecord, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT id, call_id, started_at, ended_at
+		FROM sessions WHERE call_id = ? ORDER BY started_at`), callID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []SessionRecord{}
+	for rows.Next() {
+		var sess SessionRecord
+		var started, ended int64
+		if err := rows.Scan(&sess.ID, &sess.CallID, &started, &ended); err != nil {
+			return nil, err
+		}
+		sess.StartedAt, sess.EndedAt = fromMillis(started), fromMillis(ended)
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sqlStore) SaveClientStats(ctx context.Context, stats ClientStatsRecord) error {
+	return s.exec(ctx, `INSERT INTO client_stats (session_id, call_id, time, packets_received, packets_lost,
+			bytes_received, jitter, round_trip_time, concealed_samples)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		stats.SessionID, stats.CallID, toMillis(stats.Time), int64(stats.PacketsReceived), stats.PacketsLost,
+		int64(stats.BytesReceived), stats.Jitter, stats.RoundTripTime, int64(stats.ConcealedSamples))
+}
+
+func (s *sqlStore) ListClientStats(ctx context.Context, sessionID string, limit int) ([]ClientStatsRecord, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT session_id, call_id, time, packets_received, packets_lost,
+			bytes_received, jitter, round_trip_time, concealed_samples
+		FROM client_stats WHERE session_id = ? ORDER BY time DESC LIMIT ?`), sessionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []ClientStatsRecord{}
+	for rows.Next() {
+		var stats ClientStatsRecord
+		var t, received, bytes, concealed int64
+		if err := rows.Scan(&stats.SessionID, &stats.CallID, &t, &received, &stats.PacketsLost,
+			&bytes, &stats.Jitter, &stats.RoundTripTime, &concealed); err != nil {
+			return nil, err
+		}
+		stats.Time = fromMillis(t)
+		stats.PacketsReceived, stats.BytesReceived, stats.ConcealedSamples = uint64(received), uint64(bytes), uint64(concealed)
+		list = append(list, stats)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlStore) SaveRecording(ctx context.Context, rec RecordingRecord) error {
+	return s.exec(ctx, `INSERT INTO recordings (id, call_id, location, started_at, stopped_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			location = excluded.location,
+			stopped_at = excluded.stopped_at`,
+		rec.ID, rec.CallID, rec.Location, toMillis(rec.StartedAt), toMillis(rec.StoppedAt))
+}
+
+func (s *sqlStore) ListRecordings(ctx context.Context, callID string) ([]RecordingRecord, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT id, call_id, location, started_at, stopped_at
+		FROM recordings WHERE call_id = ? ORDER BY started_at`), callID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordings := []RecordingRecord{}
+	for rows.Next() {
+		var rec RecordingRecord
+		var started, stopped int64
+		if err := rows.Scan(&rec.ID, &rec.CallID, &rec.Location, &started, &stopped); err != nil {
+			return nil, err
+		}
+		rec.StartedAt, rec.StoppedAt = fromMillis(started), fromMillis(stopped)
+		recordings = append(recordings, rec)
+	}
+	return recordings, rows.Err()
+}
+
+func (s *sqlStore) AppendAudit(ctx context.Context, entry AuditEntry) error {
+	return s.exec(ctx, `INSERT INTO audit (time, actor, action, target, detail) VALUES (?, ?, ?, ?, ?)`,
+		toMillis(entry.Time), entry.Actor, entry.Action, entry.Target, entry.Detail)
+}
+
+func (s *sqlStore) ListAudit(ctx context.Context, limit int) ([]AuditEntry, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT id, time, actor, action, target, detail
+		FROM audit ORDER BY id DESC LIMIT ?`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var t int64
+		if err := rows.Scan(&entry.ID, &t, &entry.Actor, &entry.Action, &entry.Target, &entry.Detail); err != nil {
+			return nil, err
+		}
+		entry.Time = fromMillis(t)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) Heartbeat(ctx context.Context, inst Instance) error {
+	return s.exec(ctx, `INSERT INTO instances (id, url, last_seen) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			url = excluded.url,
+			last_seen = excluded.last_seen`,
+		inst.ID, inst.URL, toMillis(inst.LastSeen))
+}
+
+func (s *sqlStore) ListInstances(ctx context.Context, since time.Time) ([]Instance, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT id, url, last_seen
+		FROM instances WHERE last_seen >= ? ORDER BY id`), toMillis(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	instances := []Instance{}
+	for rows.Next() {
+		var inst Instance
+		var lastSeen int64
+		if err := rows.Scan(&inst.ID, &inst.URL, &lastSeen); err != nil {
+			return nil, err
+		}
+		inst.LastSeen = fromMillis(lastSeen)
+		instances = append(instances, inst)
+	}
+	return instances, rows.Err()
+}
+
+func (s *sqlStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			holder = excluded.holder,
+			expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at < ?`),
+		name, holder, toMillis(now.Add(ttl)), toMillis(now))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *sqlStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	return s.exec(ctx, `DELETE FROM leases WHERE name = ? AND holder = ?`, name, holder)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func toMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+var sqliteDialect = dialect{
+	name:        "sqlite",
+	driverName:  "sqlite",
+	migrations:  "migrations/sqlite",
+	placeholder: func(int) string { return "?" },
+	dsn:         sqliteDSN,
+}
+
+// sqliteDefaults make concurrent writers queue for the database lock rather
+// than fail with SQLITE_BUSY: readers do not block the writer in WAL mode,
+// writers wait up to 5s for each other, and transactions take the write lock
+// up front so one that reads first cannot fail upgrading it.
+var sqliteDefaults = []struct{ key, param string }{
+	{"busy_timeout", "_pragma=busy_timeout(5000)"},
+	{"journal_mode", "_pragma=journal_mode(WAL)"},
+	{"_txlock", "_txlock=immediate"},
+}
+
+// sqliteDSN adds the defaults the DSN does not set itself.
+func sqliteDSN(dsn string) string {
+	for _, d := range sqliteDefaults {
+		if strings.Contains(dsn, d.key) {
+			continue
+		}
+		if strings.Contains(dsn, "?") {
+			dsn += "&" + d.param
+		} else {
+			dsn += "?" + d.param
+		}
+	}
+	return dsn
+}
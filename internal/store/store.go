@@ -0,0 +1,153 @@
+// Package store persists calls, spy sessions, recording metadata and audit
+// entries. The backing database is selected at runtime by driver name.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when a record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// CallRecord describes a call seen by the monitor.
+type CallRecord struct {
+	CallID    string    `json:"call_id"`
+	FromTag   string    `json:"from_tag"`
+	ToTag     string    `json:"to_tag"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Talk is the talk time measured while the call was subscribed. It is
+	// only changed by AddCallTalk.
+	Talk CallTalk `json:"talk"`
+	// Labels are the static labels of the instance that saw the call.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// CallTalk is the talk and silence time of both legs of a call, in
+// milliseconds. The talk ratios, each leg's share of the talk time, are
+// derived when the record is read.
+type CallTalk struct {
+	FromTalkMs    int64   `json:"from_talk_ms"`
+	FromSilenceMs int64   `json:"from_silence_ms"`
+	FromTalkRatio float64 `json:"from_talk_ratio"`
+	ToTalkMs      int64   `json:"to_talk_ms"`
+	ToSilenceMs   int64   `json:"to_silence_ms"`
+	ToTalkRatio   float64 `json:"to_talk_ratio"`
+}
+
+func (t *CallTalk) setRatios() {
+	if total := t.FromTalkMs + t.ToTalkMs; total > 0 {
+		t.FromTalkRatio = float64(t.FromTalkMs) / float64(total)
+		t.ToTalkRatio = float64(t.ToTalkMs) / float64(total)
+	}
+}
+
+// SessionRecord describes a browser spy session.
+type SessionRecord struct {
+	ID        string    `json:"id"`
+	CallID    string    `json:"call_id"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+}
+
+// RecordingRecord describes a recording produced for a call.
+type RecordingRecord struct {
+	ID        string    `json:"id"`
+	CallID    string    `json:"call_id"`
+	Location  string    `json:"location"`
+	StartedAt time.Time `json:"started_at"`
+	StoppedAt time.Time `json:"stopped_at"`
+}
+
+// ClientStatsRecord is a browser getStats() summary uploaded for a session.
+type ClientStatsRecord struct {
+	SessionID        string    `json:"session_id"`
+	CallID           string    `json:"call_id"`
+	Time             time.Time `json:"time"`
+	PacketsReceived  uint64    `json:"packets_received"`
+	PacketsLost      int64     `json:"packets_lost"`
+	BytesReceived    uint64    `json:"bytes_received"`
+	Jitter           float64   `json:"jitter"`
+	RoundTripTime    float64   `json:"round_trip_time"`
+	ConcealedSamples uint64    `json:"concealed_samples"`
+}
+
+// AuditEntry records an action taken through the monitor.
+type AuditEntry struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Detail string    `json:"detail"`
+}
+
+// Instance is an rtpengine-mon replica registered in a shared store.
+type Instance struct {
+	ID       string    `json:"id"`
+	URL      string    `json:"url"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Store is the persistence layer used by the monitor.
+type Store interface {
+	SaveCall(ctx context.Context, call CallRecord) error
+	GetCall(ctx context.Context, callID string) (*CallRecord, error)
+	ListCalls(ctx context.Context, limit int) ([]CallRecord, error)
+	// AddCallTalk adds talk time measured during one subscription of a
+	// saved call to its record.
+	AddCallTalk(ctx context.Context, callID string, talk CallTalk) error
+
+	SaveSession(ctx context.Context, sess SessionRecord) error
+	EndSession(ctx context.Context, sessionID string, endedAt time.Time) error
+	ListSessions(ctx context.Context, callID string) ([]SessionRecord, error)
+
+	SaveClientStats(ctx context.Context, stats ClientStatsRecord) error
+	// ListClientStats returns the most recent uploads of a session, newest first.
+	ListClientStats(ctx context.Context, sessionID string, limit int) ([]ClientStatsRecord, error)
+
+	SaveRecording(ctx context.Context, rec RecordingRecord) error
+	ListRecordings(ctx context.Context, callID string) ([]RecordingRecord, error)
+
+	AppendAudit(ctx context.Context, entry AuditEntry) error
+	ListAudit(ctx context.Context, limit int) ([]AuditEntry, error)
+
+	Heartbeat(ctx context.Context, inst Instance) error
+	ListInstances(ctx context.Context, since time.Time) ([]Instance, error)
+
+	// AcquireLease takes or renews the named lease for holder. It reports
+	// false while another holder owns an unexpired lease.
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+
+	PlaceLegalHold(ctx context.Context, hold LegalHold) error
+	ReleaseLegalHold(ctx context.Context, callID string) error
+	// EraseCall removes the history of a call unless it is under legal hold,
+	// in which case ErrLegalHold is returned.
+	EraseCall(ctx context.Context, callID string, auditTargets ...string) (*Erasure, error)
+
+	// GetPreferences returns ErrNotFound until the user saved preferences.
+	GetPreferences(ctx context.Context, user string) (*Preferences, error)
+	SavePreferences(ctx context.Context, prefs Preferences) error
+
+	SchemaInfo(ctx context.Context) (*SchemaInfo, error)
+
+	Close() error
+}
+
+// Open opens the store for the given driver ("sqlite" or "postgres") and DSN.
+func Open(ctx context.Context, driver, dsn string) (Store, error) {
+	var d dialect
+	switch driver {
+	case "sqlite":
+		d = sqliteDialect
+	case "postgres":
+		d = postgresDialect
+	default:
+		return nil, fmt.Errorf("unknown store driver: %q", driver)
+	}
+	return openSQL(ctx, d, dsn)
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	ctx := context.Background()
+	st, err := Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	first := time.UnixMilli(1000)
+	if err := st.SaveCall(ctx, CallRecord{CallID: "c1", FromTag: "a", ToTag: "b", FirstSeen: first, LastSeen: first}); err != nil {
+		t.Fatalf("SaveCall() error = %v", err)
+	}
+	if err := st.SaveCall(ctx, CallRecord{CallID: "c1", FromTag: "a", ToTag: "c", FirstSeen: first, LastSeen: time.UnixMilli(2000), Labels: map[string]string{"datacenter": "fra1"}}); err != nil {
+		t.Fatalf("SaveCall() upsert error = %v", err)
+	}
+
+	call, err := st.GetCall(ctx, "c1")
+	if err != nil {
+		t.Fatalf("GetCall() error = %v", err)
+	}
+	if call.ToTag != "c" || !call.FirstSeen.Equal(first) || !call.LastSeen.Equal(time.UnixMilli(2000)) || call.Labels["datacenter"] != "fra1" {
+		t.Errorf("unexpected call after upsert: %+v", call)
+	}
+	if _, err := st.GetCall(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := st.SaveSession(ctx, SessionRecord{ID: "s1", CallID: "c1", StartedAt: first}); err != nil {
+		t.Fatalf("SaveSession() error = %v", err)
+	}
+	if err := st.EndSession(ctx, "s1", time.UnixMilli(3000)); err != nil {
+		t.Fatalf("EndSession() error = %v", err)
+	}
+	sessions, err := st.ListSessions(ctx, "c1")
+	if err != nil || len(sessions) != 1 || !sessions[0].EndedAt.Equal(time.UnixMilli(3000)) {
+		t.Errorf("unexpected sessions: %+v, err = %v", sessions, err)
+	}
+
+	for _, action := range []string{"spy.start", "spy.stop"} {
+		if err := st.AppendAudit(ctx, AuditEntry{Time: first, Action: action, Target: "c1"}); err != nil {
+			t.Fatalf("AppendAudit() error = %v", err)
+		}
+	}
+	entries, err := st.ListAudit(ctx, 10)
+	if err != nil || len(entries) != 2 || entries[0].Action != "spy.stop" {
+		t.Errorf("unexpected audit entries: %+v, err = %v", entries, err)
+	}
+}
+
+func TestAddCallTalk(t *testing.T) {
+	ctx := context.Background()
+	st, err := Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	now := time.UnixMilli(1000)
+	if err := st.SaveCall(ctx, CallRecord{CallID: "c1", FirstSeen: now, LastSeen: now}); err != nil {
+		t.Fatalf("SaveCall() error = %v", err)
+	}
+	for _, talk := range []CallTalk{
+		{FromTalkMs: 1000, FromSilenceMs: 500, ToTalkMs: 2000, ToSilenceMs: 100},
+		{FromTalkMs: 2000, FromSilenceMs: 500, ToTalkMs: 1000, ToSilenceMs: 300},
+	} {
+		if err := st.AddCallTalk(ctx, "c1", talk); err != nil {
+			t.Fatalf("AddCallTalk() error = %v", err)
+		}
+	}
+	// A later subscription of the call must not reset its talk time.
+	if err := st.SaveCall(ctx, CallRecord{CallID: "c1", FirstSeen: now, LastSeen: time.UnixMilli(2000)}); err != nil {
+		t.Fatalf("SaveCall() error = %v", err)
+	}
+
+	call, err := st.GetCall(ctx, "c1")
+	if err != nil {
+		t.Fatalf("GetCall() error = %v", err)
+	}
+	want := CallTalk{FromTalkMs: 3000, FromSilenceMs: 1000, FromTalkRatio: 0.5, ToTalkMs: 3000, ToSilenceMs: 400, ToTalkRatio: 0.5}
+	if call.Talk != want {
+		t.Errorf("Talk = %+v, want %+v", call.Talk, want)
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	ctx := context.Background()
+	st, err := Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	if _, err := st.GetPreferences(ctx, "u1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	for i, settings := range []string{`{"denoise":true}`, `{"denoise":false,"ranked":true}`} {
+		prefs := Preferences{User: "u1", Settings: []byte(settings), UpdatedAt: time.UnixMilli(int64(1000 * (i + 1)))}
+		if err := st.SavePreferences(ctx, prefs); err != nil {
+			t.Fatalf("SavePreferences() error = %v", err)
+		}
+	}
+
+	prefs, err := st.GetPreferences(ctx, "u1")
+	if err != nil {
+		t.Fatalf("GetPreferences() error = %v", err)
+	}
+	if string(prefs.Settings) != `{"denoise":false,"ranked":true}` || !prefs.UpdatedAt.Equal(time.UnixMilli(2000)) {
+		t.Errorf("unexpected preferences after upsert: %+v", prefs)
+	}
+	if _, err := st.GetPreferences(ctx, "u2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("preferences leaked to another user: %v", err)
+	}
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	if _, err := Open(context.Background(), "mysql", ""); err == nil {
+		t.Fatal("expected error for unknown driver")
+	}
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "test.db")
+
+	for i := 0; i < 2; i++ {
+		st, err := Open(ctx, "sqlite", dsn)
+		if err != nil {
+			t.Fatalf("Open() run %d error = %v", i, err)
+		}
+		info, err := st.SchemaInfo(ctx)
+		st.Close()
+		if err != nil {
+			t.Fatalf("SchemaInfo() error = %v", err)
+		}
+		if info.Version != info.Latest || len(info.Migrations) != info.Latest {
+			t.Errorf("run %d: unexpected schema info %+v", i, info)
+		}
+	}
+}
+
+func TestLeases(t *testing.T) {
+	ctx := context.Background()
+	st, err := Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	steps := []struct {
+		holder string
+		ttl    time.Duration
+		want   bool
+	}{
+		{holder: "a", ttl: time.Minute, want: true},
+		{holder: "b", ttl: time.Minute, want: false},
+		{holder: "a", ttl: -time.Second, want: true},
+		{holder: "b", ttl: time.Minute, want: true},
+	}
+	for i, step := range steps {
+		got, err := st.AcquireLease(ctx, "poller", step.holder, step.ttl)
+		if err != nil {
+			t.Fatalf("step %d: AcquireLease() error = %v", i, err)
+		}
+		if got != step.want {
+			t.Errorf("step %d: AcquireLease(%s) = %v, want %v", i, step.holder, got, step.want)
+		}
+	}
+}
+
+func TestEraseCall(t *testing.T) {
+	ctx := context.Background()
+	st, err := Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	now := time.UnixMilli(1000)
+	for _, callID := range []string{"c1", "c2"} {
+		if err := st.SaveCall(ctx, CallRecord{CallID: callID, FirstSeen: now, LastSeen: now}); err != nil {
+			t.Fatalf("SaveCall() error = %v", err)
+		}
+		if err := st.SaveSession(ctx, SessionRecord{ID: "s-" + callID, CallID: callID, StartedAt: now}); err != nil {
+			t.Fatalf("SaveSession() error = %v", err)
+		}
+		if err := st.SaveRecording(ctx, RecordingRecord{ID: "r-" + callID, CallID: callID, StartedAt: now}); err != nil {
+			t.Fatalf("SaveRecording() error = %v", err)
+		}
+	}
+	for _, target := range []string{"c1", "hashed-c1", "c2"} {
+		if err := st.AppendAudit(ctx, AuditEntry{Time: now, Action: "spy.start", Target: target}); err != nil {
+			t.Fatalf("AppendAudit() error = %v", err)
+		}
+	}
+
+	if err := st.PlaceLegalHold(ctx, LegalHold{CallID: "c2", Reason: "case 42", PlacedAt: now}); err != nil {
+		t.Fatalf("PlaceLegalHold() error = %v", err)
+	}
+	if _, err := st.EraseCall(ctx, "c2"); !errors.Is(err, ErrLegalHold) {
+		t.Fatalf("expected ErrLegalHold, got %v", err)
+	}
+
+	erasure, err := st.EraseCall(ctx, "c1", "hashed-c1")
+	if err != nil {
+		t.Fatalf("EraseCall() error = %v", err)
+	}
+	want := Erasure{Calls: 1, Sessions: 1, Recordings: 1, AuditEntries: 2}
+	if *erasure != want {
+		t.Errorf("EraseCall() = %+v, want %+v", *erasure, want)
+	}
+	if _, err := st.GetCall(ctx, "c1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected c1 to be erased, got %v", err)
+	}
+	if entries, _ := st.ListAudit(ctx, 10); len(entries) != 1 || entries[0].Target != "c2" {
+		t.Errorf("unexpected audit entries after erasure: %+v", entries)
+	}
+
+	if err := st.ReleaseLegalHold(ctx, "c2"); err != nil {
+		t.Fatalf("ReleaseLegalHold() error = %v", err)
+	}
+	if _, err := st.EraseCall(ctx, "c2"); err != nil {
+		t.Errorf("EraseCall() after release error = %v", err)
+	}
+}
+
+// TestConcurrentMigrations starts several replicas against one Postgres
+// database at once, as a rolling deploy does. Point STORE_POSTGRES_DSN at
+// an empty database to run it.
+func TestConcurrentMigrations(t *testing.T) {
+	dsn := os.Getenv("STORE_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("STORE_POSTGRES_DSN not set")
+	}
+	ctx := context.Background()
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			st, err := Open(ctx, "postgres", dsn)
+			if err == nil {
+				st.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Open() error = %v", err)
+		}
+	}
+
+	st, err := Open(ctx, "postgres", dsn)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+	info, err := st.SchemaInfo(ctx)
+	if err != nil {
+		t.Fatalf("SchemaInfo() error = %v", err)
+	}
+	if info.Version != info.Latest || len(info.Migrations) != info.Latest {
+		t.Errorf("unexpected schema info %+v", info)
+	}
+}
+
+// Concurrent writes, as the API, the call feed and the elector make them,
+// wait for SQLite's write lock instead of failing busy.
+func TestSQLiteConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	st, err := Open(ctx, "sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer st.Close()
+
+	errs := make(chan error, 16)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			for j := 0; j < 50; j++ {
+				if err := st.AppendAudit(ctx, AuditEntry{Time: time.Now(), Actor: "test", Action: "probe", Target: "c1"}); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := st.AcquireLease(ctx, "leader", "holder", time.Minute); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent write error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Package systemd implements the sd_notify protocol so the service reports
+// readiness and watchdog keep-alives when run under systemd.
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends state to the socket in NOTIFY_SOCKET. It is a no-op when the
+// process is not supervised by systemd.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Ready reports that startup finished.
+func Ready() error {
+	return Notify("READY=1")
+}
+
+// Stopping reports that shutdown started.
+func Stopping() error {
+	return Notify("STOPPING=1")
+}
+
+// WatchdogInterval returns the interval configured with WatchdogSec=, or zero
+// when the watchdog is disabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog pings the watchdog at half its interval for as long as healthy
+// returns nil, so a hung health check lets systemd restart the service.
+func RunWatchdog(ctx context.Context, healthy func(ctx context.Context) error) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, interval/2)
+			err := healthy(checkCtx)
+			cancel()
+			if err == nil {
+				Notify("WATCHDOG=1")
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+// Store routes call history to the store of the call's tenant. Cluster state
+// (instances, leases) and the history of tenants without a dedicated store
+// live in the shared store.
+type Store struct {
+	reg       *Registry
+	shared    store.Store
+	dedicated map[string]store.Store
+}
+
+// OpenStore opens the dedicated store of every tenant that configures one.
+func OpenStore(ctx context.Context, reg *Registry, shared store.Store) (*Store, error) {
+	s := &Store{reg: reg, shared: shared, dedicated: make(map[string]store.Store)}
+	for _, t := range reg.Tenants() {
+		if t.StoreDriver == "" {
+			continue
+		}
+		st, err := store.Open(ctx, t.StoreDriver, t.StoreDSN)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("tenant %q: %w", t.Name, err)
+		}
+		s.dedicated[t.Name] = st
+	}
+	return s, nil
+}
+
+// forCall returns the store holding callID's history. Calls matching no
+// tenant are refused so their data never lands in another region.
+func (s *Store) forCall(callID string) (store.Store, error) {
+	t, err := s.reg.Resolve(callID)
+	if err != nil {
+		return nil, err
+	}
+	if st, ok := s.dedicated[t.Name]; ok {
+		return st, nil
+	}
+	return s.shared, nil
+}
+
+func (s *Store) all() []store.Store {
+	stores := []store.Store{s.shared}
+	for _, st := range s.dedicated {
+		stores = append(stores, st)
+	}
+	return stores
+}
+
+func (s *Store) SaveCall(ctx context.Context, call store.CallRecord) error {
+	st, err := s.forCall(call.CallID)
+	if err != nil {
+		return err
+	}
+	return st.SaveCall(ctx, call)
+}
+
+func (s *Store) GetCall(ctx context.Context, callID string) (*store.CallRecord, error) {
+	st, err := s.forCall(callID)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetCall(ctx, callID)
+}
+
+func (s *Store) ListCalls(ctx context.Context, limit int) ([]store.CallRecord, error) {
+	calls := []store.CallRecord{}
+	for _, st := range s.all() {
+		part, err := st.ListCalls(ctx, limit)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, part...)
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].LastSeen.After(calls[j].LastSeen) })
+	if len(calls) > limit {
+		calls = calls[:limit]
+	}
+	return calls, nil
+}
+
+func (s *Store) AddCallTalk(ctx context.Context, callID string, talk store.CallTalk) error {
+	st, err := s.forCall(callID)
+	if err != nil {
+		return err
+	}
+	return st.AddCallTalk(ctx, callID, talk)
+}
+
+func (s *Store) SaveSession(ctx context.Context, sess store.SessionRecord) error {
+	st, err := s.forCall(sess.CallID)
+	if err != nil {
+		return err
+	}
+	return st.SaveSession(ctx, sess)
+}
+
+// EndSession is applied to every store since sessions are keyed by ID only.
+func (s *Store) EndSession(ctx context.Context, sessionID string, endedAt time.Time) error {
+	for _, st := range s.all() {
+		if err := st.EndSession(ctx, sessionID, endedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) ListSessions(ctx context.Context, callID string) ([]store.SessionRecord, error) {
+	st, err := s.forCall(callID)
+	if err != nil {
+		return nil, err
+	}
+	return st.ListSessions(ctx, callID)
+}
+
+func (s *Store) SaveClientStats(ctx context.Context, stats store.ClientStatsRecord) error {
+	st, err := s.forCall(stats.CallID)
+	if err != nil {
+		return err
+	}
+	return st.SaveClientStats(ctx, stats)
+}
+
+// ListClientStats looks the session up in every store since sessions are
+// keyed by ID only.
+func (s *Store) ListClientStats(ctx context.Context, sessionID string, limit int) ([]store.ClientStatsRecord, error) {
+	for _, st := range s.all() {
+		list, err := st.ListClientStats(ctx, sessionID, limit)
+		if err != nil || len(list) > 0 {
+			return list, err
+		}
+	}
+	return []store.ClientStatsRecord{}, nil
+}
+
+func (s *Store) SaveRecording(ctx context.Context, rec store.RecordingRecord) error {
+	st, err := s.forCall(rec.CallID)
+	if err != nil {
+		return err
+	}
+	return st.SaveRecording(ctx, rec)
+}
+
+func (s *Store) ListRecordings(ctx context.Context, callID string) ([]store.RecordingRecord, error) {
+	st, err := s.forCall(callID)
+	if err != nil {
+		return nil, err
+	}
+	return st.ListRecordings(ctx, callID)
+}
+
+// AppendAudit stores entries targeting a call with the call's tenant and
+// everything else in the shared store.
+func (s *Store) AppendAudit(ctx context.Context, entry store.AuditEntry) error {
+	st, err := s.forCall(entry.Target)
+	if err != nil || entry.Target == "" {
+		st = s.shared
+	}
+	return st.AppendAudit(ctx, entry)
+}
+
+func (s *Store) ListAudit(ctx context.Context, limit int) ([]store.AuditEntry, error) {
+	entries := []store.AuditEntry{}
+	for _, st := range s.all() {
+		part, err := st.ListAudit(ctx, limit)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, part...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (s *Store) Heartbeat(ctx context.Context, inst store.Instance) error {
+	return s.shared.Heartbeat(ctx, inst)
+}
+
+func (s *Store) ListInstances(ctx context.Context, since time.Time) ([]store.Instance, error) {
+	return s.shared.ListInstances(ctx, since)
+}
+
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	return s.shared.AcquireLease(ctx, name, holder, ttl)
+}
+
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string) error {
+	return s.shared.ReleaseLease(ctx, name, holder)
+}
+
+func (s *Store) GetPreferences(ctx context.Context, user string) (*store.Preferences, error) {
+	return s.shared.GetPreferences(ctx, user)
+}
+
+func (s *Store) SavePreferences(ctx context.Context, prefs store.Preferences) error {
+	return s.shared.SavePreferences(ctx, prefs)
+}
+
+func (s *Store) PlaceLegalHold(ctx context.Context, hold store.LegalHold) error {
+	st, err := s.forCall(hold.CallID)
+	if err != nil {
+		return err
+	}
+	return st.PlaceLegalHold(ctx, hold)
+}
+
+func (s *Store) ReleaseLegalHold(ctx context.Context, callID string) error {
+	st, err := s.forCall(callID)
+	if err != nil {
+		return err
+	}
+	return st.ReleaseLegalHold(ctx, callID)
+}
+
+// EraseCall erases the call from its tenant store, then from the shared store
+// where audit references without a resolvable target end up.
+func (s *Store) EraseCall(ctx context.Context, callID string, auditTargets ...string) (*store.Erasure, error) {
+	st, err := s.forCall(callID)
+	if err != nil {
+		return nil, err
+	}
+	erased, err := st.EraseCall(ctx, callID, auditTargets...)
+	if err != nil || st == s.shared {
+		return erased, err
+	}
+
+	shared, err := s.shared.EraseCall(ctx, callID, auditTargets...)
+	if err != nil {
+		return nil, err
+	}
+	erased.Calls += shared.Calls
+	erased.Sessions += shared.Sessions
+	erased.ClientStats += shared.ClientStats
+	erased.Recordings += shared.Recordings
+	erased.AuditEntries += shared.AuditEntries
+	return erased, nil
+}
+
+func (s *Store) SchemaInfo(ctx context.Context) (*store.SchemaInfo, error) {
+	return s.shared.SchemaInfo(ctx)
+}
+
+// Close closes the dedicated tenant stores. The shared store is owned by the
+// caller.
+func (s *Store) Close() error {
+	var firstErr error
+	for _, st := range s.dedicated {
+		if err := st.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,124 @@
+// Package tenant assigns calls to tenants and keeps each tenant's recordings
+// and history in the storage configured for its data residency region.
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/quota"
+)
+
+// ErrNoTenant is returned when a call matches no tenant and no default tenant
+// is configured.
+var ErrNoTenant = errors.New("call matches no tenant")
+
+// Tenant describes where the data of a group of calls may be stored.
+type Tenant struct {
+	Name string `json:"name"`
+	// Region labels the residency region, e.g. "eu-west-1".
+	Region string `json:"region"`
+	// CallIDPrefixes select the tenant's calls. The longest matching prefix
+	// across all tenants wins.
+	CallIDPrefixes []string `json:"call_id_prefixes"`
+	// Default receives calls that match no prefix.
+	Default bool `json:"default"`
+
+	// StoreDriver and StoreDSN select the tenant's history database, e.g. a
+	// Postgres DSN with search_path set to the tenant schema.
+	StoreDriver string `json:"store_driver"`
+	StoreDSN    string `json:"store_dsn"`
+
+	// RecordingPath is passed to rtpengine as the recording directory, e.g. a
+	// mount backed by an S3 bucket in the tenant's region.
+	RecordingPath string `json:"recording_path"`
+
+	// APIKeys are the API keys issued to the tenant. Their requests and spy
+	// minutes count against Quota.
+	APIKeys []string     `json:"api_keys"`
+	Quota   quota.Limits `json:"quota"`
+}
+
+// Registry resolves calls to tenants.
+type Registry struct {
+	tenants []*Tenant
+	def     *Tenant
+	byKey   map[string]*Tenant
+}
+
+// Load reads a JSON array of tenants from path.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []*Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("invalid tenants file %s: %w", path, err)
+	}
+	return NewRegistry(tenants)
+}
+
+// NewRegistry validates tenants and builds a registry.
+func NewRegistry(tenants []*Tenant) (*Registry, error) {
+	r := &Registry{tenants: tenants, byKey: make(map[string]*Tenant)}
+	names := make(map[string]bool, len(tenants))
+	for _, t := range tenants {
+		if t.Name == "" {
+			return nil, fmt.Errorf("tenant name is required")
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("duplicate tenant %q", t.Name)
+		}
+		names[t.Name] = true
+		if (t.StoreDriver == "") != (t.StoreDSN == "") {
+			return nil, fmt.Errorf("tenant %q: store_driver and store_dsn must be set together", t.Name)
+		}
+		for _, key := range t.APIKeys {
+			if other, ok := r.byKey[key]; ok {
+				return nil, fmt.Errorf("API key of tenant %q is also issued to %q", t.Name, other.Name)
+			}
+			r.byKey[key] = t
+		}
+		if t.Default {
+			if r.def != nil {
+				return nil, fmt.Errorf("tenants %q and %q are both default", r.def.Name, t.Name)
+			}
+			r.def = t
+		}
+	}
+	return r, nil
+}
+
+// Tenants returns every configured tenant.
+func (r *Registry) Tenants() []*Tenant {
+	return r.tenants
+}
+
+// ForAPIKey returns the tenant an API key is issued to, or nil.
+func (r *Registry) ForAPIKey(key string) *Tenant {
+	return r.byKey[key]
+}
+
+// Resolve returns the tenant owning callID.
+func (r *Registry) Resolve(callID string) (*Tenant, error) {
+	var best *Tenant
+	bestLen := -1
+	for _, t := range r.tenants {
+		for _, prefix := range t.CallIDPrefixes {
+			if len(prefix) > bestLen && strings.HasPrefix(callID, prefix) {
+				best, bestLen = t, len(prefix)
+			}
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	if r.def != nil {
+		return r.def, nil
+	}
+	return nil, ErrNoTenant
+}
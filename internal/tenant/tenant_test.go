@@ -0,0 +1,131 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/store"
+)
+
+func TestResolve(t *testing.T) {
+	reg, err := NewRegistry([]*Tenant{
+		{Name: "eu", CallIDPrefixes: []string{"eu-"}},
+		{Name: "eu-de", CallIDPrefixes: []string{"eu-de-"}},
+		{Name: "us", CallIDPrefixes: []string{"us-"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	tests := []struct {
+		callID string
+		want   string
+	}{
+		{callID: "eu-123", want: "eu"},
+		{callID: "eu-de-123", want: "eu-de"},
+		{callID: "us-123", want: "us"},
+	}
+	for _, tt := range tests {
+		got, err := reg.Resolve(tt.callID)
+		if err != nil || got.Name != tt.want {
+			t.Errorf("Resolve(%q) = %v, %v, want %s", tt.callID, got, err, tt.want)
+		}
+	}
+	if _, err := reg.Resolve("apac-123"); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+}
+
+func TestForAPIKey(t *testing.T) {
+	reg, err := NewRegistry([]*Tenant{
+		{Name: "eu", APIKeys: []string{"k1", "k2"}},
+		{Name: "us", APIKeys: []string{"k3"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	if got := reg.ForAPIKey("k2"); got == nil || got.Name != "eu" {
+		t.Errorf("ForAPIKey(k2) = %v, want eu", got)
+	}
+	if got := reg.ForAPIKey("unknown"); got != nil {
+		t.Errorf("ForAPIKey(unknown) = %v, want nil", got)
+	}
+
+	if _, err := NewRegistry([]*Tenant{
+		{Name: "eu", APIKeys: []string{"k1"}},
+		{Name: "us", APIKeys: []string{"k1"}},
+	}); err == nil {
+		t.Error("expected error for an API key issued to two tenants")
+	}
+}
+
+func TestNewRegistryValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []*Tenant
+	}{
+		{name: "missing name", tenants: []*Tenant{{}}},
+		{name: "duplicate", tenants: []*Tenant{{Name: "eu"}, {Name: "eu"}}},
+		{name: "two defaults", tenants: []*Tenant{{Name: "eu", Default: true}, {Name: "us", Default: true}}},
+		{name: "driver without dsn", tenants: []*Tenant{{Name: "eu", StoreDriver: "sqlite"}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewRegistry(tt.tenants); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestStoreRouting(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	shared, err := store.Open(ctx, "sqlite", filepath.Join(dir, "shared.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer shared.Close()
+
+	reg, err := NewRegistry([]*Tenant{
+		{Name: "eu", CallIDPrefixes: []string{"eu-"}, StoreDriver: "sqlite", StoreDSN: filepath.Join(dir, "eu.db")},
+		{Name: "us", Default: true},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	st, err := OpenStore(ctx, reg, shared)
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	defer st.Close()
+
+	now := time.Now()
+	for _, callID := range []string{"eu-1", "us-1"} {
+		if err := st.SaveCall(ctx, store.CallRecord{CallID: callID, FirstSeen: now, LastSeen: now}); err != nil {
+			t.Fatalf("SaveCall(%s) error = %v", callID, err)
+		}
+	}
+
+	if _, err := shared.GetCall(ctx, "eu-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("EU call leaked into the shared store: %v", err)
+	}
+	if _, err := st.dedicated["eu"].GetCall(ctx, "eu-1"); err != nil {
+		t.Errorf("EU call missing from the EU store: %v", err)
+	}
+	if _, err := shared.GetCall(ctx, "us-1"); err != nil {
+		t.Errorf("US call missing from the shared store: %v", err)
+	}
+
+	calls, err := st.ListCalls(ctx, 10)
+	if err != nil || len(calls) != 2 {
+		t.Errorf("ListCalls() = %+v, %v, want both calls", calls, err)
+	}
+
+	erased, err := st.EraseCall(ctx, "eu-1")
+	if err != nil || erased.Calls != 1 {
+		t.Errorf("EraseCall() = %+v, %v", erased, err)
+	}
+}
@@ -0,0 +1,114 @@
+package watermark
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"time"
+)
+
+// Detect recovers the payload marked into samples, 8kHz audio at least
+// MessageDuration long that may start anywhere in the message. It reports
+// false when no mark made with k is found.
+func (k *Key) Detect(samples []int16) (Payload, bool) {
+	if len(samples) < (messageBits+1)*FrameSize {
+		return Payload{}, false
+	}
+	filtered := highPass(samples)
+	var chips [FrameSize]float64
+	for i := range chips {
+		prev := 0.0
+		if i > 0 {
+			prev = k.chips[i-1]
+		}
+		chips[i] = k.chips[i] - preEmphasis*prev
+	}
+
+	// Try every alignment of frames to samples and of the message to the
+	// frames, scoring each by how strongly the repetitions of the sync word
+	// add up.
+	var best [messageBits]float64
+	bestScore := 0.0
+	for offset := 0; offset < FrameSize; offset++ {
+		frames := frameCorrelations(filtered[offset:], &chips)
+		for start := 0; start < messageBits; start++ {
+			var acc [messageBits]float64
+			for f, c := range frames {
+				acc[(f+start)%messageBits] += c
+			}
+			score := 0.0
+			for i := 0; i < syncBits; i++ {
+				score += acc[i] * k.scramble[i] * syncSign(i)
+			}
+			if score > bestScore {
+				bestScore, best = score, acc
+			}
+		}
+	}
+	if bestScore == 0 {
+		return Payload{}, false
+	}
+	return k.decode(best)
+}
+
+// preEmphasis is the coefficient of the high-pass filter applied before
+// correlating. Speech has most of its energy at low frequencies while the
+// mark is white, so filtering the audio raises the mark above it.
+const preEmphasis = 0.95
+
+func highPass(samples []int16) []float64 {
+	out := make([]float64, len(samples))
+	prev := 0.0
+	for i, s := range samples {
+		out[i] = float64(s) - preEmphasis*prev
+		prev = float64(s)
+	}
+	return out
+}
+
+// frameCorrelations correlates each whole frame of samples with chips,
+// normalized by the frame's level so loud passages do not outweigh the rest.
+func frameCorrelations(samples []float64, chips *[FrameSize]float64) []float64 {
+	frames := make([]float64, len(samples)/FrameSize)
+	for f := range frames {
+		frame := samples[f*FrameSize : (f+1)*FrameSize]
+		var c, energy float64
+		for i, s := range frame {
+			c += s * chips[i]
+			energy += s * s
+		}
+		if energy > 0 {
+			c /= math.Sqrt(energy)
+		}
+		frames[f] = c
+	}
+	return frames
+}
+
+func syncSign(i int) float64 {
+	if syncWord>>(syncBits-1-i)&1 == 1 {
+		return 1
+	}
+	return -1
+}
+
+// decode reads the message from the accumulated correlations of its bits,
+// checking the sync word and the checksum.
+func (k *Key) decode(acc [messageBits]float64) (Payload, bool) {
+	var b [messageBytes]byte
+	for i, c := range acc {
+		if c*k.scramble[i] > 0 {
+			b[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	if binary.BigEndian.Uint16(b[0:]) != syncWord {
+		return Payload{}, false
+	}
+	if binary.BigEndian.Uint16(b[22:]) != uint16(crc32.ChecksumIEEE(b[2:22])) {
+		return Payload{}, false
+	}
+	var p Payload
+	copy(p.ID[:], b[2:18])
+	p.Issued = time.Unix(int64(binary.BigEndian.Uint32(b[18:])), 0)
+	return p, true
+}
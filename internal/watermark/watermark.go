@@ -0,0 +1,165 @@
+// Package watermark embeds an inaudible mark identifying a listener into
+// 8kHz audio and recovers it from a leaked copy.
+//
+// The mark is spread-spectrum: every 20ms frame carries one bit of the
+// message as a low-level pseudo-random noise, added or subtracted, whose
+// level follows the audio so that speech masks it. The message is a sync
+// word, the payload and a checksum, repeated for as long as the audio lasts;
+// detection correlates the audio with the noise and adds up the repetitions,
+// so longer excerpts are recovered more reliably. The noise and the order of
+// the bits derive from a secret key, without which the mark can neither be
+// read nor removed.
+package watermark
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"sync"
+	"time"
+)
+
+// SampleRate is the rate of the audio the mark is embedded in and detected
+// from, that of G.711.
+const SampleRate = 8000
+
+// FrameSize is the number of samples carrying one bit, 20ms.
+const FrameSize = 160
+
+const (
+	// syncWord starts every message.
+	syncWord = 0xB38F
+	// messageBytes is the sync word, the payload ID, the issue time and a
+	// checksum: 192 bits, 3.84s of audio.
+	messageBytes = 2 + 16 + 4 + 2
+	messageBits  = messageBytes * 8
+	syncBits     = 16
+)
+
+// MessageDuration is the length of audio one copy of the message takes;
+// detection needs at least this much.
+const MessageDuration = messageBits * FrameSize * time.Second / SampleRate
+
+// minAmplitude is the level of the mark in silence, about -72dBFS.
+const minAmplitude = 8
+
+// Payload is what a mark identifies: who the audio was produced for and
+// when.
+type Payload struct {
+	ID     [16]byte
+	Issued time.Time
+}
+
+// Key is a secret the marks are embedded and detected with.
+type Key struct {
+	chips    [FrameSize]float64
+	scramble [messageBits]float64
+}
+
+// NewKey derives a key from secret.
+func NewKey(secret string) *Key {
+	k := &Key{}
+	stream := keyStream(secret)
+	for i := range k.chips {
+		k.chips[i] = stream()
+	}
+	for i := range k.scramble {
+		k.scramble[i] = stream()
+	}
+	return k
+}
+
+// keyStream returns a generator of ±1 values derived from secret.
+func keyStream(secret string) func() float64 {
+	var block []byte
+	var counter uint64
+	bit := 0
+	return func() float64 {
+		if bit == len(block)*8 {
+			mac := hmac.New(sha256.New, []byte(secret))
+			binary.Write(mac, binary.BigEndian, counter)
+			block = mac.Sum(nil)
+			counter++
+			bit = 0
+		}
+		v := block[bit/8] >> (bit % 8) & 1
+		bit++
+		if v == 1 {
+			return 1
+		}
+		return -1
+	}
+}
+
+// message returns the signs of the bits of p's message, scrambled with the
+// key.
+func (k *Key) message(p Payload) [messageBits]float64 {
+	var b [messageBytes]byte
+	binary.BigEndian.PutUint16(b[0:], syncWord)
+	copy(b[2:], p.ID[:])
+	binary.BigEndian.PutUint32(b[18:], uint32(p.Issued.Unix()))
+	binary.BigEndian.PutUint16(b[22:], uint16(crc32.ChecksumIEEE(b[2:22])))
+
+	var bits [messageBits]float64
+	for i := range bits {
+		bits[i] = -k.scramble[i]
+		if b[i/8]>>(7-i%8)&1 == 1 {
+			bits[i] = k.scramble[i]
+		}
+	}
+	return bits
+}
+
+// Embedder marks one stream of audio with a payload. It is safe for
+// concurrent use.
+type Embedder struct {
+	key  *Key
+	bits [messageBits]float64
+
+	mu sync.Mutex
+	// pos is the number of samples marked so far.
+	pos int
+}
+
+// NewEmbedder creates an embedder marking audio with p.
+func (k *Key) NewEmbedder(p Payload) *Embedder {
+	return &Embedder{key: k, bits: k.message(p)}
+}
+
+// Mark adds the mark to samples in place, continuing the message where the
+// previous call left off. Samples are best passed one packet at a time, as
+// the level of the mark follows that of each call's samples.
+func (e *Embedder) Mark(samples []int16) {
+	amplitude := level(samples) / 50
+	if amplitude < minAmplitude {
+		amplitude = minAmplitude
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, s := range samples {
+		chip := e.key.chips[e.pos%FrameSize] * e.bits[(e.pos/FrameSize)%messageBits]
+		v := float64(s) + chip*amplitude
+		switch {
+		case v > 32767:
+			v = 32767
+		case v < -32768:
+			v = -32768
+		}
+		samples[i] = int16(v)
+		e.pos++
+	}
+}
+
+// level returns the RMS level of samples.
+func level(samples []int16) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
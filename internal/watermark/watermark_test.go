@@ -0,0 +1,80 @@
+package watermark
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// speech returns d of speech-like audio: a few harmonics whose level rises
+// and falls like syllables, pauses and some background noise.
+func speech(d time.Duration, rng *rand.Rand) []int16 {
+	samples := make([]int16, int(d.Seconds()*SampleRate))
+	for i := range samples {
+		t := float64(i) / SampleRate
+		envelope := math.Max(0, math.Sin(2*math.Pi*3*t)) * (0.5 + 0.5*math.Sin(2*math.Pi*0.2*t))
+		v := 0.0
+		for h, f := range []float64{140, 280, 420, 700, 1100} {
+			v += math.Sin(2*math.Pi*f*t) / float64(h+1)
+		}
+		samples[i] = int16(6000*envelope*v + 40*rng.NormFloat64())
+	}
+	return samples
+}
+
+// g711 quantizes samples like a μ-law round trip does.
+func g711(samples []int16) {
+	const mu = 255.0
+	for i, s := range samples {
+		x := float64(s) / 32768
+		y := math.Copysign(math.Log1p(mu*math.Abs(x))/math.Log1p(mu), x)
+		y = math.Round(y*127) / 127
+		samples[i] = int16(math.Copysign((math.Pow(1+mu, math.Abs(y))-1)/mu, y) * 32767)
+	}
+}
+
+func TestMarkAndDetect(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	key := NewKey("secret")
+	want := Payload{ID: [16]byte{0xde, 0xad, 0xbe, 0xef, 15: 1}, Issued: time.Unix(1760000000, 0)}
+
+	audio := speech(20*time.Second, rng)
+	original := append([]int16(nil), audio...)
+	e := key.NewEmbedder(want)
+	for i := 0; i < len(audio); i += FrameSize {
+		e.Mark(audio[i:min(i+FrameSize, len(audio))])
+	}
+
+	// The mark stays far below the audio.
+	var signal, noise float64
+	for i := range audio {
+		signal += float64(original[i]) * float64(original[i])
+		d := float64(audio[i]) - float64(original[i])
+		noise += d * d
+	}
+	if snr := 10 * math.Log10(signal/noise); snr < 30 {
+		t.Errorf("mark is %.1fdB below the audio, want at least 30dB", snr)
+	}
+
+	// A G.711 copy starting in the middle of a message and of a frame.
+	excerpt := append([]int16(nil), audio[3*SampleRate+57:]...)
+	g711(excerpt)
+	got, ok := key.Detect(excerpt)
+	if !ok {
+		t.Fatal("Detect() found no mark")
+	}
+	if got != want {
+		t.Errorf("Detect() = %+v, want %+v", got, want)
+	}
+
+	if _, ok := NewKey("other").Detect(excerpt); ok {
+		t.Error("Detect() with another key found a mark")
+	}
+	if _, ok := key.Detect(original); ok {
+		t.Error("Detect() found a mark in unmarked audio")
+	}
+	if _, ok := key.Detect(audio[:SampleRate]); ok {
+		t.Error("Detect() found a mark in less than one message")
+	}
+}
@@ -0,0 +1,170 @@
+// Package monitor exposes call listing and spy session management for Go
+// services that embed rtpengine-mon instead of running the standalone binary.
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/api"
+	"github.com/civilcoder55/rtpengine-mon/internal/config"
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+	"github.com/civilcoder55/rtpengine-mon/internal/spy"
+)
+
+// Aliases so embedders can name the types passed to lifecycle hooks.
+type (
+	Source      = spy.Source
+	Session     = spy.Session
+	SessionHook = spy.SessionHook
+	SourceHook  = spy.SourceHook
+)
+
+// SpySession is the result of starting a spy session. The SDP offer must be
+// answered by the browser through AnswerSpySession.
+type SpySession struct {
+	ID      string
+	SDP     string
+	FromTag string
+	ToTag   string
+}
+
+// Option configures a Monitor.
+type Option func(*options)
+
+type options struct {
+	cfg         *config.Config
+	iceListener net.Listener
+}
+
+// WithRTPEngineAddr sets the address of the rtpengine NG control socket.
+func WithRTPEngineAddr(addr string) Option {
+	return func(o *options) { o.cfg.RTPEngineAddr = addr }
+}
+
+// WithPortRange sets the UDP port range used for backend WebRTC subscriptions.
+func WithPortRange(min, max uint16) Option {
+	return func(o *options) {
+		o.cfg.WebRTCMinPort = min
+		o.cfg.WebRTCMaxPort = max
+	}
+}
+
+// WithNAT1To1IPs sets the IPs advertised to rtpengine for backend subscriptions.
+func WithNAT1To1IPs(ips ...string) Option {
+	return func(o *options) { o.cfg.WebRTCNAT1To1IPs = ips }
+}
+
+// WithICETCPListener sets the listener browsers reach over ICE-TCP. Without
+// it browser sessions gather regular UDP candidates.
+func WithICETCPListener(l net.Listener) Option {
+	return func(o *options) { o.iceListener = l }
+}
+
+// Monitor is an embeddable rtpengine monitor.
+type Monitor struct {
+	rtpClient  rtpengine.Client
+	spyService *spy.Service
+	handler    *api.Handler
+}
+
+// New connects to rtpengine and prepares the spy service.
+func New(opts ...Option) (*Monitor, error) {
+	o := &options{cfg: config.Default()}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	rtpClient, err := rtpengine.NewClient(o.cfg.RTPEngineAddr,
+		rtpengine.WithTransport(o.cfg.RTPEngineTransport),
+		rtpengine.WithEncoding(o.cfg.RTPEngineEncoding),
+		rtpengine.WithQueryCache(o.cfg.RTPEngineQueryCacheTTL),
+		rtpengine.WithRateLimit(o.cfg.RTPEngineRateLimit, o.cfg.RTPEngineRateBurst),
+		rtpengine.WithSockets(o.cfg.RTPEngineSockets),
+		rtpengine.WithRetryPolicy(rtpengine.RetryPolicy{
+			Timeout:         o.cfg.RTPEngineTimeout,
+			CommandTimeouts: o.cfg.RTPEngineCommandTimeouts,
+			Retries:         o.cfg.RTPEngineRetries,
+			Backoff:         o.cfg.RTPEngineRetryBackoff,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("rtpengine client init failed: %w", err)
+	}
+
+	spyService, err := spy.NewService(o.cfg, rtpClient, o.iceListener)
+	if err != nil {
+		rtpClient.Close()
+		return nil, fmt.Errorf("spy service init failed: %w", err)
+	}
+
+	return &Monitor{
+		rtpClient:  rtpClient,
+		spyService: spyService,
+		handler:    api.NewHandler(rtpClient, spyService, nil),
+	}, nil
+}
+
+// ListCalls returns the call IDs currently known to rtpengine.
+func (m *Monitor) ListCalls(ctx context.Context) ([]string, error) {
+	return m.rtpClient.ListCalls(ctx, rtpengine.ListOptions{})
+}
+
+// QueryCall returns the raw rtpengine query response for a call.
+func (m *Monitor) QueryCall(ctx context.Context, callID string) (map[string]interface{}, error) {
+	return m.rtpClient.QueryCall(ctx, callID)
+}
+
+// Statistics returns the raw rtpengine statistics response.
+func (m *Monitor) Statistics(ctx context.Context) (map[string]interface{}, error) {
+	return m.rtpClient.Statistics(ctx)
+}
+
+// StartSpySession subscribes to a call and returns a WebRTC offer for the
+// browser. Empty tags are detected from the call.
+func (m *Monitor) StartSpySession(ctx context.Context, callID, fromTag, toTag string) (*SpySession, error) {
+	id, sdp, fromTag, toTag, err := m.spyService.StartSpySession(ctx, callID, fromTag, toTag)
+	if err != nil {
+		return nil, err
+	}
+	return &SpySession{ID: id, SDP: sdp, FromTag: fromTag, ToTag: toTag}, nil
+}
+
+// AnswerSpySession applies the browser's SDP answer to a spy session.
+func (m *Monitor) AnswerSpySession(ctx context.Context, sessionID, sdp string) error {
+	return m.spyService.HandleSpyAnswer(ctx, sessionID, sdp)
+}
+
+// OnSessionCreated registers a hook run after a browser session is created.
+func (m *Monitor) OnSessionCreated(fn SessionHook) { m.spyService.OnSessionCreated(fn) }
+
+// OnSessionClosed registers a hook run after a browser session is removed.
+func (m *Monitor) OnSessionClosed(fn SessionHook) { m.spyService.OnSessionClosed(fn) }
+
+// OnSourceCreated registers a hook run after a call source is subscribed.
+func (m *Monitor) OnSourceCreated(fn SourceHook) { m.spyService.OnSourceCreated(fn) }
+
+// OnSourceClosed registers a hook run after a call source is torn down.
+func (m *Monitor) OnSourceClosed(fn SourceHook) { m.spyService.OnSourceClosed(fn) }
+
+// RegisterRoutes mounts the JSON API used by the bundled dashboard on mux.
+func (m *Monitor) RegisterRoutes(mux *http.ServeMux) {
+	m.handler.RegisterRoutes(mux)
+}
+
+// closeTimeout bounds how long Close waits for rtpengine to release the
+// subscriptions of the monitor.
+const closeTimeout = 5 * time.Second
+
+// Close ends every spy session, releases the monitor's rtpengine
+// subscriptions and then the rtpengine control socket.
+func (m *Monitor) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	err := m.spyService.Close(ctx)
+	return errors.Join(err, m.rtpClient.Close())
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/civilcoder55/rtpengine-mon/pkg/rtpenginetest"
+)
+
+func TestMonitor(t *testing.T) {
+	engine, err := rtpenginetest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	engine.AddCall(rtpenginetest.Call{ID: "call-1", Tags: []rtpenginetest.Tag{{Tag: "caller"}, {Tag: "callee"}}})
+
+	m, err := New(WithRTPEngineAddr(engine.Addr()), WithPortRange(40000, 40100))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	calls, err := m.ListCalls(ctx)
+	if err != nil || !slices.Equal(calls, []string{"call-1"}) {
+		t.Fatalf("ListCalls() = %v, %v", calls, err)
+	}
+	call, err := m.QueryCall(ctx, "call-1")
+	if err != nil || call["tags"] == nil {
+		t.Fatalf("QueryCall() = %v, %v", call, err)
+	}
+	if _, err := m.Statistics(ctx); err != nil {
+		t.Errorf("Statistics() error = %v", err)
+	}
+
+	created := make(chan string, 2)
+	m.OnSourceCreated(func(source *Source) { created <- "source " + source.CallID })
+	m.OnSessionCreated(func(_ *Source, sess *Session) { created <- "session " + sess.CallID })
+
+	sess, err := m.StartSpySession(ctx, "call-1", "", "")
+	if err != nil {
+		t.Fatalf("StartSpySession() error = %v", err)
+	}
+	if sess.ID == "" || !strings.Contains(sess.SDP, "m=audio") || sess.FromTag != "caller" || sess.ToTag != "callee" {
+		t.Errorf("StartSpySession() = %+v, want an offer for the detected tags", sess)
+	}
+	if got := engine.Subscriptions("call-1"); len(got) == 0 {
+		t.Error("no rtpengine subscription made for the session")
+	}
+	for _, want := range []string{"source call-1", "session call-1"} {
+		select {
+		case got := <-created:
+			if got != want {
+				t.Errorf("hook %q ran, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("hook %q never ran", want)
+		}
+	}
+	if err := m.AnswerSpySession(ctx, "missing", "v=0\r\n"); err == nil {
+		t.Error("AnswerSpySession() of an unknown session succeeded")
+	}
+
+	mux := http.NewServeMux()
+	m.RegisterRoutes(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calls", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "call-1") {
+		t.Errorf("GET /calls = %d %s", rec.Code, rec.Body)
+	}
+
+	// Closing the monitor ends the session and hands the subscriptions
+	// back to rtpengine.
+	closed := make(chan string, 2)
+	m.OnSessionClosed(func(_ *Source, sess *Session) { closed <- "session " + sess.ID })
+	m.OnSourceClosed(func(source *Source) { closed <- "source " + source.CallID })
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := engine.Subscriptions("call-1"); len(got) != 0 {
+		t.Errorf("subscriptions left after Close() = %v", got)
+	}
+	for _, want := range []string{"session " + sess.ID, "source call-1"} {
+		select {
+		case got := <-closed:
+			if got != want {
+				t.Errorf("hook %q ran, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("hook %q never ran", want)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+// Package rtpenginetest runs a fake rtpengine speaking the NG protocol over
+// UDP, so the monitor can be integration-tested and demoed without a real
+// one. Calls and their tags are scripted with AddCall; subscriptions are
+// answered with a WebRTC offer for the subscribed tags unless OnSubscribe
+// scripts them otherwise. No media flows.
+package rtpenginetest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackpal/bencode-go"
+)
+
+// defaultListLimit is how many calls list returns without a limit, as in
+// rtpengine.
+const defaultListLimit = 32
+
+// Call is a scripted call.
+type Call struct {
+	ID string
+	// Created defaults to the time the call is added.
+	Created time.Time
+	Tags    []Tag
+}
+
+// Tag is one party of a scripted call.
+type Tag struct {
+	Tag   string
+	Label string
+	// Codec of the tag's audio; PCMU when empty.
+	Codec string
+}
+
+// Request is an NG request the server received.
+type Request struct {
+	Command string
+	Args    map[string]interface{}
+}
+
+// SubscribeFunc answers a subscribe request for the fromTags of a call with
+// the response dictionary, which must carry "sdp" and "to-tag", or with an
+// error sent back as an rtpengine error.
+type SubscribeFunc func(callID string, fromTags []string) (map[string]interface{}, error)
+
+// Server is a fake rtpengine. It is safe for concurrent use.
+type Server struct {
+	conn net.PacketConn
+
+	mu        sync.Mutex
+	calls     map[string]*call
+	order     []string
+	subscribe SubscribeFunc
+	requests  []Request
+	nextSub   int
+}
+
+type call struct {
+	Call
+	// subscriptions maps subscription tags to the tags they receive.
+	subscriptions map[string][]string
+	subscribed    map[string]time.Time
+}
+
+// NewServer starts a fake rtpengine on a free local port.
+func NewServer() (*Server, error) {
+	return Listen("127.0.0.1:0")
+}
+
+// Listen starts a fake rtpengine answering NG requests on the UDP address.
+func Listen(addr string) (*Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{conn: conn, calls: make(map[string]*call)}
+	go s.serve()
+	return s, nil
+}
+
+// Addr is the address NG requests are answered on.
+func (s *Server) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// AddCall adds a call, replacing one with the same ID.
+func (s *Server) AddCall(c Call) {
+	if c.Created.IsZero() {
+		c.Created = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.calls[c.ID]; !ok {
+		s.order = append(s.order, c.ID)
+	}
+	s.calls[c.ID] = &call{Call: c, subscriptions: make(map[string][]string), subscribed: make(map[string]time.Time)}
+}
+
+// RemoveCall ends a call.
+func (s *Server) RemoveCall(callID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeCall(callID)
+}
+
+func (s *Server) removeCall(callID string) {
+	delete(s.calls, callID)
+	s.order = slices.DeleteFunc(s.order, func(id string) bool { return id == callID })
+}
+
+// OnSubscribe scripts the answer to subscribe requests; nil restores the
+// default WebRTC offer.
+func (s *Server) OnSubscribe(fn SubscribeFunc) {
+	s.mu.Lock()
+	s.subscribe = fn
+	s.mu.Unlock()
+}
+
+// Subscriptions returns the subscription tags of a call that were not
+// unsubscribed, sorted.
+func (s *Server) Subscriptions(callID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.calls[callID]
+	if !ok {
+		return nil
+	}
+	tags := make([]string, 0, len(c.subscriptions))
+	for tag := range c.subscriptions {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// Requests returns the requests received so far, oldest first. Requests
+// repeated with the same cookie are listed each time.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+func (s *Server) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		cookie, body, ok := bytes.Cut(buf[:n], []byte(" "))
+		if !ok {
+			continue
+		}
+		// Like rtpengine, answer in the encoding of the request.
+		isJSON := len(body) > 0 && body[0] == '{'
+		var decoded interface{}
+		if isJSON {
+			decoded, err = decodeJSON(body)
+		} else {
+			decoded, err = bencode.Decode(bytes.NewReader(body))
+		}
+		args, _ := decoded.(map[string]interface{})
+		var resp map[string]interface{}
+		if err != nil || args == nil {
+			resp = failure("Failed to parse request")
+		} else {
+			resp = s.handle(args)
+		}
+
+		var out bytes.Buffer
+		out.Write(cookie)
+		out.WriteByte(' ')
+		if isJSON {
+			err = json.NewEncoder(&out).Encode(resp)
+		} else {
+			err = bencode.Marshal(&out, resp)
+		}
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(out.Bytes(), addr)
+	}
+}
+
+// decodeJSON decodes a JSON request into the types bencode decodes to.
+func decodeJSON(body []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return integers(v), nil
+}
+
+func integers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	case []interface{}:
+		for i := range v {
+			v[i] = integers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = integers(v[k])
+		}
+	}
+	return v
+}
+
+func failure(reason string) map[string]interface{} {
+	return map[string]interface{}{"result": "error", "error-reason": reason}
+}
+
+func okResult() map[string]interface{} {
+	return map[string]interface{}{"result": "ok"}
+}
+
+func (s *Server) handle(args map[string]interface{}) map[string]interface{} {
+	command, _ := args["command"].(string)
+	callID, _ := args["call-id"].(string)
+	fromTag, _ := args["from-tag"].(string)
+	toTag, _ := args["to-tag"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Command: command, Args: args})
+
+	switch command {
+	case "ping":
+		return map[string]interface{}{"result": "pong"}
+	case "list":
+		limit := defaultListLimit
+		if l, ok := args["limit"].(int64); ok {
+			limit = int(l)
+		}
+		calls := []interface{}{}
+		for _, id := range s.order[:min(limit, len(s.order))] {
+			calls = append(calls, id)
+		}
+		return map[string]interface{}{"result": "ok", "calls": calls}
+	case "statistics":
+		return map[string]interface{}{"result": "ok", "currentstatistics": map[string]interface{}{
+			"sessionsown":     len(s.calls),
+			"sessionsforeign": 0,
+			"sessionstotal":   len(s.calls),
+		}}
+	case "offer", "publish":
+		sdp, _ := args["sdp"].(string)
+		c, ok := s.calls[callID]
+		if !ok {
+			s.order = append(s.order, callID)
+			c = &call{Call: Call{ID: callID, Created: time.Now()}, subscriptions: make(map[string][]string), subscribed: make(map[string]time.Time)}
+			s.calls[callID] = c
+		}
+		c.addTag(fromTag)
+		return map[string]interface{}{"result": "ok", "sdp": sdp}
+	}
+
+	c, ok := s.calls[callID]
+	if !ok {
+		return failure("Unknown call-id")
+	}
+	switch command {
+	case "query":
+		return c.query()
+	case "answer":
+		sdp, _ := args["sdp"].(string)
+		c.addTag(toTag)
+		return map[string]interface{}{"result": "ok", "sdp": sdp}
+	case "delete":
+		s.removeCall(callID)
+		return okResult()
+	case "subscribe request":
+		tags := []string{fromTag}
+		if flags, _ := args["flags"].([]interface{}); slices.Contains(flags, interface{}("all")) {
+			tags = c.tagNames()
+		}
+		for _, tag := range tags {
+			if !c.hasTag(tag) {
+				return failure("Unknown tag")
+			}
+		}
+		if s.subscribe != nil {
+			resp, err := s.subscribe(callID, tags)
+			if err != nil {
+				return failure(err.Error())
+			}
+			if subTag, ok := resp["to-tag"].(string); ok {
+				c.subscriptions[subTag] = tags
+				c.subscribed[subTag] = time.Now()
+			}
+			return resp
+		}
+		subTag := toTag
+		if subTag == "" {
+			s.nextSub++
+			subTag = fmt.Sprintf("subscriber-%d", s.nextSub)
+		}
+		c.subscriptions[subTag] = tags
+		c.subscribed[subTag] = time.Now()
+		fromTags := make([]interface{}, len(tags))
+		for i, tag := range tags {
+			fromTags[i] = tag
+		}
+		return map[string]interface{}{"result": "ok", "sdp": offerSDP(len(tags)), "to-tag": subTag, "from-tags": fromTags}
+	case "subscribe answer", "unsubscribe":
+		if _, ok := c.subscriptions[toTag]; !ok {
+			return failure("Unknown tag")
+		}
+		if command == "unsubscribe" {
+			delete(c.subscriptions, toTag)
+			delete(c.subscribed, toTag)
+		}
+		return okResult()
+	}
+	return okResult()
+}
+
+func (c *call) addTag(tag string) {
+	if tag != "" && !c.hasTag(tag) {
+		c.Tags = append(c.Tags, Tag{Tag: tag})
+	}
+}
+
+func (c *call) hasTag(tag string) bool {
+	return slices.ContainsFunc(c.Tags, func(t Tag) bool { return t.Tag == tag })
+}
+
+func (c *call) tagNames() []string {
+	names := make([]string, len(c.Tags))
+	for i, t := range c.Tags {
+		names[i] = t.Tag
+	}
+	return names
+}
+
+// query describes the call as rtpengine's query does: its tags one second
+// apart in the order they were added, then its subscriptions.
+func (c *call) query() map[string]interface{} {
+	tags := map[string]interface{}{}
+	for i, t := range c.Tags {
+		codec := t.Codec
+		if codec == "" {
+			codec = "PCMU"
+		}
+		tag := map[string]interface{}{
+			"tag":     t.Tag,
+			"created": c.Created.Unix() + int64(i),
+			"medias": []interface{}{map[string]interface{}{
+				"index":    1,
+				"type":     "audio",
+				"protocol": "RTP/AVP",
+				"codec":    codec,
+				"codecs":   []interface{}{codec + "/8000"},
+				"streams": []interface{}{map[string]interface{}{
+					"local address": "127.0.0.1",
+					"local port":    30000 + 2*i,
+				}},
+			}},
+		}
+		if t.Label != "" {
+			tag["label"] = t.Label
+		}
+		if len(c.Tags) == 2 {
+			tag["in dialogue with"] = c.Tags[1-i].Tag
+		}
+		tags[t.Tag] = tag
+	}
+	for subTag, at := range c.subscribed {
+		tags[subTag] = map[string]interface{}{"tag": subTag, "created": at.Unix()}
+	}
+	return map[string]interface{}{
+		"result":      "ok",
+		"created":     c.Created.Unix(),
+		"last signal": c.Created.Unix(),
+		"tags":        tags,
+	}
+}
+
+// offerSDP is a WebRTC offer of one send-only PCMU section per subscribed
+// tag, with fresh ICE credentials and fingerprint.
+func offerSDP(sections int) string {
+	var b strings.Builder
+	b.WriteString("v=0\r\no=- 1 1 IN IP4 127.0.0.1\r\ns=rtpenginetest\r\nt=0 0\r\na=ice-lite\r\n")
+	for i := range sections {
+		ufrag, pwd, fingerprint := random(4), random(12), random(32)
+		fmt.Fprintf(&b, "m=audio %d UDP/TLS/RTP/SAVPF 0\r\n", 40000+2*i)
+		b.WriteString("c=IN IP4 127.0.0.1\r\n")
+		fmt.Fprintf(&b, "a=mid:%d\r\n", i)
+		b.WriteString("a=rtpmap:0 PCMU/8000\r\na=sendonly\r\na=rtcp-mux\r\na=setup:actpass\r\n")
+		fmt.Fprintf(&b, "a=ice-ufrag:%x\r\na=ice-pwd:%x\r\n", ufrag, pwd)
+		b.WriteString("a=fingerprint:sha-256 ")
+		for j, v := range fingerprint {
+			if j > 0 {
+				b.WriteByte(':')
+			}
+			fmt.Fprintf(&b, "%02X", v)
+		}
+		b.WriteString("\r\n")
+		fmt.Fprintf(&b, "a=candidate:1 1 UDP 2130706431 127.0.0.1 %d typ host\r\n", 40000+2*i)
+	}
+	return b.String()
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
@@ -0,0 +1,86 @@
+package rtpenginetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/civilcoder55/rtpengine-mon/internal/rtpengine"
+)
+
+func TestServer(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.AddCall(Call{ID: "call-1", Tags: []Tag{{Tag: "caller", Label: "agent"}, {Tag: "callee", Codec: "opus"}}})
+	s.AddCall(Call{ID: "call-2", Tags: []Tag{{Tag: "a"}}})
+
+	c, err := rtpengine.NewClient(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	calls, err := c.ListCalls(ctx, rtpengine.ListOptions{})
+	if err != nil || !slices.Equal(calls, []string{"call-1", "call-2"}) {
+		t.Fatalf("ListCalls() = %v, %v", calls, err)
+	}
+
+	call, err := c.QueryCall(ctx, "call-1")
+	if err != nil {
+		t.Fatalf("QueryCall() error = %v", err)
+	}
+	tags, _ := call["tags"].(map[string]interface{})
+	caller, _ := tags["caller"].(map[string]interface{})
+	if caller["label"] != "agent" || caller["in dialogue with"] != "callee" {
+		t.Errorf("caller = %v, want labelled agent in dialogue with callee", caller)
+	}
+	if _, err := c.QueryCall(ctx, "missing"); err == nil {
+		t.Error("QueryCall() of an unknown call succeeded")
+	}
+
+	resp, err := c.SubscribeAll(ctx, "call-1")
+	if err != nil {
+		t.Fatalf("SubscribeAll() error = %v", err)
+	}
+	sdp, _ := resp["sdp"].(string)
+	toTag, _ := resp["to-tag"].(string)
+	if strings.Count(sdp, "m=audio") != 2 || !strings.Contains(sdp, "UDP/TLS/RTP/SAVPF") || toTag == "" {
+		t.Errorf("subscription = %v, want a WebRTC offer of both tags", resp)
+	}
+	if _, err := c.SubscribeAnswer(ctx, "call-1", "v=0\r\n", toTag); err != nil {
+		t.Errorf("SubscribeAnswer() error = %v", err)
+	}
+	if got := s.Subscriptions("call-1"); !slices.Equal(got, []string{toTag}) {
+		t.Errorf("Subscriptions() = %v, want [%s]", got, toTag)
+	}
+	if _, err := c.UnSubscribe(ctx, "call-1", toTag); err != nil {
+		t.Errorf("UnSubscribe() error = %v", err)
+	}
+	if got := s.Subscriptions("call-1"); len(got) != 0 {
+		t.Errorf("Subscriptions() after unsubscribing = %v", got)
+	}
+
+	s.OnSubscribe(func(callID string, fromTags []string) (map[string]interface{}, error) {
+		return nil, errors.New("Subscriptions disabled")
+	})
+	if _, err := c.Subscribe(ctx, "call-1", "caller"); err == nil || !strings.Contains(err.Error(), "Subscriptions disabled") {
+		t.Errorf("Subscribe() error = %v, want the scripted error", err)
+	}
+
+	s.RemoveCall("call-2")
+	if calls, _ := c.ListCalls(ctx, rtpengine.ListOptions{}); !slices.Equal(calls, []string{"call-1"}) {
+		t.Errorf("ListCalls() after removing call-2 = %v", calls)
+	}
+	if reqs := s.Requests(); len(reqs) == 0 || reqs[0].Command != "ping" {
+		t.Errorf("Requests() = %v, want the ping first", reqs)
+	}
+}
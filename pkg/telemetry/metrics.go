@@ -0,0 +1,243 @@
+package telemetry
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// openMetricsContentType is the exposition format that carries exemplars.
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// MetricsHandler serves the collected metrics in the OpenMetrics text format.
+// Measurements taken inside a sampled span carry its trace and span IDs as
+// exemplars, so a latency spike in Grafana links to the matching trace.
+type MetricsHandler struct {
+	reader *metric.ManualReader
+	// labels are added to every sample.
+	labels []attribute.KeyValue
+}
+
+// InitMeter installs a global meter provider whose metrics are served by the
+// returned handler, every sample carrying labels.
+func InitMeter(labels map[string]string) (*metric.MeterProvider, *MetricsHandler) {
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(
+		metric.WithReader(reader),
+		metric.WithExemplarFilter(exemplar.TraceBasedFilter),
+	)
+	otel.SetMeterProvider(provider)
+	return provider, &MetricsHandler{reader: reader, labels: attributes(labels)}
+}
+
+// attributes returns labels as attributes sorted by key.
+func attributes(labels map[string]string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		attrs = append(attrs, attribute.String(key, labels[key]))
+	}
+	return attrs
+}
+
+func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var rm metricdata.ResourceMetrics
+	if err := h.reader.Collect(r.Context(), &rm); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", openMetricsContentType)
+	WriteOpenMetrics(w, &rm, h.labels...)
+}
+
+// WriteOpenMetrics writes rm in the OpenMetrics text format, adding labels
+// to every sample that does not carry them already.
+func WriteOpenMetrics(w io.Writer, rm *metricdata.ResourceMetrics, labels ...attribute.KeyValue) error {
+	bw := bufio.NewWriter(w)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			writeMetric(bw, m, labels)
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+func writeMetric(w *bufio.Writer, m metricdata.Metrics, labels []attribute.KeyValue) {
+	name := metricName(m.Name, m.Unit)
+	switch data := m.Data.(type) {
+	case metricdata.Histogram[float64]:
+		writeHistogram(w, name, m.Description, data, labels)
+	case metricdata.Histogram[int64]:
+		writeHistogram(w, name, m.Description, data, labels)
+	case metricdata.Sum[float64]:
+		writeSum(w, name, m.Description, data, labels)
+	case metricdata.Sum[int64]:
+		writeSum(w, name, m.Description, data, labels)
+	case metricdata.Gauge[float64]:
+		writeHeader(w, name, "gauge", m.Description)
+		for _, dp := range data.DataPoints {
+			writeSample(w, name, dp.Attributes, labels, formatValue(dp.Value), "")
+		}
+	case metricdata.Gauge[int64]:
+		writeHeader(w, name, "gauge", m.Description)
+		for _, dp := range data.DataPoints {
+			writeSample(w, name, dp.Attributes, labels, formatValue(dp.Value), "")
+		}
+	}
+}
+
+func writeSum[N int64 | float64](w *bufio.Writer, name, desc string, data metricdata.Sum[N], labels []attribute.KeyValue) {
+	if !data.IsMonotonic {
+		writeHeader(w, name, "gauge", desc)
+		for _, dp := range data.DataPoints {
+			writeSample(w, name, dp.Attributes, labels, formatValue(dp.Value), "")
+		}
+		return
+	}
+
+	name = strings.TrimSuffix(name, "_total")
+	writeHeader(w, name, "counter", desc)
+	for _, dp := range data.DataPoints {
+		writeSample(w, name+"_total", dp.Attributes, labels, formatValue(dp.Value), formatExemplar(latestExemplar(dp.Exemplars)))
+	}
+}
+
+func writeHistogram[N int64 | float64](w *bufio.Writer, name, desc string, data metricdata.Histogram[N], labels []attribute.KeyValue) {
+	writeHeader(w, name, "histogram", desc)
+	for _, dp := range data.DataPoints {
+		// Each exemplar belongs to the first bucket whose bound covers it.
+		bucketExemplars := make([]*metricdata.Exemplar[N], len(dp.BucketCounts))
+		for i := range dp.Exemplars {
+			ex := &dp.Exemplars[i]
+			idx := sort.SearchFloat64s(dp.Bounds, float64(ex.Value))
+			if prev := bucketExemplars[idx]; prev == nil || ex.Time.After(prev.Time) {
+				bucketExemplars[idx] = ex
+			}
+		}
+
+		var cumulative uint64
+		for i, count := range dp.BucketCounts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(dp.Bounds) {
+				le = formatValue(dp.Bounds[i])
+			}
+			writeSample(w, name+"_bucket", dp.Attributes, labels, strconv.FormatUint(cumulative, 10), formatExemplar(bucketExemplars[i]), attribute.String("le", le))
+		}
+		writeSample(w, name+"_sum", dp.Attributes, labels, formatValue(dp.Sum), "")
+		writeSample(w, name+"_count", dp.Attributes, labels, strconv.FormatUint(dp.Count, 10), "")
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, kind, desc string) {
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	if desc != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, escape(desc))
+	}
+}
+
+// writeSample writes one sample labelled with attrs, then the labels its
+// attributes lack, then extra.
+func writeSample(w *bufio.Writer, name string, attrs attribute.Set, labels []attribute.KeyValue, value, exemplar string, extra ...attribute.KeyValue) {
+	all := attrs.ToSlice()
+	for _, kv := range labels {
+		if !attrs.HasValue(kv.Key) {
+			all = append(all, kv)
+		}
+	}
+	w.WriteString(name)
+	writeLabels(w, append(all, extra...))
+	w.WriteString(" ")
+	w.WriteString(value)
+	w.WriteString(exemplar)
+	w.WriteString("\n")
+}
+
+// formatExemplar renders the trace an exemplar was recorded in, or nothing
+// for measurements taken outside a sampled span.
+func formatExemplar[N int64 | float64](ex *metricdata.Exemplar[N]) string {
+	if ex == nil || len(ex.TraceID) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(` # {trace_id="%s",span_id="%s"} %s %s`,
+		hex.EncodeToString(ex.TraceID), hex.EncodeToString(ex.SpanID),
+		formatValue(ex.Value), formatTimestamp(ex.Time))
+}
+
+func writeLabels(w *bufio.Writer, attrs []attribute.KeyValue) {
+	if len(attrs) == 0 {
+		return
+	}
+	w.WriteString("{")
+	for i, kv := range attrs {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		fmt.Fprintf(w, `%s="%s"`, sanitize(string(kv.Key)), escape(kv.Value.Emit()))
+	}
+	w.WriteString("}")
+}
+
+func latestExemplar[N int64 | float64](exemplars []metricdata.Exemplar[N]) *metricdata.Exemplar[N] {
+	var latest *metricdata.Exemplar[N]
+	for i := range exemplars {
+		if latest == nil || exemplars[i].Time.After(latest.Time) {
+			latest = &exemplars[i]
+		}
+	}
+	return latest
+}
+
+// metricName converts an OpenTelemetry name and unit to a Prometheus name,
+// e.g. http.server.request.duration in s to http_server_request_duration_seconds.
+func metricName(name, unit string) string {
+	name = sanitize(name)
+	suffix := map[string]string{"s": "seconds", "ms": "milliseconds", "By": "bytes"}[unit]
+	if suffix != "" && !strings.HasSuffix(name, "_"+suffix) {
+		name += "_" + suffix
+	}
+	return name
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatValue[N int64 | float64](v N) string {
+	f := float64(v)
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
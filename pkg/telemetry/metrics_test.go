@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestMetricsHandlerExemplars(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	meter := provider.Meter("test")
+	h := &MetricsHandler{reader: reader}
+
+	latency, _ := meter.Float64Histogram("http.server.request.duration", metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.1, 1))
+	requests, _ := meter.Int64Counter("spy.requests_total")
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	latency.Record(ctx, 0.5)
+	latency.Record(context.Background(), 0.05)
+	requests.Add(ctx, 1)
+	span.End()
+	traceID := span.SpanContext().TraceID().String()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE http_server_request_duration_seconds histogram\n",
+		`http_server_request_duration_seconds_bucket{le="0.1"} 1` + "\n",
+		`http_server_request_duration_seconds_bucket{le="1"} 2 # {trace_id="` + traceID + `"`,
+		`http_server_request_duration_seconds_bucket{le="+Inf"} 2` + "\n",
+		"http_server_request_duration_seconds_count 2\n",
+		"# TYPE spy_requests counter\n",
+		`spy_requests_total 1 # {trace_id="` + traceID + `"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("expected output to end with # EOF")
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+}
+
+func TestMetricsHandlerLabels(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	meter := provider.Meter("test")
+	h := &MetricsHandler{reader: reader, labels: attributes(map[string]string{"team": "voip", "datacenter": "fra1"})}
+
+	requests, _ := meter.Int64Counter("spy.requests_total")
+	requests.Add(context.Background(), 1, metric.WithAttributes(attribute.String("team", "own")))
+	latency, _ := meter.Float64Histogram("latency", metric.WithExplicitBucketBoundaries(1))
+	latency.Record(context.Background(), 0.5)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`spy_requests_total{team="own",datacenter="fra1"} 1` + "\n",
+		`latency_bucket{datacenter="fra1",team="voip",le="1"} 1` + "\n",
+		`latency_count{datacenter="fra1",team="voip"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -13,8 +13,9 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 )
 
-// InitTracer initializes an OpenTelemetry tracer.
-func InitTracer(ctx context.Context, endpoint string) (*trace.TracerProvider, error) {
+// InitTracer initializes an OpenTelemetry tracer. Labels are added to the
+// resource of every span.
+func InitTracer(ctx context.Context, endpoint string, labels map[string]string) (*trace.TracerProvider, error) {
 	if endpoint == "" {
 		return nil, nil
 	}
@@ -23,6 +24,7 @@ func InitTracer(ctx context.Context, endpoint string) (*trace.TracerProvider, er
 		resource.WithAttributes(
 			semconv.ServiceName("rtpengine-mon"),
 		),
+		resource.WithAttributes(attributes(labels)...),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
@@ -7,11 +7,83 @@ const state = {
     animationFrame: null,
     currentCallDetails: null,
     currentView: 'stats',
-    statsInterval: null
+    statsInterval: null,
+    callStream: null,
+    detailsCallID: null,
+    recording: false,
+    denoise: localStorage.getItem('denoise') === 'true',
+    normalize: localStorage.getItem('normalize') !== 'false',
+    playbackGraph: null,
+    remoteStream: null,
+    muted: { from: false, to: false },
+    ranked: localStorage.getItem('ranked') === 'true'
 };
 
 // --- API ---
 
+// apiFetch attaches the API key stored in localStorage and asks for one when
+// the server rejects the request.
+async function apiFetch(url, options = {}) {
+    const key = localStorage.getItem('apiKey');
+    const headers = { ...(options.headers || {}) };
+    if (key) headers['X-API-Key'] = key;
+
+    const res = await fetch(url, { ...options, headers });
+    if (res.status === 401) {
+        const entered = prompt('API key');
+        if (entered) {
+            localStorage.setItem('apiKey', entered);
+            return apiFetch(url, options);
+        }
+    }
+    return res;
+}
+
+// --- Preferences ---
+
+// preferenceKeys are the settings saved on the server per user, so they
+// follow a supervisor across machines. localStorage keeps them when
+// persistence is disabled.
+const preferenceKeys = ['denoise', 'normalize', 'ranked'];
+
+async function loadPreferences() {
+    try {
+        const res = await apiFetch('/preferences');
+        if (!res.ok) return;
+        const { settings } = await res.json();
+        const rankedBefore = state.ranked;
+        for (const key of preferenceKeys) {
+            if (typeof settings[key] !== 'boolean') continue;
+            state[key] = settings[key];
+            localStorage.setItem(key, settings[key]);
+        }
+        renderPreferences();
+        applyPlayback();
+        if (state.ranked !== rankedBefore) fetchCalls();
+    } catch (e) {
+        console.error('Failed to load preferences', e);
+    }
+}
+
+async function savePreferences() {
+    const settings = Object.fromEntries(preferenceKeys.map(key => [key, state[key]]));
+    try {
+        await apiFetch('/preferences', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(settings)
+        });
+    } catch (e) {
+        console.error('Failed to save preferences', e);
+    }
+}
+
+function renderPreferences() {
+    document.getElementById('denoise-toggle').checked = state.denoise;
+    document.getElementById('normalize-toggle').checked = state.normalize;
+    document.getElementById('rank-toggle').checked = state.ranked;
+}
+
 function showView(view, navLink) {
     state.currentView = view;
 
@@ -31,7 +103,9 @@ function showView(view, navLink) {
             state.statsInterval = null;
         }
         fetchCalls();
+        streamCalls();
     } else {
+        stopCallStream();
         monitorView.classList.add('hidden');
         statsView.classList.remove('hidden');
         statsView.innerHTML = '<div class="mono" style="padding: 2rem; color: var(--text-secondary)">Loading statistics...</div>';
@@ -46,7 +120,7 @@ function showView(view, navLink) {
 async function fetchStats() {
     if (state.currentView !== 'stats') return;
     try {
-        const res = await fetch('/stats');
+        const res = await apiFetch('/stats');
         if (!res.ok) throw new Error('Failed to fetch stats');
         const data = await res.json();
 
@@ -115,10 +189,10 @@ function renderStats(stats) {
 
 async function fetchCalls() {
     try {
-        const res = await fetch('/calls');
+        const res = await apiFetch(state.ranked ? '/calls/ranked' : '/calls?audio=true');
         if (!res.ok) throw new Error('Network response was not ok');
         const calls = await res.json();
-        const newCallObjects = (calls || []).map(id => ({ id, status: 'Active' }));
+        const newCallObjects = (calls || []).map(c => ({ id: c.call_id, status: 'Active', audio: c.audio, score: c.score, reasons: c.reasons }));
 
         // Update connection status
         const statusEl = document.getElementById('connection-status');
@@ -169,15 +243,31 @@ async function startSpying(callID) {
         }
     };
 
+    pc.ondatachannel = (event) => {
+        event.channel.onmessage = (msg) => {
+            const update = JSON.parse(msg.data);
+            if (update.type === 'legs_changed') {
+                logToTerminal(`Call legs changed (${update.changed.join(', ')}), following new tags`);
+            } else if (update.type === 'echo') {
+                logToTerminal(`Both legs carry the same audio (${update.delay_ms} ms apart): echo or media loop`);
+            } else if (update.type === 'quality') {
+                renderQuality('quality-from', update.from);
+                renderQuality('quality-to', update.to);
+            }
+        };
+    };
+
     pc.ontrack = (event) => {
         logToTerminal(`Audio track received`);
         const audio = document.getElementById('remoteAudio');
         const stream = event.streams[0] || new MediaStream([event.track]);
         audio.srcObject = stream;
+        state.remoteStream = stream;
+        applyPlayback();
     };
 
     try {
-        const res = await fetch(`/spy/${callID}`, {
+        const res = await apiFetch(`/spy/${callID}`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ from_tag: "", to_tag: "" })
@@ -185,14 +275,23 @@ async function startSpying(callID) {
 
         if (!res.ok) throw new Error(await res.text());
 
-        const { spyID, sdp } = await res.json();
+        const { spyID, sdp, duplicate } = await res.json();
+        if (duplicate) {
+            // A concurrent request for this call already owns the session.
+            logToTerminal(`Reusing spy session: ${spyID}`);
+            pc.close();
+            return;
+        }
+        // The session lives on the replica that owns the call, which may
+        // differ from this one when the offer request was redirected.
+        const origin = new URL(res.url).origin;
         logToTerminal(`Spy session created: ${spyID}`);
 
         await pc.setRemoteDescription({ type: 'offer', sdp });
         const answer = await pc.createAnswer();
         await pc.setLocalDescription(answer);
 
-        const ansRes = await fetch(`/spy/answer/${spyID}`, {
+        const ansRes = await apiFetch(`${origin}/spy/answer/${spyID}`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ sdp: pc.localDescription.sdp })
@@ -201,7 +300,8 @@ async function startSpying(callID) {
         if (!ansRes.ok) throw new Error(await ansRes.text());
 
         logToTerminal("Spying handshake complete");
-        state.activeSpy = { pc, id: spyID };
+        const statsTimer = setInterval(() => uploadClientStats(origin, spyID, pc), 10000);
+        state.activeSpy = { pc, id: spyID, callID, statsTimer };
     } catch (err) {
         logToTerminal(`Error: ${err.message}`);
         updateStreamStatus('No active stream', false);
@@ -209,23 +309,223 @@ async function startSpying(callID) {
     }
 }
 
+// uploadClientStats summarizes the browser end of the spy leg so it can be
+// compared with the media the server receives from rtpengine.
+async function uploadClientStats(origin, spyID, pc) {
+    const summary = {
+        packets_received: 0,
+        packets_lost: 0,
+        bytes_received: 0,
+        jitter: 0,
+        round_trip_time: 0,
+        concealed_samples: 0
+    };
+
+    const report = await pc.getStats();
+    report.forEach(s => {
+        if (s.type === 'inbound-rtp' && s.kind === 'audio') {
+            summary.packets_received += s.packetsReceived || 0;
+            summary.packets_lost += s.packetsLost || 0;
+            summary.bytes_received += s.bytesReceived || 0;
+            summary.concealed_samples += s.concealedSamples || 0;
+            summary.jitter = Math.max(summary.jitter, s.jitter || 0);
+        } else if (s.type === 'candidate-pair' && s.nominated && s.currentRoundTripTime !== undefined) {
+            summary.round_trip_time = s.currentRoundTripTime;
+        }
+    });
+
+    try {
+        await apiFetch(`${origin}/spy/${spyID}/client-stats`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(summary)
+        });
+    } catch (err) {
+        console.error('Failed to upload client stats:', err);
+    }
+}
+
 function stopSpy() {
     if (state.activeSpy) {
         logToTerminal(`Stopping spy session...`);
+        clearInterval(state.activeSpy.statsTimer);
         state.activeSpy.pc.close();
         state.activeSpy = null;
     }
     const audio = document.getElementById('remoteAudio');
     if (audio) audio.srcObject = null;
+    state.remoteStream = null;
+    applyPlayback();
     updateStreamStatus('No active stream', false);
+    renderQuality('quality-from', null);
+    renderQuality('quality-to', null);
+    state.muted = { from: false, to: false };
+    renderMute();
 
     // Hide Spy Modal
     const spyOverlay = document.getElementById('spy-overlay');
     if (spyOverlay) spyOverlay.classList.add('hidden');
 }
 
+// toggleMute silences or restores the media a leg of the call sends, for
+// everyone on the call and not only the supervisor.
+async function toggleMute(leg) {
+    if (!state.activeSpy) return;
+    const action = state.muted[leg] ? 'unsilence' : 'silence';
+    try {
+        const res = await apiFetch(`/calls/${state.activeSpy.callID}/media`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ action, leg })
+        });
+        if (!res.ok) throw new Error((await res.json()).error || res.statusText);
+        state.muted[leg] = !state.muted[leg];
+        logToTerminal(`${action === 'silence' ? 'Muted' : 'Unmuted'} ${leg === 'from' ? 'caller' : 'callee'}`);
+    } catch (e) {
+        logToTerminal(`Mute failed: ${e.message}`);
+    }
+    renderMute();
+}
+
+// sendDTMF plays the entered digits to a leg, e.g. to drive an IVR.
+async function sendDTMF(leg) {
+    const input = document.getElementById('dtmf-digits');
+    const digits = input.value.trim();
+    if (!state.activeSpy || !digits) return;
+    try {
+        const res = await apiFetch(`/calls/${state.activeSpy.callID}/dtmf`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ action: 'play', leg, digits })
+        });
+        if (!res.ok) throw new Error((await res.json()).error || res.statusText);
+        logToTerminal(`Played DTMF to ${leg === 'from' ? 'caller' : 'callee'}`);
+        input.value = '';
+    } catch (e) {
+        logToTerminal(`DTMF failed: ${e.message}`);
+    }
+}
+
+function renderMute() {
+    for (const [leg, name] of [['from', 'caller'], ['to', 'callee']]) {
+        const btn = document.getElementById(`mute-${leg}`);
+        if (!btn) continue;
+        btn.textContent = `${state.muted[leg] ? 'Unmute' : 'Mute'} ${name}`;
+        btn.classList.toggle('muted', state.muted[leg]);
+    }
+}
+
+// setRanked orders the call list by how much each call needs a supervisor
+// and remembers the choice.
+function setRanked(enabled) {
+    state.ranked = enabled;
+    localStorage.setItem('ranked', enabled);
+    savePreferences();
+    fetchCalls();
+}
+
+// setDenoise turns noise suppression of the spy player on or off and
+// remembers the choice.
+function setDenoise(enabled) {
+    state.denoise = enabled;
+    localStorage.setItem('denoise', enabled);
+    savePreferences();
+    applyPlayback();
+}
+
+// setNormalize turns loudness normalization of the legs on or off and
+// remembers the choice.
+function setNormalize(enabled) {
+    state.normalize = enabled;
+    localStorage.setItem('normalize', enabled);
+    savePreferences();
+    applyPlayback();
+}
+
+// applyPlayback plays the remote stream through Web Audio while noise
+// suppression or loudness normalization is on, instead of the audio element.
+// Each leg is its own track: legs are levelled separately before they are
+// mixed, and the mix is then denoised. Only this browser's playback is
+// processed, never the call or recordings.
+async function applyPlayback() {
+    const audio = document.getElementById('remoteAudio');
+    if (state.playbackGraph) {
+        state.playbackGraph.forEach(node => node.disconnect());
+        state.playbackGraph = null;
+    }
+    if (audio) audio.muted = false;
+    if (!(state.denoise || state.normalize) || !state.remoteStream) return;
+
+    try {
+        if (!state.audioContext) {
+            state.audioContext = new AudioContext();
+            await Promise.all([
+                state.audioContext.audioWorklet.addModule('denoise-worklet.js'),
+                state.audioContext.audioWorklet.addModule('loudness-worklet.js')
+            ]);
+        }
+        const ctx = state.audioContext;
+        await ctx.resume();
+        // The stream may have ended or the settings changed while loading.
+        if (!(state.denoise || state.normalize) || !state.remoteStream || state.playbackGraph) return;
+
+        const graph = [];
+        const mix = new GainNode(ctx);
+        graph.push(mix);
+        state.remoteStream.getAudioTracks().forEach(track => {
+            const source = ctx.createMediaStreamSource(new MediaStream([track]));
+            graph.push(source);
+            if (state.normalize) {
+                const level = new AudioWorkletNode(ctx, 'loudness');
+                graph.push(level);
+                source.connect(level).connect(mix);
+            } else {
+                source.connect(mix);
+            }
+        });
+
+        let out = mix;
+        if (state.denoise) {
+            // Band-limit to telephony speech before gating.
+            const highpass = new BiquadFilterNode(ctx, { type: 'highpass', frequency: 100 });
+            const lowpass = new BiquadFilterNode(ctx, { type: 'lowpass', frequency: 3800 });
+            const gate = new AudioWorkletNode(ctx, 'denoise');
+            graph.push(highpass, lowpass, gate);
+            out = out.connect(highpass).connect(lowpass).connect(gate);
+        }
+        if (state.normalize) {
+            // Catch peaks of boosted legs talking over each other.
+            const limiter = new DynamicsCompressorNode(ctx, { threshold: -3, knee: 0, ratio: 20, attack: 0.003, release: 0.1 });
+            graph.push(limiter);
+            out = out.connect(limiter);
+        }
+        out.connect(ctx.destination);
+        state.playbackGraph = graph;
+        // The element keeps the stream flowing but no longer plays it.
+        if (audio) audio.muted = true;
+    } catch (err) {
+        logToTerminal(`Audio processing unavailable: ${err.message}`);
+    }
+}
+
 // --- UI Rendering ---
 
+// renderQuality shows the MOS of one leg of the watched call. Scores reflect
+// the caller's or callee's network as rtpengine sees it, not the spy stream.
+function renderQuality(id, score) {
+    const el = document.getElementById(id);
+    if (!el) return;
+    el.classList.remove('good', 'fair', 'bad');
+    if (!score) {
+        el.textContent = 'no RTCP';
+        el.title = '';
+        return;
+    }
+    el.textContent = `MOS ${score.mos.toFixed(1)}`;
+    el.title = `jitter ${score.jitter_ms} ms, loss ${score.loss_percent}%, rtt ${score.rtt_ms} ms`;
+    el.classList.add(score.mos >= 4 ? 'good' : score.mos >= 3.1 ? 'fair' : 'bad');
+}
+
 function renderCalls() {
     const container = document.getElementById('calls-list');
     if (!container) return;
@@ -242,16 +542,7 @@ function renderCalls() {
         return;
     }
 
-    let rowsHtml = state.calls.map(call => `
-        <tr>
-            <td class="mono">${call.id.substring(0, 24)}...</td>
-            <td><span class="status-badge">Active</span></td>
-            <td style="text-align: right;">
-                <button class="btn-primary" onclick="startSpying('${call.id}')">Spy</button>
-                <button class="btn-text" style="display:inline-block; margin-left: 10px;" onclick="viewDetails('${call.id}')">Details</button>
-            </td>
-        </tr>
-    `).join('');
+    let rowsHtml = state.calls.map(callRow).join('');
 
     container.innerHTML = `
         <table class="data-table">
@@ -259,14 +550,135 @@ function renderCalls() {
                 <tr>
                     <th>CALL ID</th>
                     <th>STATUS</th>
+                    <th>AUDIO</th>
                     <th style="text-align: right;">ACTIONS</th>
                 </tr>
             </thead>
-            <tbody>${rowsHtml}</tbody>
+            <tbody id="calls-body">${rowsHtml}</tbody>
         </table>
     `;
 }
 
+function callRow(call) {
+    // Calls on hold music, ringback or silence are dimmed so supervisors can skip them.
+    const audioBadge = (audio) => {
+        if (!audio) return '<span style="color: var(--text-muted);">-</span>';
+        const idle = ['music', 'ringback', 'silence'];
+        const stuck = idle.includes(audio.from) && idle.includes(audio.to);
+        const echo = audio.echo
+            ? ` <span class="status-badge danger" title="Both legs carry the same audio, ${audio.echo_delay_ms} ms apart">echo</span>`
+            : '';
+        return `<span class="status-badge${stuck ? ' muted' : ''}">${audio.from} / ${audio.to}</span>${echo}`;
+    };
+
+    const reasons = (call.reasons || []).map(r => r.replace('_', ' ')).join(', ');
+    const priority = call.score
+        ? ` <span class="status-badge danger" title="${reasons}">priority ${call.score}</span>`
+        : '';
+
+    return `
+        <tr data-call-id="${call.id}">
+            <td class="mono">${call.id.substring(0, 24)}...</td>
+            <td><span class="status-badge">Active</span>${priority}</td>
+            <td>${audioBadge(call.audio)}</td>
+            <td style="text-align: right;">
+                <button class="btn-primary" onclick="startSpying('${call.id}')">Spy</button>
+                <button class="btn-text" style="display:inline-block; margin-left: 10px;" onclick="viewDetails('${call.id}')">Details</button>
+            </td>
+        </tr>
+    `;
+}
+
+// streamCalls keeps the call list live from /calls/events. Only the rows
+// named in each diff are touched, so large lists are not re-rendered on
+// every poll. Without the stream the list is refreshed manually.
+async function streamCalls() {
+    if (state.callStream) return;
+    const controller = new AbortController();
+    state.callStream = controller;
+
+    try {
+        const res = await apiFetch('/calls/events', { signal: controller.signal });
+        if (!res.ok) {
+            state.callStream = null;
+            return;
+        }
+        const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+        let buffer = '';
+        while (true) {
+            const { value, done } = await reader.read();
+            if (done) break;
+            buffer += value;
+            let end;
+            while ((end = buffer.indexOf('\n\n')) !== -1) {
+                const data = buffer.slice(0, end).split('\n')
+                    .filter(line => line.startsWith('data: '))
+                    .map(line => line.slice(6))
+                    .join('\n');
+                buffer = buffer.slice(end + 2);
+                if (data) applyCallDiff(JSON.parse(data));
+            }
+        }
+    } catch (err) {
+        if (err.name === 'AbortError') return;
+        console.error('Call stream failed:', err);
+    }
+
+    // The server drops clients that fall behind; reconnect for a snapshot.
+    if (state.callStream === controller) {
+        state.callStream = null;
+        setTimeout(() => {
+            if (state.currentView === 'calls') streamCalls();
+        }, 2000);
+    }
+}
+
+function stopCallStream() {
+    if (state.callStream) {
+        const controller = state.callStream;
+        state.callStream = null;
+        controller.abort();
+    }
+}
+
+function applyCallDiff(diff) {
+    // Ranks depend on the whole list, so the server ranks it again.
+    if (state.ranked) {
+        fetchCalls();
+        return;
+    }
+    const toCall = c => ({ id: c.call_id, status: 'Active', audio: c.audio });
+    if (diff.reset) {
+        state.calls = (diff.added || []).map(toCall);
+        renderCalls();
+        return;
+    }
+
+    const removed = new Set(diff.removed || []);
+    const changed = new Map((diff.changed || []).map(c => [c.call_id, toCall(c)]));
+    const added = (diff.added || []).map(toCall);
+    const wasEmpty = state.calls.length === 0;
+    state.calls = state.calls
+        .filter(call => !removed.has(call.id))
+        .map(call => changed.get(call.id) || call)
+        .concat(added);
+
+    const body = document.getElementById('calls-body');
+    if (!body || wasEmpty || state.calls.length === 0) {
+        renderCalls();
+        return;
+    }
+    body.querySelectorAll('tr[data-call-id]').forEach(row => {
+        const id = row.dataset.callId;
+        if (removed.has(id)) {
+            row.remove();
+        } else if (changed.has(id)) {
+            row.outerHTML = callRow(changed.get(id));
+        }
+    });
+    if (added.length) body.insertAdjacentHTML('beforeend', added.map(callRow).join(''));
+}
+
 function updateStreamStatus(text, isActive) {
     const indicator = document.getElementById('stream-status-indicator');
     const textEl = document.getElementById('stream-status-text');
@@ -321,9 +733,11 @@ async function viewDetails(id) {
     title.textContent = id;
     content.innerHTML = '<div class="mono" style="color:var(--text-secondary)">Loading...</div>';
     overlay.classList.remove('hidden');
+    state.detailsCallID = id;
+    loadRecordingState(id);
 
     try {
-        const res = await fetch(`/calls/${id}`);
+        const res = await apiFetch(`/calls/${id}`);
         const data = await res.json();
         state.currentCallDetails = data;
         renderTab('json');
@@ -332,6 +746,43 @@ async function viewDetails(id) {
     }
 }
 
+// loadRecordingState shows whether rtpengine records the call. Without
+// persistence the state is unknown and assumed off.
+async function loadRecordingState(id) {
+    state.recording = false;
+    try {
+        const res = await apiFetch(`/calls/${id}/recording`);
+        if (res.ok) state.recording = (await res.json()).recording;
+    } catch (e) {
+        console.error('Failed to load recording state:', e);
+    }
+    renderRecordingToggle();
+}
+
+// toggleRecording starts or stops rtpengine's native recording of the call
+// shown in the details modal.
+async function toggleRecording() {
+    const id = state.detailsCallID;
+    const btn = document.getElementById('record-toggle');
+    btn.disabled = true;
+    try {
+        const res = await apiFetch(`/calls/${id}/recording`, { method: state.recording ? 'DELETE' : 'POST' });
+        if (!res.ok) throw new Error((await res.json()).error || res.statusText);
+        state.recording = (await res.json()).recording;
+    } catch (e) {
+        alert(`Recording change failed: ${e.message}`);
+    } finally {
+        btn.disabled = false;
+        renderRecordingToggle();
+    }
+}
+
+function renderRecordingToggle() {
+    const btn = document.getElementById('record-toggle');
+    btn.textContent = state.recording ? 'Stop recording' : 'Start recording';
+    btn.classList.toggle('recording', state.recording);
+}
+
 function closeDetails() {
     document.getElementById('details-overlay').classList.add('hidden');
 }
@@ -497,5 +948,26 @@ function syntaxHighlight(json) {
     });
 }
 
+// openDeepLink opens the call named by the URL fragment, as linked from
+// chat alerts: #call=<id> shows its details and #spy=<id> starts listening.
+function openDeepLink() {
+    const params = new URLSearchParams(location.hash.slice(1));
+    const callID = params.get('spy') || params.get('call');
+    if (!callID) return false;
+    showView('calls', document.querySelector('.nav-link[onclick*="calls"]'));
+    if (params.has('spy')) {
+        startSpying(callID);
+    } else {
+        viewDetails(callID);
+    }
+    return true;
+}
+
+window.addEventListener('hashchange', openDeepLink);
+
 // Init
-showView('stats', document.querySelector('.nav-link[onclick*="stats"]'));
+if (!openDeepLink()) {
+    showView('stats', document.querySelector('.nav-link[onclick*="stats"]'));
+}
+renderPreferences();
+loadPreferences();
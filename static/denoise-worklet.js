@@ -0,0 +1,53 @@
+// Noise suppression for the spy player. It runs only in the supervisor's
+// browser on the audio being played, so the call and its recordings are
+// untouched.
+//
+// The processor is an adaptive noise gate: it follows the noise floor of the
+// signal as the slowly rising minimum of the block energy and attenuates
+// blocks that do not stand clear of it, with smoothed gain changes so speech
+// onsets and tails are not clipped.
+
+const FLOOR_RISE = 1.0005;     // per block, about 3dB/s at 48kHz
+const OPEN_RATIO = 4;          // energy over the floor (6dB) that opens the gate
+const CLOSED_GAIN = 0.1;       // -20dB on noise-only blocks
+const ATTACK = 0.5;            // gain smoothing when opening
+const RELEASE = 0.02;          // gain smoothing when closing
+const MIN_FLOOR = 1e-8;
+
+class DenoiseProcessor extends AudioWorkletProcessor {
+    constructor() {
+        super();
+        this.floor = MIN_FLOOR;
+        this.gain = 1;
+    }
+
+    process(inputs, outputs) {
+        const input = inputs[0];
+        const output = outputs[0];
+        if (!input.length) return true;
+
+        let energy = 0;
+        for (const channel of input) {
+            for (let i = 0; i < channel.length; i++) energy += channel[i] * channel[i];
+        }
+        energy /= input.length * input[0].length;
+
+        this.floor = Math.max(MIN_FLOOR, Math.min(this.floor * FLOOR_RISE, Math.max(energy, MIN_FLOOR)));
+        const target = energy > this.floor * OPEN_RATIO ? 1 : CLOSED_GAIN;
+        const step = target > this.gain ? ATTACK : RELEASE;
+
+        for (let c = 0; c < output.length; c++) {
+            const src = input[c] || input[0];
+            const dst = output[c];
+            let gain = this.gain;
+            for (let i = 0; i < dst.length; i++) {
+                gain += (target - gain) * step / dst.length;
+                dst[i] = src[i] * gain;
+            }
+            if (c === output.length - 1) this.gain = gain;
+        }
+        return true;
+    }
+}
+
+registerProcessor('denoise', DenoiseProcessor);
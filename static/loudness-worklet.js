@@ -0,0 +1,88 @@
+// Loudness normalization for one leg of the spy player, so a hot trunk leg
+// and a quiet WebRTC leg are heard at the same level. Like the denoise stage
+// it only processes the supervisor's playback.
+//
+// Loudness is measured roughly as EBU R128 does: K-weighted mean square over
+// 400ms blocks, ignoring blocks below a silence gate so pauses are not
+// boosted. The gain moves slowly towards the target and is bounded so line
+// noise on a silent leg is never amplified into something audible.
+
+const TARGET_LUFS = -23;
+const GATE_LUFS = -50;
+const MAX_BOOST_DB = 15;
+const MAX_CUT_DB = 20;
+const BLOCK_SECONDS = 0.4;
+const SMOOTHING = 0.3;         // fraction of the remaining gain change per block
+
+// biquad returns RBJ cookbook coefficients for the BS.1770 K-weighting stages.
+function biquad(type, f0, q, gainDB, fs) {
+    const A = Math.pow(10, gainDB / 40);
+    const w0 = 2 * Math.PI * f0 / fs;
+    const alpha = Math.sin(w0) / (2 * q);
+    const cos = Math.cos(w0);
+    let b, a;
+    if (type === 'highshelf') {
+        const s = 2 * Math.sqrt(A) * alpha;
+        b = [A * ((A + 1) + (A - 1) * cos + s), -2 * A * ((A - 1) + (A + 1) * cos), A * ((A + 1) + (A - 1) * cos - s)];
+        a = [(A + 1) - (A - 1) * cos + s, 2 * ((A - 1) - (A + 1) * cos), (A + 1) - (A - 1) * cos - s];
+    } else {
+        b = [(1 + cos) / 2, -(1 + cos), (1 + cos) / 2];
+        a = [1 + alpha, -2 * cos, 1 - alpha];
+    }
+    return { b0: b[0] / a[0], b1: b[1] / a[0], b2: b[2] / a[0], a1: a[1] / a[0], a2: a[2] / a[0], x1: 0, x2: 0, y1: 0, y2: 0 };
+}
+
+function filter(f, x) {
+    const y = f.b0 * x + f.b1 * f.x1 + f.b2 * f.x2 - f.a1 * f.y1 - f.a2 * f.y2;
+    f.x2 = f.x1; f.x1 = x;
+    f.y2 = f.y1; f.y1 = y;
+    return y;
+}
+
+class LoudnessProcessor extends AudioWorkletProcessor {
+    constructor() {
+        super();
+        this.shelf = biquad('highshelf', 1681.97, 0.7072, 4.0, sampleRate);
+        this.highpass = biquad('highpass', 38.135, 0.5003, 0, sampleRate);
+        this.blockSize = Math.round(BLOCK_SECONDS * sampleRate);
+        this.sum = 0;
+        this.count = 0;
+        this.gainDB = 0;
+        this.gain = 1;
+    }
+
+    process(inputs, outputs) {
+        const input = inputs[0][0];
+        if (!input) return true;
+
+        for (let i = 0; i < input.length; i++) {
+            const k = filter(this.highpass, filter(this.shelf, input[i]));
+            this.sum += k * k;
+        }
+        this.count += input.length;
+        if (this.count >= this.blockSize) {
+            const lufs = -0.691 + 10 * Math.log10(this.sum / this.count + 1e-12);
+            if (lufs > GATE_LUFS) {
+                const wanted = Math.max(-MAX_CUT_DB, Math.min(MAX_BOOST_DB, TARGET_LUFS - lufs));
+                this.gainDB += (wanted - this.gainDB) * SMOOTHING;
+            }
+            this.sum = 0;
+            this.count = 0;
+        }
+
+        // Ramp within the render quantum to avoid zipper noise.
+        const target = Math.pow(10, this.gainDB / 20);
+        for (const out of outputs[0]) {
+            let gain = this.gain;
+            const step = (target - gain) / input.length;
+            for (let i = 0; i < out.length; i++) {
+                gain += step;
+                out[i] = input[i] * gain;
+            }
+        }
+        this.gain = target;
+        return true;
+    }
+}
+
+registerProcessor('loudness', LoudnessProcessor);